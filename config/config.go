@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/connmgr"
@@ -20,23 +22,34 @@ import (
 	"github.com/libp2p/go-libp2p/core/sec"
 	"github.com/libp2p/go-libp2p/core/sec/insecure"
 	"github.com/libp2p/go-libp2p/core/transport"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
 	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
 	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	"github.com/libp2p/go-libp2p/p2p/host/bootstrap"
+	"github.com/libp2p/go-libp2p/p2p/host/debug"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	pstore "github.com/libp2p/go-libp2p/p2p/host/peerstore"
 	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
 	routed "github.com/libp2p/go-libp2p/p2p/host/routed"
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+	"github.com/libp2p/go-libp2p/p2p/net/addrfilter"
+	"github.com/libp2p/go-libp2p/p2p/net/conngater"
+	"github.com/libp2p/go-libp2p/p2p/net/nat64"
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
 	circuitv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
 	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
 	"github.com/prometheus/client_golang/prometheus"
 
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
+	manet "github.com/multiformats/go-multiaddr/net"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 )
@@ -57,6 +70,10 @@ type AutoNATConfig struct {
 	ThrottleGlobalLimit int
 	ThrottlePeerLimit   int
 	ThrottleInterval    time.Duration
+	ServiceDialTimeout  time.Duration
+	// ServiceDialer is the network used to dial back peers.
+	// If nil, a dedicated network is created from the host's transports.
+	ServiceDialer network.Network
 }
 
 type Security struct {
@@ -80,6 +97,13 @@ type Config struct {
 	// using the [ProtocolVersion] option.
 	ProtocolVersion string
 
+	// IdentifyOpts are options for the identify service.
+	IdentifyOpts []identify.Option
+
+	// RequireSignedPeerRecord enables strict signed peer record mode.
+	// It is set using the [RequireSignedPeerRecord] option.
+	RequireSignedPeerRecord bool
+
 	PeerKey crypto.PrivKey
 
 	QUICReuse          []fx.Option
@@ -91,15 +115,25 @@ type Config struct {
 
 	DialTimeout time.Duration
 
+	// StreamEventsSampleRate is the fraction of streams the swarm emits stream
+	// events for, see swarm.WithStreamEvents.
+	StreamEventsSampleRate float64
+	// ConnTraceWriter and ConnTraceFile are where the swarm writes its connection
+	// and stream trace to, see swarm.WithTrace. At most one of them is set.
+	ConnTraceWriter io.Writer
+	ConnTraceFile   *swarm.TraceFile
+
 	RelayCustom bool
 	Relay       bool // should the relay transport be used
 
 	EnableRelayService bool // should we run a circuitv2 relay (if publicly reachable)
 	RelayServiceOpts   []relayv2.Option
 
-	ListenAddrs     []ma.Multiaddr
-	AddrsFactory    bhost.AddrsFactory
-	ConnectionGater connmgr.ConnectionGater
+	ListenAddrs          []ma.Multiaddr
+	AddrsFactory         bhost.AddrsFactory
+	ListenAddrsFactories []bhost.ListenAddrsFactory
+	AddrFilters          *addrfilter.Filters
+	ConnectionGater      connmgr.ConnectionGater
 
 	ConnManager     connmgr.ConnManager
 	ResourceManager network.ResourceManager
@@ -108,24 +142,71 @@ type Config struct {
 	Peerstore  peerstore.Peerstore
 	Reporter   metrics.Reporter
 
+	StaticPortMappings              []bhost.StaticPortMapping
+	StaticPortMappingVerifyInterval time.Duration
+
+	EnableNAT64 bool
+
+	OutboundNegotiationTimeout time.Duration
+	LazyNegotiation            map[protocol.ID]bhost.LazyNegotiation
+
+	EnableProtocolTokens bool
+	ProtocolTokens       []protocol.ID
+
+	DNSAddrs              []ma.Multiaddr
+	VerifyDNSAddrs        bool
+	DNSAddrVerifyInterval time.Duration
+
 	MultiaddrResolver *madns.Resolver
 
 	DisablePing bool
 
+	EnableLatencyMonitor bool
+	LatencyMonitorOpts   []ping.MonitorOption
+
 	Routing RoutingC
 
 	EnableAutoRelay bool
 	AutoRelayOpts   []autorelay.Option
+	// AutoRelayWithRouting makes AutoRelay find relays using Routing, see
+	// autorelay.RoutingCandidateSource.
+	AutoRelayWithRouting bool
+	// AdvertiseRelayService makes the relay service advertise itself using Routing.
+	AdvertiseRelayService bool
 	AutoNATConfig
 
+	EnableBootstrap bool
+	BootstrapOpts   []bootstrap.Option
+
 	EnableHolePunching  bool
 	HolePunchingOptions []holepunch.Option
 
+	EnableAutoNATv2 bool
+
 	DisableMetrics       bool
 	PrometheusRegisterer prometheus.Registerer
+	// MetricsExporters export the metrics gathered from the PrometheusRegisterer,
+	// which must also be a prometheus.Gatherer if there are any.
+	MetricsExporters []metricshelper.Exporter
+	// PeerMetricsLimit is the maximum number of peers with their own bandwidth
+	// metrics, see swarm.WithPeerLabels. The per-peer metrics are disabled if it is 0.
+	PeerMetricsLimit int
+
+	// Profiles are applied by libp2p.FallbackDefaults, before the defaults. They
+	// only set the options the other options left unset, see libp2p.ProfileServer.
+	Profiles []Option
+
+	// UserFxOptions register the services of the user into the lifecycle of the host,
+	// see the WithFxOption option. They're started once the host listens, and
+	// stopped before it's closed.
+	UserFxOptions []fx.Option
+
+	// DebugServerAddr is the TCP address the debug HTTP server listens on, see
+	// debug.Server. The server is disabled if it is empty.
+	DebugServerAddr string
 }
 
-func (cfg *Config) makeSwarm(eventBus event.Bus, enableMetrics bool) (*swarm.Swarm, error) {
+func (cfg *Config) makeSwarm(eventBus event.Bus, enableMetrics bool, nat64Detector *nat64.Detector) (*swarm.Swarm, error) {
 	if cfg.Peerstore == nil {
 		return nil, fmt.Errorf("no peerstore specified")
 	}
@@ -156,6 +237,17 @@ func (cfg *Config) makeSwarm(eventBus event.Bus, enableMetrics bool) (*swarm.Swa
 	if err := cfg.Peerstore.AddPubKey(pid, cfg.PeerKey.GetPublic()); err != nil {
 		return nil, err
 	}
+	if eps, ok := cfg.Peerstore.(pstore.EventEmittingPeerstore); ok {
+		// fails if the peerstore is shared with another host, which already receives the events
+		if err := eps.EmitEvents(eventBus); err != nil {
+			log.Warnw("peerstore won't emit events", "error", err)
+		}
+	}
+	if em, ok := cfg.ResourceManager.(interface{ EmitEvents(event.Bus) error }); ok {
+		if err := em.EmitEvents(eventBus); err != nil {
+			log.Warnw("resource manager won't emit events", "error", err)
+		}
+	}
 
 	opts := make([]swarm.Option, 0, 6)
 	if cfg.Reporter != nil {
@@ -167,6 +259,15 @@ func (cfg *Config) makeSwarm(eventBus event.Bus, enableMetrics bool) (*swarm.Swa
 	if cfg.DialTimeout != 0 {
 		opts = append(opts, swarm.WithDialTimeout(cfg.DialTimeout))
 	}
+	if cfg.StreamEventsSampleRate != 0 {
+		opts = append(opts, swarm.WithStreamEvents(cfg.StreamEventsSampleRate))
+	}
+	if cfg.ConnTraceWriter != nil {
+		opts = append(opts, swarm.WithTrace(cfg.ConnTraceWriter))
+	}
+	if cfg.ConnTraceFile != nil {
+		opts = append(opts, swarm.WithTraceFile(*cfg.ConnTraceFile))
+	}
 	if cfg.ResourceManager != nil {
 		opts = append(opts, swarm.WithResourceManager(cfg.ResourceManager))
 	}
@@ -175,7 +276,12 @@ func (cfg *Config) makeSwarm(eventBus event.Bus, enableMetrics bool) (*swarm.Swa
 	}
 	if enableMetrics {
 		opts = append(opts,
-			swarm.WithMetricsTracer(swarm.NewMetricsTracer(swarm.WithRegisterer(cfg.PrometheusRegisterer))))
+			swarm.WithMetricsTracer(swarm.NewMetricsTracer(
+				swarm.WithRegisterer(cfg.PrometheusRegisterer),
+				swarm.WithPeerLabels(cfg.PeerMetricsLimit))))
+	}
+	if nat64Detector != nil {
+		opts = append(opts, swarm.WithNAT64(nat64Detector))
 	}
 	// TODO: Make the swarm implementation configurable.
 	return swarm.NewSwarm(pid, cfg.Peerstore, eventBus, opts...)
@@ -282,32 +388,193 @@ func (cfg *Config) addTransports(h host.Host) error {
 	return nil
 }
 
+// makeAutoNATDialerHost creates the host used by the AutoNAT services to dial back
+// peers. It has its own identity and peerstore, and doesn't listen on any address.
+func (cfg *Config) makeAutoNATDialerHost() (host.Host, error) {
+	autonatPrivKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := pstoremem.NewPeerstore()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pull out the pieces of the config that we _actually_ care about.
+	// Specifically, don't setup things like autorelay, listeners,
+	// identify, etc.
+	autoNatCfg := Config{
+		Transports:         cfg.Transports,
+		Muxers:             cfg.Muxers,
+		SecurityTransports: cfg.SecurityTransports,
+		Insecure:           cfg.Insecure,
+		PSK:                cfg.PSK,
+		ConnectionGater:    cfg.ConnectionGater,
+		Reporter:           cfg.Reporter,
+		PeerKey:            autonatPrivKey,
+		Peerstore:          ps,
+	}
+
+	dialer, err := autoNatCfg.makeSwarm(eventbus.NewBus(), false, nil)
+	if err != nil {
+		return nil, err
+	}
+	dialerHost := blankhost.NewBlankHost(dialer)
+	if err := autoNatCfg.addTransports(dialerHost); err != nil {
+		dialerHost.Close()
+		return nil, err
+	}
+	return dialerHost, nil
+}
+
+// checkListenAddrs fails if the address filters deny one of the listen addresses.
+// Unspecified addresses like 0.0.0.0 aren't checked: they stand for the addresses of
+// all interfaces, which are filtered when they are advertised.
+func (cfg *Config) checkListenAddrs() error {
+	if cfg.AddrFilters == nil {
+		return nil
+	}
+	for _, a := range cfg.ListenAddrs {
+		if ip, err := manet.ToIP(a); err == nil && ip.IsUnspecified() {
+			continue
+		}
+		if cfg.AddrFilters.AddrBlocked(a) {
+			return fmt.Errorf("listen address %s is denied by the address filters", a)
+		}
+	}
+	return nil
+}
+
 // NewNode constructs a new libp2p Host from the Config.
 //
 // This function consumes the config. Do not reuse it (really!).
 func (cfg *Config) NewNode() (host.Host, error) {
+	if err := cfg.checkListenAddrs(); err != nil {
+		return nil, err
+	}
+	if len(cfg.MetricsExporters) > 0 && !cfg.DisableMetrics {
+		g, ok := cfg.PrometheusRegisterer.(prometheus.Gatherer)
+		if !ok {
+			return nil, errors.New("exporting metrics requires the prometheus registerer to be a gatherer")
+		}
+		for _, exp := range cfg.MetricsExporters {
+			if err := exp.Export(g); err != nil {
+				return nil, fmt.Errorf("failed to export metrics: %w", err)
+			}
+		}
+	}
+	// the gater given in the options, before it's wrapped
+	connGater := cfg.ConnectionGater
+	if cfg.AddrFilters != nil {
+		cfg.ConnectionGater = cfg.AddrFilters.Gater(cfg.ConnectionGater)
+	}
 	eventBus := eventbus.NewBus(eventbus.WithMetricsTracer(eventbus.NewMetricsTracer(eventbus.WithRegisterer(cfg.PrometheusRegisterer))))
-	swrm, err := cfg.makeSwarm(eventBus, !cfg.DisableMetrics)
+	if cfg.ConnectionGater != nil {
+		var mt conngater.MetricsTracer
+		if !cfg.DisableMetrics {
+			mt = conngater.NewMetricsTracer(conngater.WithRegisterer(cfg.PrometheusRegisterer))
+		}
+		rg := conngater.NewReportingGater(cfg.ConnectionGater, mt)
+		if err := rg.EmitEvents(eventBus); err != nil {
+			log.Warnw("connection gater won't emit events", "error", err)
+		}
+		cfg.ConnectionGater = rg
+	}
+	var nat64Detector *nat64.Detector
+	if cfg.EnableNAT64 {
+		var nat64Opts []nat64.Option
+		if cfg.MultiaddrResolver != nil {
+			nat64Opts = append(nat64Opts, nat64.WithResolver(cfg.MultiaddrResolver))
+		}
+		var err error
+		nat64Detector, err = nat64.NewDetector(nat64Opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	swrm, err := cfg.makeSwarm(eventBus, !cfg.DisableMetrics, nat64Detector)
 	if err != nil {
 		return nil, err
 	}
+	// the connection manager is constructed before the event bus, so it's connected to it here
+	if em, ok := cfg.ConnManager.(interface{ EmitEvents(event.Bus) error }); ok {
+		if err := em.EmitEvents(eventBus); err != nil {
+			log.Warnw("connection manager won't emit events", "error", err)
+		}
+	}
 
-	h, err := bhost.NewHost(swrm, &bhost.HostOpts{
-		EventBus:             eventBus,
-		ConnManager:          cfg.ConnManager,
-		AddrsFactory:         cfg.AddrsFactory,
-		NATManager:           cfg.NATManager,
-		EnablePing:           !cfg.DisablePing,
-		UserAgent:            cfg.UserAgent,
-		ProtocolVersion:      cfg.ProtocolVersion,
-		EnableHolePunching:   cfg.EnableHolePunching,
-		HolePunchingOptions:  cfg.HolePunchingOptions,
-		EnableRelayService:   cfg.EnableRelayService,
-		RelayServiceOpts:     cfg.RelayServiceOpts,
-		EnableMetrics:        !cfg.DisableMetrics,
-		PrometheusRegisterer: cfg.PrometheusRegisterer,
+	var autonatv2Dialer host.Host
+	if cfg.EnableAutoNATv2 && cfg.AutoNATConfig.EnableService {
+		autonatv2Dialer, err = cfg.makeAutoNATDialerHost()
+		if err != nil {
+			swrm.Close()
+			return nil, err
+		}
+	}
+
+	// The routing is only constructed after the host. That's fine, as the relay service is
+	// only started once we're publicly reachable, after the host was started.
+	var contentRouting routing.ContentRouting
+	relayServiceOpts := cfg.RelayServiceOpts
+	if cfg.EnableRelayService && cfg.AdvertiseRelayService {
+		relayServiceOpts = append(relayServiceOpts[:len(relayServiceOpts):len(relayServiceOpts)], func(r *relayv2.Relay) error {
+			return relayv2.WithAdvertiser(drouting.NewRoutingDiscovery(contentRouting), autorelay.RelayNamespace)(r)
+		})
+	}
+
+	// AutoRelay is only constructed after the host, but may withhold relay addresses
+	// from some peers in identify, see autorelay.CircuitAddrsToPeers.
+	var autoRelay atomic.Pointer[autorelay.AutoRelay]
+	identifyOpts := cfg.IdentifyOpts
+	if cfg.EnableAutoRelay {
+		identifyOpts = append(identifyOpts[:len(identifyOpts):len(identifyOpts)], identify.WithListenAddrsFilter(
+			func(c network.Conn, addrs []ma.Multiaddr) []ma.Multiaddr {
+				if ar := autoRelay.Load(); ar != nil {
+					return ar.FilterListenAddrs(c, addrs)
+				}
+				return addrs
+			}))
+	}
+
+	var h *bhost.BasicHost
+	h, err = bhost.NewHost(swrm, &bhost.HostOpts{
+		EventBus:                        eventBus,
+		ConnManager:                     cfg.ConnManager,
+		AddrsFactory:                    cfg.AddrsFactory,
+		ListenAddrsFactories:            cfg.ListenAddrsFactories,
+		AddrFilters:                     cfg.AddrFilters,
+		NATManager:                      cfg.NATManager,
+		StaticPortMappings:              cfg.StaticPortMappings,
+		StaticPortMappingVerifyInterval: cfg.StaticPortMappingVerifyInterval,
+		NAT64:                           nat64Detector,
+		OutboundNegotiationTimeout:      cfg.OutboundNegotiationTimeout,
+		LazyNegotiation:                 cfg.LazyNegotiation,
+		EnableProtocolTokens:            cfg.EnableProtocolTokens,
+		ProtocolTokens:                  cfg.ProtocolTokens,
+		DNSAddrs:                        cfg.DNSAddrs,
+		VerifyDNSAddrs:                  cfg.VerifyDNSAddrs,
+		DNSAddrVerifyInterval:           cfg.DNSAddrVerifyInterval,
+		EnablePing:                      !cfg.DisablePing,
+		EnableLatencyMonitor:            cfg.EnableLatencyMonitor,
+		LatencyMonitorOpts:              cfg.LatencyMonitorOpts,
+		UserAgent:                       cfg.UserAgent,
+		ProtocolVersion:                 cfg.ProtocolVersion,
+		IdentifyOpts:                    identifyOpts,
+		RequireSignedPeerRecord:         cfg.RequireSignedPeerRecord,
+		EnableHolePunching:              cfg.EnableHolePunching,
+		HolePunchingOptions:             cfg.HolePunchingOptions,
+		EnableRelayService:              cfg.EnableRelayService,
+		RelayServiceOpts:                relayServiceOpts,
+		EnableAutoNATv2:                 cfg.EnableAutoNATv2,
+		AutoNATv2Dialer:                 autonatv2Dialer,
+		EnableMetrics:                   !cfg.DisableMetrics,
+		PrometheusRegisterer:            cfg.PrometheusRegisterer,
+		EffectiveConfig:                 func() *EffectiveConfig { return cfg.effectiveConfig(h, connGater) },
 	})
 	if err != nil {
+		if autonatv2Dialer != nil {
+			autonatv2Dialer.Close()
+		}
 		swrm.Close()
 		return nil, err
 	}
@@ -344,6 +611,14 @@ func (cfg *Config) NewNode() (host.Host, error) {
 			return nil, err
 		}
 	}
+	if cfg.AutoRelayWithRouting || (cfg.EnableRelayService && cfg.AdvertiseRelayService) {
+		cr, ok := router.(routing.ContentRouting)
+		if !ok {
+			h.Close()
+			return nil, fmt.Errorf("cannot discover relays; routing doesn't implement content routing")
+		}
+		contentRouting = cr
+	}
 
 	// Note: h.AddrsFactory may be changed by relayFinder, but non-relay version is
 	// used by AutoNAT below.
@@ -360,11 +635,18 @@ func (cfg *Config) NewNode() (host.Host, error) {
 			mtOpts := []autorelay.Option{mt}
 			cfg.AutoRelayOpts = append(mtOpts, cfg.AutoRelayOpts...)
 		}
+		if cfg.RequireSignedPeerRecord {
+			cfg.AutoRelayOpts = append(cfg.AutoRelayOpts, autorelay.WithCertifiedRelayAddrs())
+		}
+		if cfg.AutoRelayWithRouting {
+			cfg.AutoRelayOpts = append(cfg.AutoRelayOpts, autorelay.WithCandidateSource(autorelay.RoutingCandidateSource(contentRouting)))
+		}
 
 		ar, err = autorelay.NewAutoRelay(h, cfg.AutoRelayOpts...)
 		if err != nil {
 			return nil, err
 		}
+		autoRelay.Store(ar)
 	}
 
 	autonatOpts := []autonat.Option{
@@ -382,46 +664,23 @@ func (cfg *Config) NewNode() (host.Host, error) {
 			autonat.WithThrottling(cfg.AutoNATConfig.ThrottleGlobalLimit, cfg.AutoNATConfig.ThrottleInterval),
 			autonat.WithPeerThrottling(cfg.AutoNATConfig.ThrottlePeerLimit))
 	}
+	if cfg.AutoNATConfig.ServiceDialTimeout != 0 {
+		autonatOpts = append(autonatOpts, autonat.WithDialTimeout(cfg.AutoNATConfig.ServiceDialTimeout))
+	}
 	if cfg.AutoNATConfig.EnableService {
-		autonatPrivKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
-		if err != nil {
-			return nil, err
+		dialer := cfg.AutoNATConfig.ServiceDialer
+		if dialer == nil {
+			dialerHost, err := cfg.makeAutoNATDialerHost()
+			if err != nil {
+				h.Close()
+				return nil, err
+			}
+			// NOTE: We're dropping the blank host here but that's fine. It
+			// doesn't really _do_ anything and doesn't even need to be
+			// closed (as long as we close the underlying network).
+			dialer = dialerHost.Network()
 		}
-		ps, err := pstoremem.NewPeerstore()
-		if err != nil {
-			return nil, err
-		}
-
-		// Pull out the pieces of the config that we _actually_ care about.
-		// Specifically, don't setup things like autorelay, listeners,
-		// identify, etc.
-		autoNatCfg := Config{
-			Transports:         cfg.Transports,
-			Muxers:             cfg.Muxers,
-			SecurityTransports: cfg.SecurityTransports,
-			Insecure:           cfg.Insecure,
-			PSK:                cfg.PSK,
-			ConnectionGater:    cfg.ConnectionGater,
-			Reporter:           cfg.Reporter,
-			PeerKey:            autonatPrivKey,
-			Peerstore:          ps,
-		}
-
-		dialer, err := autoNatCfg.makeSwarm(eventbus.NewBus(), false)
-		if err != nil {
-			h.Close()
-			return nil, err
-		}
-		dialerHost := blankhost.NewBlankHost(dialer)
-		if err := autoNatCfg.addTransports(dialerHost); err != nil {
-			dialerHost.Close()
-			h.Close()
-			return nil, err
-		}
-		// NOTE: We're dropping the blank host here but that's fine. It
-		// doesn't really _do_ anything and doesn't even need to be
-		// closed (as long as we close the underlying network).
-		autonatOpts = append(autonatOpts, autonat.EnableService(dialerHost.Network()))
+		autonatOpts = append(autonatOpts, autonat.EnableService(dialer))
 	}
 	if cfg.AutoNATConfig.ForceReachability != nil {
 		autonatOpts = append(autonatOpts, autonat.WithReachability(*cfg.AutoNATConfig.ForceReachability))
@@ -447,6 +706,44 @@ func (cfg *Config) NewNode() (host.Host, error) {
 		arh.Start()
 		ho = arh
 	}
+	if cfg.EnableBootstrap {
+		var opts []bootstrap.Option
+		if cfg.MultiaddrResolver != nil {
+			opts = append(opts, bootstrap.WithResolver(cfg.MultiaddrResolver))
+		}
+		if !cfg.DisableMetrics {
+			opts = append(opts, bootstrap.WithMetricsTracer(
+				bootstrap.NewMetricsTracer(bootstrap.WithRegisterer(cfg.PrometheusRegisterer))))
+		}
+		b, err := bootstrap.New(h, append(opts, cfg.BootstrapOpts...)...)
+		if err != nil {
+			ho.Close()
+			return nil, fmt.Errorf("failed to create the bootstrapper: %w", err)
+		}
+		bh := bootstrap.NewHost(ho, b)
+		bh.Start()
+		ho = bh
+	}
+	if len(cfg.UserFxOptions) > 0 {
+		lh, err := cfg.startServices(ho, router)
+		if err != nil {
+			ho.Close()
+			return nil, err
+		}
+		ho = lh
+	}
+	if cfg.DebugServerAddr != "" {
+		opts := []debug.Option{debug.WithConfigFunc(func() interface{} { return cfg.effectiveConfig(h, connGater) })}
+		if g, ok := cfg.PrometheusRegisterer.(prometheus.Gatherer); ok {
+			opts = append(opts, debug.WithGatherer(g))
+		}
+		srv, err := debug.New(ho, cfg.DebugServerAddr, opts...)
+		if err != nil {
+			ho.Close()
+			return nil, fmt.Errorf("failed to start the debug server: %w", err)
+		}
+		ho = debug.NewHost(ho, srv)
+	}
 	return ho, nil
 }
 
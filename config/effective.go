@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	bconnmgr "github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// EffectiveConfig is the resolved configuration of a running host, see
+// basichost.EffectiveConfig.
+type EffectiveConfig = bhost.EffectiveConfig
+
+// ConnManagerLimits are the watermarks of a connection manager.
+type ConnManagerLimits = bhost.ConnManagerLimits
+
+// effectiveConfig returns the configuration of h, which was constructed from cfg, and
+// connGater, the connection gater given in the options. It's called again on every
+// request, so that the changes made at runtime show.
+func (cfg *Config) effectiveConfig(h *bhost.BasicHost, connGater connmgr.ConnectionGater) *EffectiveConfig {
+	c := &EffectiveConfig{
+		PeerID:                     h.ID(),
+		UserAgent:                  cfg.UserAgent,
+		ProtocolVersion:            cfg.ProtocolVersion,
+		ListenAddrs:                h.Network().ListenAddresses(),
+		Addrs:                      h.Addrs(),
+		Protocols:                  h.Mux().Protocols(),
+		Insecure:                   cfg.Insecure,
+		PrivateNetwork:             cfg.PSK != nil,
+		DialTimeout:                cfg.DialTimeout,
+		NegotiationTimeout:         h.NegotiationTimeout(),
+		OutboundNegotiationTimeout: h.OutboundNegotiationTimeout(),
+		Relay:                      cfg.Relay,
+		EnableRelayService:         h.RelayServiceEnabled(),
+		EnableAutoRelay:            cfg.EnableAutoRelay,
+		EnableHolePunching:         cfg.EnableHolePunching,
+		EnableAutoNATv2:            cfg.EnableAutoNATv2,
+		AutoNATService:             cfg.AutoNATConfig.EnableService,
+		EnableBootstrap:            cfg.EnableBootstrap,
+		DisablePing:                cfg.DisablePing,
+		EnableLatencyMonitor:       cfg.EnableLatencyMonitor,
+		DisableMetrics:             cfg.DisableMetrics,
+		ResourceManager:            fmt.Sprintf("%T", cfg.ResourceManager),
+		ConnManager:                fmt.Sprintf("%T", cfg.ConnManager),
+		Peerstore:                  fmt.Sprintf("%T", cfg.Peerstore),
+	}
+	if c.UserAgent == "" {
+		c.UserAgent = identify.DefaultUserAgent()
+	}
+	if c.ProtocolVersion == "" {
+		c.ProtocolVersion = identify.DefaultProtocolVersion
+	}
+	if swrm, ok := h.Network().(*swarm.Swarm); ok {
+		c.DialTimeout = swrm.DialTimeout()
+		for _, t := range swrm.Transports() {
+			for _, p := range t.Protocols() {
+				c.Transports = append(c.Transports, ma.ProtocolWithCode(p).Name)
+			}
+		}
+		sort.Strings(c.Transports)
+	}
+	if !cfg.Insecure {
+		for _, s := range cfg.SecurityTransports {
+			c.SecurityProtocols = append(c.SecurityProtocols, s.ID)
+		}
+	}
+	for _, m := range cfg.Muxers {
+		c.Muxers = append(c.Muxers, m.ID)
+	}
+	if cfg.AutoNATConfig.ForceReachability != nil {
+		c.ForceReachability = cfg.AutoNATConfig.ForceReachability.String()
+	}
+	if connGater != nil {
+		c.ConnectionGater = fmt.Sprintf("%T", connGater)
+	}
+	if lu, ok := cfg.ResourceManager.(rcmgr.LimitUpdater); ok {
+		if l, err := lu.Limits(); err == nil {
+			pl := l.ToPartialLimitConfig()
+			c.ResourceManagerLimits = &pl
+		}
+	}
+	if cm, ok := cfg.ConnManager.(*bconnmgr.BasicConnMgr); ok {
+		info := cm.GetInfo()
+		c.ConnManagerLimits = &ConnManagerLimits{
+			LowWater:    info.LowWater,
+			HighWater:   info.HighWater,
+			GracePeriod: info.GracePeriod,
+		}
+	}
+	return c
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/routing"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+)
+
+// startServices starts the services registered with UserFxOptions on h, which is
+// listening and started. The returned host stops them before closing h.
+func (cfg *Config) startServices(h host.Host, router routing.PeerRouting) (host.Host, error) {
+	fxopts := []fx.Option{
+		fx.WithLogger(func() fxevent.Logger { return getFXLogger() }),
+		fx.Supply(h.ID()),
+		fx.Provide(func() host.Host { return h }),
+		fx.Provide(func() crypto.PrivKey { return h.Peerstore().PrivKey(h.ID()) }),
+		fx.Provide(func() network.Network { return h.Network() }),
+		fx.Provide(func() peerstore.Peerstore { return h.Peerstore() }),
+		fx.Provide(func() event.Bus { return h.EventBus() }),
+		fx.Provide(func() connmgr.ConnManager { return h.ConnManager() }),
+		fx.Provide(func() network.ResourceManager { return h.Network().ResourceManager() }),
+	}
+	if router != nil {
+		fxopts = append(fxopts, fx.Provide(func() routing.PeerRouting { return router }))
+	}
+	app := fx.New(append(fxopts, cfg.UserFxOptions...)...)
+	if err := app.Err(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), app.StartTimeout())
+	defer cancel()
+	if err := app.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start the services: %w", err)
+	}
+	return &lifecycleHost{Host: h, app: app}, nil
+}
+
+// lifecycleHost is a host that stops the services of app when it is closed, before
+// closing its connections.
+type lifecycleHost struct {
+	host.Host
+	app *fx.App
+}
+
+// Unwrap returns the wrapped host.
+func (h *lifecycleHost) Unwrap() host.Host {
+	return h.Host
+}
+
+func (h *lifecycleHost) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.app.StopTimeout())
+	defer cancel()
+	if err := h.app.Stop(ctx); err != nil {
+		log.Warnw("failed to stop the services", "error", err)
+	}
+	return h.Host.Close()
+}
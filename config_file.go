@@ -0,0 +1,405 @@
+package libp2p
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/bootstrap"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/muxer/mplex"
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	tls "github.com/libp2p/go-libp2p/p2p/security/tls"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	ws "github.com/libp2p/go-libp2p/p2p/transport/websocket"
+	webtransport "github.com/libp2p/go-libp2p/p2p/transport/webtransport"
+
+	"github.com/BurntSushi/toml"
+	ma "github.com/multiformats/go-multiaddr"
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig is the declarative configuration of a host, as read from a config file
+// by LoadConfigFile. The fields that aren't set keep the defaults of New.
+//
+// A JSON config file looks like:
+//
+//	{
+//	  "IdentityFile": "/var/lib/node/key",
+//	  "ListenAddrs": ["/ip4/0.0.0.0/tcp/4001", "/ip4/0.0.0.0/udp/4001/quic-v1"],
+//	  "Transports": ["tcp", "quic"],
+//	  "Relay": {"Service": true},
+//	  "ConnManager": {"Low": 100, "High": 400, "GracePeriod": "1m"},
+//	  "ResourceManager": {"Limits": {"System": {"Conns": 1000}}},
+//	  "Bootstrap": {"Peers": ["/dnsaddr/bootstrap.libp2p.io/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"]}
+//	}
+type FileConfig struct {
+	// IdentityFile is the path of the file holding the private key of the host,
+	// encoded with crypto.MarshalPrivateKey.
+	IdentityFile string `json:",omitempty"`
+	UserAgent    string `json:",omitempty"`
+
+	// ListenAddrs are the addresses the host listens on. An empty list, as opposed
+	// to a missing one, makes the host not listen at all.
+	ListenAddrs []string `json:",omitempty"`
+	// Transports are the names of the transports: "tcp", "quic", "websocket" and
+	// "webtransport".
+	Transports []string `json:",omitempty"`
+	// Security are the names of the security protocols in order of preference:
+	// "noise" and "tls".
+	Security []string `json:",omitempty"`
+	// Muxers are the names of the stream muxers in order of preference: "yamux" and
+	// "mplex".
+	Muxers []string `json:",omitempty"`
+
+	Relay           *RelayFileConfig           `json:",omitempty"`
+	ConnManager     *ConnManagerFileConfig     `json:",omitempty"`
+	ResourceManager *ResourceManagerFileConfig `json:",omitempty"`
+	Bootstrap       *BootstrapFileConfig       `json:",omitempty"`
+}
+
+// RelayFileConfig configures the relay transport and services.
+type RelayFileConfig struct {
+	// Disable disables the relay transport, which is enabled by default.
+	Disable bool `json:",omitempty"`
+	// Service runs a circuit v2 relay service, see EnableRelayService.
+	Service bool `json:",omitempty"`
+	// StaticRelays enables AutoRelay with these relays, given as /p2p addresses.
+	StaticRelays []string `json:",omitempty"`
+}
+
+// ConnManagerFileConfig configures the connection manager, see connmgr.NewConnManager.
+type ConnManagerFileConfig struct {
+	Low, High   int
+	GracePeriod Duration `json:",omitempty"`
+	// Inbound and Outbound are the optional watermarks per direction.
+	Inbound  *Watermarks `json:",omitempty"`
+	Outbound *Watermarks `json:",omitempty"`
+}
+
+// Watermarks are the low and high watermarks of a connection count.
+type Watermarks struct {
+	Low, High int
+}
+
+// ResourceManagerFileConfig configures the limits of the resource manager.
+type ResourceManagerFileConfig struct {
+	// MaxMemory and MaxFileDescriptors are the resources the default limits are scaled
+	// to. By default, they are scaled to the memory and file descriptors available.
+	MaxMemory          int64 `json:",omitempty"`
+	MaxFileDescriptors int   `json:",omitempty"`
+	// Limits override the scaled limits. They have the format of the limit files read
+	// by rcmgr.LimitReloader.
+	Limits rcmgr.PartialLimitConfig
+}
+
+// BootstrapFileConfig configures the peers the host stays connected to, see Bootstrap.
+type BootstrapFileConfig struct {
+	// Peers are the /p2p or /dnsaddr addresses of the bootstrap peers.
+	Peers []string
+	// MinPeers is the number of connected peers below which the bootstrap peers are
+	// dialed, see bootstrap.WithMinPeers.
+	MinPeers int `json:",omitempty"`
+}
+
+// Duration is a time.Duration written as a string like "1m30s" in config files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ConfigDecoder decodes a config file into v, a *FileConfig. The field names of v are
+// the keys of the file, matched case-insensitively.
+type ConfigDecoder func(r io.Reader, v interface{}) error
+
+// DecodeJSONConfig is the ConfigDecoder of JSON config files. Unknown fields are
+// errors.
+func DecodeJSONConfig(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// DecodeYAMLConfig is the ConfigDecoder of YAML config files. The file is converted
+// to JSON first, so it has the same structure as a JSON file.
+func DecodeYAMLConfig(r io.Reader, v interface{}) error {
+	var doc interface{}
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil && err != io.EOF {
+		return err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("YAML config can't be converted to JSON: %w", err)
+	}
+	return DecodeJSONConfig(bytes.NewReader(b), v)
+}
+
+// DecodeTOMLConfig is the ConfigDecoder of TOML config files. The file is converted
+// to JSON first, so it has the same structure as a JSON file.
+func DecodeTOMLConfig(r io.Reader, v interface{}) error {
+	var doc map[string]interface{}
+	if _, err := toml.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("TOML config can't be converted to JSON: %w", err)
+	}
+	return DecodeJSONConfig(bytes.NewReader(b), v)
+}
+
+// LoadConfigFile reads the config file at path. Its format is determined by its
+// extension: .json for JSON, .yaml or .yml for YAML, and .toml for TOML. Use
+// DecodeConfig to read other formats.
+func LoadConfigFile(path string) (*FileConfig, error) {
+	var dec ConfigDecoder
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec = DecodeJSONConfig
+	case ".yaml", ".yml":
+		dec = DecodeYAMLConfig
+	case ".toml":
+		dec = DecodeTOMLConfig
+	default:
+		return nil, fmt.Errorf("unknown config file format: %s", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeConfig(f, dec)
+}
+
+// DecodeConfig reads a config file from r with dec.
+func DecodeConfig(r io.Reader, dec ConfigDecoder) (*FileConfig, error) {
+	var c FileConfig
+	if err := dec(r, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return &c, nil
+}
+
+// ConfigFile configures libp2p from the config file at path, see LoadConfigFile. It
+// can be combined with other options, as long as they don't configure the same
+// components as the file, e.g. an identity or a connection manager.
+func ConfigFile(path string) Option {
+	return func(cfg *Config) error {
+		c, err := LoadConfigFile(path)
+		if err != nil {
+			return err
+		}
+		return cfg.Apply(c.Option())
+	}
+}
+
+var (
+	fileTransports = map[string]interface{}{
+		"tcp":          tcp.NewTCPTransport,
+		"quic":         quic.NewTransport,
+		"websocket":    ws.New,
+		"webtransport": webtransport.New,
+	}
+	fileSecurity = map[string]Option{
+		"noise": Security(noise.ID, noise.New),
+		"tls":   Security(tls.ID, tls.New),
+	}
+	fileMuxers = map[string]Option{
+		"yamux": Muxer(yamux.ID, yamux.DefaultTransport),
+		"mplex": Muxer(mplex.ID, mplex.DefaultTransport),
+	}
+)
+
+func unknownName[V any](kind, name string, known map[string]V) error {
+	names := make([]string, 0, len(known))
+	for n := range known {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown %s %q, expected one of %s", kind, name, strings.Join(names, ", "))
+}
+
+// Option returns the option configuring libp2p as described by c.
+func (c *FileConfig) Option() Option {
+	return func(cfg *Config) error {
+		opts, err := c.options()
+		if err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		return cfg.Apply(opts...)
+	}
+}
+
+func (c *FileConfig) options() ([]Option, error) {
+	var opts []Option
+	if c.IdentityFile != "" {
+		b, err := os.ReadFile(c.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		sk, err := crypto.UnmarshalPrivateKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identity: %w", err)
+		}
+		opts = append(opts, Identity(sk))
+	}
+	if c.UserAgent != "" {
+		opts = append(opts, UserAgent(c.UserAgent))
+	}
+	if c.ListenAddrs != nil {
+		if len(c.ListenAddrs) == 0 {
+			opts = append(opts, NoListenAddrs)
+		} else {
+			opts = append(opts, ListenAddrStrings(c.ListenAddrs...))
+		}
+	}
+	for _, name := range c.Transports {
+		tpt, ok := fileTransports[name]
+		if !ok {
+			return nil, unknownName("transport", name, fileTransports)
+		}
+		opts = append(opts, Transport(tpt))
+	}
+	for _, name := range c.Security {
+		opt, ok := fileSecurity[name]
+		if !ok {
+			return nil, unknownName("security protocol", name, fileSecurity)
+		}
+		opts = append(opts, opt)
+	}
+	for _, name := range c.Muxers {
+		opt, ok := fileMuxers[name]
+		if !ok {
+			return nil, unknownName("muxer", name, fileMuxers)
+		}
+		opts = append(opts, opt)
+	}
+	if r := c.Relay; r != nil {
+		if r.Disable {
+			if r.Service || len(r.StaticRelays) > 0 {
+				return nil, fmt.Errorf("relay services need the relay transport")
+			}
+			opts = append(opts, DisableRelay())
+		}
+		if r.Service {
+			opts = append(opts, EnableRelayService())
+		}
+		if len(r.StaticRelays) > 0 {
+			relays, err := parseAddrInfos(r.StaticRelays)
+			if err != nil {
+				return nil, fmt.Errorf("invalid static relays: %w", err)
+			}
+			opts = append(opts, EnableAutoRelayWithStaticRelays(relays))
+		}
+	}
+	if c.ConnManager != nil {
+		opt, err := c.ConnManager.option()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+	if c.ResourceManager != nil {
+		opts = append(opts, c.ResourceManager.option())
+	}
+	if b := c.Bootstrap; b != nil {
+		addrs, err := parseAddrs(b.Peers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap peers: %w", err)
+		}
+		var bopts []bootstrap.Option
+		if b.MinPeers != 0 {
+			bopts = append(bopts, bootstrap.WithMinPeers(b.MinPeers))
+		}
+		opts = append(opts, Bootstrap(addrs, bopts...))
+	}
+	return opts, nil
+}
+
+func (c *ConnManagerFileConfig) option() (Option, error) {
+	var opts []connmgr.Option
+	if c.GracePeriod != 0 {
+		opts = append(opts, connmgr.WithGracePeriod(time.Duration(c.GracePeriod)))
+	}
+	if c.Inbound != nil {
+		opts = append(opts, connmgr.WithInboundLimits(c.Inbound.Low, c.Inbound.High))
+	}
+	if c.Outbound != nil {
+		opts = append(opts, connmgr.WithOutboundLimits(c.Outbound.Low, c.Outbound.High))
+	}
+	if c.Low < 0 || c.High < c.Low {
+		return nil, fmt.Errorf("connection manager watermarks must satisfy 0 <= Low <= High")
+	}
+	// the connection manager is only constructed when the option is applied, so that
+	// an invalid config doesn't leave it running
+	return func(cfg *Config) error {
+		mgr, err := connmgr.NewConnManager(c.Low, c.High, opts...)
+		if err != nil {
+			return err
+		}
+		return cfg.Apply(ConnectionManager(mgr))
+	}, nil
+}
+
+func (c *ResourceManagerFileConfig) option() Option {
+	return func(cfg *Config) error {
+		limits := rcmgr.DefaultLimits
+		SetDefaultServiceLimits(&limits)
+		var scaled rcmgr.ConcreteLimitConfig
+		if c.MaxMemory > 0 || c.MaxFileDescriptors > 0 {
+			mem, fd := c.MaxMemory, c.MaxFileDescriptors
+			if mem <= 0 || fd <= 0 {
+				return fmt.Errorf("MaxMemory and MaxFileDescriptors must be set together")
+			}
+			scaled = limits.Scale(mem, fd)
+		} else {
+			scaled = limits.AutoScale()
+		}
+		mgr, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(c.Limits.Build(scaled)))
+		if err != nil {
+			return err
+		}
+		return cfg.Apply(ResourceManager(mgr))
+	}
+}
+
+func parseAddrs(ss []string) ([]ma.Multiaddr, error) {
+	addrs := make([]ma.Multiaddr, 0, len(ss))
+	for _, s := range ss {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs, nil
+}
+
+func parseAddrInfos(ss []string) ([]peer.AddrInfo, error) {
+	addrs, err := parseAddrs(ss)
+	if err != nil {
+		return nil, err
+	}
+	return peer.AddrInfosFromP2pAddrs(addrs...)
+}
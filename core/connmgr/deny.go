@@ -0,0 +1,153 @@
+package connmgr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// GatingStage is the stage of a connection at which a ConnectionGater is consulted.
+type GatingStage int
+
+const (
+	// GatingStagePeerDial is the stage of InterceptPeerDial.
+	GatingStagePeerDial GatingStage = iota
+	// GatingStageAddrDial is the stage of InterceptAddrDial.
+	GatingStageAddrDial
+	// GatingStageAccept is the stage of InterceptAccept.
+	GatingStageAccept
+	// GatingStageSecured is the stage of InterceptSecured.
+	GatingStageSecured
+	// GatingStageUpgraded is the stage of InterceptUpgraded.
+	GatingStageUpgraded
+)
+
+func (s GatingStage) String() string {
+	switch s {
+	case GatingStagePeerDial:
+		return "peer-dial"
+	case GatingStageAddrDial:
+		return "addr-dial"
+	case GatingStageAccept:
+		return "accept"
+	case GatingStageSecured:
+		return "secured"
+	case GatingStageUpgraded:
+		return "upgraded"
+	default:
+		return "unknown"
+	}
+}
+
+// DenyReason describes why a ConnectionGater denied a connection.
+type DenyReason struct {
+	// Stage is the stage at which the connection was denied.
+	Stage GatingStage
+	// Gater names the gater that denied the connection, e.g. when it wraps other
+	// gaters. There are few of them, so it can be used as a metric label.
+	Gater string
+	// Rule identifies the rule that denied the connection, in a format specific to
+	// the gater. It's empty if the gater doesn't tell.
+	Rule string
+}
+
+func (r DenyReason) String() string {
+	if r.Rule == "" {
+		return fmt.Sprintf("denied by %s at stage %s", r.Gater, r.Stage)
+	}
+	return fmt.Sprintf("denied by %s at stage %s: %s", r.Gater, r.Stage, r.Rule)
+}
+
+// DenyReasoner can be implemented by a ConnectionGater to tell why it denies the
+// connections. Each method is called in place of the Intercept method of the same
+// stage, and returns nil if the connection is allowed. The Stage of the returned
+// reasons needn't be set.
+//
+// Use the Gate functions to consult a gater, whether it implements DenyReasoner or not.
+type DenyReasoner interface {
+	DenyPeerDial(p peer.ID) *DenyReason
+	DenyAddrDial(p peer.ID, a ma.Multiaddr) *DenyReason
+	DenyAccept(addrs network.ConnMultiaddrs) *DenyReason
+	DenySecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) *DenyReason
+}
+
+// ErrGated is the error of the connections denied by a ConnectionGater. The
+// GatedErrors wrap it.
+var ErrGated = errors.New("gater disallows connection to peer")
+
+// GatedError is the error of a connection denied by a ConnectionGater.
+type GatedError struct {
+	Reason DenyReason
+}
+
+func (e *GatedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrGated, e.Reason)
+}
+
+func (e *GatedError) Unwrap() error {
+	return ErrGated
+}
+
+// GatePeerDial calls InterceptPeerDial, or DenyPeerDial if g implements DenyReasoner,
+// and returns why g denies the dial, or nil if it allows it.
+func GatePeerDial(g ConnectionGater, p peer.ID) *DenyReason {
+	if dr, ok := g.(DenyReasoner); ok {
+		return withStage(g, dr.DenyPeerDial(p), GatingStagePeerDial)
+	}
+	return denied(g, g.InterceptPeerDial(p), GatingStagePeerDial)
+}
+
+// GateAddrDial is like GatePeerDial, for InterceptAddrDial.
+func GateAddrDial(g ConnectionGater, p peer.ID, a ma.Multiaddr) *DenyReason {
+	if dr, ok := g.(DenyReasoner); ok {
+		return withStage(g, dr.DenyAddrDial(p, a), GatingStageAddrDial)
+	}
+	return denied(g, g.InterceptAddrDial(p, a), GatingStageAddrDial)
+}
+
+// GateAccept is like GatePeerDial, for InterceptAccept.
+func GateAccept(g ConnectionGater, addrs network.ConnMultiaddrs) *DenyReason {
+	if dr, ok := g.(DenyReasoner); ok {
+		return withStage(g, dr.DenyAccept(addrs), GatingStageAccept)
+	}
+	return denied(g, g.InterceptAccept(addrs), GatingStageAccept)
+}
+
+// GateSecured is like GatePeerDial, for InterceptSecured.
+func GateSecured(g ConnectionGater, dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) *DenyReason {
+	if dr, ok := g.(DenyReasoner); ok {
+		return withStage(g, dr.DenySecured(dir, p, addrs), GatingStageSecured)
+	}
+	return denied(g, g.InterceptSecured(dir, p, addrs), GatingStageSecured)
+}
+
+// GateUpgraded is like GatePeerDial, for InterceptUpgraded. It also returns the
+// disconnect reason of g.
+func GateUpgraded(g ConnectionGater, c network.Conn) (*DenyReason, control.DisconnectReason) {
+	allow, reason := g.InterceptUpgraded(c)
+	return denied(g, allow, GatingStageUpgraded), reason
+}
+
+func withStage(g ConnectionGater, r *DenyReason, stage GatingStage) *DenyReason {
+	if r == nil {
+		return nil
+	}
+	reason := *r
+	reason.Stage = stage
+	if reason.Gater == "" {
+		reason.Gater = fmt.Sprintf("%T", g)
+	}
+	return &reason
+}
+
+func denied(g ConnectionGater, allow bool, stage GatingStage) *DenyReason {
+	if allow {
+		return nil
+	}
+	return &DenyReason{Stage: stage, Gater: fmt.Sprintf("%T", g)}
+}
@@ -2,6 +2,7 @@ package connmgr
 
 import (
 	"math"
+	"sort"
 	"time"
 )
 
@@ -30,6 +31,33 @@ func DecayLinear(coef float64) DecayFn {
 	}
 }
 
+// DecayExponential halves the value of the tag every halfLife, taking the interval of
+// the tag into account, and rounding down via math.Floor. It erases the tag when the
+// result is zero.
+func DecayExponential(halfLife time.Duration) DecayFn {
+	return func(value DecayingValue) (after int, rm bool) {
+		coef := math.Pow(0.5, float64(value.Tag.Interval())/float64(halfLife))
+		v := math.Floor(float64(value.Value) * coef)
+		return int(v), v <= 0
+	}
+}
+
+// DecayStepwise lowers the value of the tag to the next lower of the provided levels
+// on every tick, e.g. with levels 100, 50 and 10, a value of 80 decays to 50 and then
+// to 10. It erases the tag when the value is at or below the lowest level.
+func DecayStepwise(levels ...int) DecayFn {
+	sorted := append([]int(nil), levels...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	return func(value DecayingValue) (after int, rm bool) {
+		for _, l := range sorted {
+			if l < value.Value {
+				return l, false
+			}
+		}
+		return 0, true
+	}
+}
+
 // DecayExpireWhenInactive expires a tag after a certain period of no bumps.
 func DecayExpireWhenInactive(after time.Duration) DecayFn {
 	return func(value DecayingValue) (_ int, rm bool) {
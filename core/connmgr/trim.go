@@ -0,0 +1,71 @@
+package connmgr
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PruneReason describes why a connection manager closed the connections of a peer.
+type PruneReason int
+
+const (
+	// PruneReasonWatermark means that there were more connections than the high
+	// watermark of the connection manager allows.
+	PruneReasonWatermark PruneReason = iota
+	// PruneReasonInbound means that there were too many inbound connections.
+	PruneReasonInbound
+	// PruneReasonOutbound means that there were too many outbound connections.
+	PruneReasonOutbound
+	// PruneReasonProtocol means that there were too many connections dominated by the
+	// protocol of one of the pruned connections.
+	PruneReasonProtocol
+	// PruneReasonMemory means that the system was running low on memory.
+	PruneReasonMemory
+	// PruneReasonGroup means that there were more connections to a group of peers
+	// than its quota allows.
+	PruneReasonGroup
+)
+
+func (r PruneReason) String() string {
+	switch r {
+	case PruneReasonWatermark:
+		return "watermark"
+	case PruneReasonInbound:
+		return "inbound"
+	case PruneReasonOutbound:
+		return "outbound"
+	case PruneReasonProtocol:
+		return "protocol"
+	case PruneReasonMemory:
+		return "memory"
+	case PruneReasonGroup:
+		return "group"
+	default:
+		return "unknown"
+	}
+}
+
+// TrimReport describes a trim of the open connections by a connection manager.
+type TrimReport struct {
+	// Start and End are the times the trim started and ended.
+	Start, End time.Time
+	// ConnCount is the number of connections when the trim started.
+	ConnCount int
+	// Pruned holds the peers whose connections were closed.
+	Pruned []PrunedPeer
+}
+
+// PrunedPeer describes a peer whose connections were closed during a trim.
+type PrunedPeer struct {
+	Peer peer.ID
+	// Reason is why the connections of the peer were closed. If there were several
+	// reasons, it's the first one that applied.
+	Reason PruneReason
+	// Conns is the number of connections that were closed.
+	Conns int
+	// Value is the total value of the tags of the peer at the time of the trim, and
+	// Tags holds the value of each tag, including the decaying tags.
+	Value int
+	Tags  map[string]int
+}
@@ -81,3 +81,15 @@ type EvtLocalAddressesUpdated struct {
 	// wrapped in a record.Envelope and signed by the Host's private key.
 	SignedPeerRecord *record.Envelope
 }
+
+// EvtAddrFiltersUpdated is emitted when the address filters of the host are changed at
+// runtime.
+type EvtAddrFiltersUpdated struct {
+	// Denied and Allowed are the subnets that were added to the deny and the allow
+	// set, like /ip4/1.2.3.0/ipcidr/24.
+	Denied, Allowed []ma.Multiaddr
+	// Removed are the subnets that were removed from the filters.
+	Removed []ma.Multiaddr
+	// DefaultDeny is true if addresses that don't match any subnet are denied.
+	DefaultDeny bool
+}
@@ -0,0 +1,12 @@
+package event
+
+// EvtBootstrapStatusChanged is emitted when the node drops below or recovers to the
+// minimum number of connected peers maintained by the bootstrapper.
+type EvtBootstrapStatusChanged struct {
+	// Healthy is true if we are connected to at least the minimum number of peers.
+	Healthy bool
+	// ConnectedPeers is the number of peers we are connected to.
+	ConnectedPeers int
+	// ConnectedBootstrapPeers is the number of bootstrap peers we are connected to.
+	ConnectedBootstrapPeers int
+}
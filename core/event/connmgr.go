@@ -0,0 +1,23 @@
+package event
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+)
+
+// EvtConnManagerTrimStarted is emitted by the connection manager when it starts
+// trimming open connections.
+type EvtConnManagerTrimStarted struct {
+	// Start is the time the trim started.
+	Start time.Time
+	// ConnCount is the number of connections when the trim started.
+	ConnCount int
+}
+
+// EvtConnManagerTrimFinished is emitted by the connection manager when it finished
+// trimming open connections.
+type EvtConnManagerTrimFinished struct {
+	// Report describes which peers were pruned and why.
+	Report connmgr.TrimReport
+}
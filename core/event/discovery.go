@@ -0,0 +1,30 @@
+package event
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// EvtLocalPeerFound is emitted when a peer is discovered on the local network.
+//
+// This event is usually emitted by the mDNS discovery service.
+type EvtLocalPeerFound struct {
+	// Peer is the discovered peer, with the addresses it announced.
+	Peer peer.AddrInfo
+}
+
+// EvtLocalPeerLost is emitted when a peer that was discovered on the local network
+// stops announcing itself, i.e. its records expired without being refreshed.
+//
+// This event is usually emitted by the mDNS discovery service.
+type EvtLocalPeerLost struct {
+	Peer peer.ID
+}
+
+// EvtPeerExchangePeersFound is emitted when a connected peer returned a sample of the
+// peers it recently saw, using the peer exchange protocol.
+type EvtPeerExchangePeersFound struct {
+	// From is the peer that returned the sample.
+	From peer.ID
+	// Peers are the returned peers, with the addresses of their signed peer records.
+	Peers []peer.AddrInfo
+}
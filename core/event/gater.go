@@ -0,0 +1,21 @@
+package event
+
+import (
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// EvtConnectionGated is emitted when the connection gater denies a connection.
+type EvtConnectionGated struct {
+	// Peer is the remote peer. It's empty if the connection was denied when it was
+	// accepted, before the peer was authenticated.
+	Peer peer.ID
+	// Addr is the remote address. It's nil if the dial to the peer was denied before
+	// an address was chosen.
+	Addr      ma.Multiaddr
+	Direction network.Direction
+	Reason    connmgr.DenyReason
+}
@@ -0,0 +1,24 @@
+package event
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// EvtHolePunchFinished is emitted when an attempt to hole punch a direct connection
+// to a peer ends, on both the initiating and the receiving side.
+//
+// This event is usually emitted by the hole punching service.
+type EvtHolePunchFinished struct {
+	// Peer is the remote peer.
+	Peer peer.ID
+	// Initiator is true if the local node initiated the hole punch.
+	Initiator bool
+	// Success is true if a direct connection was established.
+	Success bool
+	// Duration is the time the simultaneous dial took.
+	Duration time.Duration
+	// Error describes why the attempt failed, it is empty on success.
+	Error string
+}
@@ -0,0 +1,22 @@
+package event
+
+// HostSetting is a setting of the host that can be changed while it's running.
+type HostSetting string
+
+const (
+	// HostSettingWatermarks are the watermarks of the connection manager.
+	HostSettingWatermarks HostSetting = "watermarks"
+	// HostSettingAddrFilters are the rules of the address filters.
+	HostSettingAddrFilters HostSetting = "addr-filters"
+	// HostSettingAnnounceAddrs are the addresses the host advertises.
+	HostSettingAnnounceAddrs HostSetting = "announce-addrs"
+	// HostSettingRelayService is whether the host runs a relay service.
+	HostSettingRelayService HostSetting = "relay-service"
+)
+
+// EvtHostReconfigured is emitted when the configuration of the host is changed while
+// it's running.
+type EvtHostReconfigured struct {
+	// Settings are the settings that were changed, in no particular order.
+	Settings []HostSetting
+}
@@ -0,0 +1,22 @@
+package event
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// EvtPeerLatencyThresholdCrossed is emitted when the latency estimate of a peer
+// crosses one of the configured latency thresholds.
+//
+// This event is usually emitted by the latency monitor of the ping service.
+type EvtPeerLatencyThresholdCrossed struct {
+	// Peer is the peer whose latency changed.
+	Peer peer.ID
+	// Latency is the current latency estimate (an EWMA of the measured RTTs).
+	Latency time.Duration
+	// Threshold is the threshold that was crossed.
+	Threshold time.Duration
+	// Above is true if the latency rose above the threshold, and false if it fell below it.
+	Above bool
+}
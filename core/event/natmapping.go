@@ -0,0 +1,82 @@
+package event
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// NATPortMappingStatus describes a change of a NAT port mapping.
+type NATPortMappingStatus int
+
+const (
+	// NATPortMappingAcquired means that a mapping was established.
+	NATPortMappingAcquired NATPortMappingStatus = iota
+	// NATPortMappingRenewed means that an established mapping was renewed.
+	NATPortMappingRenewed
+	// NATPortMappingFailed means that a new mapping couldn't be established.
+	NATPortMappingFailed
+	// NATPortMappingLost means that an established mapping couldn't be renewed.
+	NATPortMappingLost
+	// NATPortMappingRemoved means that a mapping was removed, e.g. because we stopped
+	// listening on its port.
+	NATPortMappingRemoved
+)
+
+func (s NATPortMappingStatus) String() string {
+	switch s {
+	case NATPortMappingAcquired:
+		return "acquired"
+	case NATPortMappingRenewed:
+		return "renewed"
+	case NATPortMappingFailed:
+		return "failed"
+	case NATPortMappingLost:
+		return "lost"
+	case NATPortMappingRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// NATPortMapping is a port mapping on a NAT device.
+type NATPortMapping struct {
+	// Protocol is either "tcp" or "udp".
+	Protocol     string
+	InternalPort int
+	// ExternalPort is 0 if the mapping isn't established.
+	ExternalPort int
+	// ExternalAddr is the external address of the NAT device, it is invalid if it is
+	// unknown.
+	ExternalAddr netip.Addr
+	// Expiry is when the lease of the mapping expires unless it is renewed. It is zero
+	// if the lease doesn't expire.
+	Expiry time.Time
+	// Gateway is the address of the NAT device.
+	Gateway netip.Addr
+}
+
+// EvtNATPortMappingChanged is emitted when a NAT port mapping is acquired, renewed,
+// lost or removed.
+type EvtNATPortMappingChanged struct {
+	Status  NATPortMappingStatus
+	Mapping NATPortMapping
+	// Error is the reason a mapping failed or was lost.
+	Error error
+}
+
+// EvtStaticPortMappingVerified is emitted after the reachability of an address of a
+// manually configured port mapping was verified using AutoNAT v2.
+type EvtStaticPortMappingVerified struct {
+	// Addr is the advertised address of the mapping.
+	Addr ma.Multiaddr
+	// Reachability is the verified reachability of Addr. It is
+	// network.ReachabilityUnknown if the verification failed.
+	Reachability network.Reachability
+	// Error is the reason the verification failed.
+	Error error
+}
@@ -1,8 +1,11 @@
 package event
 
 import (
+	"time"
+
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
 // EvtPeerConnectednessChanged should be emitted every time the "connectedness" to a
@@ -53,3 +56,36 @@ type EvtPeerConnectednessChanged struct {
 	// Connectedness is the new connectedness state.
 	Connectedness network.Connectedness
 }
+
+// EvtStreamOpened is emitted when a stream starts speaking a protocol, i.e. when
+// the protocol of the stream is set after negotiating it. It is only emitted if
+// stream events are enabled on the swarm, and may only be emitted for a sample of
+// the streams.
+type EvtStreamOpened struct {
+	// Peer is the remote peer of the stream.
+	Peer peer.ID
+	// Protocol is the protocol the stream speaks.
+	Protocol protocol.ID
+	// Direction is the direction of the stream.
+	Direction network.Direction
+}
+
+// EvtStreamClosed is emitted when a stream is closed or reset. It is emitted for
+// the same streams as EvtStreamOpened, and for streams of the sample that were
+// closed before a protocol was negotiated.
+type EvtStreamClosed struct {
+	// Peer is the remote peer of the stream.
+	Peer peer.ID
+	// Protocol is the protocol the stream spoke, it is empty if no protocol was
+	// negotiated.
+	Protocol protocol.ID
+	// Direction is the direction of the stream.
+	Direction network.Direction
+	// Reset is true if the stream was reset rather than closed.
+	Reset bool
+	// Duration is the time the stream was open for.
+	Duration time.Duration
+	// BytesRead and BytesWritten are the number of bytes read from and written to
+	// the stream.
+	BytesRead, BytesWritten uint64
+}
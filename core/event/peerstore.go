@@ -0,0 +1,43 @@
+package event
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// EvtPeerAdded is emitted by the peerstore when it stores the first address of a peer.
+type EvtPeerAdded struct {
+	// Peer is the ID of the peer that was added.
+	Peer peer.ID
+}
+
+// EvtPeerRemoved is emitted by the peerstore when it removed the last address of a
+// peer. Expired addresses are only removed when the address book is garbage
+// collected, so the event may be emitted some time after the last address expired.
+type EvtPeerRemoved struct {
+	// Peer is the ID of the peer that was removed.
+	Peer peer.ID
+}
+
+// EvtPeerAddrsUpdated is emitted by the peerstore when addresses of a peer were added
+// or removed. Changes of the TTLs of known addresses aren't reported.
+type EvtPeerAddrsUpdated struct {
+	// Peer is the ID of the peer whose addresses changed.
+	Peer peer.ID
+	// Added contains the addresses that were added.
+	Added []ma.Multiaddr
+	// Removed contains the addresses that were removed, including the ones that
+	// expired.
+	Removed []ma.Multiaddr
+}
+
+// EvtPeerRecordUpdated is emitted by the peerstore when it accepted a signed peer
+// record newer than the one it held for a peer.
+type EvtPeerRecordUpdated struct {
+	// Peer is the ID of the peer whose record was updated.
+	Peer peer.ID
+	// SignedPeerRecord is the envelope containing the new peer.PeerRecord.
+	SignedPeerRecord *record.Envelope
+}
@@ -1,6 +1,9 @@
 package event
 
 import (
+	"time"
+
+	network "github.com/libp2p/go-libp2p/core/network"
 	peer "github.com/libp2p/go-libp2p/core/peer"
 	protocol "github.com/libp2p/go-libp2p/core/protocol"
 )
@@ -13,6 +16,10 @@ type EvtPeerProtocolsUpdated struct {
 	Added []protocol.ID
 	// Removed enumerates the protocols that were removed by this peer.
 	Removed []protocol.ID
+	// Conn is the connection on which the update was received.
+	Conn network.Conn
+	// Time is the time at which the update was received.
+	Time time.Time
 }
 
 // EvtLocalProtocolsUpdated should be emitted when stream handlers are attached or detached from the local host.
@@ -24,3 +31,39 @@ type EvtLocalProtocolsUpdated struct {
 	// Removed enumerates the protocols that were removed locally.
 	Removed []protocol.ID
 }
+
+// ProtocolNegotiationFailure is the reason a protocol negotiation failed.
+type ProtocolNegotiationFailure string
+
+const (
+	// NegotiationUnsupported means that the peer doesn't support any of the proposed
+	// protocols.
+	NegotiationUnsupported ProtocolNegotiationFailure = "unsupported"
+	// NegotiationTimeout means that the negotiation took longer than the negotiation
+	// timeout.
+	NegotiationTimeout ProtocolNegotiationFailure = "timeout"
+	// NegotiationCanceled means that the context of the negotiation was canceled.
+	NegotiationCanceled ProtocolNegotiationFailure = "canceled"
+	// NegotiationClosed means that the peer closed the stream before a protocol was
+	// selected.
+	NegotiationClosed ProtocolNegotiationFailure = "closed"
+	// NegotiationError is any other failure, e.g. a reset stream.
+	NegotiationError ProtocolNegotiationFailure = "error"
+)
+
+// EvtProtocolNegotiationFailed is emitted when negotiating the protocol of a new
+// stream fails.
+type EvtProtocolNegotiationFailed struct {
+	// Peer is the remote peer of the stream.
+	Peer peer.ID
+	// Direction is the direction of the stream.
+	Direction network.Direction
+	// Protocols are the protocols we proposed. It is empty for inbound streams.
+	Protocols []protocol.ID
+	// Reason is the reason the negotiation failed.
+	Reason ProtocolNegotiationFailure
+	// Error is the error the negotiation failed with.
+	Error error
+	// Duration is the time the negotiation took until it failed.
+	Duration time.Duration
+}
@@ -0,0 +1,21 @@
+package event
+
+import (
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// EvtResourceLimitsUpdated is emitted by the resource manager when its limits are
+// changed at runtime.
+type EvtResourceLimitsUpdated struct {
+	// Scopes are the names of the existing scopes whose limits changed, like "system",
+	// "service:<name>", "protocol:<id>" or "peer:<id>".
+	Scopes []string
+}
+
+// EvtAllowlistUpdated is emitted by the resource manager when an entry is added to or
+// removed from its allowlist.
+type EvtAllowlistUpdated struct {
+	// Added and Removed are the entries that were added and removed, like
+	// /ip4/1.2.3.0/ipcidr/24 or /ip4/1.2.3.4/ipcidr/32/p2p/<peer>.
+	Added, Removed []ma.Multiaddr
+}
@@ -2,6 +2,9 @@ package event
 
 import (
 	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 // EvtLocalReachabilityChanged is an event struct to be emitted when the local's
@@ -10,4 +13,32 @@ import (
 // This event is usually emitted by the AutoNAT subsystem.
 type EvtLocalReachabilityChanged struct {
 	Reachability network.Reachability
+	// Confidence is the confidence in Reachability at the time of the change, between
+	// 0 and 1. It grows with the number of consecutive observations confirming
+	// Reachability, and is 1 if Reachability was configured or overridden.
+	Confidence float64
+	// Evidence holds the observations Reachability is based on. It is empty if
+	// Reachability was configured or overridden.
+	Evidence ReachabilityEvidence
+}
+
+// ReachabilityEvidence describes the observations a reachability status is based on.
+type ReachabilityEvidence struct {
+	// Peers are the peers whose most recent consecutive dial-back attempts confirmed
+	// the reachability, oldest first. A peer appears once per attempt.
+	Peers []peer.ID
+	// Addrs are the addresses these peers were asked to dial back.
+	Addrs []ma.Multiaddr
+}
+
+// EvtTransportReachabilityChanged is an event struct to be emitted when the
+// reachability of any of the local node's transports changes state.
+//
+// Reachability is keyed by transport, i.e. the address family and the protocol
+// stack of the local addresses with the IPs and ports stripped, for example
+// "ip4/tcp" or "ip6/udp/quic-v1".
+//
+// This event is usually emitted by the AutoNAT v2 subsystem.
+type EvtTransportReachabilityChanged struct {
+	Reachability map[string]network.Reachability
 }
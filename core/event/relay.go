@@ -0,0 +1,58 @@
+package event
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// EvtRelayReservationObtained is emitted when a reservation with a relay is obtained.
+//
+// The reservation events are usually emitted by AutoRelay.
+type EvtRelayReservationObtained struct {
+	// Relay is the ID of the relay.
+	Relay peer.ID
+	// Expiration is the time the reservation expires unless it is renewed.
+	Expiration time.Time
+}
+
+// EvtRelayReservationRenewed is emitted when a reservation with a relay is renewed.
+type EvtRelayReservationRenewed struct {
+	// Relay is the ID of the relay.
+	Relay peer.ID
+	// Expiration is the new expiration time of the reservation.
+	Expiration time.Time
+}
+
+// EvtRelayReservationExpiring is emitted once when a reservation with a relay is about
+// to expire. The reservation is usually renewed right after.
+type EvtRelayReservationExpiring struct {
+	// Relay is the ID of the relay.
+	Relay peer.ID
+	// Expiration is the time the reservation expires unless it is renewed.
+	Expiration time.Time
+}
+
+// EvtRelayReservationLost is emitted when a reservation with a relay is lost, because
+// we disconnected from the relay, renewing the reservation failed, or the reservation
+// expired without being renewed.
+type EvtRelayReservationLost struct {
+	// Relay is the ID of the relay.
+	Relay peer.ID
+	// Expiration is the expiration time of the lost reservation.
+	Expiration time.Time
+	// Reason is the reason why the reservation was lost.
+	Reason error
+}
+
+// EvtRelayFailover is emitted by AutoRelay when prioritized static relays are used,
+// and we start using a different relay as the highest priority relay. This happens
+// when we fail over to a lower priority relay after the reservation with the
+// previous relay was lost, and when we switch back to a higher priority relay once
+// it's available again.
+type EvtRelayFailover struct {
+	// From is the ID of the previously used relay.
+	From peer.ID
+	// To is the ID of the relay now used.
+	To peer.ID
+}
@@ -0,0 +1,108 @@
+package peerstore
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// AddrSource describes where an address of a peer was learned from.
+type AddrSource int
+
+const (
+	// AddrSourceUnknown is the source of addresses added using AddrBook.AddAddrs,
+	// AddrBook.SetAddrs and CertifiedAddrBook.ConsumePeerRecord.
+	AddrSourceUnknown AddrSource = iota
+	// AddrSourceManual is the source of addresses explicitly configured by the user,
+	// e.g. bootstrap peers.
+	AddrSourceManual
+	// AddrSourceIdentify is the source of addresses the peer advertised itself using
+	// the identify protocol.
+	AddrSourceIdentify
+	// AddrSourceRelay is the source of addresses learned from a relay.
+	AddrSourceRelay
+	// AddrSourceDHT is the source of addresses learned from a routing system, e.g. the DHT.
+	AddrSourceDHT
+	// AddrSourceObserved is the source of addresses we observed the peer at, e.g. the
+	// remote address of a connection.
+	AddrSourceObserved
+)
+
+func (s AddrSource) String() string {
+	switch s {
+	case AddrSourceUnknown:
+		return "unknown"
+	case AddrSourceManual:
+		return "manual"
+	case AddrSourceIdentify:
+		return "identify"
+	case AddrSourceRelay:
+		return "relay"
+	case AddrSourceDHT:
+		return "dht"
+	case AddrSourceObserved:
+		return "observed"
+	default:
+		return "invalid"
+	}
+}
+
+// IsThirdParty returns true if addresses from s were provided by other peers than the
+// peer they belong to.
+func (s AddrSource) IsThirdParty() bool {
+	return s == AddrSourceRelay || s == AddrSourceDHT
+}
+
+// Replaces returns true if s replaces old as the source of an address, see
+// ProvenanceAddrBook.AddAddrsWithSource.
+func (s AddrSource) Replaces(old AddrSource) bool {
+	if s == AddrSourceUnknown {
+		return false
+	}
+	return old == AddrSourceUnknown || (old.IsThirdParty() && !s.IsThirdParty())
+}
+
+// AddrProvenance describes where an address came from.
+type AddrProvenance struct {
+	// Source is where the address was learned from.
+	Source AddrSource
+	// LastConfirmed is the last time we successfully connected to the peer using the
+	// address. It is zero if we never did.
+	LastConfirmed time.Time
+}
+
+// ProvenanceAddrBook is implemented by address books that track the provenance of
+// addresses. To test whether an AddrBook supports it, use GetProvenanceAddrBook.
+type ProvenanceAddrBook interface {
+	// AddAddrsWithSource adds addresses like AddrBook.AddAddrs, and records src as
+	// their source. A known source replaces an unknown one, and a source that isn't
+	// a third party replaces a third party one. Otherwise, the source of an address
+	// that is already known doesn't change.
+	AddAddrsWithSource(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, src AddrSource)
+
+	// ConfirmAddr records that we just successfully connected to p using addr.
+	ConfirmAddr(p peer.ID, addr ma.Multiaddr)
+
+	// AddrProvenance returns the provenance of the address addr of p. It returns
+	// false if the address isn't known.
+	AddrProvenance(p peer.ID, addr ma.Multiaddr) (AddrProvenance, bool)
+}
+
+// GetProvenanceAddrBook is a helper to "upcast" an AddrBook to a ProvenanceAddrBook
+// by using type assertion, like GetCertifiedAddrBook.
+func GetProvenanceAddrBook(ab AddrBook) (pab ProvenanceAddrBook, ok bool) {
+	pab, ok = ab.(ProvenanceAddrBook)
+	return pab, ok
+}
+
+// AddAddrsWithSource adds addrs to ab, and records src as their source if ab is a
+// ProvenanceAddrBook. Otherwise, it falls back to AddrBook.AddAddrs.
+func AddAddrsWithSource(ab AddrBook, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, src AddrSource) {
+	if pab, ok := GetProvenanceAddrBook(ab); ok {
+		pab.AddAddrsWithSource(p, addrs, ttl, src)
+		return
+	}
+	ab.AddAddrs(p, addrs, ttl)
+}
@@ -124,3 +124,32 @@ type Upgrader interface {
 	// Upgrade upgrades the multiaddr/net connection into a full libp2p-transport connection.
 	Upgrade(ctx context.Context, t Transport, maconn manet.Conn, dir network.Direction, p peer.ID, scope network.ConnManagementScope) (CapableConn, error)
 }
+
+// UpgradeStage is a stage of the upgrade of a connection.
+type UpgradeStage string
+
+const (
+	// UpgradeStageSecurity is the setup of the private network protector and the
+	// security handshake.
+	UpgradeStageSecurity UpgradeStage = "security"
+	// UpgradeStageMuxer starts once the connection is secured. It includes the checks
+	// of the connection gater and of the resource manager on the authenticated peer,
+	// and the negotiation of the stream multiplexer.
+	UpgradeStageMuxer UpgradeStage = "muxer"
+)
+
+// UpgradeError is returned by Upgrader.Upgrade when a stage of the upgrade fails,
+// to tell the failures of the security handshake and of the stream multiplexer
+// apart. It has the message of the underlying error.
+type UpgradeError struct {
+	Stage UpgradeStage
+	Err   error
+}
+
+func (e *UpgradeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UpgradeError) Unwrap() error {
+	return e.Err
+}
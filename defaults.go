@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
 	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
 	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
 	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
@@ -59,7 +60,12 @@ var DefaultPrivateTransports = ChainOptions(
 
 // DefaultPeerstore configures libp2p to use the default peerstore.
 var DefaultPeerstore Option = func(cfg *Config) error {
-	ps, err := pstoremem.NewPeerstore()
+	var opts []pstoremem.Option
+	if !cfg.DisableMetrics {
+		opts = append(opts, pstoremem.WithGCMetricsTracer(
+			peerstore.NewGCMetricsTracer(peerstore.WithRegisterer(cfg.PrometheusRegisterer))))
+	}
+	ps, err := pstoremem.NewPeerstore(opts...)
 	if err != nil {
 		return err
 	}
@@ -167,10 +173,6 @@ var defaults = []struct {
 		fallback: func(cfg *Config) bool { return cfg.PeerKey == nil },
 		opt:      RandomIdentity,
 	},
-	{
-		fallback: func(cfg *Config) bool { return cfg.Peerstore == nil },
-		opt:      DefaultPeerstore,
-	},
 	{
 		fallback: func(cfg *Config) bool { return !cfg.RelayCustom },
 		opt:      DefaultEnableRelay,
@@ -191,6 +193,11 @@ var defaults = []struct {
 		fallback: func(cfg *Config) bool { return !cfg.DisableMetrics && cfg.PrometheusRegisterer == nil },
 		opt:      DefaultPrometheusRegisterer,
 	},
+	{
+		// after the registerer, which is used for the peerstore metrics
+		fallback: func(cfg *Config) bool { return cfg.Peerstore == nil },
+		opt:      DefaultPeerstore,
+	},
 }
 
 // Defaults configures libp2p to use the default options. Can be combined with
@@ -206,8 +213,15 @@ var Defaults Option = func(cfg *Config) error {
 
 // FallbackDefaults applies default options to the libp2p node if and only if no
 // other relevant options have been applied. will be appended to the options
-// passed into New.
+// passed into New. The profiles, such as ProfileServer, are applied first, the last
+// one first.
 var FallbackDefaults Option = func(cfg *Config) error {
+	for i := len(cfg.Profiles) - 1; i >= 0; i-- {
+		if err := cfg.Profiles[i](cfg); err != nil {
+			return err
+		}
+	}
+	cfg.Profiles = nil
 	for _, def := range defaults {
 		if !def.fallback(cfg) {
 			continue
@@ -1,26 +1,55 @@
 package libp2p
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/libp2p/go-libp2p/config"
 	"github.com/libp2p/go-libp2p/core/connmgr"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/routing"
 	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/host/autonat"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	"github.com/libp2p/go-libp2p/p2p/host/bootstrap"
+	"github.com/libp2p/go-libp2p/p2p/host/debug"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/net/addrfilter"
+	"github.com/libp2p/go-libp2p/p2p/net/conngater"
+	bconnmgr "github.com/libp2p/go-libp2p/p2p/net/connmgr"
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
 	"github.com/libp2p/go-libp2p/p2p/security/noise"
 	tls "github.com/libp2p/go-libp2p/p2p/security/tls"
+	"github.com/libp2p/go-libp2p/p2p/transport/memory"
 	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 	webtransport "github.com/libp2p/go-libp2p/p2p/transport/webtransport"
 
 	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
 )
 
 func TestNewHost(t *testing.T) {
@@ -97,6 +126,33 @@ func TestAutoNATService(t *testing.T) {
 	h.Close()
 }
 
+func TestAutoNATServiceDialer(t *testing.T) {
+	dialer := swarmt.GenSwarm(t, swarmt.OptDialOnly)
+	defer dialer.Close()
+	h, err := New(AutoNATServiceDialer(dialer), AutoNATServiceDialTimeout(time.Second))
+	require.NoError(t, err)
+	defer h.Close()
+	require.Contains(t, h.Mux().Protocols(), protocol.ID(autonat.AutoNATProto))
+
+	_, err = New(AutoNATServiceDialTimeout(0))
+	require.Error(t, err)
+}
+
+func TestAutoNATv2(t *testing.T) {
+	h, err := New(EnableNATService(), EnableAutoNATv2())
+	require.NoError(t, err)
+	defer h.Close()
+	require.Contains(t, h.Mux().Protocols(), protocol.ID(autonatv2.DialProtocol))
+	require.Contains(t, h.Mux().Protocols(), protocol.ID(autonatv2.DialBackProtocol))
+
+	// without the NAT service, only the client is enabled
+	h2, err := New(EnableAutoNATv2())
+	require.NoError(t, err)
+	defer h2.Close()
+	require.NotContains(t, h2.Mux().Protocols(), protocol.ID(autonatv2.DialProtocol))
+	require.Contains(t, h2.Mux().Protocols(), protocol.ID(autonatv2.DialBackProtocol))
+}
+
 func TestDefaultListenAddrs(t *testing.T) {
 	reTCP := regexp.MustCompile("/(ip)[4|6]/((0.0.0.0)|(::))/tcp/")
 	reQUIC := regexp.MustCompile("/(ip)[4|6]/((0.0.0.0)|(::))/udp/([0-9]*)/quic")
@@ -356,3 +412,507 @@ func TestTransportCustomAddressWebTransportDoesNotStall(t *testing.T) {
 	// We did not add the certhash to the multiaddr
 	require.Equal(t, addrs[0], customAddr)
 }
+
+type gatherExporter struct{ g prometheus.Gatherer }
+
+func (e *gatherExporter) Export(g prometheus.Gatherer) error {
+	e.g = g
+	return nil
+}
+
+func TestMetricsExporter(t *testing.T) {
+	exp := &gatherExporter{}
+	h, err := New(NoListenAddrs, MetricsExporter(exp))
+	require.NoError(t, err)
+	defer h.Close()
+
+	require.NotNil(t, exp.g)
+	families, err := exp.g.Gather()
+	require.NoError(t, err)
+	var names []string
+	for _, mf := range families {
+		names = append(names, mf.GetName())
+	}
+	require.Contains(t, names, "libp2p_eventbus_subscribers_total")
+
+	_, err = New(DisableMetrics(), MetricsExporter(exp))
+	require.Error(t, err)
+}
+
+func TestDebugServer(t *testing.T) {
+	h, err := New(NoListenAddrs, WithDebugServer("127.0.0.1:0"))
+	require.NoError(t, err)
+	defer h.Close()
+
+	dh, ok := h.(*debug.Host)
+	require.True(t, ok)
+	resp, err := http.Get(fmt.Sprintf("http://%s/config", dh.DebugServer().Addr()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var cfg struct{ PeerID peer.ID }
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&cfg))
+	require.Equal(t, h.ID(), cfg.PeerID)
+
+	_, err = New(WithDebugServer("localhost"))
+	require.Error(t, err)
+}
+
+func TestBootstrap(t *testing.T) {
+	bootstrapHost, err := New(ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer bootstrapHost.Close()
+	addrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: bootstrapHost.ID(), Addrs: bootstrapHost.Addrs()})
+	require.NoError(t, err)
+
+	h, err := New(NoListenAddrs, Bootstrap(addrs, bootstrap.WithMinPeers(1)))
+	require.NoError(t, err)
+	defer h.Close()
+	bh, ok := h.(*bootstrap.Host)
+	require.True(t, ok)
+	require.Eventually(t, func() bool { return bh.Bootstrapper().Status().Healthy }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, network.Connected, h.Network().Connectedness(bootstrapHost.ID()))
+
+	_, err = New(NoListenAddrs, Bootstrap(nil))
+	require.Error(t, err)
+}
+
+func TestAddrFilters(t *testing.T) {
+	filters := addrfilter.New()
+	h1, err := New(AddrFilters(filters), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h1.Close()
+	h2, err := New(ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h2.Close()
+	sub, err := h1.EventBus().Subscribe(new(event.EvtLocalAddressesUpdated))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	ai := peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}
+	require.NoError(t, h1.Connect(context.Background(), ai))
+
+	_, loopback, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(t, err)
+	require.NoError(t, filters.Deny(*loopback))
+	require.Eventually(t, func() bool {
+		return h1.Network().Connectedness(h2.ID()) != network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, h1.Addrs())
+	require.Eventually(t, func() bool {
+		select {
+		case e := <-sub.Out():
+			return len(e.(event.EvtLocalAddressesUpdated).Current) == 0
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+	h1.Peerstore().ClearAddrs(h2.ID())
+	require.Error(t, h1.Connect(context.Background(), ai))
+
+	require.Equal(t, 1, filters.Remove(*loopback))
+	require.Eventually(t, func() bool { return len(h1.Addrs()) > 0 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, h1.Connect(context.Background(), ai))
+}
+
+func TestAddrFiltersListenAddrs(t *testing.T) {
+	filters := addrfilter.New()
+	_, loopback, err := net.ParseCIDR("127.0.0.0/8")
+	require.NoError(t, err)
+	require.NoError(t, filters.Deny(*loopback))
+
+	_, err = New(AddrFilters(filters), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.ErrorContains(t, err, "denied by the address filters")
+
+	// the unspecified address is listened on, but the loopback addresses aren't advertised
+	h, err := New(AddrFilters(filters), ListenAddrStrings("/ip4/0.0.0.0/tcp/0"))
+	require.NoError(t, err)
+	defer h.Close()
+	for _, a := range h.Addrs() {
+		require.False(t, manet.IsIPLoopback(a), "advertised %s", a)
+	}
+}
+
+func TestDNSAddrs(t *testing.T) {
+	dnsAddr := ma.StringCast("/dns4/example.com/tcp/4001")
+	h, err := New(DNSAddrs(false, dnsAddr), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h.Close()
+	addrs := h.Addrs()
+	require.Contains(t, addrs, dnsAddr)
+	require.Len(t, addrs, 2)
+
+	_, err = New(DNSAddrs(false, ma.StringCast("/ip4/1.2.3.4/tcp/4001")))
+	require.Error(t, err)
+}
+
+func TestMemoryTransport(t *testing.T) {
+	newHost := func() host.Host {
+		h, err := New(Transport(memory.NewTransport), ListenAddrStrings("/memory/0"))
+		require.NoError(t, err)
+		return h
+	}
+	h1, h2 := newHost(), newHost()
+	defer h1.Close()
+	defer h2.Close()
+	require.Len(t, h2.Addrs(), 1)
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+
+	h2.SetStreamHandler("/echo", func(s network.Stream) {
+		defer s.Close()
+		io.Copy(s, s)
+	})
+	s, err := h1.NewStream(context.Background(), h2.ID(), "/echo")
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, s.CloseWrite())
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b))
+}
+
+func TestEnableNAT64(t *testing.T) {
+	h, err := New(EnableNAT64(), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h.Close()
+	require.NotEmpty(t, h.Addrs())
+}
+
+func TestConnectionTrace(t *testing.T) {
+	var buf bytes.Buffer
+	h1, err := New(ConnectionTrace(&buf), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	h2, err := New(ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h2.Close()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	require.NoError(t, h1.Close())
+
+	var r swarm.TraceRecord
+	require.NoError(t, json.NewDecoder(&buf).Decode(&r))
+	require.Equal(t, swarm.TraceDialStarted, r.Type)
+	require.Equal(t, h2.ID(), r.Peer)
+
+	_, err = New(ConnectionTrace(&buf), ConnectionTraceFile("trace.json", 0, 0))
+	require.Error(t, err)
+}
+
+func TestConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	sk, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	b, err := crypto.MarshalPrivateKey(sk)
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(keyFile, b, 0o600))
+
+	yamlFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte(`
+IdentityFile: `+keyFile+`
+ListenAddrs: [/ip4/127.0.0.1/tcp/0]
+Transports: [tcp]
+Security: [noise]
+Muxers: [yamux]
+Relay:
+  Disable: true
+ConnManager:
+  Low: 10
+  High: 20
+  GracePeriod: 1m
+ResourceManager:
+  Limits:
+    System:
+      Conns: 123
+`), 0o644))
+	jsonFile := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{
+		"IdentityFile": "`+keyFile+`",
+		"ListenAddrs": ["/ip4/127.0.0.1/tcp/0"],
+		"Transports": ["tcp"],
+		"Security": ["noise"],
+		"Muxers": ["yamux"],
+		"Relay": {"Disable": true},
+		"ConnManager": {"Low": 10, "High": 20, "GracePeriod": "1m"},
+		"ResourceManager": {"Limits": {"System": {"Conns": 123}}}
+	}`), 0o644))
+	tomlFile := filepath.Join(dir, "config.toml")
+	require.NoError(t, os.WriteFile(tomlFile, []byte(`
+IdentityFile = "`+keyFile+`"
+ListenAddrs = ["/ip4/127.0.0.1/tcp/0"]
+Transports = ["tcp"]
+Security = ["noise"]
+Muxers = ["yamux"]
+
+[Relay]
+Disable = true
+
+[ConnManager]
+Low = 10
+High = 20
+GracePeriod = "1m"
+
+[ResourceManager.Limits.System]
+Conns = 123
+`), 0o644))
+	yamlCfg, err := LoadConfigFile(yamlFile)
+	require.NoError(t, err)
+	jsonCfg, err := LoadConfigFile(jsonFile)
+	require.NoError(t, err)
+	require.Equal(t, jsonCfg, yamlCfg)
+	tomlCfg, err := LoadConfigFile(tomlFile)
+	require.NoError(t, err)
+	require.Equal(t, jsonCfg, tomlCfg)
+
+	h, err := New(ConfigFile(yamlFile))
+	require.NoError(t, err)
+	defer h.Close()
+	require.Equal(t, sk.GetPublic(), h.Peerstore().PubKey(h.ID()))
+	require.NotEmpty(t, h.Addrs())
+	for _, a := range h.Addrs() {
+		_, err := a.ValueForProtocol(ma.P_TCP)
+		require.NoError(t, err)
+	}
+	info := h.ConnManager().(*bconnmgr.BasicConnMgr).GetInfo()
+	require.Equal(t, 10, info.LowWater)
+	require.Equal(t, 20, info.HighWater)
+	require.Equal(t, time.Minute, info.GracePeriod)
+	limits, err := h.Network().ResourceManager().(rcmgr.LimitUpdater).Limits()
+	require.NoError(t, err)
+	require.Equal(t, rcmgr.LimitVal(123), limits.ToPartialLimitConfig().System.Conns)
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	for name, cfg := range map[string]string{
+		"unknown field":     `{"Transport": ["tcp"]}`,
+		"unknown transport": `{"Transports": ["udp"]}`,
+		"unknown muxer":     `{"Muxers": ["spdy"]}`,
+		"relay disabled":    `{"Relay": {"Disable": true, "Service": true}}`,
+		"watermarks":        `{"ConnManager": {"Low": 20, "High": 10}}`,
+		"invalid duration":  `{"ConnManager": {"GracePeriod": "1 minute"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := DecodeConfig(strings.NewReader(cfg), DecodeJSONConfig)
+			if err == nil {
+				_, err = New(c.Option())
+			}
+			require.Error(t, err)
+		})
+	}
+
+	_, err := LoadConfigFile("config.ini")
+	require.Error(t, err)
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	cm, err := bconnmgr.NewConnManager(10, 20)
+	require.NoError(t, err)
+	h, err := New(
+		ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		Transport(tcp.NewTCPTransport),
+		ConnectionManager(cm),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+
+	c := h.(*bhost.BasicHost).EffectiveConfig()
+	require.NotNil(t, c)
+	require.Equal(t, h.ID(), c.PeerID)
+	require.ElementsMatch(t, h.Network().ListenAddresses(), c.ListenAddrs)
+	require.Equal(t, []string{"p2p-circuit", "tcp"}, c.Transports)
+	require.Equal(t, []protocol.ID{noise.ID, tls.ID}, c.SecurityProtocols)
+	require.Equal(t, []protocol.ID{"/yamux/1.0.0"}, c.Muxers)
+	require.Equal(t, 15*time.Second, c.DialTimeout)
+	require.Equal(t, bhost.DefaultNegotiationTimeout, c.NegotiationTimeout)
+	require.NotEmpty(t, c.UserAgent)
+	require.Contains(t, c.Protocols, protocol.ID("/ipfs/id/1.0.0"))
+	require.Equal(t, &config.ConnManagerLimits{LowWater: 10, HighWater: 20, GracePeriod: time.Minute}, c.ConnManagerLimits)
+	require.NotNil(t, c.ResourceManagerLimits)
+
+	// the changes made at runtime show
+	require.NoError(t, h.Network().ResourceManager().(rcmgr.LimitUpdater).UpdateLimits(
+		rcmgr.PartialLimitConfig{System: rcmgr.ResourceLimits{Conns: 42}}))
+	c = h.(*bhost.BasicHost).EffectiveConfig()
+	require.Equal(t, rcmgr.LimitVal(42), c.ResourceManagerLimits.System.Conns)
+
+	b, err := json.Marshal(c)
+	require.NoError(t, err)
+	var decoded struct {
+		PeerID                peer.ID
+		ResourceManagerLimits rcmgr.PartialLimitConfig
+	}
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Equal(t, c.PeerID, decoded.PeerID)
+	require.Equal(t, rcmgr.LimitVal(42), decoded.ResourceManagerLimits.System.Conns)
+}
+
+func TestEffectiveConfigWrapped(t *testing.T) {
+	bootstrapHost, err := New(NoListenAddrs)
+	require.NoError(t, err)
+	defer bootstrapHost.Close()
+	addr, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/1/p2p/" + bootstrapHost.ID().String())
+	require.NoError(t, err)
+
+	h, err := New(
+		NoListenAddrs,
+		Routing(func(host.Host) (routing.PeerRouting, error) { return noopPeerRouting{}, nil }),
+		EnableRelay(),
+		EnableAutoRelayWithStaticRelays(nil),
+		Bootstrap([]ma.Multiaddr{addr}),
+		WithFxOption(fx.Invoke(func() {})),
+		WithDebugServer("127.0.0.1:0"),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+	_, ok := h.(*debug.Host)
+	require.True(t, ok)
+
+	c := bhost.GetEffectiveConfig(h)
+	require.NotNil(t, c)
+	require.Equal(t, h.ID(), c.PeerID)
+	require.True(t, c.EnableAutoRelay)
+	require.True(t, c.EnableBootstrap)
+
+	require.Nil(t, bhost.GetEffectiveConfig(blankhost.NewBlankHost(swarmt.GenSwarm(t))))
+}
+
+type noopPeerRouting struct{}
+
+func (noopPeerRouting) FindPeer(context.Context, peer.ID) (peer.AddrInfo, error) {
+	return peer.AddrInfo{}, routing.ErrNotFound
+}
+
+func TestWithFxOption(t *testing.T) {
+	type service struct {
+		started, stopped chan struct{}
+		listening        int
+		conns            int
+	}
+	s := &service{started: make(chan struct{}), stopped: make(chan struct{})}
+	h, err := New(
+		ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		WithFxOption(fx.Invoke(func(lc fx.Lifecycle, h host.Host, n network.Network) {
+			lc.Append(fx.Hook{
+				OnStart: func(context.Context) error {
+					s.listening = len(h.Addrs())
+					close(s.started)
+					return nil
+				},
+				OnStop: func(context.Context) error {
+					s.conns = len(n.Conns())
+					close(s.stopped)
+					return nil
+				},
+			})
+		})),
+	)
+	require.NoError(t, err)
+	<-s.started
+	require.NotZero(t, s.listening)
+
+	h2, err := New(NoListenAddrs)
+	require.NoError(t, err)
+	defer h2.Close()
+	require.NoError(t, h2.Connect(context.Background(), peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}))
+
+	require.NoError(t, h.Close())
+	<-s.stopped
+	require.Equal(t, 1, s.conns)
+
+	// a failing service fails the construction of the host
+	_, err = New(NoListenAddrs, WithFxOption(fx.Invoke(func(lc fx.Lifecycle) {
+		lc.Append(fx.Hook{OnStart: func(context.Context) error { return errors.New("failed") }})
+	})))
+	require.ErrorContains(t, err, "failed")
+	_, err = New(NoListenAddrs, WithFxOption(fx.Invoke(func(string) {})))
+	require.Error(t, err)
+}
+
+func TestProfiles(t *testing.T) {
+	effectiveConfig := func(t *testing.T, opts ...Option) *config.EffectiveConfig {
+		t.Helper()
+		h, err := New(opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		return h.(*bhost.BasicHost).EffectiveConfig()
+	}
+
+	t.Run("low power", func(t *testing.T) {
+		c := effectiveConfig(t, ProfileLowPower(), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.Equal(t, []string{"p2p-circuit", "quic", "quic-v1", "tcp"}, c.Transports)
+		require.Equal(t, 20, c.ConnManagerLimits.LowWater)
+		require.Equal(t, 40, c.ConnManagerLimits.HighWater)
+		require.Equal(t, 30*time.Second, c.DialTimeout)
+		require.Equal(t, 20*time.Second, c.OutboundNegotiationTimeout)
+	})
+
+	t.Run("browser compatible", func(t *testing.T) {
+		c := effectiveConfig(t, ProfileBrowserCompatible(),
+			ListenAddrStrings("/ip4/127.0.0.1/tcp/0/ws", "/ip4/127.0.0.1/udp/0/quic-v1/webtransport"))
+		require.Equal(t, []string{"p2p-circuit", "webtransport", "ws", "wss"}, c.Transports)
+	})
+
+	t.Run("overridden", func(t *testing.T) {
+		cm, err := bconnmgr.NewConnManager(1, 2)
+		require.NoError(t, err)
+		c := effectiveConfig(t,
+			ProfileLowPower(),
+			ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+			Transport(tcp.NewTCPTransport),
+			ConnectionManager(cm),
+			WithDialTimeout(time.Second),
+		)
+		require.Equal(t, []string{"p2p-circuit", "tcp"}, c.Transports)
+		require.Equal(t, 2, c.ConnManagerLimits.HighWater)
+		require.Equal(t, time.Second, c.DialTimeout)
+		require.Equal(t, 20*time.Second, c.OutboundNegotiationTimeout)
+	})
+
+	t.Run("last profile wins", func(t *testing.T) {
+		c := effectiveConfig(t, ProfileLowPower(), ProfileServer(), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.Equal(t, 900, c.ConnManagerLimits.HighWater)
+		require.Contains(t, c.Transports, "webtransport")
+		// the server profile doesn't set the timeouts
+		require.Equal(t, 30*time.Second, c.DialTimeout)
+	})
+}
+
+func TestConnectionGatedReason(t *testing.T) {
+	h2, err := New(ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h2.Close()
+
+	g, err := conngater.NewRuleGater(nil)
+	require.NoError(t, err)
+	require.NoError(t, g.AddRule(conngater.Rule{Action: conngater.RuleDeny, Peer: h2.ID()}))
+	h1, err := New(ConnectionGater(g), NoListenAddrs)
+	require.NoError(t, err)
+	defer h1.Close()
+	sub, err := h1.EventBus().Subscribe(new(event.EvtConnectionGated))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	err = h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()})
+	require.ErrorIs(t, err, swarm.ErrGaterDisallowedConnection)
+	var gerr *connmgr.GatedError
+	require.ErrorAs(t, err, &gerr)
+	reason := connmgr.DenyReason{Stage: connmgr.GatingStagePeerDial, Gater: "rules", Rule: "deny peer " + h2.ID().String()}
+	require.Equal(t, reason, gerr.Reason)
+	select {
+	case e := <-sub.Out():
+		require.Equal(t, event.EvtConnectionGated{Peer: h2.ID(), Direction: network.DirOutbound, Reason: reason}, e)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an event")
+	}
+
+	// the addresses the gater disallows are listed in the dial error
+	require.NoError(t, g.RemoveRule(conngater.Rule{Action: conngater.RuleDeny, Peer: h2.ID()}))
+	require.NoError(t, g.AddRule(conngater.Rule{Action: conngater.RuleDeny, Subnet: &net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}))
+	err = h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()})
+	require.ErrorIs(t, err, swarm.ErrNoGoodAddresses)
+	var derr *swarm.DialError
+	require.ErrorAs(t, err, &derr)
+	require.Len(t, derr.DialErrors, len(h2.Addrs()))
+	require.ErrorAs(t, derr.DialErrors[0].Cause, &gerr)
+	require.Equal(t, connmgr.DenyReason{Stage: connmgr.GatingStageAddrDial, Gater: "rules", Rule: "deny subnet 127.0.0.0/8"}, gerr.Reason)
+}
@@ -8,6 +8,8 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"reflect"
 	"time"
 
@@ -23,9 +25,15 @@ import (
 	"github.com/libp2p/go-libp2p/core/transport"
 	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	"github.com/libp2p/go-libp2p/p2p/host/bootstrap"
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+	"github.com/libp2p/go-libp2p/p2p/net/addrfilter"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
 	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
 	"github.com/prometheus/client_golang/prometheus"
 
@@ -267,6 +275,39 @@ func AddrsFactory(factory config.AddrsFactory) Option {
 	}
 }
 
+// ListenAddrsFactory configures libp2p to rewrite or filter the addresses of the
+// listeners matched by match, e.g. basichost.MatchTransport(ma.P_TCP, ma.P_WS) to hide
+// all WebSocket listeners. It can be passed multiple times, the factories are applied
+// in order, before the factory set with AddrsFactory.
+func ListenAddrsFactory(match func(listenAddr ma.Multiaddr) bool, factory config.AddrsFactory) Option {
+	return func(cfg *Config) error {
+		if match == nil || factory == nil {
+			return fmt.Errorf("listen addrs factory needs both a match and a factory function")
+		}
+		cfg.ListenAddrsFactories = append(cfg.ListenAddrsFactories, bhost.ListenAddrsFactory{Match: match, Factory: factory})
+		return nil
+	}
+}
+
+// AddrFilters configures libp2p to use address filters that can be changed while the
+// host is running, e.g. to block abusive subnets. Denied addresses are neither dialed,
+// accepted nor advertised, and existing connections to them are closed when they get
+// denied. The filters are applied before the ConnectionGater, if any.
+//
+// The host fails to start if a listen address is denied, unless it's an unspecified
+// address like 0.0.0.0, which stands for the addresses of all interfaces. The
+// listeners are kept when their addresses get denied later on, but their addresses
+// are no longer advertised.
+func AddrFilters(f *addrfilter.Filters) Option {
+	return func(cfg *Config) error {
+		if cfg.AddrFilters != nil {
+			return errors.New("cannot specify multiple address filters")
+		}
+		cfg.AddrFilters = f
+		return nil
+	}
+}
+
 // EnableRelay configures libp2p to enable the relay transport.
 // This option only configures libp2p to accept inbound connections from relays
 // and make outbound connections_through_ relays when requested by the remote peer.
@@ -306,6 +347,7 @@ func EnableRelayService(opts ...relayv2.Option) Option {
 //   - Either:
 //     1. A list of static relays
 //     2. A PeerSource function that provides a chan of relays. See `autorelay.WithPeerSource`
+//     3. A routing implementing content routing, to find relays. See `EnableAutoRelayWithRouting`
 //
 // This subsystem performs automatic address rewriting to advertise relay addresses when it
 // detects that the node is publicly unreachable (e.g. behind a NAT).
@@ -344,6 +386,48 @@ func EnableAutoRelayWithPeerSource(peerSource autorelay.PeerSource, opts ...auto
 	}
 }
 
+// EnableAutoRelayWithCandidateSource configures libp2p to enable the AutoRelay
+// subsystem using the provided CandidateSource to get more relay candidates.
+// This subsystem performs automatic address rewriting to advertise relay addresses
+// when it detects that the node is publicly unreachable (e.g. behind a NAT).
+func EnableAutoRelayWithCandidateSource(src autorelay.CandidateSource, opts ...autorelay.Option) Option {
+	return func(cfg *Config) error {
+		cfg.EnableAutoRelay = true
+		cfg.AutoRelayOpts = append([]autorelay.Option{autorelay.WithCandidateSource(src)}, opts...)
+		return nil
+	}
+}
+
+// EnableAutoRelayWithRouting configures libp2p to enable the AutoRelay subsystem
+// using the configured routing to find relays, i.e. relays advertising themselves
+// with AdvertiseRelayService. The routing must implement routing.ContentRouting,
+// as the DHT does. See autorelay.RoutingCandidateSource.
+// This subsystem performs automatic address rewriting to advertise relay addresses
+// when it detects that the node is publicly unreachable (e.g. behind a NAT).
+func EnableAutoRelayWithRouting(opts ...autorelay.Option) Option {
+	return func(cfg *Config) error {
+		cfg.EnableAutoRelay = true
+		cfg.AutoRelayWithRouting = true
+		cfg.AutoRelayOpts = opts
+		return nil
+	}
+}
+
+// AdvertiseRelayService configures the relay service to advertise itself using the
+// configured routing while it is running, so that nodes using
+// EnableAutoRelayWithRouting can find it. The routing must implement
+// routing.ContentRouting, as the DHT does.
+//
+// Dependencies:
+//   - EnableRelayService
+//   - Routing
+func AdvertiseRelayService() Option {
+	return func(cfg *Config) error {
+		cfg.AdvertiseRelayService = true
+		return nil
+	}
+}
+
 // ForceReachabilityPublic overrides automatic reachability detection in the AutoNAT subsystem,
 // forcing the local node to believe it is reachable externally.
 func ForceReachabilityPublic() Option {
@@ -387,6 +471,34 @@ func AutoNATServiceRateLimit(global, perPeer int, interval time.Duration) Option
 	}
 }
 
+// AutoNATServiceDialTimeout sets the timeout for the dial-backs performed when
+// helping other peers determine their reachability status.
+func AutoNATServiceDialTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) error {
+		if timeout <= 0 {
+			return errors.New("dial timeout must be positive")
+		}
+		cfg.AutoNATConfig.ServiceDialTimeout = timeout
+		return nil
+	}
+}
+
+// AutoNATServiceDialer enables the AutoNAT service and configures it to dial back
+// peers using the given network, instead of a network created from the host's
+// transports. This allows running the dial-backs from a dedicated host, such as
+// one that dials from a different IP address. The network must not be the host's
+// own network; it is not closed when the host is closed.
+func AutoNATServiceDialer(dialer network.Network) Option {
+	return func(cfg *Config) error {
+		if dialer == nil {
+			return errors.New("dialer must not be nil")
+		}
+		cfg.AutoNATConfig.EnableService = true
+		cfg.AutoNATConfig.ServiceDialer = dialer
+		return nil
+	}
+}
+
 // ConnectionGater configures libp2p to use the given ConnectionGater
 // to actively reject inbound/outbound connections based on the lifecycle stage
 // of the connection.
@@ -433,6 +545,112 @@ func NATManager(nm config.NATManagerC) Option {
 	}
 }
 
+// StaticPortMappings declares port mappings set up manually on the NAT device, e.g.
+// port forwarding rules. The host advertises the external addresses of its listen
+// addresses that are mapped. If AutoNAT v2 is enabled, their reachability is verified
+// periodically: an event.EvtStaticPortMappingVerified is emitted after every check, and
+// a warning is logged if a mapped address isn't reachable.
+func StaticPortMappings(mappings ...bhost.StaticPortMapping) Option {
+	return func(cfg *Config) error {
+		cfg.StaticPortMappings = append(cfg.StaticPortMappings, mappings...)
+		return nil
+	}
+}
+
+// StaticPortMappingVerifyInterval sets the interval between two reachability checks of
+// the static port mappings. Defaults to bhost.DefaultStaticPortMappingVerifyInterval.
+func StaticPortMappingVerifyInterval(interval time.Duration) Option {
+	return func(cfg *Config) error {
+		if interval <= 0 {
+			return errors.New("static port mapping verify interval must be positive")
+		}
+		cfg.StaticPortMappingVerifyInterval = interval
+		return nil
+	}
+}
+
+// OutboundNegotiationTimeout bounds the protocol negotiation of the streams opened by
+// NewStream, independently of the deadline of the context passed to it. A negotiation
+// that takes longer fails with bhost.ErrNegotiationTimeout. Defaults to
+// bhost.DefaultOutboundNegotiationTimeout. If negative, the negotiation is only
+// bounded by the context.
+func OutboundNegotiationTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) error {
+		if timeout == 0 {
+			return errors.New("outbound negotiation timeout must not be 0")
+		}
+		cfg.OutboundNegotiationTimeout = timeout
+		return nil
+	}
+}
+
+// LazyNegotiation sets whether NewStream negotiates the protocols lazily, sending the
+// multistream header together with the first write instead of waiting for the peer to
+// confirm the protocol. By default, protocols are negotiated lazily if the peer is
+// known to support them. See bhost.LazyNegotiation.
+func LazyNegotiation(mode bhost.LazyNegotiation, protos ...protocol.ID) Option {
+	return func(cfg *Config) error {
+		if cfg.LazyNegotiation == nil {
+			cfg.LazyNegotiation = make(map[protocol.ID]bhost.LazyNegotiation, len(protos))
+		}
+		for _, p := range protos {
+			cfg.LazyNegotiation[p] = mode
+		}
+		return nil
+	}
+}
+
+// ProtocolTokens makes libp2p use the protocol tokens offered by its peers, which are
+// short identifiers negotiated in place of the protocol IDs of new streams. It also
+// offers tokens for protos to the peers that use them. Tokens are only used for
+// protocols handled with SetStreamHandler.
+func ProtocolTokens(protos ...protocol.ID) Option {
+	return func(cfg *Config) error {
+		cfg.EnableProtocolTokens = true
+		cfg.ProtocolTokens = append(cfg.ProtocolTokens, protos...)
+		return nil
+	}
+}
+
+// EnableNAT64 makes libp2p detect whether it's in an IPv6-only network that provides
+// NAT64 and DNS64, as many mobile networks do. If it is, the public IPv4 addresses of
+// peers are also dialed through NAT64, and IPv4 listen addresses, which peers can't
+// reach, aren't advertised. The NAT64 prefix is discovered using the
+// MultiaddrResolver, if one is set.
+func EnableNAT64() Option {
+	return func(cfg *Config) error {
+		cfg.EnableNAT64 = true
+		return nil
+	}
+}
+
+// DNSAddrs sets the canonical DNS addresses of the host, e.g. /dnsaddr/example.com or
+// /dns4/example.com/tcp/4001. They are advertised in identify and in the signed peer
+// record in place of the public IP addresses of the host.
+//
+// If verify is true, the host periodically resolves them, and only advertises those
+// that currently resolve to one of its addresses. As long as none of them does, the
+// public IP addresses are advertised.
+func DNSAddrs(verify bool, addrs ...ma.Multiaddr) Option {
+	return func(cfg *Config) error {
+		cfg.DNSAddrs = append(cfg.DNSAddrs, addrs...)
+		cfg.VerifyDNSAddrs = cfg.VerifyDNSAddrs || verify
+		return nil
+	}
+}
+
+// DNSAddrVerifyInterval sets the interval between two verifications of the DNS
+// addresses. Defaults to bhost.DefaultDNSAddrVerifyInterval.
+func DNSAddrVerifyInterval(interval time.Duration) Option {
+	return func(cfg *Config) error {
+		if interval <= 0 {
+			return errors.New("DNS address verify interval must be positive")
+		}
+		cfg.DNSAddrVerifyInterval = interval
+		return nil
+	}
+}
+
 // Ping will configure libp2p to support the ping service; enable by default.
 func Ping(enable bool) Option {
 	return func(cfg *Config) error {
@@ -493,6 +711,52 @@ func UserAgent(userAgent string) Option {
 	}
 }
 
+// IdentifyOptions configures the identify service.
+// Options that are set by the host itself (user agent, protocol version, signed peer records
+// and metrics) can be overwritten using these options.
+func IdentifyOptions(opts ...identify.Option) Option {
+	return func(cfg *Config) error {
+		cfg.IdentifyOpts = append(cfg.IdentifyOpts, opts...)
+		return nil
+	}
+}
+
+// RequireSignedPeerRecord enables strict signed peer record mode.
+// Peers are required to provide a signed peer record when identifying them,
+// and only the certified addresses contained in these records are stored in the peerstore.
+// Unsigned addresses are ignored, and are therefore never advertised to other peers or used for dialing.
+// Peers that don't send a signed peer record fail identification.
+// The host only advertises its own addresses that are contained in its signed peer record, and
+// AutoRelay only advertises relay addresses built on the certified addresses of the relays.
+func RequireSignedPeerRecord() Option {
+	return func(cfg *Config) error {
+		cfg.RequireSignedPeerRecord = true
+		return nil
+	}
+}
+
+// EnableAutoNATv2 enables the AutoNAT v2 service, which verifies the reachability of
+// individual addresses (see the autonatv2 package). If the AutoNAT service is enabled
+// too, the host also acts as an AutoNAT v2 server and dials back other peers.
+func EnableAutoNATv2() Option {
+	return func(cfg *Config) error {
+		cfg.EnableAutoNATv2 = true
+		return nil
+	}
+}
+
+// EnableLatencyMonitor enables the latency monitor.
+// It periodically pings connected peers, records their latency in the peerstore, and
+// emits an event.EvtPeerLatencyThresholdCrossed when a peer's latency crosses one
+// of the configured thresholds.
+func EnableLatencyMonitor(opts ...ping.MonitorOption) Option {
+	return func(cfg *Config) error {
+		cfg.EnableLatencyMonitor = true
+		cfg.LatencyMonitorOpts = opts
+		return nil
+	}
+}
+
 // MultiaddrResolver sets the libp2p dns resolver
 func MultiaddrResolver(rslv *madns.Resolver) Option {
 	return func(cfg *Config) error {
@@ -550,6 +814,150 @@ func WithDialTimeout(t time.Duration) Option {
 	}
 }
 
+// StreamEvents configures libp2p to emit an event.EvtStreamOpened and an
+// event.EvtStreamClosed on the event bus for a sample of the streams. The sample
+// rate is the fraction of streams events are emitted for, between 0 (none) and 1
+// (all). The events are emitted asynchronously, see swarm.WithStreamEvents.
+func StreamEvents(sampleRate float64) Option {
+	return func(cfg *Config) error {
+		if sampleRate < 0 || sampleRate > 1 {
+			return errors.New("stream event sample rate must be between 0 and 1")
+		}
+		cfg.StreamEventsSampleRate = sampleRate
+		return nil
+	}
+}
+
+// ConnectionTrace configures libp2p to write a record for every dial attempt, and for
+// the opening, protocol negotiation and closing of every connection and stream, to w
+// as lines of JSON. See swarm.TraceRecord for the records. w isn't closed when the
+// host is closed.
+func ConnectionTrace(w io.Writer) Option {
+	return func(cfg *Config) error {
+		if cfg.ConnTraceWriter != nil || cfg.ConnTraceFile != nil {
+			return errors.New("connection trace already set")
+		}
+		if w == nil {
+			return errors.New("connection trace writer cannot be nil")
+		}
+		cfg.ConnTraceWriter = w
+		return nil
+	}
+}
+
+// ConnectionTraceFile is like ConnectionTrace, writing the trace to the file at path.
+// The file is rotated when it reaches maxSize bytes, keeping maxFiles rotated files
+// named path.1 to path.<maxFiles>. A maxSize of 0 uses the default of 100 MiB.
+func ConnectionTraceFile(path string, maxSize int64, maxFiles int) Option {
+	return func(cfg *Config) error {
+		if cfg.ConnTraceWriter != nil || cfg.ConnTraceFile != nil {
+			return errors.New("connection trace already set")
+		}
+		if path == "" {
+			return errors.New("connection trace file path cannot be empty")
+		}
+		if maxSize < 0 || maxFiles < 0 {
+			return errors.New("connection trace file limits cannot be negative")
+		}
+		cfg.ConnTraceFile = &swarm.TraceFile{Path: path, MaxSize: maxSize, MaxFiles: maxFiles}
+		return nil
+	}
+}
+
+// MetricsExporter configures libp2p to export the metrics of all metrics subsystems
+// with exp, in addition to recording them with Prometheus collectors. See the
+// github.com/libp2p/go-libp2p/p2p/metricshelper/otelmetrics module for an exporter to
+// OpenTelemetry.
+//
+// Unless a PrometheusRegisterer was configured before, the metrics are recorded in a
+// registry private to the host instead of the default Prometheus registerer. A
+// configured PrometheusRegisterer must also be a prometheus.Gatherer.
+func MetricsExporter(exp metricshelper.Exporter) Option {
+	return func(cfg *Config) error {
+		if cfg.DisableMetrics {
+			return errors.New("cannot export metrics when metrics are disabled")
+		}
+		if exp == nil {
+			return errors.New("metrics exporter cannot be nil")
+		}
+		if cfg.PrometheusRegisterer == nil {
+			cfg.PrometheusRegisterer = prometheus.NewRegistry()
+		}
+		if _, ok := cfg.PrometheusRegisterer.(prometheus.Gatherer); !ok {
+			return errors.New("exporting metrics requires the prometheus registerer to be a gatherer")
+		}
+		cfg.MetricsExporters = append(cfg.MetricsExporters, exp)
+		return nil
+	}
+}
+
+// Bootstrap configures libp2p to keep the node connected to the network by dialing
+// the given bootstrap peers whenever it is connected to fewer than a minimum number of
+// peers, see bootstrap.WithMinPeers. The addresses must either end with a /p2p
+// component, or be /dnsaddr addresses that resolve to such addresses.
+func Bootstrap(peers []ma.Multiaddr, opts ...bootstrap.Option) Option {
+	return func(cfg *Config) error {
+		cfg.EnableBootstrap = true
+		cfg.BootstrapOpts = append(cfg.BootstrapOpts, bootstrap.WithPeers(peers...))
+		cfg.BootstrapOpts = append(cfg.BootstrapOpts, opts...)
+		return nil
+	}
+}
+
+// WithDebugServer configures libp2p to serve debugging information over HTTP on the
+// TCP address addr: the metrics, the Go profiles, the open connections and streams, a
+// summary of the peerstore, the usage of the resource manager and the effective
+// configuration. See the debug package for the endpoints.
+//
+// The server isn't authenticated, addr should be a loopback address like
+// "127.0.0.1:5001".
+func WithDebugServer(addr string) Option {
+	return func(cfg *Config) error {
+		if cfg.DebugServerAddr != "" {
+			return errors.New("debug server already set")
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid debug server address: %w", err)
+		}
+		cfg.DebugServerAddr = addr
+		return nil
+	}
+}
+
+// WithFxOption registers services into the lifecycle of the host, using fx. The
+// options can depend on the host: host.Host, peer.ID, crypto.PrivKey,
+// network.Network, peerstore.Peerstore, event.Bus, connmgr.ConnManager,
+// network.ResourceManager and, if a routing is configured, routing.PeerRouting are
+// provided. The OnStart hooks run once the host listens on its addresses and its
+// services are started, and New fails if one of them fails. The OnStop hooks run
+// when the host is closed, before its connections are closed.
+//
+//	libp2p.WithFxOption(fx.Invoke(func(lc fx.Lifecycle, h host.Host) {
+//		lc.Append(fx.Hook{OnStart: ..., OnStop: ...})
+//	}))
+func WithFxOption(opts ...fx.Option) Option {
+	return func(cfg *Config) error {
+		cfg.UserFxOptions = append(cfg.UserFxOptions, opts...)
+		return nil
+	}
+}
+
+// PeerBandwidthMetrics configures libp2p to record the bytes sent to and received
+// from each peer, for at most maxPeers peers at a time. The bytes of other peers are
+// recorded under the "other" label. The bandwidth by protocol is always recorded.
+func PeerBandwidthMetrics(maxPeers int) Option {
+	return func(cfg *Config) error {
+		if cfg.DisableMetrics {
+			return errors.New("cannot enable per-peer metrics when metrics are disabled")
+		}
+		if maxPeers <= 0 {
+			return errors.New("the maximum number of peers must be positive")
+		}
+		cfg.PeerMetricsLimit = maxPeers
+		return nil
+	}
+}
+
 // DisableMetrics configures libp2p to disable prometheus metrics
 func DisableMetrics() Option {
 	return func(cfg *Config) error {
@@ -0,0 +1,281 @@
+// Package compose implements a discovery that combines multiple discovery backends,
+// e.g. mDNS, rendezvous and routing based ones.
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/discovery"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("discovery-compose")
+
+// DefaultTimeout is the default timeout of a backend.
+const DefaultTimeout = time.Minute
+
+// Backend is a discovery backend of a ComposedDiscovery.
+type Backend struct {
+	// Name identifies the backend in logs and in the status.
+	Name string
+	discovery.Discovery
+	// Timeout bounds Advertise, and the time FindPeers reads results from the backend.
+	// A zero Timeout means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// BackendStatus describes the health of a backend.
+type BackendStatus struct {
+	Name string
+	// Healthy is true unless the last call to the backend failed.
+	Healthy bool
+	// LastError is the error of the last failed call, it is nil if the last call
+	// succeeded.
+	LastError error
+	// LastSuccess is the time of the last successful call.
+	LastSuccess time.Time
+	// ConsecutiveFailures is the number of calls that failed since the last
+	// successful one.
+	ConsecutiveFailures int
+	// PeersFound is the number of peers found by the backend, including duplicates of
+	// peers found by other backends.
+	PeersFound int
+}
+
+type backend struct {
+	Backend
+
+	mx     sync.Mutex
+	status BackendStatus
+}
+
+func (b *backend) record(err error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if err != nil {
+		b.status.Healthy = false
+		b.status.LastError = err
+		b.status.ConsecutiveFailures++
+		return
+	}
+	b.status.Healthy = true
+	b.status.LastError = nil
+	b.status.LastSuccess = time.Now()
+	b.status.ConsecutiveFailures = 0
+}
+
+func (b *backend) peerFound() {
+	b.mx.Lock()
+	b.status.PeersFound++
+	b.mx.Unlock()
+}
+
+// ComposedDiscovery is an implementation of discovery that advertises on, and finds
+// peers using, multiple backends. The peers found by the backends are merged and
+// deduplicated.
+type ComposedDiscovery struct {
+	backends []*backend
+
+	returnedBufSz int
+}
+
+type ComposedDiscoveryOption func(*ComposedDiscovery) error
+
+// WithComposedDiscoveryReturnedChannelSize sets the size of the buffer of the
+// channel returned by FindPeers.
+func WithComposedDiscoveryReturnedChannelSize(size int) ComposedDiscoveryOption {
+	return func(d *ComposedDiscovery) error {
+		if size < 0 {
+			return fmt.Errorf("cannot set size to be smaller than 0")
+		}
+		d.returnedBufSz = size
+		return nil
+	}
+}
+
+func NewComposedDiscovery(backends []Backend, opts ...ComposedDiscoveryOption) (*ComposedDiscovery, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("no discovery backends")
+	}
+	d := &ComposedDiscovery{returnedBufSz: 32}
+	names := make(map[string]struct{}, len(backends))
+	for _, b := range backends {
+		if b.Discovery == nil {
+			return nil, fmt.Errorf("discovery backend %q is nil", b.Name)
+		}
+		if _, ok := names[b.Name]; ok {
+			return nil, fmt.Errorf("duplicate discovery backend %q", b.Name)
+		}
+		names[b.Name] = struct{}{}
+		if b.Timeout == 0 {
+			b.Timeout = DefaultTimeout
+		}
+		d.backends = append(d.backends, &backend{
+			Backend: b,
+			status:  BackendStatus{Name: b.Name, Healthy: true},
+		})
+	}
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Advertise advertises on all backends. It returns the shortest TTL returned by a
+// backend, and fails only if all backends fail.
+func (d *ComposedDiscovery) Advertise(ctx context.Context, ns string, opts ...discovery.Option) (time.Duration, error) {
+	type result struct {
+		ttl time.Duration
+		err error
+	}
+	results := make([]result, len(d.backends))
+	var wg sync.WaitGroup
+	for i, b := range d.backends {
+		wg.Add(1)
+		go func(i int, b *backend) {
+			defer wg.Done()
+			actx, cancel := context.WithTimeout(ctx, b.Timeout)
+			defer cancel()
+			ttl, err := b.Advertise(actx, ns, opts...)
+			if err != nil && ctx.Err() == nil {
+				log.Debugw("failed to advertise", "backend", b.Name, "namespace", ns, "error", err)
+				b.record(err)
+			} else if err == nil {
+				b.record(nil)
+			}
+			results[i] = result{ttl: ttl, err: err}
+		}(i, b)
+	}
+	wg.Wait()
+
+	var ttl time.Duration
+	var errs []string
+	for i, r := range results {
+		if r.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", d.backends[i].Name, r.err))
+			continue
+		}
+		if ttl == 0 || r.ttl < ttl {
+			ttl = r.ttl
+		}
+	}
+	if len(errs) == len(results) {
+		return 0, fmt.Errorf("failed to advertise on all backends: %s", strings.Join(errs, "; "))
+	}
+	return ttl, nil
+}
+
+// FindPeers finds peers using all backends. Every peer is returned at most once. The
+// limit applies to the merged results. It fails only if all backends fail.
+func (d *ComposedDiscovery) FindPeers(ctx context.Context, ns string, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	var options discovery.Options
+	if err := options.Apply(opts...); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	type source struct {
+		ch      <-chan peer.AddrInfo
+		backend *backend
+		ctx     context.Context
+		cancel  context.CancelFunc
+	}
+	var sources []source
+	var errs []string
+	for _, b := range d.backends {
+		fctx, fcancel := context.WithTimeout(ctx, b.Timeout)
+		ch, err := b.FindPeers(fctx, ns, opts...)
+		if err != nil {
+			fcancel()
+			log.Debugw("failed to find peers", "backend", b.Name, "namespace", ns, "error", err)
+			b.record(err)
+			errs = append(errs, fmt.Sprintf("%s: %s", b.Name, err))
+			continue
+		}
+		b.record(nil)
+		sources = append(sources, source{ch: ch, backend: b, ctx: fctx, cancel: fcancel})
+	}
+	if len(sources) == 0 {
+		cancel()
+		return nil, fmt.Errorf("failed to find peers on all backends: %s", strings.Join(errs, "; "))
+	}
+
+	type found struct {
+		info    peer.AddrInfo
+		backend *backend
+	}
+	merged := make(chan found)
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src source) {
+			defer wg.Done()
+			defer src.cancel()
+			for {
+				select {
+				case info, ok := <-src.ch:
+					if !ok {
+						return
+					}
+					select {
+					case merged <- found{info: info, backend: src.backend}:
+					case <-ctx.Done():
+						return
+					}
+				case <-src.ctx.Done():
+					// the backend timed out, stop reading its results
+					return
+				}
+			}
+		}(src)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	out := make(chan peer.AddrInfo, d.returnedBufSz)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		seen := make(map[peer.ID]struct{})
+		for f := range merged {
+			f.backend.peerFound()
+			if _, ok := seen[f.info.ID]; ok {
+				continue
+			}
+			seen[f.info.ID] = struct{}{}
+			select {
+			case out <- f.info:
+			case <-ctx.Done():
+				return
+			}
+			if options.Limit > 0 && len(seen) >= options.Limit {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Status returns the status of the backends, in the order they were passed to
+// NewComposedDiscovery.
+func (d *ComposedDiscovery) Status() []BackendStatus {
+	s := make([]BackendStatus, 0, len(d.backends))
+	for _, b := range d.backends {
+		b.mx.Lock()
+		s = append(s, b.status)
+		b.mx.Unlock()
+	}
+	return s
+}
@@ -0,0 +1,153 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/discovery"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mocks"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// failingDiscovery fails all requests.
+type failingDiscovery struct{}
+
+var errFailing = errors.New("failing")
+
+func (failingDiscovery) Advertise(context.Context, string, ...discovery.Option) (time.Duration, error) {
+	return 0, errFailing
+}
+
+func (failingDiscovery) FindPeers(context.Context, string, ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	return nil, errFailing
+}
+
+// stuckDiscovery returns the given peers, but never closes the channel and blocks
+// Advertise until the context is done.
+type stuckDiscovery struct {
+	peers []peer.AddrInfo
+}
+
+func (d stuckDiscovery) Advertise(ctx context.Context, _ string, _ ...discovery.Option) (time.Duration, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func (d stuckDiscovery) FindPeers(context.Context, string, ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	ch := make(chan peer.AddrInfo, len(d.peers))
+	for _, p := range d.peers {
+		ch <- p
+	}
+	return ch, nil
+}
+
+func newHost(t *testing.T) host.Host {
+	t.Helper()
+	h := bhost.NewBlankHost(swarmt.GenSwarm(t))
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func collect(t *testing.T, ch <-chan peer.AddrInfo) []peer.ID {
+	t.Helper()
+	var ids []peer.ID
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ai, ok := <-ch:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, ai.ID)
+		case <-timeout:
+			t.Fatal("timeout waiting for FindPeers to finish")
+		}
+	}
+}
+
+func TestComposedDiscovery(t *testing.T) {
+	ctx := context.Background()
+	server1 := mocks.NewDiscoveryServer(clock.New())
+	server2 := mocks.NewDiscoveryServer(clock.New())
+
+	// h1 advertises on both servers, h2 only on the second one
+	h1 := newHost(t)
+	h2 := newHost(t)
+	d1, err := NewComposedDiscovery([]Backend{
+		{Name: "one", Discovery: mocks.NewDiscoveryClient(h1, server1)},
+		{Name: "two", Discovery: mocks.NewDiscoveryClient(h1, server2)},
+	})
+	require.NoError(t, err)
+	ttl, err := d1.Advertise(ctx, "foo", discovery.TTL(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, ttl)
+	_, err = mocks.NewDiscoveryClient(h2, server2).Advertise(ctx, "foo", discovery.TTL(time.Hour))
+	require.NoError(t, err)
+
+	h3 := newHost(t)
+	d, err := NewComposedDiscovery([]Backend{
+		{Name: "one", Discovery: mocks.NewDiscoveryClient(h3, server1)},
+		{Name: "two", Discovery: mocks.NewDiscoveryClient(h3, server2)},
+		{Name: "failing", Discovery: failingDiscovery{}},
+	})
+	require.NoError(t, err)
+	ch, err := d.FindPeers(ctx, "foo")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []peer.ID{h1.ID(), h2.ID()}, collect(t, ch))
+
+	ch, err = d.FindPeers(ctx, "foo", discovery.Limit(1))
+	require.NoError(t, err)
+	require.Len(t, collect(t, ch), 1)
+
+	s := d.Status()
+	require.Len(t, s, 3)
+	require.Equal(t, "one", s[0].Name)
+	require.True(t, s[0].Healthy)
+	require.Equal(t, "two", s[1].Name)
+	require.True(t, s[1].Healthy)
+	require.GreaterOrEqual(t, s[0].PeersFound, 1)
+	require.GreaterOrEqual(t, s[1].PeersFound, 2)
+	require.Equal(t, "failing", s[2].Name)
+	require.False(t, s[2].Healthy)
+	require.ErrorIs(t, s[2].LastError, errFailing)
+	require.Equal(t, 2, s[2].ConsecutiveFailures)
+}
+
+func TestComposedDiscoveryTimeout(t *testing.T) {
+	ctx := context.Background()
+	p := peer.AddrInfo{ID: "stuck"}
+	d, err := NewComposedDiscovery([]Backend{
+		{Name: "stuck", Discovery: stuckDiscovery{peers: []peer.AddrInfo{p}}, Timeout: 50 * time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	ch, err := d.FindPeers(ctx, "foo")
+	require.NoError(t, err)
+	require.Equal(t, []peer.ID{p.ID}, collect(t, ch))
+
+	_, err = d.Advertise(ctx, "foo")
+	require.ErrorContains(t, err, context.DeadlineExceeded.Error())
+	require.False(t, d.Status()[0].Healthy)
+}
+
+func TestComposedDiscoveryAllFailing(t *testing.T) {
+	d, err := NewComposedDiscovery([]Backend{{Name: "failing", Discovery: failingDiscovery{}}})
+	require.NoError(t, err)
+	_, err = d.Advertise(context.Background(), "foo")
+	require.Error(t, err)
+	_, err = d.FindPeers(context.Background(), "foo")
+	require.Error(t, err)
+
+	_, err = NewComposedDiscovery(nil)
+	require.Error(t, err)
+	_, err = NewComposedDiscovery([]Backend{{Name: "a", Discovery: failingDiscovery{}}, {Name: "a", Discovery: failingDiscovery{}}})
+	require.Error(t, err)
+}
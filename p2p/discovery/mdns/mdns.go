@@ -3,11 +3,15 @@ package mdns
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 
@@ -24,6 +28,14 @@ const (
 	dnsaddrPrefix = "dnsaddr="
 )
 
+// peerLostGracePeriod is how long after the expiry of its records we wait for a peer
+// to be rediscovered before we consider it lost. The resolver only reports an entry
+// again after it expired, and it queries at most once a minute.
+const peerLostGracePeriod = 90 * time.Second
+
+// expiryCheckInterval is the interval at which we check for lost peers.
+const expiryCheckInterval = 10 * time.Second
+
 var log = logging.Logger("mdns")
 
 type Service interface {
@@ -48,9 +60,28 @@ type mdnsService struct {
 	server     *zeroconf.Server
 
 	notifee Notifee
+
+	allowIfaces              []string
+	denyIfaces               []string
+	ttl                      time.Duration
+	disableIPv4, disableIPv6 bool
+
+	// ifaces are the selected network interfaces, nil means all multicast interfaces.
+	ifaces []net.Interface
+
+	// peers maps the peers found on the local network to the expiry of their
+	// records. It is only accessed by the resolver.
+	peers             map[peer.ID]time.Time
+	evtLocalPeerFound event.Emitter
+	evtLocalPeerLost  event.Emitter
 }
 
-func NewMdnsService(host host.Host, serviceName string, notifee Notifee) *mdnsService {
+// NewMdnsService creates a new mDNS service. Peers only find each other if they use
+// the same service name, so private networks can use their own name to avoid
+// discovering other libp2p nodes. An empty name means ServiceName.
+// The notifee may be nil if the caller only subscribes to EvtLocalPeerFound and
+// EvtLocalPeerLost.
+func NewMdnsService(host host.Host, serviceName string, notifee Notifee, opts ...Option) *mdnsService {
 	if serviceName == "" {
 		serviceName = ServiceName
 	}
@@ -59,13 +90,44 @@ func NewMdnsService(host host.Host, serviceName string, notifee Notifee) *mdnsSe
 		serviceName: serviceName,
 		peerName:    randomString(32 + rand.Intn(32)), // generate a random string between 32 and 63 characters long
 		notifee:     notifee,
+		peers:       make(map[peer.ID]time.Time),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
 	return s
 }
 
 func (s *mdnsService) Start() error {
+	if s.disableIPv4 && s.disableIPv6 {
+		return errors.New("mdns: IPv4 and IPv6 are both disabled")
+	}
+	if s.ttl < 0 {
+		return fmt.Errorf("mdns: invalid TTL: %s", s.ttl)
+	}
+	if len(s.allowIfaces) > 0 || len(s.denyIfaces) > 0 {
+		ifaces, err := net.Interfaces()
+		if err != nil {
+			return err
+		}
+		s.ifaces = selectInterfaces(ifaces, s.allowIfaces, s.denyIfaces)
+		if len(s.ifaces) == 0 {
+			return errors.New("mdns: no usable network interfaces")
+		}
+	}
+
+	var err error
+	if s.evtLocalPeerFound, err = s.host.EventBus().Emitter(new(event.EvtLocalPeerFound)); err != nil {
+		return err
+	}
+	if s.evtLocalPeerLost, err = s.host.EventBus().Emitter(new(event.EvtLocalPeerLost)); err != nil {
+		s.evtLocalPeerFound.Close()
+		return err
+	}
 	if err := s.startServer(); err != nil {
+		s.evtLocalPeerFound.Close()
+		s.evtLocalPeerLost.Close()
 		return err
 	}
 	s.startResolver(s.ctx)
@@ -78,9 +140,91 @@ func (s *mdnsService) Close() error {
 		s.server.Shutdown()
 	}
 	s.resolverWG.Wait()
+	if s.evtLocalPeerFound != nil {
+		s.evtLocalPeerFound.Close()
+		s.evtLocalPeerLost.Close()
+	}
 	return nil
 }
 
+// selectInterfaces returns the interfaces that are up, support multicast and are
+// allowed by the allow and deny lists. An empty allow list allows all interfaces.
+func selectInterfaces(ifaces []net.Interface, allow, deny []string) []net.Interface {
+	contains := func(names []string, name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	var selected []net.Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		if len(allow) > 0 && !contains(allow, iface.Name) {
+			continue
+		}
+		if contains(deny, iface.Name) {
+			continue
+		}
+		selected = append(selected, iface)
+	}
+	return selected
+}
+
+// filterAddrs removes the addresses of disabled IP versions, and, if interfaces were
+// selected, the addresses that don't belong to one of them.
+func (s *mdnsService) filterAddrs(addrs []ma.Multiaddr, ifaceIPs []net.IP) []ma.Multiaddr {
+	filtered := make([]ma.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		ip, err := manet.ToIP(addr)
+		if err != nil {
+			continue
+		}
+		if ip.To4() != nil {
+			if s.disableIPv4 {
+				continue
+			}
+		} else if s.disableIPv6 {
+			continue
+		}
+		if s.ifaces != nil {
+			var found bool
+			for _, ifaceIP := range ifaceIPs {
+				if ifaceIP.Equal(ip) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		filtered = append(filtered, addr)
+	}
+	return filtered
+}
+
+// interfaceIPs returns the IP addresses of the selected interfaces.
+func (s *mdnsService) interfaceIPs() []net.IP {
+	var ips []net.IP
+	for _, iface := range s.ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			log.Debugf("failed to get addresses of interface %s: %s", iface.Name, err)
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+	return ips
+}
+
 // We don't really care about the IP addresses, but the spec (and various routers / firewalls) require us
 // to send A and AAAA records.
 func (s *mdnsService) getIPs(addrs []ma.Multiaddr) ([]string, error) {
@@ -116,7 +260,7 @@ func (s *mdnsService) startServer() error {
 	}
 	addrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{
 		ID:    s.host.ID(),
-		Addrs: interfaceAddrs,
+		Addrs: s.filterAddrs(interfaceAddrs, s.interfaceIPs()),
 	})
 	if err != nil {
 		return err
@@ -141,7 +285,8 @@ func (s *mdnsService) startServer() error {
 		s.peerName,
 		ips,
 		txts,
-		nil,
+		s.ifaces,
+		s.serverOptions()...,
 	)
 	if err != nil {
 		return err
@@ -150,48 +295,102 @@ func (s *mdnsService) startServer() error {
 	return nil
 }
 
+func (s *mdnsService) serverOptions() []zeroconf.ServerOption {
+	if s.ttl == 0 {
+		return nil
+	}
+	return []zeroconf.ServerOption{zeroconf.TTL(uint32(s.ttl / time.Second))}
+}
+
+func (s *mdnsService) clientOptions() []zeroconf.ClientOption {
+	opts := make([]zeroconf.ClientOption, 0, 2)
+	switch {
+	case s.disableIPv4:
+		opts = append(opts, zeroconf.SelectIPTraffic(zeroconf.IPv6))
+	case s.disableIPv6:
+		opts = append(opts, zeroconf.SelectIPTraffic(zeroconf.IPv4))
+	}
+	if s.ifaces != nil {
+		opts = append(opts, zeroconf.SelectIfaces(s.ifaces))
+	}
+	return opts
+}
+
 func (s *mdnsService) startResolver(ctx context.Context) {
 	s.resolverWG.Add(2)
 	entryChan := make(chan *zeroconf.ServiceEntry, 1000)
 	go func() {
 		defer s.resolverWG.Done()
-		for entry := range entryChan {
-			// We only care about the TXT records.
-			// Ignore A, AAAA and PTR.
-			addrs := make([]ma.Multiaddr, 0, len(entry.Text)) // assume that all TXT records are dnsaddrs
-			for _, s := range entry.Text {
-				if !strings.HasPrefix(s, dnsaddrPrefix) {
-					log.Debug("missing dnsaddr prefix")
-					continue
-				}
-				addr, err := ma.NewMultiaddr(s[len(dnsaddrPrefix):])
-				if err != nil {
-					log.Debugf("failed to parse multiaddr: %s", err)
-					continue
-				}
-				addrs = append(addrs, addr)
-			}
-			infos, err := peer.AddrInfosFromP2pAddrs(addrs...)
-			if err != nil {
-				log.Debugf("failed to get peer info: %s", err)
-				continue
-			}
-			for _, info := range infos {
-				if info.ID == s.host.ID() {
-					continue
+		t := time.NewTicker(expiryCheckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case entry, ok := <-entryChan:
+				if !ok {
+					return
 				}
-				go s.notifee.HandlePeerFound(info)
+				s.handleEntry(entry)
+			case now := <-t.C:
+				s.expirePeers(now)
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 	go func() {
 		defer s.resolverWG.Done()
-		if err := zeroconf.Browse(ctx, s.serviceName, mdnsDomain, entryChan); err != nil {
+		if err := zeroconf.Browse(ctx, s.serviceName, mdnsDomain, entryChan, s.clientOptions()...); err != nil {
 			log.Debugf("zeroconf browsing failed: %s", err)
 		}
 	}()
 }
 
+func (s *mdnsService) handleEntry(entry *zeroconf.ServiceEntry) {
+	// We only care about the TXT records.
+	// Ignore A, AAAA and PTR.
+	addrs := make([]ma.Multiaddr, 0, len(entry.Text)) // assume that all TXT records are dnsaddrs
+	for _, s := range entry.Text {
+		if !strings.HasPrefix(s, dnsaddrPrefix) {
+			log.Debug("missing dnsaddr prefix")
+			continue
+		}
+		addr, err := ma.NewMultiaddr(s[len(dnsaddrPrefix):])
+		if err != nil {
+			log.Debugf("failed to parse multiaddr: %s", err)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	infos, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		log.Debugf("failed to get peer info: %s", err)
+		return
+	}
+	for _, info := range infos {
+		if info.ID == s.host.ID() {
+			continue
+		}
+		if _, ok := s.peers[info.ID]; !ok {
+			s.evtLocalPeerFound.Emit(event.EvtLocalPeerFound{Peer: info})
+		}
+		s.peers[info.ID] = entry.Expiry
+		if s.notifee != nil {
+			go s.notifee.HandlePeerFound(info)
+		}
+	}
+}
+
+// expirePeers emits EvtLocalPeerLost for the peers whose records expired more than
+// peerLostGracePeriod ago.
+func (s *mdnsService) expirePeers(now time.Time) {
+	for p, expiry := range s.peers {
+		if now.After(expiry.Add(peerLostGracePeriod)) {
+			delete(s.peers, p)
+			s.evtLocalPeerLost.Emit(event.EvtLocalPeerLost{Peer: p})
+		}
+	}
+}
+
 func randomString(l int) string {
 	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
 	s := make([]byte, 0, l)
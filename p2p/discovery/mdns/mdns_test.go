@@ -1,12 +1,18 @@
 package mdns
 
 import (
+	"net"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+
+	"github.com/libp2p/zeroconf/v2"
+	ma "github.com/multiformats/go-multiaddr"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -96,3 +102,108 @@ func TestOtherDiscovery(t *testing.T) {
 		"expected peers to find each other",
 	)
 }
+
+func TestSelectInterfaces(t *testing.T) {
+	const up = net.FlagUp | net.FlagMulticast
+	ifaces := []net.Interface{
+		{Index: 1, Name: "lo", Flags: net.FlagUp | net.FlagLoopback},
+		{Index: 2, Name: "eth0", Flags: up},
+		{Index: 3, Name: "wlan0", Flags: up},
+		{Index: 4, Name: "docker0", Flags: up},
+		{Index: 5, Name: "eth1", Flags: net.FlagMulticast},
+	}
+	names := func(ifaces []net.Interface) []string {
+		var names []string
+		for _, iface := range ifaces {
+			names = append(names, iface.Name)
+		}
+		return names
+	}
+	require.Equal(t, []string{"eth0", "wlan0", "docker0"}, names(selectInterfaces(ifaces, nil, nil)))
+	require.Equal(t, []string{"eth0", "wlan0"}, names(selectInterfaces(ifaces, nil, []string{"docker0"})))
+	require.Equal(t, []string{"wlan0"}, names(selectInterfaces(ifaces, []string{"wlan0", "eth1", "lo"}, nil)))
+	require.Empty(t, selectInterfaces(ifaces, []string{"eth0"}, []string{"eth0"}))
+}
+
+func TestFilterAddrs(t *testing.T) {
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/192.168.1.2/tcp/1234"),
+		ma.StringCast("/ip4/172.17.0.1/udp/1234/quic-v1"),
+		ma.StringCast("/ip6/fe80::1/tcp/1234"),
+	}
+	s := NewMdnsService(nil, "", nil)
+	require.Equal(t, addrs, s.filterAddrs(addrs, nil))
+
+	s = NewMdnsService(nil, "", nil, DisableIPv6())
+	require.Equal(t, addrs[:2], s.filterAddrs(addrs, nil))
+
+	s = NewMdnsService(nil, "", nil, DisableIPv4())
+	require.Equal(t, addrs[2:], s.filterAddrs(addrs, nil))
+
+	// only announce the addresses of the selected interfaces
+	s = NewMdnsService(nil, "", nil, WithoutInterfaces("docker0"))
+	s.ifaces = []net.Interface{{Name: "eth0"}}
+	require.Equal(t, []ma.Multiaddr{addrs[0], addrs[2]}, s.filterAddrs(addrs, []net.IP{net.ParseIP("192.168.1.2"), net.ParseIP("fe80::1")}))
+}
+
+func TestInvalidOptions(t *testing.T) {
+	host, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer host.Close()
+
+	require.Error(t, NewMdnsService(host, "", nil, DisableIPv4(), DisableIPv6()).Start())
+	require.Error(t, NewMdnsService(host, "", nil, WithTTL(-time.Second)).Start())
+	require.Error(t, NewMdnsService(host, "", nil, WithInterfaces("does-not-exist")).Start())
+}
+
+func TestLocalPeerEvents(t *testing.T) {
+	host, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer host.Close()
+	sub, err := host.EventBus().Subscribe([]interface{}{new(event.EvtLocalPeerFound), new(event.EvtLocalPeerLost)})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	notif := &notif{}
+	s := NewMdnsService(host, "", notif)
+	s.evtLocalPeerFound, err = host.EventBus().Emitter(new(event.EvtLocalPeerFound))
+	require.NoError(t, err)
+	s.evtLocalPeerLost, err = host.EventBus().Emitter(new(event.EvtLocalPeerLost))
+	require.NoError(t, err)
+	defer s.Close()
+
+	p := test.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/192.168.1.2/tcp/1234/p2p/" + p.String())
+	expiry := time.Now().Add(time.Minute)
+	entry := &zeroconf.ServiceEntry{Text: []string{dnsaddrPrefix + addr.String()}, Expiry: expiry}
+	s.handleEntry(entry)
+	select {
+	case e := <-sub.Out():
+		evt, ok := e.(event.EvtLocalPeerFound)
+		require.True(t, ok)
+		require.Equal(t, p, evt.Peer.ID)
+		require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/192.168.1.2/tcp/1234")}, evt.Peer.Addrs)
+	case <-time.After(time.Second):
+		t.Fatal("expected a peer found event")
+	}
+	require.Eventually(t, func() bool { return len(notif.GetPeers()) == 1 }, time.Second, 10*time.Millisecond)
+
+	// rediscovering the peer refreshes its expiry, but doesn't emit another event
+	expiry = expiry.Add(time.Minute)
+	s.handleEntry(&zeroconf.ServiceEntry{Text: entry.Text, Expiry: expiry})
+	s.expirePeers(expiry)
+	s.expirePeers(expiry.Add(peerLostGracePeriod / 2))
+	select {
+	case e := <-sub.Out():
+		t.Fatalf("unexpected event: %#v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s.expirePeers(expiry.Add(peerLostGracePeriod + time.Second))
+	select {
+	case e := <-sub.Out():
+		require.Equal(t, event.EvtLocalPeerLost{Peer: p}, e)
+	case <-time.After(time.Second):
+		t.Fatal("expected a peer lost event")
+	}
+}
@@ -0,0 +1,48 @@
+package mdns
+
+import "time"
+
+// Option configures the mDNS service.
+type Option func(*mdnsService)
+
+// WithInterfaces restricts the mDNS service to the network interfaces with the given
+// names. Only the addresses of these interfaces are announced.
+// By default, all interfaces that support multicast are used.
+func WithInterfaces(names ...string) Option {
+	return func(s *mdnsService) {
+		s.allowIfaces = append(s.allowIfaces, names...)
+	}
+}
+
+// WithoutInterfaces excludes the network interfaces with the given names, e.g. the
+// bridges of virtual machines or containers. The addresses of these interfaces are
+// not announced.
+func WithoutInterfaces(names ...string) Option {
+	return func(s *mdnsService) {
+		s.denyIfaces = append(s.denyIfaces, names...)
+	}
+}
+
+// WithTTL sets the TTL of the records we announce. Peers that don't see the records
+// again before the TTL expires consider us gone, so a short TTL lets them notice
+// sooner, at the cost of more traffic.
+// The TTL is rounded down to full seconds. The default is 3200s.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *mdnsService) {
+		s.ttl = ttl
+	}
+}
+
+// DisableIPv4 stops announcing IPv4 addresses and sending mDNS queries over IPv4.
+func DisableIPv4() Option {
+	return func(s *mdnsService) {
+		s.disableIPv4 = true
+	}
+}
+
+// DisableIPv6 stops announcing IPv6 addresses and sending mDNS queries over IPv6.
+func DisableIPv6() Option {
+	return func(s *mdnsService) {
+		s.disableIPv6 = true
+	}
+}
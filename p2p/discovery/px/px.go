@@ -0,0 +1,378 @@
+// Package px implements a lightweight peer exchange protocol.
+//
+// Connected peers periodically ask each other for a random sample of the peers they
+// were recently connected to. Only peers with a signed peer record are shared, and the
+// records are returned as is, so a peer can't forge the addresses of other peers.
+// This is a low-cost discovery mechanism for small networks that run neither a DHT
+// nor a rendezvous point.
+package px
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/discovery/px/pb"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-msgio/pbio"
+)
+
+//go:generate protoc --proto_path=$PWD:$PWD/../../.. --go_out=. --go_opt=Mpb/px.proto=./pb pb/px.proto
+
+// Protocol is the libp2p protocol for peer exchange.
+const Protocol protocol.ID = "/libp2p/px/1.0.0"
+
+// ServiceName is the name of the peer exchange service in the resource manager.
+const ServiceName = "libp2p.px"
+
+// MaxPeers is the maximum number of peers exchanged in a single response.
+const MaxPeers = 64
+
+const (
+	streamTimeout = time.Minute
+	// maxRequestSize is the maximum size of a request.
+	maxRequestSize = 64
+	// maxRecordSize is the maximum size of a signed peer record.
+	maxRecordSize = 4 << 10
+	// maxResponseSize is the maximum size of a response.
+	maxResponseSize = MaxPeers * (maxRecordSize + 8)
+)
+
+var log = logging.Logger("px")
+
+type config struct {
+	maxPeers       int
+	recentlySeen   time.Duration
+	gossipInterval time.Duration
+	addrTTL        time.Duration
+}
+
+type Option func(*config) error
+
+// WithMaxPeers sets the maximum number of peers we return to, and request from, a
+// peer. It can't exceed MaxPeers.
+func WithMaxPeers(n int) Option {
+	return func(c *config) error {
+		if n <= 0 || n > MaxPeers {
+			return fmt.Errorf("invalid maximum number of peers: %d", n)
+		}
+		c.maxPeers = n
+		return nil
+	}
+}
+
+// WithRecentlySeen sets how long after disconnecting from a peer we keep sharing it.
+// Peers we are connected to are always shared.
+func WithRecentlySeen(d time.Duration) Option {
+	return func(c *config) error {
+		if d < 0 {
+			return fmt.Errorf("invalid recently seen duration: %s", d)
+		}
+		c.recentlySeen = d
+		return nil
+	}
+}
+
+// WithGossipInterval sets the interval at which we request peers from a random
+// connected peer. An interval of 0 disables the periodic requests, peers are then
+// only requested by calling Request.
+func WithGossipInterval(d time.Duration) Option {
+	return func(c *config) error {
+		if d < 0 {
+			return fmt.Errorf("invalid gossip interval: %s", d)
+		}
+		c.gossipInterval = d
+		return nil
+	}
+}
+
+// WithAddrTTL sets the TTL of the addresses of the peers we learn about.
+func WithAddrTTL(ttl time.Duration) Option {
+	return func(c *config) error {
+		if ttl <= 0 {
+			return fmt.Errorf("invalid address TTL: %s", ttl)
+		}
+		c.addrTTL = ttl
+		return nil
+	}
+}
+
+// PeerExchange serves, and periodically requests, samples of recently seen peers.
+type PeerExchange struct {
+	host host.Host
+	cab  peerstore.CertifiedAddrBook
+	conf config
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	refCount  sync.WaitGroup
+	emitter   event.Emitter
+
+	mx sync.Mutex
+	// lastSeen is the time we were last connected to a peer
+	lastSeen map[peer.ID]time.Time
+	rng      *rand.Rand
+}
+
+// NewPeerExchange starts the peer exchange on h. The peerstore of h has to be a
+// certified address book, since only signed peer records are exchanged.
+func NewPeerExchange(h host.Host, opts ...Option) (*PeerExchange, error) {
+	conf := config{
+		maxPeers:       16,
+		recentlySeen:   10 * time.Minute,
+		gossipInterval: 5 * time.Minute,
+		addrTTL:        peerstore.RecentlyConnectedAddrTTL,
+	}
+	for _, opt := range opts {
+		if err := opt(&conf); err != nil {
+			return nil, err
+		}
+	}
+	cab, ok := peerstore.GetCertifiedAddrBook(h.Peerstore())
+	if !ok {
+		return nil, errors.New("peer exchange requires a certified address book")
+	}
+
+	px := &PeerExchange{
+		host:     h,
+		cab:      cab,
+		conf:     conf,
+		lastSeen: make(map[peer.ID]time.Time),
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	sub, err := h.EventBus().Subscribe(new(event.EvtPeerConnectednessChanged), eventbus.Name("px"))
+	if err != nil {
+		return nil, err
+	}
+	px.emitter, err = h.EventBus().Emitter(new(event.EvtPeerExchangePeersFound))
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+	now := time.Now()
+	for _, p := range h.Network().Peers() {
+		px.lastSeen[p] = now
+	}
+	px.ctx, px.ctxCancel = context.WithCancel(context.Background())
+	h.SetStreamHandler(Protocol, px.handleStream)
+
+	px.refCount.Add(1)
+	go px.background(sub)
+	return px, nil
+}
+
+func (px *PeerExchange) Close() error {
+	px.host.RemoveStreamHandler(Protocol)
+	px.ctxCancel()
+	px.refCount.Wait()
+	return px.emitter.Close()
+}
+
+func (px *PeerExchange) background(sub event.Subscription) {
+	defer px.refCount.Done()
+	defer sub.Close()
+
+	var tick <-chan time.Time
+	if px.conf.gossipInterval > 0 {
+		t := time.NewTicker(px.conf.gossipInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			evt := e.(event.EvtPeerConnectednessChanged)
+			px.mx.Lock()
+			px.lastSeen[evt.Peer] = time.Now()
+			px.mx.Unlock()
+		case <-tick:
+			px.gc()
+			px.gossip()
+		case <-px.ctx.Done():
+			return
+		}
+	}
+}
+
+func (px *PeerExchange) gc() {
+	px.mx.Lock()
+	defer px.mx.Unlock()
+	now := time.Now()
+	for p, t := range px.lastSeen {
+		if now.Sub(t) > px.conf.recentlySeen && px.host.Network().Connectedness(p) != network.Connected {
+			delete(px.lastSeen, p)
+		}
+	}
+}
+
+// gossip requests peers from a random connected peer that supports the protocol.
+func (px *PeerExchange) gossip() {
+	var candidates []peer.ID
+	for _, p := range px.host.Network().Peers() {
+		if protos, err := px.host.Peerstore().SupportsProtocols(p, Protocol); err == nil && len(protos) > 0 {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	px.mx.Lock()
+	p := candidates[px.rng.Intn(len(candidates))]
+	px.mx.Unlock()
+
+	px.refCount.Add(1)
+	go func() {
+		defer px.refCount.Done()
+		if _, err := px.Request(px.ctx, p, 0); err != nil {
+			log.Debugw("failed to request peers", "peer", p, "error", err)
+		}
+	}()
+}
+
+// Request asks p for up to limit of the peers it recently saw. A limit of 0 requests
+// as many peers as configured with WithMaxPeers. The peer records are added to the
+// peerstore, and an EvtPeerExchangePeersFound event is emitted.
+func (px *PeerExchange) Request(ctx context.Context, p peer.ID, limit int) ([]peer.AddrInfo, error) {
+	if limit <= 0 || limit > px.conf.maxPeers {
+		limit = px.conf.maxPeers
+	}
+
+	s, err := px.host.NewStream(ctx, p, Protocol)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to attach stream to service %s: %w", ServiceName, err)
+	}
+	deadline := time.Now().Add(streamTimeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	s.SetDeadline(deadline)
+
+	l := uint32(limit)
+	if err := pbio.NewDelimitedWriter(s).WriteMsg(&pb.Request{Limit: &l}); err != nil {
+		s.Reset()
+		return nil, err
+	}
+	if err := s.Scope().ReserveMemory(maxResponseSize, network.ReservationPriorityAlways); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to reserve memory: %w", err)
+	}
+	defer s.Scope().ReleaseMemory(maxResponseSize)
+	var resp pb.Response
+	if err := pbio.NewDelimitedReader(s, maxResponseSize).ReadMsg(&resp); err != nil {
+		s.Reset()
+		return nil, err
+	}
+
+	recs := resp.GetSignedPeerRecords()
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	infos := make([]peer.AddrInfo, 0, len(recs))
+	seen := make(map[peer.ID]struct{}, len(recs))
+	for _, rec := range recs {
+		env, r, err := record.ConsumeEnvelope(rec, peer.PeerRecordEnvelopeDomain)
+		if err != nil {
+			log.Debugw("invalid signed peer record", "peer", p, "error", err)
+			continue
+		}
+		pr, ok := r.(*peer.PeerRecord)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[pr.PeerID]; ok || pr.PeerID == px.host.ID() || pr.PeerID == p {
+			continue
+		}
+		seen[pr.PeerID] = struct{}{}
+		if _, err := px.cab.ConsumePeerRecord(env, px.conf.addrTTL); err != nil {
+			log.Debugw("failed to add peer record", "peer", pr.PeerID, "error", err)
+		}
+		infos = append(infos, peer.AddrInfo{ID: pr.PeerID, Addrs: pr.Addrs})
+	}
+	if len(infos) > 0 {
+		px.emitter.Emit(event.EvtPeerExchangePeersFound{From: p, Peers: infos})
+	}
+	return infos, nil
+}
+
+func (px *PeerExchange) handleStream(s network.Stream) {
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("failed to attach stream to service %s: %s", ServiceName, err)
+		s.Reset()
+		return
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(streamTimeout))
+
+	var req pb.Request
+	if err := pbio.NewDelimitedReader(s, maxRequestSize).ReadMsg(&req); err != nil {
+		log.Debugw("failed to read request", "peer", s.Conn().RemotePeer(), "error", err)
+		s.Reset()
+		return
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 || limit > px.conf.maxPeers {
+		limit = px.conf.maxPeers
+	}
+	resp := &pb.Response{SignedPeerRecords: px.sample(s.Conn().RemotePeer(), limit)}
+	if err := pbio.NewDelimitedWriter(s).WriteMsg(resp); err != nil {
+		log.Debugw("failed to write response", "peer", s.Conn().RemotePeer(), "error", err)
+		s.Reset()
+	}
+}
+
+// sample returns the signed peer records of up to limit random peers we are connected
+// to or recently saw, excluding p.
+func (px *PeerExchange) sample(p peer.ID, limit int) [][]byte {
+	now := time.Now()
+	px.mx.Lock()
+	candidates := make([]peer.ID, 0, len(px.lastSeen))
+	for id, t := range px.lastSeen {
+		if now.Sub(t) <= px.conf.recentlySeen || px.host.Network().Connectedness(id) == network.Connected {
+			candidates = append(candidates, id)
+		}
+	}
+	px.rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	px.mx.Unlock()
+
+	recs := make([][]byte, 0, limit)
+	for _, id := range candidates {
+		if len(recs) >= limit {
+			break
+		}
+		if id == p || id == px.host.ID() {
+			continue
+		}
+		env := px.cab.GetPeerRecord(id)
+		if env == nil {
+			continue
+		}
+		rec, err := env.Marshal()
+		if err != nil || len(rec) > maxRecordSize {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
@@ -0,0 +1,139 @@
+package px
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/record"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newHost(t *testing.T) host.Host {
+	t.Helper()
+	bus := eventbus.NewBus()
+	h := bhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.EventBus(bus)), bhost.WithEventBus(bus))
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func newPeerExchange(t *testing.T, h host.Host, opts ...Option) *PeerExchange {
+	t.Helper()
+	px, err := NewPeerExchange(h, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { px.Close() })
+	return px
+}
+
+func connect(t *testing.T, a, b host.Host) {
+	t.Helper()
+	require.NoError(t, a.Connect(context.Background(), peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}))
+}
+
+// addPeerRecord adds the signed peer record of p to the peerstore of h, like identify
+// would.
+func addPeerRecord(t *testing.T, h, p host.Host) {
+	t.Helper()
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: p.ID(), Addrs: p.Addrs()}), p.Peerstore().PrivKey(p.ID()))
+	require.NoError(t, err)
+	cab, ok := peerstore.GetCertifiedAddrBook(h.Peerstore())
+	require.True(t, ok)
+	_, err = cab.ConsumePeerRecord(env, time.Hour)
+	require.NoError(t, err)
+}
+
+func TestRequest(t *testing.T) {
+	server := newHost(t)
+	newPeerExchange(t, server, WithGossipInterval(0), WithRecentlySeen(0))
+	// p1 and p2 have signed peer records, unsigned doesn't
+	p1, p2, unsigned := newHost(t), newHost(t), newHost(t)
+	for _, p := range []host.Host{p1, p2, unsigned} {
+		connect(t, server, p)
+	}
+	addPeerRecord(t, server, p1)
+	addPeerRecord(t, server, p2)
+
+	client := newHost(t)
+	addPeerRecord(t, server, client)
+	connect(t, client, server)
+	pxc := newPeerExchange(t, client, WithGossipInterval(0))
+	sub, err := client.EventBus().Subscribe(new(event.EvtPeerExchangePeersFound))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	require.Eventually(t, func() bool {
+		infos, err := pxc.Request(context.Background(), server.ID(), 0)
+		require.NoError(t, err)
+		return len(infos) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	infos, err := pxc.Request(context.Background(), server.ID(), 0)
+	require.NoError(t, err)
+	var ids []peer.ID
+	for _, info := range infos {
+		ids = append(ids, info.ID)
+		require.ElementsMatch(t, server.Peerstore().Addrs(info.ID), info.Addrs)
+	}
+	require.ElementsMatch(t, []peer.ID{p1.ID(), p2.ID()}, ids)
+	// the records were added to the peerstore
+	cab, _ := peerstore.GetCertifiedAddrBook(client.Peerstore())
+	require.NotNil(t, cab.GetPeerRecord(p1.ID()))
+	require.NotNil(t, cab.GetPeerRecord(p2.ID()))
+
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtPeerExchangePeersFound)
+		require.Equal(t, server.ID(), evt.From)
+		require.Len(t, evt.Peers, 2)
+	case <-time.After(time.Second):
+		t.Fatal("expected an event")
+	}
+
+	infos, err = pxc.Request(context.Background(), server.ID(), 1)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+
+	// disconnected peers are not shared once they weren't seen recently
+	require.NoError(t, server.Network().ClosePeer(p1.ID()))
+	require.Eventually(t, func() bool {
+		infos, err := pxc.Request(context.Background(), server.ID(), 0)
+		require.NoError(t, err)
+		return len(infos) == 1 && infos[0].ID == p2.ID()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestGossip(t *testing.T) {
+	server := newHost(t)
+	newPeerExchange(t, server, WithGossipInterval(0))
+	p := newHost(t)
+	connect(t, server, p)
+	addPeerRecord(t, server, p)
+
+	client := newHost(t)
+	connect(t, client, server)
+	// blank hosts don't run identify
+	require.NoError(t, client.Peerstore().AddProtocols(server.ID(), Protocol))
+	newPeerExchange(t, client, WithGossipInterval(20*time.Millisecond))
+
+	cab, _ := peerstore.GetCertifiedAddrBook(client.Peerstore())
+	require.Eventually(t, func() bool { return cab.GetPeerRecord(p.ID()) != nil }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestInvalidOptions(t *testing.T) {
+	h := newHost(t)
+	_, err := NewPeerExchange(h, WithMaxPeers(0))
+	require.Error(t, err)
+	_, err = NewPeerExchange(h, WithMaxPeers(MaxPeers+1))
+	require.Error(t, err)
+	_, err = NewPeerExchange(h, WithGossipInterval(-time.Second))
+	require.Error(t, err)
+	_, err = NewPeerExchange(h, WithAddrTTL(0))
+	require.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package rendezvous
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/discovery/rendezvous/pb"
+
+	"github.com/libp2p/go-msgio/pbio"
+)
+
+// Registration is a registration returned by a rendezvous point.
+type Registration struct {
+	Peer      peer.AddrInfo
+	Namespace string
+	// TTL is the remaining time until the registration expires.
+	TTL time.Duration
+}
+
+// Client registers at and discovers peers from a rendezvous point.
+type Client struct {
+	host   host.Host
+	server peer.ID
+}
+
+// NewClient creates a client for the rendezvous point server. The host must be able
+// to connect to server, e.g. because its addresses were added to the peerstore.
+func NewClient(h host.Host, server peer.ID) *Client {
+	return &Client{host: h, server: server}
+}
+
+// Register registers us in the namespace ns, with our current addresses. A ttl of 0
+// means DefaultTTL. It returns the TTL granted by the rendezvous point; the caller has
+// to register again before it expires to stay registered.
+func (c *Client) Register(ctx context.Context, ns string, ttl time.Duration) (time.Duration, error) {
+	privKey := c.host.Peerstore().PrivKey(c.host.ID())
+	if privKey == nil {
+		return 0, errors.New("missing private key")
+	}
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: c.host.ID(), Addrs: c.host.Addrs()}), privKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sign peer record: %w", err)
+	}
+	rec, err := env.Marshal()
+	if err != nil {
+		return 0, err
+	}
+
+	t := pb.Message_REGISTER
+	req := &pb.Message{
+		Type: &t,
+		Register: &pb.Message_Register{
+			Ns:               &ns,
+			SignedPeerRecord: rec,
+		},
+	}
+	if ttl != 0 {
+		secs := uint64(ttl / time.Second)
+		req.Register.Ttl = &secs
+	}
+	var resp pb.Message
+	if err := c.request(ctx, req, &resp); err != nil {
+		return 0, err
+	}
+	r := resp.GetRegisterResponse()
+	if resp.GetType() != pb.Message_REGISTER_RESPONSE || r == nil {
+		return 0, fmt.Errorf("unexpected response: %s", resp.GetType())
+	}
+	if r.GetStatus() != pb.Message_OK {
+		return 0, &StatusError{Status: r.GetStatus(), Text: r.GetStatusText()}
+	}
+	return time.Duration(r.GetTtl()) * time.Second, nil
+}
+
+// Unregister removes our registration in the namespace ns.
+func (c *Client) Unregister(ctx context.Context, ns string) error {
+	t := pb.Message_UNREGISTER
+	return c.request(ctx, &pb.Message{
+		Type:       &t,
+		Unregister: &pb.Message_Unregister{Ns: &ns},
+	}, nil)
+}
+
+// Discover returns up to limit registrations in the namespace ns. An empty namespace
+// returns the registrations of all namespaces, a limit of 0 as many registrations as
+// the rendezvous point allows.
+//
+// cookie is nil for the first request. Passing the returned cookie to the next
+// request only returns the registrations made since the previous request.
+//
+// The addresses of the discovered peers are added to the peerstore.
+func (c *Client) Discover(ctx context.Context, ns string, limit int, cookie []byte) ([]Registration, []byte, error) {
+	t := pb.Message_DISCOVER
+	req := &pb.Message{
+		Type: &t,
+		Discover: &pb.Message_Discover{
+			Ns:     &ns,
+			Cookie: cookie,
+		},
+	}
+	if limit > 0 {
+		l := uint64(limit)
+		req.Discover.Limit = &l
+	}
+	var resp pb.Message
+	if err := c.request(ctx, req, &resp); err != nil {
+		return nil, nil, err
+	}
+	r := resp.GetDiscoverResponse()
+	if resp.GetType() != pb.Message_DISCOVER_RESPONSE || r == nil {
+		return nil, nil, fmt.Errorf("unexpected response: %s", resp.GetType())
+	}
+	if r.GetStatus() != pb.Message_OK {
+		return nil, nil, &StatusError{Status: r.GetStatus(), Text: r.GetStatusText()}
+	}
+
+	cab, hasCAB := peerstore.GetCertifiedAddrBook(c.host.Peerstore())
+	regs := make([]Registration, 0, len(r.GetRegistrations()))
+	for _, reg := range r.GetRegistrations() {
+		env, rec, err := record.ConsumeEnvelope(reg.GetSignedPeerRecord(), peer.PeerRecordEnvelopeDomain)
+		if err != nil {
+			log.Debugf("invalid signed peer record from rendezvous point %s: %s", c.server, err)
+			continue
+		}
+		pr, ok := rec.(*peer.PeerRecord)
+		if !ok {
+			continue
+		}
+		ttl := time.Duration(reg.GetTtl()) * time.Second
+		if hasCAB && pr.PeerID != c.host.ID() {
+			if _, err := cab.ConsumePeerRecord(env, ttl); err != nil {
+				log.Debugf("failed to add peer record of %s: %s", pr.PeerID, err)
+			}
+		}
+		regs = append(regs, Registration{
+			Peer:      peer.AddrInfo{ID: pr.PeerID, Addrs: pr.Addrs},
+			Namespace: reg.GetNs(),
+			TTL:       ttl,
+		})
+	}
+	return regs, r.GetCookie(), nil
+}
+
+// request sends req to the rendezvous point and reads the response into resp, unless
+// resp is nil.
+func (c *Client) request(ctx context.Context, req, resp *pb.Message) error {
+	s, err := c.host.NewStream(ctx, c.server, Protocol)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		s.Reset()
+		return fmt.Errorf("failed to attach stream to service %s: %w", ServiceName, err)
+	}
+	deadline := time.Now().Add(streamTimeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	s.SetDeadline(deadline)
+
+	if err := pbio.NewDelimitedWriter(s).WriteMsg(req); err != nil {
+		s.Reset()
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+
+	if err := s.Scope().ReserveMemory(maxResponseSize, network.ReservationPriorityAlways); err != nil {
+		s.Reset()
+		return fmt.Errorf("failed to reserve memory: %w", err)
+	}
+	defer s.Scope().ReleaseMemory(maxResponseSize)
+	if err := pbio.NewDelimitedReader(s, maxResponseSize).ReadMsg(resp); err != nil {
+		s.Reset()
+		return err
+	}
+	return nil
+}
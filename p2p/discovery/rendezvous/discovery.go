@@ -0,0 +1,77 @@
+package rendezvous
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/discovery"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// RendezvousDiscovery is an implementation of discovery using a rendezvous point.
+type RendezvousDiscovery struct {
+	*Client
+}
+
+var _ discovery.Discovery = &RendezvousDiscovery{}
+
+func NewRendezvousDiscovery(c *Client) *RendezvousDiscovery {
+	return &RendezvousDiscovery{c}
+}
+
+func (d *RendezvousDiscovery) Advertise(ctx context.Context, ns string, opts ...discovery.Option) (time.Duration, error) {
+	var options discovery.Options
+	if err := options.Apply(opts...); err != nil {
+		return 0, err
+	}
+	return d.Register(ctx, ns, options.Ttl)
+}
+
+func (d *RendezvousDiscovery) FindPeers(ctx context.Context, ns string, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	var options discovery.Options
+	if err := options.Apply(opts...); err != nil {
+		return nil, err
+	}
+
+	// fetch the first page synchronously, so that errors are returned to the caller
+	regs, cookie, err := d.Discover(ctx, ns, options.Limit, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan peer.AddrInfo)
+	go func() {
+		defer close(ch)
+
+		seen := make(map[peer.ID]struct{})
+		for {
+			for _, r := range regs {
+				if _, ok := seen[r.Peer.ID]; ok || r.Peer.ID == d.host.ID() {
+					continue
+				}
+				seen[r.Peer.ID] = struct{}{}
+				select {
+				case ch <- r.Peer:
+				case <-ctx.Done():
+					return
+				}
+				if options.Limit > 0 && len(seen) >= options.Limit {
+					return
+				}
+			}
+			if len(regs) == 0 {
+				return
+			}
+			limit := 0
+			if options.Limit > 0 {
+				limit = options.Limit - len(seen)
+			}
+			regs, cookie, err = d.Discover(ctx, ns, limit, cookie)
+			if err != nil {
+				log.Debugf("failed to discover peers in %s: %s", ns, err)
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,62 @@
+// Package rendezvous implements the libp2p rendezvous protocol.
+//
+// Peers register themselves under a namespace at a rendezvous point, and other peers
+// discover them by asking the rendezvous point for the registrations of the namespace.
+// Registrations carry a signed peer record, and expire after their TTL unless they are
+// renewed.
+//
+// The Server implements the rendezvous point, the Client and RendezvousDiscovery are
+// used by the peers that register and discover.
+package rendezvous
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/discovery/rendezvous/pb"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+//go:generate protoc --proto_path=$PWD:$PWD/../../.. --go_out=. --go_opt=Mpb/rendezvous.proto=./pb pb/rendezvous.proto
+
+// Protocol is the libp2p protocol for rendezvous.
+const Protocol protocol.ID = "/rendezvous/1.0.0"
+
+// ServiceName is the name of the rendezvous service in the resource manager.
+const ServiceName = "libp2p.rendezvous"
+
+const (
+	// DefaultTTL is the TTL of registrations that don't specify one.
+	DefaultTTL = 2 * time.Hour
+	// MaxTTL is the maximum TTL of a registration allowed by the spec.
+	MaxTTL = 72 * time.Hour
+	// MaxNamespaceLength is the maximum length of a namespace.
+	MaxNamespaceLength = 255
+)
+
+const (
+	streamTimeout = time.Minute
+	// maxRequestSize is the maximum size of a message sent to the server.
+	maxRequestSize = 8 << 10
+	// maxResponseSize is the maximum size of a message sent by the server.
+	maxResponseSize = 4 << 20
+	// maxRecordSize is the maximum size of a signed peer record.
+	maxRecordSize = 4 << 10
+)
+
+var log = logging.Logger("rendezvous")
+
+// StatusError is returned by the Client if the rendezvous point rejected a request.
+type StatusError struct {
+	Status pb.Message_ResponseStatus
+	Text   string
+}
+
+func (e *StatusError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("rendezvous error: %s", e.Status)
+	}
+	return fmt.Sprintf("rendezvous error: %s: %s", e.Status, e.Text)
+}
@@ -0,0 +1,312 @@
+package rendezvous
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/discovery"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/discovery/rendezvous/pb"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/libp2p/go-msgio/pbio"
+	"github.com/stretchr/testify/require"
+)
+
+func newHost(t *testing.T) host.Host {
+	t.Helper()
+	h := bhost.NewBlankHost(swarmt.GenSwarm(t))
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func newServer(t *testing.T, opts ...Option) (*Server, host.Host) {
+	t.Helper()
+	h := newHost(t)
+	s, err := NewServer(h, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, h
+}
+
+func newClient(t *testing.T, server host.Host) (*Client, host.Host) {
+	t.Helper()
+	h := newHost(t)
+	h.Peerstore().AddAddrs(server.ID(), server.Addrs(), peerstore.PermanentAddrTTL)
+	return NewClient(h, server.ID()), h
+}
+
+// mockClock is a clock for the server that can be advanced manually.
+type mockClock struct {
+	mx  sync.Mutex
+	now time.Time
+}
+
+func (c *mockClock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.now
+}
+
+func (c *mockClock) Advance(d time.Duration) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func peerIDs(regs []Registration) []peer.ID {
+	ids := make([]peer.ID, 0, len(regs))
+	for _, r := range regs {
+		ids = append(ids, r.Peer.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func sortedIDs(ids ...peer.ID) []peer.ID {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestRegisterDiscover(t *testing.T) {
+	ctx := context.Background()
+	_, server := newServer(t)
+	c1, h1 := newClient(t, server)
+	c2, h2 := newClient(t, server)
+	c3, h3 := newClient(t, server)
+
+	ttl, err := c1.Register(ctx, "foo", 0)
+	require.NoError(t, err)
+	require.Equal(t, DefaultTTL, ttl)
+	ttl, err = c2.Register(ctx, "foo", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, ttl)
+	_, err = c3.Register(ctx, "bar", 0)
+	require.NoError(t, err)
+
+	regs, _, err := c3.Discover(ctx, "foo", 0, nil)
+	require.NoError(t, err)
+	require.Equal(t, sortedIDs(h1.ID(), h2.ID()), peerIDs(regs))
+	for _, r := range regs {
+		require.Equal(t, "foo", r.Namespace)
+		require.NotEmpty(t, r.Peer.Addrs)
+		require.ElementsMatch(t, r.Peer.Addrs, h3.Peerstore().Addrs(r.Peer.ID), "expected addresses to be added to the peerstore")
+	}
+
+	regs, _, err = c3.Discover(ctx, "", 0, nil)
+	require.NoError(t, err)
+	require.Equal(t, sortedIDs(h1.ID(), h2.ID(), h3.ID()), peerIDs(regs))
+
+	require.NoError(t, c1.Unregister(ctx, "foo"))
+	require.Eventually(t, func() bool {
+		regs, _, err = c3.Discover(ctx, "foo", 0, nil)
+		require.NoError(t, err)
+		return len(regs) == 1 && regs[0].Peer.ID == h2.ID()
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDiscoverCookie(t *testing.T) {
+	ctx := context.Background()
+	_, server := newServer(t)
+	c1, h1 := newClient(t, server)
+	c2, h2 := newClient(t, server)
+	c3, h3 := newClient(t, server)
+
+	_, err := c1.Register(ctx, "foo", 0)
+	require.NoError(t, err)
+	_, err = c2.Register(ctx, "foo", 0)
+	require.NoError(t, err)
+
+	regs, cookie, err := c3.Discover(ctx, "foo", 1, nil)
+	require.NoError(t, err)
+	require.Equal(t, []peer.ID{h1.ID()}, peerIDs(regs))
+	regs, cookie, err = c3.Discover(ctx, "foo", 1, cookie)
+	require.NoError(t, err)
+	require.Equal(t, []peer.ID{h2.ID()}, peerIDs(regs))
+	regs, cookie, err = c3.Discover(ctx, "foo", 1, cookie)
+	require.NoError(t, err)
+	require.Empty(t, regs)
+
+	// the cookie only returns new registrations
+	_, err = c3.Register(ctx, "foo", 0)
+	require.NoError(t, err)
+	regs, _, err = c3.Discover(ctx, "foo", 0, cookie)
+	require.NoError(t, err)
+	require.Equal(t, []peer.ID{h3.ID()}, peerIDs(regs))
+
+	// the cookie is only valid for the namespace it was returned for
+	_, _, err = c3.Discover(ctx, "bar", 0, cookie)
+	var serr *StatusError
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, pb.Message_E_INVALID_COOKIE, serr.Status)
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	clock := &mockClock{now: time.Now()}
+	s, server := newServer(t)
+	s.now = clock.Now
+	c1, _ := newClient(t, server)
+	c2, _ := newClient(t, server)
+
+	var serr *StatusError
+	_, err := c1.Register(ctx, "foo", time.Minute)
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, pb.Message_E_INVALID_TTL, serr.Status)
+	_, err = c1.Register(ctx, "foo", MaxTTL+time.Hour)
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, pb.Message_E_INVALID_TTL, serr.Status)
+
+	_, err = c1.Register(ctx, "foo", time.Hour)
+	require.NoError(t, err)
+	clock.Advance(30 * time.Minute)
+	regs, _, err := c2.Discover(ctx, "foo", 0, nil)
+	require.NoError(t, err)
+	require.Len(t, regs, 1)
+	require.Equal(t, 30*time.Minute, regs[0].TTL)
+
+	clock.Advance(30 * time.Minute)
+	regs, _, err = c2.Discover(ctx, "foo", 0, nil)
+	require.NoError(t, err)
+	require.Empty(t, regs, "expected the registration to expire")
+
+	s.gc()
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	require.Empty(t, s.namespaces)
+	require.Empty(t, s.registrations)
+}
+
+func TestQuotas(t *testing.T) {
+	ctx := context.Background()
+	limits := DefaultLimits()
+	limits.MaxRegistrationsPerNamespace = 1
+	limits.NamespaceQuotas = map[string]int{"big": 2, "closed": 0}
+	limits.MaxRegistrationsPerPeer = 2
+	_, server := newServer(t, WithLimits(limits))
+	c1, _ := newClient(t, server)
+	c2, _ := newClient(t, server)
+	c3, _ := newClient(t, server)
+
+	requireUnavailable := func(err error) {
+		t.Helper()
+		var serr *StatusError
+		require.ErrorAs(t, err, &serr)
+		require.Equal(t, pb.Message_E_UNAVAILABLE, serr.Status)
+	}
+
+	_, err := c1.Register(ctx, "foo", 0)
+	require.NoError(t, err)
+	_, err = c2.Register(ctx, "foo", 0)
+	requireUnavailable(err)
+	// renewing doesn't count against the quota
+	_, err = c1.Register(ctx, "foo", 0)
+	require.NoError(t, err)
+
+	_, err = c1.Register(ctx, "big", 0)
+	require.NoError(t, err)
+	_, err = c2.Register(ctx, "big", 0)
+	require.NoError(t, err)
+	_, err = c3.Register(ctx, "big", 0)
+	requireUnavailable(err)
+
+	_, err = c3.Register(ctx, "closed", 0)
+	requireUnavailable(err)
+
+	// c1 is registered in foo and big
+	_, err = c1.Register(ctx, "bar", 0)
+	requireUnavailable(err)
+	require.NoError(t, c1.Unregister(ctx, "foo"))
+	require.Eventually(t, func() bool {
+		_, err = c1.Register(ctx, "bar", 0)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestInvalidLimits(t *testing.T) {
+	h := newHost(t)
+	limits := DefaultLimits()
+	limits.MinTTL = 2 * MaxTTL
+	_, err := NewServer(h, WithLimits(limits))
+	require.Error(t, err)
+}
+
+func TestInvalidRequests(t *testing.T) {
+	ctx := context.Background()
+	_, server := newServer(t)
+	c, h := newClient(t, server)
+
+	var serr *StatusError
+	_, err := c.Register(ctx, "", 0)
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, pb.Message_E_INVALID_NAMESPACE, serr.Status)
+	_, err = c.Register(ctx, string(make([]byte, MaxNamespaceLength+1)), 0)
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, pb.Message_E_INVALID_NAMESPACE, serr.Status)
+
+	// register a record of another peer
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	other, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: other, Addrs: h.Addrs()}), priv)
+	require.NoError(t, err)
+	rec, err := env.Marshal()
+	require.NoError(t, err)
+
+	ns := "foo"
+	typ := pb.Message_REGISTER
+	var resp pb.Message
+	require.NoError(t, c.request(ctx, &pb.Message{
+		Type:     &typ,
+		Register: &pb.Message_Register{Ns: &ns, SignedPeerRecord: rec},
+	}, &resp))
+	require.Equal(t, pb.Message_E_INVALID_SIGNED_PEER_RECORD, resp.GetRegisterResponse().GetStatus())
+
+	// unexpected messages reset the stream
+	s, err := h.NewStream(ctx, server.ID(), Protocol)
+	require.NoError(t, err)
+	defer s.Close()
+	typ = pb.Message_DISCOVER_RESPONSE
+	require.NoError(t, pbio.NewDelimitedWriter(s).WriteMsg(&pb.Message{Type: &typ}))
+	require.Error(t, pbio.NewDelimitedReader(s, maxResponseSize).ReadMsg(&resp))
+}
+
+func TestRendezvousDiscovery(t *testing.T) {
+	ctx := context.Background()
+	_, server := newServer(t)
+
+	const n = 5
+	var ids []peer.ID
+	for i := 0; i < n; i++ {
+		c, h := newClient(t, server)
+		ttl, err := NewRendezvousDiscovery(c).Advertise(ctx, "foo", discovery.TTL(time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, time.Hour, ttl)
+		ids = append(ids, h.ID())
+	}
+
+	c, _ := newClient(t, server)
+	d := NewRendezvousDiscovery(c)
+	collect := func(opts ...discovery.Option) []peer.ID {
+		ch, err := d.FindPeers(ctx, "foo", opts...)
+		require.NoError(t, err)
+		var found []peer.ID
+		for ai := range ch {
+			found = append(found, ai.ID)
+		}
+		sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+		return found
+	}
+	require.Equal(t, sortedIDs(ids...), collect())
+	require.Len(t, collect(discovery.Limit(3)), 3)
+}
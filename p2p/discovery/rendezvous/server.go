@@ -0,0 +1,421 @@
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/discovery/rendezvous/pb"
+
+	"github.com/libp2p/go-msgio/pbio"
+)
+
+// gcInterval is the interval at which expired registrations are removed.
+const gcInterval = time.Minute
+
+// Limits are the quotas enforced by the Server.
+type Limits struct {
+	// MaxNamespaces is the maximum number of namespaces with registrations.
+	MaxNamespaces int
+	// MaxRegistrationsPerNamespace is the maximum number of peers registered in a
+	// namespace, unless overridden by NamespaceQuotas.
+	MaxRegistrationsPerNamespace int
+	// NamespaceQuotas overrides MaxRegistrationsPerNamespace for individual
+	// namespaces. A quota of 0 disallows registrations in the namespace.
+	NamespaceQuotas map[string]int
+	// MaxRegistrationsPerPeer is the maximum number of namespaces a peer can be
+	// registered in.
+	MaxRegistrationsPerPeer int
+	// MinTTL and MaxTTL are the bounds of the TTL of a registration. Registrations
+	// with a TTL outside these bounds are rejected.
+	MinTTL, MaxTTL time.Duration
+	// MaxDiscoverLimit is the maximum number of registrations returned in response
+	// to a single discover request.
+	MaxDiscoverLimit int
+}
+
+// DefaultLimits returns the default limits, suitable for a public rendezvous point.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxNamespaces:                10000,
+		MaxRegistrationsPerNamespace: 1000,
+		MaxRegistrationsPerPeer:      100,
+		MinTTL:                       2 * time.Minute,
+		MaxTTL:                       MaxTTL,
+		MaxDiscoverLimit:             1000,
+	}
+}
+
+func (l *Limits) namespaceQuota(ns string) int {
+	if q, ok := l.NamespaceQuotas[ns]; ok {
+		return q
+	}
+	return l.MaxRegistrationsPerNamespace
+}
+
+// Option configures the Server.
+type Option func(*Server) error
+
+// WithLimits sets the limits enforced by the Server.
+func WithLimits(l Limits) Option {
+	return func(s *Server) error {
+		if l.MinTTL <= 0 || l.MaxTTL < l.MinTTL {
+			return fmt.Errorf("invalid TTL bounds: [%s, %s]", l.MinTTL, l.MaxTTL)
+		}
+		if l.MaxDiscoverLimit <= 0 {
+			return fmt.Errorf("invalid discover limit: %d", l.MaxDiscoverLimit)
+		}
+		s.limits = l
+		return nil
+	}
+}
+
+type registration struct {
+	ns     string
+	peer   peer.ID
+	record []byte
+	expiry time.Time
+	// seq orders the registrations in the order they were made, and is used for the
+	// discover cookie.
+	seq uint64
+}
+
+// Server is a rendezvous point.
+type Server struct {
+	host   host.Host
+	limits Limits
+	now    func() time.Time
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	refCount  sync.WaitGroup
+
+	mx            sync.Mutex
+	seq           uint64
+	namespaces    map[string]map[peer.ID]*registration
+	registrations map[peer.ID]int
+}
+
+// NewServer creates a rendezvous point and starts serving requests on h.
+func NewServer(h host.Host, opts ...Option) (*Server, error) {
+	s := &Server{
+		host:          h,
+		limits:        DefaultLimits(),
+		now:           time.Now,
+		namespaces:    make(map[string]map[peer.ID]*registration),
+		registrations: make(map[peer.ID]int),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+
+	s.refCount.Add(1)
+	go s.background()
+	h.SetStreamHandler(Protocol, s.handleStream)
+	return s, nil
+}
+
+// Close stops serving requests and drops all registrations.
+func (s *Server) Close() error {
+	s.host.RemoveStreamHandler(Protocol)
+	s.ctxCancel()
+	s.refCount.Wait()
+	return nil
+}
+
+func (s *Server) background() {
+	defer s.refCount.Done()
+
+	t := time.NewTicker(gcInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.gc()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// gc removes the expired registrations.
+func (s *Server) gc() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := s.now()
+	for _, regs := range s.namespaces {
+		for _, r := range regs {
+			if !now.Before(r.expiry) {
+				s.removeRegistration(r)
+			}
+		}
+	}
+}
+
+func (s *Server) handleStream(str network.Stream) {
+	if err := str.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("failed to attach stream to service %s: %s", ServiceName, err)
+		str.Reset()
+		return
+	}
+	if err := str.Scope().ReserveMemory(maxRequestSize, network.ReservationPriorityAlways); err != nil {
+		log.Debugf("failed to reserve memory for stream: %s", err)
+		str.Reset()
+		return
+	}
+	defer str.Scope().ReleaseMemory(maxRequestSize)
+
+	str.SetDeadline(time.Now().Add(streamTimeout))
+	defer str.Close()
+
+	p := str.Conn().RemotePeer()
+	rd := pbio.NewDelimitedReader(str, maxRequestSize)
+	wr := pbio.NewDelimitedWriter(str)
+	for {
+		var req pb.Message
+		if err := rd.ReadMsg(&req); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Debugf("error reading rendezvous request from %s: %s", p, err)
+				str.Reset()
+			}
+			return
+		}
+
+		var resp *pb.Message
+		switch req.GetType() {
+		case pb.Message_REGISTER:
+			resp = s.handleRegister(p, req.GetRegister())
+		case pb.Message_UNREGISTER:
+			s.handleUnregister(p, req.GetUnregister())
+			continue
+		case pb.Message_DISCOVER:
+			resp = s.handleDiscover(req.GetDiscover())
+		default:
+			log.Debugf("unexpected rendezvous message from %s: %s", p, req.GetType())
+			str.Reset()
+			return
+		}
+		if err := wr.WriteMsg(resp); err != nil {
+			log.Debugf("error writing rendezvous response to %s: %s", p, err)
+			str.Reset()
+			return
+		}
+	}
+}
+
+func newRegisterResponse(status pb.Message_ResponseStatus, text string, ttl time.Duration) *pb.Message {
+	t := pb.Message_REGISTER_RESPONSE
+	secs := uint64(ttl / time.Second)
+	return &pb.Message{
+		Type: &t,
+		RegisterResponse: &pb.Message_RegisterResponse{
+			Status:     &status,
+			StatusText: &text,
+			Ttl:        &secs,
+		},
+	}
+}
+
+func (s *Server) handleRegister(p peer.ID, req *pb.Message_Register) *pb.Message {
+	if req == nil {
+		return newRegisterResponse(pb.Message_E_INTERNAL_ERROR, "missing register message", 0)
+	}
+	ns := req.GetNs()
+	if ns == "" || len(ns) > MaxNamespaceLength {
+		return newRegisterResponse(pb.Message_E_INVALID_NAMESPACE, "invalid namespace", 0)
+	}
+	ttl := DefaultTTL
+	if req.Ttl != nil {
+		if req.GetTtl() > uint64(s.limits.MaxTTL/time.Second) {
+			return newRegisterResponse(pb.Message_E_INVALID_TTL, "ttl too long", 0)
+		}
+		ttl = time.Duration(req.GetTtl()) * time.Second
+	}
+	if ttl < s.limits.MinTTL || ttl > s.limits.MaxTTL {
+		return newRegisterResponse(pb.Message_E_INVALID_TTL, fmt.Sprintf("ttl must be between %s and %s", s.limits.MinTTL, s.limits.MaxTTL), 0)
+	}
+	if err := validateRecord(p, req.GetSignedPeerRecord()); err != nil {
+		log.Debugf("invalid signed peer record from %s: %s", p, err)
+		return newRegisterResponse(pb.Message_E_INVALID_SIGNED_PEER_RECORD, "invalid signed peer record", 0)
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := s.now()
+	regs, ok := s.namespaces[ns]
+	if !ok && len(s.namespaces) >= s.limits.MaxNamespaces {
+		return newRegisterResponse(pb.Message_E_UNAVAILABLE, "too many namespaces", 0)
+	}
+	if old, ok := regs[p]; ok {
+		// renewals don't count against the quotas
+		s.removeRegistration(old)
+	} else {
+		if len(regs) >= s.limits.namespaceQuota(ns) {
+			return newRegisterResponse(pb.Message_E_UNAVAILABLE, "namespace quota exceeded", 0)
+		}
+		if s.registrations[p] >= s.limits.MaxRegistrationsPerPeer {
+			return newRegisterResponse(pb.Message_E_UNAVAILABLE, "registration quota exceeded", 0)
+		}
+	}
+	s.seq++
+	s.addRegistration(&registration{
+		ns:     ns,
+		peer:   p,
+		record: req.GetSignedPeerRecord(),
+		expiry: now.Add(ttl),
+		seq:    s.seq,
+	})
+	return newRegisterResponse(pb.Message_OK, "", ttl)
+}
+
+// validateRecord checks that rec is a signed peer record of p.
+func validateRecord(p peer.ID, rec []byte) error {
+	if len(rec) > maxRecordSize {
+		return fmt.Errorf("record too large: %d bytes", len(rec))
+	}
+	_, r, err := record.ConsumeEnvelope(rec, peer.PeerRecordEnvelopeDomain)
+	if err != nil {
+		return err
+	}
+	pr, ok := r.(*peer.PeerRecord)
+	if !ok {
+		return errors.New("not a peer record")
+	}
+	if pr.PeerID != p {
+		return fmt.Errorf("record is for a different peer: %s", pr.PeerID)
+	}
+	return nil
+}
+
+func (s *Server) handleUnregister(p peer.ID, req *pb.Message_Unregister) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if r, ok := s.namespaces[req.GetNs()][p]; ok {
+		s.removeRegistration(r)
+	}
+}
+
+func newDiscoverResponse(status pb.Message_ResponseStatus, text string) *pb.Message {
+	t := pb.Message_DISCOVER_RESPONSE
+	return &pb.Message{
+		Type: &t,
+		DiscoverResponse: &pb.Message_DiscoverResponse{
+			Status:     &status,
+			StatusText: &text,
+		},
+	}
+}
+
+func (s *Server) handleDiscover(req *pb.Message_Discover) *pb.Message {
+	if req == nil {
+		return newDiscoverResponse(pb.Message_E_INTERNAL_ERROR, "missing discover message")
+	}
+	ns := req.GetNs()
+	if len(ns) > MaxNamespaceLength {
+		return newDiscoverResponse(pb.Message_E_INVALID_NAMESPACE, "invalid namespace")
+	}
+	limit := s.limits.MaxDiscoverLimit
+	if l := req.GetLimit(); l > 0 && l < uint64(limit) {
+		limit = int(l)
+	}
+	var after uint64
+	if cookie := req.GetCookie(); cookie != nil {
+		var ok bool
+		after, ok = parseCookie(cookie, ns)
+		if !ok {
+			return newDiscoverResponse(pb.Message_E_INVALID_COOKIE, "invalid cookie")
+		}
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := s.now()
+	var regs []*registration
+	add := func(nsRegs map[peer.ID]*registration) {
+		for _, r := range nsRegs {
+			if r.seq > after && now.Before(r.expiry) {
+				regs = append(regs, r)
+			}
+		}
+	}
+	if ns == "" {
+		for _, nsRegs := range s.namespaces {
+			add(nsRegs)
+		}
+	} else {
+		add(s.namespaces[ns])
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].seq < regs[j].seq })
+	if len(regs) > limit {
+		regs = regs[:limit]
+	}
+
+	resp := newDiscoverResponse(pb.Message_OK, "")
+	resp.DiscoverResponse.Registrations = make([]*pb.Message_Register, 0, len(regs))
+	for _, r := range regs {
+		ns := r.ns
+		ttl := uint64(r.expiry.Sub(now) / time.Second)
+		resp.DiscoverResponse.Registrations = append(resp.DiscoverResponse.Registrations, &pb.Message_Register{
+			Ns:               &ns,
+			SignedPeerRecord: r.record,
+			Ttl:              &ttl,
+		})
+		after = r.seq
+	}
+	resp.DiscoverResponse.Cookie = makeCookie(after, ns)
+	return resp
+}
+
+// The cookie is the sequence number of the last returned registration, followed by
+// the namespace.
+func makeCookie(seq uint64, ns string) []byte {
+	cookie := make([]byte, 8, 8+len(ns))
+	binary.BigEndian.PutUint64(cookie, seq)
+	return append(cookie, ns...)
+}
+
+func parseCookie(cookie []byte, ns string) (uint64, bool) {
+	if len(cookie) < 8 || !bytes.Equal(cookie[8:], []byte(ns)) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(cookie), true
+}
+
+func (s *Server) addRegistration(r *registration) {
+	regs, ok := s.namespaces[r.ns]
+	if !ok {
+		regs = make(map[peer.ID]*registration)
+		s.namespaces[r.ns] = regs
+	}
+	regs[r.peer] = r
+	s.registrations[r.peer]++
+}
+
+func (s *Server) removeRegistration(r *registration) {
+	regs := s.namespaces[r.ns]
+	delete(regs, r.peer)
+	if len(regs) == 0 {
+		delete(s.namespaces, r.ns)
+	}
+	s.registrations[r.peer]--
+	if s.registrations[r.peer] == 0 {
+		delete(s.registrations, r.peer)
+	}
+}
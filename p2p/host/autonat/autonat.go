@@ -3,6 +3,7 @@ package autonat
 import (
 	"context"
 	"math/rand"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -21,6 +22,10 @@ var log = logging.Logger("autonat")
 
 const maxConfidence = 3
 
+// maxObservations is the number of observations kept as evidence. A reachability
+// status confirmed by this many consecutive observations is reported with confidence 1.
+const maxObservations = maxConfidence + 1
+
 // AmbientAutoNAT is the implementation of ambient NAT autodiscovery
 type AmbientAutoNAT struct {
 	host host.Host
@@ -32,7 +37,11 @@ type AmbientAutoNAT struct {
 	backgroundRunning chan struct{}      // is closed when the background go routine exits
 
 	inboundConn   chan network.Conn
-	dialResponses chan error
+	dialResponses chan dialResponse
+	overrides     chan *network.Reachability
+	// override is the reachability set with SetReachabilityOverride, or nil.
+	// It is only accessed by the background go routine.
+	override *network.Reachability
 	// status is an autoNATResult reflecting current status.
 	status atomic.Pointer[network.Reachability]
 	// Reflects the confidence on of the NATStatus being private, as a single
@@ -40,7 +49,10 @@ type AmbientAutoNAT struct {
 	// If it is <3, then multiple autoNAT peers may be contacted for dialback
 	// If only a single autoNAT peer is known, then the confidence increases
 	// for each failure until it reaches 3.
-	confidence   int
+	confidence int
+	// observations are the most recent probe results, oldest first. They are the
+	// evidence reported with reachability changes.
+	observations []observation
 	lastInbound  time.Time
 	lastProbeTry time.Time
 	lastProbe    time.Time
@@ -52,11 +64,36 @@ type AmbientAutoNAT struct {
 	subscriber              event.Subscription
 }
 
+// dialResponse is the result of a probe.
+type dialResponse struct {
+	peer  peer.ID
+	addrs []ma.Multiaddr
+	err   error
+}
+
+// observation is the reachability observed by a probe.
+type observation struct {
+	peer         peer.ID
+	addrs        []ma.Multiaddr
+	reachability network.Reachability
+}
+
+var (
+	_ ReachabilityOverrider = (*AmbientAutoNAT)(nil)
+	_ ReachabilityOverrider = (*StaticAutoNAT)(nil)
+)
+
 // StaticAutoNAT is a simple AutoNAT implementation when a single NAT status is desired.
 type StaticAutoNAT struct {
-	host         host.Host
+	host    host.Host
+	service *autoNATService
+
+	mx sync.Mutex
+	// configured is the reachability the StaticAutoNAT was constructed with.
+	configured   network.Reachability
 	reachability network.Reachability
-	service      *autoNATService
+
+	emitReachabilityChanged event.Emitter
 }
 
 // New creates a new NAT autodiscovery system attached to a host
@@ -90,12 +127,14 @@ func New(h host.Host, options ...Option) (AutoNAT, error) {
 	}
 
 	if conf.forceReachability {
-		emitReachabilityChanged.Emit(event.EvtLocalReachabilityChanged{Reachability: conf.reachability})
+		emitReachabilityChanged.Emit(event.EvtLocalReachabilityChanged{Reachability: conf.reachability, Confidence: 1})
 
 		return &StaticAutoNAT{
-			host:         h,
-			reachability: conf.reachability,
-			service:      service,
+			host:                    h,
+			configured:              conf.reachability,
+			reachability:            conf.reachability,
+			service:                 service,
+			emitReachabilityChanged: emitReachabilityChanged,
 		}, nil
 	}
 
@@ -107,7 +146,8 @@ func New(h host.Host, options ...Option) (AutoNAT, error) {
 		host:              h,
 		config:            conf,
 		inboundConn:       make(chan network.Conn, 5),
-		dialResponses:     make(chan error, 1),
+		dialResponses:     make(chan dialResponse, 1),
+		overrides:         make(chan *network.Reachability),
 
 		emitReachabilityChanged: emitReachabilityChanged,
 		service:                 service,
@@ -139,12 +179,37 @@ func (as *AmbientAutoNAT) Status() network.Reachability {
 
 func (as *AmbientAutoNAT) emitStatus() {
 	status := *as.status.Load()
-	as.emitReachabilityChanged.Emit(event.EvtLocalReachabilityChanged{Reachability: status})
+	evt := event.EvtLocalReachabilityChanged{Reachability: status}
+	if as.override != nil {
+		evt.Confidence = 1
+	} else {
+		// the evidence are the consecutive observations confirming the status
+		i := len(as.observations)
+		for i > 0 && as.observations[i-1].reachability == status {
+			i--
+		}
+		for _, o := range as.observations[i:] {
+			evt.Evidence.Peers = append(evt.Evidence.Peers, o.peer)
+			evt.Evidence.Addrs = appendNewAddrs(evt.Evidence.Addrs, o.addrs)
+		}
+		evt.Confidence = float64(len(as.observations)-i) / float64(maxObservations)
+	}
+	as.emitReachabilityChanged.Emit(evt)
 	if as.metricsTracer != nil {
 		as.metricsTracer.ReachabilityStatus(status)
 	}
 }
 
+// appendNewAddrs appends the addresses in addrs that aren't in list yet.
+func appendNewAddrs(list []ma.Multiaddr, addrs []ma.Multiaddr) []ma.Multiaddr {
+	for _, a := range addrs {
+		if !ma.Contains(list, a) {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
 func ipInList(candidate ma.Multiaddr, list []ma.Multiaddr) bool {
 	candidateIP, _ := manet.ToIP(candidate)
 	for _, i := range list {
@@ -188,6 +253,9 @@ func (as *AmbientAutoNAT) background() {
 					as.confidence--
 				}
 			case event.EvtPeerIdentificationCompleted:
+				if as.override != nil {
+					break
+				}
 				if s, err := as.host.Peerstore().SupportsProtocols(e.Peer, AutoNATProto); err == nil && len(s) > 0 {
 					currentStatus := *as.status.Load()
 					if currentStatus == network.ReachabilityUnknown {
@@ -199,18 +267,25 @@ func (as *AmbientAutoNAT) background() {
 			}
 
 		// probe finished.
-		case err, ok := <-as.dialResponses:
+		case res, ok := <-as.dialResponses:
 			if !ok {
 				return
 			}
-			if IsDialRefused(err) {
+			if as.override != nil {
+				break
+			}
+			if IsDialRefused(res.err) {
 				retryProbe = true
 			} else {
-				as.handleDialResponse(err)
+				as.handleDialResponse(res)
 			}
+		case r := <-as.overrides:
+			as.applyOverride(r)
 		case <-timer.C:
-			peer := as.getPeerToProbe()
-			as.tryProbe(peer)
+			if as.override == nil {
+				peer := as.getPeerToProbe()
+				as.tryProbe(peer)
+			}
 			timerRunning = false
 			retryProbe = false
 		case <-as.ctx.Done():
@@ -226,6 +301,52 @@ func (as *AmbientAutoNAT) background() {
 	}
 }
 
+// SetReachabilityOverride forces the reachability status to r, and emits an
+// EvtLocalReachabilityChanged if the status changed. No probes are performed until the
+// override is cleared with ClearReachabilityOverride.
+func (as *AmbientAutoNAT) SetReachabilityOverride(r network.Reachability) {
+	as.sendOverride(&r)
+}
+
+// ClearReachabilityOverride removes the override set by SetReachabilityOverride.
+// The reachability status is reset to unknown, and automatic detection resumes.
+func (as *AmbientAutoNAT) ClearReachabilityOverride() {
+	as.sendOverride(nil)
+}
+
+func (as *AmbientAutoNAT) sendOverride(r *network.Reachability) {
+	select {
+	case as.overrides <- r:
+	case <-as.ctx.Done():
+	}
+}
+
+func (as *AmbientAutoNAT) applyOverride(r *network.Reachability) {
+	if r == nil && as.override == nil {
+		return
+	}
+	as.override = r
+
+	status := network.ReachabilityUnknown
+	if r != nil {
+		status = *r
+	}
+	as.confidence = 0
+	as.observations = nil
+	current := *as.status.Load()
+	as.status.Store(&status)
+	if as.service != nil {
+		if status == network.ReachabilityPrivate {
+			as.service.Disable()
+		} else {
+			as.service.Enable()
+		}
+	}
+	if current != status {
+		as.emitStatus()
+	}
+}
+
 func (as *AmbientAutoNAT) cleanupRecentProbes() {
 	fixedNow := time.Now()
 	for k, v := range as.recentProbes {
@@ -279,20 +400,30 @@ func (as *AmbientAutoNAT) scheduleProbe(retryProbe bool) time.Duration {
 }
 
 // handleDialResponse updates the current status based on dial response.
-func (as *AmbientAutoNAT) handleDialResponse(dialErr error) {
+func (as *AmbientAutoNAT) handleDialResponse(res dialResponse) {
 	var observation network.Reachability
 	switch {
-	case dialErr == nil:
+	case res.err == nil:
 		observation = network.ReachabilityPublic
-	case IsDialError(dialErr):
+	case IsDialError(res.err):
 		observation = network.ReachabilityPrivate
 	default:
 		observation = network.ReachabilityUnknown
 	}
 
+	as.addEvidence(res.peer, res.addrs, observation)
 	as.recordObservation(observation)
 }
 
+// addEvidence records the observation made by probing p, keeping the most recent
+// maxObservations.
+func (as *AmbientAutoNAT) addEvidence(p peer.ID, addrs []ma.Multiaddr, r network.Reachability) {
+	if len(as.observations) == maxObservations {
+		as.observations = append(as.observations[:0], as.observations[1:]...)
+	}
+	as.observations = append(as.observations, observation{peer: p, addrs: addrs, reachability: r})
+}
+
 // recordObservation updates NAT status and confidence
 func (as *AmbientAutoNAT) recordObservation(observation network.Reachability) {
 
@@ -379,7 +510,8 @@ func (as *AmbientAutoNAT) tryProbe(p peer.ID) bool {
 }
 
 func (as *AmbientAutoNAT) probe(pi *peer.AddrInfo) {
-	cli := NewAutoNATClient(as.host, as.config.addressFunc, as.metricsTracer)
+	addrs := as.config.addressFunc()
+	cli := NewAutoNATClient(as.host, func() []ma.Multiaddr { return addrs }, as.metricsTracer)
 	ctx, cancel := context.WithTimeout(as.ctx, as.config.requestTimeout)
 	defer cancel()
 
@@ -387,7 +519,7 @@ func (as *AmbientAutoNAT) probe(pi *peer.AddrInfo) {
 	log.Debugf("Dialback through peer %s completed: err: %s", pi.ID, err)
 
 	select {
-	case as.dialResponses <- err:
+	case as.dialResponses <- dialResponse{peer: pi.ID, addrs: addrs, err: err}:
 	case <-as.ctx.Done():
 		return
 	}
@@ -439,12 +571,42 @@ func (as *AmbientAutoNAT) Close() error {
 
 // Status returns the AutoNAT observed reachability status.
 func (s *StaticAutoNAT) Status() network.Reachability {
+	s.mx.Lock()
+	defer s.mx.Unlock()
 	return s.reachability
 }
 
+// SetReachabilityOverride changes the reachability status to r.
+func (s *StaticAutoNAT) SetReachabilityOverride(r network.Reachability) {
+	s.setReachability(r)
+}
+
+// ClearReachabilityOverride restores the reachability status the StaticAutoNAT was
+// configured with.
+func (s *StaticAutoNAT) ClearReachabilityOverride() {
+	s.setReachability(s.configured)
+}
+
+func (s *StaticAutoNAT) setReachability(r network.Reachability) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.reachability == r {
+		return
+	}
+	s.reachability = r
+	if s.service != nil {
+		if r == network.ReachabilityPrivate {
+			s.service.Disable()
+		} else {
+			s.service.Enable()
+		}
+	}
+	s.emitReachabilityChanged.Emit(event.EvtLocalReachabilityChanged{Reachability: r, Confidence: 1})
+}
+
 func (s *StaticAutoNAT) Close() error {
 	if s.service != nil {
 		s.service.Disable()
 	}
-	return nil
+	return s.emitReachabilityChanged.Close()
 }
@@ -15,6 +15,7 @@ import (
 
 	"github.com/libp2p/go-msgio/pbio"
 
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -311,6 +312,61 @@ func TestAutoNATObservationRecording(t *testing.T) {
 	}
 }
 
+func TestAutoNATReachabilityEvidence(t *testing.T) {
+	hs := makeAutoNATServicePublic(t)
+	defer hs.Close()
+	hc, ani := makeAutoNAT(t, hs)
+	defer hc.Close()
+	defer ani.Close()
+	an := ani.(*AmbientAutoNAT)
+
+	s, err := hc.EventBus().Subscribe(&event.EvtLocalReachabilityChanged{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	addrs := []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1")}
+	expectEvidence := func(r network.Reachability, confidence float64, peers ...peer.ID) {
+		t.Helper()
+		select {
+		case e := <-s.Out():
+			ev := e.(event.EvtLocalReachabilityChanged)
+			require.Equal(t, r, ev.Reachability)
+			require.Equal(t, confidence, ev.Confidence)
+			require.Equal(t, peers, ev.Evidence.Peers)
+			require.Equal(t, addrs, ev.Evidence.Addrs)
+		case <-time.After(3 * time.Second):
+			t.Fatal("failed to get the reachability event from the bus")
+		}
+	}
+
+	// a single observation is enough to become public, but not with much confidence
+	an.handleDialResponse(dialResponse{peer: "peer1", addrs: addrs})
+	expectEvidence(network.ReachabilityPublic, 0.25, "peer1")
+
+	for i := 0; i < 3; i++ {
+		an.handleDialResponse(dialResponse{peer: "peer1", addrs: addrs})
+	}
+	// it takes as many private observations to undo the public status
+	dialErr := Error{Status: pb.Message_E_DIAL_ERROR}
+	for _, p := range []peer.ID{"peer1", "peer2", "peer3"} {
+		an.handleDialResponse(dialResponse{peer: p, addrs: addrs, err: dialErr})
+	}
+	require.Equal(t, network.ReachabilityPublic, an.Status())
+	an.handleDialResponse(dialResponse{peer: "peer4", addrs: addrs, err: dialErr})
+	expectEvidence(network.ReachabilityPrivate, 1, "peer1", "peer2", "peer3", "peer4")
+
+	an.SetReachabilityOverride(network.ReachabilityPublic)
+	select {
+	case e := <-s.Out():
+		ev := e.(event.EvtLocalReachabilityChanged)
+		require.Equal(t, network.ReachabilityPublic, ev.Reachability)
+		require.Equal(t, 1.0, ev.Confidence)
+		require.Empty(t, ev.Evidence.Peers)
+	case <-time.After(3 * time.Second):
+		t.Fatal("failed to get the reachability event from the bus")
+	}
+}
+
 func TestStaticNat(t *testing.T) {
 	_, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -328,3 +384,53 @@ func TestStaticNat(t *testing.T) {
 	}
 	expectEvent(t, s, network.ReachabilityPrivate, 3*time.Second)
 }
+
+func TestAutoNATReachabilityOverride(t *testing.T) {
+	hs := makeAutoNATServicePublic(t)
+	defer hs.Close()
+	hc, an := makeAutoNAT(t, hs)
+	defer hc.Close()
+	defer an.Close()
+
+	s, err := hc.EventBus().Subscribe(&event.EvtLocalReachabilityChanged{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	an.(ReachabilityOverrider).SetReachabilityOverride(network.ReachabilityPrivate)
+	expectEvent(t, s, network.ReachabilityPrivate, 3*time.Second)
+	require.Equal(t, network.ReachabilityPrivate, an.Status())
+
+	// the override prevails over the probes, which would find us public
+	connect(t, hs, hc)
+	select {
+	case e := <-s.Out():
+		t.Fatalf("unexpected event: %v", e)
+	case <-time.After(500 * time.Millisecond):
+	}
+	require.Equal(t, network.ReachabilityPrivate, an.Status())
+
+	an.(ReachabilityOverrider).ClearReachabilityOverride()
+	expectEvent(t, s, network.ReachabilityUnknown, 3*time.Second)
+	expectEvent(t, s, network.ReachabilityPublic, 3*time.Second)
+}
+
+func TestStaticNatReachabilityOverride(t *testing.T) {
+	h := bhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h.Close()
+	s, err := h.EventBus().Subscribe(&event.EvtLocalReachabilityChanged{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	nat, err := New(h, WithReachability(network.ReachabilityPrivate))
+	require.NoError(t, err)
+	defer nat.Close()
+	expectEvent(t, s, network.ReachabilityPrivate, 3*time.Second)
+
+	nat.(ReachabilityOverrider).SetReachabilityOverride(network.ReachabilityPublic)
+	expectEvent(t, s, network.ReachabilityPublic, 3*time.Second)
+	require.Equal(t, network.ReachabilityPublic, nat.Status())
+
+	nat.(ReachabilityOverrider).ClearReachabilityOverride()
+	expectEvent(t, s, network.ReachabilityPrivate, 3*time.Second)
+	require.Equal(t, network.ReachabilityPrivate, nat.Status())
+}
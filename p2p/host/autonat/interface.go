@@ -17,6 +17,16 @@ type AutoNAT interface {
 	io.Closer
 }
 
+// ReachabilityOverrider is implemented by AutoNAT implementations that allow
+// overriding the reachability status at runtime.
+type ReachabilityOverrider interface {
+	// SetReachabilityOverride forces the reachability status to r until the override
+	// is cleared. While the override is in place, no probes are performed.
+	SetReachabilityOverride(r network.Reachability)
+	// ClearReachabilityOverride removes the override set by SetReachabilityOverride.
+	ClearReachabilityOverride()
+}
+
 // Client is a stateless client interface to AutoNAT peers
 type Client interface {
 	// DialBack requests from a peer providing AutoNAT services to test dial back
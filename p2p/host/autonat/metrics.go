@@ -50,6 +50,29 @@ var (
 		},
 		[]string{"refusal_reason"},
 	)
+	incomingDialRequestTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "incoming_dial_request_total",
+			Help:      "Count of dial requests received by server",
+		},
+	)
+	dialBackTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "dial_back_total",
+			Help:      "Count of dial-backs performed by server",
+		},
+		[]string{"outcome"},
+	)
+	dialBackDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "dial_back_duration_seconds",
+			Help:      "Duration of dial-backs performed by server",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 15},
+		},
+	)
 	nextProbeTimestamp = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: metricNamespace,
@@ -63,6 +86,9 @@ var (
 		receivedDialResponseTotal,
 		outgoingDialResponseTotal,
 		outgoingDialRefusedTotal,
+		incomingDialRequestTotal,
+		dialBackTotal,
+		dialBackDuration,
 		nextProbeTimestamp,
 	}
 )
@@ -73,6 +99,8 @@ type MetricsTracer interface {
 	ReceivedDialResponse(status pb.Message_ResponseStatus)
 	OutgoingDialResponse(status pb.Message_ResponseStatus)
 	OutgoingDialRefused(reason string)
+	IncomingDialRequest()
+	DialBack(success bool, d time.Duration)
 	NextProbeTime(t time.Time)
 }
 
@@ -157,6 +185,22 @@ func (mt *metricsTracer) OutgoingDialRefused(reason string) {
 	outgoingDialRefusedTotal.WithLabelValues(*tags...).Inc()
 }
 
+func (mt *metricsTracer) IncomingDialRequest() {
+	incomingDialRequestTotal.Inc()
+}
+
+func (mt *metricsTracer) DialBack(success bool, d time.Duration) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	if success {
+		*tags = append(*tags, "success")
+	} else {
+		*tags = append(*tags, "failure")
+	}
+	dialBackTotal.WithLabelValues(*tags...).Inc()
+	dialBackDuration.Observe(d.Seconds())
+}
+
 func (mt *metricsTracer) NextProbeTime(t time.Time) {
 	nextProbeTimestamp.Set(float64(t.Unix()))
 }
@@ -71,6 +71,8 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 		"ReceivedDialResponse":         func() { mt.ReceivedDialResponse(respStatuses[rand.Intn(len(respStatuses))]) },
 		"OutgoingDialResponse":         func() { mt.OutgoingDialResponse(respStatuses[rand.Intn(len(respStatuses))]) },
 		"OutgoingDialRefused":          func() { mt.OutgoingDialRefused(reasons[rand.Intn(len(reasons))]) },
+		"IncomingDialRequest":          func() { mt.IncomingDialRequest() },
+		"DialBack":                     func() { mt.DialBack(rand.Intn(2) == 1, time.Duration(rand.Intn(5000))*time.Millisecond) },
 		"NextProbeTime":                func() { mt.NextProbeTime(time.Now()) },
 	}
 	for method, f := range tests {
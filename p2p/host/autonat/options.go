@@ -144,6 +144,31 @@ func WithPeerThrottling(amount int) Option {
 	}
 }
 
+// WithDialTimeout sets the timeout for dial-backs performed when acting as a server.
+// Failed dial-backs always take the full timeout, so that the service can't be used
+// as a port scanner.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *config) error {
+		if d <= 0 {
+			return errors.New("dial timeout must be positive")
+		}
+		c.dialTimeout = d
+		return nil
+	}
+}
+
+// WithMaxPeerAddresses sets the maximum number of addresses of a peer that are
+// dialed back when acting as a server.
+func WithMaxPeerAddresses(n int) Option {
+	return func(c *config) error {
+		if n <= 0 {
+			return errors.New("maximum number of peer addresses must be positive")
+		}
+		c.maxPeerAddresses = n
+		return nil
+	}
+}
+
 // WithMetricsTracer uses mt to track autonat metrics
 func WithMetricsTracer(mt MetricsTracer) Option {
 	return func(c *config) error {
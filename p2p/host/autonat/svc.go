@@ -10,7 +10,9 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/transport"
 	"github.com/libp2p/go-libp2p/p2p/host/autonat/pb"
+	"github.com/libp2p/go-libp2p/p2p/net/addrutil"
 
 	"github.com/libp2p/go-msgio/pbio"
 
@@ -90,6 +92,9 @@ func (as *autoNATService) handleStream(s network.Stream) {
 		return
 	}
 
+	if as.config.metricsTracer != nil {
+		as.config.metricsTracer.IncomingDialRequest()
+	}
 	dr := as.handleDial(pid, s.Conn().RemoteMultiaddr(), req.GetDial().GetPeer())
 	res.Type = pb.Message_DIAL_RESPONSE.Enum()
 	res.DialResponse = dr
@@ -147,7 +152,12 @@ func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Me
 	}
 
 	// add observed addr to the list of addresses to dial
-	addrs = append(addrs, obsaddr)
+	// The observed address of a connection over a transport that authenticates the
+	// server by certificate hash lacks the hashes, so we might not be able to dial it.
+	// The peer's own addresses on that transport are tried below.
+	if as.canDial(obsaddr) {
+		addrs = append(addrs, obsaddr)
+	}
 	seen[obsaddr.String()] = struct{}{}
 
 	for _, maddr := range mpi.GetAddrs() {
@@ -174,8 +184,8 @@ func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Me
 		}
 
 		// Make sure we're willing to dial the rest of the address (e.g., not a circuit
-		// address).
-		if as.config.dialPolicy.skipDial(addr) {
+		// address), and that we're able to.
+		if as.config.dialPolicy.skipDial(addr) || !as.canDial(addr) {
 			continue
 		}
 
@@ -204,6 +214,23 @@ func (as *autoNATService) handleDial(p peer.ID, obsaddr ma.Multiaddr, mpi *pb.Me
 	return as.doDial(peer.AddrInfo{ID: p, Addrs: addrs})
 }
 
+// canDial reports whether the dialer supports the transport of addr. Addresses we
+// can't dial are dropped, so that peers listening only on transports we don't support
+// are refused rather than told they're unreachable.
+func (as *autoNATService) canDial(addr ma.Multiaddr) bool {
+	type transportForDialinger interface {
+		TransportForDialing(a ma.Multiaddr) transport.Transport
+	}
+
+	if addrutil.MissingCertHash(addr) {
+		return false
+	}
+	if s, ok := as.config.dialer.(transportForDialinger); ok {
+		return s.TransportForDialing(addr) != nil
+	}
+	return true
+}
+
 func (as *autoNATService) doDial(pi peer.AddrInfo) *pb.Message_DialResponse {
 	// rate limit check
 	as.mx.Lock()
@@ -232,7 +259,11 @@ func (as *autoNATService) doDial(pi peer.AddrInfo) *pb.Message_DialResponse {
 		as.config.dialer.Peerstore().RemovePeer(pi.ID)
 	}()
 
+	start := time.Now()
 	conn, err := as.config.dialer.DialPeer(ctx, pi.ID)
+	if as.config.metricsTracer != nil {
+		as.config.metricsTracer.DialBack(err == nil, time.Since(start))
+	}
 	if err != nil {
 		log.Debugf("error dialing %s: %s", pi.ID.Pretty(), err.Error())
 		// wait for the context to timeout to avoid leaking timing information
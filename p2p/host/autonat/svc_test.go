@@ -3,6 +3,7 @@ package autonat
 import (
 	"context"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -87,6 +89,91 @@ func TestAutoNATServiceDialSuccess(t *testing.T) {
 	}
 }
 
+func TestAutoNATServiceDialUDPTransports(t *testing.T) {
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+	_ = makeAutoNATService(t, c)
+
+	// the client only listens on QUIC
+	hc := bhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableTCP))
+	defer hc.Close()
+	connect(t, c.host, hc)
+	require.NoError(t, NewAutoNATClient(hc, nil, nil).DialBack(context.Background(), c.host.ID()))
+
+	// a dialer without QUIC support refuses to dial instead of reporting a dial error
+	dh := bhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC, swarmt.OptDialOnly))
+	defer dh.Close()
+	c.dialer = dh.Network()
+	err := NewAutoNATClient(hc, nil, nil).DialBack(context.Background(), c.host.ID())
+	require.True(t, IsDialRefused(err), err)
+}
+
+func TestAutoNATServiceSkipsAddrsWithoutCertHash(t *testing.T) {
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+	as := makeAutoNATService(t, c)
+
+	require.True(t, as.canDial(ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1")))
+	require.False(t, as.canDial(ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1/webtransport")))
+	// the test dialer doesn't support WebTransport
+	require.False(t, as.canDial(ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1/webtransport/certhash/uEiDDq4_xNyDorZBH3TlGazyJdOWSwvo4PUo5YHFMrvDE8g")))
+}
+
+type countingMetricsTracer struct {
+	MetricsTracer
+	requests  atomic.Int32
+	successes atomic.Int32
+	failures  atomic.Int32
+}
+
+func (mt *countingMetricsTracer) IncomingDialRequest() {
+	mt.requests.Add(1)
+	mt.MetricsTracer.IncomingDialRequest()
+}
+
+func (mt *countingMetricsTracer) DialBack(success bool, d time.Duration) {
+	if success {
+		mt.successes.Add(1)
+	} else {
+		mt.failures.Add(1)
+	}
+	mt.MetricsTracer.DialBack(success, d)
+}
+
+func TestAutoNATServiceMetrics(t *testing.T) {
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+
+	mt := &countingMetricsTracer{MetricsTracer: &metricsTracer{}}
+	c.metricsTracer = mt
+	_ = makeAutoNATService(t, c)
+
+	hc, ac := makeAutoNATClient(t)
+	defer hc.Close()
+	connect(t, c.host, hc)
+
+	require.NoError(t, ac.DialBack(context.Background(), c.host.ID()))
+	require.Equal(t, int32(1), mt.requests.Load())
+	require.Equal(t, int32(1), mt.successes.Load())
+	require.Zero(t, mt.failures.Load())
+}
+
+func TestAutoNATServiceOptions(t *testing.T) {
+	c := makeAutoNATConfig(t)
+	defer c.host.Close()
+	defer c.dialer.Close()
+
+	require.NoError(t, WithDialTimeout(time.Second)(c))
+	require.Equal(t, time.Second, c.dialTimeout)
+	require.Error(t, WithDialTimeout(0)(c))
+	require.NoError(t, WithMaxPeerAddresses(2)(c))
+	require.Equal(t, 2, c.maxPeerAddresses)
+	require.Error(t, WithMaxPeerAddresses(0)(c))
+}
+
 func TestAutoNATServiceDialRateLimiter(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -49,7 +49,12 @@ func NewAutoRelay(bhost *basic.BasicHost, opts ...Option) (*AutoRelay, error) {
 	}
 	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
 	r.conf = &conf
-	r.relayFinder = newRelayFinder(bhost, conf.peerSource, &conf)
+	rf, err := newRelayFinder(bhost, conf.peerSource, &conf)
+	if err != nil {
+		r.ctxCancel()
+		return nil, err
+	}
+	r.relayFinder = rf
 	r.metricsTracer = &wrappedMetricsTracer{conf.metricsTracer}
 	bhost.AddrsFactory = r.hostAddrs
 
@@ -84,15 +89,13 @@ func (r *AutoRelay) background() {
 			evt := ev.(event.EvtLocalReachabilityChanged)
 			switch evt.Reachability {
 			case network.ReachabilityPrivate, network.ReachabilityUnknown:
-				err := r.relayFinder.Start()
-				if errors.Is(err, errAlreadyRunning) {
-					log.Debug("tried to start already running relay finder")
-				} else if err != nil {
-					log.Errorw("failed to start relay finder", "error", err)
-				} else {
-					r.metricsTracer.RelayFinderStatus(true)
-				}
+				r.startRelayFinder()
 			case network.ReachabilityPublic:
+				if r.conf.circuitAddrPolicy == CircuitAddrsAlways {
+					// we advertise the relay addresses anyway
+					r.startRelayFinder()
+					break
+				}
 				r.relayFinder.Stop()
 				r.metricsTracer.RelayFinderStatus(false)
 			}
@@ -103,6 +106,17 @@ func (r *AutoRelay) background() {
 	}
 }
 
+func (r *AutoRelay) startRelayFinder() {
+	err := r.relayFinder.Start()
+	if errors.Is(err, errAlreadyRunning) {
+		log.Debug("tried to start already running relay finder")
+	} else if err != nil {
+		log.Errorw("failed to start relay finder", "error", err)
+	} else {
+		r.metricsTracer.RelayFinderStatus(true)
+	}
+}
+
 func (r *AutoRelay) hostAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	return r.relayAddrs(r.addrsF(addrs))
 }
@@ -111,15 +125,36 @@ func (r *AutoRelay) relayAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	r.mx.Lock()
 	defer r.mx.Unlock()
 
+	switch r.conf.circuitAddrPolicy {
+	case CircuitAddrsNever:
+		return addrs
+	case CircuitAddrsAlways:
+		if r.status != network.ReachabilityPrivate {
+			return append(addrs[:len(addrs):len(addrs)], r.relayFinder.circuitAddrs()...)
+		}
+	}
 	if r.status != network.ReachabilityPrivate {
 		return addrs
 	}
 	return r.relayFinder.relayAddrs(addrs)
 }
 
+// FilterListenAddrs is an identify.ListenAddrsFilter that withholds the relay
+// addresses from the peers that mustn't learn about them, see CircuitAddrsToPeers.
+func (r *AutoRelay) FilterListenAddrs(c network.Conn, addrs []ma.Multiaddr) []ma.Multiaddr {
+	if r.conf.circuitAddrPolicy != CircuitAddrsToPeers {
+		return addrs
+	}
+	if _, ok := r.conf.circuitAddrPeers[c.RemotePeer()]; ok {
+		return addrs
+	}
+	return Filter(addrs)
+}
+
 func (r *AutoRelay) Close() error {
 	r.ctxCancel()
 	err := r.relayFinder.Stop()
 	r.refCount.Wait()
+	r.relayFinder.closeEmitters()
 	return err
 }
@@ -4,18 +4,24 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/routing"
 	"github.com/libp2p/go-libp2p/core/test"
 	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
 	circuitv2_proto "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
 
+	"github.com/ipfs/go-cid"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
 )
@@ -85,9 +91,9 @@ func newPrivateNodeWithStaticRelays(t *testing.T, static []peer.AddrInfo, opts .
 	return h
 }
 
-func newRelay(t *testing.T) host.Host {
+func newRelay(t *testing.T, opts ...libp2p.Option) host.Host {
 	t.Helper()
-	h, err := libp2p.New(
+	h, err := libp2p.New(append([]libp2p.Option{
 		libp2p.DisableRelay(),
 		libp2p.EnableRelayService(),
 		libp2p.ForceReachabilityPublic(),
@@ -101,7 +107,7 @@ func newRelay(t *testing.T) host.Host {
 			}
 			return addrs
 		}),
-	)
+	}, opts...)...)
 	require.NoError(t, err)
 	require.Eventually(t, func() bool {
 		for _, p := range h.Mux().Protocols() {
@@ -517,3 +523,421 @@ func TestNoBusyLoop0MinInterval(t *testing.T) {
 	val := atomic.LoadUint64(&calledTimes)
 	require.Less(t, val, uint64(2))
 }
+
+func TestReservationEvents(t *testing.T) {
+	cl := newMockClock()
+	r := newRelay(t)
+	t.Cleanup(func() { r.Close() })
+
+	start := make(chan struct{})
+	var renew atomic.Bool
+	renew.Store(true)
+	h := newPrivateNode(t,
+		func(ctx context.Context, _ int) <-chan peer.AddrInfo {
+			c := make(chan peer.AddrInfo, 1)
+			go func() {
+				defer close(c)
+				select {
+				case <-start:
+					c <- peer.AddrInfo{ID: r.ID(), Addrs: r.Addrs()}
+				case <-ctx.Done():
+				}
+			}()
+			return c
+		},
+		autorelay.WithClock(cl),
+		autorelay.WithBootDelay(0),
+		autorelay.WithNumRelays(1),
+		autorelay.WithMaxCandidates(1),
+		autorelay.WithRenewalPolicy(func(_ peer.ID, _ time.Time, _ bool) bool { return renew.Load() }),
+	)
+	defer h.Close()
+
+	sub, err := h.EventBus().Subscribe([]interface{}{
+		new(event.EvtRelayReservationObtained),
+		new(event.EvtRelayReservationRenewed),
+		new(event.EvtRelayReservationExpiring),
+		new(event.EvtRelayReservationLost),
+	})
+	require.NoError(t, err)
+	defer sub.Close()
+	close(start)
+
+	next := func() interface{} {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for reservation event")
+			return nil
+		}
+	}
+
+	obtained, ok := next().(event.EvtRelayReservationObtained)
+	require.True(t, ok)
+	require.Equal(t, r.ID(), obtained.Relay)
+
+	// the renewal policy can renew reservations early
+	cl.AdvanceBy(time.Minute + time.Second)
+	renewed, ok := next().(event.EvtRelayReservationRenewed)
+	require.True(t, ok)
+	require.Equal(t, r.ID(), renewed.Relay)
+
+	// and veto renewals, letting the reservation expire
+	renew.Store(false)
+	cl.AdvanceBy(renewed.Expiration.Sub(cl.Now()) - time.Minute)
+	expiring, ok := next().(event.EvtRelayReservationExpiring)
+	require.True(t, ok)
+	require.Equal(t, renewed.Expiration, expiring.Expiration)
+	require.Equal(t, 1, numRelays(h))
+
+	cl.AdvanceBy(2 * time.Minute)
+	lost, ok := next().(event.EvtRelayReservationLost)
+	require.True(t, ok)
+	require.Equal(t, r.ID(), lost.Relay)
+	require.ErrorIs(t, lost.Reason, autorelay.ErrReservationExpired)
+	// after which we obtain a new reservation
+	_, ok = next().(event.EvtRelayReservationObtained)
+	require.True(t, ok)
+}
+
+func TestPeerstoreCandidateSource(t *testing.T) {
+	r := newRelay(t)
+	defer r.Close()
+
+	h, err := libp2p.New(
+		libp2p.ForceReachabilityPrivate(),
+		libp2p.EnableAutoRelayWithCandidateSource(autorelay.PeerstoreCandidateSource(),
+			autorelay.WithBootDelay(0),
+			autorelay.WithMinCandidates(1),
+			autorelay.WithMinInterval(100*time.Millisecond),
+		),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+
+	require.Never(t, func() bool { return numRelays(h) > 0 }, 200*time.Millisecond, 50*time.Millisecond)
+
+	h.Peerstore().AddAddrs(r.ID(), r.Addrs(), time.Hour)
+	require.NoError(t, h.Peerstore().AddProtocols(r.ID(), protoIDv2))
+	require.Eventually(t, func() bool { return numRelays(h) > 0 }, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestCandidateScorer(t *testing.T) {
+	const numCandidates = 3
+	var relays []peer.AddrInfo
+	for i := 0; i < numCandidates; i++ {
+		r := newRelay(t)
+		t.Cleanup(func() { r.Close() })
+		relays = append(relays, peer.AddrInfo{ID: r.ID(), Addrs: r.Addrs()})
+	}
+	preferred := relays[numCandidates-1].ID
+
+	h := newPrivateNodeWithStaticRelays(t, relays,
+		autorelay.WithMinCandidates(numCandidates),
+		autorelay.WithNumRelays(1),
+		// wait for all candidates, so that the scorer picks among all of them
+		autorelay.WithBootDelay(time.Hour),
+		autorelay.WithCandidateScorer(func(_ host.Host, ai peer.AddrInfo) float64 {
+			if ai.ID == preferred {
+				return 1
+			}
+			return 0
+		}),
+	)
+	defer h.Close()
+
+	require.Eventually(t, func() bool { return numRelays(h) > 0 }, 10*time.Second, 100*time.Millisecond)
+	require.Equal(t, []peer.ID{preferred}, usedRelays(h))
+}
+
+func TestStatus(t *testing.T) {
+	const numRelays = 2
+	var relays []peer.AddrInfo
+	for i := 0; i < numRelays; i++ {
+		r := newRelay(t)
+		t.Cleanup(func() { r.Close() })
+		relays = append(relays, peer.AddrInfo{ID: r.ID(), Addrs: r.Addrs()})
+	}
+
+	h := newPrivateNodeWithStaticRelays(t, relays,
+		autorelay.WithMinCandidates(numRelays),
+		autorelay.WithNumRelays(numRelays),
+		autorelay.WithBootDelay(0),
+	)
+	defer h.Close()
+
+	arh, ok := h.(*autorelay.AutoRelayHost)
+	require.True(t, ok)
+	require.Eventually(t, func() bool { return len(arh.Status().Relays) == numRelays }, 10*time.Second, 100*time.Millisecond)
+
+	s := arh.Status()
+	require.True(t, s.Active)
+	require.Equal(t, network.ReachabilityPrivate, s.Reachability)
+	// candidates are removed from the pool once we obtained a reservation with them
+	require.Equal(t, numRelays, s.CandidatesAdded)
+	require.Equal(t, s.CandidatesAdded-s.CandidatesRemoved, s.Candidates)
+	for _, rs := range s.Relays {
+		require.Contains(t, []peer.ID{relays[0].ID, relays[1].ID}, rs.ID)
+		require.True(t, rs.Expiration.After(time.Now()))
+		_, err := circuitv2_proto.VerifyVoucher(rs.Voucher, rs.ID, h.ID(), time.Now())
+		require.NoError(t, err)
+	}
+}
+
+func TestPrioritizedStaticRelays(t *testing.T) {
+	cl := newMockClock()
+	r1 := newRelay(t)
+	t.Cleanup(func() { r1.Close() })
+	r2 := newRelay(t)
+	t.Cleanup(func() { r2.Close() })
+
+	h, err := libp2p.New(
+		libp2p.ForceReachabilityPrivate(),
+		libp2p.EnableAutoRelay(
+			autorelay.WithPrioritizedStaticRelays([]peer.AddrInfo{
+				{ID: r1.ID(), Addrs: r1.Addrs()},
+				{ID: r2.ID(), Addrs: r2.Addrs()},
+			}, 1),
+			autorelay.WithClock(cl),
+			autorelay.WithBackoff(30*time.Minute),
+		),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+
+	sub, err := h.EventBus().Subscribe(new(event.EvtRelayFailover))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	cl.AdvanceBy(time.Minute)
+	require.Eventually(t, func() bool {
+		relays := usedRelays(h)
+		return len(relays) == 1 && relays[0] == r1.ID()
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// fail over to the lower priority relay, once the boot delay passed
+	cl.AdvanceBy(5 * time.Minute)
+	r1.Network().ClosePeer(h.ID())
+	select {
+	case e := <-sub.Out():
+		require.Equal(t, event.EvtRelayFailover{From: r1.ID(), To: r2.ID()}, e)
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected a failover event")
+	}
+	require.Eventually(t, func() bool {
+		relays := usedRelays(h)
+		return len(relays) == 1 && relays[0] == r2.ID()
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// switch back once the backoff for the higher priority relay expired
+	cl.AdvanceBy(time.Hour)
+	var e interface{}
+	require.Eventually(t, func() bool {
+		select {
+		case e = <-sub.Out():
+			return true
+		default:
+			cl.AdvanceBy(time.Minute)
+			return false
+		}
+	}, 10*time.Second, 100*time.Millisecond)
+	require.Equal(t, event.EvtRelayFailover{From: r2.ID(), To: r1.ID()}, e)
+	require.Eventually(t, func() bool {
+		relays := usedRelays(h)
+		return len(relays) == 1 && relays[0] == r1.ID()
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestRelayHealthCheck(t *testing.T) {
+	cl := newMockClock()
+	r := newRelay(t)
+	t.Cleanup(func() { r.Close() })
+
+	h := newPrivateNodeWithStaticRelays(t,
+		[]peer.AddrInfo{{ID: r.ID(), Addrs: r.Addrs()}},
+		autorelay.WithClock(cl),
+		// no relay can be that fast
+		autorelay.WithRelayHealthCheck(time.Nanosecond),
+	)
+	defer h.Close()
+
+	sub, err := h.EventBus().Subscribe(new(event.EvtRelayReservationLost))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	cl.AdvanceBy(time.Minute)
+	require.Eventually(t, func() bool { return numRelays(h) == 1 }, 10*time.Second, 100*time.Millisecond)
+
+	// the health check runs with the next reservation refresh
+	cl.AdvanceBy(2 * time.Minute)
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtRelayReservationLost)
+		require.Equal(t, r.ID(), evt.Relay)
+		require.ErrorIs(t, evt.Reason, autorelay.ErrRelayUnhealthy)
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the reservation to be lost")
+	}
+	require.Eventually(t, func() bool { return numRelays(h) == 0 }, 10*time.Second, 100*time.Millisecond)
+}
+
+type mockRouting struct {
+	h  host.Host
+	mx *sync.Mutex
+	// providers holds the providers of each CID
+	providers map[string][]peer.AddrInfo
+}
+
+func (m *mockRouting) Provide(_ context.Context, c cid.Cid, _ bool) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.providers[c.String()] = append(m.providers[c.String()], peer.AddrInfo{ID: m.h.ID(), Addrs: m.h.Addrs()})
+	return nil
+}
+
+func (m *mockRouting) FindProvidersAsync(_ context.Context, c cid.Cid, _ int) <-chan peer.AddrInfo {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	ch := make(chan peer.AddrInfo, len(m.providers[c.String()]))
+	defer close(ch)
+	for _, ai := range m.providers[c.String()] {
+		ch <- ai
+	}
+	return ch
+}
+
+func (m *mockRouting) FindPeer(context.Context, peer.ID) (peer.AddrInfo, error) {
+	return peer.AddrInfo{}, routing.ErrNotFound
+}
+
+func TestRoutingCandidateSource(t *testing.T) {
+	var mx sync.Mutex
+	providers := make(map[string][]peer.AddrInfo)
+	withMockRouting := libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
+		return &mockRouting{h: h, mx: &mx, providers: providers}, nil
+	})
+
+	r := newRelay(t, libp2p.AdvertiseRelayService(), withMockRouting)
+	defer r.Close()
+	require.Eventually(t, func() bool {
+		mx.Lock()
+		defer mx.Unlock()
+		return len(providers) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	h, err := libp2p.New(
+		libp2p.ForceReachabilityPrivate(),
+		libp2p.EnableAutoRelayWithRouting(
+			autorelay.WithMinCandidates(1),
+			autorelay.WithBootDelay(0),
+		),
+		withMockRouting,
+	)
+	require.NoError(t, err)
+	defer h.Close()
+
+	require.Eventually(t, func() bool {
+		relays := usedRelays(h)
+		return len(relays) == 1 && relays[0] == r.ID()
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestCircuitAddrPolicy(t *testing.T) {
+	hasCircuitAddr := func(addrs []ma.Multiaddr) bool {
+		return len(autorelay.Filter(addrs)) < len(addrs)
+	}
+
+	t.Run("never", func(t *testing.T) {
+		r := newRelay(t)
+		t.Cleanup(func() { r.Close() })
+		h := newPrivateNodeWithStaticRelays(t, []peer.AddrInfo{{ID: r.ID(), Addrs: r.Addrs()}},
+			autorelay.WithBootDelay(0),
+			autorelay.WithCircuitAddrPolicy(autorelay.CircuitAddrsNever),
+		)
+		defer h.Close()
+
+		require.Eventually(t, func() bool { return len(h.(*autorelay.AutoRelayHost).Status().Relays) == 1 }, 10*time.Second, 100*time.Millisecond)
+		require.Never(t, func() bool { return hasCircuitAddr(h.Addrs()) }, 200*time.Millisecond, 50*time.Millisecond)
+	})
+
+	t.Run("always", func(t *testing.T) {
+		r := newRelay(t)
+		t.Cleanup(func() { r.Close() })
+		h, err := libp2p.New(
+			libp2p.ForceReachabilityPublic(),
+			libp2p.EnableAutoRelayWithStaticRelays([]peer.AddrInfo{{ID: r.ID(), Addrs: r.Addrs()}},
+				autorelay.WithBootDelay(0),
+				autorelay.WithCircuitAddrPolicy(autorelay.CircuitAddrsAlways),
+			),
+		)
+		require.NoError(t, err)
+		defer h.Close()
+
+		require.Eventually(t, func() bool { return hasCircuitAddr(h.Addrs()) }, 10*time.Second, 100*time.Millisecond)
+		require.Less(t, len(autorelay.Filter(h.Addrs())), len(h.Addrs()))
+		require.NotEmpty(t, autorelay.Filter(h.Addrs()), "expected the direct addresses to be advertised")
+	})
+
+	t.Run("to peers", func(t *testing.T) {
+		r := newRelay(t)
+		t.Cleanup(func() { r.Close() })
+		allowed, err := libp2p.New()
+		require.NoError(t, err)
+		defer allowed.Close()
+		other, err := libp2p.New()
+		require.NoError(t, err)
+		defer other.Close()
+
+		h := newPrivateNodeWithStaticRelays(t, []peer.AddrInfo{{ID: r.ID(), Addrs: r.Addrs()}},
+			autorelay.WithBootDelay(0),
+			autorelay.WithCircuitAddrPolicy(autorelay.CircuitAddrsToPeers, allowed.ID()),
+		)
+		defer h.Close()
+		require.Eventually(t, func() bool { return hasCircuitAddr(h.Addrs()) }, 10*time.Second, 100*time.Millisecond)
+
+		for _, p := range []host.Host{allowed, other} {
+			require.NoError(t, p.Connect(context.Background(), peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}))
+		}
+		require.Eventually(t, func() bool { return hasCircuitAddr(allowed.Peerstore().Addrs(h.ID())) }, 5*time.Second, 50*time.Millisecond)
+		require.False(t, hasCircuitAddr(other.Peerstore().Addrs(h.ID())))
+	})
+}
+
+func TestCertifiedRelayAddrs(t *testing.T) {
+	r := newRelay(t)
+	t.Cleanup(func() { r.Close() })
+	// this address isn't in the signed peer record of the relay, and it's not removed by
+	// identify as it's permanent
+	uncertified := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	ps.AddAddr(r.ID(), uncertified, peerstore.PermanentAddrTTL)
+	h, err := libp2p.New(
+		libp2p.Peerstore(ps),
+		libp2p.ForceReachabilityPrivate(),
+		libp2p.RequireSignedPeerRecord(),
+		libp2p.EnableAutoRelayWithStaticRelays(
+			[]peer.AddrInfo{{ID: r.ID(), Addrs: r.Addrs()}},
+			autorelay.WithBootDelay(0),
+		),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+
+	circuitAddrs := func() []ma.Multiaddr {
+		var addrs []ma.Multiaddr
+		for _, a := range h.Addrs() {
+			if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+				addrs = append(addrs, a)
+			}
+		}
+		return addrs
+	}
+	require.Eventually(t, func() bool { return len(circuitAddrs()) > 0 }, 10*time.Second, 100*time.Millisecond)
+	require.Contains(t, h.Peerstore().Addrs(r.ID()), uncertified)
+	for _, a := range circuitAddrs() {
+		require.False(t, strings.HasPrefix(a.String(), uncertified.String()), "advertised uncertified relay address %s", a)
+	}
+}
@@ -0,0 +1,225 @@
+package autorelay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+var (
+	// ErrRelayUnhealthy is the reason for losing a reservation with a relay that
+	// failed the health check, see WithRelayHealthCheck.
+	ErrRelayUnhealthy = errors.New("relay unhealthy")
+	// ErrReplacedByHigherPriorityRelay is the reason for losing a reservation that
+	// was dropped in favor of a reservation with a higher priority relay, see
+	// WithPrioritizedStaticRelays.
+	ErrReplacedByHigherPriorityRelay = errors.New("replaced by higher priority relay")
+)
+
+const healthCheckTimeout = 10 * time.Second
+
+// relayPriority returns the priority of relay p. Lower values mean higher priority.
+// Relays without a configured priority have the lowest priority.
+func (rf *relayFinder) relayPriority(p peer.ID) int {
+	if prio, ok := rf.conf.relayPriorities[p]; ok {
+		return prio
+	}
+	return len(rf.conf.relayPriorities)
+}
+
+// checkPrimaryRelay emits an EvtRelayFailover if we started using a different relay
+// as the highest priority relay. It does nothing unless relay priorities are configured.
+func (rf *relayFinder) checkPrimaryRelay() {
+	if len(rf.conf.relayPriorities) == 0 {
+		return
+	}
+
+	rf.relayMx.Lock()
+	var primary peer.ID
+	best := -1
+	for p := range rf.relays {
+		if prio := rf.relayPriority(p); best < 0 || prio < best {
+			primary, best = p, prio
+		}
+	}
+	prev := rf.primary
+	// Losing all reservations isn't a failover yet, but obtaining a reservation
+	// with a different relay afterwards is. Obtaining the very first one isn't.
+	changed := primary != "" && primary != prev && prev != ""
+	if primary != "" {
+		rf.primary = primary
+	}
+	rf.relayMx.Unlock()
+
+	if changed {
+		log.Debugw("relay failover", "from", prev, "to", primary)
+		rf.emitFailover.Emit(event.EvtRelayFailover{From: prev, To: primary})
+	}
+}
+
+// maybeSwitchToHigherPriorityRelay tries to obtain a reservation with a relay of
+// higher priority than the lowest priority relay in use, and drops the reservation
+// with the latter if successful. It returns true if the relays in use changed.
+func (rf *relayFinder) maybeSwitchToHigherPriorityRelay(ctx context.Context) bool {
+	if len(rf.conf.relayPriorities) == 0 {
+		return false
+	}
+
+	rf.relayMx.Lock()
+	if len(rf.relays) < rf.conf.desiredRelays {
+		// we're still looking for relays, maybeConnectToRelay picks the best ones
+		rf.relayMx.Unlock()
+		return false
+	}
+	var worst peer.ID
+	worstPrio := -1
+	for p := range rf.relays {
+		if prio := rf.relayPriority(p); prio > worstPrio {
+			worst, worstPrio = p, prio
+		}
+	}
+	rf.relayMx.Unlock()
+
+	rf.candidateMx.Lock()
+	var better []*candidate
+	for id, cand := range rf.candidates {
+		if rf.relayPriority(id) < worstPrio {
+			better = append(better, cand)
+		}
+	}
+	rf.candidateMx.Unlock()
+	sort.Slice(better, func(i, j int) bool {
+		return rf.relayPriority(better[i].ai.ID) < rf.relayPriority(better[j].ai.ID)
+	})
+
+	for _, cand := range better {
+		id := cand.ai.ID
+		rf.relayMx.Lock()
+		usingRelay := rf.usingRelay(id)
+		rf.relayMx.Unlock()
+		if usingRelay {
+			continue
+		}
+		rsvp, err := rf.connectToRelay(ctx, cand)
+		rf.metricsTracer.ReservationRequestFinished(false, err)
+		if err != nil {
+			log.Debugw("failed to connect to higher priority relay", "peer", id, "error", err)
+			continue
+		}
+
+		log.Debugw("switching to higher priority relay", "id", id, "replaced", worst)
+		rf.relayMx.Lock()
+		rf.relays[id] = rsvp
+		old, replaced := rf.relays[worst]
+		delete(rf.relays, worst)
+		delete(rf.expiringNotified, worst)
+		rf.relayMx.Unlock()
+
+		rf.host.ConnManager().Protect(id, autorelayTag)
+		rf.host.ConnManager().Unprotect(worst, autorelayTag)
+		rf.emitObtained.Emit(event.EvtRelayReservationObtained{Relay: id, Expiration: rsvp.Expiration})
+		if replaced {
+			rf.metricsTracer.ReservationEnded(1)
+			rf.emitLost.Emit(event.EvtRelayReservationLost{Relay: worst, Expiration: old.Expiration, Reason: ErrReplacedByHigherPriorityRelay})
+		}
+		rf.notifyMaybeNeedNewCandidates()
+		return true
+	}
+	return false
+}
+
+// dropUnhealthyRelays drops the reservations with relays with a round trip time
+// exceeding the maximum configured by WithRelayHealthCheck. It returns true if any
+// reservation was dropped.
+func (rf *relayFinder) dropUnhealthyRelays(ctx context.Context) bool {
+	if rf.conf.maxRelayRTT <= 0 {
+		return false
+	}
+
+	rf.relayMx.Lock()
+	relays := make([]peer.ID, 0, len(rf.relays))
+	for p := range rf.relays {
+		relays = append(relays, p)
+	}
+	rf.relayMx.Unlock()
+
+	var mx sync.Mutex
+	unhealthy := make(map[peer.ID]error)
+	var wg sync.WaitGroup
+	for _, p := range relays {
+		p := p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := rf.checkRelayHealth(ctx, p); err != nil {
+				mx.Lock()
+				unhealthy[p] = err
+				mx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var lost []event.EvtRelayReservationLost
+	now := rf.conf.clock.Now()
+	rf.relayMx.Lock()
+	for p, err := range unhealthy {
+		rsvp, ok := rf.relays[p]
+		if !ok {
+			continue
+		}
+		log.Debugw("dropping reservation with unhealthy relay", "relay", p, "error", err)
+		delete(rf.relays, p)
+		delete(rf.expiringNotified, p)
+		rf.host.ConnManager().Unprotect(p, autorelayTag)
+		lost = append(lost, event.EvtRelayReservationLost{Relay: p, Expiration: rsvp.Expiration, Reason: err})
+	}
+	rf.relayMx.Unlock()
+
+	if len(lost) == 0 {
+		return false
+	}
+	// don't immediately obtain a new reservation with the unhealthy relays
+	rf.candidateMx.Lock()
+	for _, evt := range lost {
+		rf.backoff[evt.Relay] = now
+		rf.removeCandidate(evt.Relay)
+	}
+	rf.candidateMx.Unlock()
+
+	for _, evt := range lost {
+		rf.metricsTracer.ReservationEnded(1)
+		rf.emitLost.Emit(evt)
+	}
+	rf.notifyMaybeConnectToRelay()
+	rf.notifyMaybeNeedNewCandidates()
+	return true
+}
+
+// checkRelayHealth measures the round trip time to relay p. If the relay doesn't
+// support the ping protocol, the latency recorded in the peerstore is used.
+func (rf *relayFinder) checkRelayHealth(ctx context.Context, p peer.ID) error {
+	var rtt time.Duration
+	if protos, err := rf.host.Peerstore().SupportsProtocols(p, ping.ID); err == nil && len(protos) > 0 {
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+		res := <-ping.Ping(ctx, rf.host, p)
+		if res.Error != nil {
+			return fmt.Errorf("%w: ping failed: %s", ErrRelayUnhealthy, res.Error)
+		}
+		rtt = res.RTT
+	} else {
+		rtt = rf.host.Peerstore().LatencyEWMA(p)
+	}
+	if rtt > rf.conf.maxRelayRTT {
+		return fmt.Errorf("%w: rtt %s exceeds %s", ErrRelayUnhealthy, rtt, rf.conf.maxRelayRTT)
+	}
+	return nil
+}
@@ -14,6 +14,11 @@ func (h *AutoRelayHost) Close() error {
 	return h.Host.Close()
 }
 
+// Unwrap returns the wrapped host.
+func (h *AutoRelayHost) Unwrap() host.Host {
+	return h.Host
+}
+
 func (h *AutoRelayHost) Start() {
 	h.ar.Start()
 }
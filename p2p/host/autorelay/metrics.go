@@ -2,6 +2,7 @@ package autorelay
 
 import (
 	"errors"
+	"time"
 
 	"github.com/libp2p/go-libp2p/p2p/metricshelper"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
@@ -40,6 +41,21 @@ var (
 		[]string{"request_type", "outcome"},
 	)
 
+	reservationsCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "reservations_count",
+			Help:      "Current Reservations",
+		},
+	)
+	nextReservationExpiry = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "next_reservation_expiry",
+			Help:      "Expiration Time of the Next Reservation to Expire",
+		},
+	)
+
 	relayAddressesUpdatedTotal = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: metricNamespace,
@@ -71,6 +87,13 @@ var (
 		},
 		[]string{"type"},
 	)
+	candidatesCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "candidates_count",
+			Help:      "Current Candidates",
+		},
+	)
 	candLoopState = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: metricNamespace,
@@ -101,10 +124,13 @@ var (
 		reservationsOpenedTotal,
 		reservationsClosedTotal,
 		reservationRequestsOutcomeTotal,
+		reservationsCount,
+		nextReservationExpiry,
 		relayAddressesUpdatedTotal,
 		relayAddressesCount,
 		candidatesCircuitV2SupportTotal,
 		candidatesTotal,
+		candidatesCount,
 		candLoopState,
 		scheduledWorkTime,
 		desiredReservations,
@@ -127,6 +153,7 @@ type MetricsTracer interface {
 	ReservationEnded(cnt int)
 	ReservationOpened(cnt int)
 	ReservationRequestFinished(isRefresh bool, err error)
+	NextReservationExpiry(t time.Time)
 
 	RelayAddressCount(int)
 	RelayAddressUpdated()
@@ -185,10 +212,12 @@ func (mt *metricsTracer) RelayFinderStatus(isActive bool) {
 
 func (mt *metricsTracer) ReservationEnded(cnt int) {
 	reservationsClosedTotal.Add(float64(cnt))
+	reservationsCount.Sub(float64(cnt))
 }
 
 func (mt *metricsTracer) ReservationOpened(cnt int) {
 	reservationsOpenedTotal.Add(float64(cnt))
+	reservationsCount.Add(float64(cnt))
 }
 
 func (mt *metricsTracer) ReservationRequestFinished(isRefresh bool, err error) {
@@ -205,7 +234,16 @@ func (mt *metricsTracer) ReservationRequestFinished(isRefresh bool, err error) {
 
 	if !isRefresh && err == nil {
 		reservationsOpenedTotal.Inc()
+		reservationsCount.Inc()
+	}
+}
+
+func (mt *metricsTracer) NextReservationExpiry(t time.Time) {
+	if t.IsZero() {
+		nextReservationExpiry.Set(0)
+		return
 	}
+	nextReservationExpiry.Set(float64(t.Unix()))
 }
 
 func (mt *metricsTracer) RelayAddressUpdated() {
@@ -232,6 +270,7 @@ func (mt *metricsTracer) CandidateAdded(cnt int) {
 	defer metricshelper.PutStringSlice(tags)
 	*tags = append(*tags, "added")
 	candidatesTotal.WithLabelValues(*tags...).Add(float64(cnt))
+	candidatesCount.Add(float64(cnt))
 }
 
 func (mt *metricsTracer) CandidateRemoved(cnt int) {
@@ -239,6 +278,7 @@ func (mt *metricsTracer) CandidateRemoved(cnt int) {
 	defer metricshelper.PutStringSlice(tags)
 	*tags = append(*tags, "removed")
 	candidatesTotal.WithLabelValues(*tags...).Add(float64(cnt))
+	candidatesCount.Sub(float64(cnt))
 }
 
 func (mt *metricsTracer) CandidateLoopState(state candidateLoopState) {
@@ -324,6 +364,12 @@ func (mt *wrappedMetricsTracer) ReservationRequestFinished(isRefresh bool, err e
 	}
 }
 
+func (mt *wrappedMetricsTracer) NextReservationExpiry(t time.Time) {
+	if mt.mt != nil {
+		mt.mt.NextReservationExpiry(t)
+	}
+}
+
 func (mt *wrappedMetricsTracer) RelayAddressUpdated() {
 	if mt.mt != nil {
 		mt.mt.RelayAddressUpdated()
@@ -42,6 +42,7 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 		"RelayAddressCount":          func() { tr.RelayAddressCount(rand.Intn(10)) },
 		"RelayAddressUpdated":        func() { tr.RelayAddressUpdated() },
 		"ReservationOpened":          func() { tr.ReservationOpened(rand.Intn(10)) },
+		"NextReservationExpiry":      func() { tr.NextReservationExpiry(time.Unix(int64(rand.Intn(1000)), 0)) },
 		"CandidateChecked":           func() { tr.CandidateChecked(rand.Intn(2) == 1) },
 		"CandidateAdded":             func() { tr.CandidateAdded(rand.Intn(10)) },
 		"CandidateRemoved":           func() { tr.CandidateRemoved(rand.Intn(10)) },
@@ -23,7 +23,7 @@ type PeerSource func(ctx context.Context, num int) <-chan peer.AddrInfo
 
 type config struct {
 	clock      ClockWithInstantTimer
-	peerSource PeerSource
+	peerSource CandidateSource
 	// minimum interval used to call the peerSource callback
 	minInterval time.Duration
 	// see WithMinCandidates
@@ -42,6 +42,19 @@ type config struct {
 	setMinCandidates bool
 	// see WithMetricsTracer
 	metricsTracer MetricsTracer
+	// see WithRenewalPolicy
+	renewalPolicy RenewalPolicy
+	// see WithCandidateScorer
+	scorer CandidateScorer
+	// see WithPrioritizedStaticRelays
+	relayPriorities map[peer.ID]int
+	// see WithRelayHealthCheck
+	maxRelayRTT time.Duration
+	// see WithCircuitAddrPolicy
+	circuitAddrPolicy CircuitAddrPolicy
+	circuitAddrPeers  map[peer.ID]struct{}
+	// see WithCertifiedRelayAddrs
+	certifiedRelayAddrs bool
 }
 
 var defaultConfig = config{
@@ -56,7 +69,7 @@ var defaultConfig = config{
 }
 
 var (
-	errAlreadyHavePeerSource = errors.New("can only use a single WithPeerSource or WithStaticRelays")
+	errAlreadyHavePeerSource = errors.New("can only use a single WithPeerSource, WithCandidateSource or WithStaticRelays")
 )
 
 type Option func(*config) error
@@ -67,33 +80,125 @@ func WithStaticRelays(static []peer.AddrInfo) Option {
 			return errAlreadyHavePeerSource
 		}
 
-		WithPeerSource(func(ctx context.Context, numPeers int) <-chan peer.AddrInfo {
-			if len(static) < numPeers {
-				numPeers = len(static)
-			}
-			c := make(chan peer.AddrInfo, numPeers)
-			defer close(c)
+		c.peerSource = StaticCandidateSource(static)
+		WithMinCandidates(len(static))(c)
+		WithMaxCandidates(len(static))(c)
+		WithNumRelays(len(static))(c)
+
+		return nil
+	}
+}
+
+// WithPrioritizedStaticRelays configures static relays, ordered from the highest to the
+// lowest priority, and sets the number of relays we strive to obtain reservations with.
+//
+// AutoRelay obtains reservations with the highest priority relays available. When
+// a reservation is lost, it fails over to the next relay by priority, and switches
+// back to a higher priority relay once it is available again. An
+// event.EvtRelayFailover is emitted when the highest priority relay in use changes.
+func WithPrioritizedStaticRelays(static []peer.AddrInfo, numRelays int) Option {
+	return func(c *config) error {
+		if c.peerSource != nil {
+			return errAlreadyHavePeerSource
+		}
 
-			for i := 0; i < numPeers; i++ {
-				c <- static[i]
+		c.peerSource = StaticCandidateSource(static)
+		c.relayPriorities = make(map[peer.ID]int, len(static))
+		for i, ai := range static {
+			if _, ok := c.relayPriorities[ai.ID]; !ok {
+				c.relayPriorities[ai.ID] = i
 			}
-			return c
-		})(c)
+		}
 		WithMinCandidates(len(static))(c)
 		WithMaxCandidates(len(static))(c)
-		WithNumRelays(len(static))(c)
+		WithNumRelays(numRelays)(c)
+
+		return nil
+	}
+}
+
+// WithRelayHealthCheck makes AutoRelay check the health of the relays it holds
+// reservations with every time it refreshes reservations. Besides being able to
+// refresh the reservation, the round trip time to a healthy relay must not exceed
+// maxRTT. Reservations with unhealthy relays are dropped, and AutoRelay looks for
+// other relays.
+func WithRelayHealthCheck(maxRTT time.Duration) Option {
+	return func(c *config) error {
+		c.maxRelayRTT = maxRTT
+		return nil
+	}
+}
 
+// CircuitAddrPolicy controls when AutoRelay advertises relay (/p2p-circuit) addresses.
+type CircuitAddrPolicy int
+
+const (
+	// CircuitAddrsWhenPrivate advertises relay addresses instead of the public
+	// addresses while the node isn't publicly reachable. This is the default.
+	CircuitAddrsWhenPrivate CircuitAddrPolicy = iota
+	// CircuitAddrsAlways always advertises relay addresses. AutoRelay keeps its
+	// reservations when the node is publicly reachable, and advertises the relay
+	// addresses in addition to the public addresses.
+	CircuitAddrsAlways
+	// CircuitAddrsNever never advertises relay addresses, e.g. for gateways that must
+	// not attract relayed traffic. AutoRelay still obtains reservations while the node
+	// isn't publicly reachable.
+	CircuitAddrsNever
+	// CircuitAddrsToPeers works like CircuitAddrsWhenPrivate, but relay addresses are
+	// only disclosed to the peers passed to WithCircuitAddrPolicy in identify.
+	CircuitAddrsToPeers
+)
+
+// WithCircuitAddrPolicy sets the policy that controls when relay addresses are
+// advertised. The peers are only used by CircuitAddrsToPeers.
+func WithCircuitAddrPolicy(policy CircuitAddrPolicy, peers ...peer.ID) Option {
+	return func(c *config) error {
+		c.circuitAddrPolicy = policy
+		c.circuitAddrPeers = make(map[peer.ID]struct{}, len(peers))
+		for _, p := range peers {
+			c.circuitAddrPeers[p] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithCertifiedRelayAddrs makes AutoRelay build relay addresses only on the addresses of
+// the relays that are certified by their signed peer records, so that no uncertified
+// address is advertised. It is used by strict signed peer record mode.
+func WithCertifiedRelayAddrs() Option {
+	return func(c *config) error {
+		c.certifiedRelayAddrs = true
 		return nil
 	}
 }
 
 // WithPeerSource defines a callback for AutoRelay to query for more relay candidates.
 func WithPeerSource(f PeerSource) Option {
+	if f == nil {
+		return WithCandidateSource(nil)
+	}
+	return WithCandidateSource(f)
+}
+
+// WithCandidateSource sets the source AutoRelay queries for more relay candidates.
+// See StaticCandidateSource, DiscoveryCandidateSource and PeerstoreCandidateSource for
+// the built-in sources.
+func WithCandidateSource(src CandidateSource) Option {
 	return func(c *config) error {
 		if c.peerSource != nil {
 			return errAlreadyHavePeerSource
 		}
-		c.peerSource = f
+		c.peerSource = src
+		return nil
+	}
+}
+
+// WithCandidateScorer sets the scorer used to decide which candidates AutoRelay tries
+// to obtain reservations with first, e.g. LowLatencyScorer. By default, candidates are
+// tried in random order.
+func WithCandidateScorer(scorer CandidateScorer) Option {
+	return func(c *config) error {
+		c.scorer = scorer
 		return nil
 	}
 }
@@ -224,6 +329,24 @@ func WithMinInterval(interval time.Duration) Option {
 	}
 }
 
+// RenewalPolicy decides whether the reservation with relay, which expires at
+// expiration, is renewed now. expiring reports whether the reservation is about to
+// expire. AutoRelay consults the policy for every reservation once a minute.
+//
+// Returning false for an expiring reservation lets it expire, after which AutoRelay
+// looks for another relay. Returning true for a reservation that isn't expiring renews
+// it early. The policy must return quickly.
+type RenewalPolicy func(relay peer.ID, expiration time.Time, expiring bool) bool
+
+// WithRenewalPolicy sets the policy for renewing reservations. By default, reservations
+// are renewed when they're about to expire.
+func WithRenewalPolicy(p RenewalPolicy) Option {
+	return func(c *config) error {
+		c.renewalPolicy = p
+		return nil
+	}
+}
+
 // WithMetricsTracer configures autorelay to use mt to track metrics
 func WithMetricsTracer(mt MetricsTracer) Option {
 	return func(c *config) error {
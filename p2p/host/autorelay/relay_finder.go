@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
 	basic "github.com/libp2p/go-libp2p/p2p/host/basic"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
 	circuitv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
@@ -56,11 +58,13 @@ type relayFinder struct {
 	ctxCancel   context.CancelFunc
 	ctxCancelMx sync.Mutex
 
-	peerSource PeerSource
+	peerSource CandidateSource
 
 	candidateFound             chan struct{} // receives every time we find a new relay candidate
 	candidateMx                sync.Mutex
 	candidates                 map[peer.ID]*candidate
+	candidatesAdded            int
+	candidatesRemoved          int
 	backoff                    map[peer.ID]time.Time
 	maybeConnectToRelayTrigger chan struct{} // cap: 1
 	// Any time _something_ hapens that might cause us to need new candidates.
@@ -74,6 +78,12 @@ type relayFinder struct {
 
 	relayMx sync.Mutex
 	relays  map[peer.ID]*circuitv2.Reservation
+	// expiringNotified holds the expiration times of the reservations for which an
+	// EvtRelayReservationExpiring was emitted.
+	expiringNotified map[peer.ID]time.Time
+	// primary is the highest priority relay in use, or last in use if we don't hold
+	// any reservation, see WithPrioritizedStaticRelays.
+	primary peer.ID
 
 	cachedAddrs       []ma.Multiaddr
 	cachedAddrsExpiry time.Time
@@ -81,16 +91,31 @@ type relayFinder struct {
 	// A channel that triggers a run of `runScheduledWork`.
 	triggerRunScheduledWork chan struct{}
 	metricsTracer           MetricsTracer
+
+	emitObtained event.Emitter
+	emitRenewed  event.Emitter
+	emitExpiring event.Emitter
+	emitLost     event.Emitter
+	emitFailover event.Emitter
 }
 
 var errAlreadyRunning = errors.New("relayFinder already running")
 
-func newRelayFinder(host *basic.BasicHost, peerSource PeerSource, conf *config) *relayFinder {
+var (
+	// ErrRelayDisconnected is the reason for losing a reservation because we
+	// disconnected from the relay.
+	ErrRelayDisconnected = errors.New("disconnected from relay")
+	// ErrReservationExpired is the reason for losing a reservation that expired
+	// without being renewed.
+	ErrReservationExpired = errors.New("reservation expired")
+)
+
+func newRelayFinder(host *basic.BasicHost, peerSource CandidateSource, conf *config) (*relayFinder, error) {
 	if peerSource == nil {
 		panic("Can not create a new relayFinder. Need a Peer Source fn or a list of static relays. Refer to the documentation around `libp2p.EnableAutoRelay`")
 	}
 
-	return &relayFinder{
+	rf := &relayFinder{
 		bootTime:                   conf.clock.Now(),
 		host:                       host,
 		conf:                       conf,
@@ -102,9 +127,41 @@ func newRelayFinder(host *basic.BasicHost, peerSource PeerSource, conf *config)
 		maybeRequestNewCandidates:  make(chan struct{}, 1),
 		triggerRunScheduledWork:    make(chan struct{}, 1),
 		relays:                     make(map[peer.ID]*circuitv2.Reservation),
+		expiringNotified:           make(map[peer.ID]time.Time),
 		relayUpdated:               make(chan struct{}, 1),
 		metricsTracer:              &wrappedMetricsTracer{conf.metricsTracer},
 	}
+
+	var err error
+	bus := host.EventBus()
+	if rf.emitObtained, err = bus.Emitter(new(event.EvtRelayReservationObtained)); err != nil {
+		return nil, err
+	}
+	if rf.emitRenewed, err = bus.Emitter(new(event.EvtRelayReservationRenewed)); err != nil {
+		rf.closeEmitters()
+		return nil, err
+	}
+	if rf.emitExpiring, err = bus.Emitter(new(event.EvtRelayReservationExpiring)); err != nil {
+		rf.closeEmitters()
+		return nil, err
+	}
+	if rf.emitLost, err = bus.Emitter(new(event.EvtRelayReservationLost)); err != nil {
+		rf.closeEmitters()
+		return nil, err
+	}
+	if rf.emitFailover, err = bus.Emitter(new(event.EvtRelayFailover)); err != nil {
+		rf.closeEmitters()
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *relayFinder) closeEmitters() {
+	for _, em := range []event.Emitter{rf.emitObtained, rf.emitRenewed, rf.emitExpiring, rf.emitLost, rf.emitFailover} {
+		if em != nil {
+			em.Close()
+		}
+	}
 }
 
 type scheduledWorkTimes struct {
@@ -174,21 +231,22 @@ func (rf *relayFinder) background(ctx context.Context) {
 			if evt.Connectedness != network.NotConnected {
 				continue
 			}
-			push := false
-
 			rf.relayMx.Lock()
-			if rf.usingRelay(evt.Peer) { // we were disconnected from a relay
+			rsvp, push := rf.relays[evt.Peer]
+			if push { // we were disconnected from a relay
 				log.Debugw("disconnected from relay", "id", evt.Peer)
 				delete(rf.relays, evt.Peer)
+				delete(rf.expiringNotified, evt.Peer)
 				rf.notifyMaybeConnectToRelay()
 				rf.notifyMaybeNeedNewCandidates()
-				push = true
 			}
 			rf.relayMx.Unlock()
 
 			if push {
 				rf.clearCachedAddrsAndSignalAddressChange()
 				rf.metricsTracer.ReservationEnded(1)
+				rf.emitLost.Emit(event.EvtRelayReservationLost{Relay: evt.Peer, Expiration: rsvp.Expiration, Reason: ErrRelayDisconnected})
+				rf.checkPrimaryRelay()
 			}
 		case <-rf.candidateFound:
 			rf.notifyMaybeConnectToRelay()
@@ -225,8 +283,16 @@ func (rf *relayFinder) runScheduledWork(ctx context.Context, now time.Time, sche
 
 	if now.After(scheduledWork.nextRefresh) {
 		scheduledWork.nextRefresh = now.Add(rsvpRefreshInterval)
-		if rf.refreshReservations(ctx, now) {
+		changed := rf.refreshReservations(ctx, now)
+		if rf.dropUnhealthyRelays(ctx) {
+			changed = true
+		}
+		if rf.maybeSwitchToHigherPriorityRelay(ctx) {
+			changed = true
+		}
+		if changed {
 			rf.clearCachedAddrsAndSignalAddressChange()
+			rf.checkPrimaryRelay()
 		}
 	}
 
@@ -270,6 +336,7 @@ func (rf *relayFinder) runScheduledWork(ctx context.Context, now time.Time, sche
 	}
 
 	rf.metricsTracer.ScheduledWorkUpdated(scheduledWork)
+	rf.updateReservationExpiryMetric()
 
 	return nextTime
 }
@@ -342,7 +409,7 @@ func (rf *relayFinder) findNodes(ctx context.Context, peerSourceRateLimiter <-ch
 
 			select {
 			case <-peerSourceRateLimiter:
-				peerChan = rf.peerSource(ctx, rf.conf.maxCandidates)
+				peerChan = rf.peerSource.Candidates(ctx, rf.host, rf.conf.maxCandidates)
 				select {
 				case rf.triggerRunScheduledWork <- struct{}{}:
 				default:
@@ -577,11 +644,14 @@ func (rf *relayFinder) maybeConnectToRelay(ctx context.Context) {
 		}
 
 		rf.metricsTracer.ReservationRequestFinished(false, nil)
+		rf.updateReservationExpiryMetric()
+		rf.emitObtained.Emit(event.EvtRelayReservationObtained{Relay: id, Expiration: rsvp.Expiration})
 
 		if numRelays >= rf.conf.desiredRelays {
 			break
 		}
 	}
+	rf.checkPrimaryRelay()
 }
 
 func (rf *relayFinder) connectToRelay(ctx context.Context, cand *candidate) (*circuitv2.Reservation, error) {
@@ -621,13 +691,50 @@ func (rf *relayFinder) connectToRelay(ctx context.Context, cand *candidate) (*ci
 func (rf *relayFinder) refreshReservations(ctx context.Context, now time.Time) bool {
 	rf.relayMx.Lock()
 
-	// find reservations about to expire and refresh them in parallel
-	g := new(errgroup.Group)
+	// find reservations about to expire, and those the renewal policy asks us to renew
+	var refresh []peer.ID
+	var expiring []event.EvtRelayReservationExpiring
+	var expired []event.EvtRelayReservationLost
 	for p, rsvp := range rf.relays {
-		if now.Add(rsvpExpirationSlack).Before(rsvp.Expiration) {
+		isExpiring := !now.Add(rsvpExpirationSlack).Before(rsvp.Expiration)
+		if isExpiring && !rf.expiringNotified[p].Equal(rsvp.Expiration) {
+			rf.expiringNotified[p] = rsvp.Expiration
+			expiring = append(expiring, event.EvtRelayReservationExpiring{Relay: p, Expiration: rsvp.Expiration})
+		}
+
+		renew := isExpiring
+		if rf.conf.renewalPolicy != nil {
+			renew = rf.conf.renewalPolicy(p, rsvp.Expiration, isExpiring)
+		}
+		if renew {
+			refresh = append(refresh, p)
 			continue
 		}
+		if !now.Before(rsvp.Expiration) {
+			log.Debugw("relay slot reservation expired", "relay", p)
+			delete(rf.relays, p)
+			delete(rf.expiringNotified, p)
+			rf.host.ConnManager().Unprotect(p, autorelayTag)
+			expired = append(expired, event.EvtRelayReservationLost{Relay: p, Expiration: rsvp.Expiration, Reason: ErrReservationExpired})
+		}
+	}
+	rf.relayMx.Unlock()
+
+	for _, evt := range expiring {
+		rf.emitExpiring.Emit(evt)
+	}
+	for _, evt := range expired {
+		rf.metricsTracer.ReservationEnded(1)
+		rf.emitLost.Emit(evt)
+	}
+	if len(expired) > 0 {
+		rf.notifyMaybeConnectToRelay()
+		rf.notifyMaybeNeedNewCandidates()
+	}
 
+	// refresh them in parallel
+	g := new(errgroup.Group)
+	for _, p := range refresh {
 		p := p
 		g.Go(func() error {
 			err := rf.refreshRelayReservation(ctx, p)
@@ -636,10 +743,9 @@ func (rf *relayFinder) refreshReservations(ctx context.Context, now time.Time) b
 			return err
 		})
 	}
-	rf.relayMx.Unlock()
 
 	err := g.Wait()
-	return err != nil
+	return err != nil || len(expired) > 0
 }
 
 func (rf *relayFinder) refreshRelayReservation(ctx context.Context, p peer.ID) error {
@@ -648,20 +754,24 @@ func (rf *relayFinder) refreshRelayReservation(ctx context.Context, p peer.ID) e
 	rf.relayMx.Lock()
 	if err != nil {
 		log.Debugw("failed to refresh relay slot reservation", "relay", p, "error", err)
-		_, exists := rf.relays[p]
+		old, exists := rf.relays[p]
 		delete(rf.relays, p)
+		delete(rf.expiringNotified, p)
 		// unprotect the connection
 		rf.host.ConnManager().Unprotect(p, autorelayTag)
 		rf.relayMx.Unlock()
 		if exists {
 			rf.metricsTracer.ReservationEnded(1)
+			rf.emitLost.Emit(event.EvtRelayReservationLost{Relay: p, Expiration: old.Expiration, Reason: err})
 		}
 		return err
 	}
 
 	log.Debugw("refreshed relay slot reservation", "relay", p)
 	rf.relays[p] = rsvp
+	delete(rf.expiringNotified, p)
 	rf.relayMx.Unlock()
+	rf.emitRenewed.Emit(event.EvtRelayReservationRenewed{Relay: p, Expiration: rsvp.Expiration})
 	return nil
 }
 
@@ -676,6 +786,7 @@ func (rf *relayFinder) addCandidate(cand *candidate) {
 	_, exists := rf.candidates[cand.ai.ID]
 	rf.candidates[cand.ai.ID] = cand
 	if !exists {
+		rf.candidatesAdded++
 		rf.metricsTracer.CandidateAdded(1)
 	}
 }
@@ -684,6 +795,7 @@ func (rf *relayFinder) removeCandidate(id peer.ID) {
 	_, exists := rf.candidates[id]
 	if exists {
 		delete(rf.candidates, id)
+		rf.candidatesRemoved++
 		rf.metricsTracer.CandidateRemoved(1)
 	}
 }
@@ -699,11 +811,23 @@ func (rf *relayFinder) selectCandidates() []*candidate {
 		}
 	}
 
-	// TODO: better relay selection strategy; this just selects random relays,
-	// but we should probably use ping latency as the selection metric
 	rand.Shuffle(len(candidates), func(i, j int) {
 		candidates[i], candidates[j] = candidates[j], candidates[i]
 	})
+	if rf.conf.scorer != nil {
+		scores := make(map[peer.ID]float64, len(candidates))
+		for _, cand := range candidates {
+			scores[cand.ai.ID] = rf.conf.scorer(rf.host, cand.ai)
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return scores[candidates[i].ai.ID] > scores[candidates[j].ai.ID]
+		})
+	}
+	if len(rf.conf.relayPriorities) > 0 {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return rf.relayPriority(candidates[i].ai.ID) < rf.relayPriority(candidates[j].ai.ID)
+		})
+	}
 	return candidates
 }
 
@@ -715,14 +839,8 @@ func (rf *relayFinder) selectCandidates() []*candidate {
 //     connected. For each non-private relay addr, we encapsulate the p2p-circuit addr
 //     through which we can be dialed.
 func (rf *relayFinder) relayAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
-	rf.relayMx.Lock()
-	defer rf.relayMx.Unlock()
-
-	if rf.cachedAddrs != nil && rf.conf.clock.Now().Before(rf.cachedAddrsExpiry) {
-		return rf.cachedAddrs
-	}
-
-	raddrs := make([]ma.Multiaddr, 0, 4*len(rf.relays)+4)
+	circuitAddrs := rf.circuitAddrs()
+	raddrs := make([]ma.Multiaddr, 0, len(circuitAddrs)+4)
 
 	// only keep private addrs from the original addr set
 	for _, addr := range addrs {
@@ -732,9 +850,22 @@ func (rf *relayFinder) relayAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	}
 
 	// add relay specific addrs to the list
+	return append(raddrs, circuitAddrs...)
+}
+
+// circuitAddrs returns the relay specific addrs of the relays to which we are connected.
+func (rf *relayFinder) circuitAddrs() []ma.Multiaddr {
+	rf.relayMx.Lock()
+	defer rf.relayMx.Unlock()
+
+	if rf.cachedAddrs != nil && rf.conf.clock.Now().Before(rf.cachedAddrsExpiry) {
+		return rf.cachedAddrs
+	}
+
+	raddrs := make([]ma.Multiaddr, 0, 4*len(rf.relays))
 	relayAddrCnt := 0
 	for p := range rf.relays {
-		addrs := cleanupAddressSet(rf.host.Peerstore().Addrs(p))
+		addrs := rf.relayPeerAddrs(p)
 		relayAddrCnt += len(addrs)
 		circuit := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit", p.Pretty()))
 		for _, addr := range addrs {
@@ -750,6 +881,43 @@ func (rf *relayFinder) relayAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	return raddrs
 }
 
+// relayPeerAddrs returns the addresses of relay p on which relay addresses can be built.
+func (rf *relayFinder) relayPeerAddrs(p peer.ID) []ma.Multiaddr {
+	addrs := rf.host.Peerstore().Addrs(p)
+	if rf.conf.certifiedRelayAddrs {
+		addrs = certifiedAddrs(rf.host.Peerstore(), p, addrs)
+	}
+	return cleanupAddressSet(addrs)
+}
+
+// certifiedAddrs returns the addresses of addrs that are contained in the signed peer
+// record of p.
+func certifiedAddrs(ps peerstore.Peerstore, p peer.ID, addrs []ma.Multiaddr) []ma.Multiaddr {
+	cab, ok := peerstore.GetCertifiedAddrBook(ps)
+	if !ok {
+		return nil
+	}
+	env := cab.GetPeerRecord(p)
+	if env == nil {
+		return nil
+	}
+	rec, err := env.Record()
+	if err != nil {
+		return nil
+	}
+	pr, ok := rec.(*peer.PeerRecord)
+	if !ok {
+		return nil
+	}
+	certified := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if ma.Contains(pr.Addrs, a) {
+			certified = append(certified, a)
+		}
+	}
+	return certified
+}
+
 func (rf *relayFinder) Start() error {
 	rf.ctxCancelMx.Lock()
 	defer rf.ctxCancelMx.Unlock()
@@ -807,4 +975,23 @@ func (rf *relayFinder) resetMetrics() {
 
 	rf.metricsTracer.RelayAddressCount(0)
 	rf.metricsTracer.ScheduledWorkUpdated(&scheduledWorkTimes{})
+	rf.metricsTracer.NextReservationExpiry(time.Time{})
+}
+
+func (rf *relayFinder) updateReservationExpiryMetric() {
+	var next time.Time
+	rf.relayMx.Lock()
+	for _, rsvp := range rf.relays {
+		if next.IsZero() || rsvp.Expiration.Before(next) {
+			next = rsvp.Expiration
+		}
+	}
+	rf.relayMx.Unlock()
+	rf.metricsTracer.NextReservationExpiry(next)
+}
+
+func (rf *relayFinder) isRunning() bool {
+	rf.ctxCancelMx.Lock()
+	defer rf.ctxCancelMx.Unlock()
+	return rf.ctxCancel != nil
 }
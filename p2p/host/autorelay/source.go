@@ -0,0 +1,147 @@
+package autorelay
+
+import (
+	"context"
+	"math"
+	"math/rand"
+
+	"github.com/libp2p/go-libp2p/core/discovery"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+)
+
+// RelayNamespace is the rendezvous namespace relays advertise themselves in, and
+// RoutingCandidateSource looks for relays in.
+const RelayNamespace = "/libp2p/relay"
+
+// CandidateSource provides AutoRelay with relay candidates.
+//
+// AutoRelay calls Candidates when it needs new candidates, with the same contract as
+// a PeerSource: implementations must send *at most* num peers, and close the channel
+// when they don't intend to provide any more peers. h is the host AutoRelay runs on.
+type CandidateSource interface {
+	Candidates(ctx context.Context, h host.Host, num int) <-chan peer.AddrInfo
+}
+
+// Candidates implements CandidateSource.
+func (f PeerSource) Candidates(ctx context.Context, _ host.Host, num int) <-chan peer.AddrInfo {
+	return f(ctx, num)
+}
+
+type staticSource []peer.AddrInfo
+
+// StaticCandidateSource returns a CandidateSource which provides the given relays.
+func StaticCandidateSource(static []peer.AddrInfo) CandidateSource {
+	return staticSource(static)
+}
+
+func (s staticSource) Candidates(_ context.Context, _ host.Host, num int) <-chan peer.AddrInfo {
+	return sendCandidates(s, num)
+}
+
+// sendCandidates returns a closed channel containing the first num candidates.
+func sendCandidates(candidates []peer.AddrInfo, num int) <-chan peer.AddrInfo {
+	if len(candidates) < num {
+		num = len(candidates)
+	}
+	c := make(chan peer.AddrInfo, num)
+	defer close(c)
+
+	for i := 0; i < num; i++ {
+		c <- candidates[i]
+	}
+	return c
+}
+
+type discoverySource struct {
+	d  discovery.Discoverer
+	ns string
+}
+
+// DiscoveryCandidateSource returns a CandidateSource which finds relays by looking up
+// peers in the namespace ns using d, e.g. a routing discovery backed by the DHT.
+func DiscoveryCandidateSource(d discovery.Discoverer, ns string) CandidateSource {
+	return &discoverySource{d: d, ns: ns}
+}
+
+func (s *discoverySource) Candidates(ctx context.Context, h host.Host, num int) <-chan peer.AddrInfo {
+	c := make(chan peer.AddrInfo, num)
+	peers, err := s.d.FindPeers(ctx, s.ns, discovery.Limit(num))
+	if err != nil {
+		log.Debugw("failed to find relay candidates", "namespace", s.ns, "error", err)
+		close(c)
+		return c
+	}
+	go func() {
+		defer close(c)
+		for sent := 0; sent < num; {
+			select {
+			case pi, ok := <-peers:
+				if !ok {
+					return
+				}
+				if pi.ID == h.ID() {
+					continue
+				}
+				select {
+				case c <- pi:
+					sent++
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// RoutingCandidateSource returns a CandidateSource which finds the relays that
+// advertise themselves in RelayNamespace using r, e.g. the DHT.
+func RoutingCandidateSource(r routing.ContentRouting) CandidateSource {
+	return DiscoveryCandidateSource(drouting.NewRoutingDiscovery(r), RelayNamespace)
+}
+
+type peerstoreSource struct{}
+
+// PeerstoreCandidateSource returns a CandidateSource which provides the peers in the
+// host's peerstore that are known to support the circuit v2 hop protocol.
+func PeerstoreCandidateSource() CandidateSource {
+	return peerstoreSource{}
+}
+
+func (peerstoreSource) Candidates(_ context.Context, h host.Host, num int) <-chan peer.AddrInfo {
+	ps := h.Peerstore()
+	var candidates []peer.AddrInfo
+	for _, p := range ps.PeersWithAddrs() {
+		if p == h.ID() {
+			continue
+		}
+		if protos, err := ps.SupportsProtocols(p, protoIDv2); err != nil || len(protos) == 0 {
+			continue
+		}
+		candidates = append(candidates, ps.PeerInfo(p))
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return sendCandidates(candidates, num)
+}
+
+// CandidateScorer scores relay candidates. AutoRelay tries to obtain reservations with
+// the candidates with the highest score first. Candidates with the same score are tried
+// in random order.
+type CandidateScorer func(h host.Host, ai peer.AddrInfo) float64
+
+// LowLatencyScorer is a CandidateScorer that prefers the candidates with the lowest
+// latency, as measured by the host. Candidates of unknown latency are tried last.
+func LowLatencyScorer(h host.Host, ai peer.AddrInfo) float64 {
+	latency := h.Peerstore().LatencyEWMA(ai.ID)
+	if latency == 0 {
+		return math.Inf(-1)
+	}
+	return -latency.Seconds()
+}
@@ -0,0 +1,76 @@
+package autorelay
+
+import (
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Status is a snapshot of the state of AutoRelay.
+type Status struct {
+	// Reachability is the last reachability of the node AutoRelay was notified of.
+	Reachability network.Reachability
+	// Active is true if AutoRelay is currently looking for relays and keeping
+	// reservations, which is the case while the node isn't publicly reachable.
+	Active bool
+	// Relays are the relays we currently hold reservations with, sorted by peer ID.
+	Relays []RelayStatus
+	// Candidates is the current size of the relay candidate pool.
+	Candidates int
+	// CandidatesAdded and CandidatesRemoved count the candidates that were added to
+	// and removed from the pool since AutoRelay was created.
+	CandidatesAdded   int
+	CandidatesRemoved int
+}
+
+// RelayStatus describes a reservation with a relay.
+type RelayStatus struct {
+	// ID is the ID of the relay.
+	ID peer.ID
+	// Expiration is the time the reservation expires unless it is renewed.
+	Expiration time.Time
+	// Voucher is the signed reservation voucher provided by the relay, if any. It can
+	// be presented to third parties as a proof of the reservation, see
+	// proto.VerifyVoucher.
+	Voucher []byte
+}
+
+// Status returns a snapshot of the current state of AutoRelay: the relays in use,
+// the expiration times of their reservations and the relay candidate pool.
+func (r *AutoRelay) Status() Status {
+	r.mx.Lock()
+	reachability := r.status
+	r.mx.Unlock()
+
+	s := r.relayFinder.status()
+	s.Reachability = reachability
+	return s
+}
+
+// Status returns a snapshot of the current state of AutoRelay. See AutoRelay.Status.
+func (h *AutoRelayHost) Status() Status {
+	return h.ar.Status()
+}
+
+func (rf *relayFinder) status() Status {
+	s := Status{Active: rf.isRunning()}
+
+	rf.relayMx.Lock()
+	s.Relays = make([]RelayStatus, 0, len(rf.relays))
+	for p, rsvp := range rf.relays {
+		s.Relays = append(s.Relays, RelayStatus{ID: p, Expiration: rsvp.Expiration, Voucher: rsvp.SignedVoucher})
+	}
+	rf.relayMx.Unlock()
+	sort.Slice(s.Relays, func(i, j int) bool {
+		return s.Relays[i].ID < s.Relays[j].ID
+	})
+
+	rf.candidateMx.Lock()
+	s.Candidates = len(rf.candidates)
+	s.CandidatesAdded = rf.candidatesAdded
+	s.CandidatesRemoved = rf.candidatesRemoved
+	rf.candidateMx.Unlock()
+	return s
+}
@@ -0,0 +1,30 @@
+package basichost
+
+// watchAddrFilters closes the connections to the addresses denied by the address
+// filters, and advertises our new addresses, whenever the filters change.
+func (h *BasicHost) watchAddrFilters() {
+	defer h.refCount.Done()
+
+	for {
+		select {
+		case _, ok := <-h.addrFiltersSub.Out():
+			if !ok {
+				return
+			}
+			// removing a rule, or changing the default action, can deny addresses too
+			h.closeDeniedConns()
+			h.SignalAddressChange()
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *BasicHost) closeDeniedConns() {
+	for _, c := range h.Network().Conns() {
+		if h.addrFilters.AddrBlocked(c.RemoteMultiaddr()) {
+			log.Debugw("closing connection to denied address", "peer", c.RemotePeer(), "addr", c.RemoteMultiaddr())
+			c.Close()
+		}
+	}
+}
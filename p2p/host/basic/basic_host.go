@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/connmgr"
@@ -25,6 +27,9 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
 	"github.com/libp2p/go-libp2p/p2p/host/pstoremanager"
 	"github.com/libp2p/go-libp2p/p2p/host/relaysvc"
+	"github.com/libp2p/go-libp2p/p2p/net/addrfilter"
+	"github.com/libp2p/go-libp2p/p2p/net/nat64"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
@@ -41,6 +46,10 @@ import (
 	msmux "github.com/multiformats/go-multistream"
 )
 
+// ErrNegotiationTimeout is returned by NewStream if the protocol negotiation took
+// longer than the OutboundNegotiationTimeout.
+var ErrNegotiationTimeout = errors.New("protocol negotiation timed out")
+
 // addrChangeTickrInterval is the interval between two address change ticks.
 var addrChangeTickrInterval = 5 * time.Second
 
@@ -50,6 +59,10 @@ var (
 	// DefaultNegotiationTimeout is the default value for HostOpts.NegotiationTimeout.
 	DefaultNegotiationTimeout = 10 * time.Second
 
+	// DefaultOutboundNegotiationTimeout is the default value for
+	// HostOpts.OutboundNegotiationTimeout.
+	DefaultOutboundNegotiationTimeout = 10 * time.Second
+
 	// DefaultAddrsFactory is the default value for HostOpts.AddrsFactory.
 	DefaultAddrsFactory = func(addrs []ma.Multiaddr) []ma.Multiaddr { return addrs }
 )
@@ -71,27 +84,61 @@ type BasicHost struct {
 	// keep track of resources we need to wait on before shutting down
 	refCount sync.WaitGroup
 
-	network      network.Network
-	psManager    *pstoremanager.PeerstoreManager
-	mux          *msmux.MultistreamMuxer[protocol.ID]
-	ids          identify.IDService
-	hps          *holepunch.Service
-	pings        *ping.PingService
-	natmgr       NATManager
-	maResolver   *madns.Resolver
-	cmgr         connmgr.ConnManager
-	eventbus     event.Bus
+	network    network.Network
+	psManager  *pstoremanager.PeerstoreManager
+	mux        *msmux.MultistreamMuxer[protocol.ID]
+	ids        identify.IDService
+	hps        *holepunch.Service
+	pings      *ping.PingService
+	latencyMon *ping.LatencyMonitor
+	natmgr     NATManager
+	maResolver *madns.Resolver
+	cmgr       connmgr.ConnManager
+	eventbus   event.Bus
+
+	relayMu      sync.Mutex
 	relayManager *relaysvc.RelayManager
-
-	AddrsFactory AddrsFactory
-
-	negtimeout time.Duration
+	relayOpts    []relayv2.Option
+	// relayMetrics registers the metrics of the relay service, it's cleared once
+	// they're registered, see relayServiceOpts
+	relayMetrics func() relayv2.MetricsTracer
+
+	AddrsFactory         AddrsFactory
+	listenAddrsFactories []ListenAddrsFactory
+	addrFilters          *addrfilter.Filters
+	addrFiltersSub       event.Subscription
+	// announceAddrs replace the addresses advertised, see AnnounceAddrs
+	announceAddrs atomic.Pointer[[]ma.Multiaddr]
+
+	negtimeout      time.Duration
+	outNegTimeout   time.Duration
+	lazyNegotiation map[protocol.ID]LazyNegotiation
+	protocolTokens  *protocolTokens
+	tokensNotifiee  network.Notifiee
+	tokensSub       event.Subscription
 
 	emitters struct {
-		evtLocalProtocolsUpdated event.Emitter
-		evtLocalAddrsUpdated     event.Emitter
+		evtLocalProtocolsUpdated     event.Emitter
+		evtLocalAddrsUpdated         event.Emitter
+		evtNATPortMappingChanged     event.Emitter
+		evtStaticPortMappingVerified event.Emitter
+		evtProtocolNegotiationFailed event.Emitter
+		evtHostReconfigured          event.Emitter
 	}
 
+	metricsTracer MetricsTracer
+
+	staticMappings              []StaticPortMapping
+	staticMappingVerifyInterval time.Duration
+
+	nat64 *nat64.Detector
+
+	dnsAddrs              []ma.Multiaddr
+	verifyDNSAddrs        bool
+	dnsAddrVerifyInterval time.Duration
+	dnsAddrsMu            sync.Mutex
+	verifiedDNSAddrs      []ma.Multiaddr
+
 	addrChangeChan chan struct{}
 
 	addrMu                 sync.RWMutex
@@ -103,6 +150,11 @@ type BasicHost struct {
 	caBook                  peerstore.CertifiedAddrBook
 
 	autoNat autonat.AutoNAT
+
+	autonatv2       *autonatv2.AutoNAT
+	autonatv2Dialer host.Host
+
+	effectiveConfig func() *EffectiveConfig
 }
 
 var _ host.Host = (*BasicHost)(nil)
@@ -121,10 +173,47 @@ type HostOpts struct {
 	// If below 0, timeouts on streams will be deactivated.
 	NegotiationTimeout time.Duration
 
+	// OutboundNegotiationTimeout bounds the protocol negotiation of the streams opened
+	// by NewStream, independently of the context passed to it. If 0 or omitted, it
+	// will use DefaultOutboundNegotiationTimeout. If below 0, the negotiation is only
+	// bounded by the context. It doesn't apply to streams negotiated lazily, because
+	// the protocol is already known to be supported by the peer.
+	OutboundNegotiationTimeout time.Duration
+
+	// LazyNegotiation overrides, per protocol, whether NewStream negotiates the
+	// protocol lazily. By default, it does if the peer is known to support the
+	// protocol.
+	LazyNegotiation map[protocol.ID]LazyNegotiation
+
+	// EnableProtocolTokens makes the host use the protocol tokens offered by its peers
+	// when it opens streams to them. Tokens are short identifiers that are negotiated
+	// instead of the protocol IDs they stand for, which saves bytes on every stream.
+	// If the peer rejects a token, the protocol ID is negotiated instead. Lazily
+	// negotiated streams, which can't fall back, use the token as well, since the
+	// peer accepts its tokens for as long as it handles their protocols.
+	EnableProtocolTokens bool
+	// ProtocolTokens are the protocols for which the host offers tokens to its peers
+	// that enabled protocol tokens, on every connection. Setting them enables
+	// protocol tokens. Tokens are only accepted for protocols handled with
+	// SetStreamHandler, not with SetStreamHandlerMatch.
+	ProtocolTokens []protocol.ID
+
 	// AddrsFactory holds a function which can be used to override or filter the result of Addrs.
 	// If omitted, there's no override or filtering, and the results of Addrs and AllAddrs are the same.
 	AddrsFactory AddrsFactory
 
+	// ListenAddrsFactories are applied to the addresses of the listeners they match,
+	// in order, before AddrsFactory.
+	ListenAddrsFactories []ListenAddrsFactory
+
+	// AddrFilters are address filters that can be changed while the host is running.
+	// Denied addresses aren't advertised, and when the filters change, the host closes
+	// its connections to denied addresses and advertises its new addresses. The
+	// host makes the filters emit events on its event bus, so they can't be shared
+	// with other hosts. To also gate new connections, the network has to use
+	// AddrFilters.Gater as its connection gater.
+	AddrFilters *addrfilter.Filters
+
 	// MultiaddrResolves holds the go-multiaddr-dns.Resolver used for resolving
 	// /dns4, /dns6, and /dnsaddr addresses before trying to connect to a peer.
 	MultiaddrResolver *madns.Resolver
@@ -133,12 +222,45 @@ type HostOpts struct {
 	// If omitted, this will simply be disabled.
 	NATManager func(network.Network) NATManager
 
+	// StaticPortMappings are port mappings set up manually on the NAT device. The host
+	// advertises the external addresses of its listen addresses that are mapped, and
+	// verifies their reachability using AutoNAT v2 if it is enabled.
+	StaticPortMappings []StaticPortMapping
+	// StaticPortMappingVerifyInterval is the interval between two reachability checks
+	// of the static port mappings. If 0, DefaultStaticPortMappingVerifyInterval is used.
+	StaticPortMappingVerifyInterval time.Duration
+
+	// NAT64 detects whether the host is in an IPv6-only network. If it is, the host
+	// doesn't advertise IPv4 addresses other than loopback ones, since its peers can't
+	// reach them. CLAT addresses are never advertised. The host refreshes the detector
+	// periodically. To also dial IPv4 addresses through NAT64, the network has to use
+	// it too, see swarm.WithNAT64.
+	NAT64 *nat64.Detector
+
+	// DNSAddrs are the canonical DNS addresses of the host: /dnsaddr addresses, or
+	// /dns, /dns4 and /dns6 addresses followed by a transport. They are advertised in
+	// identify and in the signed peer record in place of the public IP addresses of
+	// the host. Private and relay addresses are still advertised.
+	DNSAddrs []ma.Multiaddr
+	// VerifyDNSAddrs makes the host periodically resolve the DNSAddrs, and only
+	// advertise those that currently resolve to one of its addresses. As long as
+	// none of them does, the public IP addresses are advertised.
+	VerifyDNSAddrs bool
+	// DNSAddrVerifyInterval is the interval between two verifications of the
+	// DNSAddrs. If 0, DefaultDNSAddrVerifyInterval is used.
+	DNSAddrVerifyInterval time.Duration
+
 	// ConnManager is a libp2p connection manager
 	ConnManager connmgr.ConnManager
 
 	// EnablePing indicates whether to instantiate the ping service
 	EnablePing bool
 
+	// EnableLatencyMonitor enables the latency monitor, which periodically pings connected peers.
+	EnableLatencyMonitor bool
+	// LatencyMonitorOpts are options for the latency monitor.
+	LatencyMonitorOpts []ping.MonitorOption
+
 	// EnableRelayService enables the circuit v2 relay (if we're publicly reachable).
 	EnableRelayService bool
 	// RelayServiceOpts are options for the circuit v2 relay.
@@ -150,18 +272,41 @@ type HostOpts struct {
 	// ProtocolVersion sets the protocol version for the host.
 	ProtocolVersion string
 
+	// IdentifyOpts are options for the identify service.
+	// They are applied after the options derived from the other fields.
+	IdentifyOpts []identify.Option
+
 	// DisableSignedPeerRecord disables the generation of Signed Peer Records on this host.
 	DisableSignedPeerRecord bool
 
+	// RequireSignedPeerRecord requires peers to send Signed Peer Records in identify,
+	// only stores the certified addresses of peers in the peerstore, and only advertises
+	// the addresses contained in the host's own Signed Peer Record.
+	// It can't be combined with DisableSignedPeerRecord.
+	RequireSignedPeerRecord bool
+
 	// EnableHolePunching enables the peer to initiate/respond to hole punching attempts for NAT traversal.
 	EnableHolePunching bool
 	// HolePunchingOptions are options for the hole punching service
 	HolePunchingOptions []holepunch.Option
 
+	// EnableAutoNATv2 enables the AutoNAT v2 service, which verifies the reachability of
+	// individual addresses.
+	EnableAutoNATv2 bool
+	// AutoNATv2Dialer is the host used by the AutoNAT v2 server to dial back clients.
+	// If nil, only the client is enabled. The host takes ownership of the dialer and
+	// closes it when it's closed.
+	AutoNATv2Dialer host.Host
+
 	// EnableMetrics enables the metrics subsystems
 	EnableMetrics bool
 	// PrometheusRegisterer is the PrometheusRegisterer used for metrics
 	PrometheusRegisterer prometheus.Registerer
+
+	// EffectiveConfig returns the configuration of the host, see
+	// BasicHost.EffectiveConfig. It's set by the constructor of the host, which
+	// knows how the host and its components were configured.
+	EffectiveConfig func() *EffectiveConfig
 }
 
 // NewHost constructs a new *BasicHost and activates it by attaching its stream and connection handlers to the given inet.Network.
@@ -184,6 +329,7 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 		psManager:               psManager,
 		mux:                     msmux.NewMultistreamMuxer[protocol.ID](),
 		negtimeout:              DefaultNegotiationTimeout,
+		outNegTimeout:           DefaultOutboundNegotiationTimeout,
 		AddrsFactory:            DefaultAddrsFactory,
 		maResolver:              madns.DefaultResolver,
 		eventbus:                opts.EventBus,
@@ -201,6 +347,18 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 	if h.emitters.evtLocalAddrsUpdated, err = h.eventbus.Emitter(&event.EvtLocalAddressesUpdated{}, eventbus.Stateful); err != nil {
 		return nil, err
 	}
+	if h.emitters.evtNATPortMappingChanged, err = h.eventbus.Emitter(&event.EvtNATPortMappingChanged{}); err != nil {
+		return nil, err
+	}
+	if h.emitters.evtStaticPortMappingVerified, err = h.eventbus.Emitter(&event.EvtStaticPortMappingVerified{}); err != nil {
+		return nil, err
+	}
+	if h.emitters.evtProtocolNegotiationFailed, err = h.eventbus.Emitter(&event.EvtProtocolNegotiationFailed{}); err != nil {
+		return nil, err
+	}
+	if h.emitters.evtHostReconfigured, err = h.eventbus.Emitter(&event.EvtHostReconfigured{}); err != nil {
+		return nil, err
+	}
 
 	if !h.disableSignedPeerRecord {
 		cab, ok := peerstore.GetCertifiedAddrBook(n.Peerstore())
@@ -241,11 +399,16 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 	if h.disableSignedPeerRecord {
 		idOpts = append(idOpts, identify.DisableSignedPeerRecord())
 	}
+	if opts.RequireSignedPeerRecord {
+		idOpts = append(idOpts, identify.RequireSignedPeerRecord())
+	}
 	if opts.EnableMetrics {
+		h.metricsTracer = NewMetricsTracer(WithRegisterer(opts.PrometheusRegisterer))
 		idOpts = append(idOpts,
 			identify.WithMetricsTracer(
 				identify.NewMetricsTracer(identify.WithRegisterer(opts.PrometheusRegisterer))))
 	}
+	idOpts = append(idOpts, opts.IdentifyOpts...)
 
 	h.ids, err = identify.NewIDService(h, idOpts...)
 	if err != nil {
@@ -253,6 +416,12 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 	}
 
 	if opts.EnableHolePunching {
+		if opts.EnableMetrics {
+			// Prefer explicitly provided metrics tracer
+			hpOpts := []holepunch.Option{
+				holepunch.WithMetricsTracer(holepunch.NewMetricsTracer(holepunch.WithRegisterer(opts.PrometheusRegisterer)))}
+			opts.HolePunchingOptions = append(hpOpts, opts.HolePunchingOptions...)
+		}
 		h.hps, err = holepunch.NewService(h, h.ids, opts.HolePunchingOptions...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create hole punch service: %w", err)
@@ -262,13 +431,84 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 	if uint64(opts.NegotiationTimeout) != 0 {
 		h.negtimeout = opts.NegotiationTimeout
 	}
+	if opts.OutboundNegotiationTimeout != 0 {
+		h.outNegTimeout = opts.OutboundNegotiationTimeout
+	}
+	for p, l := range opts.LazyNegotiation {
+		if err := l.validate(); err != nil {
+			return nil, fmt.Errorf("protocol %s: %w", p, err)
+		}
+	}
+	h.lazyNegotiation = opts.LazyNegotiation
+	h.effectiveConfig = opts.EffectiveConfig
+
+	if opts.EnableProtocolTokens || len(opts.ProtocolTokens) > 0 {
+		h.protocolTokens = newProtocolTokens(opts.ProtocolTokens)
+		h.SetStreamHandlerMatch(ProtocolTokensID, h.protocolTokens.match, h.handleProtocolTokens)
+		h.tokensNotifiee = &network.NotifyBundle{
+			DisconnectedF: func(_ network.Network, c network.Conn) { h.protocolTokens.removeConn(c) },
+		}
+		h.Network().Notify(h.tokensNotifiee)
+		if len(h.protocolTokens.tokens) > 0 {
+			h.tokensSub, err = h.eventbus.Subscribe(new(event.EvtPeerIdentificationCompleted), eventbus.Name("basichost (protocol tokens)"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to subscribe to identification events: %w", err)
+			}
+		}
+	}
 
 	if opts.AddrsFactory != nil {
 		h.AddrsFactory = opts.AddrsFactory
 	}
+	for _, f := range opts.ListenAddrsFactories {
+		if err := f.validate(); err != nil {
+			return nil, err
+		}
+	}
+	h.listenAddrsFactories = opts.ListenAddrsFactories
+
+	if opts.AddrFilters != nil {
+		h.addrFilters = opts.AddrFilters
+		if err := h.addrFilters.EmitEvents(h.eventbus); err != nil {
+			return nil, fmt.Errorf("failed to emit address filter events: %w", err)
+		}
+		h.addrFiltersSub, err = h.eventbus.Subscribe(new(event.EvtAddrFiltersUpdated), eventbus.Name("basichost (address filters)"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to subscribe to address filter events: %w", err)
+		}
+	}
 
 	if opts.NATManager != nil {
 		h.natmgr = opts.NATManager(n)
+		if nmgr, ok := h.natmgr.(*natManager); ok {
+			nmgr.setEmitter(h.emitters.evtNATPortMappingChanged)
+		}
+	}
+
+	for _, m := range opts.StaticPortMappings {
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("invalid static port mapping: %w", err)
+		}
+	}
+	h.staticMappings = opts.StaticPortMappings
+	h.staticMappingVerifyInterval = opts.StaticPortMappingVerifyInterval
+	if h.staticMappingVerifyInterval == 0 {
+		h.staticMappingVerifyInterval = DefaultStaticPortMappingVerifyInterval
+	}
+
+	h.nat64 = opts.NAT64
+
+	for _, a := range opts.DNSAddrs {
+		a, err := validateDNSAddr(a, h.ID())
+		if err != nil {
+			return nil, err
+		}
+		h.dnsAddrs = append(h.dnsAddrs, a)
+	}
+	h.verifyDNSAddrs = opts.VerifyDNSAddrs
+	h.dnsAddrVerifyInterval = opts.DNSAddrVerifyInterval
+	if h.dnsAddrVerifyInterval == 0 {
+		h.dnsAddrVerifyInterval = DefaultDNSAddrVerifyInterval
 	}
 
 	if opts.MultiaddrResolver != nil {
@@ -282,21 +522,35 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 		n.Notify(h.cmgr.Notifee())
 	}
 
-	if opts.EnableRelayService {
-		if opts.EnableMetrics {
-			// Prefer explicitly provided metrics tracer
-			metricsOpt := []relayv2.Option{
-				relayv2.WithMetricsTracer(
-					relayv2.NewMetricsTracer(relayv2.WithRegisterer(opts.PrometheusRegisterer)))}
-			opts.RelayServiceOpts = append(metricsOpt, opts.RelayServiceOpts...)
+	h.relayOpts = opts.RelayServiceOpts
+	if opts.EnableMetrics {
+		h.relayMetrics = func() relayv2.MetricsTracer {
+			return relayv2.NewMetricsTracer(relayv2.WithRegisterer(opts.PrometheusRegisterer))
 		}
-		h.relayManager = relaysvc.NewRelayManager(h, opts.RelayServiceOpts...)
+	}
+	if opts.EnableRelayService {
+		h.relayManager = relaysvc.NewRelayManager(h, h.relayServiceOpts()...)
 	}
 
 	if opts.EnablePing {
 		h.pings = ping.NewPingService(h)
 	}
 
+	if opts.EnableLatencyMonitor {
+		h.latencyMon, err = ping.NewLatencyMonitor(h, opts.LatencyMonitorOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create latency monitor: %w", err)
+		}
+	}
+
+	if opts.EnableAutoNATv2 {
+		h.autonatv2, err = autonatv2.New(h, opts.AutoNATv2Dialer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create autonatv2: %w", err)
+		}
+		h.autonatv2Dialer = opts.AutoNATv2Dialer
+	}
+
 	n.SetStreamHandler(h.newStreamHandler)
 
 	// register to be notified when the network's listen addrs change,
@@ -385,6 +639,36 @@ func (h *BasicHost) Start() {
 	h.psManager.Start()
 	h.refCount.Add(1)
 	h.ids.Start()
+	if h.latencyMon != nil {
+		h.latencyMon.Start()
+	}
+	if h.autonatv2 != nil {
+		h.autonatv2.Start()
+	}
+	if len(h.staticMappings) > 0 {
+		if h.autonatv2 != nil {
+			h.refCount.Add(1)
+			go h.verifyStaticMappings()
+		} else {
+			log.Info("static port mappings can't be verified without AutoNAT v2")
+		}
+	}
+	if h.addrFiltersSub != nil {
+		h.refCount.Add(1)
+		go h.watchAddrFilters()
+	}
+	if h.nat64 != nil {
+		h.refCount.Add(1)
+		go h.refreshNAT64()
+	}
+	if h.verifyDNSAddrs && len(h.dnsAddrs) > 0 {
+		h.refCount.Add(1)
+		go h.verifyDNSAddrsLoop()
+	}
+	if h.tokensSub != nil {
+		h.refCount.Add(1)
+		go h.offerProtocolTokensLoop()
+	}
 	go h.background()
 }
 
@@ -402,6 +686,13 @@ func (h *BasicHost) newStreamHandler(s network.Stream) {
 	}
 
 	protoID, handle, err := h.Mux().Negotiate(s)
+	if err == nil && h.protocolTokens != nil && protoID != ProtocolTokensID && isToken(protoID) {
+		var ok bool
+		if protoID, handle, ok = h.protocolTokens.resolve(protoID); !ok {
+			// the handler was removed during the negotiation
+			err = fmt.Errorf("no handler for protocol token")
+		}
+	}
 	took := time.Since(before)
 	if err != nil {
 		if err == io.EOF {
@@ -413,6 +704,7 @@ func (h *BasicHost) newStreamHandler(s network.Stream) {
 		} else {
 			log.Debugf("protocol mux failed: %s (took %s)", err, took)
 		}
+		h.negotiationFailed(s, nil, err, took)
 		s.Reset()
 		return
 	}
@@ -432,6 +724,9 @@ func (h *BasicHost) newStreamHandler(s network.Stream) {
 	}
 
 	log.Debugf("negotiated: %s (took %s)", protoID, took)
+	if h.metricsTracer != nil {
+		h.metricsTracer.ProtocolNegotiated(network.DirInbound, protoID, took)
+	}
 
 	go handle(protoID, s)
 }
@@ -589,12 +884,14 @@ func (h *BasicHost) EventBus() event.Bus {
 //
 // (Threadsafe)
 func (h *BasicHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
-	h.Mux().AddHandler(pid, func(p protocol.ID, rwc io.ReadWriteCloser) error {
+	f := func(p protocol.ID, rwc io.ReadWriteCloser) error {
 		is := rwc.(network.Stream)
 		is.SetProtocol(p)
 		handler(is)
 		return nil
-	})
+	}
+	h.Mux().AddHandler(pid, f)
+	h.protocolTokens.setHandler(pid, f)
 	h.emitters.evtLocalProtocolsUpdated.Emit(event.EvtLocalProtocolsUpdated{
 		Added: []protocol.ID{pid},
 	})
@@ -617,6 +914,7 @@ func (h *BasicHost) SetStreamHandlerMatch(pid protocol.ID, m func(protocol.ID) b
 // RemoveStreamHandler returns ..
 func (h *BasicHost) RemoveStreamHandler(pid protocol.ID) {
 	h.Mux().RemoveHandler(pid)
+	h.protocolTokens.removeHandler(pid)
 	h.emitters.evtLocalProtocolsUpdated.Emit(event.EvtLocalProtocolsUpdated{
 		Removed: []protocol.ID{pid},
 	})
@@ -666,40 +964,105 @@ func (h *BasicHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.I
 		return nil, err
 	}
 
-	if pref != "" {
+	if pref = h.lazyProtocol(pids, pref); pref != "" {
 		s.SetProtocol(pref)
-		lzcon := msmux.NewMSSelect(s, pref)
+		// The peer accepts the tokens it offered on this connection for as long as
+		// it handles their protocols, just like it accepts the protocol IDs.
+		proposal := pref
+		if tok, ok := h.protocolTokens.token(s.Conn(), pref); ok {
+			proposal = tok
+		}
+		lzcon := msmux.NewMSSelect(s, proposal)
 		return &streamWrapper{
 			Stream: s,
 			rw:     lzcon,
 		}, nil
 	}
 
-	// Negotiate the protocol in the background, obeying the context.
+	// Negotiate the protocol in the background, obeying the context and the
+	// negotiation timeout.
+	var timeout <-chan time.Time
+	if h.outNegTimeout > 0 {
+		t := time.NewTimer(h.outNegTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
 	var selected protocol.ID
 	errCh := make(chan error, 1)
+	start := time.Now()
+	proposals, fromToken := h.protocolTokens.propose(s.Conn(), pids)
 	go func() {
-		selected, err = msmux.SelectOneOf(pids, s)
+		selected, err = msmux.SelectOneOf(proposals, s)
 		errCh <- err
 	}()
 	select {
 	case err = <-errCh:
 		if err != nil {
+			h.negotiationFailed(s, pids, err, time.Since(start))
 			s.Reset()
 			return nil, err
 		}
+	case <-timeout:
+		s.Reset()
+		// wait for `SelectOneOf` to error out because of resetting the stream.
+		<-errCh
+		h.negotiationFailed(s, pids, ErrNegotiationTimeout, time.Since(start))
+		return nil, ErrNegotiationTimeout
 	case <-ctx.Done():
 		s.Reset()
 		// wait for `SelectOneOf` to error out because of resetting the stream.
 		<-errCh
+		h.negotiationFailed(s, pids, ctx.Err(), time.Since(start))
 		return nil, ctx.Err()
 	}
+	if p, ok := fromToken[selected]; ok {
+		selected = p
+	}
+	if h.metricsTracer != nil {
+		h.metricsTracer.ProtocolNegotiated(network.DirOutbound, selected, time.Since(start))
+	}
 
 	s.SetProtocol(selected)
 	h.Peerstore().AddProtocols(p, selected)
 	return s, nil
 }
 
+// negotiationFailed records that negotiating the protocol of s failed. protos are the
+// protocols we proposed, if we opened the stream.
+func (h *BasicHost) negotiationFailed(s network.Stream, protos []protocol.ID, err error, took time.Duration) {
+	dir := network.DirInbound
+	if protos != nil {
+		dir = network.DirOutbound
+	}
+	reason := negotiationFailureReason(err)
+	if h.metricsTracer != nil {
+		h.metricsTracer.ProtocolNegotiationFailed(dir, reason, took)
+	}
+	h.emitters.evtProtocolNegotiationFailed.Emit(event.EvtProtocolNegotiationFailed{
+		Peer:      s.Conn().RemotePeer(),
+		Direction: dir,
+		Protocols: protos,
+		Reason:    reason,
+		Error:     err,
+		Duration:  took,
+	})
+}
+
+func negotiationFailureReason(err error) event.ProtocolNegotiationFailure {
+	switch {
+	case errors.Is(err, msmux.ErrNotSupported[protocol.ID]{}):
+		return event.NegotiationUnsupported
+	case errors.Is(err, ErrNegotiationTimeout), errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return event.NegotiationTimeout
+	case errors.Is(err, context.Canceled):
+		return event.NegotiationCanceled
+	case errors.Is(err, io.EOF):
+		return event.NegotiationClosed
+	default:
+		return event.NegotiationError
+	}
+}
+
 func (h *BasicHost) preferredProtocol(p peer.ID, pids []protocol.ID) (protocol.ID, error) {
 	supported, err := h.Peerstore().SupportsProtocols(p, pids...)
 	if err != nil {
@@ -720,7 +1083,7 @@ func (h *BasicHost) preferredProtocol(p peer.ID, pids []protocol.ID) (protocol.I
 // It will also resolve any /dns4, /dns6, and /dnsaddr addresses.
 func (h *BasicHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
 	// absorb addresses into peerstore
-	h.Peerstore().AddAddrs(pi.ID, pi.Addrs, peerstore.TempAddrTTL)
+	peerstore.AddAddrsWithSource(h.Peerstore(), pi.ID, pi.Addrs, peerstore.TempAddrTTL, peerstore.AddrSourceManual)
 
 	forceDirect, _ := network.GetForceDirectDial(ctx)
 	if !forceDirect {
@@ -761,7 +1124,10 @@ func (h *BasicHost) ConnManager() connmgr.ConnManager {
 }
 
 // Addrs returns listening addresses that are safe to announce to the network.
-// The output is the same as AllAddrs, but processed by AddrsFactory.
+// The output is the same as AllAddrs, but without the IPv4 addresses that are useless
+// behind a NAT64, processed by the ListenAddrsFactories, with the public IP addresses
+// replaced by the DNSAddrs, processed by the AddrsFactory, and without the addresses
+// denied by the AddrFilters.
 func (h *BasicHost) Addrs() []ma.Multiaddr {
 	// This is a temporary workaround/hack that fixes #2233. Once we have a
 	// proper address pipeline, rework this. See the issue for more context.
@@ -773,7 +1139,14 @@ func (h *BasicHost) Addrs() []ma.Multiaddr {
 		AddCertHashes(m ma.Multiaddr) (ma.Multiaddr, bool)
 	}
 
-	addrs := h.AddrsFactory(h.AllAddrs())
+	addrs := h.applyDNSAddrs(h.applyListenAddrsFactories(h.Network().ListenAddresses(), h.removeNAT64Addrs(h.AllAddrs())))
+	if announce := h.announceAddrs.Load(); announce != nil {
+		addrs = *announce
+	}
+	addrs = h.AddrsFactory(addrs)
+	if h.addrFilters != nil {
+		addrs = h.addrFilters.FilterAddrs(addrs)
+	}
 
 	s, ok := h.Network().(transportForListeninger)
 	if !ok {
@@ -868,57 +1241,53 @@ func (h *BasicHost) AllAddrs() []ma.Multiaddr {
 
 		// Next, apply this mapping to our addresses.
 		for _, listen := range listenAddrs {
-			extMaddr := h.natmgr.GetMapping(listen)
-			if extMaddr == nil {
-				// not mapped
-				continue
-			}
-
-			// if the router reported a sane address
-			if !manet.IsIPUnspecified(extMaddr) {
-				// Add in the mapped addr.
-				finalAddrs = append(finalAddrs, extMaddr)
-			} else {
-				log.Warn("NAT device reported an unspecified IP as it's external address")
-			}
-
-			// Did the router give us a routable public addr?
-			if manet.IsPublicAddr(extMaddr) {
-				// well done
-				continue
-			}
-
-			// No.
-			// in case the router gives us a wrong address or we're behind a double-NAT.
-			// also add observed addresses
-			resolved, err := manet.ResolveUnspecifiedAddress(listen, allIfaceAddrs)
-			if err != nil {
-				// This can happen if we try to resolve /ip6/::/...
-				// without any IPv6 interface addresses.
-				continue
-			}
+			for _, extMaddr := range h.natMappings(listen) {
+				// if the router reported a sane address
+				if !manet.IsIPUnspecified(extMaddr) {
+					// Add in the mapped addr.
+					finalAddrs = append(finalAddrs, extMaddr)
+				} else {
+					log.Warn("NAT device reported an unspecified IP as it's external address")
+				}
 
-			for _, addr := range resolved {
-				// Now, check if we have any observed addresses that
-				// differ from the one reported by the router. Routers
-				// don't always give the most accurate information.
-				observed := h.ids.ObservedAddrsFor(addr)
+				// Did the router give us a routable public addr?
+				if manet.IsPublicAddr(extMaddr) {
+					// well done
+					continue
+				}
 
-				if len(observed) == 0 {
+				// No.
+				// in case the router gives us a wrong address or we're behind a double-NAT.
+				// also add observed addresses
+				resolved, err := manet.ResolveUnspecifiedAddress(listen, allIfaceAddrs)
+				if err != nil {
+					// This can happen if we try to resolve /ip6/::/...
+					// without any IPv6 interface addresses.
 					continue
 				}
 
-				// Drop the IP from the external maddr
-				_, extMaddrNoIP := ma.SplitFirst(extMaddr)
+				for _, addr := range resolved {
+					// Now, check if we have any observed addresses that
+					// differ from the one reported by the router. Routers
+					// don't always give the most accurate information.
+					observed := h.ids.ObservedAddrsFor(addr)
 
-				for _, obsMaddr := range observed {
-					// Extract a public observed addr.
-					ip, _ := ma.SplitFirst(obsMaddr)
-					if ip == nil || !manet.IsPublicAddr(ip) {
+					if len(observed) == 0 {
 						continue
 					}
 
-					finalAddrs = append(finalAddrs, ma.Join(ip, extMaddrNoIP))
+					// Drop the IP from the external maddr
+					_, extMaddrNoIP := ma.SplitFirst(extMaddr)
+
+					for _, obsMaddr := range observed {
+						// Extract a public observed addr.
+						ip, _ := ma.SplitFirst(obsMaddr)
+						if ip == nil || !manet.IsPublicAddr(ip) {
+							continue
+						}
+
+						finalAddrs = append(finalAddrs, ma.Join(ip, extMaddrNoIP))
+					}
 				}
 			}
 		}
@@ -929,6 +1298,7 @@ func (h *BasicHost) AllAddrs() []ma.Multiaddr {
 		}
 		finalAddrs = append(finalAddrs, observedAddrs...)
 	}
+	finalAddrs = append(finalAddrs, h.staticMappingAddrs(listenAddrs)...)
 	finalAddrs = dedupAddrs(finalAddrs)
 	finalAddrs = inferWebtransportAddrsFromQuic(finalAddrs)
 
@@ -1024,6 +1394,100 @@ func (h *BasicHost) GetAutoNat() autonat.AutoNAT {
 	return h.autoNat
 }
 
+// SetReachability overrides the reachability status determined by AutoNAT, e.g. for
+// operators who know their firewall setup. The override is announced with an
+// EvtLocalReachabilityChanged event, so that services like AutoRelay adapt
+// immediately, and the host's addresses are re-evaluated.
+// The override stays in place until ClearReachability is called.
+func (h *BasicHost) SetReachability(r network.Reachability) error {
+	o, err := h.reachabilityOverrider()
+	if err != nil {
+		return err
+	}
+	o.SetReachabilityOverride(r)
+	h.SignalAddressChange()
+	return nil
+}
+
+// ClearReachability removes the override set by SetReachability and lets AutoNAT
+// determine the reachability status again.
+func (h *BasicHost) ClearReachability() error {
+	o, err := h.reachabilityOverrider()
+	if err != nil {
+		return err
+	}
+	o.ClearReachabilityOverride()
+	h.SignalAddressChange()
+	return nil
+}
+
+func (h *BasicHost) reachabilityOverrider() (autonat.ReachabilityOverrider, error) {
+	an := h.GetAutoNat()
+	if an == nil {
+		return nil, errors.New("autonat is not enabled")
+	}
+	o, ok := an.(autonat.ReachabilityOverrider)
+	if !ok {
+		return nil, fmt.Errorf("autonat of type %T doesn't support reachability overrides", an)
+	}
+	return o, nil
+}
+
+// natMappings returns the external addresses listen is mapped to on the NAT devices.
+func (h *BasicHost) natMappings(listen ma.Multiaddr) []ma.Multiaddr {
+	if nmgr, ok := h.natmgr.(interface {
+		GetMappings(ma.Multiaddr) []ma.Multiaddr
+	}); ok {
+		return nmgr.GetMappings(listen)
+	}
+	if extMaddr := h.natmgr.GetMapping(listen); extMaddr != nil {
+		return []ma.Multiaddr{extMaddr}
+	}
+	return nil
+}
+
+// NATPortMappings returns the port mappings requested on the NAT device, and whether
+// they are established. It returns nil if NAT port mapping is disabled, no NAT device
+// was found, or a custom NATManager that doesn't expose its mappings is used.
+func (h *BasicHost) NATPortMappings() []event.NATPortMapping {
+	if nmgr, ok := h.natmgr.(interface {
+		Mappings() []event.NATPortMapping
+	}); ok {
+		return nmgr.Mappings()
+	}
+	return nil
+}
+
+// AutoNATv2 returns the host's AutoNAT v2 service, if AutoNAT v2 is enabled.
+func (h *BasicHost) AutoNATv2() *autonatv2.AutoNAT {
+	return h.autonatv2
+}
+
+// relayServiceOpts returns the options of the relay service. Since the service can be
+// enabled at runtime, its metrics are only registered once it's first enabled. It must
+// be called with the relayMu held, or during construction.
+func (h *BasicHost) relayServiceOpts() []relayv2.Option {
+	if h.relayMetrics != nil {
+		// Prefer explicitly provided metrics tracer
+		metricsOpt := []relayv2.Option{relayv2.WithMetricsTracer(h.relayMetrics())}
+		h.relayOpts = append(metricsOpt, h.relayOpts...)
+		h.relayMetrics = nil
+	}
+	return h.relayOpts
+}
+
+// NegotiationTimeout returns the read and write timeout of the protocol
+// negotiation of the streams, see HostOpts.NegotiationTimeout.
+func (h *BasicHost) NegotiationTimeout() time.Duration {
+	return h.negtimeout
+}
+
+// OutboundNegotiationTimeout returns the timeout of the protocol negotiation of
+// the streams opened by NewStream, see HostOpts.OutboundNegotiationTimeout.
+func (h *BasicHost) OutboundNegotiationTimeout() time.Duration {
+	return h.outNegTimeout
+}
+
 // Close shuts down the Host's services (network, etc).
 func (h *BasicHost) Close() error {
 	h.closeSync.Do(func() {
@@ -1040,15 +1504,40 @@ func (h *BasicHost) Close() error {
 		if h.autoNat != nil {
 			h.autoNat.Close()
 		}
+		h.relayMu.Lock()
 		if h.relayManager != nil {
 			h.relayManager.Close()
+			h.relayManager = nil
 		}
+		h.relayMu.Unlock()
 		if h.hps != nil {
 			h.hps.Close()
 		}
+		if h.latencyMon != nil {
+			h.latencyMon.Close()
+		}
+		if h.autonatv2 != nil {
+			h.autonatv2.Close()
+		}
+		if h.autonatv2Dialer != nil {
+			h.autonatv2Dialer.Close()
+		}
 
 		_ = h.emitters.evtLocalProtocolsUpdated.Close()
 		_ = h.emitters.evtLocalAddrsUpdated.Close()
+		_ = h.emitters.evtNATPortMappingChanged.Close()
+		_ = h.emitters.evtStaticPortMappingVerified.Close()
+		_ = h.emitters.evtProtocolNegotiationFailed.Close()
+		_ = h.emitters.evtHostReconfigured.Close()
+		if h.addrFiltersSub != nil {
+			h.addrFiltersSub.Close()
+		}
+		if h.tokensSub != nil {
+			h.tokensSub.Close()
+		}
+		if h.tokensNotifiee != nil {
+			h.Network().StopNotify(h.tokensNotifiee)
+		}
 		h.Network().Close()
 
 		h.psManager.Close()
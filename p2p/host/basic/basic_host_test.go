@@ -19,11 +19,13 @@ import (
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/core/record"
 	"github.com/libp2p/go-libp2p/p2p/host/autonat"
+	"github.com/libp2p/go-libp2p/p2p/host/basic/pb"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 
 	ma "github.com/multiformats/go-multiaddr"
+	msmux "github.com/multiformats/go-multistream"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -421,6 +423,156 @@ func TestHostProtoPreknowledge(t *testing.T) {
 	s.Close()
 }
 
+func TestLazyNegotiation(t *testing.T) {
+	h1, err := NewHost(swarmt.GenSwarm(t), &HostOpts{LazyNegotiation: map[protocol.ID]LazyNegotiation{
+		"/eager":   LazyNegotiationNever,
+		"/unknown": LazyNegotiationAlways,
+	}})
+	require.NoError(t, err)
+	defer h1.Close()
+	h2, err := NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.SetStreamHandler("/eager", func(s network.Stream) { s.Close() })
+	h2.SetStreamHandler("/lazy", func(s network.Stream) { s.Close() })
+	h1.Start()
+	h2.Start()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+
+	s, err := h1.NewStream(context.Background(), h2.ID(), "/lazy")
+	require.NoError(t, err)
+	require.IsType(t, &streamWrapper{}, s)
+	s.Close()
+
+	s, err = h1.NewStream(context.Background(), h2.ID(), "/eager")
+	require.NoError(t, err)
+	require.NotEqual(t, reflect.TypeOf(&streamWrapper{}), reflect.TypeOf(s))
+	require.Equal(t, protocol.ID("/eager"), s.Protocol())
+	s.Close()
+
+	// the peer doesn't support the protocol, so the stream fails on the first read
+	s, err = h1.NewStream(context.Background(), h2.ID(), "/unknown")
+	require.NoError(t, err)
+	require.IsType(t, &streamWrapper{}, s)
+	_, err = s.Read(make([]byte, 1))
+	require.Error(t, err)
+	s.Reset()
+
+	_, err = NewHost(swarmt.GenSwarm(t), &HostOpts{LazyNegotiation: map[protocol.ID]LazyNegotiation{"/foo": 42}})
+	require.Error(t, err)
+}
+
+func TestProtocolTokens(t *testing.T) {
+	const long protocol.ID = "/a/very/long/protocol/id/1.0.0"
+	h1, err := NewHost(swarmt.GenSwarm(t), &HostOpts{
+		EnableProtocolTokens: true,
+		LazyNegotiation:      map[protocol.ID]LazyNegotiation{long: LazyNegotiationNever},
+	})
+	require.NoError(t, err)
+	defer h1.Close()
+	h2, err := NewHost(swarmt.GenSwarm(t), &HostOpts{ProtocolTokens: []protocol.ID{long}})
+	require.NoError(t, err)
+	defer h2.Close()
+	protos := make(chan protocol.ID, 1)
+	h2.SetStreamHandler(long, func(s network.Stream) {
+		protos <- s.Protocol()
+		s.Close()
+	})
+	h1.Start()
+	h2.Start()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	conn := h1.Network().ConnsToPeer(h2.ID())[0]
+	hasToken := func() bool {
+		h1.protocolTokens.mx.RLock()
+		defer h1.protocolTokens.mx.RUnlock()
+		_, ok := h1.protocolTokens.peerTokens[conn][long]
+		return ok
+	}
+	require.Eventually(t, hasToken, 5*time.Second, 10*time.Millisecond)
+
+	// only the token can be negotiated
+	h2.Mux().RemoveHandler(long)
+	s, err := h1.NewStream(context.Background(), h2.ID(), long)
+	require.NoError(t, err)
+	require.Equal(t, long, s.Protocol())
+	require.Equal(t, long, <-protos)
+	s.Close()
+
+	// the token is rejected, so the protocol ID is negotiated
+	h2.SetStreamHandler(long, func(s network.Stream) {
+		protos <- s.Protocol()
+		s.Close()
+	})
+	h2.protocolTokens.removeHandler(long)
+	s, err = h1.NewStream(context.Background(), h2.ID(), long)
+	require.NoError(t, err)
+	require.Equal(t, long, s.Protocol())
+	require.Equal(t, long, <-protos)
+	s.Close()
+
+	require.NoError(t, h1.Network().ClosePeer(h2.ID()))
+	require.Eventually(t, func() bool { return !hasToken() }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestProtocolTokensLazy(t *testing.T) {
+	const long protocol.ID = "/a/very/long/protocol/id/1.0.0"
+	// lazy negotiation is enabled for the protocols the peer supports by default
+	h1, err := NewHost(swarmt.GenSwarm(t), &HostOpts{EnableProtocolTokens: true})
+	require.NoError(t, err)
+	defer h1.Close()
+	h2, err := NewHost(swarmt.GenSwarm(t), &HostOpts{ProtocolTokens: []protocol.ID{long}})
+	require.NoError(t, err)
+	defer h2.Close()
+	protos := make(chan protocol.ID, 1)
+	h2.SetStreamHandler(long, func(s network.Stream) {
+		protos <- s.Protocol()
+		s.Read(make([]byte, 1))
+		s.Close()
+	})
+	h1.Start()
+	h2.Start()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	conn := h1.Network().ConnsToPeer(h2.ID())[0]
+	require.Eventually(t, func() bool {
+		_, ok := h1.protocolTokens.token(conn, long)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// only the token can be negotiated
+	h2.Mux().RemoveHandler(long)
+	s, err := h1.NewStream(context.Background(), h2.ID(), long)
+	require.NoError(t, err)
+	require.IsType(t, &streamWrapper{}, s)
+	require.Equal(t, long, s.Protocol())
+	_, err = s.Write([]byte("x"))
+	require.NoError(t, err)
+	require.Equal(t, long, <-protos)
+	_, err = s.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+	s.Close()
+}
+
+func TestProtocolTokensAmbiguous(t *testing.T) {
+	token := func(p, tok string) *pb.ProtocolTokens_Token {
+		return &pb.ProtocolTokens_Token{Protocol: &p, Token: &tok}
+	}
+	tokens := peerProtocolTokens(&pb.ProtocolTokens{Tokens: []*pb.ProtocolTokens_Token{
+		token("/first/protocol/1.0.0", "/t/0"),
+		token("/second/protocol/1.0.0", "/t/0"),
+		token("/third/protocol/1.0.0", "/t/1"),
+		token("/p", "/t/2"),
+	}})
+	require.Equal(t, map[protocol.ID]protocol.ID{"/third/protocol/1.0.0": "/t/1"}, tokens)
+
+	// the same token is only proposed for the first of the protocols
+	pt := newProtocolTokens(nil)
+	c := &struct{ network.Conn }{}
+	pt.peerTokens[c] = map[protocol.ID]protocol.ID{"/a/1.0.0": "/t/0", "/b/1.0.0": "/t/0"}
+	proposals, fromToken := pt.propose(c, []protocol.ID{"/a/1.0.0", "/b/1.0.0"})
+	require.Equal(t, []protocol.ID{"/t/0", "/a/1.0.0", "/b/1.0.0"}, proposals)
+	require.Equal(t, map[protocol.ID]protocol.ID{"/t/0": "/a/1.0.0"}, fromToken)
+}
+
 func TestNewDialOld(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -446,6 +598,64 @@ func TestNewDialOld(t *testing.T) {
 	require.Equal(t, s.Protocol(), protocol.ID("/testing"), "should have gotten /testing")
 }
 
+func TestOutboundNegotiationTimeout(t *testing.T) {
+	h1, err := NewHost(swarmt.GenSwarm(t), &HostOpts{OutboundNegotiationTimeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	defer h1.Close()
+	h2, err := NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h1.Start()
+	h2.Start()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+
+	// h2 accepts streams, but never negotiates a protocol on them
+	h2.Network().SetStreamHandler(func(s network.Stream) {
+		time.Sleep(time.Second)
+		s.Reset()
+	})
+	start := time.Now()
+	_, err = h1.NewStream(context.Background(), h2.ID(), "/testing")
+	require.ErrorIs(t, err, ErrNegotiationTimeout)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestProtocolNegotiationFailedEvent(t *testing.T) {
+	h1, h2 := getHostPair(t)
+	defer h1.Close()
+	defer h2.Close()
+	sub1, err := h1.EventBus().Subscribe(new(event.EvtProtocolNegotiationFailed))
+	require.NoError(t, err)
+	defer sub1.Close()
+	sub2, err := h2.EventBus().Subscribe(new(event.EvtProtocolNegotiationFailed))
+	require.NoError(t, err)
+	defer sub2.Close()
+
+	_, err = h1.NewStream(context.Background(), h2.ID(), "/unsupported/1.0.0", "/unsupported/2.0.0")
+	require.ErrorIs(t, err, msmux.ErrNotSupported[protocol.ID]{})
+
+	select {
+	case e := <-sub1.Out():
+		evt := e.(event.EvtProtocolNegotiationFailed)
+		require.Equal(t, h2.ID(), evt.Peer)
+		require.Equal(t, network.DirOutbound, evt.Direction)
+		require.Equal(t, []protocol.ID{"/unsupported/1.0.0", "/unsupported/2.0.0"}, evt.Protocols)
+		require.Equal(t, event.NegotiationUnsupported, evt.Reason)
+		require.Error(t, evt.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an outbound negotiation failure event")
+	}
+	select {
+	case e := <-sub2.Out():
+		evt := e.(event.EvtProtocolNegotiationFailed)
+		require.Equal(t, h1.ID(), evt.Peer)
+		require.Equal(t, network.DirInbound, evt.Direction)
+		require.Empty(t, evt.Protocols)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an inbound negotiation failure event")
+	}
+}
+
 func TestNewStreamResolve(t *testing.T) {
 	h1, err := NewHost(swarmt.GenSwarm(t), nil)
 	require.NoError(t, err)
@@ -920,3 +1130,38 @@ func TestInferWebtransportAddrsFromQuic(t *testing.T) {
 	}
 
 }
+
+func TestHostSetReachability(t *testing.T) {
+	h, err := NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h.Close()
+	h.Start()
+
+	require.Error(t, h.SetReachability(network.ReachabilityPublic))
+
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	an, err := autonat.New(h, autonat.WithReachability(network.ReachabilityPrivate))
+	require.NoError(t, err)
+	h.SetAutoNat(an)
+
+	expect := func(r network.Reachability) {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			require.Equal(t, r, e.(event.EvtLocalReachabilityChanged).Reachability)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for reachability event")
+		}
+	}
+	expect(network.ReachabilityPrivate)
+
+	require.NoError(t, h.SetReachability(network.ReachabilityPublic))
+	expect(network.ReachabilityPublic)
+	require.Equal(t, network.ReachabilityPublic, h.GetAutoNat().Status())
+
+	require.NoError(t, h.ClearReachability())
+	expect(network.ReachabilityPrivate)
+}
@@ -0,0 +1,188 @@
+package basichost
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// DefaultDNSAddrVerifyInterval is the default value for HostOpts.DNSAddrVerifyInterval.
+const DefaultDNSAddrVerifyInterval = 10 * time.Minute
+
+// dnsAddrRetryInterval is the interval after which verification is retried if none of
+// the DNS addresses resolved to one of our addresses, e.g. because we haven't learnt
+// our public address from our peers yet.
+const dnsAddrRetryInterval = time.Minute
+
+// maxDNSAddrVerifyDepth bounds the number of /dnsaddr indirections followed when
+// verifying a DNS address.
+const maxDNSAddrVerifyDepth = 4
+
+func isDNSAddr(a ma.Multiaddr) bool {
+	first, _ := ma.SplitFirst(a)
+	if first == nil {
+		return false
+	}
+	switch first.Protocol().Code {
+	case ma.P_DNS, ma.P_DNS4, ma.P_DNS6, ma.P_DNSADDR:
+		return true
+	}
+	return false
+}
+
+// validateDNSAddr checks that a can be advertised as our DNS address, and returns it
+// without its /p2p component.
+func validateDNSAddr(a ma.Multiaddr, self peer.ID) (ma.Multiaddr, error) {
+	transport, id := peer.SplitAddr(a)
+	if id != "" && id != self {
+		return nil, fmt.Errorf("DNS address %s is for another peer", a)
+	}
+	if transport == nil || !isDNSAddr(transport) {
+		return nil, fmt.Errorf("not a DNS address: %s", a)
+	}
+	first, rest := ma.SplitFirst(transport)
+	if first.Protocol().Code == ma.P_DNSADDR {
+		if rest != nil {
+			return nil, fmt.Errorf("/dnsaddr address %s can't have a transport", a)
+		}
+	} else if rest == nil {
+		return nil, fmt.Errorf("DNS address %s has no transport", a)
+	}
+	return transport, nil
+}
+
+// advertisedDNSAddrs returns the DNS addresses to advertise in place of our public IP
+// addresses. If they are verified, only those that resolved to one of our addresses
+// at the last verification are returned.
+func (h *BasicHost) advertisedDNSAddrs() []ma.Multiaddr {
+	if !h.verifyDNSAddrs {
+		return h.dnsAddrs
+	}
+	h.dnsAddrsMu.Lock()
+	defer h.dnsAddrsMu.Unlock()
+	return h.verifiedDNSAddrs
+}
+
+// applyDNSAddrs replaces the public IP addresses in addrs with our DNS addresses.
+// Private addresses, relay addresses and addresses that aren't IP addresses are
+// kept. If no DNS address is advertised, addrs is returned unchanged.
+func (h *BasicHost) applyDNSAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	dnsAddrs := h.advertisedDNSAddrs()
+	if len(dnsAddrs) == 0 {
+		return addrs
+	}
+	out := make([]ma.Multiaddr, 0, len(addrs)+len(dnsAddrs))
+	for _, a := range addrs {
+		if isPublicIPAddr(a) {
+			continue
+		}
+		out = append(out, a)
+	}
+	return append(out, dnsAddrs...)
+}
+
+func isPublicIPAddr(a ma.Multiaddr) bool {
+	first, _ := ma.SplitFirst(a)
+	if first == nil {
+		return false
+	}
+	if c := first.Protocol().Code; c != ma.P_IP4 && c != ma.P_IP6 {
+		return false
+	}
+	if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+		return false
+	}
+	return manet.IsPublicAddr(a)
+}
+
+func (h *BasicHost) verifyDNSAddrsLoop() {
+	defer h.refCount.Done()
+
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if h.verifyDNSAddrsOnce(h.ctx) {
+				t.Reset(h.dnsAddrVerifyInterval)
+			} else {
+				t.Reset(dnsAddrRetryInterval)
+			}
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// verifyDNSAddrsOnce resolves our DNS addresses, and advertises those that resolve to
+// one of our addresses. It returns false if none of them did.
+func (h *BasicHost) verifyDNSAddrsOnce(ctx context.Context) bool {
+	own := make(map[string]struct{})
+	for _, a := range h.AllAddrs() {
+		own[string(h.NormalizeMultiaddr(a).Bytes())] = struct{}{}
+	}
+	var verified []ma.Multiaddr
+	for _, a := range h.dnsAddrs {
+		ok, err := h.resolvesToSelf(ctx, a, own, maxDNSAddrVerifyDepth)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			log.Infow("failed to resolve DNS address", "addr", a, "error", err)
+			continue
+		}
+		if !ok {
+			log.Infow("DNS address doesn't resolve to any of our addresses", "addr", a)
+			continue
+		}
+		verified = append(verified, a)
+	}
+
+	h.dnsAddrsMu.Lock()
+	changed := len(verified) != len(h.verifiedDNSAddrs)
+	for i := 0; !changed && i < len(verified); i++ {
+		changed = !verified[i].Equal(h.verifiedDNSAddrs[i])
+	}
+	h.verifiedDNSAddrs = verified
+	h.dnsAddrsMu.Unlock()
+
+	if changed {
+		h.SignalAddressChange()
+	}
+	return len(verified) > 0
+}
+
+// resolvesToSelf reports whether a resolves to one of the addresses in own, following
+// /dnsaddr indirections up to depth times. Resolved addresses for other peers are
+// ignored.
+func (h *BasicHost) resolvesToSelf(ctx context.Context, a ma.Multiaddr, own map[string]struct{}, depth int) (bool, error) {
+	resolved, err := h.maResolver.Resolve(ctx, a)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range resolved {
+		transport, id := peer.SplitAddr(r)
+		if transport == nil || (id != "" && id != h.ID()) {
+			continue
+		}
+		if isDNSAddr(transport) {
+			if depth == 0 {
+				continue
+			}
+			// a failure to resolve one of the records doesn't fail the others
+			if ok, _ := h.resolvesToSelf(ctx, transport, own, depth-1); ok {
+				return true, nil
+			}
+			continue
+		}
+		if _, ok := own[string(h.NormalizeMultiaddr(transport).Bytes())]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,103 @@
+package basichost
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSAddrValidation(t *testing.T) {
+	for _, a := range []string{
+		"/ip4/1.2.3.4/tcp/1234",
+		"/dns4/example.com",
+		"/dnsaddr/example.com/tcp/1234",
+		"/dnsaddr/example.com/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC",
+	} {
+		_, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), &HostOpts{DNSAddrs: []ma.Multiaddr{ma.StringCast(a)}})
+		require.Error(t, err, a)
+	}
+}
+
+func TestDNSAddrs(t *testing.T) {
+	h, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), nil)
+	require.NoError(t, err)
+	defer h.Close()
+	require.NoError(t, h.Network().Listen(ma.StringCast("/ip4/0.0.0.0/tcp/0")))
+	port, err := h.Network().ListenAddresses()[0].ValueForProtocol(ma.P_TCP)
+	require.NoError(t, err)
+	pm := StaticPortMapping{Protocol: "tcp", External: netip.MustParseAddrPort("1.2.3.4:4321")}
+	pm.InternalPort, err = strconv.Atoi(port)
+	require.NoError(t, err)
+	h.staticMappings = []StaticPortMapping{pm}
+
+	dnsAddr := ma.StringCast("/dnsaddr/example.com")
+	a, err := validateDNSAddr(dnsAddr.Encapsulate(ma.StringCast("/p2p/"+h.ID().String())), h.ID())
+	require.NoError(t, err)
+	require.Equal(t, dnsAddr, a)
+	h.dnsAddrs = []ma.Multiaddr{dnsAddr}
+
+	addrs := h.Addrs()
+	require.Contains(t, addrs, dnsAddr)
+	require.NotContains(t, addrs, ma.StringCast("/ip4/1.2.3.4/tcp/4321"))
+	require.Contains(t, addrs, ma.StringCast("/ip4/127.0.0.1/tcp/"+port))
+}
+
+func TestVerifyDNSAddrs(t *testing.T) {
+	h, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), nil)
+	require.NoError(t, err)
+	defer h.Close()
+	require.NoError(t, h.Network().Listen(ma.StringCast("/ip4/0.0.0.0/tcp/0")))
+	port, err := h.Network().ListenAddresses()[0].ValueForProtocol(ma.P_TCP)
+	require.NoError(t, err)
+	pm := StaticPortMapping{Protocol: "tcp", External: netip.MustParseAddrPort("1.2.3.4:4321")}
+	pm.InternalPort, err = strconv.Atoi(port)
+	require.NoError(t, err)
+	h.staticMappings = []StaticPortMapping{pm}
+
+	backend := &madns.MockResolver{
+		IP: map[string][]net.IPAddr{
+			"good.example.com": {{IP: net.ParseIP("1.2.3.4")}},
+			"bad.example.com":  {{IP: net.ParseIP("5.6.7.8")}},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=/dns4/good.example.com/tcp/4321/p2p/" + h.ID().String(),
+			},
+			"_dnsaddr.other.example.com": {
+				"dnsaddr=/ip4/1.2.3.4/tcp/4321/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC",
+			},
+		},
+	}
+	h.maResolver, err = madns.NewResolver(madns.WithDefaultResolver(backend))
+	require.NoError(t, err)
+
+	good := ma.StringCast("/dns4/good.example.com/tcp/4321")
+	bad := ma.StringCast("/dns4/bad.example.com/tcp/4321")
+	dnsAddr := ma.StringCast("/dnsaddr/example.com")
+	other := ma.StringCast("/dnsaddr/other.example.com")
+	h.verifyDNSAddrs = true
+
+	// nothing is verified yet, the public address is advertised
+	h.dnsAddrs = []ma.Multiaddr{good, bad, dnsAddr, other}
+	require.Contains(t, h.Addrs(), ma.StringCast("/ip4/1.2.3.4/tcp/4321"))
+
+	require.True(t, h.verifyDNSAddrsOnce(context.Background()))
+	addrs := h.Addrs()
+	require.Contains(t, addrs, good)
+	require.Contains(t, addrs, dnsAddr)
+	require.NotContains(t, addrs, bad)
+	require.NotContains(t, addrs, other)
+	require.NotContains(t, addrs, ma.StringCast("/ip4/1.2.3.4/tcp/4321"))
+
+	h.dnsAddrs = []ma.Multiaddr{bad, other}
+	require.False(t, h.verifyDNSAddrsOnce(context.Background()))
+	require.Contains(t, h.Addrs(), ma.StringCast("/ip4/1.2.3.4/tcp/4321"))
+}
@@ -0,0 +1,103 @@
+package basichost
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// EffectiveConfig is the resolved configuration of a running host, with the
+// defaults applied. It's returned by BasicHost.EffectiveConfig, and served by the
+// debug server. It's meant to be marshaled, e.g. to JSON.
+type EffectiveConfig struct {
+	PeerID          peer.ID
+	UserAgent       string
+	ProtocolVersion string
+	// ListenAddrs are the addresses the host listens on, and Addrs the addresses
+	// it advertises.
+	ListenAddrs []ma.Multiaddr
+	Addrs       []ma.Multiaddr
+	// Protocols are the protocols the host has a handler for.
+	Protocols []protocol.ID
+
+	// Transports are the multiaddr protocols the host has a transport for.
+	Transports        []string
+	SecurityProtocols []protocol.ID
+	Muxers            []protocol.ID
+	Insecure          bool
+	PrivateNetwork    bool
+
+	DialTimeout                time.Duration
+	NegotiationTimeout         time.Duration
+	OutboundNegotiationTimeout time.Duration
+
+	Relay              bool
+	EnableRelayService bool
+	EnableAutoRelay    bool
+	EnableHolePunching bool
+	EnableAutoNATv2    bool
+	AutoNATService     bool
+	ForceReachability  string `json:",omitempty"`
+	EnableBootstrap    bool
+
+	DisablePing          bool
+	EnableLatencyMonitor bool
+	DisableMetrics       bool
+
+	// the implementations of the pluggable components
+	ResourceManager string
+	ConnManager     string
+	Peerstore       string
+	ConnectionGater string `json:",omitempty"`
+
+	// ResourceManagerLimits are the current limits of the resource manager, if
+	// it's a rcmgr.LimitUpdater.
+	ResourceManagerLimits *rcmgr.PartialLimitConfig `json:",omitempty"`
+	// ConnManagerLimits are the current watermarks of the connection manager, if
+	// it's the connection manager of the connmgr package.
+	ConnManagerLimits *ConnManagerLimits `json:",omitempty"`
+}
+
+// ConnManagerLimits are the watermarks of a connection manager.
+type ConnManagerLimits struct {
+	LowWater    int
+	HighWater   int
+	GracePeriod time.Duration
+}
+
+// EffectiveConfig returns the resolved configuration of the running host, with the
+// defaults applied. It reflects the changes made at runtime, e.g. to the limits of
+// the resource manager. It returns nil if HostOpts.EffectiveConfig wasn't set.
+func (h *BasicHost) EffectiveConfig() *EffectiveConfig {
+	if h.effectiveConfig == nil {
+		return nil
+	}
+	return h.effectiveConfig()
+}
+
+// Unwrapper is implemented by the hosts wrapping another host, e.g. the routed host.
+type Unwrapper interface {
+	// Unwrap returns the wrapped host.
+	Unwrap() host.Host
+}
+
+// GetEffectiveConfig returns the effective configuration of h, see
+// BasicHost.EffectiveConfig. If h wraps another host, it unwraps it until it finds
+// a BasicHost. It returns nil if there is none.
+func GetEffectiveConfig(h host.Host) *EffectiveConfig {
+	for {
+		switch hh := h.(type) {
+		case *BasicHost:
+			return hh.EffectiveConfig()
+		case Unwrapper:
+			h = hh.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package basichost
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// LazyNegotiation controls whether NewStream negotiates the protocol of a stream
+// lazily, i.e. sends the multistream header together with the first write instead of
+// waiting for the peer to confirm the protocol. This saves a round trip, but the
+// stream fails on its first read if the peer doesn't support the protocol, and the
+// first write is buffered until the negotiation completes.
+type LazyNegotiation int
+
+const (
+	// LazyNegotiationIfSupported negotiates lazily if the peerstore knows that the
+	// peer supports the protocol. This is the default.
+	LazyNegotiationIfSupported LazyNegotiation = iota
+	// LazyNegotiationNever always waits for the peer to confirm the protocol.
+	LazyNegotiationNever
+	// LazyNegotiationAlways negotiates lazily even if the peerstore doesn't know
+	// whether the peer supports the protocol. It only applies to the first protocol
+	// passed to NewStream, since there is no fallback to the other ones.
+	LazyNegotiationAlways
+)
+
+func (l LazyNegotiation) String() string {
+	switch l {
+	case LazyNegotiationIfSupported:
+		return "if-supported"
+	case LazyNegotiationNever:
+		return "never"
+	case LazyNegotiationAlways:
+		return "always"
+	default:
+		return fmt.Sprintf("unknown lazy negotiation mode %d", int(l))
+	}
+}
+
+func (l LazyNegotiation) validate() error {
+	if l < LazyNegotiationIfSupported || l > LazyNegotiationAlways {
+		return fmt.Errorf("invalid lazy negotiation mode: %d", int(l))
+	}
+	return nil
+}
+
+// lazyProtocol returns the protocol to negotiate lazily on a stream opened for pids,
+// given the protocol supported by the peer according to the peerstore. It returns ""
+// if the protocol has to be negotiated eagerly.
+func (h *BasicHost) lazyProtocol(pids []protocol.ID, supported protocol.ID) protocol.ID {
+	if supported != "" {
+		if h.lazyNegotiation[supported] == LazyNegotiationNever {
+			return ""
+		}
+		return supported
+	}
+	if len(pids) > 0 && h.lazyNegotiation[pids[0]] == LazyNegotiationAlways {
+		return pids[0]
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package basichost
+
+import (
+	"errors"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ListenAddrsFactory is an AddrsFactory that only applies to the addresses of the
+// listeners selected by Match.
+//
+// The addresses of a listener are its listen addresses, with unspecified IPs resolved
+// to the interface addresses, and the external addresses derived from them, i.e.
+// NAT and static port mappings and observed addresses. Observed addresses are
+// attributed to the listener of the same transport and IP version if their port
+// doesn't match any listener, since NATs often rewrite ports.
+type ListenAddrsFactory struct {
+	// Match reports whether Factory applies to the listener listening on listenAddr.
+	Match func(listenAddr ma.Multiaddr) bool
+	// Factory rewrites or filters the addresses of the listener. Returning nil hides
+	// the listener.
+	Factory AddrsFactory
+}
+
+func (f ListenAddrsFactory) validate() error {
+	if f.Match == nil || f.Factory == nil {
+		return errors.New("listen addrs factory needs both a Match and a Factory function")
+	}
+	return nil
+}
+
+// MatchTransport matches the listeners whose address consists of an IP or DNS
+// component followed by the given protocols, e.g. MatchTransport(ma.P_TCP, ma.P_WS)
+// matches all WebSocket listeners. Certificate hashes are ignored.
+func MatchTransport(protos ...int) func(ma.Multiaddr) bool {
+	return func(listenAddr ma.Multiaddr) bool {
+		codes := transportProtocols(listenAddr)
+		if len(codes) != len(protos) {
+			return false
+		}
+		for i, c := range codes {
+			if c != protos[i] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchListenAddr matches the listener listening on a.
+func MatchListenAddr(a ma.Multiaddr) func(ma.Multiaddr) bool {
+	return func(listenAddr ma.Multiaddr) bool {
+		return listenAddr.Equal(a)
+	}
+}
+
+// transportProtocols returns the protocol codes following the first component of a,
+// omitting certificate hashes.
+func transportProtocols(a ma.Multiaddr) []int {
+	var codes []int
+	for i, p := range a.Protocols() {
+		if i > 0 && p.Code != ma.P_CERTHASH {
+			codes = append(codes, p.Code)
+		}
+	}
+	return codes
+}
+
+// transportKey identifies the transport of an address, and optionally its port.
+func transportKey(a ma.Multiaddr, withPort bool) string {
+	var key []byte
+	ma.ForEach(a, func(c ma.Component) bool {
+		switch code := c.Protocol().Code; code {
+		case ma.P_IP4, ma.P_DNS4:
+			key = append(key, '4')
+		case ma.P_IP6, ma.P_DNS6:
+			key = append(key, '6')
+		case ma.P_IP6ZONE, ma.P_DNS, ma.P_CERTHASH:
+		case ma.P_TCP, ma.P_UDP:
+			key = append(key, '/')
+			key = append(key, c.Protocol().Name...)
+			if withPort {
+				key = append(key, '/')
+				key = append(key, c.Value()...)
+			}
+		default:
+			key = append(key, '/')
+			key = append(key, c.Protocol().Name...)
+		}
+		return true
+	})
+	return string(key)
+}
+
+// listenerOf returns the index of the listen address a is an address of, or -1.
+func listenerOf(listenAddrs []ma.Multiaddr, a ma.Multiaddr) int {
+	key := transportKey(a, true)
+	for i, l := range listenAddrs {
+		if transportKey(l, true) == key {
+			return i
+		}
+	}
+	key = transportKey(a, false)
+	for i, l := range listenAddrs {
+		if transportKey(l, false) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyListenAddrsFactories applies the ListenAddrsFactories to the addresses of the
+// listeners they match. Addresses that can't be attributed to a listener are kept
+// as is.
+func (h *BasicHost) applyListenAddrsFactories(listenAddrs, addrs []ma.Multiaddr) []ma.Multiaddr {
+	if len(h.listenAddrsFactories) == 0 {
+		return addrs
+	}
+	groups := make([][]ma.Multiaddr, len(listenAddrs))
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if i := listenerOf(listenAddrs, a); i >= 0 {
+			groups[i] = append(groups[i], a)
+		} else {
+			out = append(out, a)
+		}
+	}
+	for i, l := range listenAddrs {
+		group := groups[i]
+		for _, f := range h.listenAddrsFactories {
+			if f.Match(l) {
+				group = f.Factory(group)
+			}
+		}
+		out = append(out, group...)
+	}
+	return dedupAddrs(out)
+}
@@ -0,0 +1,70 @@
+package basichost
+
+import (
+	"testing"
+
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerOf(t *testing.T) {
+	listenAddrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/0.0.0.0/tcp/4001"),
+		ma.StringCast("/ip6/::/tcp/4001"),
+		ma.StringCast("/ip4/0.0.0.0/udp/4001/quic-v1"),
+		ma.StringCast("/ip4/0.0.0.0/tcp/4002/ws"),
+	}
+	for _, tc := range []struct {
+		addr     string
+		listener int
+	}{
+		{"/ip4/192.168.1.2/tcp/4001", 0},
+		{"/ip4/1.2.3.4/tcp/1234", 0}, // observed, with a port rewritten by a NAT
+		{"/ip6/2001:db8::1/tcp/4001", 1},
+		{"/ip4/1.2.3.4/udp/4001/quic-v1", 2},
+		{"/dns4/example.com/tcp/4002/ws", 3},
+		{"/ip4/1.2.3.4/udp/4001/quic-v1/webtransport", -1},
+		{"/ip6/2001:db8::1/udp/4001/quic-v1", -1},
+	} {
+		require.Equal(t, tc.listener, listenerOf(listenAddrs, ma.StringCast(tc.addr)), tc.addr)
+	}
+}
+
+func TestMatchTransport(t *testing.T) {
+	require.True(t, MatchTransport(ma.P_TCP)(ma.StringCast("/ip4/0.0.0.0/tcp/4001")))
+	require.False(t, MatchTransport(ma.P_TCP)(ma.StringCast("/ip4/0.0.0.0/tcp/4001/ws")))
+	require.True(t, MatchTransport(ma.P_TCP, ma.P_WS)(ma.StringCast("/ip6/::/tcp/4001/ws")))
+	require.True(t, MatchTransport(ma.P_UDP, ma.P_QUIC_V1, ma.P_WEBTRANSPORT)(
+		ma.StringCast("/ip4/0.0.0.0/udp/4001/quic-v1/webtransport/certhash/uEiDDq4_xNyDorZBH3TlGazyJdOWSwvo4PUo5YHFMrvDE8g"),
+	))
+}
+
+func TestListenAddrsFactories(t *testing.T) {
+	public := ma.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1")
+	h, err := NewHost(swarmt.GenSwarm(t), &HostOpts{
+		ListenAddrsFactories: []ListenAddrsFactory{
+			// hide the TCP listener
+			{Match: MatchTransport(ma.P_TCP), Factory: func([]ma.Multiaddr) []ma.Multiaddr { return nil }},
+			// replace the addresses of the QUIC listener
+			{Match: MatchTransport(ma.P_UDP, ma.P_QUIC), Factory: func([]ma.Multiaddr) []ma.Multiaddr { return []ma.Multiaddr{public} }},
+		},
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	require.Equal(t, []ma.Multiaddr{public}, h.Addrs())
+	var tcpAddrs int
+	for _, a := range h.AllAddrs() {
+		if _, err := a.ValueForProtocol(ma.P_TCP); err == nil {
+			tcpAddrs++
+			require.True(t, manet.IsIPLoopback(a))
+		}
+	}
+	require.NotZero(t, tcpAddrs)
+
+	_, err = NewHost(swarmt.GenSwarm(t), &HostOpts{ListenAddrsFactories: []ListenAddrsFactory{{Match: MatchTransport(ma.P_TCP)}}})
+	require.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package basichost
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricNamespace = "libp2p_basichost"
+
+var (
+	negotiationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "protocol_negotiations_total",
+			Help:      "Successful Protocol Negotiations by Protocol",
+		},
+		[]string{"dir", "protocol"},
+	)
+	negotiationFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "protocol_negotiation_failures_total",
+			Help:      "Failed Protocol Negotiations by Reason",
+		},
+		[]string{"dir", "reason"},
+	)
+	negotiationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "protocol_negotiation_duration_seconds",
+			Help:      "Protocol Negotiation Duration",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 1.5, 24), // 1ms to ~11s
+		},
+		[]string{"dir", "outcome"},
+	)
+	collectors = []prometheus.Collector{
+		negotiationsTotal,
+		negotiationFailuresTotal,
+		negotiationDuration,
+	}
+)
+
+// MetricsTracer is the interface for tracking metrics of the protocol negotiations of
+// the host. Streams negotiated lazily aren't tracked.
+type MetricsTracer interface {
+	// ProtocolNegotiated is called when the protocol of a stream was negotiated.
+	ProtocolNegotiated(dir network.Direction, p protocol.ID, took time.Duration)
+	// ProtocolNegotiationFailed is called when negotiating the protocol of a stream
+	// failed.
+	ProtocolNegotiationFailed(dir network.Direction, reason event.ProtocolNegotiationFailure, took time.Duration)
+}
+
+type metricsTracer struct{}
+
+var _ MetricsTracer = &metricsTracer{}
+
+type metricsTracerSetting struct {
+	reg prometheus.Registerer
+}
+
+type MetricsTracerOption func(*metricsTracerSetting)
+
+func WithRegisterer(reg prometheus.Registerer) MetricsTracerOption {
+	return func(s *metricsTracerSetting) {
+		if reg != nil {
+			s.reg = reg
+		}
+	}
+}
+
+func NewMetricsTracer(opts ...MetricsTracerOption) MetricsTracer {
+	setting := &metricsTracerSetting{reg: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(setting)
+	}
+	metricshelper.RegisterCollectors(setting.reg, collectors...)
+	return &metricsTracer{}
+}
+
+func (mt *metricsTracer) ProtocolNegotiated(dir network.Direction, p protocol.ID, took time.Duration) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, metricshelper.GetDirection(dir), string(p))
+	negotiationsTotal.WithLabelValues(*tags...).Inc()
+
+	*tags = (*tags)[:1]
+	*tags = append(*tags, "success")
+	negotiationDuration.WithLabelValues(*tags...).Observe(took.Seconds())
+}
+
+func (mt *metricsTracer) ProtocolNegotiationFailed(dir network.Direction, reason event.ProtocolNegotiationFailure, took time.Duration) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, metricshelper.GetDirection(dir), string(reason))
+	negotiationFailuresTotal.WithLabelValues(*tags...).Inc()
+
+	*tags = (*tags)[:1]
+	*tags = append(*tags, "failure")
+	negotiationDuration.WithLabelValues(*tags...).Observe(took.Seconds())
+}
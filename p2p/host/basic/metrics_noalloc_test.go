@@ -0,0 +1,34 @@
+//go:build nocover
+
+package basichost
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func TestMetricsNoAllocNoCover(t *testing.T) {
+	dirs := []network.Direction{network.DirInbound, network.DirOutbound}
+	protos := []protocol.ID{"/a/1.0.0", "/b/1.0.0", "/c/1.0.0"}
+	reasons := []event.ProtocolNegotiationFailure{event.NegotiationUnsupported, event.NegotiationTimeout, event.NegotiationError}
+	tr := NewMetricsTracer()
+	tests := map[string]func(){
+		"ProtocolNegotiated": func() {
+			tr.ProtocolNegotiated(dirs[rand.Intn(len(dirs))], protos[rand.Intn(len(protos))], time.Duration(rand.Intn(1000))*time.Millisecond)
+		},
+		"ProtocolNegotiationFailed": func() {
+			tr.ProtocolNegotiationFailed(dirs[rand.Intn(len(dirs))], reasons[rand.Intn(len(reasons))], time.Duration(rand.Intn(1000))*time.Millisecond)
+		},
+	}
+	for method, f := range tests {
+		allocs := testing.AllocsPerRun(1000, f)
+		if allocs > 0 {
+			t.Fatalf("Alloc Test: %s, got: %0.2f, expected: 0 allocs", method, allocs)
+		}
+	}
+}
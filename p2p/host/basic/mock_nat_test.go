@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	event "github.com/libp2p/go-libp2p/core/event"
 )
 
 // MockNAT is a mock of NAT interface.
@@ -77,6 +78,34 @@ func (mr *MockNATMockRecorder) GetMapping(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMapping", reflect.TypeOf((*MockNAT)(nil).GetMapping), arg0, arg1)
 }
 
+// GetMappings mocks base method.
+func (m *MockNAT) GetMappings(arg0 string, arg1 int) []netip.AddrPort {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMappings", arg0, arg1)
+	ret0, _ := ret[0].([]netip.AddrPort)
+	return ret0
+}
+
+// GetMappings indicates an expected call of GetMappings.
+func (mr *MockNATMockRecorder) GetMappings(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMappings", reflect.TypeOf((*MockNAT)(nil).GetMappings), arg0, arg1)
+}
+
+// Mappings mocks base method.
+func (m *MockNAT) Mappings() []event.NATPortMapping {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Mappings")
+	ret0, _ := ret[0].([]event.NATPortMapping)
+	return ret0
+}
+
+// Mappings indicates an expected call of Mappings.
+func (mr *MockNATMockRecorder) Mappings() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mappings", reflect.TypeOf((*MockNAT)(nil).Mappings))
+}
+
 // RemoveMapping mocks base method.
 func (m *MockNAT) RemoveMapping(arg0 string, arg1 int) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,45 @@
+package basichost
+
+import (
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// nat64RefreshInterval is the interval at which we check whether we are in an
+// IPv6-only network.
+const nat64RefreshInterval = 5 * time.Minute
+
+// refreshNAT64 periodically refreshes the NAT64 detector, and advertises our new
+// addresses when its state changes.
+func (h *BasicHost) refreshNAT64() {
+	defer h.refCount.Done()
+
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			changed, err := h.nat64.Refresh(h.ctx)
+			if err != nil && h.ctx.Err() == nil {
+				log.Debugw("failed to discover NAT64 prefix", "error", err)
+			}
+			if changed {
+				log.Infow("NAT64 state changed", "ipv6Only", h.nat64.IPv6Only())
+				h.SignalAddressChange()
+			}
+			t.Reset(nat64RefreshInterval)
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// removeNAT64Addrs removes the IPv4 addresses that are useless to our peers because
+// we are behind a NAT64 or a CLAT.
+func (h *BasicHost) removeNAT64Addrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	if h.nat64 == nil {
+		return addrs
+	}
+	return ma.FilterAddrs(addrs, h.nat64.AdvertisableAddr)
+}
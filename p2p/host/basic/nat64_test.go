@@ -0,0 +1,45 @@
+package basichost
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/p2p/net/nat64"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNAT64Addrs(t *testing.T) {
+	d, err := nat64.NewDetector(
+		nat64.WithResolver(&madns.MockResolver{}),
+		nat64.WithInterfaceAddrs(func() ([]net.Addr, error) {
+			return []net.Addr{&net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(64, 128)}}, nil
+		}),
+	)
+	require.NoError(t, err)
+	h, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), &HostOpts{NAT64: d})
+	require.NoError(t, err)
+	defer h.Close()
+	require.NoError(t, h.Network().Listen(ma.StringCast("/ip4/0.0.0.0/tcp/0")))
+	port, err := h.Network().ListenAddresses()[0].ValueForProtocol(ma.P_TCP)
+	require.NoError(t, err)
+	pm := StaticPortMapping{Protocol: "tcp", External: netip.MustParseAddrPort("1.2.3.4:4321")}
+	pm.InternalPort, err = strconv.Atoi(port)
+	require.NoError(t, err)
+	h.staticMappings = []StaticPortMapping{pm}
+	public := ma.StringCast("/ip4/1.2.3.4/tcp/4321")
+	require.Contains(t, h.Addrs(), public)
+
+	_, err = d.Refresh(context.Background())
+	require.NoError(t, err)
+	addrs := h.Addrs()
+	require.NotContains(t, addrs, public)
+	require.Contains(t, addrs, ma.StringCast("/ip4/127.0.0.1/tcp/"+port))
+	require.Contains(t, h.AllAddrs(), public)
+}
@@ -7,8 +7,10 @@ import (
 	"net/netip"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	inat "github.com/libp2p/go-libp2p/p2p/net/nat"
 
@@ -29,6 +31,15 @@ func NewNATManager(net network.Network) NATManager {
 	return newNATManager(net)
 }
 
+// NATManagerWithOptions returns a constructor of a NAT manager that discovers the NAT
+// devices with the given options, e.g. to select the gateways to use with
+// inat.WithGateways or inat.WithInterfaces.
+func NATManagerWithOptions(opts ...inat.Option) func(network.Network) NATManager {
+	return func(net network.Network) NATManager {
+		return newNATManager(net, opts...)
+	}
+}
+
 type entry struct {
 	protocol string
 	port     int
@@ -38,11 +49,13 @@ type nat interface {
 	AddMapping(protocol string, port int) error
 	RemoveMapping(protocol string, port int) error
 	GetMapping(protocol string, port int) (netip.AddrPort, bool)
+	GetMappings(protocol string, port int) []netip.AddrPort
+	Mappings() []event.NATPortMapping
 	io.Closer
 }
 
 // so we can mock it in tests
-var discoverNAT = func(ctx context.Context) (nat, error) { return inat.DiscoverNAT(ctx) }
+var discoverNAT = func(ctx context.Context, opts ...inat.Option) (nat, error) { return inat.DiscoverNAT(ctx, opts...) }
 
 // natManager takes care of adding + removing port mappings to the nat.
 // Initialized with the host if it has a NATPortMap option enabled.
@@ -52,6 +65,7 @@ var discoverNAT = func(ctx context.Context) (nat, error) { return inat.DiscoverN
 //   - closing the natManager closes the nat and its mappings.
 type natManager struct {
 	net   network.Network
+	opts  []inat.Option
 	natMx sync.RWMutex
 	nat   nat
 
@@ -59,14 +73,19 @@ type natManager struct {
 
 	tracked map[entry]bool // the bool is only used in doSync and has no meaning outside of that function
 
+	// emitter emits an event.EvtNATPortMappingChanged for every change of a mapping, it
+	// is set by the host
+	emitter atomic.Pointer[event.Emitter]
+
 	refCount  sync.WaitGroup
 	ctxCancel context.CancelFunc
 }
 
-func newNATManager(net network.Network) *natManager {
+func newNATManager(net network.Network, opts ...inat.Option) *natManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	nmgr := &natManager{
 		net:       net,
+		opts:      opts,
 		syncFlag:  make(chan struct{}, 1),
 		ctxCancel: cancel,
 		tracked:   make(map[entry]bool),
@@ -98,7 +117,8 @@ func (nmgr *natManager) background(ctx context.Context) {
 
 	discoverCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	natInstance, err := discoverNAT(discoverCtx)
+	opts := append([]inat.Option{inat.WithMappingEvents(nmgr.emitMappingChange)}, nmgr.opts...)
+	natInstance, err := discoverNAT(discoverCtx, opts...)
 	if err != nil {
 		log.Info("DiscoverNAT error:", err)
 		return
@@ -125,6 +145,35 @@ func (nmgr *natManager) background(ctx context.Context) {
 	}
 }
 
+// setEmitter makes the natManager emit mapping changes on em.
+func (nmgr *natManager) setEmitter(em event.Emitter) {
+	nmgr.emitter.Store(&em)
+}
+
+func (nmgr *natManager) emitMappingChange(evt event.EvtNATPortMappingChanged) {
+	switch evt.Status {
+	case event.NATPortMappingFailed, event.NATPortMappingLost:
+		log.Infow("NAT port mapping "+evt.Status.String(), "protocol", evt.Mapping.Protocol, "port", evt.Mapping.InternalPort, "error", evt.Error)
+	default:
+		log.Debugw("NAT port mapping "+evt.Status.String(), "protocol", evt.Mapping.Protocol, "port", evt.Mapping.InternalPort, "external_port", evt.Mapping.ExternalPort)
+	}
+	if em := nmgr.emitter.Load(); em != nil {
+		(*em).Emit(evt)
+	}
+}
+
+// Mappings returns the port mappings requested on the NAT device, including those
+// that couldn't be established. It returns nil if no NAT device was found (yet).
+func (nmgr *natManager) Mappings() []event.NATPortMapping {
+	nmgr.natMx.RLock()
+	defer nmgr.natMx.RUnlock()
+
+	if nmgr.nat == nil {
+		return nil
+	}
+	return nmgr.nat.Mappings()
+}
+
 func (nmgr *natManager) sync() {
 	select {
 	case nmgr.syncFlag <- struct{}{}:
@@ -207,6 +256,19 @@ func (nmgr *natManager) doSync() {
 }
 
 func (nmgr *natManager) GetMapping(addr ma.Multiaddr) ma.Multiaddr {
+	mapped := nmgr.getMappings(addr, false)
+	if len(mapped) == 0 {
+		return nil
+	}
+	return mapped[0]
+}
+
+// GetMappings returns the external addresses of addr on all NAT devices it is mapped on.
+func (nmgr *natManager) GetMappings(addr ma.Multiaddr) []ma.Multiaddr {
+	return nmgr.getMappings(addr, true)
+}
+
+func (nmgr *natManager) getMappings(addr ma.Multiaddr, all bool) []ma.Multiaddr {
 	nmgr.natMx.Lock()
 	defer nmgr.natMx.Unlock()
 
@@ -257,28 +319,34 @@ func (nmgr *natManager) GetMapping(addr ma.Multiaddr) ma.Multiaddr {
 		return nil
 	}
 
-	extAddr, ok := nmgr.nat.GetMapping(protocol, port)
-	if !ok {
-		return nil
+	var extAddrs []netip.AddrPort
+	if all {
+		extAddrs = nmgr.nat.GetMappings(protocol, port)
+	} else if extAddr, ok := nmgr.nat.GetMapping(protocol, port); ok {
+		extAddrs = []netip.AddrPort{extAddr}
 	}
 
-	var mappedAddr net.Addr
-	switch naddr.(type) {
-	case *net.TCPAddr:
-		mappedAddr = net.TCPAddrFromAddrPort(extAddr)
-	case *net.UDPAddr:
-		mappedAddr = net.UDPAddrFromAddrPort(extAddr)
-	}
-	mappedMaddr, err := manet.FromNetAddr(mappedAddr)
-	if err != nil {
-		log.Errorf("mapped addr can't be turned into a multiaddr %q: %s", mappedAddr, err)
-		return nil
-	}
-	extMaddr := mappedMaddr
-	if rest != nil {
-		extMaddr = ma.Join(extMaddr, rest)
+	var mapped []ma.Multiaddr
+	for _, extAddr := range extAddrs {
+		var mappedAddr net.Addr
+		switch naddr.(type) {
+		case *net.TCPAddr:
+			mappedAddr = net.TCPAddrFromAddrPort(extAddr)
+		case *net.UDPAddr:
+			mappedAddr = net.UDPAddrFromAddrPort(extAddr)
+		}
+		mappedMaddr, err := manet.FromNetAddr(mappedAddr)
+		if err != nil {
+			log.Errorf("mapped addr can't be turned into a multiaddr %q: %s", mappedAddr, err)
+			continue
+		}
+		extMaddr := mappedMaddr
+		if rest != nil {
+			extMaddr = ma.Join(extMaddr, rest)
+		}
+		mapped = append(mapped, extMaddr)
 	}
-	return extMaddr
+	return mapped
 }
 
 type nmgrNetNotifiee natManager
@@ -10,6 +10,9 @@ import (
 
 	ma "github.com/multiformats/go-multiaddr"
 
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	inat "github.com/libp2p/go-libp2p/p2p/net/nat"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 
 	"github.com/golang/mock/gomock"
@@ -20,7 +23,7 @@ func setupMockNAT(t *testing.T) (mockNAT *MockNAT, reset func()) {
 	ctrl := gomock.NewController(t)
 	mockNAT = NewMockNAT(ctrl)
 	origDiscoverNAT := discoverNAT
-	discoverNAT = func(ctx context.Context) (nat, error) { return mockNAT, nil }
+	discoverNAT = func(ctx context.Context, opts ...inat.Option) (nat, error) { return mockNAT, nil }
 	return mockNAT, func() {
 		discoverNAT = origDiscoverNAT
 		ctrl.Finish()
@@ -106,3 +109,70 @@ func TestAddAndRemoveListeners(t *testing.T) {
 	mockNAT.EXPECT().RemoveMapping("tcp", 1234).MaxTimes(1)
 	mockNAT.EXPECT().Close().MaxTimes(1)
 }
+
+func TestMappingStatus(t *testing.T) {
+	mockNAT, reset := setupMockNAT(t)
+	defer reset()
+
+	sw := swarmt.GenSwarm(t)
+	defer sw.Close()
+	m := newNATManager(sw)
+	bus := eventbus.NewBus()
+	em, err := bus.Emitter(new(event.EvtNATPortMappingChanged))
+	require.NoError(t, err)
+	defer em.Close()
+	m.setEmitter(em)
+	sub, err := bus.Subscribe(new(event.EvtNATPortMappingChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+	require.Eventually(t, func() bool {
+		m.natMx.Lock()
+		defer m.natMx.Unlock()
+		return m.nat != nil
+	}, time.Second, time.Millisecond)
+
+	mapping := event.NATPortMapping{
+		Protocol:     "tcp",
+		InternalPort: 1234,
+		ExternalPort: 4321,
+		ExternalAddr: netip.AddrFrom4([4]byte{1, 2, 3, 4}),
+	}
+	mockNAT.EXPECT().Mappings().Return([]event.NATPortMapping{mapping})
+	require.Equal(t, []event.NATPortMapping{mapping}, m.Mappings())
+
+	m.emitMappingChange(event.EvtNATPortMappingChanged{Status: event.NATPortMappingAcquired, Mapping: mapping})
+	select {
+	case e := <-sub.Out():
+		require.Equal(t, event.EvtNATPortMappingChanged{Status: event.NATPortMappingAcquired, Mapping: mapping}, e)
+	case <-time.After(time.Second):
+		t.Fatal("didn't receive mapping event")
+	}
+
+	mockNAT.EXPECT().Close().MaxTimes(1)
+}
+
+func TestNATManagerWithOptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockNAT := NewMockNAT(ctrl)
+	mockNAT.EXPECT().Close().MaxTimes(1)
+	gotOpts := make(chan int, 1)
+	origDiscoverNAT := discoverNAT
+	defer func() { discoverNAT = origDiscoverNAT }()
+	discoverNAT = func(ctx context.Context, opts ...inat.Option) (nat, error) {
+		gotOpts <- len(opts)
+		return mockNAT, nil
+	}
+
+	sw := swarmt.GenSwarm(t)
+	defer sw.Close()
+	m := NATManagerWithOptions(inat.WithInterfaces("eth0"))(sw)
+	defer m.Close()
+	select {
+	case n := <-gotOpts:
+		// the mapping events option is always added
+		require.Equal(t, 2, n)
+	case <-time.After(time.Second):
+		t.Fatal("NAT discovery didn't start")
+	}
+}
@@ -0,0 +1,218 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.30.0
+// 	protoc        v3.21.12
+// source: pb/tokens.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ProtocolTokens offers short tokens that the receiver can use instead of the protocol
+// IDs when it opens streams to the sender on the same connection.
+type ProtocolTokens struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Tokens []*ProtocolTokens_Token `protobuf:"bytes,1,rep,name=tokens" json:"tokens,omitempty"`
+}
+
+func (x *ProtocolTokens) Reset() {
+	*x = ProtocolTokens{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_tokens_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProtocolTokens) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProtocolTokens) ProtoMessage() {}
+
+func (x *ProtocolTokens) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_tokens_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProtocolTokens.ProtoReflect.Descriptor instead.
+func (*ProtocolTokens) Descriptor() ([]byte, []int) {
+	return file_pb_tokens_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ProtocolTokens) GetTokens() []*ProtocolTokens_Token {
+	if x != nil {
+		return x.Tokens
+	}
+	return nil
+}
+
+type ProtocolTokens_Token struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Protocol *string `protobuf:"bytes,1,opt,name=protocol" json:"protocol,omitempty"`
+	Token    *string `protobuf:"bytes,2,opt,name=token" json:"token,omitempty"`
+}
+
+func (x *ProtocolTokens_Token) Reset() {
+	*x = ProtocolTokens_Token{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_tokens_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProtocolTokens_Token) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProtocolTokens_Token) ProtoMessage() {}
+
+func (x *ProtocolTokens_Token) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_tokens_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProtocolTokens_Token.ProtoReflect.Descriptor instead.
+func (*ProtocolTokens_Token) Descriptor() ([]byte, []int) {
+	return file_pb_tokens_proto_rawDescGZIP(), []int{0, 0}
+}
+
+func (x *ProtocolTokens_Token) GetProtocol() string {
+	if x != nil && x.Protocol != nil {
+		return *x.Protocol
+	}
+	return ""
+}
+
+func (x *ProtocolTokens_Token) GetToken() string {
+	if x != nil && x.Token != nil {
+		return *x.Token
+	}
+	return ""
+}
+
+var File_pb_tokens_proto protoreflect.FileDescriptor
+
+var file_pb_tokens_proto_rawDesc = []byte{
+	0x0a, 0x0f, 0x70, 0x62, 0x2f, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x12, 0x0c, 0x62, 0x61, 0x73, 0x69, 0x63, 0x68, 0x6f, 0x73, 0x74, 0x2e, 0x70, 0x62, 0x22,
+	0x87, 0x01, 0x0a, 0x0e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x54, 0x6f, 0x6b, 0x65,
+	0x6e, 0x73, 0x12, 0x3a, 0x0a, 0x06, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x18, 0x01, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x22, 0x2e, 0x62, 0x61, 0x73, 0x69, 0x63, 0x68, 0x6f, 0x73, 0x74, 0x2e, 0x70,
+	0x62, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x73,
+	0x2e, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x52, 0x06, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x1a, 0x39,
+	0x0a, 0x05, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x63, 0x6f, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x63, 0x6f, 0x6c, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e,
+}
+
+var (
+	file_pb_tokens_proto_rawDescOnce sync.Once
+	file_pb_tokens_proto_rawDescData = file_pb_tokens_proto_rawDesc
+)
+
+func file_pb_tokens_proto_rawDescGZIP() []byte {
+	file_pb_tokens_proto_rawDescOnce.Do(func() {
+		file_pb_tokens_proto_rawDescData = protoimpl.X.CompressGZIP(file_pb_tokens_proto_rawDescData)
+	})
+	return file_pb_tokens_proto_rawDescData
+}
+
+var file_pb_tokens_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_pb_tokens_proto_goTypes = []interface{}{
+	(*ProtocolTokens)(nil),       // 0: basichost.pb.ProtocolTokens
+	(*ProtocolTokens_Token)(nil), // 1: basichost.pb.ProtocolTokens.Token
+}
+var file_pb_tokens_proto_depIdxs = []int32{
+	1, // 0: basichost.pb.ProtocolTokens.tokens:type_name -> basichost.pb.ProtocolTokens.Token
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_pb_tokens_proto_init() }
+func file_pb_tokens_proto_init() {
+	if File_pb_tokens_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_pb_tokens_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProtocolTokens); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_tokens_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProtocolTokens_Token); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_pb_tokens_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_pb_tokens_proto_goTypes,
+		DependencyIndexes: file_pb_tokens_proto_depIdxs,
+		MessageInfos:      file_pb_tokens_proto_msgTypes,
+	}.Build()
+	File_pb_tokens_proto = out.File
+	file_pb_tokens_proto_rawDesc = nil
+	file_pb_tokens_proto_goTypes = nil
+	file_pb_tokens_proto_depIdxs = nil
+}
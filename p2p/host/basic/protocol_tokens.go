@@ -0,0 +1,319 @@
+package basichost
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/host/basic/pb"
+
+	"github.com/libp2p/go-msgio/pbio"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// ProtocolTokensID is the protocol used to offer protocol tokens to a peer.
+const ProtocolTokensID protocol.ID = "/libp2p/protocol-tokens/1.0.0"
+
+// ProtocolTokensServiceName is the name of the resource manager service of the
+// streams used to offer protocol tokens.
+const ProtocolTokensServiceName = "libp2p.protocol-tokens"
+
+const (
+	tokenPrefix = "/t/"
+	// maxProtocolTokens is the maximum number of tokens a peer can offer on a
+	// connection. Additional tokens are ignored.
+	maxProtocolTokens = 256
+	// maxTokenLen is the maximum length of a token offered by a peer.
+	maxTokenLen              = 16
+	maxProtocolTokensMsgSize = 64 << 10
+
+	protocolTokensStreamTimeout = 10 * time.Second
+)
+
+// protocolTokens keeps track of the tokens we offer to our peers, and of the tokens
+// they offer to us. Tokens are short identifiers that are negotiated with
+// multistream-select instead of the protocol IDs they stand for, to save bytes on
+// every stream. The tokens offered by a peer are only valid on the connection they
+// were offered on.
+//
+// All methods can be called on a nil *protocolTokens, which has no tokens.
+type protocolTokens struct {
+	// tokens maps the protocols we offer tokens for to their tokens.
+	tokens map[protocol.ID]protocol.ID
+	// protocols maps the tokens we offer to their protocols.
+	protocols map[protocol.ID]protocol.ID
+
+	mx sync.RWMutex
+	// handlers are the stream handlers of the protocols we offer tokens for.
+	handlers map[protocol.ID]msmux.HandlerFunc[protocol.ID]
+	// peerTokens maps the connections on which the peer offered tokens to the
+	// tokens, by protocol.
+	peerTokens map[network.Conn]map[protocol.ID]protocol.ID
+	// offered are the connections on which we offered our tokens.
+	offered map[network.Conn]struct{}
+}
+
+func newProtocolTokens(offered []protocol.ID) *protocolTokens {
+	t := &protocolTokens{
+		tokens:     make(map[protocol.ID]protocol.ID, len(offered)),
+		protocols:  make(map[protocol.ID]protocol.ID, len(offered)),
+		handlers:   make(map[protocol.ID]msmux.HandlerFunc[protocol.ID]),
+		peerTokens: make(map[network.Conn]map[protocol.ID]protocol.ID),
+		offered:    make(map[network.Conn]struct{}),
+	}
+	for _, p := range offered {
+		if _, ok := t.tokens[p]; ok {
+			continue
+		}
+		tok := protocol.ID(tokenPrefix + strconv.FormatInt(int64(len(t.tokens)), 36))
+		t.tokens[p] = tok
+		t.protocols[tok] = p
+	}
+	return t
+}
+
+func isToken(p protocol.ID) bool {
+	return strings.HasPrefix(string(p), tokenPrefix)
+}
+
+// match is the multistream match function of the protocol tokens handler. It
+// accepts ProtocolTokensID, and the tokens of the protocols we currently handle.
+func (t *protocolTokens) match(p protocol.ID) bool {
+	if p == ProtocolTokensID {
+		return true
+	}
+	_, _, ok := t.resolve(p)
+	return ok
+}
+
+// resolve returns the protocol and the handler of the token tok.
+func (t *protocolTokens) resolve(tok protocol.ID) (protocol.ID, msmux.HandlerFunc[protocol.ID], bool) {
+	if t == nil {
+		return "", nil, false
+	}
+	p, ok := t.protocols[tok]
+	if !ok {
+		return "", nil, false
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	h, ok := t.handlers[p]
+	return p, h, ok
+}
+
+func (t *protocolTokens) setHandler(p protocol.ID, h msmux.HandlerFunc[protocol.ID]) {
+	if t == nil {
+		return
+	}
+	if _, ok := t.tokens[p]; !ok {
+		return
+	}
+	t.mx.Lock()
+	t.handlers[p] = h
+	t.mx.Unlock()
+}
+
+func (t *protocolTokens) removeHandler(p protocol.ID) {
+	if t == nil {
+		return
+	}
+	t.mx.Lock()
+	delete(t.handlers, p)
+	t.mx.Unlock()
+}
+
+// propose returns the protocols to propose on a new stream on c for pids. Every
+// protocol the peer offered a token for is preceded by its token, so that we fall
+// back to the protocol ID if the peer rejects the token. It also returns the
+// protocols of the tokens.
+func (t *protocolTokens) propose(c network.Conn, pids []protocol.ID) ([]protocol.ID, map[protocol.ID]protocol.ID) {
+	if t == nil {
+		return pids, nil
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	tokens, ok := t.peerTokens[c]
+	if !ok {
+		return pids, nil
+	}
+	proposals := make([]protocol.ID, 0, 2*len(pids))
+	var fromToken map[protocol.ID]protocol.ID
+	for _, p := range pids {
+		if tok, ok := tokens[p]; ok {
+			if fromToken == nil {
+				fromToken = make(map[protocol.ID]protocol.ID)
+			}
+			// a token standing for several protocols would be ambiguous
+			if other, ok := fromToken[tok]; !ok || other == p {
+				fromToken[tok] = p
+				proposals = append(proposals, tok)
+			}
+		}
+		proposals = append(proposals, p)
+	}
+	return proposals, fromToken
+}
+
+// token returns the token the peer offered on c for p.
+func (t *protocolTokens) token(c network.Conn, p protocol.ID) (protocol.ID, bool) {
+	if t == nil {
+		return "", false
+	}
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	tok, ok := t.peerTokens[c][p]
+	return tok, ok
+}
+
+func (t *protocolTokens) removeConn(c network.Conn) {
+	t.mx.Lock()
+	delete(t.peerTokens, c)
+	delete(t.offered, c)
+	t.mx.Unlock()
+}
+
+// handleProtocolTokens stores the tokens offered by the peer on the stream's
+// connection.
+func (h *BasicHost) handleProtocolTokens(s network.Stream) {
+	defer s.Close()
+	if err := s.Scope().SetService(ProtocolTokensServiceName); err != nil {
+		log.Debugw("failed to attach stream to protocol tokens service", "error", err)
+		s.Reset()
+		return
+	}
+	if err := s.Scope().ReserveMemory(maxProtocolTokensMsgSize, network.ReservationPriorityAlways); err != nil {
+		log.Debugw("failed to reserve memory for protocol tokens", "error", err)
+		s.Reset()
+		return
+	}
+	defer s.Scope().ReleaseMemory(maxProtocolTokensMsgSize)
+	s.SetDeadline(time.Now().Add(protocolTokensStreamTimeout))
+
+	var msg pb.ProtocolTokens
+	if err := pbio.NewDelimitedReader(s, maxProtocolTokensMsgSize).ReadMsg(&msg); err != nil {
+		log.Debugw("failed to read protocol tokens", "peer", s.Conn().RemotePeer(), "error", err)
+		s.Reset()
+		return
+	}
+	tokens := peerProtocolTokens(&msg)
+
+	c := s.Conn()
+	h.protocolTokens.mx.Lock()
+	h.protocolTokens.peerTokens[c] = tokens
+	h.protocolTokens.mx.Unlock()
+	// the connection may have been closed before we stored the tokens
+	if c.IsClosed() {
+		h.protocolTokens.removeConn(c)
+	}
+}
+
+// peerProtocolTokens returns the valid tokens of msg, by protocol.
+func peerProtocolTokens(msg *pb.ProtocolTokens) map[protocol.ID]protocol.ID {
+	tokens := make(map[protocol.ID]protocol.ID, len(msg.GetTokens()))
+	protos := make(map[protocol.ID]protocol.ID, len(msg.GetTokens()))
+	ambiguous := make(map[protocol.ID]struct{})
+	for _, t := range msg.GetTokens() {
+		if len(tokens) >= maxProtocolTokens {
+			break
+		}
+		p, tok := protocol.ID(t.GetProtocol()), protocol.ID(t.GetToken())
+		// a token that isn't shorter than its protocol doesn't save anything
+		if tok == "" || len(tok) > maxTokenLen || len(tok) >= len(p) {
+			continue
+		}
+		if other, ok := protos[tok]; ok && other != p {
+			ambiguous[tok] = struct{}{}
+			continue
+		}
+		protos[tok] = p
+		tokens[p] = tok
+	}
+	// tokens offered for several protocols are ignored for all of them
+	for p, tok := range tokens {
+		if _, ok := ambiguous[tok]; ok {
+			delete(tokens, p)
+		}
+	}
+	return tokens
+}
+
+// offerProtocolTokensLoop offers our tokens on the connections to the peers that
+// support protocol tokens, once they are identified.
+func (h *BasicHost) offerProtocolTokensLoop() {
+	defer h.refCount.Done()
+
+	for {
+		select {
+		case e, ok := <-h.tokensSub.Out():
+			if !ok {
+				return
+			}
+			h.offerProtocolTokens(e.(event.EvtPeerIdentificationCompleted).Peer)
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *BasicHost) offerProtocolTokens(p peer.ID) {
+	if supported, err := h.Peerstore().SupportsProtocols(p, ProtocolTokensID); err != nil || len(supported) == 0 {
+		return
+	}
+	var conns []network.Conn
+	h.protocolTokens.mx.Lock()
+	for _, c := range h.Network().ConnsToPeer(p) {
+		if _, ok := h.protocolTokens.offered[c]; !ok {
+			h.protocolTokens.offered[c] = struct{}{}
+			conns = append(conns, c)
+		}
+	}
+	h.protocolTokens.mx.Unlock()
+	for _, c := range conns {
+		h.refCount.Add(1)
+		go func(c network.Conn) {
+			defer h.refCount.Done()
+			if err := h.sendProtocolTokens(h.ctx, c); err != nil {
+				log.Debugw("failed to offer protocol tokens", "peer", c.RemotePeer(), "error", err)
+			}
+		}(c)
+	}
+}
+
+func (h *BasicHost) sendProtocolTokens(ctx context.Context, c network.Conn) error {
+	s, err := c.NewStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := s.SetProtocol(ProtocolTokensID); err != nil {
+		s.Reset()
+		return err
+	}
+	if err := s.Scope().SetService(ProtocolTokensServiceName); err != nil {
+		s.Reset()
+		return fmt.Errorf("failed to attach stream to service %s: %w", ProtocolTokensServiceName, err)
+	}
+	s.SetDeadline(time.Now().Add(protocolTokensStreamTimeout))
+
+	msg := &pb.ProtocolTokens{Tokens: make([]*pb.ProtocolTokens_Token, 0, len(h.protocolTokens.tokens))}
+	for p, tok := range h.protocolTokens.tokens {
+		p, tok := string(p), string(tok)
+		msg.Tokens = append(msg.Tokens, &pb.ProtocolTokens_Token{Protocol: &p, Token: &tok})
+	}
+	if err := msmux.SelectProtoOrFail(ProtocolTokensID, s); err != nil {
+		s.Reset()
+		return err
+	}
+	if err := pbio.NewDelimitedWriter(s).WriteMsg(msg); err != nil {
+		s.Reset()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package basichost
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/p2p/host/relaysvc"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ReconfigureOption is a change of the configuration of a running host, see
+// BasicHost.Reconfigure.
+type ReconfigureOption func(*reconfiguration) error
+
+type reconfiguration struct {
+	watermarks   *watermarks
+	addrFilters  *addrFilterRules
+	announce     *[]ma.Multiaddr
+	relayService *bool
+}
+
+type watermarks struct{ low, high int }
+
+type addrFilterRules struct {
+	deny, allow []net.IPNet
+	defaultDeny bool
+}
+
+// Watermarks changes the low and high watermarks of the connection manager, which must
+// support it, like the connection manager of the connmgr package.
+func Watermarks(low, high int) ReconfigureOption {
+	return func(r *reconfiguration) error {
+		if low < 0 || high < 0 {
+			return errors.New("watermarks must not be negative")
+		}
+		if low > high {
+			return fmt.Errorf("low watermark %d is above the high watermark %d", low, high)
+		}
+		r.watermarks = &watermarks{low: low, high: high}
+		return nil
+	}
+}
+
+// AddrFilterRules replaces the rules of the address filters, see
+// addrfilter.Filters.Replace. The host must have been constructed with address
+// filters, see HostOpts.AddrFilters.
+func AddrFilterRules(deny, allow []net.IPNet, defaultDeny bool) ReconfigureOption {
+	return func(r *reconfiguration) error {
+		for _, s := range append(deny[:len(deny):len(deny)], allow...) {
+			if _, bits := s.Mask.Size(); bits == 0 {
+				return fmt.Errorf("invalid subnet mask: %s", s.Mask)
+			}
+		}
+		r.addrFilters = &addrFilterRules{deny: deny, allow: allow, defaultDeny: defaultDeny}
+		return nil
+	}
+}
+
+// AnnounceAddrs makes the host advertise addrs, in place of the addresses it listens
+// on. They're still processed by the AddrsFactory and the address filters. If addrs is
+// nil, the host advertises the addresses it listens on again.
+func AnnounceAddrs(addrs []ma.Multiaddr) ReconfigureOption {
+	return func(r *reconfiguration) error {
+		for _, a := range addrs {
+			if a == nil {
+				return errors.New("announce address cannot be nil")
+			}
+		}
+		if addrs != nil {
+			addrs = append(make([]ma.Multiaddr, 0, len(addrs)), addrs...)
+		}
+		r.announce = &addrs
+		return nil
+	}
+}
+
+// RelayService starts or stops the relay service. Like with
+// HostOpts.EnableRelayService, the relay only runs while the host is publicly
+// reachable.
+func RelayService(enabled bool) ReconfigureOption {
+	return func(r *reconfiguration) error {
+		r.relayService = &enabled
+		return nil
+	}
+}
+
+// Reconfigure changes the configuration of the running host. The changes are validated
+// before any of them is applied, so the host is left unchanged if Reconfigure returns an
+// error. Once they're applied, an event.EvtHostReconfigured is emitted.
+func (h *BasicHost) Reconfigure(opts ...ReconfigureOption) error {
+	var r reconfiguration
+	for _, opt := range opts {
+		if err := opt(&r); err != nil {
+			return err
+		}
+	}
+
+	if h.ctx.Err() != nil {
+		return errors.New("host is closed")
+	}
+	wm, ok := h.cmgr.(interface{ SetWatermarks(low, high int) error })
+	if r.watermarks != nil && !ok {
+		return fmt.Errorf("connection manager %T doesn't support changing its watermarks", h.cmgr)
+	}
+	if r.addrFilters != nil && h.addrFilters == nil {
+		return errors.New("the host has no address filters")
+	}
+
+	var changed []event.HostSetting
+	if r.addrFilters != nil {
+		if err := h.addrFilters.Replace(r.addrFilters.deny, r.addrFilters.allow, r.addrFilters.defaultDeny); err != nil {
+			return err
+		}
+		changed = append(changed, event.HostSettingAddrFilters)
+	}
+	if r.watermarks != nil {
+		if err := wm.SetWatermarks(r.watermarks.low, r.watermarks.high); err != nil {
+			return err
+		}
+		changed = append(changed, event.HostSettingWatermarks)
+	}
+	if r.announce != nil {
+		if *r.announce == nil {
+			h.announceAddrs.Store(nil)
+		} else {
+			h.announceAddrs.Store(r.announce)
+		}
+		h.SignalAddressChange()
+		changed = append(changed, event.HostSettingAnnounceAddrs)
+	}
+	if r.relayService != nil && h.setRelayService(*r.relayService) {
+		changed = append(changed, event.HostSettingRelayService)
+	}
+
+	if len(changed) > 0 {
+		if err := h.emitters.evtHostReconfigured.Emit(event.EvtHostReconfigured{Settings: changed}); err != nil {
+			log.Warnw("failed to emit the reconfiguration event", "error", err)
+		}
+	}
+	return nil
+}
+
+// setRelayService starts or stops the relay service. It returns false if it was already
+// in that state.
+func (h *BasicHost) setRelayService(enabled bool) bool {
+	h.relayMu.Lock()
+	defer h.relayMu.Unlock()
+	// checked under the lock, so that Close stops the service started here
+	if h.ctx.Err() != nil || enabled == (h.relayManager != nil) {
+		return false
+	}
+	if enabled {
+		h.relayManager = relaysvc.NewRelayManager(h, h.relayServiceOpts()...)
+	} else {
+		h.relayManager.Close()
+		h.relayManager = nil
+	}
+	return true
+}
+
+// RelayServiceEnabled reports whether the relay service is enabled. The relay only runs
+// while the host is publicly reachable.
+func (h *BasicHost) RelayServiceEnabled() bool {
+	h.relayMu.Lock()
+	defer h.relayMu.Unlock()
+	return h.relayManager != nil
+}
@@ -0,0 +1,105 @@
+package basichost
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/autonat"
+	"github.com/libp2p/go-libp2p/p2p/net/addrfilter"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconfigure(t *testing.T) {
+	cm, err := connmgr.NewConnManager(10, 20)
+	require.NoError(t, err)
+	filters := addrfilter.New()
+	h, err := NewHost(swarmt.GenSwarm(t), &HostOpts{ConnManager: cm, AddrFilters: filters})
+	require.NoError(t, err)
+	defer h.Close()
+	h.Start()
+	an, err := autonat.New(h, autonat.WithReachability(network.ReachabilityPublic))
+	require.NoError(t, err)
+	h.SetAutoNat(an)
+
+	sub, err := h.EventBus().Subscribe(new(event.EvtHostReconfigured))
+	require.NoError(t, err)
+	defer sub.Close()
+	next := func() event.EvtHostReconfigured {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			return e.(event.EvtHostReconfigured)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected an event")
+			return event.EvtHostReconfigured{}
+		}
+	}
+
+	announced := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	require.NoError(t, h.Reconfigure(Watermarks(1, 2), AnnounceAddrs([]ma.Multiaddr{announced})))
+	require.ElementsMatch(t, []event.HostSetting{event.HostSettingWatermarks, event.HostSettingAnnounceAddrs}, next().Settings)
+	info := cm.GetInfo()
+	require.Equal(t, 1, info.LowWater)
+	require.Equal(t, 2, info.HighWater)
+	require.Equal(t, []ma.Multiaddr{announced}, h.Addrs())
+
+	// the announced addresses are filtered
+	require.NoError(t, h.Reconfigure(AddrFilterRules([]net.IPNet{{IP: net.IPv4(1, 2, 3, 0), Mask: net.CIDRMask(24, 32)}}, nil, false)))
+	require.Equal(t, []event.HostSetting{event.HostSettingAddrFilters}, next().Settings)
+	require.Empty(t, h.Addrs())
+	require.Len(t, filters.Denied(), 1)
+
+	require.NoError(t, h.Reconfigure(AnnounceAddrs(nil)))
+	next()
+	require.ElementsMatch(t, h.Network().ListenAddresses(), h.Addrs())
+
+	require.False(t, h.RelayServiceEnabled())
+	require.NoError(t, h.Reconfigure(RelayService(true)))
+	require.Equal(t, []event.HostSetting{event.HostSettingRelayService}, next().Settings)
+	require.True(t, h.RelayServiceEnabled())
+	// the relay starts, since the host is publicly reachable
+	require.Eventually(t, func() bool {
+		for _, p := range h.Mux().Protocols() {
+			if p == "/libp2p/circuit/relay/0.2.0/hop" {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	// no change, no event
+	require.NoError(t, h.Reconfigure(RelayService(true)))
+	require.NoError(t, h.Reconfigure(RelayService(false)))
+	require.Equal(t, []event.HostSetting{event.HostSettingRelayService}, next().Settings)
+	require.False(t, h.RelayServiceEnabled())
+}
+
+func TestReconfigureValidation(t *testing.T) {
+	h, err := NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h.Close()
+	h.Start()
+
+	require.Error(t, h.Reconfigure(Watermarks(2, 1)))
+	require.Error(t, h.Reconfigure(AnnounceAddrs([]ma.Multiaddr{nil})))
+	require.Error(t, h.Reconfigure(AddrFilterRules([]net.IPNet{{IP: net.IPv4(1, 2, 3, 4)}}, nil, false)))
+	// the null connection manager doesn't have watermarks
+	require.Error(t, h.Reconfigure(Watermarks(1, 2)))
+	// the host has no address filters
+	require.Error(t, h.Reconfigure(AddrFilterRules(nil, nil, true)))
+
+	// nothing is changed if one of the changes is invalid
+	announced := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	require.Error(t, h.Reconfigure(AnnounceAddrs([]ma.Multiaddr{announced}), Watermarks(1, 2)))
+	require.NotContains(t, h.Addrs(), announced)
+
+	h.Close()
+	require.Error(t, h.Reconfigure(RelayService(true)))
+	require.False(t, h.RelayServiceEnabled())
+}
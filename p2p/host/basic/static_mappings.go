@@ -0,0 +1,177 @@
+package basichost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// DefaultStaticPortMappingVerifyInterval is the default value for
+// HostOpts.StaticPortMappingVerifyInterval.
+const DefaultStaticPortMappingVerifyInterval = 30 * time.Minute
+
+// staticMappingRetryInterval is the interval after which verification is retried if
+// it couldn't be done, e.g. because we aren't connected to AutoNAT v2 servers yet.
+const staticMappingRetryInterval = time.Minute
+
+// StaticPortMapping is a port mapping set up manually on a NAT device, e.g. a port
+// forwarding rule on a router.
+type StaticPortMapping struct {
+	// Protocol is either "tcp" or "udp".
+	Protocol string
+	// InternalPort is the port we listen on.
+	InternalPort int
+	// External is the address and port the NAT device forwards to InternalPort.
+	External netip.AddrPort
+}
+
+func (m StaticPortMapping) validate() error {
+	switch m.Protocol {
+	case "tcp", "udp":
+	default:
+		return fmt.Errorf("invalid protocol: %s", m.Protocol)
+	}
+	if m.InternalPort <= 0 || m.InternalPort > 65535 {
+		return fmt.Errorf("invalid internal port: %d", m.InternalPort)
+	}
+	if !m.External.IsValid() || m.External.Port() == 0 {
+		return fmt.Errorf("invalid external address: %s", m.External)
+	}
+	return nil
+}
+
+// staticMappingAddrs returns the external addresses of the listen addresses that are
+// mapped by a static port mapping.
+func (h *BasicHost) staticMappingAddrs(listenAddrs []ma.Multiaddr) []ma.Multiaddr {
+	if len(h.staticMappings) == 0 {
+		return nil
+	}
+	var addrs []ma.Multiaddr
+	for _, listen := range listenAddrs {
+		for _, m := range h.staticMappings {
+			if a := m.apply(listen); a != nil {
+				addrs = append(addrs, a)
+			}
+		}
+	}
+	return addrs
+}
+
+// apply returns the external address of listen if it is mapped by m, and nil otherwise.
+func (m StaticPortMapping) apply(listen ma.Multiaddr) ma.Multiaddr {
+	var found bool
+	transport, rest := ma.SplitFunc(listen, func(c ma.Component) bool {
+		if found {
+			return true
+		}
+		code := c.Protocol().Code
+		found = code == ma.P_TCP || code == ma.P_UDP
+		return false
+	})
+	if !manet.IsThinWaist(transport) {
+		return nil
+	}
+	naddr, err := manet.ToNetAddr(transport)
+	if err != nil {
+		return nil
+	}
+	var (
+		ip       net.IP
+		port     int
+		protocol string
+	)
+	switch naddr := naddr.(type) {
+	case *net.TCPAddr:
+		ip, port, protocol = naddr.IP, naddr.Port, "tcp"
+	case *net.UDPAddr:
+		ip, port, protocol = naddr.IP, naddr.Port, "udp"
+	default:
+		return nil
+	}
+	if protocol != m.Protocol || port != m.InternalPort || (ip.To4() != nil) != m.External.Addr().Unmap().Is4() {
+		return nil
+	}
+	if !ip.IsGlobalUnicast() && !ip.IsUnspecified() {
+		return nil
+	}
+
+	var extAddr net.Addr
+	ext := netip.AddrPortFrom(m.External.Addr().Unmap(), m.External.Port())
+	if protocol == "tcp" {
+		extAddr = net.TCPAddrFromAddrPort(ext)
+	} else {
+		extAddr = net.UDPAddrFromAddrPort(ext)
+	}
+	extMaddr, err := manet.FromNetAddr(extAddr)
+	if err != nil {
+		return nil
+	}
+	if rest != nil {
+		extMaddr = ma.Join(extMaddr, rest)
+	}
+	return extMaddr
+}
+
+// verifyStaticMappings periodically verifies the reachability of the addresses of the
+// static port mappings using AutoNAT v2, and warns about those that aren't reachable.
+func (h *BasicHost) verifyStaticMappings() {
+	defer h.refCount.Done()
+
+	t := time.NewTimer(staticMappingRetryInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if h.verifyStaticMappingAddrs(h.ctx) {
+				t.Reset(h.staticMappingVerifyInterval)
+			} else {
+				t.Reset(staticMappingRetryInterval)
+			}
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// verifyStaticMappingAddrs verifies the addresses of the static port mappings once. It
+// returns false if the verification should be retried soon.
+func (h *BasicHost) verifyStaticMappingAddrs(ctx context.Context) bool {
+	addrs := dedupAddrs(h.staticMappingAddrs(h.Network().ListenAddresses()))
+	done := true
+	for _, a := range addrs {
+		res, err := h.autonatv2.GetReachability(ctx, []autonatv2.Request{{Addr: a, SendDialData: true}})
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			if errors.Is(err, autonatv2.ErrNoValidPeers) {
+				log.Debugw("no AutoNAT v2 servers to verify static port mapping", "addr", a)
+			} else {
+				log.Infow("failed to verify static port mapping", "addr", a, "error", err)
+			}
+			done = false
+			h.emitters.evtStaticPortMappingVerified.Emit(event.EvtStaticPortMappingVerified{Addr: a, Error: err})
+			continue
+		}
+		switch res.Reachability {
+		case network.ReachabilityPublic:
+			log.Debugw("verified static port mapping", "addr", a)
+		case network.ReachabilityPrivate:
+			log.Warnw("static port mapping is not reachable, check the port forwarding of the NAT device", "addr", a)
+		default:
+			done = false
+		}
+		h.emitters.evtStaticPortMappingVerified.Emit(event.EvtStaticPortMappingVerified{Addr: a, Reachability: res.Reachability})
+	}
+	return done
+}
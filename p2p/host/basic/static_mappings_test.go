@@ -0,0 +1,92 @@
+package basichost
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticPortMappingApply(t *testing.T) {
+	m := StaticPortMapping{Protocol: "udp", InternalPort: 1234, External: netip.MustParseAddrPort("1.2.3.4:4321")}
+	for _, tc := range []struct {
+		listen, mapped string
+	}{
+		{"/ip4/0.0.0.0/udp/1234/quic-v1", "/ip4/1.2.3.4/udp/4321/quic-v1"},
+		{"/ip4/192.168.1.2/udp/1234/quic-v1/webtransport", "/ip4/1.2.3.4/udp/4321/quic-v1/webtransport"},
+		{"/ip4/0.0.0.0/udp/1235/quic-v1", ""},
+		{"/ip4/0.0.0.0/tcp/1234", ""},
+		{"/ip6/::/udp/1234/quic-v1", ""},
+		{"/ip4/127.0.0.1/udp/1234/quic-v1", ""},
+	} {
+		got := m.apply(ma.StringCast(tc.listen))
+		if tc.mapped == "" {
+			require.Nil(t, got, tc.listen)
+		} else {
+			require.Equal(t, ma.StringCast(tc.mapped), got, tc.listen)
+		}
+	}
+}
+
+func TestStaticPortMappingValidation(t *testing.T) {
+	for _, m := range []StaticPortMapping{
+		{Protocol: "sctp", InternalPort: 1234, External: netip.MustParseAddrPort("1.2.3.4:4321")},
+		{Protocol: "tcp", InternalPort: 0, External: netip.MustParseAddrPort("1.2.3.4:4321")},
+		{Protocol: "tcp", InternalPort: 1234},
+	} {
+		_, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), &HostOpts{StaticPortMappings: []StaticPortMapping{m}})
+		require.Error(t, err)
+	}
+}
+
+func TestStaticPortMappingAddrs(t *testing.T) {
+	h, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), nil)
+	require.NoError(t, err)
+	defer h.Close()
+	require.NoError(t, h.Network().Listen(ma.StringCast("/ip4/0.0.0.0/tcp/0")))
+	port, err := h.Network().ListenAddresses()[0].ValueForProtocol(ma.P_TCP)
+	require.NoError(t, err)
+	require.NotContains(t, h.AllAddrs(), ma.StringCast("/ip4/1.2.3.4/tcp/4321"))
+
+	pm := StaticPortMapping{Protocol: "tcp", External: netip.MustParseAddrPort("1.2.3.4:4321")}
+	pm.InternalPort, err = strconv.Atoi(port)
+	require.NoError(t, err)
+	h.staticMappings = []StaticPortMapping{pm}
+	require.Contains(t, h.AllAddrs(), ma.StringCast("/ip4/1.2.3.4/tcp/4321"))
+}
+
+func TestVerifyStaticPortMappingsWithoutServers(t *testing.T) {
+	h, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), &HostOpts{
+		EnableAutoNATv2:    true,
+		StaticPortMappings: []StaticPortMapping{{Protocol: "tcp", InternalPort: 1, External: netip.MustParseAddrPort("1.2.3.4:4321")}},
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	sub, err := h.EventBus().Subscribe(new(event.EvtStaticPortMappingVerified))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	require.NoError(t, h.Network().Listen(ma.StringCast("/ip4/0.0.0.0/tcp/0")))
+	port, err := h.Network().ListenAddresses()[0].ValueForProtocol(ma.P_TCP)
+	require.NoError(t, err)
+	h.staticMappings[0].InternalPort, err = strconv.Atoi(port)
+	require.NoError(t, err)
+
+	require.False(t, h.verifyStaticMappingAddrs(context.Background()), "expected verification to be retried")
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtStaticPortMappingVerified)
+		require.Equal(t, ma.StringCast("/ip4/1.2.3.4/tcp/4321"), evt.Addr)
+		require.ErrorIs(t, evt.Error, autonatv2.ErrNoValidPeers)
+	case <-time.After(time.Second):
+		t.Fatal("expected a verification event")
+	}
+}
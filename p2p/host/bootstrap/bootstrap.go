@@ -0,0 +1,339 @@
+// Package bootstrap implements a service that keeps a node connected to the network
+// by dialing a set of bootstrap peers whenever it is connected to fewer than a
+// minimum number of peers.
+package bootstrap
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/backoff"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+var log = logging.Logger("bootstrap")
+
+type bootstrapPeer struct {
+	info peer.AddrInfo
+	// owned are the addresses of info that weren't in the peerstore before they were
+	// added by the bootstrapper. Only these are removed from the peerstore when they
+	// disappear.
+	owned    []ma.Multiaddr
+	backoff  backoff.BackoffStrategy
+	dialing  bool
+	failures int
+	lastErr  error
+	nextDial time.Time
+}
+
+// Bootstrapper keeps the host connected to at least a minimum number of peers by
+// dialing bootstrap peers.
+type Bootstrapper struct {
+	host       host.Host
+	conf       *config
+	newBackoff backoff.BackoffFactory
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	refCount  sync.WaitGroup
+	trigger   chan struct{}
+	emitter   event.Emitter
+
+	mx    sync.Mutex
+	peers map[peer.ID]*bootstrapPeer
+	// static are the bootstrap peers that were configured with /p2p addresses.
+	static   []peer.AddrInfo
+	dnsAddrs []ma.Multiaddr
+	// resolved maps the /dnsaddr addresses to the peers they resolved to the last time
+	// they were resolved successfully.
+	resolved    map[string][]peer.AddrInfo
+	resolving   bool
+	lastRefresh time.Time
+	checked     bool
+	healthy     bool
+}
+
+// New creates a Bootstrapper for h. It doesn't dial any peers until Start is called.
+func New(h host.Host, opts ...Option) (*Bootstrapper, error) {
+	conf := defaultConfig
+	for _, opt := range opts {
+		if err := opt(&conf); err != nil {
+			return nil, err
+		}
+	}
+	if len(conf.addrs) == 0 {
+		return nil, errNoPeers
+	}
+	if conf.resolver == nil {
+		conf.resolver = madns.DefaultResolver
+	}
+
+	b := &Bootstrapper{
+		host:       h,
+		conf:       &conf,
+		newBackoff: backoff.NewExponentialBackoff(conf.minBackoff, conf.maxBackoff, backoff.FullJitter, conf.minBackoff, 2, 0, rand.NewSource(time.Now().UnixNano())),
+		trigger:    make(chan struct{}, 1),
+		peers:      make(map[peer.ID]*bootstrapPeer),
+		resolved:   make(map[string][]peer.AddrInfo),
+	}
+	var p2pAddrs []ma.Multiaddr
+	for _, a := range conf.addrs {
+		if isDNSAddr(a) {
+			b.dnsAddrs = append(b.dnsAddrs, a)
+		} else {
+			p2pAddrs = append(p2pAddrs, a)
+		}
+	}
+	var err error
+	b.static, err = peer.AddrInfosFromP2pAddrs(p2pAddrs...)
+	if err != nil {
+		return nil, err
+	}
+	b.updatePeers()
+
+	b.emitter, err = h.EventBus().Emitter(new(event.EvtBootstrapStatusChanged), eventbus.Stateful)
+	if err != nil {
+		return nil, err
+	}
+	b.ctx, b.ctxCancel = context.WithCancel(context.Background())
+	return b, nil
+}
+
+// Start starts maintaining the connectivity.
+func (b *Bootstrapper) Start() {
+	b.refCount.Add(1)
+	go b.background()
+}
+
+func (b *Bootstrapper) Close() error {
+	b.ctxCancel()
+	b.refCount.Wait()
+	return b.emitter.Close()
+}
+
+func (b *Bootstrapper) background() {
+	defer b.refCount.Done()
+
+	sub, err := b.host.EventBus().Subscribe(new(event.EvtPeerConnectednessChanged), eventbus.Name("bootstrap"))
+	if err != nil {
+		log.Errorf("failed to subscribe to connectedness events: %s", err)
+		return
+	}
+	defer sub.Close()
+
+	t := time.NewTicker(b.conf.checkInterval)
+	defer t.Stop()
+
+	b.check()
+	for {
+		select {
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			switch e.(event.EvtPeerConnectednessChanged).Connectedness {
+			case network.Connected:
+				// If this is our first connection, we were probably offline. Don't wait
+				// for the backoff of the bootstrap peers we failed to dial meanwhile.
+				if len(b.host.Network().Peers()) == 1 {
+					b.resetBackoffs()
+					b.check()
+				}
+			case network.NotConnected:
+				b.check()
+			}
+		case <-b.trigger:
+			b.check()
+		case <-t.C:
+			b.check()
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// check dials bootstrap peers if we are connected to fewer than the minimum number of
+// peers, and emits an event if this changed since the last check.
+func (b *Bootstrapper) check() {
+	connected := len(b.host.Network().Peers())
+	now := time.Now()
+
+	b.mx.Lock()
+	if !b.resolving && (len(b.unresolvedLocked()) > 0 || b.refreshDueLocked(now)) {
+		b.resolving = true
+		b.refCount.Add(1)
+		go b.resolve()
+	}
+
+	var bootstrapConnected, dialing int
+	var candidates []*bootstrapPeer
+	for _, p := range b.peers {
+		switch {
+		case b.host.Network().Connectedness(p.info.ID) == network.Connected:
+			bootstrapConnected++
+		case p.dialing:
+			dialing++
+		case !now.Before(p.nextDial):
+			candidates = append(candidates, p)
+		}
+	}
+	isHealthy := connected >= b.conf.minPeers
+	if !isHealthy {
+		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		for _, p := range candidates[:min(len(candidates), max(0, b.conf.minPeers-connected-dialing))] {
+			p.dialing = true
+			b.refCount.Add(1)
+			go b.dial(p.info)
+		}
+	}
+	changed := !b.checked || isHealthy != b.healthy
+	b.checked = true
+	b.healthy = isHealthy
+	b.mx.Unlock()
+
+	if b.conf.metricsTracer != nil {
+		b.conf.metricsTracer.ConnectivityChecked(connected, bootstrapConnected, isHealthy)
+	}
+	if changed {
+		if isHealthy {
+			log.Debugw("connected to enough peers", "peers", connected)
+		} else {
+			log.Infow("connected to too few peers, dialing bootstrap peers", "peers", connected, "min", b.conf.minPeers)
+		}
+		b.emitter.Emit(event.EvtBootstrapStatusChanged{
+			Healthy:                 isHealthy,
+			ConnectedPeers:          connected,
+			ConnectedBootstrapPeers: bootstrapConnected,
+		})
+	}
+}
+
+func (b *Bootstrapper) dial(info peer.AddrInfo) {
+	defer b.refCount.Done()
+
+	ctx, cancel := context.WithTimeout(b.ctx, b.conf.dialTimeout)
+	defer cancel()
+	err := b.host.Connect(ctx, info)
+	if b.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Debugw("failed to dial bootstrap peer", "peer", info.ID, "error", err)
+	}
+	if b.conf.metricsTracer != nil {
+		b.conf.metricsTracer.DialFinished(err == nil)
+	}
+
+	b.mx.Lock()
+	if p, ok := b.peers[info.ID]; ok {
+		p.dialing = false
+		if err != nil {
+			p.failures++
+			p.lastErr = err
+			p.nextDial = time.Now().Add(p.backoff.Delay())
+		} else {
+			p.failures = 0
+			p.lastErr = nil
+			p.nextDial = time.Time{}
+			p.backoff.Reset()
+		}
+	}
+	b.mx.Unlock()
+	b.triggerCheck()
+}
+
+func (b *Bootstrapper) triggerCheck() {
+	select {
+	case b.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Bootstrapper) resetBackoffs() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	for _, p := range b.peers {
+		p.backoff.Reset()
+		p.nextDial = time.Time{}
+	}
+}
+
+// Status is a snapshot of the state of the Bootstrapper.
+type Status struct {
+	// Healthy is true if we were connected to at least MinPeers peers at the last check.
+	Healthy bool
+	// ConnectedPeers is the number of peers we are connected to.
+	ConnectedPeers int
+	// MinPeers is the configured minimum number of peers.
+	MinPeers int
+	// Peers are the bootstrap peers, sorted by peer ID.
+	Peers []PeerStatus
+	// Unresolved are the /dnsaddr bootstrap addresses that couldn't be resolved yet.
+	Unresolved []ma.Multiaddr
+	// LastRefresh is the time the /dnsaddr bootstrap addresses were last re-resolved.
+	LastRefresh time.Time
+}
+
+// PeerStatus describes a bootstrap peer.
+type PeerStatus struct {
+	peer.AddrInfo
+	Connected bool
+	// Failures is the number of consecutive failed dials.
+	Failures int
+	// LastError is the error of the last failed dial, it is nil if the last dial
+	// succeeded.
+	LastError error
+	// NextDial is the time the backoff after the last failed dial ends.
+	NextDial time.Time
+}
+
+// Status returns a snapshot of the current state of the Bootstrapper.
+func (b *Bootstrapper) Status() Status {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	s := Status{
+		Healthy:        b.healthy,
+		ConnectedPeers: len(b.host.Network().Peers()),
+		MinPeers:       b.conf.minPeers,
+		Peers:          make([]PeerStatus, 0, len(b.peers)),
+		Unresolved:     b.unresolvedLocked(),
+		LastRefresh:    b.lastRefresh,
+	}
+	for _, p := range b.peers {
+		s.Peers = append(s.Peers, PeerStatus{
+			AddrInfo:  peer.AddrInfo{ID: p.info.ID, Addrs: append([]ma.Multiaddr(nil), p.info.Addrs...)},
+			Connected: b.host.Network().Connectedness(p.info.ID) == network.Connected,
+			Failures:  p.failures,
+			LastError: p.lastErr,
+			NextDial:  p.nextDial,
+		})
+	}
+	sort.Slice(s.Peers, func(i, j int) bool { return s.Peers[i].ID < s.Peers[j].ID })
+	return s
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
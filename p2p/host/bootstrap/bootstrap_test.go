@@ -0,0 +1,246 @@
+package bootstrap
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+	"github.com/stretchr/testify/require"
+)
+
+func newHost(t *testing.T) host.Host {
+	t.Helper()
+	h := bhost.NewBlankHost(swarmt.GenSwarm(t))
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func p2pAddr(t *testing.T, h host.Host) ma.Multiaddr {
+	t.Helper()
+	addrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	require.NoError(t, err)
+	return addrs[0]
+}
+
+func newBootstrapper(t *testing.T, h host.Host, opts ...Option) *Bootstrapper {
+	t.Helper()
+	opts = append([]Option{WithCheckInterval(50 * time.Millisecond), WithBackoff(50*time.Millisecond, 200*time.Millisecond)}, opts...)
+	b, err := New(h, opts...)
+	require.NoError(t, err)
+	b.Start()
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestBootstrap(t *testing.T) {
+	var addrs []ma.Multiaddr
+	for i := 0; i < 4; i++ {
+		addrs = append(addrs, p2pAddr(t, newHost(t)))
+	}
+	h := newHost(t)
+	sub, err := h.EventBus().Subscribe(new(event.EvtBootstrapStatusChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	b := newBootstrapper(t, h, WithPeers(addrs...), WithMinPeers(2))
+	require.Eventually(t, func() bool { return b.Status().Healthy }, 5*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, len(h.Network().Peers()), 2)
+
+	s := b.Status()
+	require.Len(t, s.Peers, 4)
+	require.Equal(t, 2, s.MinPeers)
+	var connected int
+	for _, p := range s.Peers {
+		if p.Connected {
+			connected++
+		}
+		require.Zero(t, p.Failures)
+	}
+	require.Equal(t, len(h.Network().Peers()), connected)
+
+	var evts []event.EvtBootstrapStatusChanged
+	require.Eventually(t, func() bool {
+		select {
+		case e := <-sub.Out():
+			evts = append(evts, e.(event.EvtBootstrapStatusChanged))
+		default:
+		}
+		return len(evts) > 0 && evts[len(evts)-1].Healthy
+	}, 5*time.Second, 10*time.Millisecond)
+	require.False(t, evts[0].Healthy)
+}
+
+func TestReconnect(t *testing.T) {
+	bootstrap := newHost(t)
+	h := newHost(t)
+	newBootstrapper(t, h, WithPeers(p2pAddr(t, bootstrap)), WithMinPeers(1))
+	require.Eventually(t, func() bool {
+		return h.Network().Connectedness(bootstrap.ID()) == network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, h.Network().ClosePeer(bootstrap.ID()))
+	require.Eventually(t, func() bool {
+		return h.Network().Connectedness(bootstrap.ID()) == network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBackoff(t *testing.T) {
+	h := newHost(t)
+	id := test.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/127.0.0.1/tcp/1/p2p/" + id.String())
+	b := newBootstrapper(t, h, WithPeers(addr), WithDialTimeout(time.Second))
+
+	require.Eventually(t, func() bool {
+		s := b.Status()
+		return s.Peers[0].Failures >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	s := b.Status()
+	require.False(t, s.Healthy)
+	require.Equal(t, id, s.Peers[0].ID)
+	require.False(t, s.Peers[0].Connected)
+	require.Error(t, s.Peers[0].LastError)
+}
+
+func TestDNSAddr(t *testing.T) {
+	h1 := newHost(t)
+	h2 := newHost(t)
+	resolver, err := madns.NewResolver(madns.WithDefaultResolver(&madns.MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.bootstrap.example.com": {"dnsaddr=" + p2pAddr(t, h1).String(), "dnsaddr=/dnsaddr/nested.example.com"},
+			"_dnsaddr.nested.example.com":    {"dnsaddr=" + p2pAddr(t, h2).String()},
+		},
+	}))
+	require.NoError(t, err)
+
+	h := newHost(t)
+	b := newBootstrapper(t, h,
+		WithPeers(ma.StringCast("/dnsaddr/bootstrap.example.com"), ma.StringCast("/dnsaddr/unknown.example.com")),
+		WithResolver(resolver),
+		WithMinPeers(2),
+	)
+	require.Eventually(t, func() bool { return b.Status().Healthy }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, network.Connected, h.Network().Connectedness(h1.ID()))
+	require.Equal(t, network.Connected, h.Network().Connectedness(h2.ID()))
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/dnsaddr/unknown.example.com")}, b.Status().Unresolved)
+}
+
+// txtResolver is a resolver with TXT records that can be changed while it is used.
+type txtResolver struct {
+	mx  sync.Mutex
+	txt map[string][]string
+}
+
+func (r *txtResolver) set(name string, records ...string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.txt[name] = records
+}
+
+func (r *txtResolver) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	return nil, nil
+}
+
+func (r *txtResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.txt[name], nil
+}
+
+func TestDNSAddrRefresh(t *testing.T) {
+	h1 := newHost(t)
+	h2 := newHost(t)
+	r := &txtResolver{txt: make(map[string][]string)}
+	r.set("_dnsaddr.bootstrap.example.com", "dnsaddr="+p2pAddr(t, h1).String())
+	resolver, err := madns.NewResolver(madns.WithDefaultResolver(r))
+	require.NoError(t, err)
+
+	h := newHost(t)
+	b := newBootstrapper(t, h,
+		WithPeers(ma.StringCast("/dnsaddr/bootstrap.example.com")),
+		WithResolver(resolver),
+		WithMinPeers(1),
+		WithDNSAddrRefreshInterval(100*time.Millisecond),
+	)
+	require.Eventually(t, func() bool { return b.Status().Healthy }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, network.Connected, h.Network().Connectedness(h1.ID()))
+	require.Equal(t, p2pAddr(t, h1).Decapsulate(ma.StringCast("/p2p/"+h1.ID().String())), h.Peerstore().Addrs(h1.ID())[0])
+
+	// h1 moves to a new address
+	oldAddr := h1.Addrs()[0]
+	newAddr := ma.StringCast("/ip4/127.0.0.1/udp/1234/quic-v1")
+	r.set("_dnsaddr.bootstrap.example.com", "dnsaddr="+newAddr.String()+"/p2p/"+h1.ID().String())
+	require.Eventually(t, func() bool {
+		addrs := h.Peerstore().Addrs(h1.ID())
+		return ma.Contains(addrs, newAddr) && !ma.Contains(addrs, oldAddr)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// h1 is replaced by h2
+	r.set("_dnsaddr.bootstrap.example.com", "dnsaddr="+p2pAddr(t, h2).String())
+	require.Eventually(t, func() bool {
+		s := b.Status()
+		return len(s.Peers) == 1 && s.Peers[0].ID == h2.ID()
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, h.Peerstore().Addrs(h1.ID()))
+	require.False(t, b.Status().LastRefresh.IsZero())
+
+	// failing lookups keep the last result
+	r.set("_dnsaddr.bootstrap.example.com")
+	time.Sleep(300 * time.Millisecond)
+	s := b.Status()
+	require.Len(t, s.Peers, 1)
+	require.Equal(t, h2.ID(), s.Peers[0].ID)
+	require.Empty(t, s.Unresolved)
+}
+
+func TestDNSAddrKeepsKnownAddrs(t *testing.T) {
+	h1 := newHost(t)
+	h2 := newHost(t)
+	r := &txtResolver{txt: make(map[string][]string)}
+	r.set("_dnsaddr.bootstrap.example.com", "dnsaddr="+p2pAddr(t, h1).String())
+	resolver, err := madns.NewResolver(madns.WithDefaultResolver(r))
+	require.NoError(t, err)
+
+	// the address of h1 was learned from elsewhere
+	h := newHost(t)
+	h.Peerstore().AddAddr(h1.ID(), h1.Addrs()[0], time.Hour)
+	b := newBootstrapper(t, h,
+		WithPeers(ma.StringCast("/dnsaddr/bootstrap.example.com")),
+		WithResolver(resolver),
+		WithMinPeers(1),
+		WithDNSAddrRefreshInterval(100*time.Millisecond),
+	)
+	require.Eventually(t, func() bool { return b.Status().Healthy }, 5*time.Second, 10*time.Millisecond)
+
+	r.set("_dnsaddr.bootstrap.example.com", "dnsaddr="+p2pAddr(t, h2).String())
+	require.Eventually(t, func() bool {
+		s := b.Status()
+		return len(s.Peers) == 1 && s.Peers[0].ID == h2.ID()
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []ma.Multiaddr{h1.Addrs()[0]}, h.Peerstore().Addrs(h1.ID()))
+}
+
+func TestInvalidOptions(t *testing.T) {
+	h := newHost(t)
+	_, err := New(h)
+	require.ErrorIs(t, err, errNoPeers)
+	_, err = New(h, WithPeers(ma.StringCast("/ip4/1.2.3.4/tcp/1")))
+	require.Error(t, err)
+	_, err = New(h, WithPeerInfos(peer.AddrInfo{ID: test.RandPeerIDFatal(t)}))
+	require.Error(t, err)
+	_, err = New(h, WithPeers(p2pAddr(t, newHost(t))), WithMinPeers(0))
+	require.Error(t, err)
+	_, err = New(h, WithPeers(p2pAddr(t, newHost(t))), WithDNSAddrRefreshInterval(0))
+	require.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package bootstrap
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+// maxDNSAddrDepth is the maximum number of nested /dnsaddr lookups.
+const maxDNSAddrDepth = 4
+
+func isDNSAddr(a ma.Multiaddr) bool {
+	first, _ := ma.SplitFirst(a)
+	return first != nil && first.Protocol().Code == ma.P_DNSADDR
+}
+
+// unresolvedLocked returns the /dnsaddr addresses that were never resolved
+// successfully.
+func (b *Bootstrapper) unresolvedLocked() []ma.Multiaddr {
+	var unresolved []ma.Multiaddr
+	for _, a := range b.dnsAddrs {
+		if _, ok := b.resolved[string(a.Bytes())]; !ok {
+			unresolved = append(unresolved, a)
+		}
+	}
+	return unresolved
+}
+
+func (b *Bootstrapper) refreshDueLocked(now time.Time) bool {
+	return len(b.dnsAddrs) > 0 && now.Sub(b.lastRefresh) >= b.conf.dnsAddrRefreshInterval
+}
+
+// resolve re-resolves all /dnsaddr bootstrap addresses if a refresh is due, and only
+// the unresolved ones otherwise. If an address can't be resolved, the peers it
+// resolved to before are kept.
+func (b *Bootstrapper) resolve() {
+	defer b.refCount.Done()
+
+	now := time.Now()
+	b.mx.Lock()
+	addrs := b.unresolvedLocked()
+	refresh := b.refreshDueLocked(now)
+	if refresh {
+		addrs = b.dnsAddrs
+		b.lastRefresh = now
+	}
+	b.mx.Unlock()
+
+	resolved := make(map[string][]peer.AddrInfo, len(addrs))
+	for _, a := range addrs {
+		ctx, cancel := context.WithTimeout(b.ctx, b.conf.dialTimeout)
+		res, err := resolveDNSAddr(ctx, b.conf.resolver, a, maxDNSAddrDepth)
+		cancel()
+		if b.ctx.Err() != nil {
+			return
+		}
+		if err != nil || len(res) == 0 {
+			log.Debugw("failed to resolve bootstrap address", "addr", a, "error", err)
+			continue
+		}
+		infos, err := peer.AddrInfosFromP2pAddrs(res...)
+		if err != nil {
+			log.Debugw("resolved invalid bootstrap addresses", "addr", a, "error", err)
+			continue
+		}
+		resolved[string(a.Bytes())] = infos
+	}
+
+	b.mx.Lock()
+	for k, infos := range resolved {
+		b.resolved[k] = infos
+	}
+	changed := b.updatePeers()
+	b.resolving = false
+	b.mx.Unlock()
+	if changed {
+		b.triggerCheck()
+	}
+}
+
+// updatePeers updates the bootstrap peers from the static peers and the last
+// resolution results, keeping the backoff state of the peers that remain. The
+// addresses of new peers are added to the peerstore, and the addresses that
+// disappeared are removed from it, unless they were known before they were added.
+// It returns true if the peers changed.
+func (b *Bootstrapper) updatePeers() bool {
+	addrs := make(map[peer.ID][]ma.Multiaddr)
+	add := func(infos []peer.AddrInfo) {
+		for _, info := range infos {
+			if info.ID == b.host.ID() {
+				continue
+			}
+			for _, a := range info.Addrs {
+				if !ma.Contains(addrs[info.ID], a) {
+					addrs[info.ID] = append(addrs[info.ID], a)
+				}
+			}
+			if _, ok := addrs[info.ID]; !ok {
+				addrs[info.ID] = nil
+			}
+		}
+	}
+	add(b.static)
+	for _, a := range b.dnsAddrs {
+		add(b.resolved[string(a.Bytes())])
+	}
+
+	ps := b.host.Peerstore()
+	ttl := 2 * b.conf.dnsAddrRefreshInterval
+	var changed bool
+	for id, p := range b.peers {
+		if _, ok := addrs[id]; !ok {
+			log.Debugw("removing bootstrap peer", "peer", id)
+			for _, a := range p.owned {
+				ps.SetAddr(id, a, 0)
+			}
+			delete(b.peers, id)
+			changed = true
+		}
+	}
+	for id, as := range addrs {
+		p, ok := b.peers[id]
+		if !ok {
+			p = &bootstrapPeer{info: peer.AddrInfo{ID: id}, backoff: b.newBackoff()}
+			b.peers[id] = p
+			changed = true
+		}
+		owned := p.owned[:0]
+		for _, a := range p.owned {
+			if ma.Contains(as, a) {
+				owned = append(owned, a)
+			} else {
+				ps.SetAddr(id, a, 0)
+			}
+		}
+		for _, a := range p.info.Addrs {
+			if !ma.Contains(as, a) {
+				changed = true
+			}
+		}
+		known := ps.Addrs(id)
+		for _, a := range as {
+			if !ma.Contains(p.info.Addrs, a) {
+				changed = true
+				if !ma.Contains(known, a) {
+					owned = append(owned, a)
+				}
+			}
+		}
+		peerstore.AddAddrsWithSource(ps, id, as, ttl, peerstore.AddrSourceManual)
+		p.info.Addrs = as
+		p.owned = owned
+	}
+	return changed
+}
+
+// resolveDNSAddr resolves a, following nested /dnsaddr addresses up to depth levels.
+// Addresses without a /p2p component are dropped.
+func resolveDNSAddr(ctx context.Context, r *madns.Resolver, a ma.Multiaddr, depth int) ([]ma.Multiaddr, error) {
+	res, err := r.Resolve(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []ma.Multiaddr
+	for _, ra := range res {
+		if isDNSAddr(ra) {
+			if depth > 1 {
+				nested, err := resolveDNSAddr(ctx, r, ra, depth-1)
+				if err != nil {
+					log.Debugw("failed to resolve nested dnsaddr", "addr", ra, "error", err)
+				}
+				addrs = append(addrs, nested...)
+			}
+			continue
+		}
+		if _, err := ra.ValueForProtocol(ma.P_P2P); err != nil {
+			continue
+		}
+		addrs = append(addrs, ra)
+	}
+	return addrs, nil
+}
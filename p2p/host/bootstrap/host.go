@@ -0,0 +1,34 @@
+package bootstrap
+
+import (
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// Host wraps a host, to start and close a Bootstrapper along with it.
+type Host struct {
+	host.Host
+	b *Bootstrapper
+}
+
+func NewHost(h host.Host, b *Bootstrapper) *Host {
+	return &Host{Host: h, b: b}
+}
+
+// Unwrap returns the wrapped host.
+func (h *Host) Unwrap() host.Host {
+	return h.Host
+}
+
+func (h *Host) Start() {
+	h.b.Start()
+}
+
+func (h *Host) Close() error {
+	_ = h.b.Close()
+	return h.Host.Close()
+}
+
+// Bootstrapper returns the bootstrapper of the host.
+func (h *Host) Bootstrapper() *Bootstrapper {
+	return h.b
+}
@@ -0,0 +1,104 @@
+package bootstrap
+
+import (
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricNamespace = "libp2p_bootstrap"
+
+var (
+	dialsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "dials_total",
+			Help:      "Dials to Bootstrap Peers by Outcome",
+		},
+		[]string{"outcome"},
+	)
+	connectedPeers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "connected_peers",
+			Help:      "Connected Peers",
+		},
+	)
+	connectedBootstrapPeers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "connected_bootstrap_peers",
+			Help:      "Connected Bootstrap Peers",
+		},
+	)
+	healthy = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "healthy",
+			Help:      "1 if connected to at least the minimum number of peers",
+		},
+	)
+	collectors = []prometheus.Collector{
+		dialsTotal,
+		connectedPeers,
+		connectedBootstrapPeers,
+		healthy,
+	}
+)
+
+// MetricsTracer is the interface for tracking metrics for the bootstrapper
+type MetricsTracer interface {
+	// DialFinished is called when a dial to a bootstrap peer ends.
+	DialFinished(success bool)
+	// ConnectivityChecked is called after every check of the connectivity.
+	ConnectivityChecked(peers, bootstrapPeers int, isHealthy bool)
+}
+
+type metricsTracer struct{}
+
+var _ MetricsTracer = &metricsTracer{}
+
+type metricsTracerSetting struct {
+	reg prometheus.Registerer
+}
+
+type MetricsTracerOption func(*metricsTracerSetting)
+
+func WithRegisterer(reg prometheus.Registerer) MetricsTracerOption {
+	return func(s *metricsTracerSetting) {
+		if reg != nil {
+			s.reg = reg
+		}
+	}
+}
+
+func NewMetricsTracer(opts ...MetricsTracerOption) MetricsTracer {
+	setting := &metricsTracerSetting{reg: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(setting)
+	}
+	metricshelper.RegisterCollectors(setting.reg, collectors...)
+	dialsTotal.WithLabelValues("success")
+	dialsTotal.WithLabelValues("failed")
+	return &metricsTracer{}
+}
+
+func (mt *metricsTracer) DialFinished(success bool) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	if success {
+		*tags = append(*tags, "success")
+	} else {
+		*tags = append(*tags, "failed")
+	}
+	dialsTotal.WithLabelValues(*tags...).Inc()
+}
+
+func (mt *metricsTracer) ConnectivityChecked(peers, bootstrapPeers int, isHealthy bool) {
+	connectedPeers.Set(float64(peers))
+	connectedBootstrapPeers.Set(float64(bootstrapPeers))
+	if isHealthy {
+		healthy.Set(1)
+	} else {
+		healthy.Set(0)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build nocover
+
+package bootstrap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMetricsNoAllocNoCover(t *testing.T) {
+	tr := NewMetricsTracer()
+	tests := map[string]func(){
+		"DialFinished":        func() { tr.DialFinished(rand.Intn(2) == 1) },
+		"ConnectivityChecked": func() { tr.ConnectivityChecked(rand.Intn(10), rand.Intn(10), rand.Intn(2) == 1) },
+	}
+	for method, f := range tests {
+		allocs := testing.AllocsPerRun(1000, f)
+		if allocs > 0 {
+			t.Fatalf("Alloc Test: %s, got: %0.2f, expected: 0 allocs", method, allocs)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+type config struct {
+	// addrs are the /p2p and /dnsaddr addresses of the bootstrap peers
+	addrs []ma.Multiaddr
+	// see WithMinPeers
+	minPeers int
+	// see WithCheckInterval
+	checkInterval time.Duration
+	// see WithBackoff
+	minBackoff, maxBackoff time.Duration
+	// see WithDialTimeout
+	dialTimeout time.Duration
+	// see WithResolver
+	resolver *madns.Resolver
+	// see WithDNSAddrRefreshInterval
+	dnsAddrRefreshInterval time.Duration
+	// see WithMetricsTracer
+	metricsTracer MetricsTracer
+}
+
+var defaultConfig = config{
+	minPeers:      4,
+	checkInterval: 30 * time.Second,
+	minBackoff:    5 * time.Second,
+	maxBackoff:    10 * time.Minute,
+	dialTimeout:   15 * time.Second,
+
+	dnsAddrRefreshInterval: time.Hour,
+}
+
+var errNoPeers = errors.New("no bootstrap peers configured")
+
+type Option func(*config) error
+
+// WithPeers adds bootstrap peers. The addresses must either end with a /p2p component,
+// or be /dnsaddr addresses that resolve to such addresses.
+func WithPeers(addrs ...ma.Multiaddr) Option {
+	return func(c *config) error {
+		for _, a := range addrs {
+			if first, _ := ma.SplitFirst(a); first != nil && first.Protocol().Code == ma.P_DNSADDR {
+				continue
+			}
+			if _, err := peer.AddrInfoFromP2pAddr(a); err != nil {
+				return fmt.Errorf("invalid bootstrap address %s: %w", a, err)
+			}
+		}
+		c.addrs = append(c.addrs, addrs...)
+		return nil
+	}
+}
+
+// WithPeerInfos adds bootstrap peers.
+func WithPeerInfos(infos ...peer.AddrInfo) Option {
+	return func(c *config) error {
+		for _, info := range infos {
+			if len(info.Addrs) == 0 {
+				return fmt.Errorf("no addresses for bootstrap peer %s", info.ID)
+			}
+			addrs, err := peer.AddrInfoToP2pAddrs(&info)
+			if err != nil {
+				return err
+			}
+			c.addrs = append(c.addrs, addrs...)
+		}
+		return nil
+	}
+}
+
+// WithMinPeers sets the number of connected peers below which the Bootstrapper dials
+// bootstrap peers. Connections to any peer count, not only to bootstrap peers.
+func WithMinPeers(n int) Option {
+	return func(c *config) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid minimum number of peers: %d", n)
+		}
+		c.minPeers = n
+		return nil
+	}
+}
+
+// WithCheckInterval sets the interval at which the connectivity is checked. The
+// connectivity is also checked whenever we disconnect from a peer.
+func WithCheckInterval(d time.Duration) Option {
+	return func(c *config) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid check interval: %s", d)
+		}
+		c.checkInterval = d
+		return nil
+	}
+}
+
+// WithBackoff sets the bounds of the exponential backoff after failed dials to a
+// bootstrap peer. The backoff of all bootstrap peers is reset when we connect to a
+// peer while we are below the minimum number of peers, e.g. after a network outage.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *config) error {
+		if min <= 0 || max < min {
+			return fmt.Errorf("invalid backoff: [%s, %s]", min, max)
+		}
+		c.minBackoff, c.maxBackoff = min, max
+		return nil
+	}
+}
+
+// WithDialTimeout sets the timeout for dialing a bootstrap peer.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *config) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid dial timeout: %s", d)
+		}
+		c.dialTimeout = d
+		return nil
+	}
+}
+
+// WithResolver sets the resolver used to resolve /dnsaddr bootstrap addresses.
+func WithResolver(r *madns.Resolver) Option {
+	return func(c *config) error {
+		c.resolver = r
+		return nil
+	}
+}
+
+// WithDNSAddrRefreshInterval sets the interval at which the /dnsaddr bootstrap
+// addresses are re-resolved. Peers that are no longer returned are removed, and
+// their stale addresses are removed from the peerstore. If an address fails to
+// resolve, the peers it resolved to before are kept.
+func WithDNSAddrRefreshInterval(d time.Duration) Option {
+	return func(c *config) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid dnsaddr refresh interval: %s", d)
+		}
+		c.dnsAddrRefreshInterval = d
+		return nil
+	}
+}
+
+func WithMetricsTracer(mt MetricsTracer) Option {
+	return func(c *config) error {
+		c.metricsTracer = mt
+		return nil
+	}
+}
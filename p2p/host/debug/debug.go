@@ -0,0 +1,307 @@
+// Package debug implements an HTTP server to inspect a running libp2p host. It serves
+// the metrics, the Go profiles, the open connections and streams, a summary of the
+// peerstore, the usage of the resource manager and the configuration of the host.
+//
+// The server isn't authenticated: it should only listen on a loopback or another
+// trusted interface.
+package debug
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var log = logging.Logger("debug-server")
+
+type Option func(*Server) error
+
+// WithGatherer sets the registry the metrics are served from. It defaults to the
+// default Prometheus gatherer.
+func WithGatherer(g prometheus.Gatherer) Option {
+	return func(s *Server) error {
+		if g == nil {
+			return errors.New("gatherer cannot be nil")
+		}
+		s.gatherer = g
+		return nil
+	}
+}
+
+// WithConfig sets the configuration served on /config, it is marshaled to JSON.
+func WithConfig(cfg interface{}) Option {
+	return WithConfigFunc(func() interface{} { return cfg })
+}
+
+// WithConfigFunc sets the function returning the configuration served on /config. It's
+// called on every request, so that the changes made at runtime are served.
+func WithConfigFunc(f func() interface{}) Option {
+	return func(s *Server) error {
+		if f == nil {
+			return errors.New("config function cannot be nil")
+		}
+		s.config = f
+		return nil
+	}
+}
+
+// Server is the debug HTTP server of a host.
+type Server struct {
+	host     host.Host
+	gatherer prometheus.Gatherer
+	config   func() interface{}
+
+	ln  net.Listener
+	srv *http.Server
+}
+
+// New starts a debug server for h listening on addr, a TCP address like
+// "127.0.0.1:5001".
+func New(h host.Host, addr string, opts ...Option) (*Server, error) {
+	s := &Server{host: h, gatherer: prometheus.DefaultGatherer}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.ln = ln
+	s.srv = &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Errorw("debug server failed", "error", err)
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.srv.Close()
+}
+
+// Handler returns the handler serving the debug endpoints:
+//
+//   - /metrics: the Prometheus metrics
+//   - /debug/pprof/: the Go profiles, see net/http/pprof
+//   - /conns: the open connections and their streams
+//   - /peerstore: a summary of the peers in the peerstore
+//   - /rcmgr: the usage of the resource manager, relative to its limits
+//   - /config: the configuration of the host
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(s.gatherer, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/conns", s.serveConns)
+	mux.HandleFunc("/peerstore", s.servePeerstore)
+	mux.HandleFunc("/rcmgr", s.serveRcmgr)
+	mux.HandleFunc("/config", s.serveConfig)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Debugw("failed to write response", "error", err)
+	}
+}
+
+// ConnInfo describes an open connection.
+type ConnInfo struct {
+	Peer       peer.ID
+	LocalAddr  string
+	RemoteAddr string
+	Direction  string
+	Opened     time.Time
+	Transient  bool
+	Streams    []StreamInfo
+}
+
+// StreamInfo describes an open stream.
+type StreamInfo struct {
+	Protocol  protocol.ID
+	Direction string
+	Opened    time.Time
+}
+
+// ConnInfos describes the open connections of n, oldest first.
+func ConnInfos(n network.Network) []ConnInfo {
+	conns := n.Conns()
+	infos := make([]ConnInfo, 0, len(conns))
+	for _, c := range conns {
+		stat := c.Stat()
+		info := ConnInfo{
+			Peer:       c.RemotePeer(),
+			LocalAddr:  c.LocalMultiaddr().String(),
+			RemoteAddr: c.RemoteMultiaddr().String(),
+			Direction:  stat.Direction.String(),
+			Opened:     stat.Opened,
+			Transient:  stat.Transient,
+		}
+		for _, str := range c.GetStreams() {
+			sstat := str.Stat()
+			info.Streams = append(info.Streams, StreamInfo{
+				Protocol:  str.Protocol(),
+				Direction: sstat.Direction.String(),
+				Opened:    sstat.Opened,
+			})
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Opened.Before(infos[j].Opened) })
+	return infos
+}
+
+func (s *Server) serveConns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, ConnInfos(s.host.Network()))
+}
+
+// PeerstoreSummary summarizes the peerstore.
+type PeerstoreSummary struct {
+	NumPeers int
+	// NumConnected is the number of peers we're connected to.
+	NumConnected int
+	// NumWithAddrs is the number of peers with known addresses.
+	NumWithAddrs int
+	Peers        []PeerInfo
+}
+
+// PeerInfo summarizes what the peerstore knows about a peer.
+type PeerInfo struct {
+	ID            peer.ID
+	Connectedness string
+	NumAddrs      int
+	Protocols     []protocol.ID `json:",omitempty"`
+	AgentVersion  string        `json:",omitempty"`
+	Latency       time.Duration `json:",omitempty"`
+}
+
+func (s *Server) servePeerstore(w http.ResponseWriter, r *http.Request) {
+	ps := s.host.Peerstore()
+	peers := ps.Peers()
+	sum := PeerstoreSummary{NumPeers: len(peers), Peers: make([]PeerInfo, 0, len(peers))}
+	for _, p := range peers {
+		info := PeerInfo{
+			ID:            p,
+			Connectedness: s.host.Network().Connectedness(p).String(),
+			NumAddrs:      len(ps.Addrs(p)),
+			Latency:       ps.LatencyEWMA(p),
+		}
+		if protos, err := ps.GetProtocols(p); err == nil {
+			info.Protocols = protos
+		}
+		if av, err := ps.Get(p, "AgentVersion"); err == nil {
+			info.AgentVersion, _ = av.(string)
+		}
+		if s.host.Network().Connectedness(p) == network.Connected {
+			sum.NumConnected++
+		}
+		if info.NumAddrs > 0 {
+			sum.NumWithAddrs++
+		}
+		sum.Peers = append(sum.Peers, info)
+	}
+	sort.Slice(sum.Peers, func(i, j int) bool { return sum.Peers[i].ID < sum.Peers[j].ID })
+	writeJSON(w, sum)
+}
+
+func (s *Server) serveRcmgr(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := s.host.Network().ResourceManager().(rcmgr.ResourceManagerUsageViewer)
+	if !ok {
+		http.Error(w, "the resource manager doesn't report its usage", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, NewResourceUsage(viewer.Usage()))
+}
+
+// ResourceUsage is the usage of the resource manager, see
+// rcmgr.ResourceManagerUsage. The peers are keyed by the string encoding of their
+// ID, as peer IDs can't be used as JSON keys.
+type ResourceUsage struct {
+	System    rcmgr.ScopeUsage
+	Transient rcmgr.ScopeUsage
+	Services  map[string]rcmgr.ScopeUsage
+	Protocols map[protocol.ID]rcmgr.ScopeUsage
+	Peers     map[string]rcmgr.ScopeUsage
+}
+
+// NewResourceUsage converts u to a ResourceUsage.
+func NewResourceUsage(u rcmgr.ResourceManagerUsage) *ResourceUsage {
+	ru := &ResourceUsage{
+		System:    u.System,
+		Transient: u.Transient,
+		Services:  u.Services,
+		Protocols: u.Protocols,
+		Peers:     make(map[string]rcmgr.ScopeUsage, len(u.Peers)),
+	}
+	for p, pu := range u.Peers {
+		ru.Peers[p.String()] = pu
+	}
+	return ru
+}
+
+func (s *Server) serveConfig(w http.ResponseWriter, r *http.Request) {
+	var cfg interface{}
+	if s.config != nil {
+		cfg = s.config()
+	}
+	if cfg == nil {
+		http.Error(w, "no configuration", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, cfg)
+}
+
+// Host is a host that closes its debug server when it is closed.
+type Host struct {
+	host.Host
+	srv *Server
+}
+
+// NewHost wraps h, to close srv along with h.
+func NewHost(h host.Host, srv *Server) *Host {
+	return &Host{Host: h, srv: srv}
+}
+
+// Unwrap returns the wrapped host.
+func (h *Host) Unwrap() host.Host {
+	return h.Host
+}
+
+func (h *Host) Close() error {
+	_ = h.srv.Close()
+	return h.Host.Close()
+}
+
+// DebugServer returns the debug server of the host.
+func (h *Host) DebugServer() *Server {
+	return h.srv
+}
@@ -0,0 +1,137 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, s *Server, path string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get(fmt.Sprintf("http://%s%s", s.Addr(), path))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, b
+}
+
+func TestServer(t *testing.T) {
+	h1, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+	h2, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total"})
+	reg.MustRegister(counter)
+	counter.Inc()
+
+	s, err := New(h1, "127.0.0.1:0", WithGatherer(reg), WithConfig(map[string]string{"key": "value"}))
+	require.NoError(t, err)
+	defer s.Close()
+
+	code, body := get(t, s, "/metrics")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, string(body), "test_total 1")
+
+	code, _ = get(t, s, "/debug/pprof/")
+	require.Equal(t, http.StatusOK, code)
+
+	code, body = get(t, s, "/conns")
+	require.Equal(t, http.StatusOK, code)
+	var conns []ConnInfo
+	require.NoError(t, json.Unmarshal(body, &conns))
+	require.Len(t, conns, 1)
+	require.Equal(t, h2.ID(), conns[0].Peer)
+	require.Equal(t, "Outbound", conns[0].Direction)
+
+	code, body = get(t, s, "/peerstore")
+	require.Equal(t, http.StatusOK, code)
+	var sum PeerstoreSummary
+	require.NoError(t, json.Unmarshal(body, &sum))
+	require.Equal(t, 1, sum.NumConnected)
+	require.GreaterOrEqual(t, sum.NumPeers, 2)
+
+	// the test swarm uses the null resource manager
+	code, _ = get(t, s, "/rcmgr")
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, body = get(t, s, "/config")
+	require.Equal(t, http.StatusOK, code)
+	require.JSONEq(t, `{"key": "value"}`, string(body))
+}
+
+func TestServerRcmgr(t *testing.T) {
+	newHost := func() *bhost.BasicHost {
+		mgr, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(rcmgr.InfiniteLimits))
+		require.NoError(t, err)
+		h, err := bhost.NewHost(swarmt.GenSwarm(t, swarmt.WithSwarmOpts(swarm.WithResourceManager(mgr))), nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		h.Start()
+		return h
+	}
+	h1 := newHost()
+	h2 := newHost()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+
+	s, err := New(h1, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+
+	code, body := get(t, s, "/rcmgr")
+	require.Equal(t, http.StatusOK, code)
+	var usage ResourceUsage
+	require.NoError(t, json.Unmarshal(body, &usage))
+	require.Contains(t, usage.Peers, h2.ID().String())
+}
+
+func TestServerConfigFunc(t *testing.T) {
+	h, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h.Close()
+
+	var calls int
+	s, err := New(h, "127.0.0.1:0", WithConfigFunc(func() interface{} {
+		calls++
+		return map[string]int{"calls": calls}
+	}))
+	require.NoError(t, err)
+	defer s.Close()
+
+	for i := 1; i <= 2; i++ {
+		code, body := get(t, s, "/config")
+		require.Equal(t, http.StatusOK, code)
+		require.JSONEq(t, fmt.Sprintf(`{"calls": %d}`, i), string(body))
+	}
+
+	// the host has no configuration
+	s2, err := New(h, "127.0.0.1:0", WithConfigFunc(func() interface{} {
+		if c := h.EffectiveConfig(); c != nil {
+			return c
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	defer s2.Close()
+	code, _ := get(t, s2, "/config")
+	require.Equal(t, http.StatusNotFound, code)
+}
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/event"
 )
@@ -25,20 +27,28 @@ var _ event.Bus = (*basicBus)(nil)
 
 type emitter struct {
 	n             *node
-	w             *wildcardNode
 	typ           reflect.Type
 	closed        atomic.Bool
 	dropper       func(reflect.Type)
 	metricsTracer MetricsTracer
+
+	synchronous bool
+	syncTimeout time.Duration
 }
 
+// ErrDeliveryTimeout is returned by the Emit method of a Synchronous emitter if the
+// event wasn't handed to all subscribers in time.
+var ErrDeliveryTimeout = errors.New("timed out waiting for the subscribers to receive the event")
+
 func (e *emitter) Emit(evt interface{}) error {
 	if e.closed.Load() {
 		return fmt.Errorf("emitter is closed")
 	}
 
+	if e.synchronous {
+		return e.emitSynchronously(evt)
+	}
 	e.n.emit(evt)
-	e.w.emit(evt)
 
 	if e.metricsTracer != nil {
 		e.metricsTracer.EventEmitted(e.typ)
@@ -46,6 +56,33 @@ func (e *emitter) Emit(evt interface{}) error {
 	return nil
 }
 
+// emitSynchronously delivers evt, and waits until it was handed to all subscribers or
+// until the timeout elapses. If it does, the event is still delivered once the
+// subscribers catch up.
+func (e *emitter) emitSynchronously(evt interface{}) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.n.emit(evt)
+	}()
+	if e.metricsTracer != nil {
+		e.metricsTracer.EventEmitted(e.typ)
+	}
+
+	var timeout <-chan time.Time
+	if e.syncTimeout > 0 {
+		t := time.NewTimer(e.syncTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-done:
+		return nil
+	case <-timeout:
+		return ErrDeliveryTimeout
+	}
+}
+
 func (e *emitter) Close() error {
 	if !e.closed.CompareAndSwap(false, true) {
 		return fmt.Errorf("closed an emitter more than once")
@@ -72,7 +109,7 @@ func (b *basicBus) withNode(typ reflect.Type, cb func(*node), async func(*node))
 
 	n, ok := b.nodes[typ]
 	if !ok {
-		n = newNode(typ, b.metricsTracer)
+		n = newNode(typ, b.wildcard, b.metricsTracer)
 		b.nodes[typ] = n
 	}
 
@@ -111,8 +148,49 @@ func (b *basicBus) tryDropNode(typ reflect.Type) {
 	b.lk.Unlock()
 }
 
+// addWildcardSink adds sink to the wildcard node, and replays the last events of all
+// stateful event types to it. The last events are taken, and the sink is added, while
+// holding the locks of their nodes, so that no newer event is missed. The locks are
+// released before the replay: the first delivery of a newer event to the sink
+// finishes the replay first, so that the last events are still delivered before it.
+func (b *basicBus) addWildcardSink(sink *namedSink) {
+	b.lk.RLock()
+	nodes := make([]*node, 0, len(b.nodes))
+	for _, n := range b.nodes {
+		nodes = append(nodes, n)
+	}
+	b.lk.RUnlock()
+	// lock the nodes in a consistent order, to not deadlock with other wildcard
+	// subscriptions
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].typ.String() < nodes[j].typ.String() })
+
+	for _, n := range nodes {
+		n.lk.Lock()
+		if n.keepLast && n.last != nil && sink.accepts(n.last) {
+			sink.replay = append(sink.replay, n.last)
+		}
+	}
+	if len(sink.replay) > 0 {
+		sink.replaying.Store(true)
+	}
+	b.wildcard.addSink(sink)
+	for _, n := range nodes {
+		n.lk.Unlock()
+	}
+
+	if sink.replaying.Load() {
+		go func() {
+			sink.replayMx.Lock()
+			defer sink.replayMx.Unlock()
+			sink.replayLocked()
+		}()
+	}
+}
+
 type wildcardSub struct {
 	ch            chan interface{}
+	sink          *namedSink
+	closeOnce     sync.Once
 	w             *wildcardNode
 	metricsTracer MetricsTracer
 	name          string
@@ -123,6 +201,9 @@ func (w *wildcardSub) Out() <-chan interface{} {
 }
 
 func (w *wildcardSub) Close() error {
+	// unblock the deliveries to the sink first: the replay of the last events holds
+	// the locks of their nodes, and emitters hold the lock of the wildcard node
+	w.closeOnce.Do(func() { close(w.sink.closed) })
 	w.w.removeSink(w.ch)
 	if w.metricsTracer != nil {
 		w.metricsTracer.RemoveSubscriber(reflect.TypeOf(event.WildcardSubscription))
@@ -137,10 +218,123 @@ func (w *wildcardSub) Name() string {
 type namedSink struct {
 	name string
 	ch   chan interface{}
+	// filter decides which events are delivered, it is nil if all are
+	filter   func(interface{}) bool
+	overflow OverflowPolicy
+	// closed is closed when the subscription is closed, to abort blocked
+	// deliveries. It is nil if the subscription drains its channel instead.
+	closed  chan struct{}
+	dropped atomic.Uint64
+
+	// replay holds the last events that are yet to be replayed to a new wildcard
+	// subscription. replaying is set until the replay finished.
+	replayMx  sync.Mutex
+	replay    []interface{}
+	replaying atomic.Bool
+}
+
+// accepts returns true if evt should be delivered to the sink.
+func (s *namedSink) accepts(evt interface{}) bool {
+	return s.filter == nil || s.filter(evt)
+}
+
+// deliver enqueues evt, applying the overflow policy if the queue is full.
+func (s *namedSink) deliver(evt interface{}, metricsTracer MetricsTracer) {
+	// Sending metrics before sending on channel allows us to
+	// record channel full events before blocking
+	sendSubscriberMetrics(metricsTracer, s)
+
+	switch s.overflow {
+	case DropNewest:
+		select {
+		case s.ch <- evt:
+		default:
+			s.drop(metricsTracer)
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.ch <- evt:
+				return
+			default:
+			}
+			// the subscriber may have read an event in the meantime
+			select {
+			case <-s.ch:
+				s.drop(metricsTracer)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- evt:
+		case <-s.closed:
+		}
+	}
+}
+
+// replayLocked delivers the events left in the replay. replayMx must be held.
+func (s *namedSink) replayLocked() {
+	for _, evt := range s.replay {
+		s.deliver(evt, nil)
+	}
+	s.replay = nil
+	s.replaying.Store(false)
+}
+
+// deliverLive delivers an emitted event, after finishing the replay of the last
+// events if it's still ongoing.
+func (s *namedSink) deliverLive(evt interface{}, metricsTracer MetricsTracer) {
+	if s.replaying.Load() {
+		s.replayMx.Lock()
+		s.replayLocked()
+		s.replayMx.Unlock()
+	}
+	s.deliver(evt, metricsTracer)
+}
+
+func (s *namedSink) drop(metricsTracer MetricsTracer) {
+	s.dropped.Add(1)
+	if metricsTracer != nil {
+		metricsTracer.SubscriberEventDropped(s.name)
+	}
+}
+
+func (s *namedSink) stats() SubscriptionStats {
+	return SubscriptionStats{
+		QueueLength:   len(s.ch),
+		QueueCapacity: cap(s.ch),
+		Dropped:       s.dropped.Load(),
+	}
+}
+
+// SubscriptionStats are the statistics of the queue of a subscription.
+type SubscriptionStats struct {
+	// QueueLength is the number of events waiting to be read.
+	QueueLength int
+	// QueueCapacity is the size of the queue, see BufSize.
+	QueueCapacity int
+	// Dropped is the number of events dropped by the overflow policy, see
+	// OnOverflow.
+	Dropped uint64
+}
+
+// GetSubscriptionStats returns the statistics of sub. It returns false if sub wasn't
+// created by a bus of this package.
+func GetSubscriptionStats(s event.Subscription) (SubscriptionStats, bool) {
+	switch s := s.(type) {
+	case *sub:
+		return s.sink.stats(), true
+	case *wildcardSub:
+		return s.sink.stats(), true
+	default:
+		return SubscriptionStats{}, false
+	}
 }
 
 type sub struct {
 	ch            chan interface{}
+	sink          *namedSink
 	nodes         []*node
 	dropper       func(reflect.Type)
 	metricsTracer MetricsTracer
@@ -203,6 +397,10 @@ func (b *basicBus) Subscribe(evtTypes interface{}, opts ...event.SubscriptionOpt
 		}
 	}
 
+	if settings.overflow != BlockOnOverflow && settings.buffer <= 0 {
+		return nil, errors.New("dropping events on overflow requires a buffer")
+	}
+
 	if evtTypes == event.WildcardSubscription {
 		out := &wildcardSub{
 			ch:            make(chan interface{}, settings.buffer),
@@ -210,7 +408,8 @@ func (b *basicBus) Subscribe(evtTypes interface{}, opts ...event.SubscriptionOpt
 			metricsTracer: b.metricsTracer,
 			name:          settings.name,
 		}
-		b.wildcard.addSink(&namedSink{ch: out.ch, name: out.name})
+		out.sink = &namedSink{ch: out.ch, name: out.name, filter: settings.filter, overflow: settings.overflow, closed: make(chan struct{})}
+		b.addWildcardSink(out.sink)
 		return out, nil
 	}
 
@@ -242,11 +441,13 @@ func (b *basicBus) Subscribe(evtTypes interface{}, opts ...event.SubscriptionOpt
 		}
 	}
 
+	sink := &namedSink{ch: out.ch, name: out.name, filter: settings.filter, overflow: settings.overflow}
+	out.sink = sink
 	for i, etyp := range types {
 		typ := reflect.TypeOf(etyp)
 
 		b.withNode(typ.Elem(), func(n *node) {
-			n.sinks = append(n.sinks, &namedSink{ch: out.ch, name: out.name})
+			n.sinks = append(n.sinks, sink)
 			out.nodes[i] = n
 			if b.metricsTracer != nil {
 				b.metricsTracer.AddSubscriber(typ.Elem())
@@ -254,10 +455,10 @@ func (b *basicBus) Subscribe(evtTypes interface{}, opts ...event.SubscriptionOpt
 		}, func(n *node) {
 			if n.keepLast {
 				l := n.last
-				if l == nil {
+				if l == nil || !sink.accepts(l) {
 					return
 				}
-				out.ch <- l
+				sink.deliver(l, nil)
 			}
 		})
 	}
@@ -296,7 +497,14 @@ func (b *basicBus) Emitter(evtType interface{}, opts ...event.EmitterOpt) (e eve
 	b.withNode(typ, func(n *node) {
 		n.nEmitters.Add(1)
 		n.keepLast = n.keepLast || settings.makeStateful
-		e = &emitter{n: n, typ: typ, dropper: b.tryDropNode, w: b.wildcard, metricsTracer: b.metricsTracer}
+		e = &emitter{
+			n:             n,
+			typ:           typ,
+			dropper:       b.tryDropNode,
+			metricsTracer: b.metricsTracer,
+			synchronous:   settings.synchronous,
+			syncTimeout:   settings.syncTimeout,
+		}
 	}, nil)
 	return
 }
@@ -355,12 +563,10 @@ func (n *wildcardNode) emit(evt interface{}) {
 
 	n.RLock()
 	for _, sink := range n.sinks {
-
-		// Sending metrics before sending on channel allows us to
-		// record channel full events before blocking
-		sendSubscriberMetrics(n.metricsTracer, sink)
-
-		sink.ch <- evt
+		if !sink.accepts(evt) {
+			continue
+		}
+		sink.deliverLive(evt, n.metricsTracer)
 	}
 	n.RUnlock()
 }
@@ -378,12 +584,14 @@ type node struct {
 	last     interface{}
 
 	sinks         []*namedSink
+	wildcard      *wildcardNode
 	metricsTracer MetricsTracer
 }
 
-func newNode(typ reflect.Type, metricsTracer MetricsTracer) *node {
+func newNode(typ reflect.Type, wildcard *wildcardNode, metricsTracer MetricsTracer) *node {
 	return &node{
 		typ:           typ,
+		wildcard:      wildcard,
 		metricsTracer: metricsTracer,
 	}
 }
@@ -400,12 +608,12 @@ func (n *node) emit(evt interface{}) {
 	}
 
 	for _, sink := range n.sinks {
-
-		// Sending metrics before sending on channel allows us to
-		// record channel full events before blocking
-		sendSubscriberMetrics(n.metricsTracer, sink)
-		sink.ch <- evt
+		if !sink.accepts(evt) {
+			continue
+		}
+		sink.deliver(evt, n.metricsTracer)
 	}
+	n.wildcard.emit(evt)
 	n.lk.Unlock()
 }
 
@@ -52,12 +52,21 @@ var (
 		},
 		[]string{"subscriber_name"},
 	)
+	subscriberEventDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "subscriber_event_dropped",
+			Help:      "Event dropped for subscriber because its queue was full",
+		},
+		[]string{"subscriber_name"},
+	)
 	collectors = []prometheus.Collector{
 		eventsEmitted,
 		totalSubscribers,
 		subscriberQueueLength,
 		subscriberQueueFull,
 		subscriberEventQueued,
+		subscriberEventDropped,
 	}
 )
 
@@ -81,6 +90,10 @@ type MetricsTracer interface {
 
 	// SubscriberEventQueued counts the total number of events grouped by subscriber
 	SubscriberEventQueued(name string)
+
+	// SubscriberEventDropped counts the events dropped by the overflow policy of a
+	// subscriber, grouped by subscriber
+	SubscriberEventDropped(name string)
 }
 
 type metricsTracer struct{}
@@ -162,3 +175,11 @@ func (m *metricsTracer) SubscriberEventQueued(name string) {
 	*tags = append(*tags, name)
 	subscriberEventQueued.WithLabelValues(*tags...).Inc()
 }
+
+func (m *metricsTracer) SubscriberEventDropped(name string) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	*tags = append(*tags, name)
+	subscriberEventDropped.WithLabelValues(*tags...).Inc()
+}
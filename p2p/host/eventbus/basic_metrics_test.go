@@ -50,12 +50,13 @@ var names = []string{
 func TestMetricsNoAllocNoCover(t *testing.T) {
 	mt := NewMetricsTracer()
 	tests := map[string]func(){
-		"EventEmitted":          func() { mt.EventEmitted(eventTypes[rand.Intn(len(eventTypes))]) },
-		"AddSubscriber":         func() { mt.AddSubscriber(eventTypes[rand.Intn(len(eventTypes))]) },
-		"RemoveSubscriber":      func() { mt.RemoveSubscriber(eventTypes[rand.Intn(len(eventTypes))]) },
-		"SubscriberQueueLength": func() { mt.SubscriberQueueLength(names[rand.Intn(len(names))], rand.Intn(100)) },
-		"SubscriberQueueFull":   func() { mt.SubscriberQueueFull(names[rand.Intn(len(names))], rand.Intn(2) == 1) },
-		"SubscriberEventQueued": func() { mt.SubscriberEventQueued(names[rand.Intn(len(names))]) },
+		"EventEmitted":           func() { mt.EventEmitted(eventTypes[rand.Intn(len(eventTypes))]) },
+		"AddSubscriber":          func() { mt.AddSubscriber(eventTypes[rand.Intn(len(eventTypes))]) },
+		"RemoveSubscriber":       func() { mt.RemoveSubscriber(eventTypes[rand.Intn(len(eventTypes))]) },
+		"SubscriberQueueLength":  func() { mt.SubscriberQueueLength(names[rand.Intn(len(names))], rand.Intn(100)) },
+		"SubscriberQueueFull":    func() { mt.SubscriberQueueFull(names[rand.Intn(len(names))], rand.Intn(2) == 1) },
+		"SubscriberEventQueued":  func() { mt.SubscriberEventQueued(names[rand.Intn(len(names))]) },
+		"SubscriberEventDropped": func() { mt.SubscriberEventDropped(names[rand.Intn(len(names))]) },
 	}
 	for method, f := range tests {
 		allocs := testing.AllocsPerRun(1000, f)
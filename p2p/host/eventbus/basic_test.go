@@ -435,6 +435,282 @@ func TestStateful(t *testing.T) {
 	}
 }
 
+func TestStatefulWildcard(t *testing.T) {
+	bus := NewBus()
+	emA, err := bus.Emitter(new(EventA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer emA.Close()
+	emB, err := bus.Emitter(new(EventB), Stateful)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer emB.Close()
+
+	emA.Emit(EventA{})
+	emB.Emit(EventB(1))
+	emB.Emit(EventB(2))
+
+	// the wildcard subscription only receives the last event of the stateful type
+	sub, err := bus.Subscribe(event.WildcardSubscription, BufSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	go emB.Emit(EventB(3))
+	if evt := (<-sub.Out()).(EventB); evt != 2 {
+		t.Fatalf("expected the remembered event, got %d", evt)
+	}
+	if evt := (<-sub.Out()).(EventB); evt != 3 {
+		t.Fatalf("expected the new event, got %d", evt)
+	}
+	select {
+	case evt := <-sub.Out():
+		t.Fatalf("didn't expect another event, got %v", evt)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestStatefulWildcardClosedBeforeReplay(t *testing.T) {
+	bus := NewBus()
+	em, err := bus.Emitter(new(EventB), Stateful)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer em.Close()
+	em.Emit(EventB(1))
+
+	// the subscription is closed without reading the replayed event
+	sub, err := bus.Subscribe(event.WildcardSubscription, BufSize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		em.Emit(EventB(2))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("emitting blocked on a closed wildcard subscription")
+	}
+}
+
+func TestStatefulWildcardReplayReleasesLocks(t *testing.T) {
+	bus := NewBus()
+	em, err := bus.Emitter(new(EventB), Stateful)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer em.Close()
+	em.Emit(EventB(1))
+
+	// the replayed event isn't read yet
+	sub, err := bus.Subscribe(event.WildcardSubscription, BufSize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		typed, err := bus.Subscribe(new(EventB))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		typed.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscribing blocked on the replay to a wildcard subscription")
+	}
+
+	if evt := (<-sub.Out()).(EventB); evt != 1 {
+		t.Fatalf("expected the remembered event, got %d", evt)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	bus := NewBus()
+	emA, err := bus.Emitter(new(EventA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer emA.Close()
+	emB, err := bus.Emitter(new(EventB), Stateful)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer emB.Close()
+
+	emB.Emit(EventB(1))
+
+	even := Filter(func(evt interface{}) bool {
+		b, ok := evt.(EventB)
+		return ok && b%2 == 0
+	})
+	sub, err := bus.Subscribe([]interface{}{new(EventA), new(EventB)}, even, BufSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	wsub, err := bus.Subscribe(event.WildcardSubscription, even, BufSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wsub.Close()
+
+	// filtered events don't use up the buffer, so none of these block
+	emA.Emit(EventA{})
+	emB.Emit(EventB(3))
+	emB.Emit(EventB(4))
+
+	for _, s := range []event.Subscription{sub, wsub} {
+		if evt := (<-s.Out()).(EventB); evt != 4 {
+			t.Fatalf("expected the even event, got %d", evt)
+		}
+		select {
+		case evt := <-s.Out():
+			t.Fatalf("didn't expect another event, got %v", evt)
+		default:
+		}
+	}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	bus := NewBus()
+	em, err := bus.Emitter(new(EventB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer em.Close()
+
+	if _, err := bus.Subscribe(new(EventB), BufSize(0), OnOverflow(DropNewest)); err == nil {
+		t.Fatal("expected dropping without a buffer to fail")
+	}
+
+	oldest, err := bus.Subscribe(new(EventB), BufSize(2), OnOverflow(DropOldest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldest.Close()
+	newest, err := bus.Subscribe(new(EventB), BufSize(2), OnOverflow(DropNewest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newest.Close()
+
+	// none of these block, even though nothing is read
+	for i := 1; i <= 5; i++ {
+		em.Emit(EventB(i))
+	}
+
+	for _, tc := range []struct {
+		sub      event.Subscription
+		expected []EventB
+	}{
+		{oldest, []EventB{4, 5}},
+		{newest, []EventB{1, 2}},
+	} {
+		stats, ok := GetSubscriptionStats(tc.sub)
+		if !ok {
+			t.Fatal("expected stats")
+		}
+		if stats != (SubscriptionStats{QueueLength: 2, QueueCapacity: 2, Dropped: 3}) {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+		for _, expected := range tc.expected {
+			if evt := (<-tc.sub.Out()).(EventB); evt != expected {
+				t.Fatalf("expected %d, got %d", expected, evt)
+			}
+		}
+	}
+}
+
+func TestSynchronousEmit(t *testing.T) {
+	bus := NewBus()
+	em, err := bus.Emitter(new(EventB), Synchronous(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer em.Close()
+
+	// without subscribers, there is nothing to wait for
+	if err := em.Emit(EventB(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := bus.Subscribe(new(EventB), BufSize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	wild, err := bus.Subscribe(event.WildcardSubscription, BufSize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wild.Close()
+
+	if err := em.Emit(EventB(1)); err != ErrDeliveryTimeout {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	// the event is still delivered
+	if evt := <-sub.Out(); evt.(EventB) != 1 {
+		t.Fatalf("expected event 1, got %v", evt)
+	}
+	if evt := <-wild.Out(); evt.(EventB) != 1 {
+		t.Fatalf("expected event 1, got %v", evt)
+	}
+
+	received := make(chan interface{}, 2)
+	go func() {
+		for _, s := range []event.Subscription{sub, wild} {
+			time.Sleep(10 * time.Millisecond)
+			received <- <-s.Out()
+		}
+	}()
+	if err := em.Emit(EventB(2)); err != nil {
+		t.Fatal(err)
+	}
+	// both subscribers received the event when Emit returned
+	if len(received) != 2 {
+		t.Fatalf("expected both subscribers to have received the event, got %d", len(received))
+	}
+
+	// a subscription dropping events doesn't block a synchronous emit
+	drop, err := bus.Subscribe(new(EventB), BufSize(1), OnOverflow(DropNewest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer drop.Close()
+	go func() {
+		for i := 0; i < 2; i++ {
+			<-sub.Out()
+			<-wild.Out()
+		}
+	}()
+	for _, evt := range []EventB{3, 4} {
+		if err := em.Emit(evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats, _ := GetSubscriptionStats(drop); stats.Dropped != 1 {
+		t.Fatalf("expected one dropped event, got %+v", stats)
+	}
+
+	if _, err := bus.Emitter(new(EventA), Synchronous(-1)); err == nil {
+		t.Fatal("expected a negative timeout to fail")
+	}
+}
+
 func TestCloseBlocking(t *testing.T) {
 	bus := NewBus()
 	em, err := bus.Emitter(new(EventB))
@@ -1,15 +1,19 @@
 package eventbus
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 	"strings"
 	"sync/atomic"
+	"time"
 )
 
 type subSettings struct {
-	buffer int
-	name   string
+	buffer   int
+	name     string
+	filter   func(interface{}) bool
+	overflow OverflowPolicy
 }
 
 var subCnt atomic.Int64
@@ -53,14 +57,55 @@ func Name(name string) func(interface{}) error {
 	}
 }
 
+// OverflowPolicy decides what happens to an event when the queue of a subscription
+// is full.
+type OverflowPolicy int
+
+const (
+	// BlockOnOverflow blocks the emitter until the subscriber reads an event. This is
+	// the default.
+	BlockOnOverflow OverflowPolicy = iota
+	// DropOldest drops the oldest queued event to make room for the new one.
+	DropOldest
+	// DropNewest drops the new event.
+	DropNewest
+)
+
+// OnOverflow is a Subscription option which sets what happens to events when the
+// queue of the subscription is full. Policies that drop events need a buffer, see
+// BufSize. Dropped events are counted, see SubscriptionStats.
+func OnOverflow(policy OverflowPolicy) func(interface{}) error {
+	return func(s interface{}) error {
+		if policy < BlockOnOverflow || policy > DropNewest {
+			return fmt.Errorf("unknown overflow policy: %d", policy)
+		}
+		s.(*subSettings).overflow = policy
+		return nil
+	}
+}
+
+// Filter is a Subscription option which only delivers the events for which
+// filter returns true. The filter is evaluated before an event is enqueued, so
+// filtered events don't use up the buffer of the subscription. It is called
+// by the emitting goroutine, and must not block.
+func Filter(filter func(evt interface{}) bool) func(interface{}) error {
+	return func(s interface{}) error {
+		s.(*subSettings).filter = filter
+		return nil
+	}
+}
+
 type emitterSettings struct {
 	makeStateful bool
+	synchronous  bool
+	syncTimeout  time.Duration
 }
 
 // Stateful is an Emitter option which makes the eventbus channel
 // 'remember' last event sent, and when a new subscriber joins the
 // bus, the remembered event is immediately sent to the subscription
-// channel.
+// channel. Wildcard subscriptions receive the remembered events of all
+// stateful event types.
 //
 // This allows to provide state tracking for dynamic systems, and/or
 // allows new subscribers to verify that there are Emitters on the channel
@@ -69,6 +114,25 @@ func Stateful(s interface{}) error {
 	return nil
 }
 
+// Synchronous is an Emitter option which makes Emit block until the event was handed
+// to all subscribers, or until timeout elapses, in which case Emit returns
+// ErrDeliveryTimeout and the event is delivered in the background. A timeout of 0
+// waits indefinitely. The event is handed to a subscription when it's enqueued
+// according to its overflow policy, or dropped by it. For subscriptions without a
+// buffer, see BufSize, this means that the subscriber received the event.
+//
+// This allows to sequence shutdowns, or to wait for the subscribers in tests.
+func Synchronous(timeout time.Duration) func(interface{}) error {
+	return func(s interface{}) error {
+		if timeout < 0 {
+			return errors.New("negative synchronous emit timeout")
+		}
+		s.(*emitterSettings).synchronous = true
+		s.(*emitterSettings).syncTimeout = timeout
+		return nil
+	}
+}
+
 type Option func(*basicBus)
 
 func WithMetricsTracer(metricsTracer MetricsTracer) Option {
@@ -0,0 +1,116 @@
+package peerstore
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PeerAddrs are addresses of a peer to add with the given TTL.
+type PeerAddrs struct {
+	ID    peer.ID
+	Addrs []ma.Multiaddr
+	TTL   time.Duration
+}
+
+// PeerProtocols are protocols supported by a peer.
+type PeerProtocols struct {
+	ID        peer.ID
+	Protocols []protocol.ID
+}
+
+// PeerMetadataValue is a metadata value of a peer, stored under Key.
+type PeerMetadataValue struct {
+	ID    peer.ID
+	Key   string
+	Value interface{}
+}
+
+// BatchPeerstore is implemented by peerstores that can process operations on many
+// peers at once more efficiently than one by one, e.g. by taking their locks or
+// writing to their datastore only once. Both pstoremem and pstoreds do. pstoreds
+// writes each batch to its datastore in a single datastore batch, so that either all
+// of its changes are stored or none.
+//
+// Use the AddAddrsBatch, AddProtocolsBatch, PutMetadataBatch, GetMetadataBatch and
+// PeerInfos helpers, which fall back to processing the peers one by one for other
+// peerstores.
+type BatchPeerstore interface {
+	// AddAddrsBatch adds addresses like AddrBook.AddAddrs for all peers in batch.
+	AddAddrsBatch(batch []PeerAddrs)
+	// AddProtocolsBatch adds protocols like ProtoBook.AddProtocols for all peers in
+	// batch. If adding the protocols of a peer fails, the protocols of the other
+	// peers are still added, and the first error is returned.
+	AddProtocolsBatch(batch []PeerProtocols) error
+	// PeerInfos returns the AddrInfos of peers.
+	PeerInfos(peers peer.IDSlice) []peer.AddrInfo
+	// PutBatch stores the metadata values in batch like PeerMetadata.Put.
+	PutBatch(batch []PeerMetadataValue) error
+	// GetBatch returns the metadata values stored under key for peers, like
+	// PeerMetadata.Get. The value of a peer without one is nil.
+	GetBatch(peers peer.IDSlice, key string) ([]interface{}, error)
+}
+
+// AddAddrsBatch adds the addresses in batch to ps.
+func AddAddrsBatch(ps pstore.Peerstore, batch []PeerAddrs) {
+	if bps, ok := ps.(BatchPeerstore); ok {
+		bps.AddAddrsBatch(batch)
+		return
+	}
+	for _, e := range batch {
+		ps.AddAddrs(e.ID, e.Addrs, e.TTL)
+	}
+}
+
+// AddProtocolsBatch adds the protocols in batch to ps. If adding the protocols of a
+// peer fails, the protocols of the other peers are still added, and the first error
+// is returned.
+func AddProtocolsBatch(ps pstore.Peerstore, batch []PeerProtocols) error {
+	if bps, ok := ps.(BatchPeerstore); ok {
+		return bps.AddProtocolsBatch(batch)
+	}
+	var firstErr error
+	for _, e := range batch {
+		if err := ps.AddProtocols(e.ID, e.Protocols...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// PutMetadataBatch stores the metadata values in batch in ps.
+func PutMetadataBatch(ps pstore.Peerstore, batch []PeerMetadataValue) error {
+	if bps, ok := ps.(BatchPeerstore); ok {
+		return bps.PutBatch(batch)
+	}
+	for _, e := range batch {
+		if err := ps.Put(e.ID, e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMetadataBatch returns the metadata values stored under key for peers in ps. The
+// value of a peer without one is nil.
+func GetMetadataBatch(ps pstore.Peerstore, peers peer.IDSlice, key string) ([]interface{}, error) {
+	if bps, ok := ps.(BatchPeerstore); ok {
+		return bps.GetBatch(peers, key)
+	}
+	vals := make([]interface{}, len(peers))
+	for i, p := range peers {
+		v, err := ps.Get(p, key)
+		switch err {
+		case nil:
+			vals[i] = v
+		case pstore.ErrNotFound:
+		default:
+			return nil, err
+		}
+	}
+	return vals, nil
+}
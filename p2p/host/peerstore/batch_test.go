@@ -0,0 +1,160 @@
+package peerstore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoreds"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+// unbatchedPeerstore hides the batch methods of the wrapped peerstore.
+type unbatchedPeerstore struct {
+	pstore.Peerstore
+}
+
+func TestBatchOperations(t *testing.T) {
+	for name, newPeerstore := range map[string]func() pstore.Peerstore{
+		"mem": func() pstore.Peerstore {
+			ps, err := pstoremem.NewPeerstore(pstoremem.WithMaxProtocols(2))
+			require.NoError(t, err)
+			return ps
+		},
+		"ds": func() pstore.Peerstore {
+			opts := pstoreds.DefaultOpts()
+			opts.MaxProtocols = 2
+			ps, err := pstoreds.NewPeerstore(context.Background(), dssync.MutexWrap(ds.NewMapDatastore()), opts)
+			require.NoError(t, err)
+			return ps
+		},
+		"unbatched": func() pstore.Peerstore {
+			ps, err := pstoremem.NewPeerstore(pstoremem.WithMaxProtocols(2))
+			require.NoError(t, err)
+			return unbatchedPeerstore{ps}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ps := newPeerstore()
+			defer ps.Close()
+
+			var peers peer.IDSlice
+			var addrs []peerstore.PeerAddrs
+			var protos []peerstore.PeerProtocols
+			for i := 0; i < 50; i++ {
+				p := test.RandPeerIDFatal(t)
+				peers = append(peers, p)
+				addrs = append(addrs, peerstore.PeerAddrs{
+					ID:    p,
+					Addrs: []ma.Multiaddr{ma.StringCast(fmt.Sprintf("/ip4/1.2.3.4/tcp/%d", i+1))},
+					TTL:   time.Hour,
+				})
+				protos = append(protos, peerstore.PeerProtocols{ID: p, Protocols: []protocol.ID{"/foo"}})
+			}
+			// the same peer can occur multiple times
+			addrs = append(addrs, peerstore.PeerAddrs{ID: peers[0], Addrs: []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1")}, TTL: time.Hour})
+			// exceeds the protocol limit
+			protos[1].Protocols = []protocol.ID{"/foo", "/bar", "/baz"}
+
+			peerstore.AddAddrsBatch(ps, addrs)
+			require.Error(t, peerstore.AddProtocolsBatch(ps, protos))
+
+			infos := peerstore.PeerInfos(ps, peers)
+			require.Len(t, infos, len(peers))
+			for i, info := range infos {
+				require.Equal(t, peers[i], info.ID)
+				if i == 0 {
+					require.ElementsMatch(t, []ma.Multiaddr{addrs[0].Addrs[0], addrs[len(addrs)-1].Addrs[0]}, info.Addrs)
+				} else {
+					require.Equal(t, addrs[i].Addrs, info.Addrs)
+				}
+				supported, err := ps.GetProtocols(peers[i])
+				require.NoError(t, err)
+				if i == 1 {
+					require.Empty(t, supported)
+				} else {
+					require.Equal(t, []protocol.ID{"/foo"}, supported)
+				}
+			}
+
+			var vals []peerstore.PeerMetadataValue
+			for i, p := range peers[1:] {
+				vals = append(vals, peerstore.PeerMetadataValue{ID: p, Key: "AgentVersion", Value: fmt.Sprintf("agent-%d", i+1)})
+			}
+			require.NoError(t, peerstore.PutMetadataBatch(ps, vals))
+			got, err := peerstore.GetMetadataBatch(ps, peers, "AgentVersion")
+			require.NoError(t, err)
+			require.Len(t, got, len(peers))
+			require.Nil(t, got[0])
+			for i := 1; i < len(peers); i++ {
+				require.Equal(t, fmt.Sprintf("agent-%d", i), got[i])
+			}
+		})
+	}
+}
+
+// failingBatchDatastore is a datastore whose batches fail to commit.
+type failingBatchDatastore struct {
+	ds.Batching
+}
+
+func (d failingBatchDatastore) Batch(ctx context.Context) (ds.Batch, error) {
+	b, err := d.Batching.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return failingBatch{b}, nil
+}
+
+type failingBatch struct {
+	ds.Batch
+}
+
+func (failingBatch) Commit(context.Context) error {
+	return errors.New("commit failed")
+}
+
+func TestBatchOperationsAtomic(t *testing.T) {
+	ps, err := pstoreds.NewPeerstore(context.Background(), failingBatchDatastore{dssync.MutexWrap(ds.NewMapDatastore())}, pstoreds.DefaultOpts())
+	require.NoError(t, err)
+	defer ps.Close()
+
+	p1 := test.RandPeerIDFatal(t)
+	p2 := test.RandPeerIDFatal(t)
+	peerstore.AddAddrsBatch(ps, []peerstore.PeerAddrs{
+		{ID: p1, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1")}, TTL: time.Hour},
+		{ID: p2, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/2")}, TTL: time.Hour},
+	})
+	require.Empty(t, ps.Addrs(p1))
+	require.Empty(t, ps.Addrs(p2))
+
+	require.Error(t, peerstore.AddProtocolsBatch(ps, []peerstore.PeerProtocols{
+		{ID: p1, Protocols: []protocol.ID{"/foo"}},
+		{ID: p2, Protocols: []protocol.ID{"/foo"}},
+	}))
+	for _, p := range []peer.ID{p1, p2} {
+		protos, err := ps.GetProtocols(p)
+		require.NoError(t, err)
+		require.Empty(t, protos)
+	}
+
+	require.Error(t, peerstore.PutMetadataBatch(ps, []peerstore.PeerMetadataValue{
+		{ID: p1, Key: "AgentVersion", Value: "foo"},
+		{ID: p2, Key: "AgentVersion", Value: "bar"},
+	}))
+	vals, err := peerstore.GetMetadataBatch(ps, peer.IDSlice{p1, p2}, "AgentVersion")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{nil, nil}, vals)
+}
@@ -0,0 +1,12 @@
+package peerstore
+
+import "github.com/libp2p/go-libp2p/core/event"
+
+// EventEmittingPeerstore is implemented by peerstores that can report changes of their
+// contents on an event bus, so that other components don't need to poll them. The
+// events are event.EvtPeerAdded, event.EvtPeerRemoved, event.EvtPeerAddrsUpdated and
+// event.EvtPeerRecordUpdated. pstoremem implements it.
+type EventEmittingPeerstore interface {
+	// EmitEvents makes the peerstore emit events on bus.
+	EmitEvents(bus event.Bus) error
+}
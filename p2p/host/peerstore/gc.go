@@ -0,0 +1,100 @@
+package peerstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// GCPeerstore is implemented by peerstores that purge expired addresses, and allow
+// triggering a purge manually. Both pstoremem and pstoreds do.
+type GCPeerstore interface {
+	// GC purges the expired addresses, and the peers left without addresses, from the
+	// address book. It blocks until done, or until ctx is cancelled if another purge
+	// is running.
+	GC(ctx context.Context) error
+}
+
+const metricNamespace = "libp2p_peerstore"
+
+var (
+	gcRunsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "gc_runs_total",
+			Help:      "Number of address book garbage collections",
+		},
+	)
+	gcPurgedAddrsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "gc_purged_addrs_total",
+			Help:      "Number of expired addresses purged by garbage collection",
+		},
+	)
+	gcPurgedPeersTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "gc_purged_peers_total",
+			Help:      "Number of peers left without addresses purged by garbage collection",
+		},
+	)
+	gcDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "gc_duration_seconds",
+			Help:      "Duration of address book garbage collections",
+			Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+		},
+	)
+	collectors = []prometheus.Collector{
+		gcRunsTotal,
+		gcPurgedAddrsTotal,
+		gcPurgedPeersTotal,
+		gcDuration,
+	}
+)
+
+// GCMetricsTracer tracks the garbage collection of the address book.
+type GCMetricsTracer interface {
+	// GCFinished is called after each garbage collection, with the number of addresses
+	// and peers purged, and the time it took.
+	GCFinished(addrs, peers int, d time.Duration)
+}
+
+type gcMetricsTracer struct{}
+
+var _ GCMetricsTracer = &gcMetricsTracer{}
+
+type metricsTracerSetting struct {
+	reg prometheus.Registerer
+}
+
+type MetricsTracerOption func(*metricsTracerSetting)
+
+func WithRegisterer(reg prometheus.Registerer) MetricsTracerOption {
+	return func(s *metricsTracerSetting) {
+		if reg != nil {
+			s.reg = reg
+		}
+	}
+}
+
+func NewGCMetricsTracer(opts ...MetricsTracerOption) GCMetricsTracer {
+	setting := &metricsTracerSetting{reg: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(setting)
+	}
+	metricshelper.RegisterCollectors(setting.reg, collectors...)
+	return &gcMetricsTracer{}
+}
+
+func (mt *gcMetricsTracer) GCFinished(addrs, peers int, d time.Duration) {
+	gcRunsTotal.Inc()
+	gcPurgedAddrsTotal.Add(float64(addrs))
+	gcPurgedPeersTotal.Add(float64(peers))
+	gcDuration.Observe(d.Seconds())
+}
@@ -0,0 +1,22 @@
+//go:build nocover
+
+package peerstore
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestGCMetricsNoAllocNoCover(t *testing.T) {
+	tr := NewGCMetricsTracer()
+	tests := map[string]func(){
+		"GCFinished": func() { tr.GCFinished(rand.Intn(100), rand.Intn(10), time.Duration(rand.Intn(1000))*time.Millisecond) },
+	}
+	for method, f := range tests {
+		allocs := testing.AllocsPerRun(1000, f)
+		if allocs > 0 {
+			t.Fatalf("Alloc Test: %s, got: %0.2f, expected: 0 allocs", method, allocs)
+		}
+	}
+}
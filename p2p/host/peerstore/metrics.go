@@ -12,17 +12,55 @@ import (
 // 1 is 100% change, 0 is no change.
 var LatencyEWMASmoothing = 0.1
 
+// DialSuccessEWMASmoothing governs the decay of the EWMA of the dial success rate,
+// like LatencyEWMASmoothing.
+var DialSuccessEWMASmoothing = 0.25
+
+// DialMetrics is implemented by peerstores that also record the outcome of the dials
+// of the peers. pstoremem, pstoreds and pstoresqlite do, and the swarm records its
+// dials in them.
+type DialMetrics interface {
+	// RecordDial records a dial of a peer that took d, and whether it succeeded.
+	RecordDial(p peer.ID, d time.Duration, success bool)
+
+	// DialLatencyEWMA returns an exponentially-weighted moving avg.
+	// of the duration of the successful dials of a peer.
+	DialLatencyEWMA(p peer.ID) time.Duration
+
+	// DialSuccessRate returns an exponentially-weighted moving avg. of the outcome
+	// of the dials of a peer, between 0 (all failed) and 1 (all succeeded). It returns
+	// false if the peer wasn't dialed.
+	DialSuccessRate(p peer.ID) (float64, bool)
+}
+
+type dialStats struct {
+	latency     time.Duration
+	successRate float64
+}
+
 type metrics struct {
-	mutex  sync.RWMutex
-	latmap map[peer.ID]time.Duration
+	mutex   sync.RWMutex
+	latmap  map[peer.ID]time.Duration
+	dialmap map[peer.ID]dialStats
 }
 
+var _ DialMetrics = (*metrics)(nil)
+
 func NewMetrics() *metrics {
 	return &metrics{
-		latmap: make(map[peer.ID]time.Duration),
+		latmap:  make(map[peer.ID]time.Duration),
+		dialmap: make(map[peer.ID]dialStats),
 	}
 }
 
+// smoothing returns s if it's a normalized (0-1) value, and def otherwise.
+func smoothing(s, def float64) float64 {
+	if s > 1 || s < 0 {
+		return def
+	}
+	return s
+}
+
 // RecordLatency records a new latency measurement
 func (m *metrics) RecordLatency(p peer.ID, next time.Duration) {
 	nextf := float64(next)
@@ -51,8 +89,53 @@ func (m *metrics) LatencyEWMA(p peer.ID) time.Duration {
 	return m.latmap[p]
 }
 
+// RecordDial records a dial of a peer that took d, and whether it succeeded.
+func (m *metrics) RecordDial(p peer.ID, d time.Duration, success bool) {
+	ls := smoothing(LatencyEWMASmoothing, 0.1)
+	ss := smoothing(DialSuccessEWMASmoothing, 0.25)
+	outcome := 0.0
+	if success {
+		outcome = 1
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	st, found := m.dialmap[p]
+	if !found {
+		st.successRate = outcome
+	} else {
+		st.successRate = (1.0-ss)*st.successRate + ss*outcome
+	}
+	if success {
+		if st.latency == 0 {
+			st.latency = d
+		} else {
+			st.latency = time.Duration((1.0-ls)*float64(st.latency) + ls*float64(d))
+		}
+	}
+	m.dialmap[p] = st
+}
+
+// DialLatencyEWMA returns an exponentially-weighted moving avg.
+// of the duration of the successful dials of a peer.
+func (m *metrics) DialLatencyEWMA(p peer.ID) time.Duration {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.dialmap[p].latency
+}
+
+// DialSuccessRate returns an exponentially-weighted moving avg. of the outcome of the
+// dials of a peer.
+func (m *metrics) DialSuccessRate(p peer.ID) (float64, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	st, ok := m.dialmap[p]
+	return st.successRate, ok
+}
+
 func (m *metrics) RemovePeer(p peer.ID) {
 	m.mutex.Lock()
 	delete(m.latmap, p)
+	delete(m.dialmap, p)
 	m.mutex.Unlock()
 }
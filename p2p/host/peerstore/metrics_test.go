@@ -61,3 +61,34 @@ func TestLatencyEWMA(t *testing.T) {
 		t.Fatalf("latency outside of expected range. expected %d ± %d, got %d", exp, sig, lat)
 	}
 }
+
+func TestDialMetrics(t *testing.T) {
+	m := NewMetrics()
+	id, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.DialSuccessRate(id); ok {
+		t.Fatal("expected no dial success rate before the first dial")
+	}
+	m.RecordDial(id, time.Second, false)
+	if rate, _ := m.DialSuccessRate(id); rate != 0 {
+		t.Fatalf("expected a dial success rate of 0, got %f", rate)
+	}
+	if lat := m.DialLatencyEWMA(id); lat != 0 {
+		t.Fatalf("expected failed dials not to count towards the latency, got %s", lat)
+	}
+	m.RecordDial(id, 100*time.Millisecond, true)
+	if rate, _ := m.DialSuccessRate(id); rate != DialSuccessEWMASmoothing {
+		t.Fatalf("expected a dial success rate of %f, got %f", DialSuccessEWMASmoothing, rate)
+	}
+	if lat := m.DialLatencyEWMA(id); lat != 100*time.Millisecond {
+		t.Fatalf("expected a dial latency of 100ms, got %s", lat)
+	}
+
+	m.RemovePeer(id)
+	if _, ok := m.DialSuccessRate(id); ok {
+		t.Fatal("expected the dial metrics to be removed with the peer")
+	}
+}
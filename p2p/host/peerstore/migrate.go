@@ -0,0 +1,53 @@
+package peerstore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+)
+
+// Migrate copies the contents of the peerstore src to dst, e.g. to move the peerstore
+// of a node to a different persistent backend. Neither peerstore should be used by a
+// node during the migration.
+//
+// Addresses are copied like by Export and Import, so that they keep their expiration
+// times. Unlike with a snapshot, private keys are copied too, and metadata values are
+// copied as is, which requires src to implement MetadataLister.
+func Migrate(dst, src pstore.Peerstore) error {
+	now := time.Now()
+	for _, p := range src.Peers() {
+		if err := migratePeer(dst, src, p, now); err != nil {
+			return fmt.Errorf("failed to migrate peer %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+func migratePeer(dst, src pstore.Peerstore, p peer.ID, now time.Time) error {
+	s, err := exportPeer(src, p, now)
+	if err != nil {
+		return err
+	}
+	if err := importPeer(dst, s, now); err != nil {
+		return err
+	}
+	if sk := src.PrivKey(p); sk != nil {
+		if err := dst.AddPrivKey(p, sk); err != nil {
+			return err
+		}
+	}
+	if ml, ok := src.(MetadataLister); ok {
+		for _, k := range ml.MetadataKeys(p) {
+			v, err := src.Get(p, k)
+			if err != nil {
+				return err
+			}
+			if err := dst.Put(p, k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package peerstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoreds"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+
+	src, err := pstoreds.NewPeerstore(context.Background(), dssync.MutexWrap(ds.NewMapDatastore()), pstoreds.DefaultOpts())
+	require.NoError(t, err)
+	defer src.Close()
+	require.NoError(t, src.AddPrivKey(p, priv))
+	src.AddAddr(p, addr, time.Hour)
+	require.NoError(t, src.AddProtocols(p, "/foo/1.0.0"))
+	require.NoError(t, src.Put(p, "latency", 42))
+
+	dst, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer dst.Close()
+	require.NoError(t, peerstore.Migrate(dst, src))
+
+	require.True(t, dst.PrivKey(p).Equals(priv))
+	require.True(t, dst.PubKey(p).Equals(priv.GetPublic()))
+	require.Equal(t, []ma.Multiaddr{addr}, dst.Addrs(p))
+	expiry := dst.AddrsWithExpiry(p)
+	require.Len(t, expiry, 1)
+	require.Greater(t, expiry[0].TTL, 59*time.Minute)
+	protos, err := dst.GetProtocols(p)
+	require.NoError(t, err)
+	require.Equal(t, []protocol.ID{"/foo/1.0.0"}, protos)
+	// metadata values keep their types
+	v, err := dst.Get(p, "latency")
+	require.NoError(t, err)
+	require.Equal(t, 42, v)
+}
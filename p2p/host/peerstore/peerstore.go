@@ -5,7 +5,12 @@ import (
 	pstore "github.com/libp2p/go-libp2p/core/peerstore"
 )
 
+// PeerInfos returns the AddrInfos of peers, in a single batch if ps is a
+// BatchPeerstore.
 func PeerInfos(ps pstore.Peerstore, peers peer.IDSlice) []peer.AddrInfo {
+	if bps, ok := ps.(BatchPeerstore); ok {
+		return bps.PeerInfos(peers)
+	}
 	pi := make([]peer.AddrInfo, len(peers))
 	for i, p := range peers {
 		pi[i] = ps.PeerInfo(p)
@@ -11,6 +11,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	pstore "github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
 	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoreds/pb"
 	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
 
@@ -277,7 +278,7 @@ func (ab *dsAddrBook) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duratio
 		return
 	}
 	addrs = cleanAddrs(addrs, p)
-	ab.setAddrs(p, addrs, ttl, ttlExtend, false)
+	ab.setAddrs(p, addrs, ttl, ttlExtend, pstore.AddrSourceUnknown, false)
 }
 
 // ConsumePeerRecord adds addresses from a signed peer.PeerRecord (contained in
@@ -303,7 +304,7 @@ func (ab *dsAddrBook) ConsumePeerRecord(recordEnvelope *record.Envelope, ttl tim
 	}
 
 	addrs := cleanAddrs(rec.Addrs, rec.PeerID)
-	err = ab.setAddrs(rec.PeerID, addrs, ttl, ttlExtend, true)
+	err = ab.setAddrs(rec.PeerID, addrs, ttl, ttlExtend, pstore.AddrSourceUnknown, true)
 	if err != nil {
 		return false, err
 	}
@@ -390,7 +391,7 @@ func (ab *dsAddrBook) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duratio
 		ab.deleteAddrs(p, addrs)
 		return
 	}
-	ab.setAddrs(p, addrs, ttl, ttlOverride, false)
+	ab.setAddrs(p, addrs, ttl, ttlOverride, pstore.AddrSourceUnknown, false)
 }
 
 // UpdateAddrs will update any addresses for a given peer and TTL combination to
@@ -442,6 +443,36 @@ func (ab *dsAddrBook) Addrs(p peer.ID) []ma.Multiaddr {
 	return addrs
 }
 
+// GC purges the expired addresses from the datastore, and deletes the records of the
+// peers left without addresses.
+func (ab *dsAddrBook) GC(ctx context.Context) error {
+	return ab.gc.purge(ctx)
+}
+
+// AddrsWithExpiry returns the addresses of p that haven't expired yet, along with
+// their TTLs and expiration times.
+func (ab *dsAddrBook) AddrsWithExpiry(p peer.ID) []peerstore.ExpiringAddr {
+	pr, err := ab.loadRecord(p, true, true)
+	if err != nil {
+		log.Warnw("failed to load peerstore entry while querying addrs", "peer", p, "error", err)
+		return nil
+	}
+
+	pr.RLock()
+	defer pr.RUnlock()
+
+	addrs := make([]peerstore.ExpiringAddr, len(pr.Addrs))
+	for i, a := range pr.Addrs {
+		addr, err := ma.NewMultiaddrBytes(a.Addr)
+		if err != nil {
+			log.Warnw("failed to parse peerstore entry while querying addrs", "peer", p, "error", err)
+			return nil
+		}
+		addrs[i] = peerstore.ExpiringAddr{Addr: addr, TTL: time.Duration(a.Ttl), Expires: time.Unix(a.Expiry, 0)}
+	}
+	return addrs
+}
+
 // Peers returns all of the peer IDs for which the AddrBook has addresses.
 func (ab *dsAddrBook) PeersWithAddrs() peer.IDSlice {
 	ids, err := uniquePeerIds(ab.ds, addrBookBase, func(result query.Result) string {
@@ -470,7 +501,7 @@ func (ab *dsAddrBook) ClearAddrs(p peer.ID) {
 	}
 }
 
-func (ab *dsAddrBook) setAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, mode ttlWriteMode, signed bool) (err error) {
+func (ab *dsAddrBook) setAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, mode ttlWriteMode, src pstore.AddrSource, signed bool) (err error) {
 	if len(addrs) == 0 {
 		return nil
 	}
@@ -488,7 +519,14 @@ func (ab *dsAddrBook) setAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duratio
 	// 	return nil
 	// }
 
-	newExp := ab.clock.Now().Add(ttl).Unix()
+	ab.updateRecord(pr, p, addrs, ttl, mode, src)
+	return pr.flush(ab.ds)
+}
+
+// updateRecord updates the addrs of p in its record pr, which must be locked. In ttlExtend
+// mode, src is recorded as the source of the addresses, see AddAddrsWithSource.
+func (ab *dsAddrBook) updateRecord(pr *addrsRecord, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, mode ttlWriteMode, src pstore.AddrSource) {
+	now := ab.clock.Now()
 	addrsMap := make(map[string]*pb.AddrBookRecord_AddrEntry, len(pr.Addrs))
 	for _, addr := range pr.Addrs {
 		addrsMap[string(addr.Addr)] = addr
@@ -503,12 +541,19 @@ func (ab *dsAddrBook) setAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duratio
 		switch mode {
 		case ttlOverride:
 			existingEntry.Ttl = int64(ttl)
-			existingEntry.Expiry = newExp
+			existingEntry.Expiry = now.Add(ttl).Unix()
 		case ttlExtend:
+			if src.Replaces(pstore.AddrSource(existingEntry.Source)) {
+				existingEntry.Source = int32(src)
+			}
+			if src == pstore.AddrSource(existingEntry.Source) {
+				existingEntry.Added = now.Unix()
+			}
+			ttl := ab.limitTTL(ttl, pstore.AddrSource(existingEntry.Source), existingEntry.LastConfirmed)
 			if int64(ttl) > existingEntry.Ttl {
 				existingEntry.Ttl = int64(ttl)
 			}
-			if newExp > existingEntry.Expiry {
+			if newExp := now.Add(ttl).Unix(); newExp > existingEntry.Expiry {
 				existingEntry.Expiry = newExp
 			}
 		default:
@@ -527,10 +572,16 @@ func (ab *dsAddrBook) setAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duratio
 			// 	}
 			// } else {
 			// new addr, add & broadcast
+			ttl := ttl
+			if mode == ttlExtend {
+				ttl = ab.limitTTL(ttl, src, 0)
+			}
 			entry := &pb.AddrBookRecord_AddrEntry{
 				Addr:   incoming.Bytes(),
 				Ttl:    int64(ttl),
-				Expiry: newExp,
+				Expiry: now.Add(ttl).Unix(),
+				Source: int32(src),
+				Added:  now.Unix(),
 			}
 			entries = append(entries, entry)
 
@@ -548,8 +599,7 @@ func (ab *dsAddrBook) setAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duratio
 	// }
 
 	pr.dirty = true
-	pr.clean(ab.clock.Now())
-	return pr.flush(ab.ds)
+	pr.clean(now)
 }
 
 // deletes addresses in place, avoiding copies until we encounter the first deletion.
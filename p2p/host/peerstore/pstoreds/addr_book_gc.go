@@ -138,6 +138,10 @@ func (gc *dsAddrBookGc) purgeLookahead() {
 		return
 	}
 
+	start := time.Now()
+	var purged purgeStats
+	defer func() { gc.report(purged, time.Since(start)) }()
+
 	var id peer.ID
 	record := &addrsRecord{AddrBookRecord: &pb.AddrBookRecord{}} // empty record to reuse and avoid allocs.
 	batch, err := newCyclicBatch(gc.ab.ds, defaultOpsPerCyclicBatch)
@@ -213,7 +217,10 @@ func (gc *dsAddrBookGc) purgeLookahead() {
 		// if the record is in cache, we clean it and flush it if necessary.
 		if cached, ok := gc.ab.cache.Peek(id); ok {
 			cached.Lock()
+			before := len(cached.Addrs)
+			gc.ab.expireBySource(cached, gc.ab.clock.Now())
 			if cached.clean(gc.ab.clock.Now()) {
+				purged.add(before, len(cached.Addrs))
 				if err = cached.flush(batch); err != nil {
 					log.Warnf("failed to flush entry modified by GC for peer: &v, err: %v", id.Pretty(), err)
 				}
@@ -238,7 +245,10 @@ func (gc *dsAddrBookGc) purgeLookahead() {
 			dropInError(gcKey, err, "unmarshalling entry")
 			continue
 		}
+		before := len(record.Addrs)
+		gc.ab.expireBySource(record, gc.ab.clock.Now())
 		if record.clean(gc.ab.clock.Now()) {
+			purged.add(before, len(record.Addrs))
 			err = record.flush(batch)
 			if err != nil {
 				log.Warnf("failed to flush entry modified by GC for peer: &v, err: %v", id.Pretty(), err)
@@ -261,6 +271,29 @@ func (gc *dsAddrBookGc) purgeStore() {
 		return
 	}
 
+	gc.purgeStoreLocked()
+}
+
+// purge runs a full purge cycle, waiting for the running GC process to finish first.
+func (gc *dsAddrBookGc) purge(ctx context.Context) error {
+	select {
+	case gc.running <- struct{}{}:
+		defer func() { <-gc.running }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	gc.purgeStoreLocked()
+	return nil
+}
+
+// purgeStoreLocked visits all entries in the datastore, deleting the addresses that have expired.
+// The caller must hold the running lock.
+func (gc *dsAddrBookGc) purgeStoreLocked() {
+	start := time.Now()
+	var purged purgeStats
+	defer func() { gc.report(purged, time.Since(start)) }()
+
 	record := &addrsRecord{AddrBookRecord: &pb.AddrBookRecord{}} // empty record to reuse and avoid allocs.
 	batch, err := newCyclicBatch(gc.ab.ds, defaultOpsPerCyclicBatch)
 	if err != nil {
@@ -283,9 +316,12 @@ func (gc *dsAddrBookGc) purgeStore() {
 		}
 
 		id := record.Id
+		before := len(record.Addrs)
+		gc.ab.expireBySource(record, gc.ab.clock.Now())
 		if !record.clean(gc.ab.clock.Now()) {
 			continue
 		}
+		purged.add(before, len(record.Addrs))
 
 		if err := record.flush(batch); err != nil {
 			log.Warnf("failed to flush entry modified by GC for peer: &v, err: %v", id, err)
@@ -298,6 +334,24 @@ func (gc *dsAddrBookGc) purgeStore() {
 	}
 }
 
+// purgeStats counts the addresses and peers purged by a GC cycle.
+type purgeStats struct {
+	addrs, peers int
+}
+
+func (s *purgeStats) add(before, after int) {
+	s.addrs += before - after
+	if before > 0 && after == 0 {
+		s.peers++
+	}
+}
+
+func (gc *dsAddrBookGc) report(purged purgeStats, d time.Duration) {
+	if gc.ab.opts.MetricsTracer != nil {
+		gc.ab.opts.MetricsTracer.GCFinished(purged.addrs, purged.peers, d)
+	}
+}
+
 // populateLookahead populates the lookahead window by scanning the entire store and picking entries whose earliest
 // expiration falls within the window period.
 //
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/peer"
 	pstore "github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/p2p/host/peerstore/test"
 
@@ -232,6 +233,42 @@ func TestGCLookaheadDisabled(t *testing.T) {
 	test.AssertAddressesEqual(t, addrs[40:], ab.Addrs(ids[3]))
 }
 
+type mockGCMetricsTracer struct {
+	addrs, peers int
+}
+
+func (mt *mockGCMetricsTracer) GCFinished(addrs, peers int, _ time.Duration) {
+	mt.addrs += addrs
+	mt.peers += peers
+}
+
+func TestGCManual(t *testing.T) {
+	ids := test.GeneratePeerIDs(2)
+	addrs := test.GenerateAddrs(30)
+
+	opts := DefaultOpts()
+	opts.GCPurgeInterval = 0 // only run GC manually
+	clk := mockClock.NewMock()
+	opts.Clock = clk
+	mt := &mockGCMetricsTracer{}
+	opts.MetricsTracer = mt
+
+	factory := addressBookFactory(t, leveldbStore, opts)
+	ab, closeFn := factory()
+	defer closeFn()
+
+	ab.AddAddrs(ids[0], addrs[:10], time.Minute)
+	ab.AddAddrs(ids[1], addrs[10:20], time.Minute)
+	ab.AddAddrs(ids[1], addrs[20:30], time.Hour)
+
+	clk.Add(2 * time.Minute)
+	require.NoError(t, ab.(*dsAddrBook).GC(context.Background()))
+	require.Equal(t, 20, mt.addrs)
+	require.Equal(t, 1, mt.peers)
+	require.ElementsMatch(t, peer.IDSlice{ids[1]}, ab.PeersWithAddrs())
+	test.AssertAddressesEqual(t, addrs[20:30], ab.Addrs(ids[1]))
+}
+
 func BenchmarkLookaheadCycle(b *testing.B) {
 	ids := test.GeneratePeerIDs(100)
 	addrs := test.GenerateAddrs(100)
@@ -0,0 +1,159 @@
+package pstoreds
+
+import (
+	"context"
+	"sort"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
+)
+
+var _ peerstore.BatchPeerstore = (*pstoreds)(nil)
+
+// AddAddrsBatch adds the addresses of all peers in batch, writing the updated records
+// to the datastore in a single batch. If a record can't be loaded or written, none of
+// the addresses are added.
+func (ab *dsAddrBook) AddAddrsBatch(batch []peerstore.PeerAddrs) {
+	byPeer := make(map[peer.ID][]peerstore.PeerAddrs, len(batch))
+	for _, e := range batch {
+		if e.TTL <= 0 {
+			continue
+		}
+		e.Addrs = cleanAddrs(e.Addrs, e.ID)
+		if len(e.Addrs) == 0 {
+			continue
+		}
+		byPeer[e.ID] = append(byPeer[e.ID], e)
+	}
+	if len(byPeer) == 0 {
+		return
+	}
+
+	// Keep all records locked until the batch is committed, so that concurrent updates
+	// of a record can't be overwritten by the batch. Records are locked in order to
+	// prevent concurrent batches from deadlocking.
+	peers := make(peer.IDSlice, 0, len(byPeer))
+	for p := range byPeer {
+		peers = append(peers, p)
+	}
+	sort.Sort(peers)
+	records := make([]*addrsRecord, 0, len(peers))
+	defer func() {
+		for _, pr := range records {
+			pr.Unlock()
+		}
+	}()
+	for _, p := range peers {
+		pr, err := ab.loadRecord(p, true, false)
+		if err != nil {
+			log.Errorw("failed to load peerstore entry while adding addrs", "peer", p, "error", err)
+			return
+		}
+		pr.Lock()
+		records = append(records, pr)
+	}
+
+	b, err := ab.ds.Batch(context.TODO())
+	if err != nil {
+		log.Errorw("failed to create batch while adding addrs", "error", err)
+		return
+	}
+	for _, pr := range records {
+		p := peer.ID(pr.Id)
+		for _, e := range byPeer[p] {
+			ab.updateRecord(pr, p, e.Addrs, e.TTL, ttlExtend, pstore.AddrSourceUnknown)
+		}
+		if err = pr.flush(b); err != nil {
+			log.Errorw("failed to write peerstore entry while adding addrs", "peer", p, "error", err)
+			break
+		}
+	}
+	if err == nil {
+		if err = b.Commit(context.TODO()); err != nil {
+			log.Errorw("failed to commit batch while adding addrs", "error", err)
+		}
+	}
+	if err != nil {
+		// roll back: the updated records are reloaded from the datastore
+		for _, pr := range records {
+			ab.cache.Remove(peer.ID(pr.Id))
+		}
+	}
+}
+
+// metadataBatcher is implemented by the metadata stores that can write values in a
+// single batch, like dsPeerMetadata.
+type metadataBatcher interface {
+	PutBatch(batch []peerstore.PeerMetadataValue) error
+}
+
+// AddProtocolsBatch adds the protocols of all peers in batch, writing them to the
+// datastore in a single batch. The protocols of the peers exceeding the protocol
+// limit aren't added. If writing the batch fails, none of the protocols are added.
+func (pb *dsProtoBook) AddProtocolsBatch(batch []peerstore.PeerProtocols) error {
+	// Keep the segments of all peers locked until the batch is written. Segments are
+	// locked in order to prevent concurrent batches from deadlocking.
+	var locked [len(pb.segments)]bool
+	for _, e := range batch {
+		locked[byte(e.ID[len(e.ID)-1])] = true
+	}
+	for i, l := range locked {
+		if l {
+			pb.segments[i].Lock()
+			defer pb.segments[i].Unlock()
+		}
+	}
+
+	var firstErr error
+	pmaps := make(map[peer.ID]map[protocol.ID]struct{}, len(batch))
+	for _, e := range batch {
+		pmap, ok := pmaps[e.ID]
+		if !ok {
+			var err error
+			if pmap, err = pb.getProtocolMap(e.ID); err != nil {
+				return err
+			}
+		}
+		if len(pmap)+len(e.Protocols) > pb.maxProtos {
+			if firstErr == nil {
+				firstErr = errTooManyProtocols
+			}
+			if !ok {
+				continue
+			}
+		} else {
+			for _, proto := range e.Protocols {
+				pmap[proto] = struct{}{}
+			}
+		}
+		pmaps[e.ID] = pmap
+	}
+
+	vals := make([]peerstore.PeerMetadataValue, 0, len(pmaps))
+	for p, pmap := range pmaps {
+		vals = append(vals, peerstore.PeerMetadataValue{ID: p, Key: protocolsKey, Value: pmap})
+	}
+	if mb, ok := pb.meta.(metadataBatcher); ok {
+		if err := mb.PutBatch(vals); err != nil {
+			return err
+		}
+		return firstErr
+	}
+	for _, v := range vals {
+		if err := pb.meta.Put(v.ID, v.Key, v.Value); err != nil {
+			return err
+		}
+	}
+	return firstErr
+}
+
+// PeerInfos returns the AddrInfos of peers.
+func (ps *pstoreds) PeerInfos(peers peer.IDSlice) []peer.AddrInfo {
+	infos := make([]peer.AddrInfo, len(peers))
+	for i, p := range peers {
+		infos[i] = peer.AddrInfo{ID: p, Addrs: ps.dsAddrBook.Addrs(p)}
+	}
+	return infos
+}
@@ -1,18 +1,25 @@
 package pstoreds
 
 import (
+	"bytes"
 	"context"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
 	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/test"
 	pt "github.com/libp2p/go-libp2p/p2p/host/peerstore/test"
 
 	mockClock "github.com/benbjohnson/clock"
 	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
 	badger "github.com/ipfs/go-ds-badger"
 	leveldb "github.com/ipfs/go-ds-leveldb"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -72,7 +79,66 @@ func TestDsKeyBook(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			pt.TestKeyBook(t, keyBookFactory(t, dsFactory, DefaultOpts()))
 		})
+
+		t.Run(name+" Encrypted", func(t *testing.T) {
+			opts := DefaultOpts()
+			enc, err := NewPassphraseKeyEncrypter([]byte("passphrase"))
+			require.NoError(t, err)
+			opts.KeyEncrypter = enc
+			pt.TestKeyBook(t, keyBookFactory(t, dsFactory, opts))
+		})
+	}
+}
+
+func TestKeyEncryption(t *testing.T) {
+	store := dssync.MutexWrap(ds.NewMapDatastore())
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	marshaled, err := crypto.MarshalPrivateKey(priv)
+	require.NoError(t, err)
+
+	newKeyBook := func(passphrase string) *dsKeyBook {
+		opts := DefaultOpts()
+		if passphrase != "" {
+			enc, err := NewPassphraseKeyEncrypter([]byte(passphrase))
+			require.NoError(t, err)
+			opts.KeyEncrypter = enc
+		}
+		kb, err := NewKeyBook(context.Background(), store, opts)
+		require.NoError(t, err)
+		return kb
+	}
+	containsPlaintext := func() bool {
+		res, err := store.Query(context.Background(), query.Query{})
+		require.NoError(t, err)
+		entries, err := res.Rest()
+		require.NoError(t, err)
+		for _, e := range entries {
+			if bytes.Contains(e.Value, marshaled) {
+				return true
+			}
+		}
+		return false
 	}
+
+	// a key stored before encryption was enabled is encrypted once it's read
+	require.NoError(t, newKeyBook("").AddPrivKey(p, priv))
+	require.True(t, containsPlaintext())
+	require.True(t, newKeyBook("passphrase").PrivKey(p).Equals(priv))
+	require.False(t, containsPlaintext())
+
+	require.True(t, newKeyBook("passphrase").PrivKey(p).Equals(priv))
+	require.Nil(t, newKeyBook("wrong").PrivKey(p))
+	require.Nil(t, newKeyBook("").PrivKey(p))
+	require.Equal(t, peer.IDSlice{p}, newKeyBook("").PeersWithKeys())
+
+	newKeyBook("passphrase").RemovePeer(p)
+	require.Empty(t, newKeyBook("").PeersWithKeys())
+
+	_, err = NewPassphraseKeyEncrypter(nil)
+	require.Error(t, err)
 }
 
 func BenchmarkDsKeyBook(b *testing.B) {
@@ -171,3 +237,55 @@ func keyBookFactory(tb testing.TB, storeFactory datastoreFactory, opts Options)
 		return kb, storeCloseFn
 	}
 }
+
+func TestAddrProvenance(t *testing.T) {
+	clk := mockClock.NewMock()
+	clk.Set(time.Now())
+	opts := DefaultOpts()
+	opts.Clock = clk
+	opts.GCPurgeInterval = 0
+	opts.SourceAddrTTLs = map[pstore.AddrSource]time.Duration{pstore.AddrSourceDHT: time.Minute}
+	ab, err := NewAddrBook(context.Background(), dssync.MutexWrap(ds.NewMapDatastore()), opts)
+	require.NoError(t, err)
+	defer ab.Close()
+
+	p := test.RandPeerIDFatal(t)
+	dht := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	identify := ma.StringCast("/ip4/1.2.3.4/tcp/2")
+	confirmed := ma.StringCast("/ip4/1.2.3.4/tcp/3")
+
+	ab.AddAddrsWithSource(p, []ma.Multiaddr{dht, identify}, time.Hour, pstore.AddrSourceDHT)
+	ab.AddAddrsWithSource(p, []ma.Multiaddr{identify}, time.Hour, pstore.AddrSourceIdentify)
+	// an unknown source doesn't replace a known one
+	ab.AddAddrs(p, []ma.Multiaddr{identify}, time.Hour)
+	ab.AddAddr(p, confirmed, time.Hour)
+	ab.ConfirmAddr(p, confirmed)
+
+	prov, ok := ab.AddrProvenance(p, dht)
+	require.True(t, ok)
+	require.Equal(t, pstore.AddrSourceDHT, prov.Source)
+	require.True(t, prov.LastConfirmed.IsZero())
+	prov, ok = ab.AddrProvenance(p, identify)
+	require.True(t, ok)
+	require.Equal(t, pstore.AddrSourceIdentify, prov.Source)
+	prov, ok = ab.AddrProvenance(p, confirmed)
+	require.True(t, ok)
+	require.Equal(t, clk.Now().Unix(), prov.LastConfirmed.Unix())
+	_, ok = ab.AddrProvenance(p, ma.StringCast("/ip4/1.2.3.4/tcp/4"))
+	require.False(t, ok)
+
+	// the TTL of unconfirmed addresses from the DHT is limited
+	for _, a := range ab.AddrsWithExpiry(p) {
+		if a.Addr.Equal(dht) {
+			require.Equal(t, time.Minute, a.TTL)
+		}
+	}
+
+	// GC purges the unconfirmed address from the DHT once its limit elapsed, even if
+	// its TTL was raised in the meantime
+	ab.SetAddr(p, dht, time.Hour)
+	clk.Add(2 * time.Minute)
+	require.NoError(t, ab.GC(context.Background()))
+	ab.cache.Remove(p)
+	require.ElementsMatch(t, []ma.Multiaddr{identify, confirmed}, ab.Addrs(p))
+}
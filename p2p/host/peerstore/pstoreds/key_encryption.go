@@ -0,0 +1,117 @@
+package pstoreds
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeyEncrypter encrypts the private keys stored by the keybook, so that they can't be
+// recovered from the datastore alone. Implementations can wrap an external key
+// provider, e.g. a KMS or a hardware security module.
+type KeyEncrypter interface {
+	// Encrypt encrypts a marshaled private key.
+	Encrypt(plaintext []byte) ([]byte, error)
+	// Decrypt reverses Encrypt.
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+const (
+	passphraseEncryptionVersion = 1
+	passphraseSaltLen           = 16
+
+	// scrypt parameters, as recommended for interactive logins in 2017
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// passphraseKeyEncrypter encrypts keys with XChaCha20-Poly1305, using a key derived
+// from a passphrase with scrypt. Ciphertexts hold the version, the salt the key was
+// derived with and the nonce, followed by the sealed plaintext.
+type passphraseKeyEncrypter struct {
+	passphrase []byte
+	salt       []byte
+
+	mx sync.Mutex
+	// keys caches the derived keys by salt, as deriving a key is slow on purpose
+	keys map[string][]byte
+}
+
+var _ KeyEncrypter = (*passphraseKeyEncrypter)(nil)
+
+// NewPassphraseKeyEncrypter returns a KeyEncrypter that encrypts keys with a key
+// derived from passphrase using scrypt. The passphrase must be kept secret, and is
+// needed to read the keys again.
+func NewPassphraseKeyEncrypter(passphrase []byte) (KeyEncrypter, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	salt := make([]byte, passphraseSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &passphraseKeyEncrypter{
+		passphrase: append([]byte(nil), passphrase...),
+		salt:       salt,
+		keys:       make(map[string][]byte),
+	}, nil
+}
+
+func (e *passphraseKeyEncrypter) key(salt []byte) ([]byte, error) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	if k, ok := e.keys[string(salt)]; ok {
+		return k, nil
+	}
+	k, err := scrypt.Key(e.passphrase, salt, scryptN, scryptR, scryptP, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	e.keys[string(salt)] = k
+	return k, nil
+}
+
+func (e *passphraseKeyEncrypter) Encrypt(plaintext []byte) ([]byte, error) {
+	k, err := e.key(e.salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(k)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, 1+passphraseSaltLen+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out = append(out, passphraseEncryptionVersion)
+	out = append(out, e.salt...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, nil), nil
+}
+
+func (e *passphraseKeyEncrypter) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 1+passphraseSaltLen+chacha20poly1305.NonceSizeX {
+		return nil, errors.New("ciphertext too short")
+	}
+	if v := ciphertext[0]; v != passphraseEncryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption version: %d", v)
+	}
+	salt := ciphertext[1 : 1+passphraseSaltLen]
+	nonce := ciphertext[1+passphraseSaltLen : 1+passphraseSaltLen+chacha20poly1305.NonceSizeX]
+	k, err := e.key(salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(k)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext[1+passphraseSaltLen+len(nonce):], nil)
+}
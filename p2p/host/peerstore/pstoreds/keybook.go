@@ -14,21 +14,25 @@ import (
 )
 
 // Public and private keys are stored under the following db key pattern:
-// /peers/keys/<b32 peer id no padding>/{pub, priv}
+// /peers/keys/<b32 peer id no padding>/{pub, priv, encpriv}
+// Private keys are stored under encpriv instead of priv if they are encrypted.
 var (
-	kbBase     = ds.NewKey("/peers/keys")
-	pubSuffix  = ds.NewKey("/pub")
-	privSuffix = ds.NewKey("/priv")
+	kbBase        = ds.NewKey("/peers/keys")
+	pubSuffix     = ds.NewKey("/pub")
+	privSuffix    = ds.NewKey("/priv")
+	encPrivSuffix = ds.NewKey("/encpriv")
 )
 
 type dsKeyBook struct {
 	ds ds.Datastore
+	// encrypter encrypts the private keys, if set
+	encrypter KeyEncrypter
 }
 
 var _ pstore.KeyBook = (*dsKeyBook)(nil)
 
-func NewKeyBook(_ context.Context, store ds.Datastore, _ Options) (*dsKeyBook, error) {
-	return &dsKeyBook{store}, nil
+func NewKeyBook(_ context.Context, store ds.Datastore, opts Options) (*dsKeyBook, error) {
+	return &dsKeyBook{ds: store, encrypter: opts.KeyEncrypter}, nil
 }
 
 func (kb *dsKeyBook) PubKey(p peer.ID) ic.PubKey {
@@ -85,10 +89,49 @@ func (kb *dsKeyBook) AddPubKey(p peer.ID, pk ic.PubKey) error {
 }
 
 func (kb *dsKeyBook) PrivKey(p peer.ID) ic.PrivKey {
+	if kb.encrypter != nil {
+		return kb.encryptedPrivKey(p)
+	}
 	value, err := kb.ds.Get(context.TODO(), peerToKey(p, privSuffix))
+	if err != nil {
+		if has, _ := kb.ds.Has(context.TODO(), peerToKey(p, encPrivSuffix)); has {
+			log.Errorf("privkey for peer %s is encrypted, but no key encrypter is configured", p.Pretty())
+		}
+		return nil
+	}
+	sk, err := ic.UnmarshalPrivateKey(value)
+	if err != nil {
+		return nil
+	}
+	return sk
+}
+
+// encryptedPrivKey returns the encrypted private key of p. A private key stored
+// unencrypted, e.g. before encryption was enabled, is encrypted on the fly.
+func (kb *dsKeyBook) encryptedPrivKey(p peer.ID) ic.PrivKey {
+	value, err := kb.ds.Get(context.TODO(), peerToKey(p, encPrivSuffix))
+	if err == ds.ErrNotFound {
+		value, err := kb.ds.Get(context.TODO(), peerToKey(p, privSuffix))
+		if err != nil {
+			return nil
+		}
+		sk, err := ic.UnmarshalPrivateKey(value)
+		if err != nil {
+			return nil
+		}
+		if err := kb.AddPrivKey(p, sk); err != nil {
+			log.Errorf("error while encrypting unencrypted privkey for peer %s: %s\n", p.Pretty(), err)
+		}
+		return sk
+	}
 	if err != nil {
 		return nil
 	}
+	value, err = kb.encrypter.Decrypt(value)
+	if err != nil {
+		log.Errorf("error while decrypting privkey for peer %s: %s\n", p.Pretty(), err)
+		return nil
+	}
 	sk, err := ic.UnmarshalPrivateKey(value)
 	if err != nil {
 		return nil
@@ -110,10 +153,28 @@ func (kb *dsKeyBook) AddPrivKey(p peer.ID, sk ic.PrivKey) error {
 		log.Errorf("error while converting privkey byte string for peer %s: %s\n", p.Pretty(), err)
 		return err
 	}
-	if err := kb.ds.Put(context.TODO(), peerToKey(p, privSuffix), val); err != nil {
+	if kb.encrypter == nil {
+		if err := kb.ds.Put(context.TODO(), peerToKey(p, privSuffix), val); err != nil {
+			log.Errorf("error while updating privkey in datastore for peer %s: %s\n", p.Pretty(), err)
+		}
+		return err
+	}
+
+	val, err = kb.encrypter.Encrypt(val)
+	if err != nil {
+		log.Errorf("error while encrypting privkey for peer %s: %s\n", p.Pretty(), err)
+		return err
+	}
+	if err := kb.ds.Put(context.TODO(), peerToKey(p, encPrivSuffix), val); err != nil {
 		log.Errorf("error while updating privkey in datastore for peer %s: %s\n", p.Pretty(), err)
+		return err
+	}
+	// don't leave an unencrypted copy behind
+	if err := kb.ds.Delete(context.TODO(), peerToKey(p, privSuffix)); err != nil {
+		log.Errorf("error while deleting unencrypted privkey from datastore for peer %s: %s\n", p.Pretty(), err)
+		return err
 	}
-	return err
+	return nil
 }
 
 func (kb *dsKeyBook) PeersWithKeys() peer.IDSlice {
@@ -128,6 +189,7 @@ func (kb *dsKeyBook) PeersWithKeys() peer.IDSlice {
 
 func (kb *dsKeyBook) RemovePeer(p peer.ID) {
 	kb.ds.Delete(context.TODO(), peerToKey(p, privSuffix))
+	kb.ds.Delete(context.TODO(), peerToKey(p, encPrivSuffix))
 	kb.ds.Delete(context.TODO(), peerToKey(p, pubSuffix))
 }
 
@@ -9,6 +9,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	pstore "github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
 
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
@@ -41,9 +42,12 @@ func NewPeerMetadata(_ context.Context, store ds.Datastore, _ Options) (*dsPeerM
 	return &dsPeerMetadata{store}, nil
 }
 
+func metadataKey(p peer.ID, key string) ds.Key {
+	return pmBase.ChildString(base32.RawStdEncoding.EncodeToString([]byte(p))).ChildString(key)
+}
+
 func (pm *dsPeerMetadata) Get(p peer.ID, key string) (interface{}, error) {
-	k := pmBase.ChildString(base32.RawStdEncoding.EncodeToString([]byte(p))).ChildString(key)
-	value, err := pm.ds.Get(context.TODO(), k)
+	value, err := pm.ds.Get(context.TODO(), metadataKey(p, key))
 	if err != nil {
 		if err == ds.ErrNotFound {
 			err = pstore.ErrNotFound
@@ -59,12 +63,80 @@ func (pm *dsPeerMetadata) Get(p peer.ID, key string) (interface{}, error) {
 }
 
 func (pm *dsPeerMetadata) Put(p peer.ID, key string, val interface{}) error {
-	k := pmBase.ChildString(base32.RawStdEncoding.EncodeToString([]byte(p))).ChildString(key)
+	return pm.put(pm.ds, p, key, val)
+}
+
+func (pm *dsPeerMetadata) put(write ds.Write, p peer.ID, key string, val interface{}) error {
 	var buf pool.Buffer
 	if err := gob.NewEncoder(&buf).Encode(&val); err != nil {
 		return err
 	}
-	return pm.ds.Put(context.TODO(), k, buf.Bytes())
+	return write.Put(context.TODO(), metadataKey(p, key), buf.Bytes())
+}
+
+// batch returns a datastore batch, which is only written to the datastore when it's
+// committed.
+func (pm *dsPeerMetadata) batch() (ds.Batch, error) {
+	if b, ok := pm.ds.(ds.Batching); ok {
+		return b.Batch(context.TODO())
+	}
+	return ds.NewBasicBatch(pm.ds), nil
+}
+
+// PutBatch stores the metadata values in batch in a single datastore batch. If
+// encoding or writing a value fails, none of the values are stored.
+func (pm *dsPeerMetadata) PutBatch(batch []peerstore.PeerMetadataValue) error {
+	b, err := pm.batch()
+	if err != nil {
+		return err
+	}
+	for _, e := range batch {
+		if err := pm.put(b, e.ID, e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+	return b.Commit(context.TODO())
+}
+
+// GetBatch returns the metadata values stored under key for peers.
+func (pm *dsPeerMetadata) GetBatch(peers peer.IDSlice, key string) ([]interface{}, error) {
+	vals := make([]interface{}, len(peers))
+	for i, p := range peers {
+		v, err := pm.Get(p, key)
+		switch err {
+		case nil:
+			vals[i] = v
+		case pstore.ErrNotFound:
+		default:
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+// MetadataKeys returns the keys of the metadata stored for p.
+func (pm *dsPeerMetadata) MetadataKeys(p peer.ID) []string {
+	prefix := pmBase.ChildString(base32.RawStdEncoding.EncodeToString([]byte(p)))
+	result, err := pm.ds.Query(context.TODO(), query.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		log.Warnw("querying datastore when listing metadata keys failed", "peer", p, "error", err)
+		return nil
+	}
+	defer result.Close()
+
+	var keys []string
+	for entry := range result.Next() {
+		if entry.Error != nil {
+			log.Warnw("querying datastore when listing metadata keys failed", "peer", p, "error", entry.Error)
+			return nil
+		}
+		k := ds.RawKey(entry.Key)
+		if !prefix.IsAncestorOf(k) {
+			continue
+		}
+		keys = append(keys, k.Name())
+	}
+	return keys
 }
 
 func (pm *dsPeerMetadata) RemovePeer(p peer.ID) {
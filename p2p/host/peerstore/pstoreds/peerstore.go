@@ -37,6 +37,19 @@ type Options struct {
 	// before starting GC.
 	GCInitialDelay time.Duration
 
+	// MetricsTracer, if set, is notified of every GC purge cycle.
+	MetricsTracer pstore.GCMetricsTracer
+
+	// KeyEncrypter, if set, encrypts the private keys before they are stored. Keys that
+	// were stored unencrypted are encrypted when they are first read. See
+	// NewPassphraseKeyEncrypter.
+	KeyEncrypter KeyEncrypter
+
+	// SourceAddrTTLs limits the TTLs of the addresses learned from a source until we
+	// successfully connect to the peer using them. Unconfirmed addresses are purged by
+	// GC once the limit elapsed since they were last added from their source.
+	SourceAddrTTLs map[peerstore.AddrSource]time.Duration
+
 	Clock clock
 }
 
@@ -60,6 +73,7 @@ func DefaultOpts() Options {
 
 type pstoreds struct {
 	peerstore.Metrics
+	pstore.DialMetrics
 
 	*dsKeyBook
 	*dsAddrBook
@@ -68,6 +82,8 @@ type pstoreds struct {
 }
 
 var _ peerstore.Peerstore = &pstoreds{}
+var _ pstore.GCPeerstore = &pstoreds{}
+var _ pstore.DialMetrics = &pstoreds{}
 
 // NewPeerstore creates a peerstore backed by the provided persistent datastore.
 // It's the caller's responsibility to call RemovePeer to ensure
@@ -93,8 +109,10 @@ func NewPeerstore(ctx context.Context, store ds.Batching, opts Options) (*pstore
 		return nil, err
 	}
 
+	m := pstore.NewMetrics()
 	return &pstoreds{
-		Metrics:        pstore.NewMetrics(),
+		Metrics:        m,
+		DialMetrics:    m,
 		dsKeyBook:      keyBook,
 		dsAddrBook:     addrBook,
 		dsPeerMetadata: peerMetadata,
@@ -102,6 +120,18 @@ func NewPeerstore(ctx context.Context, store ds.Batching, opts Options) (*pstore
 	}, nil
 }
 
+// MetadataKeys returns the keys of the metadata stored for p, except for the key the
+// protocols of p are stored under.
+func (ps *pstoreds) MetadataKeys(p peer.ID) []string {
+	keys := ps.dsPeerMetadata.MetadataKeys(p)
+	for i, k := range keys {
+		if k == protocolsKey {
+			return append(keys[:i], keys[i+1:]...)
+		}
+	}
+	return keys
+}
+
 // uniquePeerIds extracts and returns unique peer IDs from database keys.
 func uniquePeerIds(ds ds.Datastore, prefix ds.Key, extractor func(result query.Result) string) (peer.IDSlice, error) {
 	var (
@@ -0,0 +1,115 @@
+package pstoreds
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoreds/pb"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var _ pstore.ProvenanceAddrBook = (*dsAddrBook)(nil)
+
+// limitTTL returns the TTL an address from src, last confirmed at confirmed (in
+// seconds since the Unix epoch), is added with.
+func (ab *dsAddrBook) limitTTL(ttl time.Duration, src pstore.AddrSource, confirmed int64) time.Duration {
+	if maxTTL := ab.opts.SourceAddrTTLs[src]; maxTTL > 0 && ttl > maxTTL && confirmed == 0 {
+		return maxTTL
+	}
+	return ttl
+}
+
+// sourceExpired returns true if entry is an unconfirmed address from a source with a
+// TTL limit, that wasn't added from its source again since the limit elapsed.
+func (ab *dsAddrBook) sourceExpired(entry *pb.AddrBookRecord_AddrEntry, now time.Time) bool {
+	maxTTL := ab.opts.SourceAddrTTLs[pstore.AddrSource(entry.Source)]
+	return maxTTL > 0 && entry.LastConfirmed == 0 && !now.Before(time.Unix(entry.Added, 0).Add(maxTTL))
+}
+
+// expireBySource removes the addresses of the locked record pr that expired by their
+// source, see sourceExpired. It returns true if it removed any.
+func (ab *dsAddrBook) expireBySource(pr *addrsRecord, now time.Time) bool {
+	if len(ab.opts.SourceAddrTTLs) == 0 {
+		return false
+	}
+	survivors := pr.Addrs[:0]
+	for _, entry := range pr.Addrs {
+		if !ab.sourceExpired(entry, now) {
+			survivors = append(survivors, entry)
+		}
+	}
+	if len(survivors) == len(pr.Addrs) {
+		return false
+	}
+	for i := len(survivors); i < len(pr.Addrs); i++ {
+		pr.Addrs[i] = nil
+	}
+	pr.Addrs = survivors
+	pr.dirty = true
+	return true
+}
+
+// AddAddrsWithSource adds addresses like AddAddrs, and records src as their source.
+func (ab *dsAddrBook) AddAddrsWithSource(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, src pstore.AddrSource) {
+	if ttl <= 0 {
+		return
+	}
+	addrs = cleanAddrs(addrs, p)
+	ab.setAddrs(p, addrs, ttl, ttlExtend, src, false)
+}
+
+// ConfirmAddr records that we just successfully connected to p using addr.
+func (ab *dsAddrBook) ConfirmAddr(p peer.ID, addr ma.Multiaddr) {
+	addr, _ = peer.SplitAddr(addr)
+	if addr == nil {
+		return
+	}
+	pr, err := ab.loadRecord(p, true, false)
+	if err != nil {
+		log.Errorw("failed to load peerstore entry while confirming addr", "peer", p, "error", err)
+		return
+	}
+
+	pr.Lock()
+	defer pr.Unlock()
+
+	for _, entry := range pr.Addrs {
+		if string(entry.Addr) == string(addr.Bytes()) {
+			entry.LastConfirmed = ab.clock.Now().Unix()
+			if err := pr.flush(ab.ds); err != nil {
+				log.Errorw("failed to write peerstore entry while confirming addr", "peer", p, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// AddrProvenance returns the provenance of the address addr of p.
+func (ab *dsAddrBook) AddrProvenance(p peer.ID, addr ma.Multiaddr) (pstore.AddrProvenance, bool) {
+	addr, _ = peer.SplitAddr(addr)
+	if addr == nil {
+		return pstore.AddrProvenance{}, false
+	}
+	pr, err := ab.loadRecord(p, true, true)
+	if err != nil {
+		log.Warnw("failed to load peerstore entry while querying addr provenance", "peer", p, "error", err)
+		return pstore.AddrProvenance{}, false
+	}
+
+	pr.RLock()
+	defer pr.RUnlock()
+
+	for _, entry := range pr.Addrs {
+		if string(entry.Addr) != string(addr.Bytes()) {
+			continue
+		}
+		prov := pstore.AddrProvenance{Source: pstore.AddrSource(entry.Source)}
+		if entry.LastConfirmed != 0 {
+			prov.LastConfirmed = time.Unix(entry.LastConfirmed, 0)
+		}
+		return prov, true
+	}
+	return pstore.AddrProvenance{}, false
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 	pstore "github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
 
 	logging "github.com/ipfs/go-log/v2"
 	ma "github.com/multiformats/go-multiaddr"
@@ -17,10 +19,17 @@ import (
 
 var log = logging.Logger("peerstore")
 
+const defaultGCInterval = time.Hour
+
 type expiringAddr struct {
 	Addr    ma.Multiaddr
 	TTL     time.Duration
 	Expires time.Time
+
+	Source        pstore.AddrSource
+	LastConfirmed time.Time
+	// Added is the last time the address was added from its Source.
+	Added time.Time
 }
 
 func (e *expiringAddr) ExpiredBy(t time.Time) bool {
@@ -67,19 +76,41 @@ type memoryAddrBook struct {
 	segments addrSegments
 
 	refCount sync.WaitGroup
+	ctx      context.Context
 	cancel   func()
 
 	subManager *AddrSubManager
 	clock      clock
+
+	// maxAddrsPerPeer is the maximum number of addresses stored per peer, see
+	// WithMaxAddrsPerPeer. Zero means unlimited.
+	maxAddrsPerPeer int
+	// sourceTTLs are the maximum TTLs of unconfirmed addresses per source, see
+	// WithSourceAddrTTL.
+	sourceTTLs map[pstore.AddrSource]time.Duration
+
+	gcInterval    time.Duration
+	metricsTracer peerstore.GCMetricsTracer
+
+	// events is set once the address book emits events, see EmitEvents.
+	events atomic.Pointer[addrEvents]
 }
 
 var _ pstore.AddrBook = (*memoryAddrBook)(nil)
 var _ pstore.CertifiedAddrBook = (*memoryAddrBook)(nil)
+var _ pstore.ProvenanceAddrBook = (*memoryAddrBook)(nil)
 
 func NewAddrBook() *memoryAddrBook {
+	ab := newAddrBook()
+	ab.start()
+	return ab
+}
+
+// newAddrBook creates an address book, that doesn't garbage collect until started.
+func newAddrBook() *memoryAddrBook {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	ab := &memoryAddrBook{
+	return &memoryAddrBook{
 		segments: func() (ret addrSegments) {
 			for i := range ret {
 				ret[i] = &addrSegment{
@@ -89,12 +120,19 @@ func NewAddrBook() *memoryAddrBook {
 			return ret
 		}(),
 		subManager: NewAddrSubManager(),
+		ctx:        ctx,
 		cancel:     cancel,
 		clock:      realclock{},
+		gcInterval: defaultGCInterval,
 	}
-	ab.refCount.Add(1)
-	go ab.background(ctx)
-	return ab
+}
+
+func (mab *memoryAddrBook) start() {
+	if mab.gcInterval <= 0 {
+		return
+	}
+	mab.refCount.Add(1)
+	go mab.background()
 }
 
 type AddrBookOption func(book *memoryAddrBook) error
@@ -106,17 +144,37 @@ func WithClock(clock clock) AddrBookOption {
 	}
 }
 
+// WithGCInterval sets the interval at which expired addresses are purged. Zero
+// disables periodic purges, GC can then only be triggered manually, see GC.
+func WithGCInterval(interval time.Duration) AddrBookOption {
+	return func(book *memoryAddrBook) error {
+		if interval < 0 {
+			return fmt.Errorf("negative GC interval: %s", interval)
+		}
+		book.gcInterval = interval
+		return nil
+	}
+}
+
+// WithGCMetricsTracer configures the address book to report garbage collection metrics.
+func WithGCMetricsTracer(mt peerstore.GCMetricsTracer) AddrBookOption {
+	return func(book *memoryAddrBook) error {
+		book.metricsTracer = mt
+		return nil
+	}
+}
+
 // background periodically schedules a gc
-func (mab *memoryAddrBook) background(ctx context.Context) {
+func (mab *memoryAddrBook) background() {
 	defer mab.refCount.Done()
-	ticker := time.NewTicker(1 * time.Hour)
+	ticker := time.NewTicker(mab.gcInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			mab.gc()
-		case <-ctx.Done():
+		case <-mab.ctx.Done():
 			return
 		}
 	}
@@ -125,27 +183,50 @@ func (mab *memoryAddrBook) background(ctx context.Context) {
 func (mab *memoryAddrBook) Close() error {
 	mab.cancel()
 	mab.refCount.Wait()
+	if ev := mab.events.Load(); ev != nil {
+		ev.close()
+	}
+	return nil
+}
+
+// GC purges the expired addresses, and the peers left without addresses.
+func (mab *memoryAddrBook) GC(_ context.Context) error {
+	mab.gc()
 	return nil
 }
 
 // gc garbage collects the in-memory address book.
 func (mab *memoryAddrBook) gc() {
+	start := time.Now()
 	now := mab.clock.Now()
+	var purgedAddrs, purgedPeers int
+	var changes []*addrChange
 	for _, s := range mab.segments {
 		s.Lock()
 		for p, amap := range s.addrs {
+			c := mab.newAddrChange(s, p)
 			for k, addr := range amap {
-				if addr.ExpiredBy(now) {
+				if addr.ExpiredBy(now) || mab.sourceExpired(addr, now) {
+					c.remove(addr.Addr)
 					delete(amap, k)
+					purgedAddrs++
 				}
 			}
 			if len(amap) == 0 {
 				delete(s.addrs, p)
 				delete(s.signedPeerRecords, p)
+				purgedPeers++
+			}
+			if c != nil && len(c.removed) > 0 {
+				changes = append(changes, c)
 			}
 		}
 		s.Unlock()
 	}
+	mab.emit(changes...)
+	if mab.metricsTracer != nil {
+		mab.metricsTracer.GCFinished(purgedAddrs, purgedPeers, time.Since(start))
+	}
 }
 
 func (mab *memoryAddrBook) PeersWithAddrs() peer.IDSlice {
@@ -181,7 +262,12 @@ func (mab *memoryAddrBook) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Du
 	// if peerRec != nil {
 	// 	return
 	// }
-	mab.addAddrs(p, addrs, ttl)
+	mab.addAddrs(p, addrs, ttl, pstore.AddrSourceUnknown)
+}
+
+// AddAddrsWithSource adds addresses like AddAddrs, and records src as their source.
+func (mab *memoryAddrBook) AddAddrsWithSource(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, src pstore.AddrSource) {
+	mab.addAddrs(p, addrs, ttl, src)
 }
 
 // ConsumePeerRecord adds addresses from a signed peer.PeerRecord (contained in
@@ -203,28 +289,37 @@ func (mab *memoryAddrBook) ConsumePeerRecord(recordEnvelope *record.Envelope, tt
 	// ensure seq is greater than, or equal to, the last received
 	s := mab.segments.get(rec.PeerID)
 	s.Lock()
+	c := mab.newAddrChange(s, rec.PeerID)
+	defer mab.emit(c)
 	defer s.Unlock()
 	lastState, found := s.signedPeerRecords[rec.PeerID]
 	if found && lastState.Seq > rec.Seq {
 		return false, nil
 	}
+	if !found || lastState.Seq < rec.Seq {
+		c.setRecord(recordEnvelope)
+	}
 	s.signedPeerRecords[rec.PeerID] = &peerRecordState{
 		Envelope: recordEnvelope,
 		Seq:      rec.Seq,
 	}
-	mab.addAddrsUnlocked(s, rec.PeerID, rec.Addrs, ttl, true)
+	mab.addAddrsUnlocked(s, c, rec.PeerID, rec.Addrs, ttl, pstore.AddrSourceUnknown, true)
 	return true, nil
 }
 
-func (mab *memoryAddrBook) addAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+func (mab *memoryAddrBook) addAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, src pstore.AddrSource) {
 	s := mab.segments.get(p)
 	s.Lock()
+	c := mab.newAddrChange(s, p)
+	defer mab.emit(c)
 	defer s.Unlock()
 
-	mab.addAddrsUnlocked(s, p, addrs, ttl, false)
+	mab.addAddrsUnlocked(s, c, p, addrs, ttl, src, false)
 }
 
-func (mab *memoryAddrBook) addAddrsUnlocked(s *addrSegment, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, signed bool) {
+// addAddrsUnlocked adds addrs to the addresses of p, recording the changes in c. The
+// lock of s must be held.
+func (mab *memoryAddrBook) addAddrsUnlocked(s *addrSegment, c *addrChange, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, src pstore.AddrSource, signed bool) {
 	// if ttl is zero, exit. nothing to do.
 	if ttl <= 0 {
 		return
@@ -236,7 +331,7 @@ func (mab *memoryAddrBook) addAddrsUnlocked(s *addrSegment, p peer.ID, addrs []m
 		s.addrs[p] = amap
 	}
 
-	exp := mab.clock.Now().Add(ttl)
+	now := mab.clock.Now()
 	for _, addr := range addrs {
 		// Remove suffix of /p2p/peer-id from address
 		addr, addrPid := peer.SplitAddr(addr)
@@ -253,10 +348,20 @@ func (mab *memoryAddrBook) addAddrsUnlocked(s *addrSegment, p peer.ID, addrs []m
 		a, found := amap[string(addr.Bytes())] // won't allocate.
 		if !found {
 			// not found, announce it.
-			entry := &expiringAddr{Addr: addr, Expires: exp, TTL: ttl}
+			ttl := mab.limitTTL(ttl, src, time.Time{})
+			entry := &expiringAddr{Addr: addr, Expires: now.Add(ttl), TTL: ttl, Source: src, Added: now}
 			amap[string(addr.Bytes())] = entry
+			c.add(addr)
 			mab.subManager.BroadcastAddr(p, addr)
 		} else {
+			if src.Replaces(a.Source) {
+				a.Source = src
+			}
+			if src == a.Source {
+				a.Added = now
+			}
+			ttl := mab.limitTTL(ttl, a.Source, a.LastConfirmed)
+			exp := now.Add(ttl)
 			// update ttl & exp to whichever is greater between new and existing entry
 			if ttl > a.TTL {
 				a.TTL = ttl
@@ -266,6 +371,7 @@ func (mab *memoryAddrBook) addAddrsUnlocked(s *addrSegment, p peer.ID, addrs []m
 			}
 		}
 	}
+	mab.trimAddrsUnlocked(amap, c)
 }
 
 // SetAddr calls mgr.SetAddrs(p, addr, ttl)
@@ -278,6 +384,8 @@ func (mab *memoryAddrBook) SetAddr(p peer.ID, addr ma.Multiaddr, ttl time.Durati
 func (mab *memoryAddrBook) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
 	s := mab.segments.get(p)
 	s.Lock()
+	c := mab.newAddrChange(s, p)
+	defer mab.emit(c)
 	defer s.Unlock()
 
 	amap, ok := s.addrs[p]
@@ -286,7 +394,8 @@ func (mab *memoryAddrBook) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Du
 		s.addrs[p] = amap
 	}
 
-	exp := mab.clock.Now().Add(ttl)
+	now := mab.clock.Now()
+	exp := now.Add(ttl)
 	for _, addr := range addrs {
 		addr, addrPid := peer.SplitAddr(addr)
 		if addr == nil {
@@ -302,12 +411,22 @@ func (mab *memoryAddrBook) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Du
 
 		// re-set all of them for new ttl.
 		if ttl > 0 {
-			amap[key] = &expiringAddr{Addr: addr, Expires: exp, TTL: ttl}
+			entry := &expiringAddr{Addr: addr, Expires: exp, TTL: ttl, Added: now}
+			if a, ok := amap[key]; ok {
+				entry.Source = a.Source
+				entry.LastConfirmed = a.LastConfirmed
+				entry.Added = a.Added
+			} else {
+				c.add(addr)
+			}
+			amap[key] = entry
 			mab.subManager.BroadcastAddr(p, addr)
-		} else {
+		} else if a, ok := amap[key]; ok {
+			c.remove(a.Addr)
 			delete(amap, key)
 		}
 	}
+	mab.trimAddrsUnlocked(amap, c)
 }
 
 // UpdateAddrs updates the addresses associated with the given peer that have
@@ -315,6 +434,8 @@ func (mab *memoryAddrBook) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Du
 func (mab *memoryAddrBook) UpdateAddrs(p peer.ID, oldTTL time.Duration, newTTL time.Duration) {
 	s := mab.segments.get(p)
 	s.Lock()
+	c := mab.newAddrChange(s, p)
+	defer mab.emit(c)
 	defer s.Unlock()
 	exp := mab.clock.Now().Add(newTTL)
 	amap, found := s.addrs[p]
@@ -325,6 +446,7 @@ func (mab *memoryAddrBook) UpdateAddrs(p peer.ID, oldTTL time.Duration, newTTL t
 	for k, a := range amap {
 		if oldTTL == a.TTL {
 			if newTTL == 0 {
+				c.remove(a.Addr)
 				delete(amap, k)
 			} else {
 				a.TTL = newTTL
@@ -344,6 +466,23 @@ func (mab *memoryAddrBook) Addrs(p peer.ID) []ma.Multiaddr {
 	return validAddrs(mab.clock.Now(), s.addrs[p])
 }
 
+// AddrsWithExpiry returns the addresses of p that haven't expired yet, along with
+// their TTLs and expiration times.
+func (mab *memoryAddrBook) AddrsWithExpiry(p peer.ID) []peerstore.ExpiringAddr {
+	s := mab.segments.get(p)
+	s.RLock()
+	defer s.RUnlock()
+
+	now := mab.clock.Now()
+	addrs := make([]peerstore.ExpiringAddr, 0, len(s.addrs[p]))
+	for _, a := range s.addrs[p] {
+		if !a.ExpiredBy(now) {
+			addrs = append(addrs, peerstore.ExpiringAddr{Addr: a.Addr, TTL: a.TTL, Expires: a.Expires})
+		}
+	}
+	return addrs
+}
+
 func validAddrs(now time.Time, amap map[string]*expiringAddr) []ma.Multiaddr {
 	good := make([]ma.Multiaddr, 0, len(amap))
 	if amap == nil {
@@ -384,8 +523,13 @@ func (mab *memoryAddrBook) GetPeerRecord(p peer.ID) *record.Envelope {
 func (mab *memoryAddrBook) ClearAddrs(p peer.ID) {
 	s := mab.segments.get(p)
 	s.Lock()
+	c := mab.newAddrChange(s, p)
+	defer mab.emit(c)
 	defer s.Unlock()
 
+	for _, a := range s.addrs[p] {
+		c.remove(a.Addr)
+	}
 	delete(s.addrs, p)
 	delete(s.signedPeerRecords, p)
 }
@@ -0,0 +1,139 @@
+package pstoremem
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var _ peerstore.BatchPeerstore = (*pstoremem)(nil)
+
+// AddAddrsBatch adds the addresses of all peers in batch, locking each segment of the
+// address book only once.
+func (mab *memoryAddrBook) AddAddrsBatch(batch []peerstore.PeerAddrs) {
+	bySegment := make(map[*addrSegment][]*peerstore.PeerAddrs)
+	for i := range batch {
+		s := mab.segments.get(batch[i].ID)
+		bySegment[s] = append(bySegment[s], &batch[i])
+	}
+	for s, entries := range bySegment {
+		changes := make([]*addrChange, 0, len(entries))
+		s.Lock()
+		for _, e := range entries {
+			c := mab.newAddrChange(s, e.ID)
+			mab.addAddrsUnlocked(s, c, e.ID, e.Addrs, e.TTL, pstore.AddrSourceUnknown, false)
+			changes = append(changes, c)
+		}
+		s.Unlock()
+		mab.emit(changes...)
+	}
+}
+
+// addrsBatch returns the addresses of peers, locking each segment of the address book
+// only once.
+func (mab *memoryAddrBook) addrsBatch(peers peer.IDSlice) [][]ma.Multiaddr {
+	bySegment := make(map[*addrSegment][]int)
+	for i, p := range peers {
+		s := mab.segments.get(p)
+		bySegment[s] = append(bySegment[s], i)
+	}
+	now := mab.clock.Now()
+	addrs := make([][]ma.Multiaddr, len(peers))
+	for s, idxs := range bySegment {
+		s.RLock()
+		for _, i := range idxs {
+			addrs[i] = validAddrs(now, s.addrs[peers[i]])
+		}
+		s.RUnlock()
+	}
+	return addrs
+}
+
+// addProtocolsBatch adds the protocols of all peers in batch, locking each segment of
+// the protocol book only once.
+func (pb *memoryProtoBook) addProtocolsBatch(batch []peerstore.PeerProtocols) error {
+	bySegment := make(map[*protoSegment][]*peerstore.PeerProtocols)
+	for i := range batch {
+		s := pb.segments.get(batch[i].ID)
+		bySegment[s] = append(bySegment[s], &batch[i])
+	}
+	var firstErr error
+	for s, entries := range bySegment {
+		s.Lock()
+		for _, e := range entries {
+			if err := pb.addProtocolsUnlocked(s, e.ID, e.Protocols); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		s.Unlock()
+	}
+	return firstErr
+}
+
+// PutBatch stores the metadata values in batch, taking the lock only once.
+func (ps *memoryPeerMetadata) PutBatch(batch []peerstore.PeerMetadataValue) error {
+	ps.dslock.Lock()
+	defer ps.dslock.Unlock()
+	for _, e := range batch {
+		m, ok := ps.ds[e.ID]
+		if !ok {
+			m = make(map[string]interface{})
+			ps.ds[e.ID] = m
+		}
+		m[e.Key] = e.Value
+	}
+	return nil
+}
+
+// GetBatch returns the metadata values stored under key for peers, taking the lock
+// only once.
+func (ps *memoryPeerMetadata) GetBatch(peers peer.IDSlice, key string) ([]interface{}, error) {
+	ps.dslock.RLock()
+	defer ps.dslock.RUnlock()
+	vals := make([]interface{}, len(peers))
+	for i, p := range peers {
+		vals[i] = ps.ds[p][key]
+	}
+	return vals, nil
+}
+
+func (ps *pstoremem) AddAddrsBatch(batch []peerstore.PeerAddrs) {
+	ps.memoryAddrBook.AddAddrsBatch(batch)
+	for _, e := range batch {
+		if e.TTL > 0 {
+			ps.touch(e.ID)
+		}
+	}
+}
+
+func (ps *pstoremem) AddProtocolsBatch(batch []peerstore.PeerProtocols) error {
+	err := ps.memoryProtoBook.addProtocolsBatch(batch)
+	for _, e := range batch {
+		ps.touch(e.ID)
+	}
+	return err
+}
+
+func (ps *pstoremem) PeerInfos(peers peer.IDSlice) []peer.AddrInfo {
+	for _, p := range peers {
+		ps.touchIfTracked(p)
+	}
+	addrs := ps.memoryAddrBook.addrsBatch(peers)
+	infos := make([]peer.AddrInfo, len(peers))
+	for i, p := range peers {
+		infos[i] = peer.AddrInfo{ID: p, Addrs: addrs[i]}
+	}
+	return infos
+}
+
+func (ps *pstoremem) PutBatch(batch []peerstore.PeerMetadataValue) error {
+	if err := ps.memoryPeerMetadata.PutBatch(batch); err != nil {
+		return err
+	}
+	for _, e := range batch {
+		ps.touch(e.ID)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package pstoremem
+
+import (
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// addrEvents holds the emitters used to report changes of the address book.
+type addrEvents struct {
+	peerAdded, peerRemoved, addrsUpdated, recordUpdated event.Emitter
+}
+
+func (ev *addrEvents) close() {
+	for _, em := range []event.Emitter{ev.peerAdded, ev.peerRemoved, ev.addrsUpdated, ev.recordUpdated} {
+		if em != nil {
+			em.Close()
+		}
+	}
+}
+
+// EmitEvents makes the address book emit an event.EvtPeerAdded, event.EvtPeerRemoved,
+// event.EvtPeerAddrsUpdated or event.EvtPeerRecordUpdated on bus whenever addresses
+// or signed peer records change. It can only be called once.
+func (mab *memoryAddrBook) EmitEvents(bus event.Bus) error {
+	ev := &addrEvents{}
+	for _, e := range []struct {
+		em  *event.Emitter
+		evt interface{}
+	}{
+		{&ev.peerAdded, new(event.EvtPeerAdded)},
+		{&ev.peerRemoved, new(event.EvtPeerRemoved)},
+		{&ev.addrsUpdated, new(event.EvtPeerAddrsUpdated)},
+		{&ev.recordUpdated, new(event.EvtPeerRecordUpdated)},
+	} {
+		em, err := bus.Emitter(e.evt)
+		if err != nil {
+			ev.close()
+			return err
+		}
+		*e.em = em
+	}
+	if !mab.events.CompareAndSwap(nil, ev) {
+		ev.close()
+		return errors.New("address book is already emitting events")
+	}
+	return nil
+}
+
+// addrChange collects the changes to the addresses of a peer made while holding the
+// lock of its segment, so that they can be reported once the lock is released. A nil
+// *addrChange collects nothing, which is used when no events are emitted.
+type addrChange struct {
+	peer peer.ID
+	// before is the number of addresses stored before the change
+	before         int
+	added, removed []ma.Multiaddr
+	record         *record.Envelope
+}
+
+// newAddrChange starts collecting the changes to the addresses of p. The lock of s
+// must be held.
+func (mab *memoryAddrBook) newAddrChange(s *addrSegment, p peer.ID) *addrChange {
+	if mab.events.Load() == nil {
+		return nil
+	}
+	return &addrChange{peer: p, before: len(s.addrs[p])}
+}
+
+func (c *addrChange) add(a ma.Multiaddr) {
+	if c != nil {
+		c.added = append(c.added, a)
+	}
+}
+
+func (c *addrChange) remove(a ma.Multiaddr) {
+	if c == nil {
+		return
+	}
+	// an address that was just added and is removed again didn't change anything
+	for i, added := range c.added {
+		if added.Equal(a) {
+			c.added = append(c.added[:i], c.added[i+1:]...)
+			return
+		}
+	}
+	c.removed = append(c.removed, a)
+}
+
+func (c *addrChange) setRecord(env *record.Envelope) {
+	if c != nil {
+		c.record = env
+	}
+}
+
+// emit reports the collected changes. It must be called without holding any
+// segment lock, as subscribers may access the address book.
+func (mab *memoryAddrBook) emit(changes ...*addrChange) {
+	ev := mab.events.Load()
+	if ev == nil {
+		return
+	}
+	for _, c := range changes {
+		if c == nil {
+			continue
+		}
+		after := c.before + len(c.added) - len(c.removed)
+		if c.before == 0 && after > 0 {
+			ev.peerAdded.Emit(event.EvtPeerAdded{Peer: c.peer})
+		}
+		if len(c.added) > 0 || len(c.removed) > 0 {
+			ev.addrsUpdated.Emit(event.EvtPeerAddrsUpdated{Peer: c.peer, Added: c.added, Removed: c.removed})
+		}
+		if c.record != nil {
+			ev.recordUpdated.Emit(event.EvtPeerRecordUpdated{Peer: c.peer, SignedPeerRecord: c.record})
+		}
+		if c.before > 0 && after == 0 {
+			ev.peerRemoved.Emit(event.EvtPeerRemoved{Peer: c.peer})
+		}
+	}
+}
@@ -1,12 +1,21 @@
 package pstoremem
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/peer"
 	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
 	pt "github.com/libp2p/go-libp2p/p2p/host/peerstore/test"
 
 	mockClock "github.com/benbjohnson/clock"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 )
@@ -42,6 +51,226 @@ func TestPeerstoreProtoStoreLimits(t *testing.T) {
 	pt.TestPeerstoreProtoStoreLimits(t, ps, limit)
 }
 
+func TestMaxPeers(t *testing.T) {
+	ps, err := NewPeerstore(WithMaxPeers(3))
+	require.NoError(t, err)
+	defer ps.Close()
+
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	var peers []peer.ID
+	for i := 0; i < 5; i++ {
+		peers = append(peers, test.RandPeerIDFatal(t))
+	}
+	ps.Pin(peers[0])
+	for _, p := range peers[:4] {
+		ps.AddAddr(p, addr, time.Hour)
+	}
+	require.NoError(t, ps.Put(peers[1], "foo", "bar"))
+	// peers[2] is the least recently used peer
+	ps.AddAddr(peers[4], addr, time.Hour)
+
+	require.ElementsMatch(t, []peer.ID{peers[0], peers[1], peers[3], peers[4]}, ps.Peers())
+	require.Empty(t, ps.Addrs(peers[2]))
+
+	// peers with connected addresses aren't evicted
+	ps.AddAddr(peers[1], addr, pstore.ConnectedAddrTTL)
+	ps.Unpin(peers[0])
+	require.False(t, ps.IsPinned(peers[0]))
+	require.ElementsMatch(t, []peer.ID{peers[0], peers[1], peers[4]}, ps.Peers())
+	v, err := ps.Get(peers[1], "foo")
+	require.NoError(t, err)
+	require.Equal(t, "bar", v)
+}
+
+func TestMaxPeersPinsSelf(t *testing.T) {
+	ps, err := NewPeerstore(WithMaxPeers(1))
+	require.NoError(t, err)
+	defer ps.Close()
+
+	priv, pub, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	self, err := peer.IDFromPublicKey(pub)
+	require.NoError(t, err)
+	require.NoError(t, ps.AddPrivKey(self, priv))
+	require.NoError(t, ps.AddPubKey(self, pub))
+	require.True(t, ps.IsPinned(self))
+
+	for i := 0; i < 3; i++ {
+		ps.AddAddr(test.RandPeerIDFatal(t), ma.StringCast("/ip4/1.2.3.4/tcp/1"), time.Hour)
+	}
+	require.Len(t, ps.Peers(), 2)
+	require.NotNil(t, ps.PrivKey(self))
+}
+
+func TestMaxAddrsPerPeer(t *testing.T) {
+	ps, err := NewPeerstore(WithMaxAddrsPerPeer(2))
+	require.NoError(t, err)
+	defer ps.Close()
+
+	p := test.RandPeerIDFatal(t)
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1"),
+		ma.StringCast("/ip4/1.2.3.4/tcp/2"),
+		ma.StringCast("/ip4/1.2.3.4/tcp/3"),
+	}
+	ps.AddAddr(p, addrs[0], pstore.ConnectedAddrTTL)
+	ps.AddAddr(p, addrs[1], time.Minute)
+	ps.AddAddr(p, addrs[2], time.Hour)
+	require.ElementsMatch(t, []ma.Multiaddr{addrs[0], addrs[2]}, ps.Addrs(p))
+}
+
+func TestAddrProvenance(t *testing.T) {
+	clk := mockClock.NewMock()
+	ps, err := NewPeerstore(WithClock(clk), WithUnconfirmedThirdPartyAddrTTL(time.Minute))
+	require.NoError(t, err)
+	defer ps.Close()
+
+	p := test.RandPeerIDFatal(t)
+	dht := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	identify := ma.StringCast("/ip4/1.2.3.4/tcp/2")
+	confirmed := ma.StringCast("/ip4/1.2.3.4/tcp/3")
+
+	ps.AddAddrsWithSource(p, []ma.Multiaddr{dht, identify}, time.Hour, pstore.AddrSourceDHT)
+	ps.AddAddrsWithSource(p, []ma.Multiaddr{identify}, time.Hour, pstore.AddrSourceIdentify)
+	// an unknown source doesn't replace a known one
+	ps.AddAddrs(p, []ma.Multiaddr{identify}, time.Hour)
+	ps.AddAddr(p, confirmed, time.Hour)
+	ps.ConfirmAddr(p, confirmed)
+
+	prov, ok := ps.AddrProvenance(p, dht)
+	require.True(t, ok)
+	require.Equal(t, pstore.AddrSourceDHT, prov.Source)
+	require.True(t, prov.LastConfirmed.IsZero())
+	prov, ok = ps.AddrProvenance(p, identify)
+	require.True(t, ok)
+	require.Equal(t, pstore.AddrSourceIdentify, prov.Source)
+	prov, ok = ps.AddrProvenance(p, confirmed)
+	require.True(t, ok)
+	require.Equal(t, pstore.AddrSourceUnknown, prov.Source)
+	require.Equal(t, clk.Now(), prov.LastConfirmed)
+	_, ok = ps.AddrProvenance(p, ma.StringCast("/ip4/1.2.3.4/tcp/4"))
+	require.False(t, ok)
+
+	// the unconfirmed third party address expires early
+	clk.Add(2 * time.Minute)
+	require.ElementsMatch(t, []ma.Multiaddr{identify, confirmed}, ps.Addrs(p))
+	_, ok = ps.AddrProvenance(p, dht)
+	require.False(t, ok)
+
+	// GC purges unconfirmed third party addresses once their limit elapsed, even if
+	// their TTL was raised in the meantime
+	ps.AddAddrsWithSource(p, []ma.Multiaddr{dht}, time.Hour, pstore.AddrSourceDHT)
+	ps.SetAddr(p, dht, time.Hour)
+	clk.Add(2 * time.Minute)
+	require.Contains(t, ps.Addrs(p), dht)
+	require.NoError(t, ps.GC(context.Background()))
+	require.ElementsMatch(t, []ma.Multiaddr{identify, confirmed}, ps.Addrs(p))
+}
+
+type mockGCMetricsTracer struct {
+	runs, addrs, peers int
+}
+
+func (mt *mockGCMetricsTracer) GCFinished(addrs, peers int, _ time.Duration) {
+	mt.runs++
+	mt.addrs += addrs
+	mt.peers += peers
+}
+
+func TestManualGC(t *testing.T) {
+	clk := mockClock.NewMock()
+	mt := &mockGCMetricsTracer{}
+	ps, err := NewPeerstore(
+		WithClock(clk),
+		WithGCInterval(0),
+		WithGCMetricsTracer(mt),
+		WithSourceAddrTTL(pstore.AddrSourceObserved, time.Minute),
+	)
+	require.NoError(t, err)
+	defer ps.Close()
+
+	p1 := test.RandPeerIDFatal(t)
+	p2 := test.RandPeerIDFatal(t)
+	addr1 := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	addr2 := ma.StringCast("/ip4/1.2.3.4/tcp/2")
+	addr3 := ma.StringCast("/ip4/1.2.3.4/tcp/3")
+	ps.AddAddrsWithSource(p1, []ma.Multiaddr{addr1, addr2}, time.Hour, pstore.AddrSourceObserved)
+	ps.AddAddrsWithSource(p2, []ma.Multiaddr{addr2}, time.Hour, pstore.AddrSourceObserved)
+	ps.AddAddr(p2, addr3, time.Hour)
+
+	clk.Add(2 * time.Minute)
+	require.NoError(t, ps.GC(context.Background()))
+	require.Equal(t, 1, mt.runs)
+	require.Equal(t, 3, mt.addrs)
+	require.Equal(t, 1, mt.peers)
+	require.Equal(t, peer.IDSlice{p2}, ps.PeersWithAddrs())
+	require.Equal(t, []ma.Multiaddr{addr3}, ps.Addrs(p2))
+
+	_, err = NewPeerstore(WithGCInterval(-time.Second))
+	require.Error(t, err)
+}
+
+func TestEvents(t *testing.T) {
+	ps, err := NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	bus := eventbus.NewBus()
+	sub, err := bus.Subscribe([]interface{}{
+		new(event.EvtPeerAdded),
+		new(event.EvtPeerRemoved),
+		new(event.EvtPeerAddrsUpdated),
+		new(event.EvtPeerRecordUpdated),
+	}, eventbus.BufSize(16))
+	require.NoError(t, err)
+	defer sub.Close()
+	require.NoError(t, ps.EmitEvents(bus))
+	require.Error(t, ps.EmitEvents(bus))
+
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	addr1 := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	addr2 := ma.StringCast("/ip4/1.2.3.4/tcp/2")
+	addr3 := ma.StringCast("/ip4/1.2.3.4/tcp/3")
+
+	ps.AddAddrs(p, []ma.Multiaddr{addr1, addr2}, time.Hour)
+	// extending the TTL isn't reported
+	ps.AddAddr(p, addr1, 2*time.Hour)
+	ps.SetAddr(p, addr1, 0)
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: p, Addrs: []ma.Multiaddr{addr3}}), priv)
+	require.NoError(t, err)
+	_, err = ps.ConsumePeerRecord(env, time.Hour)
+	require.NoError(t, err)
+	ps.ClearAddrs(p)
+
+	next := func() interface{} {
+		select {
+		case e := <-sub.Out():
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("expected an event")
+			return nil
+		}
+	}
+	require.Equal(t, event.EvtPeerAdded{Peer: p}, next())
+	e := next().(event.EvtPeerAddrsUpdated)
+	require.ElementsMatch(t, []ma.Multiaddr{addr1, addr2}, e.Added)
+	require.Empty(t, e.Removed)
+	require.Equal(t, event.EvtPeerAddrsUpdated{Peer: p, Removed: []ma.Multiaddr{addr1}}, next())
+	require.Equal(t, event.EvtPeerAddrsUpdated{Peer: p, Added: []ma.Multiaddr{addr3}}, next())
+	require.Equal(t, event.EvtPeerRecordUpdated{Peer: p, SignedPeerRecord: env}, next())
+	e = next().(event.EvtPeerAddrsUpdated)
+	require.ElementsMatch(t, []ma.Multiaddr{addr2, addr3}, e.Removed)
+	require.Empty(t, e.Added)
+	require.Equal(t, event.EvtPeerRemoved{Peer: p}, next())
+	select {
+	case e := <-sub.Out():
+		t.Fatalf("unexpected event: %v", e)
+	default:
+	}
+}
+
 func TestInMemoryAddrBook(t *testing.T) {
 	clk := mockClock.NewMock()
 	pt.TestAddrBook(t, func() (pstore.AddrBook, func()) {
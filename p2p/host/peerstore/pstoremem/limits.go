@@ -0,0 +1,275 @@
+package pstoremem
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/record"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PeerstoreOption configures the in-memory peerstore.
+type PeerstoreOption func(ps *pstoremem) error
+
+// WithMaxPeers limits the number of peers the peerstore holds information about.
+// Once the limit is exceeded, the least recently used peer is evicted, i.e. all
+// information about it is removed. A peer is used when information about it is
+// added, or when its addresses are looked up.
+//
+// Pinned peers don't count towards the limit and are never evicted, see Pin. Neither
+// are peers with permanent addresses, which includes the peers we're connected to.
+// Peers we hold the private key of are pinned automatically.
+func WithMaxPeers(num int) PeerstoreOption {
+	return func(ps *pstoremem) error {
+		ps.lru.max = num
+		return nil
+	}
+}
+
+// WithMaxAddrsPerPeer limits the number of addresses stored per peer. Once the limit
+// is exceeded, the addresses expiring first are removed.
+func WithMaxAddrsPerPeer(num int) AddrBookOption {
+	return func(mab *memoryAddrBook) error {
+		mab.maxAddrsPerPeer = num
+		return nil
+	}
+}
+
+// trimAddrsUnlocked removes the addresses expiring first from amap until the number
+// of addresses doesn't exceed the limit anymore, recording the changes in c.
+func (mab *memoryAddrBook) trimAddrsUnlocked(amap map[string]*expiringAddr, c *addrChange) {
+	if mab.maxAddrsPerPeer <= 0 || len(amap) <= mab.maxAddrsPerPeer {
+		return
+	}
+	keys := make([]string, 0, len(amap))
+	for k := range amap {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return amap[keys[i]].Expires.Before(amap[keys[j]].Expires) })
+	for _, k := range keys[:len(keys)-mab.maxAddrsPerPeer] {
+		c.remove(amap[k].Addr)
+		delete(amap, k)
+	}
+}
+
+// hasPermanentAddrs returns true if p has a permanent address, or an address of a
+// connection.
+func (mab *memoryAddrBook) hasPermanentAddrs(p peer.ID) bool {
+	s := mab.segments.get(p)
+	s.RLock()
+	defer s.RUnlock()
+	for _, a := range s.addrs[p] {
+		if a.TTL >= pstore.ConnectedAddrTTL {
+			return true
+		}
+	}
+	return false
+}
+
+// peerLRU tracks the order in which peers were used, and the pinned peers.
+type peerLRU struct {
+	mx sync.Mutex
+	// max is the maximum number of unpinned peers. Zero means unlimited, in which
+	// case the order isn't tracked.
+	max int
+	// order holds the unpinned peers, most recently used first
+	order  *list.List
+	peers  map[peer.ID]*list.Element
+	pinned map[peer.ID]struct{}
+}
+
+func newPeerLRU() *peerLRU {
+	return &peerLRU{
+		order:  list.New(),
+		peers:  make(map[peer.ID]*list.Element),
+		pinned: make(map[peer.ID]struct{}),
+	}
+}
+
+// touch marks p as most recently used and evicts the least recently used peers if
+// the limit is exceeded.
+func (ps *pstoremem) touch(p peer.ID) {
+	l := ps.lru
+	if l.max <= 0 {
+		return
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if _, ok := l.pinned[p]; ok {
+		return
+	}
+	if e, ok := l.peers[p]; ok {
+		l.order.MoveToFront(e)
+		return
+	}
+	l.peers[p] = l.order.PushFront(p)
+
+	for e := l.order.Back(); e != nil && len(l.peers) > l.max; {
+		prev := e.Prev()
+		if id := e.Value.(peer.ID); id != p && !ps.memoryAddrBook.hasPermanentAddrs(id) {
+			l.order.Remove(e)
+			delete(l.peers, id)
+			ps.evict(id)
+		}
+		e = prev
+	}
+}
+
+// touchIfTracked marks p as most recently used if the peerstore holds information
+// about it.
+func (ps *pstoremem) touchIfTracked(p peer.ID) {
+	l := ps.lru
+	if l.max <= 0 {
+		return
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if e, ok := l.peers[p]; ok {
+		l.order.MoveToFront(e)
+	}
+}
+
+func (ps *pstoremem) forget(p peer.ID) {
+	l := ps.lru
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if e, ok := l.peers[p]; ok {
+		l.order.Remove(e)
+		delete(l.peers, p)
+	}
+}
+
+// evict removes all information about p.
+func (ps *pstoremem) evict(p peer.ID) {
+	log.Debugw("evicting peer from peerstore", "peer", p)
+	ps.memoryKeyBook.RemovePeer(p)
+	ps.memoryProtoBook.RemovePeer(p)
+	ps.memoryPeerMetadata.RemovePeer(p)
+	ps.memoryAddrBook.ClearAddrs(p)
+	ps.Metrics.RemovePeer(p)
+}
+
+// Pin exempts p from eviction, see WithMaxPeers.
+func (ps *pstoremem) Pin(p peer.ID) {
+	l := ps.lru
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.pinned[p] = struct{}{}
+	if e, ok := l.peers[p]; ok {
+		l.order.Remove(e)
+		delete(l.peers, p)
+	}
+}
+
+// Unpin makes p subject to eviction again. It counts as a use of p.
+func (ps *pstoremem) Unpin(p peer.ID) {
+	l := ps.lru
+	l.mx.Lock()
+	_, ok := l.pinned[p]
+	delete(l.pinned, p)
+	l.mx.Unlock()
+	if ok {
+		ps.touch(p)
+	}
+}
+
+// IsPinned returns true if p is pinned.
+func (ps *pstoremem) IsPinned(p peer.ID) bool {
+	l := ps.lru
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	_, ok := l.pinned[p]
+	return ok
+}
+
+func (ps *pstoremem) AddAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	ps.AddAddrs(p, []ma.Multiaddr{addr}, ttl)
+}
+
+func (ps *pstoremem) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	ps.memoryAddrBook.AddAddrs(p, addrs, ttl)
+	if ttl > 0 {
+		ps.touch(p)
+	}
+}
+
+func (ps *pstoremem) AddAddrsWithSource(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, src pstore.AddrSource) {
+	ps.memoryAddrBook.AddAddrsWithSource(p, addrs, ttl, src)
+	if ttl > 0 {
+		ps.touch(p)
+	}
+}
+
+func (ps *pstoremem) SetAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	ps.SetAddrs(p, []ma.Multiaddr{addr}, ttl)
+}
+
+func (ps *pstoremem) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	ps.memoryAddrBook.SetAddrs(p, addrs, ttl)
+	if ttl > 0 {
+		ps.touch(p)
+	}
+}
+
+func (ps *pstoremem) ConsumePeerRecord(recordEnvelope *record.Envelope, ttl time.Duration) (bool, error) {
+	accepted, err := ps.memoryAddrBook.ConsumePeerRecord(recordEnvelope, ttl)
+	if accepted && ttl > 0 {
+		if p, err := peer.IDFromPublicKey(recordEnvelope.PublicKey); err == nil {
+			ps.touch(p)
+		}
+	}
+	return accepted, err
+}
+
+func (ps *pstoremem) Addrs(p peer.ID) []ma.Multiaddr {
+	ps.touchIfTracked(p)
+	return ps.memoryAddrBook.Addrs(p)
+}
+
+func (ps *pstoremem) AddPubKey(p peer.ID, pk ic.PubKey) error {
+	if err := ps.memoryKeyBook.AddPubKey(p, pk); err != nil {
+		return err
+	}
+	ps.touch(p)
+	return nil
+}
+
+func (ps *pstoremem) AddPrivKey(p peer.ID, sk ic.PrivKey) error {
+	if err := ps.memoryKeyBook.AddPrivKey(p, sk); err != nil {
+		return err
+	}
+	ps.Pin(p)
+	return nil
+}
+
+func (ps *pstoremem) SetProtocols(p peer.ID, protos ...protocol.ID) error {
+	if err := ps.memoryProtoBook.SetProtocols(p, protos...); err != nil {
+		return err
+	}
+	ps.touch(p)
+	return nil
+}
+
+func (ps *pstoremem) AddProtocols(p peer.ID, protos ...protocol.ID) error {
+	if err := ps.memoryProtoBook.AddProtocols(p, protos...); err != nil {
+		return err
+	}
+	ps.touch(p)
+	return nil
+}
+
+func (ps *pstoremem) Put(p peer.ID, key string, val interface{}) error {
+	if err := ps.memoryPeerMetadata.Put(p, key, val); err != nil {
+		return err
+	}
+	ps.touch(p)
+	return nil
+}
@@ -47,6 +47,17 @@ func (ps *memoryPeerMetadata) Get(p peer.ID, key string) (interface{}, error) {
 	return val, nil
 }
 
+// MetadataKeys returns the keys of the metadata stored for p.
+func (ps *memoryPeerMetadata) MetadataKeys(p peer.ID) []string {
+	ps.dslock.RLock()
+	defer ps.dslock.RUnlock()
+	keys := make([]string, 0, len(ps.ds[p]))
+	for k := range ps.ds[p] {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 func (ps *memoryPeerMetadata) RemovePeer(p peer.ID) {
 	ps.dslock.Lock()
 	delete(ps.ds, p)
@@ -11,22 +11,29 @@ import (
 
 type pstoremem struct {
 	peerstore.Metrics
+	pstore.DialMetrics
 
 	*memoryKeyBook
 	*memoryAddrBook
 	*memoryProtoBook
 	*memoryPeerMetadata
+
+	lru *peerLRU
 }
 
 var _ peerstore.Peerstore = &pstoremem{}
+var _ pstore.GCPeerstore = &pstoremem{}
+var _ pstore.DialMetrics = &pstoremem{}
+var _ pstore.EventEmittingPeerstore = &pstoremem{}
 
 type Option interface{}
 
 // NewPeerstore creates an in-memory threadsafe collection of peers.
 // It's the caller's responsibility to call RemovePeer to ensure
-// that memory consumption of the peerstore doesn't grow unboundedly.
+// that memory consumption of the peerstore doesn't grow unboundedly,
+// unless the number of peers is limited using WithMaxPeers.
 func NewPeerstore(opts ...Option) (ps *pstoremem, err error) {
-	ab := NewAddrBook()
+	ab := newAddrBook()
 	defer func() {
 		if err != nil {
 			ab.Close()
@@ -34,12 +41,17 @@ func NewPeerstore(opts ...Option) (ps *pstoremem, err error) {
 	}()
 
 	var protoBookOpts []ProtoBookOption
+	var psOpts []PeerstoreOption
 	for _, opt := range opts {
 		switch o := opt.(type) {
 		case ProtoBookOption:
 			protoBookOpts = append(protoBookOpts, o)
 		case AddrBookOption:
-			o(ab)
+			if err := o(ab); err != nil {
+				return nil, err
+			}
+		case PeerstoreOption:
+			psOpts = append(psOpts, o)
 		default:
 			return nil, fmt.Errorf("unexpected peer store option: %v", o)
 		}
@@ -48,13 +60,23 @@ func NewPeerstore(opts ...Option) (ps *pstoremem, err error) {
 	if err != nil {
 		return nil, err
 	}
-	return &pstoremem{
-		Metrics:            pstore.NewMetrics(),
+	ab.start()
+	m := pstore.NewMetrics()
+	ps = &pstoremem{
+		Metrics:            m,
+		DialMetrics:        m,
 		memoryKeyBook:      NewKeyBook(),
 		memoryAddrBook:     ab,
 		memoryProtoBook:    pb,
 		memoryPeerMetadata: NewPeerMetadata(),
-	}, nil
+		lru:                newPeerLRU(),
+	}
+	for _, o := range psOpts {
+		if err := o(ps); err != nil {
+			return nil, err
+		}
+	}
+	return ps, nil
 }
 
 func (ps *pstoremem) Close() (err error) {
@@ -96,7 +118,7 @@ func (ps *pstoremem) Peers() peer.IDSlice {
 func (ps *pstoremem) PeerInfo(p peer.ID) peer.AddrInfo {
 	return peer.AddrInfo{
 		ID:    p,
-		Addrs: ps.memoryAddrBook.Addrs(p),
+		Addrs: ps.Addrs(p),
 	}
 }
 
@@ -111,4 +133,7 @@ func (ps *pstoremem) RemovePeer(p peer.ID) {
 	ps.memoryProtoBook.RemovePeer(p)
 	ps.memoryPeerMetadata.RemovePeer(p)
 	ps.Metrics.RemovePeer(p)
+	if len(ps.memoryAddrBook.Addrs(p)) == 0 {
+		ps.forget(p)
+	}
 }
@@ -111,6 +111,10 @@ func (pb *memoryProtoBook) AddProtocols(p peer.ID, protos ...protocol.ID) error
 	s.Lock()
 	defer s.Unlock()
 
+	return pb.addProtocolsUnlocked(s, p, protos)
+}
+
+func (pb *memoryProtoBook) addProtocolsUnlocked(s *protoSegment, p peer.ID, protos []protocol.ID) error {
 	protomap, ok := s.protocols[p]
 	if !ok {
 		protomap = make(map[protocol.ID]struct{})
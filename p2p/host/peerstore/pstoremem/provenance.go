@@ -0,0 +1,88 @@
+package pstoremem
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// WithUnconfirmedThirdPartyAddrTTL limits the TTL of addresses learned from third
+// parties, e.g. the DHT, to ttl until we successfully connect to the peer using them.
+// This prevents stale or bogus addresses provided by other peers from lingering in
+// the address book.
+func WithUnconfirmedThirdPartyAddrTTL(ttl time.Duration) AddrBookOption {
+	return func(mab *memoryAddrBook) error {
+		for _, src := range []pstore.AddrSource{pstore.AddrSourceRelay, pstore.AddrSourceDHT} {
+			if err := WithSourceAddrTTL(src, ttl)(mab); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithSourceAddrTTL limits the TTL of addresses learned from src to ttl until we
+// successfully connect to the peer using them. Zero removes the limit.
+func WithSourceAddrTTL(src pstore.AddrSource, ttl time.Duration) AddrBookOption {
+	return func(mab *memoryAddrBook) error {
+		if ttl < 0 {
+			return fmt.Errorf("negative TTL for addresses from %s: %s", src, ttl)
+		}
+		if mab.sourceTTLs == nil {
+			mab.sourceTTLs = make(map[pstore.AddrSource]time.Duration)
+		}
+		mab.sourceTTLs[src] = ttl
+		return nil
+	}
+}
+
+// limitTTL returns the TTL an address from src, last confirmed at confirmed, is
+// added with.
+func (mab *memoryAddrBook) limitTTL(ttl time.Duration, src pstore.AddrSource, confirmed time.Time) time.Duration {
+	if maxTTL := mab.sourceTTLs[src]; maxTTL > 0 && ttl > maxTTL && confirmed.IsZero() {
+		return maxTTL
+	}
+	return ttl
+}
+
+// sourceExpired returns true if a is an unconfirmed address from a source with a
+// TTL limit, that wasn't added from its source again since the limit elapsed. This
+// catches addresses whose TTL was raised past the limit, e.g. using SetAddrs.
+func (mab *memoryAddrBook) sourceExpired(a *expiringAddr, now time.Time) bool {
+	maxTTL := mab.sourceTTLs[a.Source]
+	return maxTTL > 0 && a.LastConfirmed.IsZero() && !now.Before(a.Added.Add(maxTTL))
+}
+
+// ConfirmAddr records that we just successfully connected to p using addr.
+func (mab *memoryAddrBook) ConfirmAddr(p peer.ID, addr ma.Multiaddr) {
+	addr, _ = peer.SplitAddr(addr)
+	if addr == nil {
+		return
+	}
+	s := mab.segments.get(p)
+	s.Lock()
+	defer s.Unlock()
+	if a, ok := s.addrs[p][string(addr.Bytes())]; ok {
+		a.LastConfirmed = mab.clock.Now()
+	}
+}
+
+// AddrProvenance returns the provenance of the address addr of p.
+func (mab *memoryAddrBook) AddrProvenance(p peer.ID, addr ma.Multiaddr) (pstore.AddrProvenance, bool) {
+	addr, _ = peer.SplitAddr(addr)
+	if addr == nil {
+		return pstore.AddrProvenance{}, false
+	}
+	s := mab.segments.get(p)
+	s.RLock()
+	defer s.RUnlock()
+	a, ok := s.addrs[p][string(addr.Bytes())]
+	if !ok || a.ExpiredBy(mab.clock.Now()) {
+		return pstore.AddrProvenance{}, false
+	}
+	return pstore.AddrProvenance{Source: a.Source, LastConfirmed: a.LastConfirmed}, true
+}
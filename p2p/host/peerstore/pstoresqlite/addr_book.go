@@ -0,0 +1,299 @@
+package pstoresqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	pstore "github.com/libp2p/go-libp2p/p2p/host/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// expiration returns the expiration time of an address added at now with ttl, in
+// nanoseconds since the Unix epoch. Addresses with TTLs that don't fit into that
+// range, like the PermanentAddrTTL, never expire.
+func expiration(now time.Time, ttl time.Duration) int64 {
+	n := now.UnixNano()
+	if int64(ttl) > math.MaxInt64-n {
+		return math.MaxInt64
+	}
+	return n + int64(ttl)
+}
+
+// cleanAddr removes the /p2p/peer-id suffix from addr. It returns nil if addr is nil,
+// or if it's the address of another peer.
+func cleanAddr(p peer.ID, addr ma.Multiaddr) ma.Multiaddr {
+	addr, addrPid := peer.SplitAddr(addr)
+	if addr == nil {
+		log.Warnw("was passed nil multiaddr", "peer", p)
+		return nil
+	}
+	if addrPid != "" && addrPid != p {
+		log.Warnf("was passed p2p address with a different peerId, found: %s wanted: %s", addrPid, p)
+		return nil
+	}
+	return addr
+}
+
+// AddAddr calls AddAddrs(p, []ma.Multiaddr{addr}, ttl)
+func (ps *pstoresqlite) AddAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	ps.AddAddrs(p, []ma.Multiaddr{addr}, ttl)
+}
+
+// AddAddrs adds the addresses of p with the given ttl. The TTL and expiration time of
+// addresses that are already known are only ever extended.
+func (ps *pstoresqlite) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	// if ttl is zero, exit. nothing to do.
+	if ttl <= 0 {
+		return
+	}
+	var added []ma.Multiaddr
+	err := ps.withTx(context.Background(), func(tx *sql.Tx) error {
+		var err error
+		added, err = ps.addAddrs(tx, p, addrs, ttl)
+		return err
+	})
+	if err != nil {
+		log.Errorw("failed to add addresses", "peer", p, "error", err)
+		return
+	}
+	for _, a := range added {
+		ps.subManager.BroadcastAddr(p, a)
+	}
+}
+
+// addAddrs adds addrs in tx, and returns the addresses that weren't known before.
+func (ps *pstoresqlite) addAddrs(tx *sql.Tx, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) ([]ma.Multiaddr, error) {
+	exp := expiration(ps.clock.Now(), ttl)
+	var added []ma.Multiaddr
+	for _, addr := range addrs {
+		if addr = cleanAddr(p, addr); addr == nil {
+			continue
+		}
+		// update ttl & exp to whichever is greater between new and existing entry
+		res, err := tx.Exec("UPDATE addrs SET ttl = max(ttl, ?), expires = max(expires, ?) WHERE peer = ? AND addr = ?",
+			int64(ttl), exp, []byte(p), addr.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n > 0 {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO addrs (peer, addr, ttl, expires) VALUES (?, ?, ?, ?)",
+			[]byte(p), addr.Bytes(), int64(ttl), exp); err != nil {
+			return nil, err
+		}
+		added = append(added, addr)
+	}
+	return added, nil
+}
+
+// SetAddr calls SetAddrs(p, []ma.Multiaddr{addr}, ttl)
+func (ps *pstoresqlite) SetAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	ps.SetAddrs(p, []ma.Multiaddr{addr}, ttl)
+}
+
+// SetAddrs sets the ttl of the addresses of p. A ttl of zero or less removes them.
+func (ps *pstoresqlite) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	exp := expiration(ps.clock.Now(), ttl)
+	var set []ma.Multiaddr
+	err := ps.withTx(context.Background(), func(tx *sql.Tx) error {
+		for _, addr := range addrs {
+			if addr = cleanAddr(p, addr); addr == nil {
+				continue
+			}
+			if ttl <= 0 {
+				if _, err := tx.Exec("DELETE FROM addrs WHERE peer = ? AND addr = ?", []byte(p), addr.Bytes()); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := tx.Exec("INSERT OR REPLACE INTO addrs (peer, addr, ttl, expires) VALUES (?, ?, ?, ?)",
+				[]byte(p), addr.Bytes(), int64(ttl), exp); err != nil {
+				return err
+			}
+			set = append(set, addr)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorw("failed to set addresses", "peer", p, "error", err)
+		return
+	}
+	for _, a := range set {
+		ps.subManager.BroadcastAddr(p, a)
+	}
+}
+
+// UpdateAddrs updates the addresses of p that have the TTL oldTTL to newTTL. A newTTL
+// of zero or less removes them.
+func (ps *pstoresqlite) UpdateAddrs(p peer.ID, oldTTL time.Duration, newTTL time.Duration) {
+	var err error
+	if newTTL <= 0 {
+		_, err = ps.db.Exec("DELETE FROM addrs WHERE peer = ? AND ttl = ?", []byte(p), int64(oldTTL))
+	} else {
+		_, err = ps.db.Exec("UPDATE addrs SET ttl = ?, expires = ? WHERE peer = ? AND ttl = ?",
+			int64(newTTL), expiration(ps.clock.Now(), newTTL), []byte(p), int64(oldTTL))
+	}
+	if err != nil {
+		log.Errorw("failed to update addresses", "peer", p, "error", err)
+	}
+}
+
+// Addrs returns the addresses of p that haven't expired yet.
+func (ps *pstoresqlite) Addrs(p peer.ID) []ma.Multiaddr {
+	addrs := ps.AddrsWithExpiry(p)
+	res := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		res = append(res, a.Addr)
+	}
+	return res
+}
+
+// AddrsWithExpiry returns the addresses of p that haven't expired yet, along with
+// their TTLs and expiration times.
+func (ps *pstoresqlite) AddrsWithExpiry(p peer.ID) []pstore.ExpiringAddr {
+	rows, err := ps.db.Query("SELECT addr, ttl, expires FROM addrs WHERE peer = ? AND expires > ?",
+		[]byte(p), ps.clock.Now().UnixNano())
+	if err != nil {
+		log.Errorw("failed to query addresses", "peer", p, "error", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var addrs []pstore.ExpiringAddr
+	for rows.Next() {
+		var b []byte
+		var ttl, exp int64
+		if err := rows.Scan(&b, &ttl, &exp); err != nil {
+			log.Errorw("failed to read address", "peer", p, "error", err)
+			return nil
+		}
+		addr, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			log.Errorw("failed to decode address", "peer", p, "error", err)
+			continue
+		}
+		addrs = append(addrs, pstore.ExpiringAddr{Addr: addr, TTL: time.Duration(ttl), Expires: time.Unix(0, exp)})
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorw("failed to query addresses", "peer", p, "error", err)
+		return nil
+	}
+	return addrs
+}
+
+// ClearAddrs removes all previously stored addresses, and the signed peer record of p.
+func (ps *pstoresqlite) ClearAddrs(p peer.ID) {
+	err := ps.withTx(context.Background(), func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM addrs WHERE peer = ?", []byte(p)); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM records WHERE peer = ?", []byte(p))
+		return err
+	})
+	if err != nil {
+		log.Errorw("failed to clear addresses", "peer", p, "error", err)
+	}
+}
+
+// PeersWithAddrs returns the peers that have addresses that haven't expired yet.
+func (ps *pstoresqlite) PeersWithAddrs() peer.IDSlice {
+	peers, err := ps.queryPeers("SELECT DISTINCT peer FROM addrs WHERE expires > ?", ps.clock.Now().UnixNano())
+	if err != nil {
+		log.Errorw("failed to list peers with addresses", "error", err)
+		return peer.IDSlice{}
+	}
+	return peers
+}
+
+// AddrStream returns a channel on which all new addresses discovered for a
+// given peer ID will be published.
+func (ps *pstoresqlite) AddrStream(ctx context.Context, p peer.ID) <-chan ma.Multiaddr {
+	return ps.subManager.AddrStream(ctx, p, ps.Addrs(p))
+}
+
+// ConsumePeerRecord stores the signed peer record in recordEnvelope, and adds the
+// addresses it contains with the given ttl, unless we already have a record of the
+// peer with a higher sequence number.
+func (ps *pstoresqlite) ConsumePeerRecord(recordEnvelope *record.Envelope, ttl time.Duration) (bool, error) {
+	r, err := recordEnvelope.Record()
+	if err != nil {
+		return false, err
+	}
+	rec, ok := r.(*peer.PeerRecord)
+	if !ok {
+		return false, fmt.Errorf("unable to process envelope: not a PeerRecord")
+	}
+	if !rec.PeerID.MatchesPublicKey(recordEnvelope.PublicKey) {
+		return false, fmt.Errorf("signing key does not match PeerID in PeerRecord")
+	}
+	envelope, err := recordEnvelope.Marshal()
+	if err != nil {
+		return false, err
+	}
+
+	var accepted bool
+	var added []ma.Multiaddr
+	err = ps.withTx(context.Background(), func(tx *sql.Tx) error {
+		// ensure seq is greater than, or equal to, the last received
+		var seq uint64
+		err := tx.QueryRow("SELECT seq FROM records WHERE peer = ?", []byte(rec.PeerID)).Scan(&seq)
+		switch {
+		case err == nil && seq > rec.Seq:
+			return nil
+		case err != nil && !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		if _, err := tx.Exec("INSERT OR REPLACE INTO records (peer, seq, envelope) VALUES (?, ?, ?)",
+			[]byte(rec.PeerID), rec.Seq, envelope); err != nil {
+			return err
+		}
+		accepted = true
+		if ttl <= 0 {
+			return nil
+		}
+		added, err = ps.addAddrs(tx, rec.PeerID, rec.Addrs, ttl)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, a := range added {
+		ps.subManager.BroadcastAddr(rec.PeerID, a)
+	}
+	return accepted, nil
+}
+
+// GetPeerRecord returns a Envelope containing a PeerRecord for the
+// given peer id, if one exists.
+// Returns nil if no signed PeerRecord exists for the peer.
+func (ps *pstoresqlite) GetPeerRecord(p peer.ID) *record.Envelope {
+	var envelope []byte
+	// although the signed record gets garbage collected when all addrs inside it are expired,
+	// we may be in between the expiration time and the GC interval
+	// so, we check to see if we have any valid addrs before returning the record
+	err := ps.db.QueryRow(`SELECT envelope FROM records WHERE peer = ?
+		AND EXISTS (SELECT 1 FROM addrs WHERE addrs.peer = records.peer AND expires > ?)`,
+		[]byte(p), ps.clock.Now().UnixNano()).Scan(&envelope)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Errorw("failed to query signed peer record", "peer", p, "error", err)
+		}
+		return nil
+	}
+	env, _, err := record.ConsumeEnvelope(envelope, peer.PeerRecordEnvelopeDomain)
+	if err != nil {
+		log.Errorw("failed to decode signed peer record", "peer", p, "error", err)
+		return nil
+	}
+	return env
+}
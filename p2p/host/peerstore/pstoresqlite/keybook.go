@@ -0,0 +1,105 @@
+package pstoresqlite
+
+import (
+	"database/sql"
+	"errors"
+
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PubKey returns the public key of p. If we don't have it, but it's inlined in p, it
+// is extracted and stored.
+func (ps *pstoresqlite) PubKey(p peer.ID) ic.PubKey {
+	var b []byte
+	err := ps.db.QueryRow("SELECT pub FROM keys WHERE peer = ? AND pub IS NOT NULL", []byte(p)).Scan(&b)
+	if err == nil {
+		pk, err := ic.UnmarshalPublicKey(b)
+		if err != nil {
+			log.Errorf("error when unmarshalling pubkey from database for peer %s: %s\n", p, err)
+		}
+		return pk
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Errorf("error when fetching pubkey from database for peer %s: %s\n", p, err)
+		return nil
+	}
+
+	pk, err := p.ExtractPublicKey()
+	switch err {
+	case nil:
+	case peer.ErrNoPublicKey:
+		return nil
+	default:
+		log.Errorf("error when extracting pubkey from peer ID for peer %s: %s\n", p, err)
+		return nil
+	}
+	if err := ps.AddPubKey(p, pk); err != nil {
+		log.Errorf("error when adding extracted pubkey to peerstore for peer %s: %s\n", p, err)
+		return nil
+	}
+	return pk
+}
+
+func (ps *pstoresqlite) AddPubKey(p peer.ID, pk ic.PubKey) error {
+	// check it's correct.
+	if !p.MatchesPublicKey(pk) {
+		return errors.New("peer ID does not match public key")
+	}
+	val, err := ic.MarshalPublicKey(pk)
+	if err != nil {
+		log.Errorf("error while converting pubkey byte string for peer %s: %s\n", p, err)
+		return err
+	}
+	if _, err := ps.db.Exec("INSERT INTO keys (peer, pub) VALUES (?, ?) ON CONFLICT (peer) DO UPDATE SET pub = excluded.pub",
+		[]byte(p), val); err != nil {
+		log.Errorf("error while updating pubkey in database for peer %s: %s\n", p, err)
+		return err
+	}
+	return nil
+}
+
+func (ps *pstoresqlite) PrivKey(p peer.ID) ic.PrivKey {
+	var b []byte
+	if err := ps.db.QueryRow("SELECT priv FROM keys WHERE peer = ? AND priv IS NOT NULL", []byte(p)).Scan(&b); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Errorf("error when fetching privkey from database for peer %s: %s\n", p, err)
+		}
+		return nil
+	}
+	sk, err := ic.UnmarshalPrivateKey(b)
+	if err != nil {
+		return nil
+	}
+	return sk
+}
+
+func (ps *pstoresqlite) AddPrivKey(p peer.ID, sk ic.PrivKey) error {
+	if sk == nil {
+		return errors.New("private key is nil")
+	}
+	// check it's correct.
+	if !p.MatchesPrivateKey(sk) {
+		return errors.New("peer ID does not match private key")
+	}
+	val, err := ic.MarshalPrivateKey(sk)
+	if err != nil {
+		log.Errorf("error while converting privkey byte string for peer %s: %s\n", p, err)
+		return err
+	}
+	if _, err := ps.db.Exec("INSERT INTO keys (peer, priv) VALUES (?, ?) ON CONFLICT (peer) DO UPDATE SET priv = excluded.priv",
+		[]byte(p), val); err != nil {
+		log.Errorf("error while updating privkey in database for peer %s: %s\n", p, err)
+		return err
+	}
+	return nil
+}
+
+func (ps *pstoresqlite) PeersWithKeys() peer.IDSlice {
+	peers, err := ps.queryPeers("SELECT peer FROM keys")
+	if err != nil {
+		log.Errorf("error while retrieving peers with keys: %v", err)
+		return peer.IDSlice{}
+	}
+	return peers
+}
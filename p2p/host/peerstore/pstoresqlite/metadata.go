@@ -0,0 +1,61 @@
+package pstoresqlite
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+
+	pool "github.com/libp2p/go-buffer-pool"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+)
+
+// Get returns the metadata value stored for p under key. Values are serialised with
+// gob, so modules storing values of types other than the basic types need to
+// gob.Register them explicitly, or else callers will receive runtime errors.
+func (ps *pstoresqlite) Get(p peer.ID, key string) (interface{}, error) {
+	var value []byte
+	if err := ps.db.QueryRow("SELECT value FROM metadata WHERE peer = ? AND key = ?", []byte(p), key).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = pstore.ErrNotFound
+		}
+		return nil, err
+	}
+
+	var res interface{}
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (ps *pstoresqlite) Put(p peer.ID, key string, val interface{}) error {
+	var buf pool.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&val); err != nil {
+		return err
+	}
+	_, err := ps.db.Exec("INSERT OR REPLACE INTO metadata (peer, key, value) VALUES (?, ?, ?)", []byte(p), key, buf.Bytes())
+	return err
+}
+
+// MetadataKeys returns the keys of the metadata stored for p.
+func (ps *pstoresqlite) MetadataKeys(p peer.ID) []string {
+	rows, err := ps.db.Query("SELECT key FROM metadata WHERE peer = ?", []byte(p))
+	if err != nil {
+		log.Warnw("querying database when listing metadata keys failed", "peer", p, "error", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			log.Warnw("querying database when listing metadata keys failed", "peer", p, "error", err)
+			return nil
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
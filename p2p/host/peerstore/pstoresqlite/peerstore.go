@@ -0,0 +1,286 @@
+// Package pstoresqlite provides a persistent peerstore keeping addresses, keys,
+// protocols and metadata in a SQLite database, so that they survive restarts of
+// the node.
+//
+// Besides peerstore.Peerstore and peerstore.CertifiedAddrBook, the peerstore
+// implements the ExpiringAddrBook, MetadataLister and GCPeerstore interfaces of
+// github.com/libp2p/go-libp2p/p2p/host/peerstore, so that it can be exported and
+// migrated to and from the other peerstore implementations without losing data,
+// see peerstore.Migrate.
+package pstoresqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	pstore "github.com/libp2p/go-libp2p/p2p/host/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+
+	logging "github.com/ipfs/go-log/v2"
+	_ "modernc.org/sqlite"
+)
+
+var log = logging.Logger("peerstore/sqlite")
+
+// schema creates the tables of the peerstore. Peer IDs and addresses are stored in
+// their binary representation, expiration times in nanoseconds since the Unix epoch.
+const schema = `
+CREATE TABLE IF NOT EXISTS addrs (
+	peer    BLOB NOT NULL,
+	addr    BLOB NOT NULL,
+	ttl     INTEGER NOT NULL,
+	expires INTEGER NOT NULL,
+	PRIMARY KEY (peer, addr)
+);
+CREATE INDEX IF NOT EXISTS addrs_expires ON addrs (expires);
+CREATE TABLE IF NOT EXISTS records (
+	peer     BLOB PRIMARY KEY,
+	seq      INTEGER NOT NULL,
+	envelope BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS keys (
+	peer BLOB PRIMARY KEY,
+	pub  BLOB,
+	priv BLOB
+);
+CREATE TABLE IF NOT EXISTS protocols (
+	peer     BLOB NOT NULL,
+	protocol TEXT NOT NULL,
+	PRIMARY KEY (peer, protocol)
+);
+CREATE TABLE IF NOT EXISTS metadata (
+	peer  BLOB NOT NULL,
+	key   TEXT NOT NULL,
+	value BLOB NOT NULL,
+	PRIMARY KEY (peer, key)
+);
+`
+
+type clock interface {
+	Now() time.Time
+}
+
+type realclock struct{}
+
+func (rc realclock) Now() time.Time {
+	return time.Now()
+}
+
+// Options configures the peerstore.
+type Options struct {
+	// MaxProtocols is the maximum number of protocols we store for one peer.
+	MaxProtocols int
+
+	// Interval to purge expired addresses from the database. If this is a zero value,
+	// GC will not run automatically, but it'll be available on demand via explicit calls.
+	GCPurgeInterval time.Duration
+
+	// MetricsTracer, if set, is notified of every GC purge cycle.
+	MetricsTracer pstore.GCMetricsTracer
+
+	Clock clock
+}
+
+// DefaultOpts returns the default options for a SQLite peerstore:
+//
+// * MaxProtocols: 1024.
+// * GC purge interval: 2 hours.
+func DefaultOpts() Options {
+	return Options{
+		MaxProtocols:    1024,
+		GCPurgeInterval: 2 * time.Hour,
+		Clock:           realclock{},
+	}
+}
+
+type pstoresqlite struct {
+	peerstore.Metrics
+	pstore.DialMetrics
+
+	db           *sql.DB
+	clock        clock
+	maxProtocols int
+	tracer       pstore.GCMetricsTracer
+	subManager   *pstoremem.AddrSubManager
+
+	gcMx sync.Mutex
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeDone sync.WaitGroup
+}
+
+var (
+	_ peerstore.Peerstore         = &pstoresqlite{}
+	_ peerstore.CertifiedAddrBook = &pstoresqlite{}
+	_ pstore.ExpiringAddrBook     = &pstoresqlite{}
+	_ pstore.MetadataLister       = &pstoresqlite{}
+	_ pstore.GCPeerstore          = &pstoresqlite{}
+)
+
+// NewPeerstore opens the peerstore kept in the SQLite database at path, creating it if
+// it doesn't exist yet. The path ":memory:" opens an in-memory database, which is only
+// useful for testing.
+// It's the caller's responsibility to call RemovePeer to ensure that the database
+// doesn't grow unboundedly.
+func NewPeerstore(ctx context.Context, path string, opts Options) (*pstoresqlite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open peerstore database at %s: %w", path, err)
+	}
+	// SQLite serializes writes anyway, and every connection to an in-memory database
+	// would open a separate database.
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create peerstore tables: %w", err)
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = realclock{}
+	}
+	m := pstore.NewMetrics()
+	ps := &pstoresqlite{
+		Metrics:      m,
+		DialMetrics:  m,
+		db:           db,
+		clock:        opts.Clock,
+		maxProtocols: opts.MaxProtocols,
+		tracer:       opts.MetricsTracer,
+		subManager:   pstoremem.NewAddrSubManager(),
+	}
+	ps.ctx, ps.cancel = context.WithCancel(context.Background())
+	if opts.GCPurgeInterval > 0 {
+		ps.closeDone.Add(1)
+		go ps.background(opts.GCPurgeInterval)
+	}
+	return ps, nil
+}
+
+func (ps *pstoresqlite) background(interval time.Duration) {
+	defer ps.closeDone.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := ps.GC(ps.ctx); err != nil && ps.ctx.Err() == nil {
+				log.Warnw("garbage collection failed", "error", err)
+			}
+		case <-ps.ctx.Done():
+			return
+		}
+	}
+}
+
+// GC purges the expired addresses, and the signed peer records of the peers left
+// without addresses.
+func (ps *pstoresqlite) GC(ctx context.Context) error {
+	ps.gcMx.Lock()
+	defer ps.gcMx.Unlock()
+
+	start := time.Now()
+	var addrs, peers int64
+	err := ps.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM addrs WHERE expires <= ?", ps.clock.Now().UnixNano())
+		if err != nil {
+			return err
+		}
+		if addrs, err = res.RowsAffected(); err != nil {
+			return err
+		}
+		res, err = tx.ExecContext(ctx, "DELETE FROM records WHERE peer NOT IN (SELECT peer FROM addrs)")
+		if err != nil {
+			return err
+		}
+		peers, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if ps.tracer != nil {
+		ps.tracer.GCFinished(int(addrs), int(peers), time.Since(start))
+	}
+	return nil
+}
+
+func (ps *pstoresqlite) withTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryPeers returns the distinct peers in the first column of the result of query.
+func (ps *pstoresqlite) queryPeers(query string, args ...interface{}) (peer.IDSlice, error) {
+	rows, err := ps.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	peers := peer.IDSlice{}
+	for rows.Next() {
+		var p []byte
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		peers = append(peers, peer.ID(p))
+	}
+	return peers, rows.Err()
+}
+
+func (ps *pstoresqlite) Close() error {
+	ps.cancel()
+	ps.closeDone.Wait()
+	return ps.db.Close()
+}
+
+func (ps *pstoresqlite) Peers() peer.IDSlice {
+	peers, err := ps.queryPeers("SELECT peer FROM keys UNION SELECT peer FROM addrs")
+	if err != nil {
+		log.Errorw("failed to list peers", "error", err)
+		return peer.IDSlice{}
+	}
+	return peers
+}
+
+func (ps *pstoresqlite) PeerInfo(p peer.ID) peer.AddrInfo {
+	return peer.AddrInfo{
+		ID:    p,
+		Addrs: ps.Addrs(p),
+	}
+}
+
+// RemovePeer removes entries associated with a peer from:
+// * the KeyBook
+// * the ProtoBook
+// * the PeerMetadata
+// * the Metrics
+// It DOES NOT remove the peer from the AddrBook.
+func (ps *pstoresqlite) RemovePeer(p peer.ID) {
+	err := ps.withTx(context.Background(), func(tx *sql.Tx) error {
+		for _, table := range []string{"keys", "protocols", "metadata"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE peer = ?", []byte(p)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorw("failed to remove peer", "peer", p, "error", err)
+	}
+	ps.Metrics.RemovePeer(p)
+}
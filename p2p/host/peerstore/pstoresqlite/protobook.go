@@ -0,0 +1,114 @@
+package pstoresqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+var errTooManyProtocols = errors.New("too many protocols")
+
+func (ps *pstoresqlite) SetProtocols(p peer.ID, protos ...protocol.ID) error {
+	if len(protos) > ps.maxProtocols {
+		return errTooManyProtocols
+	}
+	return ps.withTx(context.Background(), func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM protocols WHERE peer = ?", []byte(p)); err != nil {
+			return err
+		}
+		return insertProtocols(tx, p, protos)
+	})
+}
+
+func (ps *pstoresqlite) AddProtocols(p peer.ID, protos ...protocol.ID) error {
+	return ps.withTx(context.Background(), func(tx *sql.Tx) error {
+		var n int
+		if err := tx.QueryRow("SELECT count(*) FROM protocols WHERE peer = ?", []byte(p)).Scan(&n); err != nil {
+			return err
+		}
+		if n+len(protos) > ps.maxProtocols {
+			return errTooManyProtocols
+		}
+		return insertProtocols(tx, p, protos)
+	})
+}
+
+func insertProtocols(tx *sql.Tx, p peer.ID, protos []protocol.ID) error {
+	for _, proto := range protos {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO protocols (peer, protocol) VALUES (?, ?)", []byte(p), string(proto)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ps *pstoresqlite) GetProtocols(p peer.ID) ([]protocol.ID, error) {
+	rows, err := ps.db.Query("SELECT protocol FROM protocols WHERE peer = ?", []byte(p))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []protocol.ID{}
+	for rows.Next() {
+		var proto string
+		if err := rows.Scan(&proto); err != nil {
+			return nil, err
+		}
+		res = append(res, protocol.ID(proto))
+	}
+	return res, rows.Err()
+}
+
+func (ps *pstoresqlite) SupportsProtocols(p peer.ID, protos ...protocol.ID) ([]protocol.ID, error) {
+	supported, err := ps.protocolSet(p)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]protocol.ID, 0, len(protos))
+	for _, proto := range protos {
+		if _, ok := supported[proto]; ok {
+			res = append(res, proto)
+		}
+	}
+	return res, nil
+}
+
+func (ps *pstoresqlite) FirstSupportedProtocol(p peer.ID, protos ...protocol.ID) (protocol.ID, error) {
+	supported, err := ps.protocolSet(p)
+	if err != nil {
+		return "", err
+	}
+	for _, proto := range protos {
+		if _, ok := supported[proto]; ok {
+			return proto, nil
+		}
+	}
+	return "", nil
+}
+
+func (ps *pstoresqlite) protocolSet(p peer.ID) (map[protocol.ID]struct{}, error) {
+	protos, err := ps.GetProtocols(p)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[protocol.ID]struct{}, len(protos))
+	for _, proto := range protos {
+		set[proto] = struct{}{}
+	}
+	return set, nil
+}
+
+func (ps *pstoresqlite) RemoveProtocols(p peer.ID, protos ...protocol.ID) error {
+	return ps.withTx(context.Background(), func(tx *sql.Tx) error {
+		for _, proto := range protos {
+			if _, err := tx.Exec("DELETE FROM protocols WHERE peer = ? AND protocol = ?", []byte(p), string(proto)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
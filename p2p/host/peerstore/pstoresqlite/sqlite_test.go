@@ -0,0 +1,178 @@
+package pstoresqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+	pt "github.com/libp2p/go-libp2p/p2p/host/peerstore/test"
+
+	mockClock "github.com/benbjohnson/clock"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func newPeerstore(tb testing.TB, opts Options) *pstoresqlite {
+	tb.Helper()
+	ps, err := NewPeerstore(context.Background(), ":memory:", opts)
+	require.NoError(tb, err)
+	return ps
+}
+
+func TestSQLitePeerstore(t *testing.T) {
+	pt.TestPeerstore(t, func() (pstore.Peerstore, func()) {
+		ps := newPeerstore(t, DefaultOpts())
+		return ps, func() { ps.Close() }
+	})
+
+	t.Run("protobook limits", func(t *testing.T) {
+		const limit = 10
+		opts := DefaultOpts()
+		opts.MaxProtocols = limit
+		ps := newPeerstore(t, opts)
+		defer ps.Close()
+		pt.TestPeerstoreProtoStoreLimits(t, ps, limit)
+	})
+}
+
+func TestSQLiteAddrBook(t *testing.T) {
+	opts := DefaultOpts()
+	clk := mockClock.NewMock()
+	opts.Clock = clk
+	pt.TestAddrBook(t, func() (pstore.AddrBook, func()) {
+		ps := newPeerstore(t, opts)
+		return ps, func() { ps.Close() }
+	}, clk)
+}
+
+func TestSQLiteKeyBook(t *testing.T) {
+	pt.TestKeyBook(t, func() (pstore.KeyBook, func()) {
+		ps := newPeerstore(t, DefaultOpts())
+		return ps, func() { ps.Close() }
+	})
+}
+
+func BenchmarkSQLitePeerstore(b *testing.B) {
+	pt.BenchmarkPeerstore(b, func() (pstore.Peerstore, func()) {
+		ps := newPeerstore(b, DefaultOpts())
+		return ps, func() { ps.Close() }
+	}, "SQLite")
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peerstore.db")
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	certified := ma.StringCast("/ip4/1.2.3.4/udp/1234/quic-v1")
+
+	ps, err := NewPeerstore(context.Background(), path, DefaultOpts())
+	require.NoError(t, err)
+	require.NoError(t, ps.AddPrivKey(p, priv))
+	ps.AddAddr(p, addr, time.Hour)
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: p, Addrs: []ma.Multiaddr{certified}}), priv)
+	require.NoError(t, err)
+	accepted, err := ps.ConsumePeerRecord(env, pstore.PermanentAddrTTL)
+	require.NoError(t, err)
+	require.True(t, accepted)
+	require.NoError(t, ps.AddProtocols(p, "/foo/1.0.0"))
+	require.NoError(t, ps.Put(p, "AgentVersion", "test"))
+	require.NoError(t, ps.Close())
+
+	ps, err = NewPeerstore(context.Background(), path, DefaultOpts())
+	require.NoError(t, err)
+	defer ps.Close()
+	require.Equal(t, peer.IDSlice{p}, ps.Peers())
+	require.True(t, ps.PrivKey(p).Equals(priv))
+	require.True(t, ps.PubKey(p).Equals(priv.GetPublic()))
+	require.ElementsMatch(t, []ma.Multiaddr{addr, certified}, ps.Addrs(p))
+	require.True(t, env.Equal(ps.GetPeerRecord(p)))
+	protos, err := ps.GetProtocols(p)
+	require.NoError(t, err)
+	require.Equal(t, []protocol.ID{"/foo/1.0.0"}, protos)
+	v, err := ps.Get(p, "AgentVersion")
+	require.NoError(t, err)
+	require.Equal(t, "test", v)
+
+	expiry := make(map[string]peerstore.ExpiringAddr)
+	for _, a := range ps.AddrsWithExpiry(p) {
+		expiry[a.Addr.String()] = a
+	}
+	require.Equal(t, time.Hour, expiry[addr.String()].TTL)
+	require.Equal(t, time.Duration(pstore.PermanentAddrTTL), expiry[certified.String()].TTL)
+}
+
+func TestGC(t *testing.T) {
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: p, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1")}}), priv)
+	require.NoError(t, err)
+
+	opts := DefaultOpts()
+	clk := mockClock.NewMock()
+	opts.Clock = clk
+	ps := newPeerstore(t, opts)
+	defer ps.Close()
+	_, err = ps.ConsumePeerRecord(env, time.Minute)
+	require.NoError(t, err)
+	p2 := test.RandPeerIDFatal(t)
+	ps.AddAddr(p2, ma.StringCast("/ip4/1.2.3.4/tcp/2"), time.Hour)
+
+	clk.Add(2 * time.Minute)
+	require.NoError(t, ps.GC(context.Background()))
+	var addrs, records int
+	require.NoError(t, ps.db.QueryRow("SELECT count(*) FROM addrs").Scan(&addrs))
+	require.NoError(t, ps.db.QueryRow("SELECT count(*) FROM records").Scan(&records))
+	require.Equal(t, 1, addrs)
+	require.Zero(t, records)
+	require.Equal(t, peer.IDSlice{p2}, ps.PeersWithAddrs())
+}
+
+func TestMigrate(t *testing.T) {
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+
+	src, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer src.Close()
+	require.NoError(t, src.AddPrivKey(p, priv))
+	src.AddAddr(p, addr, pstore.PermanentAddrTTL)
+	require.NoError(t, src.AddProtocols(p, "/foo/1.0.0"))
+	require.NoError(t, src.Put(p, "AgentVersion", "test"))
+
+	dst := newPeerstore(t, DefaultOpts())
+	defer dst.Close()
+	require.NoError(t, peerstore.Migrate(dst, src))
+	require.True(t, dst.PrivKey(p).Equals(priv))
+	require.Equal(t, []ma.Multiaddr{addr}, dst.Addrs(p))
+	protos, err := dst.GetProtocols(p)
+	require.NoError(t, err)
+	require.Equal(t, []protocol.ID{"/foo/1.0.0"}, protos)
+
+	// and back
+	back, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer back.Close()
+	require.NoError(t, peerstore.Migrate(back, dst))
+	require.True(t, back.PrivKey(p).Equals(priv))
+	require.Equal(t, []ma.Multiaddr{addr}, back.Addrs(p))
+	v, err := back.Get(p, "AgentVersion")
+	require.NoError(t, err)
+	require.Equal(t, "test", v)
+}
@@ -0,0 +1,244 @@
+package peerstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/record"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// SnapshotVersion is the version of the snapshot format written by Export.
+const SnapshotVersion = 1
+
+// ExpiringAddr is an address along with its TTL and expiration time.
+type ExpiringAddr struct {
+	Addr    ma.Multiaddr
+	TTL     time.Duration
+	Expires time.Time
+}
+
+// ExpiringAddrBook is implemented by address books that can report the TTLs and
+// expiration times of the addresses they store. Both pstoremem and pstoreds do.
+type ExpiringAddrBook interface {
+	// AddrsWithExpiry returns the addresses of p that haven't expired yet.
+	AddrsWithExpiry(p peer.ID) []ExpiringAddr
+}
+
+// MetadataLister is implemented by metadata stores that can list the keys they
+// store values under for a peer. Both pstoremem and pstoreds do.
+type MetadataLister interface {
+	// MetadataKeys returns the keys of the metadata stored for p.
+	MetadataKeys(p peer.ID) []string
+}
+
+// Snapshot is a portable copy of the contents of a peerstore, created by Export and
+// restored by Import. It can be serialized to JSON. Private keys are never included.
+type Snapshot struct {
+	Version int
+	// Created is the time the snapshot was taken.
+	Created time.Time
+	Peers   []PeerSnapshot
+}
+
+// PeerSnapshot holds everything a peerstore knows about a peer.
+type PeerSnapshot struct {
+	ID peer.ID
+	// PubKey is the public key of the peer, as marshaled by crypto.MarshalPublicKey.
+	PubKey []byte         `json:",omitempty"`
+	Addrs  []AddrSnapshot `json:",omitempty"`
+	// SignedPeerRecord is the marshaled envelope of the peer's signed peer record.
+	SignedPeerRecord []byte        `json:",omitempty"`
+	Protocols        []protocol.ID `json:",omitempty"`
+	// Metadata holds the JSON encoding of the metadata values of the peer.
+	Metadata map[string]json.RawMessage `json:",omitempty"`
+}
+
+// AddrSnapshot is an address of a peer along with its TTL and expiration time.
+type AddrSnapshot struct {
+	Addr    string
+	TTL     time.Duration
+	Expires time.Time
+}
+
+// Export takes a snapshot of ps.
+//
+// If the address book of ps doesn't implement ExpiringAddrBook, the addresses are
+// exported with the AddressTTL. Metadata is only exported if ps implements
+// MetadataLister, and values that can't be encoded as JSON are omitted.
+func Export(ps pstore.Peerstore) (*Snapshot, error) {
+	now := time.Now()
+	snap := &Snapshot{Version: SnapshotVersion, Created: now}
+	for _, p := range ps.Peers() {
+		s, err := exportPeer(ps, p, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export peer %s: %w", p, err)
+		}
+		s.Metadata = exportMetadata(ps, p)
+		snap.Peers = append(snap.Peers, *s)
+	}
+	return snap, nil
+}
+
+func exportPeer(ps pstore.Peerstore, p peer.ID, now time.Time) (*PeerSnapshot, error) {
+	s := &PeerSnapshot{ID: p}
+	if pk := ps.PubKey(p); pk != nil {
+		b, err := crypto.MarshalPublicKey(pk)
+		if err != nil {
+			return nil, err
+		}
+		s.PubKey = b
+	}
+
+	if eab, ok := ps.(ExpiringAddrBook); ok {
+		for _, a := range eab.AddrsWithExpiry(p) {
+			s.Addrs = append(s.Addrs, AddrSnapshot{Addr: a.Addr.String(), TTL: a.TTL, Expires: a.Expires})
+		}
+	} else {
+		for _, a := range ps.Addrs(p) {
+			s.Addrs = append(s.Addrs, AddrSnapshot{Addr: a.String(), TTL: pstore.AddressTTL, Expires: now.Add(pstore.AddressTTL)})
+		}
+	}
+
+	if cab, ok := pstore.GetCertifiedAddrBook(ps); ok {
+		if env := cab.GetPeerRecord(p); env != nil {
+			b, err := env.Marshal()
+			if err != nil {
+				return nil, err
+			}
+			s.SignedPeerRecord = b
+		}
+	}
+
+	protos, err := ps.GetProtocols(p)
+	if err != nil {
+		return nil, err
+	}
+	s.Protocols = protos
+	return s, nil
+}
+
+func exportMetadata(ps pstore.Peerstore, p peer.ID) map[string]json.RawMessage {
+	ml, ok := ps.(MetadataLister)
+	if !ok {
+		return nil
+	}
+	var metadata map[string]json.RawMessage
+	for _, k := range ml.MetadataKeys(p) {
+		v, err := ps.Get(p, k)
+		if err != nil {
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]json.RawMessage)
+		}
+		metadata[k] = b
+	}
+	return metadata
+}
+
+// Import adds the contents of snap to ps.
+//
+// Addresses that expired since the snapshot was taken are skipped, the others are
+// added with the TTL that remained when the snapshot was taken, minus the time that
+// passed since. Permanent addresses stay permanent, but addresses of peers that were
+// connected when the snapshot was taken are added with the RecentlyConnectedAddrTTL.
+// Metadata values are restored as decoded by encoding/json, e.g. numbers become
+// float64s.
+func Import(ps pstore.Peerstore, snap *Snapshot) error {
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version: %d", snap.Version)
+	}
+	now := time.Now()
+	for _, s := range snap.Peers {
+		if err := importPeer(ps, &s, now); err != nil {
+			return fmt.Errorf("failed to import peer %s: %w", s.ID, err)
+		}
+	}
+	return nil
+}
+
+func importPeer(ps pstore.Peerstore, s *PeerSnapshot, now time.Time) error {
+	if len(s.PubKey) > 0 {
+		pk, err := crypto.UnmarshalPublicKey(s.PubKey)
+		if err != nil {
+			return err
+		}
+		if err := ps.AddPubKey(s.ID, pk); err != nil {
+			return err
+		}
+	}
+
+	addrs := make([]ma.Multiaddr, 0, len(s.Addrs))
+	ttls := make([]time.Duration, 0, len(s.Addrs))
+	var maxTTL time.Duration
+	for _, a := range s.Addrs {
+		ttl := remainingTTL(a, now)
+		if ttl <= 0 {
+			continue
+		}
+		addr, err := ma.NewMultiaddr(a.Addr)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, addr)
+		ttls = append(ttls, ttl)
+		if ttl > maxTTL {
+			maxTTL = ttl
+		}
+	}
+
+	if len(s.SignedPeerRecord) > 0 && maxTTL > 0 {
+		if cab, ok := pstore.GetCertifiedAddrBook(ps); ok {
+			env, _, err := record.ConsumeEnvelope(s.SignedPeerRecord, peer.PeerRecordEnvelopeDomain)
+			if err != nil {
+				return err
+			}
+			if _, err := cab.ConsumePeerRecord(env, maxTTL); err != nil {
+				return err
+			}
+		}
+	}
+	for i, addr := range addrs {
+		ps.AddAddr(s.ID, addr, ttls[i])
+	}
+
+	if len(s.Protocols) > 0 {
+		if err := ps.AddProtocols(s.ID, s.Protocols...); err != nil {
+			return err
+		}
+	}
+
+	for k, raw := range s.Metadata {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return err
+		}
+		if err := ps.Put(s.ID, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remainingTTL returns the TTL a snapshotted address should be imported with.
+func remainingTTL(a AddrSnapshot, now time.Time) time.Duration {
+	switch {
+	case a.TTL == pstore.ConnectedAddrTTL:
+		return pstore.RecentlyConnectedAddrTTL
+	case a.TTL >= pstore.PermanentAddrTTL:
+		return pstore.PermanentAddrTTL
+	default:
+		return a.Expires.Sub(now)
+	}
+}
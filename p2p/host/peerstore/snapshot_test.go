@@ -0,0 +1,128 @@
+package peerstore_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoreds"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotExportImport(t *testing.T) {
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	// a peer without a signed peer record
+	p2 := test.RandPeerIDFatal(t)
+
+	permanent := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	connected := ma.StringCast("/ip4/1.2.3.4/tcp/2")
+	temporary := ma.StringCast("/ip4/1.2.3.4/tcp/3")
+	certified := ma.StringCast("/ip4/1.2.3.4/udp/4/quic-v1")
+
+	newDSPeerstore := func() pstore.Peerstore {
+		ps, err := pstoreds.NewPeerstore(context.Background(), dssync.MutexWrap(ds.NewMapDatastore()), pstoreds.DefaultOpts())
+		require.NoError(t, err)
+		return ps
+	}
+	newMemPeerstore := func() pstore.Peerstore {
+		ps, err := pstoremem.NewPeerstore()
+		require.NoError(t, err)
+		return ps
+	}
+
+	for name, tc := range map[string]struct{ src, dst func() pstore.Peerstore }{
+		"mem to ds": {src: newMemPeerstore, dst: newDSPeerstore},
+		"ds to mem": {src: newDSPeerstore, dst: newMemPeerstore},
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := tc.src()
+			defer src.Close()
+
+			require.NoError(t, src.AddPubKey(p, priv.GetPublic()))
+			env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: p, Addrs: []ma.Multiaddr{certified}}), priv)
+			require.NoError(t, err)
+			cab, ok := pstore.GetCertifiedAddrBook(src)
+			require.True(t, ok)
+			_, err = cab.ConsumePeerRecord(env, time.Hour)
+			require.NoError(t, err)
+			src.AddAddr(p2, permanent, pstore.PermanentAddrTTL)
+			src.AddAddr(p2, connected, pstore.ConnectedAddrTTL)
+			src.AddAddr(p2, temporary, time.Hour)
+			require.NoError(t, src.AddProtocols(p2, "/foo/1.0.0", "/bar/1.0.0"))
+			require.NoError(t, src.Put(p2, "AgentVersion", "test/1.0"))
+
+			snap, err := peerstore.Export(src)
+			require.NoError(t, err)
+			b, err := json.Marshal(snap)
+			require.NoError(t, err)
+			require.NotContains(t, string(b), "PrivKey")
+
+			var decoded peerstore.Snapshot
+			require.NoError(t, json.Unmarshal(b, &decoded))
+			dst := tc.dst()
+			defer dst.Close()
+			require.NoError(t, peerstore.Import(dst, &decoded))
+
+			require.True(t, dst.PubKey(p).Equals(priv.GetPublic()))
+			require.Equal(t, []ma.Multiaddr{certified}, dst.Addrs(p))
+			dstCab, ok := pstore.GetCertifiedAddrBook(dst)
+			require.True(t, ok)
+			require.NotNil(t, dstCab.GetPeerRecord(p))
+
+			require.ElementsMatch(t, []ma.Multiaddr{permanent, connected, temporary}, dst.Addrs(p2))
+			expiry := make(map[string]peerstore.ExpiringAddr)
+			for _, a := range dst.(peerstore.ExpiringAddrBook).AddrsWithExpiry(p2) {
+				expiry[a.Addr.String()] = a
+			}
+			require.Equal(t, time.Duration(pstore.PermanentAddrTTL), expiry[permanent.String()].TTL)
+			require.Equal(t, pstore.RecentlyConnectedAddrTTL, expiry[connected.String()].TTL)
+			require.LessOrEqual(t, expiry[temporary.String()].TTL, time.Hour)
+			require.Greater(t, expiry[temporary.String()].TTL, 59*time.Minute)
+
+			protos, err := dst.GetProtocols(p2)
+			require.NoError(t, err)
+			require.ElementsMatch(t, []protocol.ID{"/foo/1.0.0", "/bar/1.0.0"}, protos)
+			v, err := dst.Get(p2, "AgentVersion")
+			require.NoError(t, err)
+			require.Equal(t, "test/1.0", v)
+		})
+	}
+}
+
+func TestSnapshotImportSkipsExpiredAddrs(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	snap := &peerstore.Snapshot{
+		Version: peerstore.SnapshotVersion,
+		Peers: []peerstore.PeerSnapshot{{
+			ID: p,
+			Addrs: []peerstore.AddrSnapshot{
+				{Addr: "/ip4/1.2.3.4/tcp/1", TTL: time.Hour, Expires: time.Now().Add(-time.Minute)},
+				{Addr: "/ip4/1.2.3.4/tcp/2", TTL: time.Hour, Expires: time.Now().Add(time.Minute)},
+			},
+		}},
+	}
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	require.NoError(t, peerstore.Import(ps, snap))
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/2")}, ps.Addrs(p))
+
+	snap.Version = 42
+	require.Error(t, peerstore.Import(ps, snap))
+}
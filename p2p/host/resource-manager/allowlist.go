@@ -2,6 +2,7 @@ package rcmgr
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/peer"
 
+	ds "github.com/ipfs/go-datastore"
 	"github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 )
@@ -25,6 +27,11 @@ type Allowlist struct {
 
 	// Only the specified peers can use these IPs
 	allowedPeerByNetwork map[peer.ID][]*net.IPNet
+
+	// store persists the entries added at runtime, if set. See WithPersistentAllowlist.
+	store ds.Datastore
+	// onChange is called without holding mu whenever an entry is added or removed.
+	onChange func(added, removed multiaddr.Multiaddr)
 }
 
 // WithAllowlistedMultiaddrs sets the multiaddrs to be in the allowlist
@@ -104,11 +111,26 @@ func toIPNet(ma multiaddr.Multiaddr) (*net.IPNet, peer.ID, error) {
 // an ip address of the peer with or without a `/p2p` protocol.
 // e.g. /ip4/1.2.3.4/p2p/QmFoo, /ip4/1.2.3.4, and /ip4/1.2.3.0/ipcidr/24 are valid.
 // /p2p/QmFoo is not valid.
+//
+// If the allowlist is persistent, the entry is stored and restored on the next start.
 func (al *Allowlist) Add(ma multiaddr.Multiaddr) error {
 	ipnet, allowedPeer, err := toIPNet(ma)
 	if err != nil {
 		return err
 	}
+	if al.store != nil {
+		if err := al.store.Put(context.Background(), allowlistKey(ipnet, allowedPeer), entryMultiaddr(ipnet, allowedPeer).Bytes()); err != nil {
+			return fmt.Errorf("failed to persist allowlist entry: %w", err)
+		}
+	}
+	al.add(ipnet, allowedPeer)
+	if al.onChange != nil {
+		al.onChange(entryMultiaddr(ipnet, allowedPeer), nil)
+	}
+	return nil
+}
+
+func (al *Allowlist) add(ipnet *net.IPNet, allowedPeer peer.ID) {
 	al.mu.Lock()
 	defer al.mu.Unlock()
 
@@ -121,14 +143,28 @@ func (al *Allowlist) Add(ma multiaddr.Multiaddr) error {
 	} else {
 		al.allowedNetworks = append(al.allowedNetworks, ipnet)
 	}
-	return nil
 }
 
+// Remove takes a multiaddr in the format accepted by Add, and removes it from the
+// allowlist.
 func (al *Allowlist) Remove(ma multiaddr.Multiaddr) error {
 	ipnet, allowedPeer, err := toIPNet(ma)
 	if err != nil {
 		return err
 	}
+	if al.store != nil {
+		if err := al.store.Delete(context.Background(), allowlistKey(ipnet, allowedPeer)); err != nil {
+			return fmt.Errorf("failed to delete persisted allowlist entry: %w", err)
+		}
+	}
+	if al.remove(ipnet, allowedPeer) && al.onChange != nil {
+		al.onChange(nil, entryMultiaddr(ipnet, allowedPeer))
+	}
+	return nil
+}
+
+// remove removes an entry, and returns true if it was found.
+func (al *Allowlist) remove(ipnet *net.IPNet, allowedPeer peer.ID) (removed bool) {
 	al.mu.Lock()
 	defer al.mu.Unlock()
 
@@ -140,7 +176,7 @@ func (al *Allowlist) Remove(ma multiaddr.Multiaddr) error {
 	}
 
 	if ipNetList == nil {
-		return nil
+		return false
 	}
 
 	i := len(ipNetList)
@@ -151,6 +187,7 @@ func (al *Allowlist) Remove(ma multiaddr.Multiaddr) error {
 			ipNetList[i] = ipNetList[len(ipNetList)-1]
 			ipNetList = ipNetList[:len(ipNetList)-1]
 			// We only remove one thing
+			removed = true
 			break
 		}
 	}
@@ -161,7 +198,38 @@ func (al *Allowlist) Remove(ma multiaddr.Multiaddr) error {
 		al.allowedNetworks = ipNetList
 	}
 
-	return nil
+	return removed
+}
+
+// Multiaddrs returns the entries of the allowlist, in the format accepted by Add.
+func (al *Allowlist) Multiaddrs() []multiaddr.Multiaddr {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+
+	out := make([]multiaddr.Multiaddr, 0, len(al.allowedNetworks))
+	for _, ipnet := range al.allowedNetworks {
+		out = append(out, entryMultiaddr(ipnet, ""))
+	}
+	for p, networks := range al.allowedPeerByNetwork {
+		for _, ipnet := range networks {
+			out = append(out, entryMultiaddr(ipnet, p))
+		}
+	}
+	return out
+}
+
+// entryMultiaddr returns the multiaddr of an entry, like /ip4/1.2.3.0/ipcidr/24/p2p/QmFoo.
+func entryMultiaddr(ipnet *net.IPNet, allowedPeer peer.ID) multiaddr.Multiaddr {
+	ones, _ := ipnet.Mask.Size()
+	proto := "ip6"
+	if ip4 := ipnet.IP.To4(); ip4 != nil {
+		proto = "ip4"
+	}
+	s := fmt.Sprintf("/%s/%s/ipcidr/%d", proto, ipnet.IP, ones)
+	if allowedPeer != "" {
+		s += "/p2p/" + allowedPeer.String()
+	}
+	return multiaddr.StringCast(s)
 }
 
 func (al *Allowlist) Allowed(ma multiaddr.Multiaddr) bool {
@@ -0,0 +1,59 @@
+package rcmgr
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/multiformats/go-base32"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Allowlist entries added at runtime are persisted under the following db key pattern:
+// /rcmgr/allowlist/<b32 entry multiaddr bytes no padding>
+var allowlistBase = ds.NewKey("/rcmgr/allowlist")
+
+func allowlistKey(ipnet *net.IPNet, allowedPeer peer.ID) ds.Key {
+	return allowlistBase.ChildString(base32.RawStdEncoding.EncodeToString(entryMultiaddr(ipnet, allowedPeer).Bytes()))
+}
+
+// WithPersistentAllowlist persists the allowlist entries that are added at runtime in
+// store, and restores them on start. The entries passed to WithAllowlistedMultiaddrs
+// aren't persisted, as they are part of the configuration.
+func WithPersistentAllowlist(store ds.Datastore) Option {
+	return func(r *resourceManager) error {
+		r.allowlistStore = store
+		return nil
+	}
+}
+
+// load restores the entries persisted in store, and persists the entries added from
+// now on.
+func (al *Allowlist) load(store ds.Datastore) error {
+	res, err := store.Query(context.Background(), query.Query{Prefix: allowlistBase.String()})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return fmt.Errorf("failed to load allowlist: %w", r.Error)
+		}
+		ma, err := multiaddr.NewMultiaddrBytes(r.Value)
+		if err != nil {
+			return fmt.Errorf("failed to decode allowlist entry %s: %w", r.Key, err)
+		}
+		ipnet, allowedPeer, err := toIPNet(ma)
+		if err != nil {
+			return fmt.Errorf("invalid allowlist entry %s: %w", ma, err)
+		}
+		al.add(ipnet, allowedPeer)
+	}
+	al.store = store
+	return nil
+}
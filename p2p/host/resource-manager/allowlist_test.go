@@ -5,11 +5,17 @@ import (
 	"fmt"
 	"net"
 	"testing"
+	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
 
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
 )
 
 func ExampleWithAllowlistedMultiaddrs() {
@@ -215,6 +221,65 @@ func TestRemoved(t *testing.T) {
 	}
 }
 
+func TestPersistentAllowlist(t *testing.T) {
+	peerA := test.RandPeerIDFatal(t)
+	store := dssync.MutexWrap(ds.NewMapDatastore())
+	static := multiaddr.StringCast("/ip4/1.1.1.1")
+
+	rm, err := NewResourceManager(NewFixedLimiter(DefaultLimits.AutoScale()),
+		WithAllowlistedMultiaddrs([]multiaddr.Multiaddr{static}),
+		WithPersistentAllowlist(store),
+	)
+	require.NoError(t, err)
+	bus := eventbus.NewBus()
+	require.NoError(t, rm.(*resourceManager).EmitEvents(bus))
+	sub, err := bus.Subscribe(new(event.EvtAllowlistUpdated))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	allowlist := GetAllowlist(rm)
+	require.NoError(t, allowlist.Add(multiaddr.StringCast("/ip4/1.2.3.0/ipcidr/24")))
+	require.NoError(t, allowlist.Add(multiaddr.StringCast("/ip6/2001:db8::1/p2p/"+peerA.String())))
+	require.NoError(t, allowlist.Add(multiaddr.StringCast("/ip4/4.4.4.4")))
+	require.NoError(t, allowlist.Remove(multiaddr.StringCast("/ip4/4.4.4.4")))
+	// removing an entry that doesn't exist doesn't emit an event
+	require.NoError(t, allowlist.Remove(multiaddr.StringCast("/ip4/5.5.5.5")))
+
+	for _, expected := range []event.EvtAllowlistUpdated{
+		{Added: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/1.2.3.0/ipcidr/24")}},
+		{Added: []multiaddr.Multiaddr{multiaddr.StringCast("/ip6/2001:db8::1/ipcidr/128/p2p/" + peerA.String())}},
+		{Added: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/4.4.4.4/ipcidr/32")}},
+		{Removed: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/4.4.4.4/ipcidr/32")}},
+	} {
+		select {
+		case e := <-sub.Out():
+			require.Equal(t, expected, e)
+		case <-time.After(time.Second):
+			t.Fatal("expected an allowlist updated event")
+		}
+	}
+	select {
+	case e := <-sub.Out():
+		t.Fatalf("unexpected event: %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.NoError(t, rm.Close())
+
+	// the entries added at runtime are restored, the static ones aren't persisted
+	rm, err = NewResourceManager(NewFixedLimiter(DefaultLimits.AutoScale()), WithPersistentAllowlist(store))
+	require.NoError(t, err)
+	defer rm.Close()
+	allowlist = GetAllowlist(rm)
+	require.ElementsMatch(t, []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/1.2.3.0/ipcidr/24"),
+		multiaddr.StringCast("/ip6/2001:db8::1/ipcidr/128/p2p/" + peerA.String()),
+	}, allowlist.Multiaddrs())
+	require.True(t, allowlist.Allowed(multiaddr.StringCast("/ip4/1.2.3.9/tcp/1")))
+	require.False(t, allowlist.Allowed(multiaddr.StringCast("/ip4/4.4.4.4/tcp/1")))
+	require.False(t, allowlist.Allowed(static))
+	require.True(t, allowlist.AllowedPeerAndMultiaddr(peerA, multiaddr.StringCast("/ip6/2001:db8::1/udp/1")))
+}
+
 // BenchmarkAllowlistCheck benchmarks the allowlist with plausible conditions.
 func BenchmarkAllowlistCheck(b *testing.B) {
 	allowlist := newAllowlist()
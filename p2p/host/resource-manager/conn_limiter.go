@@ -0,0 +1,139 @@
+package rcmgr
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// ConnLimitPerSubnet limits the number of inbound connections from the addresses of
+// each subnet of a given size.
+type ConnLimitPerSubnet struct {
+	// PrefixLength is the length of the subnet prefix in bits, e.g. 32 to limit the
+	// connections per IPv4 address, or 24 to limit them per /24 subnet.
+	PrefixLength int
+	// ConnCount is the maximum number of inbound connections from each subnet.
+	ConnCount int
+}
+
+var (
+	// DefaultConnLimitsPerSubnetIPv4 limits the inbound connections per IPv4 address
+	// and per /24 subnet.
+	DefaultConnLimitsPerSubnetIPv4 = []ConnLimitPerSubnet{
+		{PrefixLength: 32, ConnCount: 8},
+		{PrefixLength: 24, ConnCount: 32},
+	}
+	// DefaultConnLimitsPerSubnetIPv6 limits the inbound connections per IPv6 address
+	// and per /64 subnet, which is usually assigned to a single host.
+	DefaultConnLimitsPerSubnetIPv6 = []ConnLimitPerSubnet{
+		{PrefixLength: 128, ConnCount: 8},
+		{PrefixLength: 64, ConnCount: 32},
+	}
+)
+
+// WithConnLimitsPerSubnet limits the number of inbound connections from each IP
+// address or subnet, so that a single address can't use up the inbound connection
+// limits of the system and transient scopes. Connections from allowlisted and loopback
+// addresses aren't limited.
+//
+// Use DefaultConnLimitsPerSubnetIPv4 and DefaultConnLimitsPerSubnetIPv6 for
+// reasonable defaults.
+func WithConnLimitsPerSubnet(ipv4, ipv6 []ConnLimitPerSubnet) Option {
+	return func(r *resourceManager) error {
+		for _, l := range ipv4 {
+			if l.PrefixLength < 0 || l.PrefixLength > 32 {
+				return fmt.Errorf("invalid IPv4 prefix length: %d", l.PrefixLength)
+			}
+		}
+		for _, l := range ipv6 {
+			if l.PrefixLength < 0 || l.PrefixLength > 128 {
+				return fmt.Errorf("invalid IPv6 prefix length: %d", l.PrefixLength)
+			}
+		}
+		for _, l := range append(ipv4, ipv6...) {
+			if l.ConnCount < 0 {
+				return errors.New("subnet connection count must be non-negative")
+			}
+		}
+		r.subnets = &subnetLimiter{
+			ipv4:  ipv4,
+			ipv6:  ipv6,
+			conns: make(map[netip.Prefix]int),
+		}
+		return nil
+	}
+}
+
+// subnetLimiter counts the inbound connections per subnet.
+type subnetLimiter struct {
+	ipv4, ipv6 []ConnLimitPerSubnet
+
+	mx    sync.Mutex
+	conns map[netip.Prefix]int
+}
+
+// add counts an inbound connection from endpoint in all its subnets. It returns a
+// function to release the connection, or an error if the limit of one of the subnets
+// is reached. A nil subnetLimiter doesn't limit connections.
+func (l *subnetLimiter) add(endpoint multiaddr.Multiaddr) (release func(), err error) {
+	if l == nil || endpoint == nil {
+		return func() {}, nil
+	}
+	ip, err := manet.ToIP(endpoint)
+	if err != nil || ip.IsLoopback() {
+		return func() {}, nil
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return func() {}, nil
+	}
+	addr = addr.Unmap()
+	limits := l.ipv6
+	if addr.Is4() {
+		limits = l.ipv4
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(limits))
+	for _, limit := range limits {
+		prefix, err := addr.Prefix(limit.PrefixLength)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	for i, limit := range limits {
+		if current := l.conns[prefixes[i]]; current >= limit.ConnCount {
+			return nil, &ErrStreamOrConnLimitExceeded{
+				current:   current,
+				attempted: 1,
+				limit:     limit.ConnCount,
+				err:       fmt.Errorf("cannot reserve inbound connection from subnet %s: %w", prefixes[i], network.ErrResourceLimitExceeded),
+			}
+		}
+	}
+	for _, prefix := range prefixes {
+		l.conns[prefix]++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mx.Lock()
+			defer l.mx.Unlock()
+			for _, prefix := range prefixes {
+				if l.conns[prefix]--; l.conns[prefix] <= 0 {
+					delete(l.conns, prefix)
+				}
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,70 @@
+package rcmgr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnLimitsPerSubnet(t *testing.T) {
+	rm, err := NewResourceManager(NewFixedLimiter(InfiniteLimits),
+		WithConnLimitsPerSubnet(
+			[]ConnLimitPerSubnet{{PrefixLength: 32, ConnCount: 2}, {PrefixLength: 24, ConnCount: 3}},
+			[]ConnLimitPerSubnet{{PrefixLength: 64, ConnCount: 1}},
+		),
+		WithAllowlistedMultiaddrs([]multiaddr.Multiaddr{multiaddr.StringCast("/ip4/5.5.5.5")}),
+	)
+	require.NoError(t, err)
+	defer rm.Close()
+
+	open := func(addr string, dir network.Direction) (network.ConnManagementScope, error) {
+		return rm.OpenConnection(dir, true, multiaddr.StringCast(addr))
+	}
+	mustOpen := func(addr string) network.ConnManagementScope {
+		c, err := open(addr, network.DirInbound)
+		require.NoError(t, err)
+		return c
+	}
+
+	c1 := mustOpen("/ip4/1.2.3.4/tcp/1")
+	mustOpen("/ip4/1.2.3.4/tcp/2")
+	// per address limit
+	_, err = open("/ip4/1.2.3.4/tcp/3", network.DirInbound)
+	require.True(t, errors.Is(err, network.ErrResourceLimitExceeded))
+	// outbound connections aren't limited
+	_, err = open("/ip4/1.2.3.4/tcp/3", network.DirOutbound)
+	require.NoError(t, err)
+
+	// per subnet limit
+	mustOpen("/ip4/1.2.3.5/tcp/1")
+	_, err = open("/ip4/1.2.3.6/tcp/1", network.DirInbound)
+	require.Error(t, err)
+	mustOpen("/ip4/1.2.4.6/tcp/1")
+
+	// closing a connection frees up the subnet
+	c1.Done()
+	c1.Done()
+	c2 := mustOpen("/ip4/1.2.3.6/tcp/1")
+	_, err = open("/ip4/1.2.3.4/tcp/4", network.DirInbound)
+	require.Error(t, err)
+	c2.Done()
+
+	// IPv6 addresses are limited by their /64
+	mustOpen("/ip6/2001:db8::1/tcp/1")
+	_, err = open("/ip6/2001:db8::2/tcp/1", network.DirInbound)
+	require.Error(t, err)
+	mustOpen("/ip6/2001:db8:0:1::1/tcp/1")
+
+	// allowlisted and loopback addresses aren't limited
+	for i := 0; i < 5; i++ {
+		mustOpen("/ip4/5.5.5.5/tcp/1")
+		mustOpen("/ip4/127.0.0.1/tcp/1")
+	}
+
+	_, err = NewResourceManager(NewFixedLimiter(InfiniteLimits), WithConnLimitsPerSubnet([]ConnLimitPerSubnet{{PrefixLength: 33, ConnCount: 1}}, nil))
+	require.Error(t, err)
+}
@@ -0,0 +1,64 @@
+package rcmgr
+
+import (
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/event"
+
+	"github.com/multiformats/go-multiaddr"
+)
+
+// rcmgrEvents holds the emitters used to report changes of the resource manager.
+type rcmgrEvents struct {
+	limitsUpdated, allowlistUpdated event.Emitter
+}
+
+func (ev *rcmgrEvents) close() {
+	for _, em := range []event.Emitter{ev.limitsUpdated, ev.allowlistUpdated} {
+		if em != nil {
+			em.Close()
+		}
+	}
+}
+
+// EmitEvents makes the resource manager emit an event.EvtResourceLimitsUpdated on bus
+// whenever its limits are changed at runtime, and an event.EvtAllowlistUpdated
+// whenever its allowlist changes. It can only be called once.
+func (r *resourceManager) EmitEvents(bus event.Bus) error {
+	ev := &rcmgrEvents{}
+	for _, e := range []struct {
+		em  *event.Emitter
+		evt interface{}
+	}{
+		{&ev.limitsUpdated, new(event.EvtResourceLimitsUpdated)},
+		{&ev.allowlistUpdated, new(event.EvtAllowlistUpdated)},
+	} {
+		em, err := bus.Emitter(e.evt)
+		if err != nil {
+			ev.close()
+			return err
+		}
+		*e.em = em
+	}
+	if !r.events.CompareAndSwap(nil, ev) {
+		ev.close()
+		return errors.New("resource manager is already emitting events")
+	}
+	return nil
+}
+
+// emitAllowlistUpdated is called by the allowlist whenever an entry changes.
+func (r *resourceManager) emitAllowlistUpdated(added, removed multiaddr.Multiaddr) {
+	ev := r.events.Load()
+	if ev == nil {
+		return
+	}
+	evt := event.EvtAllowlistUpdated{}
+	if added != nil {
+		evt.Added = []multiaddr.Multiaddr{added}
+	}
+	if removed != nil {
+		evt.Removed = []multiaddr.Multiaddr{removed}
+	}
+	ev.allowlistUpdated.Emit(evt)
+}
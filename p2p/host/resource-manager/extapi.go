@@ -2,6 +2,7 @@ package rcmgr
 
 import (
 	"bytes"
+	"math"
 	"sort"
 	"strings"
 
@@ -145,3 +146,123 @@ func (r *resourceManager) Stat() (result ResourceManagerStat) {
 
 	return result
 }
+
+// ScopeUsage is the current usage of the resources of a scope, together with its
+// limits.
+type ScopeUsage struct {
+	network.ScopeStat
+	Limit BaseLimit
+}
+
+// Resources returns the usage of each resource of the scope, with its limit.
+// Unlimited resources have a limit of math.MaxInt or math.MaxInt64.
+func (u ScopeUsage) Resources() []ResourceUsage {
+	return []ResourceUsage{
+		{"memory", u.Memory, u.Limit.Memory},
+		{"fd", int64(u.NumFD), int64(u.Limit.FD)},
+		{"conns", int64(u.NumConnsInbound + u.NumConnsOutbound), int64(u.Limit.Conns)},
+		{"conns_inbound", int64(u.NumConnsInbound), int64(u.Limit.ConnsInbound)},
+		{"conns_outbound", int64(u.NumConnsOutbound), int64(u.Limit.ConnsOutbound)},
+		{"streams", int64(u.NumStreamsInbound + u.NumStreamsOutbound), int64(u.Limit.Streams)},
+		{"streams_inbound", int64(u.NumStreamsInbound), int64(u.Limit.StreamsInbound)},
+		{"streams_outbound", int64(u.NumStreamsOutbound), int64(u.Limit.StreamsOutbound)},
+	}
+}
+
+// ResourceUsage is the usage of a single resource of a scope.
+type ResourceUsage struct {
+	Resource string
+	Used     int64
+	Limit    int64
+}
+
+// IsUnlimited returns true if the resource isn't limited.
+func (u ResourceUsage) IsUnlimited() bool {
+	return u.Limit >= math.MaxInt
+}
+
+// Utilization returns the fraction of the limit that is used, which is 0 for
+// unlimited resources and 1 for resources that are blocked entirely.
+func (u ResourceUsage) Utilization() float64 {
+	switch {
+	case u.IsUnlimited():
+		return 0
+	case u.Limit <= 0:
+		return 1
+	}
+	return float64(u.Used) / float64(u.Limit)
+}
+
+// ResourceManagerUsage is the usage of the system, transient, service, protocol and
+// peer scopes of a resource manager.
+type ResourceManagerUsage struct {
+	System    ScopeUsage
+	Transient ScopeUsage
+	Services  map[string]ScopeUsage
+	Protocols map[protocol.ID]ScopeUsage
+	Peers     map[peer.ID]ScopeUsage
+}
+
+// ResourceManagerUsageViewer is a trait that allows you to query the usage of the
+// resource manager relative to its limits, to find out how close it is to blocking.
+type ResourceManagerUsageViewer interface {
+	Usage() ResourceManagerUsage
+}
+
+var _ ResourceManagerUsageViewer = (*resourceManager)(nil)
+
+// toBaseLimit returns the values of l.
+func toBaseLimit(l Limit) BaseLimit {
+	return BaseLimit{
+		Streams:         l.GetStreamTotalLimit(),
+		StreamsInbound:  l.GetStreamLimit(network.DirInbound),
+		StreamsOutbound: l.GetStreamLimit(network.DirOutbound),
+		Conns:           l.GetConnTotalLimit(),
+		ConnsInbound:    l.GetConnLimit(network.DirInbound),
+		ConnsOutbound:   l.GetConnLimit(network.DirOutbound),
+		FD:              l.GetFDLimit(),
+		Memory:          l.GetMemoryLimit(),
+	}
+}
+
+func (s *resourceScope) usage() ScopeUsage {
+	s.Lock()
+	defer s.Unlock()
+
+	return ScopeUsage{ScopeStat: s.rc.stat(), Limit: toBaseLimit(s.rc.limit)}
+}
+
+func (r *resourceManager) Usage() (result ResourceManagerUsage) {
+	r.mx.Lock()
+	svcs := make([]*serviceScope, 0, len(r.svc))
+	for _, svc := range r.svc {
+		svcs = append(svcs, svc)
+	}
+	protos := make([]*protocolScope, 0, len(r.proto))
+	for _, proto := range r.proto {
+		protos = append(protos, proto)
+	}
+	peers := make([]*peerScope, 0, len(r.peer))
+	for _, peer := range r.peer {
+		peers = append(peers, peer)
+	}
+	r.mx.Unlock()
+
+	// like Stat, this takes the usage of the system scope last
+	result.Peers = make(map[peer.ID]ScopeUsage, len(peers))
+	for _, peer := range peers {
+		result.Peers[peer.peer] = peer.usage()
+	}
+	result.Protocols = make(map[protocol.ID]ScopeUsage, len(protos))
+	for _, proto := range protos {
+		result.Protocols[proto.proto] = proto.usage()
+	}
+	result.Services = make(map[string]ScopeUsage, len(svcs))
+	for _, svc := range svcs {
+		result.Services[svc.service] = svc.usage()
+	}
+	result.Transient = r.transient.usage()
+	result.System = r.system.usage()
+
+	return result
+}
@@ -0,0 +1,57 @@
+package rcmgr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsage(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	limits := PartialLimitConfig{
+		System:      ResourceLimits{StreamsInbound: 10},
+		PeerDefault: ResourceLimits{StreamsInbound: 4, Memory: 1024},
+	}.Build(InfiniteLimits)
+	mgr, err := NewResourceManager(NewFixedLimiter(limits))
+	require.NoError(t, err)
+	defer mgr.Close()
+
+	conn, err := mgr.OpenConnection(network.DirInbound, true, ma.StringCast("/ip4/1.2.3.4/tcp/1"))
+	require.NoError(t, err)
+	defer conn.Done()
+	require.NoError(t, conn.SetPeer(p))
+	str, err := mgr.OpenStream(p, network.DirInbound)
+	require.NoError(t, err)
+	defer str.Done()
+	require.NoError(t, str.SetProtocol("/test"))
+	require.NoError(t, str.ReserveMemory(256, network.ReservationPriorityAlways))
+
+	usage := mgr.(ResourceManagerUsageViewer).Usage()
+	require.Equal(t, 1, usage.System.NumStreamsInbound)
+	require.Equal(t, 10, usage.System.Limit.StreamsInbound)
+	require.Contains(t, usage.Protocols, protocol.ID("/test"))
+	require.Equal(t, 1, usage.Protocols["/test"].NumStreamsInbound)
+
+	peer := usage.Peers[p]
+	require.Equal(t, 1, peer.NumConnsInbound)
+	for _, r := range peer.Resources() {
+		switch r.Resource {
+		case "streams_inbound":
+			require.Equal(t, ResourceUsage{Resource: "streams_inbound", Used: 1, Limit: 4}, r)
+			require.Equal(t, 0.25, r.Utilization())
+		case "memory":
+			require.Equal(t, int64(256), r.Used)
+			require.Equal(t, 0.25, r.Utilization())
+		case "conns_inbound":
+			require.True(t, r.IsUnlimited())
+			require.Equal(t, int64(math.MaxInt), r.Limit)
+			require.Zero(t, r.Utilization())
+		}
+	}
+}
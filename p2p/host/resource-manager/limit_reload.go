@@ -0,0 +1,130 @@
+package rcmgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/internal/filewatch"
+)
+
+// LimitsDecoder decodes limit overrides from a config file.
+type LimitsDecoder func(io.Reader) (PartialLimitConfig, error)
+
+// decodeLimitsJSON decodes limit overrides in the format of PartialLimitConfig's JSON
+// encoding.
+func decodeLimitsJSON(in io.Reader) (PartialLimitConfig, error) {
+	var cfg PartialLimitConfig
+	err := json.NewDecoder(in).Decode(&cfg)
+	return cfg, err
+}
+
+// LimitReloader applies the limit overrides from a config file to a resource manager,
+// and applies them again whenever the file changes or the process receives a SIGHUP,
+// so that limits can be changed without restarting the node.
+//
+// The overrides apply on top of the limits the resource manager had when the
+// LimitReloader was created, so removing an override from the file restores the
+// original limit. If the file can't be read or contains invalid limits, the previous
+// limits are kept.
+type LimitReloader struct {
+	path    string
+	updater LimitUpdater
+	base    ConcreteLimitConfig
+	decode  LimitsDecoder
+	signals bool
+
+	mx sync.Mutex
+
+	watcher *filewatch.Watcher
+}
+
+// LimitReloaderOption is an option for NewLimitReloader.
+type LimitReloaderOption func(*LimitReloader) error
+
+// WithLimitsDecoder sets the decoder of the config file, e.g. to read TOML instead of
+// JSON, which is the default.
+func WithLimitsDecoder(dec LimitsDecoder) LimitReloaderOption {
+	return func(r *LimitReloader) error {
+		r.decode = dec
+		return nil
+	}
+}
+
+// WithReloadOnSignal sets whether the limits are reloaded when the process receives a
+// SIGHUP, which is enabled by default.
+func WithReloadOnSignal(enable bool) LimitReloaderOption {
+	return func(r *LimitReloader) error {
+		r.signals = enable
+		return nil
+	}
+}
+
+// NewLimitReloader applies the limit overrides from the config file at path to rm,
+// and starts watching the file for changes. rm must implement LimitUpdater.
+func NewLimitReloader(rm network.ResourceManager, path string, opts ...LimitReloaderOption) (*LimitReloader, error) {
+	updater, ok := rm.(LimitUpdater)
+	if !ok {
+		return nil, errors.New("resource manager doesn't support updating limits")
+	}
+	base, err := updater.Limits()
+	if err != nil {
+		return nil, err
+	}
+	r := &LimitReloader{
+		path:    path,
+		updater: updater,
+		base:    base,
+		decode:  decodeLimitsJSON,
+		signals: true,
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	r.watcher, err = filewatch.New(path, r.signals, r.reloadChanged)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the config file and applies its limit overrides.
+func (r *LimitReloader) Reload() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	overrides, err := r.decode(f)
+	if err != nil {
+		return fmt.Errorf("failed to decode limits from %s: %w", r.path, err)
+	}
+	return r.updater.SetLimits(overrides.Build(r.base))
+}
+
+// reloadChanged reloads the config file after it changed.
+func (r *LimitReloader) reloadChanged() {
+	if err := r.Reload(); err != nil {
+		log.Errorw("failed to reload limits", "path", r.path, "error", err)
+		return
+	}
+	log.Infow("reloaded limits", "path", r.path)
+}
+
+// Close stops watching the config file. The limits stay as they are.
+func (r *LimitReloader) Close() error {
+	return r.watcher.Close()
+}
@@ -0,0 +1,54 @@
+package rcmgr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitReloader(t *testing.T) {
+	limits := DefaultLimits.AutoScale()
+	rm, err := NewResourceManager(NewFixedLimiter(limits))
+	require.NoError(t, err)
+	defer rm.Close()
+
+	systemConns := func() int {
+		var conns int
+		require.NoError(t, rm.ViewSystem(func(s network.ResourceScope) error {
+			conns = s.(ResourceScopeLimiter).Limit().GetConnTotalLimit()
+			return nil
+		}))
+		return conns
+	}
+
+	path := filepath.Join(t.TempDir(), "limits.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"System": {"Conns": 42}}`), 0o644))
+	r, err := NewLimitReloader(rm, path, WithReloadOnSignal(false))
+	require.NoError(t, err)
+	defer r.Close()
+	require.Equal(t, 42, systemConns())
+
+	// the limits are reloaded when the file is replaced
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, []byte(`{"System": {"Conns": 23}}`), 0o644))
+	require.NoError(t, os.Rename(tmp, path))
+	require.Eventually(t, func() bool { return systemConns() == 23 }, 5*time.Second, 10*time.Millisecond)
+
+	// invalid files keep the limits
+	require.NoError(t, os.WriteFile(path, []byte(`{"System": {"Conns": -3}}`), 0o644))
+	require.Error(t, r.Reload())
+	require.Equal(t, 23, systemConns())
+
+	// removing an override restores the original limit
+	require.NoError(t, os.WriteFile(path, []byte(`{}`), 0o644))
+	require.NoError(t, r.Reload())
+	require.Equal(t, limits.system.Conns, systemConns())
+
+	_, err = NewLimitReloader(rm, filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
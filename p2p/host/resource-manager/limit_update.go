@@ -0,0 +1,218 @@
+package rcmgr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// LimitUpdater is a trait interface that allows you to change the limits of a running
+// resource manager. It is implemented by the resource manager returned by
+// NewResourceManager, if its limiter was created with NewFixedLimiter or
+// NewLimiterFromJSON.
+//
+// The new limits apply to the existing system, transient, service, protocol and peer
+// scopes right away, and to connection and stream scopes once they are opened. Scopes
+// whose limits didn't change keep the limits set with ResourceScopeLimiter.
+type LimitUpdater interface {
+	// Limits returns the current limits.
+	Limits() (ConcreteLimitConfig, error)
+	// SetLimits replaces the limits with cfg.
+	SetLimits(cfg ConcreteLimitConfig) error
+	// UpdateLimits changes the limits defined in update, and keeps the current value
+	// of the others.
+	UpdateLimits(update PartialLimitConfig) error
+}
+
+var _ LimitUpdater = (*resourceManager)(nil)
+
+var errLimiterNotUpdatable = errors.New("limits can only be updated with a fixed limiter")
+
+// validate checks that l doesn't contain negative limits.
+func (l BaseLimit) validate() error {
+	for _, v := range []struct {
+		name  string
+		value int64
+	}{
+		{"streams", int64(l.Streams)},
+		{"inbound streams", int64(l.StreamsInbound)},
+		{"outbound streams", int64(l.StreamsOutbound)},
+		{"conns", int64(l.Conns)},
+		{"inbound conns", int64(l.ConnsInbound)},
+		{"outbound conns", int64(l.ConnsOutbound)},
+		{"fds", int64(l.FD)},
+		{"memory", l.Memory},
+	} {
+		if v.value < 0 {
+			return fmt.Errorf("negative %s limit: %d", v.name, v.value)
+		}
+	}
+	return nil
+}
+
+func validateLimitMap[K comparable](kind string, m map[K]BaseLimit) error {
+	for k, l := range m {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("invalid %s limit for %v: %w", kind, k, err)
+		}
+	}
+	return nil
+}
+
+// validate checks that none of the limits of cfg are negative.
+func (cfg *ConcreteLimitConfig) validate() error {
+	for _, l := range []struct {
+		name  string
+		limit BaseLimit
+	}{
+		{"system", cfg.system},
+		{"transient", cfg.transient},
+		{"allowlisted system", cfg.allowlistedSystem},
+		{"allowlisted transient", cfg.allowlistedTransient},
+		{"default service", cfg.serviceDefault},
+		{"default service peer", cfg.servicePeerDefault},
+		{"default protocol", cfg.protocolDefault},
+		{"default protocol peer", cfg.protocolPeerDefault},
+		{"default peer", cfg.peerDefault},
+		{"conn", cfg.conn},
+		{"stream", cfg.stream},
+	} {
+		if err := l.limit.validate(); err != nil {
+			return fmt.Errorf("invalid %s limit: %w", l.name, err)
+		}
+	}
+	if err := validateLimitMap("service", cfg.service); err != nil {
+		return err
+	}
+	if err := validateLimitMap("service peer", cfg.servicePeer); err != nil {
+		return err
+	}
+	if err := validateLimitMap("protocol", cfg.protocol); err != nil {
+		return err
+	}
+	if err := validateLimitMap("protocol peer", cfg.protocolPeer); err != nil {
+		return err
+	}
+	return validateLimitMap("peer", cfg.peer)
+}
+
+// limitsEqual returns true if a and b define the same limits.
+func limitsEqual(a, b Limit) bool {
+	return a.GetMemoryLimit() == b.GetMemoryLimit() &&
+		a.GetStreamTotalLimit() == b.GetStreamTotalLimit() &&
+		a.GetStreamLimit(network.DirInbound) == b.GetStreamLimit(network.DirInbound) &&
+		a.GetStreamLimit(network.DirOutbound) == b.GetStreamLimit(network.DirOutbound) &&
+		a.GetConnTotalLimit() == b.GetConnTotalLimit() &&
+		a.GetConnLimit(network.DirInbound) == b.GetConnLimit(network.DirInbound) &&
+		a.GetConnLimit(network.DirOutbound) == b.GetConnLimit(network.DirOutbound) &&
+		a.GetFDLimit() == b.GetFDLimit()
+}
+
+func (r *resourceManager) limiter() Limiter {
+	r.limitsMx.RLock()
+	defer r.limitsMx.RUnlock()
+	return r.limits
+}
+
+func (r *resourceManager) Limits() (ConcreteLimitConfig, error) {
+	l, ok := r.limiter().(*fixedLimiter)
+	if !ok {
+		return ConcreteLimitConfig{}, errLimiterNotUpdatable
+	}
+	return l.ConcreteLimitConfig, nil
+}
+
+func (r *resourceManager) SetLimits(cfg ConcreteLimitConfig) error {
+	r.updateMx.Lock()
+	defer r.updateMx.Unlock()
+
+	return r.setLimits(cfg)
+}
+
+func (r *resourceManager) UpdateLimits(update PartialLimitConfig) error {
+	r.updateMx.Lock()
+	defer r.updateMx.Unlock()
+
+	current, err := r.Limits()
+	if err != nil {
+		return err
+	}
+	return r.setLimits(update.Build(current))
+}
+
+// setLimits validates and applies cfg. The updateMx lock must be held.
+func (r *resourceManager) setLimits(cfg ConcreteLimitConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	old, ok := r.limiter().(*fixedLimiter)
+	if !ok {
+		return errLimiterNotUpdatable
+	}
+	next := &fixedLimiter{cfg}
+
+	// Scopes created from now on get the new limits, so that all scopes collected
+	// below are updated.
+	r.limitsMx.Lock()
+	r.limits = next
+	r.limitsMx.Unlock()
+
+	changed := r.applyLimits(old, next)
+	log.Infow("updated limits", "scopes", changed)
+	if ev := r.events.Load(); ev != nil {
+		ev.limitsUpdated.Emit(event.EvtResourceLimitsUpdated{Scopes: changed})
+	}
+	return nil
+}
+
+// applyLimits sets the limits of the existing scopes whose limits differ between the
+// old and the next limiter, and returns their names.
+func (r *resourceManager) applyLimits(old, next Limiter) []string {
+	type update struct {
+		scope *resourceScope
+		limit Limit
+	}
+	var updates []update
+	check := func(s *resourceScope, oldLimit, nextLimit Limit) {
+		if !limitsEqual(oldLimit, nextLimit) {
+			updates = append(updates, update{scope: s, limit: nextLimit})
+		}
+	}
+
+	check(r.system.resourceScope, old.GetSystemLimits(), next.GetSystemLimits())
+	check(r.transient.resourceScope, old.GetTransientLimits(), next.GetTransientLimits())
+	check(r.allowlistedSystem.resourceScope, old.GetAllowlistedSystemLimits(), next.GetAllowlistedSystemLimits())
+	check(r.allowlistedTransient.resourceScope, old.GetAllowlistedTransientLimits(), next.GetAllowlistedTransientLimits())
+
+	r.mx.Lock()
+	for svc, s := range r.svc {
+		check(s.resourceScope, old.GetServiceLimits(svc), next.GetServiceLimits(svc))
+		s.Lock()
+		for _, ps := range s.peers {
+			check(ps, old.GetServicePeerLimits(svc), next.GetServicePeerLimits(svc))
+		}
+		s.Unlock()
+	}
+	for proto, s := range r.proto {
+		check(s.resourceScope, old.GetProtocolLimits(proto), next.GetProtocolLimits(proto))
+		s.Lock()
+		for _, ps := range s.peers {
+			check(ps, old.GetProtocolPeerLimits(proto), next.GetProtocolPeerLimits(proto))
+		}
+		s.Unlock()
+	}
+	for p, s := range r.peer {
+		check(s.resourceScope, old.GetPeerLimits(p), next.GetPeerLimits(p))
+	}
+	r.mx.Unlock()
+
+	names := make([]string, 0, len(updates))
+	for _, u := range updates {
+		// this doesn't mark the scopes as sticky, unlike ResourceScopeLimiter.SetLimit
+		u.scope.SetLimit(u.limit)
+		names = append(names, u.scope.name)
+	}
+	return names
+}
@@ -0,0 +1,78 @@
+package rcmgr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateLimits(t *testing.T) {
+	peerA := test.RandPeerIDFatal(t)
+	peerB := test.RandPeerIDFatal(t)
+	limits := DefaultLimits.AutoScale()
+	limits.peer = map[peer.ID]BaseLimit{peerB: limits.peerDefault}
+
+	rm, err := NewResourceManager(NewFixedLimiter(limits))
+	require.NoError(t, err)
+	defer rm.Close()
+	bus := eventbus.NewBus()
+	require.NoError(t, rm.(*resourceManager).EmitEvents(bus))
+	sub, err := bus.Subscribe(new(event.EvtResourceLimitsUpdated))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	s, err := rm.OpenStream(peerA, network.DirOutbound)
+	require.NoError(t, err)
+	defer s.Done()
+	sB, err := rm.OpenStream(peerB, network.DirOutbound)
+	require.NoError(t, err)
+	defer sB.Done()
+
+	updater, ok := rm.(LimitUpdater)
+	require.True(t, ok)
+	require.NoError(t, updater.UpdateLimits(PartialLimitConfig{
+		System:      ResourceLimits{Conns: 5},
+		PeerDefault: ResourceLimits{Streams: 1},
+	}))
+
+	select {
+	case e := <-sub.Out():
+		// peerB has its own limits, which didn't change
+		require.ElementsMatch(t, []string{"system", "peer:" + peerA.String()}, e.(event.EvtResourceLimitsUpdated).Scopes)
+	case <-time.After(time.Second):
+		t.Fatal("expected a limits updated event")
+	}
+
+	require.NoError(t, rm.ViewSystem(func(s network.ResourceScope) error {
+		l := s.(ResourceScopeLimiter).Limit()
+		require.Equal(t, 5, l.GetConnTotalLimit())
+		require.Equal(t, limits.system.Streams, l.GetStreamTotalLimit())
+		return nil
+	}))
+	// the new limit applies to the existing peer scope
+	_, err = rm.OpenStream(peerA, network.DirOutbound)
+	require.Error(t, err)
+
+	current, err := updater.Limits()
+	require.NoError(t, err)
+	require.Equal(t, 1, current.peerDefault.Streams)
+	require.Equal(t, limits.peerDefault.Conns, current.peerDefault.Conns)
+
+	// invalid limits are rejected, and leave the limits unchanged
+	require.Error(t, updater.UpdateLimits(PartialLimitConfig{Transient: ResourceLimits{Memory: -5}}))
+	after, err := updater.Limits()
+	require.NoError(t, err)
+	require.Equal(t, current, after)
+
+	require.NoError(t, updater.SetLimits(limits))
+	s2, err := rm.OpenStream(peerA, network.DirOutbound)
+	require.NoError(t, err)
+	s2.Done()
+}
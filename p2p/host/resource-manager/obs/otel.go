@@ -0,0 +1,135 @@
+package obs
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OTelTraceReporter reports the trace events of the resource manager as OpenTelemetry
+// spans and span events: every resource scope is a span, which ends when the scope is
+// destroyed, and the reservations and releases of resources in a scope, including the
+// blocked ones, are events of its span. This makes resource exhaustion visible in
+// tracing pipelines.
+//
+// Use it with rcmgr.WithTraceReporter.
+type OTelTraceReporter struct {
+	tracer trace.Tracer
+
+	mx    sync.Mutex
+	spans map[string]trace.Span
+}
+
+var _ rcmgr.TraceReporter = (*OTelTraceReporter)(nil)
+
+// NewOTelTraceReporter creates a reporter that creates its spans with tracer.
+func NewOTelTraceReporter(tracer trace.Tracer) *OTelTraceReporter {
+	return &OTelTraceReporter{
+		tracer: tracer,
+		spans:  make(map[string]trace.Span),
+	}
+}
+
+// scopeClass returns the class of the scope with the given name, like "peer" or
+// "protocol-peer".
+func scopeClass(name string) string {
+	if i := strings.Index(name, ".span-"); i > -1 {
+		return scopeClass(name[:i]) + "-span"
+	}
+	switch {
+	case name == "system", name == "transient", name == "allowlistedSystem", name == "allowlistedTransient":
+		return name
+	case strings.HasPrefix(name, "conn-"):
+		return "conn"
+	case strings.HasPrefix(name, "stream-"):
+		return "stream"
+	case strings.HasPrefix(name, "peer:"):
+		return "peer"
+	case strings.HasPrefix(name, "service:"):
+		if strings.Contains(name, "peer:") {
+			return "service-peer"
+		}
+		return "service"
+	case strings.HasPrefix(name, "protocol:"):
+		if strings.Contains(name, "peer:") {
+			return "protocol-peer"
+		}
+		return "protocol"
+	}
+	return "unknown"
+}
+
+func (r *OTelTraceReporter) ConsumeEvent(evt rcmgr.TraceEvt) {
+	if evt.Name == "" {
+		return
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	switch evt.Type {
+	case rcmgr.TraceCreateScopeEvt:
+		_, span := r.tracer.Start(context.Background(), "rcmgr.scope "+scopeClass(evt.Name),
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes(
+				attribute.String("rcmgr.scope", evt.Name),
+				attribute.String("rcmgr.scope_class", scopeClass(evt.Name)),
+			),
+		)
+		r.spans[evt.Name] = span
+	case rcmgr.TraceDestroyScopeEvt:
+		if span, ok := r.spans[evt.Name]; ok {
+			span.End()
+			delete(r.spans, evt.Name)
+		}
+	default:
+		span, ok := r.spans[evt.Name]
+		if !ok {
+			return
+		}
+		span.AddEvent(string(evt.Type), trace.WithAttributes(eventAttributes(evt)...))
+		switch evt.Type {
+		case rcmgr.TraceBlockReserveMemoryEvt, rcmgr.TraceBlockAddStreamEvt, rcmgr.TraceBlockAddConnEvt:
+			// The status reflects that the scope ran out of resources at some point.
+			span.SetStatus(codes.Error, string(evt.Type))
+		}
+	}
+}
+
+func eventAttributes(evt rcmgr.TraceEvt) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 8)
+	add := func(key string, v int64) {
+		if v != 0 {
+			attrs = append(attrs, attribute.Int64(key, v))
+		}
+	}
+	add("rcmgr.priority", int64(evt.Priority))
+	add("rcmgr.delta", evt.Delta)
+	add("rcmgr.delta_in", int64(evt.DeltaIn))
+	add("rcmgr.delta_out", int64(evt.DeltaOut))
+	add("rcmgr.memory", evt.Memory)
+	add("rcmgr.streams_in", int64(evt.StreamsIn))
+	add("rcmgr.streams_out", int64(evt.StreamsOut))
+	add("rcmgr.conns_in", int64(evt.ConnsIn))
+	add("rcmgr.conns_out", int64(evt.ConnsOut))
+	add("rcmgr.fd", int64(evt.FD))
+	return attrs
+}
+
+// Close ends the spans of the scopes that weren't destroyed yet, like the system
+// scope. It should be called after closing the resource manager.
+func (r *OTelTraceReporter) Close() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	for name, span := range r.spans {
+		span.End()
+		delete(r.spans, name)
+	}
+}
@@ -0,0 +1,70 @@
+package obs_test
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/test"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/host/resource-manager/obs"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOTelTraceReporter(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	reporter := obs.NewOTelTraceReporter(tp.Tracer("rcmgr"))
+
+	limits := rcmgr.PartialLimitConfig{
+		System: rcmgr.ResourceLimits{StreamsOutbound: rcmgr.BlockAllLimit},
+	}.Build(rcmgr.DefaultLimits.AutoScale())
+	rm, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(limits), rcmgr.WithTraceReporter(reporter))
+	require.NoError(t, err)
+
+	conn, err := rm.OpenConnection(network.DirInbound, true, multiaddr.StringCast("/ip4/1.2.3.4/tcp/1234"))
+	require.NoError(t, err)
+	conn.Done()
+	_, err = rm.OpenStream(test.RandPeerIDFatal(t), network.DirOutbound)
+	require.Error(t, err)
+
+	require.NoError(t, rm.Close())
+	reporter.Close()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		for _, attr := range s.Attributes() {
+			if attr.Key == "rcmgr.scope" {
+				spans[attr.Value.AsString()] = s
+			}
+		}
+	}
+
+	// the span of the connection scope ended when the scope was done
+	connSpan, ok := spans["conn-1"]
+	require.True(t, ok)
+	require.Equal(t, "rcmgr.scope conn", connSpan.Name())
+	var events []string
+	for _, e := range connSpan.Events() {
+		events = append(events, e.Name)
+	}
+	require.Contains(t, events, string(rcmgr.TraceAddConnEvt))
+
+	// the system scope blocked the stream
+	systemSpan, ok := spans["system"]
+	require.True(t, ok)
+	require.Equal(t, codes.Error, systemSpan.Status().Code)
+	var blocked bool
+	for _, e := range systemSpan.Events() {
+		if e.Name == string(rcmgr.TraceBlockAddStreamEvt) {
+			blocked = true
+			require.Contains(t, e.Attributes, attribute.Int64("rcmgr.delta_out", 1))
+		}
+	}
+	require.True(t, blocked)
+}
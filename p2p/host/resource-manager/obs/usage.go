@@ -0,0 +1,86 @@
+package obs
+
+import (
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scopeUsageDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricNamespace, "", "scope_usage"),
+		"Current usage of a resource of a scope",
+		[]string{"scope", "name", "resource"}, nil)
+	scopeLimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricNamespace, "", "scope_limit"),
+		"Limit of a resource of a scope, omitted if the resource is unlimited",
+		[]string{"scope", "name", "resource"}, nil)
+	scopeUtilizationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricNamespace, "", "scope_utilization"),
+		"Fraction of the limit of a resource of a scope that is used. For peers, this is the highest utilization of any peer",
+		[]string{"scope", "name", "resource"}, nil)
+)
+
+// UsageCollector is a prometheus.Collector that reports the usage of the system,
+// transient, service and protocol scopes of a resource manager relative to their
+// limits, when it is scraped. To bound the cardinality, the peer scopes are not
+// reported individually, only the highest utilization of any peer is.
+type UsageCollector struct {
+	viewer rcmgr.ResourceManagerUsageViewer
+}
+
+var _ prometheus.Collector = (*UsageCollector)(nil)
+
+// NewUsageCollector returns a collector reporting the usage of viewer. It must be
+// registered with a prometheus.Registerer to be scraped.
+func NewUsageCollector(viewer rcmgr.ResourceManagerUsageViewer) *UsageCollector {
+	return &UsageCollector{viewer: viewer}
+}
+
+func (c *UsageCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- scopeUsageDesc
+	descs <- scopeLimitDesc
+	descs <- scopeUtilizationDesc
+}
+
+func (c *UsageCollector) Collect(metrics chan<- prometheus.Metric) {
+	usage := c.viewer.Usage()
+
+	collectScope(metrics, "system", "", usage.System)
+	collectScope(metrics, "transient", "", usage.Transient)
+	for svc, u := range usage.Services {
+		collectScope(metrics, "service", svc, u)
+	}
+	for proto, u := range usage.Protocols {
+		collectScope(metrics, "protocol", string(proto), u)
+	}
+
+	var peerMax []float64
+	for _, u := range usage.Peers {
+		res := u.Resources()
+		if peerMax == nil {
+			peerMax = make([]float64, len(res))
+		}
+		for i, r := range res {
+			if util := r.Utilization(); util > peerMax[i] {
+				peerMax[i] = util
+			}
+		}
+	}
+	if peerMax != nil {
+		for i, r := range (rcmgr.ScopeUsage{}).Resources() {
+			metrics <- prometheus.MustNewConstMetric(scopeUtilizationDesc, prometheus.GaugeValue, peerMax[i], "peer", "", r.Resource)
+		}
+	}
+}
+
+func collectScope(metrics chan<- prometheus.Metric, scope, name string, u rcmgr.ScopeUsage) {
+	for _, r := range u.Resources() {
+		metrics <- prometheus.MustNewConstMetric(scopeUsageDesc, prometheus.GaugeValue, float64(r.Used), scope, name, r.Resource)
+		if r.IsUnlimited() {
+			continue
+		}
+		metrics <- prometheus.MustNewConstMetric(scopeLimitDesc, prometheus.GaugeValue, float64(r.Limit), scope, name, r.Resource)
+		metrics <- prometheus.MustNewConstMetric(scopeUtilizationDesc, prometheus.GaugeValue, r.Utilization(), scope, name, r.Resource)
+	}
+}
@@ -0,0 +1,80 @@
+package obs_test
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/host/resource-manager/obs"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageCollector(t *testing.T) {
+	limits := rcmgr.PartialLimitConfig{
+		System: rcmgr.ResourceLimits{
+			Conns:         4,
+			ConnsInbound:  2,
+			ConnsOutbound: 4,
+			FD:            8,
+			Memory:        1024,
+		},
+	}.Build(rcmgr.InfiniteLimits)
+	mgr, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(limits))
+	require.NoError(t, err)
+	defer mgr.Close()
+
+	conn, err := mgr.OpenConnection(network.DirInbound, true, ma.StringCast("/ip4/1.2.3.4/tcp/1"))
+	require.NoError(t, err)
+	defer conn.Done()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(obs.NewUsageCollector(mgr.(rcmgr.ResourceManagerUsageViewer)))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	value := func(name, scope, resource string) (float64, bool) {
+		for _, f := range families {
+			if f.GetName() != name {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				if label(m, "scope") == scope && label(m, "resource") == resource {
+					return m.GetGauge().GetValue(), true
+				}
+			}
+		}
+		return 0, false
+	}
+
+	v, ok := value("libp2p_rcmgr_scope_usage", "system", "conns_inbound")
+	require.True(t, ok)
+	require.Equal(t, 1.0, v)
+	v, ok = value("libp2p_rcmgr_scope_limit", "system", "conns_inbound")
+	require.True(t, ok)
+	require.Equal(t, 2.0, v)
+	v, ok = value("libp2p_rcmgr_scope_utilization", "system", "conns_inbound")
+	require.True(t, ok)
+	require.Equal(t, 0.5, v)
+	v, ok = value("libp2p_rcmgr_scope_utilization", "system", "fd")
+	require.True(t, ok)
+	require.Equal(t, 0.125, v)
+
+	// unlimited resources have no limit
+	_, ok = value("libp2p_rcmgr_scope_usage", "transient", "conns_inbound")
+	require.True(t, ok)
+	_, ok = value("libp2p_rcmgr_scope_limit", "transient", "conns_inbound")
+	require.False(t, ok)
+}
+
+func label(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
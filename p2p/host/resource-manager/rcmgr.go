@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 
+	ds "github.com/ipfs/go-datastore"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/multiformats/go-multiaddr"
 )
@@ -18,12 +20,27 @@ import (
 var log = logging.Logger("rcmgr")
 
 type resourceManager struct {
-	limits Limiter
+	// limitsMx protects limits, which can be replaced at runtime, see LimitUpdater.
+	limitsMx sync.RWMutex
+	limits   Limiter
+	// updateMx serializes limit updates.
+	updateMx sync.Mutex
+
+	// events is set once the resource manager emits events, see EmitEvents.
+	events atomic.Pointer[rcmgrEvents]
 
 	trace   *trace
 	metrics *metrics
 
-	allowlist *Allowlist
+	allowlist      *Allowlist
+	allowlistStore ds.Datastore
+	// subnets limits the inbound connections per subnet, it is nil if disabled
+	subnets *subnetLimiter
+
+	// shedPolicy decides what to shed when a limit is hit, it is nil if disabled
+	shedPolicy ShedPolicy
+	shedMx     sync.Mutex
+	sheddable  map[*resourceScope]*shedEntry
 
 	system    *systemScope
 	transient *transientScope
@@ -102,6 +119,8 @@ type connectionScope struct {
 	rcmgr         *resourceManager
 	peer          *peerScope
 	endpoint      multiaddr.Multiaddr
+	// releaseSubnet releases the connection from the counts of the subnet limits
+	releaseSubnet func()
 }
 
 var _ network.ConnScope = (*connectionScope)(nil)
@@ -141,6 +160,13 @@ func NewResourceManager(limits Limiter, opts ...Option) (network.ResourceManager
 		}
 	}
 
+	if r.allowlistStore != nil {
+		if err := r.allowlist.load(r.allowlistStore); err != nil {
+			return nil, err
+		}
+	}
+	r.allowlist.onChange = r.emitAllowlistUpdated
+
 	if err := r.trace.Start(limits); err != nil {
 		return nil, err
 	}
@@ -214,7 +240,7 @@ func (r *resourceManager) getServiceScope(svc string) *serviceScope {
 
 	s, ok := r.svc[svc]
 	if !ok {
-		s = newServiceScope(svc, r.limits.GetServiceLimits(svc), r)
+		s = newServiceScope(svc, r.limiter().GetServiceLimits(svc), r)
 		r.svc[svc] = s
 	}
 
@@ -228,7 +254,7 @@ func (r *resourceManager) getProtocolScope(proto protocol.ID) *protocolScope {
 
 	s, ok := r.proto[proto]
 	if !ok {
-		s = newProtocolScope(proto, r.limits.GetProtocolLimits(proto), r)
+		s = newProtocolScope(proto, r.limiter().GetProtocolLimits(proto), r)
 		r.proto[proto] = s
 	}
 
@@ -252,7 +278,7 @@ func (r *resourceManager) getPeerScope(p peer.ID) *peerScope {
 
 	s, ok := r.peer[p]
 	if !ok {
-		s = newPeerScope(p, r.limits.GetPeerLimits(p), r)
+		s = newPeerScope(p, r.limiter().GetPeerLimits(p), r)
 		r.peer[p] = s
 	}
 
@@ -288,8 +314,22 @@ func (r *resourceManager) nextStreamId() int64 {
 }
 
 func (r *resourceManager) OpenConnection(dir network.Direction, usefd bool, endpoint multiaddr.Multiaddr) (network.ConnManagementScope, error) {
+	releaseSubnet := func() {}
+	if dir == network.DirInbound {
+		release, err := r.subnets.add(endpoint)
+		if err != nil {
+			if !r.allowlist.Allowed(endpoint) {
+				log.Debugw("blocked connection from subnet", "endpoint", endpoint, "error", err)
+				r.metrics.BlockConn(dir, usefd)
+				return nil, err
+			}
+		} else {
+			releaseSubnet = release
+		}
+	}
+
 	var conn *connectionScope
-	conn = newConnectionScope(dir, usefd, r.limits.GetConnLimits(), r, endpoint)
+	conn = newConnectionScope(dir, usefd, r.limiter().GetConnLimits(), r, endpoint)
 
 	err := conn.AddConn(dir, usefd)
 	if err != nil {
@@ -298,27 +338,35 @@ func (r *resourceManager) OpenConnection(dir network.Direction, usefd bool, endp
 		allowed := r.allowlist.Allowed(endpoint)
 		if allowed {
 			conn.Done()
-			conn = newAllowListedConnectionScope(dir, usefd, r.limits.GetConnLimits(), r, endpoint)
+			conn = newAllowListedConnectionScope(dir, usefd, r.limiter().GetConnLimits(), r, endpoint)
 			err = conn.AddConn(dir, usefd)
 		}
 	}
+	if err != nil && r.shed(ShedRequest{Kind: ShedConn, Direction: dir}, conn.blockingEdge(checkConn(dir, usefd)), nil) {
+		err = conn.AddConn(dir, usefd)
+	}
 
 	if err != nil {
 		conn.Done()
+		releaseSubnet()
 		r.metrics.BlockConn(dir, usefd)
 		return nil, err
 	}
 
+	conn.releaseSubnet = releaseSubnet
 	r.metrics.AllowConn(dir, usefd)
 	return conn, nil
 }
 
 func (r *resourceManager) OpenStream(p peer.ID, dir network.Direction) (network.StreamManagementScope, error) {
 	peer := r.getPeerScope(p)
-	stream := newStreamScope(dir, r.limits.GetStreamLimits(p), peer, r)
+	stream := newStreamScope(dir, r.limiter().GetStreamLimits(p), peer, r)
 	peer.DecRef() // we have the reference in edges
 
 	err := stream.AddStream(dir)
+	if err != nil && r.shed(ShedRequest{Kind: ShedStream, Direction: dir, Peer: p}, stream.blockingEdge(checkStream(dir)), nil) {
+		err = stream.AddStream(dir)
+	}
 	if err != nil {
 		stream.Done()
 		r.metrics.BlockStream(p, dir)
@@ -333,6 +381,9 @@ func (r *resourceManager) Close() error {
 	r.cancel()
 	r.wg.Wait()
 	r.trace.Close()
+	if ev := r.events.Load(); ev != nil {
+		ev.close()
+	}
 
 	return nil
 }
@@ -564,7 +615,7 @@ func (s *serviceScope) getPeerScope(p peer.ID) *resourceScope {
 		return ps
 	}
 
-	l := s.rcmgr.limits.GetServicePeerLimits(s.service)
+	l := s.rcmgr.limiter().GetServicePeerLimits(s.service)
 
 	if s.peers == nil {
 		s.peers = make(map[peer.ID]*resourceScope)
@@ -591,7 +642,7 @@ func (s *protocolScope) getPeerScope(p peer.ID) *resourceScope {
 		return ps
 	}
 
-	l := s.rcmgr.limits.GetProtocolPeerLimits(s.proto)
+	l := s.rcmgr.limiter().GetProtocolPeerLimits(s.proto)
 
 	if s.peers == nil {
 		s.peers = make(map[peer.ID]*resourceScope)
@@ -608,6 +659,14 @@ func (s *peerScope) Peer() peer.ID {
 	return s.peer
 }
 
+func (s *connectionScope) Done() {
+	s.resourceScope.Done()
+	s.rcmgr.unregisterShed(s.resourceScope)
+	if s.releaseSubnet != nil {
+		s.releaseSubnet()
+	}
+}
+
 func (s *connectionScope) PeerScope() network.PeerScope {
 	s.Lock()
 	defer s.Unlock()
@@ -735,12 +794,27 @@ func (s *streamScope) ProtocolScope() network.ProtocolScope {
 	return s.proto
 }
 
+func (s *streamScope) Done() {
+	s.resourceScope.Done()
+	s.rcmgr.unregisterShed(s.resourceScope)
+}
+
 func (s *streamScope) SetProtocol(proto protocol.ID) error {
+	blocked, err := s.setProtocol(proto)
+	if err != nil && s.rcmgr.shed(ShedRequest{Kind: ShedStream, Direction: s.dir, Peer: s.peer.peer, Protocol: proto}, blocked, s.resourceScope) {
+		_, err = s.setProtocol(proto)
+	}
+	return err
+}
+
+// setProtocol attaches the stream to proto. If a limit is hit, it returns the scope
+// whose limit was hit.
+func (s *streamScope) setProtocol(proto protocol.ID) (*resourceScope, error) {
 	s.Lock()
 	defer s.Unlock()
 
 	if s.proto != nil {
-		return fmt.Errorf("stream scope already attached to a protocol")
+		return nil, fmt.Errorf("stream scope already attached to a protocol")
 	}
 
 	s.proto = s.rcmgr.getProtocolScope(proto)
@@ -748,21 +822,23 @@ func (s *streamScope) SetProtocol(proto protocol.ID) error {
 	// juggle resources from transient scope to protocol scope
 	stat := s.resourceScope.rc.stat()
 	if err := s.proto.ReserveForChild(stat); err != nil {
+		blocked := s.proto.resourceScope
 		s.proto.DecRef()
 		s.proto = nil
 		s.rcmgr.metrics.BlockProtocol(proto)
-		return err
+		return blocked, err
 	}
 
 	s.peerProtoScope = s.proto.getPeerScope(s.peer.peer)
 	if err := s.peerProtoScope.ReserveForChild(stat); err != nil {
+		blocked := s.peerProtoScope
 		s.proto.ReleaseForChild(stat)
 		s.proto.DecRef()
 		s.proto = nil
 		s.peerProtoScope.DecRef()
 		s.peerProtoScope = nil
 		s.rcmgr.metrics.BlockProtocolPeer(proto, s.peer.peer)
-		return err
+		return blocked, err
 	}
 
 	s.rcmgr.transient.ReleaseForChild(stat)
@@ -778,7 +854,7 @@ func (s *streamScope) SetProtocol(proto protocol.ID) error {
 	s.resourceScope.edges = edges
 
 	s.rcmgr.metrics.AllowProtocol(proto)
-	return nil
+	return nil, nil
 }
 
 func (s *streamScope) ServiceScope() network.ServiceScope {
@@ -0,0 +1,301 @@
+package rcmgr
+
+import (
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// ShedKind is the kind of resource that can be shed.
+type ShedKind int
+
+const (
+	// ShedStream is a stream.
+	ShedStream ShedKind = iota
+	// ShedConn is a connection.
+	ShedConn
+)
+
+func (k ShedKind) String() string {
+	switch k {
+	case ShedStream:
+		return "stream"
+	case ShedConn:
+		return "connection"
+	default:
+		return "unknown"
+	}
+}
+
+// ShedRequest describes a stream or connection that was blocked by a limit.
+type ShedRequest struct {
+	Kind ShedKind
+	// Scope is the name of the scope whose limit was hit.
+	Scope     string
+	Direction network.Direction
+	// Peer is the remote peer, it is empty for connections.
+	Peer peer.ID
+	// Protocol is the protocol of the stream, it is empty before the protocol is
+	// negotiated.
+	Protocol protocol.ID
+}
+
+// ShedCandidate is an existing stream or connection that can be shed to make room
+// for a blocked request.
+type ShedCandidate struct {
+	Kind      ShedKind
+	Direction network.Direction
+	// Peer is the remote peer, it is empty for connections that aren't attached to
+	// a peer yet.
+	Peer peer.ID
+	// Protocol is the protocol of a stream, it is empty if it isn't negotiated yet.
+	Protocol protocol.ID
+	// Opened is when the stream or connection was registered for shedding.
+	Opened time.Time
+	Stat   network.ScopeStat
+
+	entry *shedEntry
+}
+
+// ShedPolicy decides which existing streams or connections to close when a limit is
+// hit, instead of only rejecting the new request.
+type ShedPolicy interface {
+	// Select returns the candidates to close to make room for req. The candidates
+	// are all of the same kind as req and use the scope whose limit was hit.
+	// Returning no candidates rejects req.
+	Select(req ShedRequest, candidates []ShedCandidate) []ShedCandidate
+}
+
+// ShedPolicyFunc adapts a function to a ShedPolicy.
+type ShedPolicyFunc func(req ShedRequest, candidates []ShedCandidate) []ShedCandidate
+
+func (f ShedPolicyFunc) Select(req ShedRequest, candidates []ShedCandidate) []ShedCandidate {
+	return f(req, candidates)
+}
+
+// WithShedPolicy sets the policy deciding which streams or connections to shed when
+// a stream or connection is blocked by a limit. Shedding requires the network to
+// register the streams and connections it can close, which the swarm does.
+func WithShedPolicy(policy ShedPolicy) Option {
+	return func(r *resourceManager) error {
+		r.shedPolicy = policy
+		return nil
+	}
+}
+
+// PriorityShedPolicy is a ShedPolicy that sheds the candidate with the lowest
+// priority, if it is lower than the priority of the blocked request. The priority of
+// a stream or connection is the sum of the priority of its protocol and of its peer.
+type PriorityShedPolicy struct {
+	// Protocols maps protocols to their priority. Other protocols, and streams that
+	// haven't negotiated a protocol yet, have priority 0.
+	Protocols map[protocol.ID]int
+	// PeerPriority returns the priority of a peer, e.g. derived from the tags of the
+	// connection manager. If nil, or if the peer isn't known, the priority is 0.
+	PeerPriority func(peer.ID) int
+	// OldestFirst sheds the oldest candidate of those with the lowest priority
+	// instead of the newest.
+	OldestFirst bool
+}
+
+var _ ShedPolicy = (*PriorityShedPolicy)(nil)
+
+func (p *PriorityShedPolicy) priority(pid peer.ID, proto protocol.ID) int {
+	prio := p.Protocols[proto]
+	if p.PeerPriority != nil && pid != "" {
+		prio += p.PeerPriority(pid)
+	}
+	return prio
+}
+
+func (p *PriorityShedPolicy) Select(req ShedRequest, candidates []ShedCandidate) []ShedCandidate {
+	reqPrio := p.priority(req.Peer, req.Protocol)
+	prios := make([]int, len(candidates))
+	for i, c := range candidates {
+		prios[i] = p.priority(c.Peer, c.Protocol)
+	}
+	best := -1
+	for i, c := range candidates {
+		if prios[i] >= reqPrio {
+			continue
+		}
+		if best < 0 || prios[i] < prios[best] {
+			best = i
+			continue
+		}
+		if prios[i] == prios[best] && c.Opened.Before(candidates[best].Opened) == p.OldestFirst {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	return candidates[best : best+1]
+}
+
+// shedEntry is a stream or connection that can be shed.
+type shedEntry struct {
+	kind   ShedKind
+	stream *streamScope
+	conn   *connectionScope
+	opened time.Time
+	shed   func()
+}
+
+func (e *shedEntry) scope() *resourceScope {
+	if e.stream != nil {
+		return e.stream.resourceScope
+	}
+	return e.conn.resourceScope
+}
+
+// candidate returns e as a candidate, if it uses blocked.
+func (e *shedEntry) candidate(blocked *resourceScope) (ShedCandidate, bool) {
+	s := e.scope()
+	s.Lock()
+	defer s.Unlock()
+
+	if s.done {
+		return ShedCandidate{}, false
+	}
+	uses := false
+	for _, edge := range s.edges {
+		if edge == blocked {
+			uses = true
+			break
+		}
+	}
+	if !uses {
+		return ShedCandidate{}, false
+	}
+
+	c := ShedCandidate{Kind: e.kind, Opened: e.opened, Stat: s.rc.stat(), entry: e}
+	if e.stream != nil {
+		c.Direction = e.stream.dir
+		c.Peer = e.stream.peer.peer
+		if e.stream.proto != nil {
+			c.Protocol = e.stream.proto.proto
+		}
+	} else {
+		c.Direction = e.conn.dir
+		if e.conn.peer != nil {
+			c.Peer = e.conn.peer.peer
+		}
+	}
+	return c, true
+}
+
+func (r *resourceManager) registerShed(e *shedEntry) {
+	r.shedMx.Lock()
+	defer r.shedMx.Unlock()
+
+	if r.sheddable == nil {
+		r.sheddable = make(map[*resourceScope]*shedEntry)
+	}
+	r.sheddable[e.scope()] = e
+}
+
+func (r *resourceManager) unregisterShed(s *resourceScope) {
+	r.shedMx.Lock()
+	defer r.shedMx.Unlock()
+
+	delete(r.sheddable, s)
+}
+
+// SetShedFunc registers the stream for shedding; shed is called to close it if the
+// shed policy selects it.
+func (s *streamScope) SetShedFunc(shed func()) {
+	if s.rcmgr.shedPolicy == nil {
+		return
+	}
+	s.rcmgr.registerShed(&shedEntry{kind: ShedStream, stream: s, opened: time.Now(), shed: shed})
+}
+
+// SetShedFunc registers the connection for shedding; shed is called to close it if
+// the shed policy selects it.
+func (s *connectionScope) SetShedFunc(shed func()) {
+	if s.rcmgr.shedPolicy == nil {
+		return
+	}
+	s.rcmgr.registerShed(&shedEntry{kind: ShedConn, conn: s, opened: time.Now(), shed: shed})
+}
+
+// blockingEdge returns the first edge of s for which check fails, or nil if there
+// is none, e.g. because resources were released in the meantime.
+func (s *resourceScope) blockingEdge(check func(rc *resources) error) *resourceScope {
+	s.Lock()
+	edges := s.edges
+	s.Unlock()
+
+	for _, e := range edges {
+		e.Lock()
+		err := check(&e.rc)
+		e.Unlock()
+		if err != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func checkStream(dir network.Direction) func(rc *resources) error {
+	return func(rc *resources) error {
+		if err := rc.addStream(dir); err != nil {
+			return err
+		}
+		rc.removeStream(dir)
+		return nil
+	}
+}
+
+func checkConn(dir network.Direction, usefd bool) func(rc *resources) error {
+	return func(rc *resources) error {
+		if err := rc.addConn(dir, usefd); err != nil {
+			return err
+		}
+		rc.removeConn(dir, usefd)
+		return nil
+	}
+}
+
+// shed asks the shed policy which of the streams or connections of kind req.Kind
+// using blocked to close to make room for req, other than self, and closes them. It
+// returns true if anything was shed, in which case req should be retried.
+func (r *resourceManager) shed(req ShedRequest, blocked, self *resourceScope) bool {
+	if r.shedPolicy == nil || blocked == nil {
+		return false
+	}
+	req.Scope = blocked.name
+
+	r.shedMx.Lock()
+	entries := make([]*shedEntry, 0, len(r.sheddable))
+	for s, e := range r.sheddable {
+		if e.kind == req.Kind && s != self {
+			entries = append(entries, e)
+		}
+	}
+	r.shedMx.Unlock()
+
+	candidates := make([]ShedCandidate, 0, len(entries))
+	for _, e := range entries {
+		if c, ok := e.candidate(blocked); ok {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return false
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Opened.Before(candidates[j].Opened) })
+
+	selected := r.shedPolicy.Select(req, candidates)
+	for _, c := range selected {
+		log.Debugw("shedding to make room for blocked request", "kind", c.Kind, "scope", req.Scope,
+			"peer", c.Peer, "protocol", c.Protocol, "blocked_peer", req.Peer, "blocked_protocol", req.Protocol)
+		r.unregisterShed(c.entry.scope())
+		c.entry.shed()
+	}
+	return len(selected) > 0
+}
@@ -0,0 +1,168 @@
+package rcmgr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityShedPolicy(t *testing.T) {
+	low, high := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	policy := &PriorityShedPolicy{
+		Protocols: map[protocol.ID]int{"/low": -1, "/high": 1},
+		PeerPriority: func(p peer.ID) int {
+			if p == high {
+				return 10
+			}
+			return 0
+		},
+	}
+	now := time.Now()
+	candidates := []ShedCandidate{
+		{Peer: low, Protocol: "/low", Opened: now},
+		{Peer: low, Protocol: "/low", Opened: now.Add(time.Second)},
+		{Peer: low, Protocol: "/high", Opened: now},
+		{Peer: high, Protocol: "/low", Opened: now},
+	}
+
+	// the newest of the candidates with the lowest priority is shed
+	require.Equal(t, candidates[1:2], policy.Select(ShedRequest{Peer: low}, candidates))
+	policy.OldestFirst = true
+	require.Equal(t, candidates[0:1], policy.Select(ShedRequest{Peer: low}, candidates))
+	// nothing is shed for requests with a priority that isn't higher
+	require.Empty(t, policy.Select(ShedRequest{Peer: low, Protocol: "/low"}, candidates))
+	require.Empty(t, policy.Select(ShedRequest{Peer: low}, candidates[2:]))
+}
+
+func TestShedStreams(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	limits := PartialLimitConfig{
+		System:   ResourceLimits{StreamsInbound: 2},
+		Protocol: map[protocol.ID]ResourceLimits{"/limited": {StreamsInbound: 1}},
+	}.Build(InfiniteLimits)
+	rm, err := NewResourceManager(NewFixedLimiter(limits), WithShedPolicy(&PriorityShedPolicy{
+		Protocols: map[protocol.ID]int{"/low": -1, "/limited": -1, "/high": 1},
+	}))
+	require.NoError(t, err)
+	defer rm.Close()
+
+	var shed []protocol.ID
+	open := func(proto protocol.ID) (network.StreamManagementScope, error) {
+		s, err := rm.OpenStream(p, network.DirInbound)
+		if err != nil {
+			return nil, err
+		}
+		s.(interface{ SetShedFunc(func()) }).SetShedFunc(func() {
+			shed = append(shed, proto)
+			s.Done()
+		})
+		if err := s.SetProtocol(proto); err != nil {
+			s.Done()
+			return nil, err
+		}
+		return s, nil
+	}
+
+	s1, err := open("/low")
+	require.NoError(t, err)
+	defer s1.Done()
+	s2, err := open("/high")
+	require.NoError(t, err)
+	defer s2.Done()
+
+	// the stream with the lower priority is shed to make room
+	s3, err := open("/limited")
+	require.NoError(t, err)
+	defer s3.Done()
+	require.Equal(t, []protocol.ID{"/low"}, shed)
+
+	// streams that haven't negotiated a protocol yet have the default priority
+	s4, err := rm.OpenStream(p, network.DirInbound)
+	require.NoError(t, err)
+	defer s4.Done()
+	require.Equal(t, []protocol.ID{"/low", "/limited"}, shed)
+
+	// streams with a priority that isn't higher than that of the others are rejected
+	_, err = rm.OpenStream(p, network.DirInbound)
+	require.Error(t, err)
+	require.Equal(t, []protocol.ID{"/low", "/limited"}, shed)
+}
+
+func TestShedStreamsOnProtocolLimit(t *testing.T) {
+	p1, p2 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	limits := PartialLimitConfig{
+		Protocol: map[protocol.ID]ResourceLimits{"/proto": {StreamsInbound: 1}},
+	}.Build(InfiniteLimits)
+	rm, err := NewResourceManager(NewFixedLimiter(limits), WithShedPolicy(&PriorityShedPolicy{
+		PeerPriority: func(p peer.ID) int {
+			if p == p2 {
+				return 1
+			}
+			return 0
+		},
+	}))
+	require.NoError(t, err)
+	defer rm.Close()
+
+	shed := make(map[peer.ID]bool)
+	open := func(p peer.ID) network.StreamManagementScope {
+		s, err := rm.OpenStream(p, network.DirInbound)
+		require.NoError(t, err)
+		s.(interface{ SetShedFunc(func()) }).SetShedFunc(func() {
+			shed[p] = true
+			s.Done()
+		})
+		return s
+	}
+
+	s1 := open(p1)
+	defer s1.Done()
+	require.NoError(t, s1.SetProtocol("/proto"))
+	s2 := open(p2)
+	defer s2.Done()
+	require.NoError(t, s2.SetProtocol("/proto"))
+	require.Equal(t, map[peer.ID]bool{p1: true}, shed)
+
+	s3 := open(p1)
+	defer s3.Done()
+	require.Error(t, s3.SetProtocol("/proto"))
+}
+
+func TestShedConns(t *testing.T) {
+	limits := PartialLimitConfig{
+		System: ResourceLimits{ConnsInbound: 1},
+	}.Build(InfiniteLimits)
+	rm, err := NewResourceManager(NewFixedLimiter(limits), WithShedPolicy(ShedPolicyFunc(
+		func(req ShedRequest, candidates []ShedCandidate) []ShedCandidate {
+			require.Equal(t, ShedConn, req.Kind)
+			require.Equal(t, "system", req.Scope)
+			return candidates
+		})))
+	require.NoError(t, err)
+	defer rm.Close()
+
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	c1, err := rm.OpenConnection(network.DirInbound, true, addr)
+	require.NoError(t, err)
+	var shed bool
+	c1.(interface{ SetShedFunc(func()) }).SetShedFunc(func() {
+		shed = true
+		c1.Done()
+	})
+
+	c2, err := rm.OpenConnection(network.DirInbound, true, addr)
+	require.NoError(t, err)
+	defer c2.Done()
+	require.True(t, shed)
+
+	// c2 isn't registered for shedding
+	_, err = rm.OpenConnection(network.DirInbound, true, addr)
+	require.Error(t, err)
+}
@@ -56,7 +56,7 @@ func (rh *RoutedHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
 
 	// if we were given some addresses, keep + use them.
 	if len(pi.Addrs) > 0 {
-		rh.Peerstore().AddAddrs(pi.ID, pi.Addrs, peerstore.TempAddrTTL)
+		peerstore.AddAddrsWithSource(rh.Peerstore(), pi.ID, pi.Addrs, peerstore.TempAddrTTL, peerstore.AddrSourceManual)
 	}
 
 	// Check if we have some addresses in our recent memory.
@@ -96,18 +96,16 @@ func (rh *RoutedHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
 			continue
 		}
 
-		relayAddrs, err := rh.findPeerAddrs(ctx, relayID)
-		if err != nil {
+		if _, err := rh.findPeerAddrs(ctx, relayID); err != nil {
 			log.Debugf("failed to find relay %s: %s", relay, err)
 			continue
 		}
-
-		rh.Peerstore().AddAddrs(relayID, relayAddrs, peerstore.TempAddrTTL)
 	}
 
-	// if we're here, we got some addrs. let's use our wrapped host to connect.
-	pi.Addrs = addrs
-	if cerr := rh.host.Connect(ctx, pi); cerr != nil {
+	// if we're here, we got some addrs, and they're all in the peerstore. let's use our
+	// wrapped host to connect. Don't pass the addrs on, so that the addrs found using
+	// the routing system aren't recorded as manually provided ones.
+	if cerr := rh.host.Connect(ctx, peer.AddrInfo{ID: pi.ID}); cerr != nil {
 		// We couldn't connect. Let's check if we have the most
 		// up-to-date addresses for the given peer. If there
 		// are addresses we didn't know about previously, we
@@ -132,8 +130,7 @@ func (rh *RoutedHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
 				continue
 			}
 
-			pi.Addrs = newAddrs
-			return rh.host.Connect(ctx, pi)
+			return rh.host.Connect(ctx, peer.AddrInfo{ID: pi.ID})
 		}
 		// No appropriate new address found.
 		// Return the original dial error.
@@ -158,9 +155,16 @@ func (rh *RoutedHost) findPeerAddrs(ctx context.Context, id peer.ID) ([]ma.Multi
 		return nil, err
 	}
 
+	// record that we learned these addresses from the routing system
+	peerstore.AddAddrsWithSource(rh.Peerstore(), id, pi.Addrs, peerstore.TempAddrTTL, peerstore.AddrSourceDHT)
 	return pi.Addrs, nil
 }
 
+// Unwrap returns the wrapped host.
+func (rh *RoutedHost) Unwrap() host.Host {
+	return rh.host
+}
+
 func (rh *RoutedHost) ID() peer.ID {
 	return rh.host.ID()
 }
@@ -0,0 +1,96 @@
+// Package filewatch watches config files, so that they can be reloaded without
+// restarting the node.
+package filewatch
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("filewatch")
+
+// Watcher calls a function whenever a file is written or replaced, and optionally
+// whenever the process receives a SIGHUP.
+type Watcher struct {
+	path     string
+	onChange func()
+
+	watcher *fsnotify.Watcher
+	sigs    chan os.Signal
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New starts watching the file at path, calling onChange, from a background
+// goroutine, whenever it changes. If signals is true, onChange is also called when
+// the process receives a SIGHUP.
+func New(path string, signals bool, onChange func()) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the directory rather than the file, as editors and config management tools
+	// usually replace files instead of writing to them.
+	if err := fw.Add(filepath.Dir(path)); err != nil {
+		fw.Close()
+		return nil, err
+	}
+	w := &Watcher{
+		path:     path,
+		onChange: onChange,
+		watcher:  fw,
+		done:     make(chan struct{}),
+	}
+	if signals {
+		w.sigs = make(chan os.Signal, 1)
+		signal.Notify(w.sigs, syscall.SIGHUP)
+	}
+
+	w.wg.Add(1)
+	go w.background()
+	return w, nil
+}
+
+func (w *Watcher) background() {
+	defer w.wg.Done()
+
+	name := filepath.Clean(w.path)
+	for {
+		select {
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != name || ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warnw("error watching file", "path", w.path, "error", err)
+			continue
+		case <-w.sigs:
+		case <-w.done:
+			return
+		}
+		w.onChange()
+	}
+}
+
+// Close stops watching the file. It waits for a running onChange call to return.
+func (w *Watcher) Close() error {
+	if w.sigs != nil {
+		signal.Stop(w.sigs)
+	}
+	close(w.done)
+	err := w.watcher.Close()
+	w.wg.Wait()
+	return err
+}
@@ -0,0 +1,53 @@
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(path, []byte("foo"), 0o644))
+
+	changes := make(chan struct{}, 10)
+	w, err := New(path, false, func() { changes <- struct{}{} })
+	require.NoError(t, err)
+
+	expectChange := func() {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a change")
+		}
+	}
+
+	// writing the file
+	require.NoError(t, os.WriteFile(path, []byte("bar"), 0o644))
+	expectChange()
+
+	// replacing the file
+	tmp := filepath.Join(dir, "config.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("baz"), 0o644))
+	for len(changes) > 0 {
+		<-changes
+	}
+	require.NoError(t, os.Rename(tmp, path))
+	expectChange()
+
+	require.NoError(t, w.Close())
+	for len(changes) > 0 {
+		<-changes
+	}
+	require.NoError(t, os.WriteFile(path, []byte("qux"), 0o644))
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, changes)
+
+	_, err = New(filepath.Join(dir, "missing", "config"), false, func() {})
+	require.Error(t, err)
+}
@@ -0,0 +1,184 @@
+// Package peermatch matches peers by peer ID, IP subnet and ASN, for the access
+// control lists of the connection gaters and the relay.
+package peermatch
+
+import (
+	"net"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	asnutil "github.com/libp2p/go-libp2p-asn-util"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Match is what a Set matches. Exactly one of Peer, Subnet and ASN is set.
+type Match struct {
+	Peer   peer.ID
+	Subnet *net.IPNet
+	// ASN is the decimal number of an autonomous system.
+	ASN string
+}
+
+// Set is a set of peer IDs, IP subnets and ASNs. It's not safe for concurrent use.
+type Set struct {
+	peers   map[peer.ID]struct{}
+	subnets map[string]*net.IPNet
+	asns    map[string]struct{}
+}
+
+// NewSet creates an empty Set.
+func NewSet() *Set {
+	return &Set{
+		peers:   make(map[peer.ID]struct{}),
+		subnets: make(map[string]*net.IPNet),
+		asns:    make(map[string]struct{}),
+	}
+}
+
+// normalizeSubnet returns ipnet with its host bits cleared, so that equal subnets
+// have the same text form.
+func normalizeSubnet(ipnet *net.IPNet) *net.IPNet {
+	return &net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}
+}
+
+// Add adds m to the set.
+func (s *Set) Add(m Match) {
+	switch {
+	case m.Peer != "":
+		s.peers[m.Peer] = struct{}{}
+	case m.Subnet != nil:
+		ipnet := normalizeSubnet(m.Subnet)
+		s.subnets[ipnet.String()] = ipnet
+	case m.ASN != "":
+		s.asns[m.ASN] = struct{}{}
+	}
+}
+
+// Remove removes m from the set.
+func (s *Set) Remove(m Match) {
+	switch {
+	case m.Peer != "":
+		delete(s.peers, m.Peer)
+	case m.Subnet != nil:
+		delete(s.subnets, normalizeSubnet(m.Subnet).String())
+	case m.ASN != "":
+		delete(s.asns, m.ASN)
+	}
+}
+
+// Contains returns true if m was added to the set.
+func (s *Set) Contains(m Match) bool {
+	var ok bool
+	switch {
+	case m.Peer != "":
+		_, ok = s.peers[m.Peer]
+	case m.Subnet != nil:
+		_, ok = s.subnets[normalizeSubnet(m.Subnet).String()]
+	case m.ASN != "":
+		_, ok = s.asns[m.ASN]
+	}
+	return ok
+}
+
+// Empty returns true if nothing was added to the set.
+func (s *Set) Empty() bool {
+	return len(s.peers) == 0 && len(s.subnets) == 0 && len(s.asns) == 0
+}
+
+// All returns everything that was added to the set, in no particular order.
+func (s *Set) All() []Match {
+	all := make([]Match, 0, len(s.peers)+len(s.subnets)+len(s.asns))
+	for p := range s.peers {
+		all = append(all, Match{Peer: p})
+	}
+	for _, ipnet := range s.subnets {
+		all = append(all, Match{Subnet: ipnet})
+	}
+	for asn := range s.asns {
+		all = append(all, Match{ASN: asn})
+	}
+	return all
+}
+
+// MatchPeer returns the match of p, if any.
+func (s *Set) MatchPeer(p peer.ID) (Match, bool) {
+	if _, ok := s.peers[p]; ok {
+		return Match{Peer: p}, true
+	}
+	return Match{}, false
+}
+
+// MatchIP returns a match of ip, or of asn if it's not empty, if any.
+func (s *Set) MatchIP(ip net.IP, asn string) (Match, bool) {
+	if ip == nil {
+		return Match{}, false
+	}
+	for _, ipnet := range s.subnets {
+		if ipnet.Contains(ip) {
+			return Match{Subnet: ipnet}, true
+		}
+	}
+	if _, ok := s.asns[asn]; asn != "" && ok {
+		return Match{ASN: asn}, true
+	}
+	return Match{}, false
+}
+
+// Lists are the allow and deny lists of an access control list. A peer is denied if
+// its peer ID, IP address or ASN is denied. Otherwise, if the allow list isn't empty,
+// the peer must match it. ASNs are only known for IPv6 addresses, so ASNs don't match
+// IPv4 addresses.
+type Lists struct {
+	Allow, Deny *Set
+}
+
+// NewLists creates empty allow and deny lists, which allow all peers.
+func NewLists() Lists {
+	return Lists{Allow: NewSet(), Deny: NewSet()}
+}
+
+// Remote returns the IP address of a, and its ASN if any of the lists has ASNs and
+// it's an IPv6 address.
+func (l Lists) Remote(a ma.Multiaddr) (net.IP, string) {
+	if a == nil {
+		return nil, ""
+	}
+	ip, err := manet.ToIP(a)
+	if err != nil {
+		return nil, ""
+	}
+	var asn string
+	if ip.To4() == nil && (len(l.Allow.asns) > 0 || len(l.Deny.asns) > 0) {
+		asn, _ = asnutil.Store.AsnForIPv6(ip)
+	}
+	return ip, asn
+}
+
+// DeniedAddr returns the match in the deny list of a, if any.
+func (l Lists) DeniedAddr(a ma.Multiaddr) (Match, bool) {
+	return l.Deny.MatchIP(l.Remote(a))
+}
+
+// Denied checks p at a against the lists. If p is denied, it returns true and the match
+// in the deny list, which is the zero Match if p is denied because it doesn't match the
+// allow list.
+func (l Lists) Denied(p peer.ID, a ma.Multiaddr) (Match, bool) {
+	ip, asn := l.Remote(a)
+	if m, ok := l.Deny.MatchPeer(p); ok {
+		return m, true
+	}
+	if m, ok := l.Deny.MatchIP(ip, asn); ok {
+		return m, true
+	}
+	if l.Allow.Empty() {
+		return Match{}, false
+	}
+	if _, ok := l.Allow.MatchPeer(p); ok {
+		return Match{}, false
+	}
+	if _, ok := l.Allow.MatchIP(ip, asn); ok {
+		return Match{}, false
+	}
+	return Match{}, true
+}
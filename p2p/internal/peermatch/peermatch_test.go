@@ -0,0 +1,83 @@
+package peermatch
+
+import (
+	"net"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseSubnet(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, ipnet, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return ipnet
+}
+
+func TestSet(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	s := NewSet()
+	require.True(t, s.Empty())
+
+	s.Add(Match{Peer: p})
+	s.Add(Match{Subnet: &net.IPNet{IP: net.ParseIP("1.2.3.4"), Mask: net.CIDRMask(24, 32)}})
+	s.Add(Match{ASN: "13335"})
+	require.False(t, s.Empty())
+	require.Len(t, s.All(), 3)
+
+	// subnets are normalized
+	require.True(t, s.Contains(Match{Subnet: mustParseSubnet(t, "1.2.3.0/24")}))
+	m, ok := s.MatchIP(net.ParseIP("1.2.3.100"), "")
+	require.True(t, ok)
+	require.Equal(t, "1.2.3.0/24", m.Subnet.String())
+	_, ok = s.MatchIP(net.ParseIP("1.2.4.1"), "")
+	require.False(t, ok)
+
+	m, ok = s.MatchIP(net.ParseIP("2001:db8::1"), "13335")
+	require.True(t, ok)
+	require.Equal(t, Match{ASN: "13335"}, m)
+	m, ok = s.MatchPeer(p)
+	require.True(t, ok)
+	require.Equal(t, Match{Peer: p}, m)
+
+	s.Remove(Match{Subnet: mustParseSubnet(t, "1.2.3.0/24")})
+	s.Remove(Match{Peer: p})
+	s.Remove(Match{ASN: "13335"})
+	require.True(t, s.Empty())
+}
+
+func TestLists(t *testing.T) {
+	allowed := test.RandPeerIDFatal(t)
+	denied := test.RandPeerIDFatal(t)
+	other := test.RandPeerIDFatal(t)
+	l := NewLists()
+
+	// everything is allowed by default
+	_, ok := l.Denied(other, ma.StringCast("/ip4/1.2.3.4/tcp/1"))
+	require.False(t, ok)
+
+	l.Deny.Add(Match{Peer: denied})
+	l.Deny.Add(Match{Subnet: mustParseSubnet(t, "1.2.3.0/24")})
+	m, ok := l.Denied(denied, ma.StringCast("/ip4/5.6.7.8/tcp/1"))
+	require.True(t, ok)
+	require.Equal(t, Match{Peer: denied}, m)
+	m, ok = l.DeniedAddr(ma.StringCast("/ip4/1.2.3.4/tcp/1"))
+	require.True(t, ok)
+	require.Equal(t, "1.2.3.0/24", m.Subnet.String())
+	_, ok = l.Denied(other, ma.StringCast("/ip4/5.6.7.8/tcp/1"))
+	require.False(t, ok)
+
+	// once there is an allow list, peers must match it
+	l.Allow.Add(Match{Peer: allowed})
+	_, ok = l.Denied(allowed, ma.StringCast("/ip4/5.6.7.8/tcp/1"))
+	require.False(t, ok)
+	m, ok = l.Denied(other, ma.StringCast("/ip4/5.6.7.8/tcp/1"))
+	require.True(t, ok)
+	require.Equal(t, Match{}, m)
+	// deny rules take precedence
+	_, ok = l.Denied(allowed, ma.StringCast("/ip4/1.2.3.4/tcp/1"))
+	require.True(t, ok)
+}
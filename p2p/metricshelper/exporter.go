@@ -0,0 +1,13 @@
+package metricshelper
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Exporter exports the metrics recorded by the metrics tracers to a metrics backend,
+// for deployments that don't scrape Prometheus. The metrics tracers record their
+// metrics with Prometheus collectors, so an Exporter reads them from the registry
+// they are registered with, and converts them for its backend.
+type Exporter interface {
+	// Export starts exporting the metrics gathered by g. It's called once, when the
+	// host is constructed.
+	Export(g prometheus.Gatherer) error
+}
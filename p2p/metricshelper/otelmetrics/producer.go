@@ -0,0 +1,184 @@
+// Package otelmetrics exports the metrics of the libp2p metrics tracers through
+// OpenTelemetry, for deployments using OTLP instead of scraping Prometheus.
+//
+// It's a separate module, so that hosts that don't export to OpenTelemetry don't
+// depend on the OpenTelemetry metrics SDK.
+//
+// The metrics tracers of all subsystems record their metrics with Prometheus
+// collectors. A Producer reads these collectors in process, from the registry they are
+// registered with, and converts them into OpenTelemetry metrics whenever the
+// OpenTelemetry reader it is registered with collects.
+package otelmetrics
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// ScopeName is the name of the instrumentation scope of the produced metrics.
+const ScopeName = "github.com/libp2p/go-libp2p"
+
+// Producer converts the metrics gathered from Prometheus collectors into
+// OpenTelemetry metrics. Register it with an OpenTelemetry reader, see
+// sdkmetric.Reader.RegisterProducer.
+type Producer struct {
+	gatherer prometheus.Gatherer
+	start    time.Time
+}
+
+var _ sdkmetric.Producer = (*Producer)(nil)
+
+// NewProducer creates a Producer for the metrics gathered by g, typically the
+// registry passed to the metrics tracers with WithRegisterer.
+func NewProducer(g prometheus.Gatherer) *Producer {
+	return &Producer{gatherer: g, start: time.Now()}
+}
+
+// Produce converts the gathered counters, gauges and histograms. Counters become
+// cumulative sums, and histograms cumulative histograms. Summaries aren't used by the
+// metrics tracers, and are skipped.
+func (p *Producer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	families, err := p.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return nil, err
+	}
+	now := time.Now()
+	metrics := make([]metricdata.Metrics, 0, len(families))
+	for _, mf := range families {
+		var data metricdata.Aggregation
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			data = p.sum(mf, now)
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			data = p.gauge(mf, now)
+		case dto.MetricType_HISTOGRAM:
+			data = p.histogram(mf, now)
+		default:
+			continue
+		}
+		metrics = append(metrics, metricdata.Metrics{
+			Name:        mf.GetName(),
+			Description: mf.GetHelp(),
+			Data:        data,
+		})
+	}
+	// a partial result is still exported, along with the error
+	return []metricdata.ScopeMetrics{{
+		Scope:   instrumentation.Scope{Name: ScopeName},
+		Metrics: metrics,
+	}}, err
+}
+
+func attributes(m *dto.Metric) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		kvs = append(kvs, attribute.String(l.GetName(), l.GetValue()))
+	}
+	return attribute.NewSet(kvs...)
+}
+
+func (p *Producer) sum(mf *dto.MetricFamily, now time.Time) metricdata.Sum[float64] {
+	points := make([]metricdata.DataPoint[float64], 0, len(mf.GetMetric()))
+	for _, m := range mf.GetMetric() {
+		points = append(points, metricdata.DataPoint[float64]{
+			Attributes: attributes(m),
+			StartTime:  p.start,
+			Time:       now,
+			Value:      m.GetCounter().GetValue(),
+		})
+	}
+	return metricdata.Sum[float64]{
+		DataPoints:  points,
+		Temporality: metricdata.CumulativeTemporality,
+		IsMonotonic: true,
+	}
+}
+
+func (p *Producer) gauge(mf *dto.MetricFamily, now time.Time) metricdata.Gauge[float64] {
+	points := make([]metricdata.DataPoint[float64], 0, len(mf.GetMetric()))
+	for _, m := range mf.GetMetric() {
+		v := m.GetGauge().GetValue()
+		if mf.GetType() == dto.MetricType_UNTYPED {
+			v = m.GetUntyped().GetValue()
+		}
+		points = append(points, metricdata.DataPoint[float64]{
+			Attributes: attributes(m),
+			StartTime:  p.start,
+			Time:       now,
+			Value:      v,
+		})
+	}
+	return metricdata.Gauge[float64]{DataPoints: points}
+}
+
+func (p *Producer) histogram(mf *dto.MetricFamily, now time.Time) metricdata.Histogram {
+	points := make([]metricdata.HistogramDataPoint, 0, len(mf.GetMetric()))
+	for _, m := range mf.GetMetric() {
+		h := m.GetHistogram()
+		buckets := h.GetBucket()
+		bounds := make([]float64, 0, len(buckets))
+		counts := make([]uint64, 0, len(buckets)+1)
+		// Prometheus buckets are cumulative, OpenTelemetry buckets aren't. The last
+		// OpenTelemetry bucket counts the values above the highest bound.
+		var prev uint64
+		for _, b := range buckets {
+			if math.IsInf(b.GetUpperBound(), 1) {
+				continue
+			}
+			bounds = append(bounds, b.GetUpperBound())
+			counts = append(counts, b.GetCumulativeCount()-prev)
+			prev = b.GetCumulativeCount()
+		}
+		counts = append(counts, h.GetSampleCount()-prev)
+		points = append(points, metricdata.HistogramDataPoint{
+			Attributes:   attributes(m),
+			StartTime:    p.start,
+			Time:         now,
+			Count:        h.GetSampleCount(),
+			Bounds:       bounds,
+			BucketCounts: counts,
+			Sum:          h.GetSampleSum(),
+		})
+	}
+	return metricdata.Histogram{
+		DataPoints:  points,
+		Temporality: metricdata.CumulativeTemporality,
+	}
+}
+
+// Exporter registers a Producer with an OpenTelemetry reader, e.g. a periodic reader
+// with an OTLP exporter, so that the metrics are collected along with the
+// OpenTelemetry metrics. The metrics keep their Prometheus names. Pass it to the host
+// with libp2p.MetricsExporter.
+type Exporter struct {
+	reader sdkmetric.Reader
+}
+
+var _ metricshelper.Exporter = (*Exporter)(nil)
+
+// NewExporter creates an Exporter for reader. The reader must be registered with a
+// MeterProvider to collect.
+func NewExporter(reader sdkmetric.Reader) *Exporter {
+	return &Exporter{reader: reader}
+}
+
+// Export registers a Producer for the metrics gathered by g with the reader.
+func (e *Exporter) Export(g prometheus.Gatherer) error {
+	if e.reader == nil {
+		return errors.New("OpenTelemetry reader cannot be nil")
+	}
+	e.reader.RegisterProducer(NewProducer(g))
+	return nil
+}
@@ -0,0 +1,78 @@
+package otelmetrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestProducer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: "a counter"}, []string{"dir"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Buckets: []float64{1, 2}})
+	reg.MustRegister(counter, gauge, hist)
+
+	counter.WithLabelValues("inbound").Add(3)
+	gauge.Set(5)
+	for _, v := range []float64{0.5, 1.5, 1.8, 10} {
+		hist.Observe(v)
+	}
+
+	reader := sdkmetric.NewManualReader()
+	reader.RegisterProducer(NewProducer(reg))
+	sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Equal(t, ScopeName, rm.ScopeMetrics[0].Scope.Name)
+
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m.Data
+	}
+	require.Len(t, metrics, 3)
+
+	sum := metrics["test_total"].(metricdata.Sum[float64])
+	require.True(t, sum.IsMonotonic)
+	require.Equal(t, metricdata.CumulativeTemporality, sum.Temporality)
+	require.Len(t, sum.DataPoints, 1)
+	require.Equal(t, 3.0, sum.DataPoints[0].Value)
+	require.Equal(t, attribute.NewSet(attribute.String("dir", "inbound")), sum.DataPoints[0].Attributes)
+
+	g := metrics["test_gauge"].(metricdata.Gauge[float64])
+	require.Equal(t, 5.0, g.DataPoints[0].Value)
+
+	h := metrics["test_seconds"].(metricdata.Histogram)
+	require.Len(t, h.DataPoints, 1)
+	dp := h.DataPoints[0]
+	require.Equal(t, uint64(4), dp.Count)
+	require.Equal(t, []float64{1, 2}, dp.Bounds)
+	require.Equal(t, []uint64{1, 2, 1}, dp.BucketCounts)
+	require.InDelta(t, 13.8, dp.Sum, 1e-9)
+}
+
+func TestExporter(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	h, err := libp2p.New(libp2p.NoListenAddrs, libp2p.MetricsExporter(NewExporter(reader)))
+	require.NoError(t, err)
+	defer h.Close()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	var names []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names = append(names, m.Name)
+		}
+	}
+	require.Contains(t, names, "libp2p_eventbus_subscribers_total")
+}
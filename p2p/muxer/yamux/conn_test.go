@@ -0,0 +1,67 @@
+package yamux
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func newPeerScope(t *testing.T) network.PeerScope {
+	t.Helper()
+	mgr, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(rcmgr.InfiniteLimits))
+	require.NoError(t, err)
+	t.Cleanup(func() { mgr.Close() })
+	scope, err := mgr.OpenConnection(network.DirInbound, false, ma.StringCast("/ip4/127.0.0.1/tcp/1234"))
+	require.NoError(t, err)
+	t.Cleanup(scope.Done)
+	require.NoError(t, scope.SetPeer(peer.ID("peer")))
+	return scope.PeerScope()
+}
+
+// The receive windows of the streams are reserved in the peer scope while they grow,
+// and released once the streams are closed.
+func TestStreamWindowMemory(t *testing.T) {
+	scope := newPeerScope(t)
+	c1, c2 := net.Pipe()
+	server, err := DefaultTransport.NewConn(c1, true, scope)
+	require.NoError(t, err)
+	defer server.Close()
+	client, err := DefaultTransport.NewConn(c2, false, nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	const size = 4 << 20
+	done := make(chan error, 1)
+	go func() {
+		str, err := client.OpenStream(context.Background())
+		if err != nil {
+			done <- err
+			return
+		}
+		_, err = str.Write(make([]byte, size))
+		str.Close()
+		done <- err
+	}()
+
+	str, err := server.AcceptStream()
+	require.NoError(t, err)
+	require.NotZero(t, scope.Stat().Memory)
+	n, err := io.Copy(io.Discard, str)
+	require.NoError(t, err)
+	require.Equal(t, int64(size), n)
+	require.NoError(t, <-done)
+	// the window grew with the throughput of the stream
+	require.Greater(t, scope.Stat().Memory, int64(256<<10))
+
+	require.NoError(t, str.Close())
+	require.Eventually(t, func() bool { return scope.Stat().Memory == 0 }, time.Second, 10*time.Millisecond)
+}
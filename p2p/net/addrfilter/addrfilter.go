@@ -0,0 +1,338 @@
+// Package addrfilter implements address filters that can be updated while the host is
+// running.
+//
+// Filters deny or allow IP subnets. They gate the connections the host dials and
+// accepts, and the addresses it advertises. When the filters change, the host closes
+// its connections to addresses that are now denied and advertises its new address
+// set to its peers.
+package addrfilter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Filters is a set of IP subnets that are denied or allowed. The rule that was added
+// last wins if several rules match an address. Addresses that don't match any rule
+// are allowed, unless the default action is set to deny.
+//
+// Filters is safe for concurrent use.
+type Filters struct {
+	mx      sync.RWMutex
+	filters *ma.Filters
+	emitter event.Emitter
+}
+
+// New creates empty Filters that allow all addresses.
+func New() *Filters {
+	return &Filters{filters: ma.NewFilters()}
+}
+
+// EmitEvents makes the filters emit an event.EvtAddrFiltersUpdated on bus whenever
+// they change. It can only be called once.
+func (f *Filters) EmitEvents(bus event.Bus) error {
+	em, err := bus.Emitter(new(event.EvtAddrFiltersUpdated))
+	if err != nil {
+		return err
+	}
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	if f.emitter != nil {
+		em.Close()
+		return errors.New("address filters are already emitting events")
+	}
+	f.emitter = em
+	return nil
+}
+
+// Deny denies the addresses in the subnets.
+func (f *Filters) Deny(subnets ...net.IPNet) error {
+	return f.add(ma.ActionDeny, subnets)
+}
+
+// Allow allows the addresses in the subnets, overriding previous rules denying them.
+func (f *Filters) Allow(subnets ...net.IPNet) error {
+	return f.add(ma.ActionAccept, subnets)
+}
+
+func (f *Filters) add(action ma.Action, subnets []net.IPNet) error {
+	addrs := make([]ma.Multiaddr, 0, len(subnets))
+	for _, s := range subnets {
+		a, err := subnetToMultiaddr(s)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, a)
+	}
+
+	f.mx.Lock()
+	for _, s := range subnets {
+		// remove the previous rule, so that this one becomes the last one
+		f.filters.RemoveLiteral(s)
+		f.filters.AddFilter(s, action)
+	}
+	evt := event.EvtAddrFiltersUpdated{DefaultDeny: f.filters.DefaultAction == ma.ActionDeny}
+	f.mx.Unlock()
+
+	if action == ma.ActionDeny {
+		evt.Denied = addrs
+	} else {
+		evt.Allowed = addrs
+	}
+	f.emit(evt)
+	return nil
+}
+
+// Remove removes the rules for the subnets. It returns the number of rules removed.
+func (f *Filters) Remove(subnets ...net.IPNet) int {
+	f.mx.Lock()
+	var removed []ma.Multiaddr
+	for _, s := range subnets {
+		if !f.filters.RemoveLiteral(s) {
+			continue
+		}
+		if a, err := subnetToMultiaddr(s); err == nil {
+			removed = append(removed, a)
+		}
+	}
+	defaultDeny := f.filters.DefaultAction == ma.ActionDeny
+	f.mx.Unlock()
+
+	if len(removed) > 0 {
+		f.emit(event.EvtAddrFiltersUpdated{Removed: removed, DefaultDeny: defaultDeny})
+	}
+	return len(removed)
+}
+
+// Replace replaces all the rules: the subnets in deny are denied, then the subnets in
+// allow are allowed, and the addresses that match neither are denied if defaultDeny is
+// set. It emits a single event.
+func (f *Filters) Replace(deny, allow []net.IPNet, defaultDeny bool) error {
+	evt := event.EvtAddrFiltersUpdated{DefaultDeny: defaultDeny}
+	filters := ma.NewFilters()
+	if defaultDeny {
+		filters.DefaultAction = ma.ActionDeny
+	}
+	for _, s := range deny {
+		a, err := subnetToMultiaddr(s)
+		if err != nil {
+			return err
+		}
+		filters.AddFilter(s, ma.ActionDeny)
+		evt.Denied = append(evt.Denied, a)
+	}
+	for _, s := range allow {
+		a, err := subnetToMultiaddr(s)
+		if err != nil {
+			return err
+		}
+		filters.RemoveLiteral(s)
+		filters.AddFilter(s, ma.ActionAccept)
+		evt.Allowed = append(evt.Allowed, a)
+	}
+
+	f.mx.Lock()
+	old := append(f.filters.FiltersForAction(ma.ActionDeny), f.filters.FiltersForAction(ma.ActionAccept)...)
+	f.filters = filters
+	f.mx.Unlock()
+
+	for _, s := range old {
+		if a, err := subnetToMultiaddr(s); err == nil {
+			evt.Removed = append(evt.Removed, a)
+		}
+	}
+	f.emit(evt)
+	return nil
+}
+
+// SetDefaultDeny sets whether addresses that don't match any rule are denied.
+func (f *Filters) SetDefaultDeny(deny bool) {
+	action := ma.ActionAccept
+	if deny {
+		action = ma.ActionDeny
+	}
+	f.mx.Lock()
+	changed := f.filters.DefaultAction != action
+	f.filters.DefaultAction = action
+	f.mx.Unlock()
+
+	if changed {
+		f.emit(event.EvtAddrFiltersUpdated{DefaultDeny: deny})
+	}
+}
+
+// emit emits evt if EmitEvents was called. It must not be called with the lock held,
+// since subscribers may call back into the filters.
+func (f *Filters) emit(evt event.EvtAddrFiltersUpdated) {
+	f.mx.RLock()
+	em := f.emitter
+	f.mx.RUnlock()
+	if em != nil {
+		em.Emit(evt)
+	}
+}
+
+// Denied returns the denied subnets.
+func (f *Filters) Denied() []net.IPNet {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.filters.FiltersForAction(ma.ActionDeny)
+}
+
+// Allowed returns the subnets that are explicitly allowed.
+func (f *Filters) Allowed() []net.IPNet {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.filters.FiltersForAction(ma.ActionAccept)
+}
+
+// AddrBlocked reports whether a is denied. Addresses without an IP component, e.g.
+// DNS addresses, are only denied if the default action is to deny.
+func (f *Filters) AddrBlocked(a ma.Multiaddr) bool {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.filters.AddrBlocked(a)
+}
+
+// denyRule returns the rule denying a, or whether a is denied by default, if it's
+// denied.
+func (f *Filters) denyRule(a ma.Multiaddr) (rule string, denied bool) {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	if !f.filters.AddrBlocked(a) {
+		return "", false
+	}
+	// a is denied, so the last rule matching it is the last deny rule matching it
+	if ip, err := manet.ToIP(a); err == nil {
+		deny := f.filters.FiltersForAction(ma.ActionDeny)
+		for i := len(deny) - 1; i >= 0; i-- {
+			if deny[i].Contains(ip) {
+				return "deny " + deny[i].String(), true
+			}
+		}
+	}
+	return "default deny", true
+}
+
+// FilterAddrs returns the addresses that aren't denied. It can be used as an
+// AddrsFactory.
+func (f *Filters) FilterAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if !f.filters.AddrBlocked(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func subnetToMultiaddr(s net.IPNet) (ma.Multiaddr, error) {
+	ones, bits := s.Mask.Size()
+	if bits == 0 {
+		return nil, fmt.Errorf("invalid subnet mask: %s", s.Mask)
+	}
+	proto := "ip6"
+	if ip4 := s.IP.To4(); ip4 != nil && bits == 32 {
+		proto = "ip4"
+	}
+	return ma.NewMultiaddr(fmt.Sprintf("/%s/%s/ipcidr/%d", proto, s.IP, ones))
+}
+
+// Gater returns a connection gater that rejects the connections to and from denied
+// addresses, and then applies next, unless it is nil. It implements
+// connmgr.DenyReasoner: the reasons of the connections it denies itself name the
+// "addrfilter" gater and the rule denying the address, e.g. "deny 1.2.3.0/24".
+func (f *Filters) Gater(next connmgr.ConnectionGater) connmgr.ConnectionGater {
+	return &gater{filters: f, next: next}
+}
+
+type gater struct {
+	filters *Filters
+	next    connmgr.ConnectionGater
+}
+
+var (
+	_ connmgr.ConnectionGater = (*gater)(nil)
+	_ connmgr.DenyReasoner    = (*gater)(nil)
+)
+
+func (g *gater) denyAddr(a ma.Multiaddr) *connmgr.DenyReason {
+	if rule, denied := g.filters.denyRule(a); denied {
+		return &connmgr.DenyReason{Gater: "addrfilter", Rule: rule}
+	}
+	return nil
+}
+
+func (g *gater) DenyPeerDial(p peer.ID) *connmgr.DenyReason {
+	if g.next == nil {
+		return nil
+	}
+	return connmgr.GatePeerDial(g.next, p)
+}
+
+func (g *gater) DenyAddrDial(p peer.ID, a ma.Multiaddr) *connmgr.DenyReason {
+	if r := g.denyAddr(a); r != nil {
+		return r
+	}
+	if g.next == nil {
+		return nil
+	}
+	return connmgr.GateAddrDial(g.next, p, a)
+}
+
+func (g *gater) DenyAccept(addrs network.ConnMultiaddrs) *connmgr.DenyReason {
+	if r := g.denyAddr(addrs.RemoteMultiaddr()); r != nil {
+		return r
+	}
+	if g.next == nil {
+		return nil
+	}
+	return connmgr.GateAccept(g.next, addrs)
+}
+
+func (g *gater) DenySecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) *connmgr.DenyReason {
+	// the filters may have changed since the connection was accepted or dialed
+	if r := g.denyAddr(addrs.RemoteMultiaddr()); r != nil {
+		return r
+	}
+	if g.next == nil {
+		return nil
+	}
+	return connmgr.GateSecured(g.next, dir, p, addrs)
+}
+
+func (g *gater) InterceptPeerDial(p peer.ID) bool {
+	return g.DenyPeerDial(p) == nil
+}
+
+func (g *gater) InterceptAddrDial(p peer.ID, a ma.Multiaddr) bool {
+	return g.DenyAddrDial(p, a) == nil
+}
+
+func (g *gater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	return g.DenyAccept(addrs) == nil
+}
+
+func (g *gater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	return g.DenySecured(dir, p, addrs) == nil
+}
+
+func (g *gater) InterceptUpgraded(c network.Conn) (bool, control.DisconnectReason) {
+	if g.next == nil {
+		return true, 0
+	}
+	return g.next.InterceptUpgraded(c)
+}
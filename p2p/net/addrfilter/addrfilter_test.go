@@ -0,0 +1,196 @@
+package addrfilter
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseCIDR(t *testing.T, s string) net.IPNet {
+	t.Helper()
+	_, ipnet, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return *ipnet
+}
+
+func TestFilters(t *testing.T) {
+	f := New()
+	a := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	b := ma.StringCast("/ip4/1.2.4.4/udp/1234/quic-v1")
+	dns := ma.StringCast("/dns4/example.com/tcp/1234")
+	require.False(t, f.AddrBlocked(a))
+
+	require.NoError(t, f.Deny(mustParseCIDR(t, "1.2.0.0/16")))
+	require.True(t, f.AddrBlocked(a))
+	require.True(t, f.AddrBlocked(b))
+	require.False(t, f.AddrBlocked(dns))
+	require.NoError(t, f.Allow(mustParseCIDR(t, "1.2.3.0/24")))
+	require.False(t, f.AddrBlocked(a))
+	require.True(t, f.AddrBlocked(b))
+	require.Equal(t, []ma.Multiaddr{a, dns}, f.FilterAddrs([]ma.Multiaddr{a, b, dns}))
+	require.Len(t, f.Denied(), 1)
+	require.Len(t, f.Allowed(), 1)
+
+	// the last rule wins
+	require.NoError(t, f.Deny(mustParseCIDR(t, "1.2.3.0/24")))
+	require.True(t, f.AddrBlocked(a))
+	require.Len(t, f.Denied(), 2)
+	require.Empty(t, f.Allowed())
+
+	require.Equal(t, 2, f.Remove(mustParseCIDR(t, "1.2.0.0/16"), mustParseCIDR(t, "1.2.3.0/24")))
+	require.Zero(t, f.Remove(mustParseCIDR(t, "1.2.3.0/24")))
+	require.False(t, f.AddrBlocked(a))
+
+	f.SetDefaultDeny(true)
+	require.True(t, f.AddrBlocked(a))
+	require.True(t, f.AddrBlocked(dns))
+}
+
+func TestEvents(t *testing.T) {
+	bus := eventbus.NewBus()
+	sub, err := bus.Subscribe(new(event.EvtAddrFiltersUpdated))
+	require.NoError(t, err)
+	defer sub.Close()
+	f := New()
+	require.NoError(t, f.EmitEvents(bus))
+	require.Error(t, f.EmitEvents(bus))
+
+	next := func() event.EvtAddrFiltersUpdated {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			return e.(event.EvtAddrFiltersUpdated)
+		case <-time.After(time.Second):
+			t.Fatal("expected an event")
+			return event.EvtAddrFiltersUpdated{}
+		}
+	}
+
+	require.NoError(t, f.Deny(mustParseCIDR(t, "1.2.3.0/24"), mustParseCIDR(t, "2001:db8::/32")))
+	evt := next()
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.0/ipcidr/24"), ma.StringCast("/ip6/2001:db8::/ipcidr/32")}, evt.Denied)
+	require.False(t, evt.DefaultDeny)
+
+	require.NoError(t, f.Allow(mustParseCIDR(t, "1.2.3.4/32")))
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/ipcidr/32")}, next().Allowed)
+
+	f.Remove(mustParseCIDR(t, "1.2.3.0/24"))
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.0/ipcidr/24")}, next().Removed)
+
+	f.SetDefaultDeny(true)
+	require.True(t, next().DefaultDeny)
+	// no change, no event
+	f.SetDefaultDeny(true)
+	select {
+	case <-sub.Out():
+		t.Fatal("didn't expect an event")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestReplace(t *testing.T) {
+	bus := eventbus.NewBus()
+	sub, err := bus.Subscribe(new(event.EvtAddrFiltersUpdated))
+	require.NoError(t, err)
+	defer sub.Close()
+	f := New()
+	require.NoError(t, f.EmitEvents(bus))
+	a := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	b := ma.StringCast("/ip4/5.6.7.8/tcp/1234")
+
+	require.NoError(t, f.Deny(mustParseCIDR(t, "1.2.0.0/16")))
+	<-sub.Out()
+	require.NoError(t, f.Replace(
+		[]net.IPNet{mustParseCIDR(t, "5.6.0.0/16")},
+		[]net.IPNet{mustParseCIDR(t, "5.6.7.0/24")},
+		false,
+	))
+	require.False(t, f.AddrBlocked(a))
+	require.False(t, f.AddrBlocked(b))
+	require.True(t, f.AddrBlocked(ma.StringCast("/ip4/5.6.8.8/tcp/1234")))
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtAddrFiltersUpdated)
+		require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/5.6.0.0/ipcidr/16")}, evt.Denied)
+		require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/5.6.7.0/ipcidr/24")}, evt.Allowed)
+		require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/1.2.0.0/ipcidr/16")}, evt.Removed)
+	case <-time.After(time.Second):
+		t.Fatal("expected an event")
+	}
+
+	require.NoError(t, f.Replace(nil, []net.IPNet{mustParseCIDR(t, "1.2.3.0/24")}, true))
+	require.False(t, f.AddrBlocked(a))
+	require.True(t, f.AddrBlocked(b))
+	require.Empty(t, f.Denied())
+
+	require.Error(t, f.Replace([]net.IPNet{{IP: net.IPv4(1, 2, 3, 4)}}, nil, false))
+	// a failed replace doesn't change the rules
+	require.False(t, f.AddrBlocked(a))
+}
+
+type mockConnMultiaddrs struct{ remote ma.Multiaddr }
+
+func (m mockConnMultiaddrs) LocalMultiaddr() ma.Multiaddr {
+	return ma.StringCast("/ip4/127.0.0.1/tcp/1")
+}
+func (m mockConnMultiaddrs) RemoteMultiaddr() ma.Multiaddr { return m.remote }
+
+func TestGater(t *testing.T) {
+	f := New()
+	g := f.Gater(nil)
+	a := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	require.True(t, g.InterceptAddrDial("", a))
+	require.True(t, g.InterceptAccept(mockConnMultiaddrs{a}))
+
+	require.NoError(t, f.Deny(mustParseCIDR(t, "1.2.3.4/32")))
+	require.False(t, g.InterceptAddrDial("", a))
+	require.False(t, g.InterceptAccept(mockConnMultiaddrs{a}))
+	require.False(t, g.InterceptSecured(0, "", mockConnMultiaddrs{a}))
+	require.True(t, g.InterceptPeerDial(""))
+}
+
+// denyPeers is a gater denying all the peer dials.
+type denyPeers struct{}
+
+func (denyPeers) InterceptPeerDial(peer.ID) bool               { return false }
+func (denyPeers) InterceptAddrDial(peer.ID, ma.Multiaddr) bool { return true }
+func (denyPeers) InterceptAccept(network.ConnMultiaddrs) bool  { return true }
+func (denyPeers) InterceptSecured(network.Direction, peer.ID, network.ConnMultiaddrs) bool {
+	return true
+}
+func (denyPeers) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) { return true, 0 }
+
+func TestGaterDenyReason(t *testing.T) {
+	f := New()
+	g := f.Gater(denyPeers{})
+	require.NoError(t, f.Deny(mustParseCIDR(t, "1.2.0.0/16"), mustParseCIDR(t, "1.2.3.0/24")))
+	require.NoError(t, f.Allow(mustParseCIDR(t, "1.2.3.4/32")))
+
+	require.Nil(t, connmgr.GateAddrDial(g, "", ma.StringCast("/ip4/1.2.3.4/tcp/1")))
+	require.Equal(t,
+		&connmgr.DenyReason{Stage: connmgr.GatingStageAddrDial, Gater: "addrfilter", Rule: "deny 1.2.3.0/24"},
+		connmgr.GateAddrDial(g, "", ma.StringCast("/ip4/1.2.3.5/tcp/1")))
+	require.Equal(t,
+		&connmgr.DenyReason{Stage: connmgr.GatingStageAccept, Gater: "addrfilter", Rule: "deny 1.2.0.0/16"},
+		connmgr.GateAccept(g, mockConnMultiaddrs{ma.StringCast("/ip4/1.2.4.5/tcp/1")}))
+
+	f.SetDefaultDeny(true)
+	require.Equal(t,
+		&connmgr.DenyReason{Stage: connmgr.GatingStageSecured, Gater: "addrfilter", Rule: "default deny"},
+		connmgr.GateSecured(g, 0, "", mockConnMultiaddrs{ma.StringCast("/ip4/5.6.7.8/tcp/1")}))
+
+	// the reasons of the next gater are passed on
+	require.Equal(t,
+		&connmgr.DenyReason{Stage: connmgr.GatingStagePeerDial, Gater: "addrfilter.denyPeers"},
+		connmgr.GatePeerDial(g, ""))
+}
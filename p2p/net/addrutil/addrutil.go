@@ -0,0 +1,22 @@
+// Package addrutil contains helpers for the multiaddrs of the libp2p transports.
+package addrutil
+
+import ma "github.com/multiformats/go-multiaddr"
+
+// MissingCertHash reports whether a is a WebTransport or WebRTC address without the
+// certificate hashes needed to dial it. This is the case for the addresses observed
+// on connections over these transports.
+func MissingCertHash(a ma.Multiaddr) bool {
+	needsCertHash := false
+	hasCertHash := false
+	ma.ForEach(a, func(c ma.Component) bool {
+		switch c.Protocol().Code {
+		case ma.P_WEBTRANSPORT, ma.P_WEBRTC_DIRECT:
+			needsCertHash = true
+		case ma.P_CERTHASH:
+			hasCertHash = true
+		}
+		return true
+	})
+	return needsCertHash && !hasCertHash
+}
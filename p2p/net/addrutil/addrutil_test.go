@@ -0,0 +1,22 @@
+package addrutil
+
+import (
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingCertHash(t *testing.T) {
+	const certHash = "uEiDDq4_xNyDorZBH3TlGazyJdOWSwvo4PUo5YHFMrvDE8g"
+	for addr, missing := range map[string]bool{
+		"/ip4/1.2.3.4/tcp/1234":                                           false,
+		"/ip4/1.2.3.4/udp/1234/quic-v1":                                   false,
+		"/ip4/1.2.3.4/udp/1234/quic-v1/webtransport":                      true,
+		"/ip4/1.2.3.4/udp/1234/quic-v1/webtransport/certhash/" + certHash: false,
+		"/ip4/1.2.3.4/udp/1234/webrtc-direct":                             true,
+		"/ip4/1.2.3.4/udp/1234/webrtc-direct/certhash/" + certHash:        false,
+	} {
+		require.Equal(t, missing, MissingCertHash(ma.StringCast(addr)), addr)
+	}
+}
@@ -0,0 +1,176 @@
+// Package capture lets transports pass copies, or summaries, of the frames they send
+// and receive on selected connections to a hook, for a bounded duration. It is meant
+// for targeted wire-level debugging, without capturing the traffic of the whole host.
+//
+// A Capturer is shared by the transports that support capturing, see tcp.WithCapture
+// and quicreuse.EnableCapture. Capturing is disabled until a session is started:
+//
+//	c := capture.New()
+//	h, err := libp2p.New(
+//		libp2p.Transport(tcp.NewTCPTransport, tcp.WithCapture(c)),
+//		libp2p.QUICReuse(quicreuse.NewConnManager, quicreuse.EnableCapture(c)),
+//		libp2p.Transport(quic.NewTransport),
+//	)
+//	...
+//	stop, err := c.Start(capture.Session{
+//		Filter:   capture.RemoteIP(ip),
+//		Hook:     func(f capture.Frame) { log.Println(f) },
+//		Duration: time.Minute,
+//	})
+package capture
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Frame is a packet, or a chunk of a byte stream, sent or received on a connection.
+type Frame struct {
+	Time time.Time
+	// Sent is true for the frames sent to the remote, and false for the frames
+	// received from it.
+	Sent   bool
+	Local  net.Addr
+	Remote net.Addr
+	// Size is the size of the frame: the size of the packet for packet based
+	// transports, or the number of bytes read or written for stream based ones.
+	Size int
+	// Summary describes the frame, for transports that parse it. For QUIC, it is the
+	// packet type and the QUIC frames the packet contains.
+	Summary string
+	// Data is a copy of the start of the frame, up to the SnapLen of the session.
+	// Transports only set it if they see the bytes on the wire, QUIC packets are
+	// only summarized.
+	Data []byte
+}
+
+// Session configures a capture.
+type Session struct {
+	// Filter selects the connections to capture by their addresses. It is called
+	// for every frame, and must be cheap. All connections are captured if it's nil.
+	Filter func(local, remote net.Addr) bool
+	// Hook is called with the captured frames. It is called synchronously on the
+	// path of the frames, and must not block. It owns the Data of the frames.
+	Hook func(Frame)
+	// Duration bounds the capture, it must be positive.
+	Duration time.Duration
+	// SnapLen is the number of bytes of each frame copied to Frame.Data. Frames are
+	// only summarized if it is 0.
+	SnapLen int
+}
+
+// RemoteIP returns a filter selecting the connections to ip.
+func RemoteIP(ip net.IP) func(local, remote net.Addr) bool {
+	return func(_, remote net.Addr) bool {
+		switch a := remote.(type) {
+		case *net.TCPAddr:
+			return a.IP.Equal(ip)
+		case *net.UDPAddr:
+			return a.IP.Equal(ip)
+		default:
+			return false
+		}
+	}
+}
+
+type session struct {
+	Session
+	timer *time.Timer
+}
+
+// Capturer passes the frames captured by the transports to the active sessions. The
+// methods used by transports can be called on a nil Capturer, which doesn't capture
+// anything.
+type Capturer struct {
+	mx sync.Mutex
+	// sessions are the active sessions, it's replaced when a session starts or stops
+	sessions atomic.Pointer[[]*session]
+}
+
+// New creates a Capturer.
+func New() *Capturer {
+	return &Capturer{}
+}
+
+// Start starts a capture session. The session stops after its duration, or when
+// stop is called.
+func (c *Capturer) Start(s Session) (stop func(), err error) {
+	if s.Hook == nil {
+		return nil, errors.New("no hook")
+	}
+	if s.Duration <= 0 {
+		return nil, errors.New("capture duration must be positive")
+	}
+	if s.SnapLen < 0 {
+		return nil, errors.New("negative snap length")
+	}
+	sess := &session{Session: s}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	var sessions []*session
+	if old := c.sessions.Load(); old != nil {
+		sessions = append(sessions, *old...)
+	}
+	sessions = append(sessions, sess)
+	c.sessions.Store(&sessions)
+
+	var once sync.Once
+	stop = func() { once.Do(func() { c.stop(sess) }) }
+	sess.timer = time.AfterFunc(s.Duration, stop)
+	return stop, nil
+}
+
+func (c *Capturer) stop(sess *session) {
+	sess.timer.Stop()
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	old := c.sessions.Load()
+	sessions := make([]*session, 0, len(*old))
+	for _, s := range *old {
+		if s != sess {
+			sessions = append(sessions, s)
+		}
+	}
+	c.sessions.Store(&sessions)
+}
+
+// Active returns true if a session is active. Transports check it before building
+// frames.
+func (c *Capturer) Active() bool {
+	if c == nil {
+		return false
+	}
+	sessions := c.sessions.Load()
+	return sessions != nil && len(*sessions) > 0
+}
+
+// Capture passes f to the sessions that capture the connection from f.Local to
+// f.Remote. data are the bytes of the frame, if the transport sees them, they are
+// copied up to the SnapLen of each session.
+func (c *Capturer) Capture(f Frame, data []byte) {
+	if c == nil {
+		return
+	}
+	sessions := c.sessions.Load()
+	if sessions == nil {
+		return
+	}
+	for _, s := range *sessions {
+		if s.Filter != nil && !s.Filter(f.Local, f.Remote) {
+			continue
+		}
+		sf := f
+		if n := s.SnapLen; n > 0 && len(data) > 0 {
+			if n > len(data) {
+				n = len(data)
+			}
+			sf.Data = append([]byte(nil), data[:n]...)
+		}
+		s.Hook(sf)
+	}
+}
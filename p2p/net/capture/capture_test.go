@@ -0,0 +1,127 @@
+package capture
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mx     sync.Mutex
+	frames []Frame
+}
+
+func (r *recorder) hook(f Frame) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.frames = append(r.frames, f)
+}
+
+func (r *recorder) get() []Frame {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return append([]Frame(nil), r.frames...)
+}
+
+func tcpPair(t *testing.T) (manet.Conn, manet.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	done := make(chan net.Conn)
+	go func() {
+		c, _ := ln.Accept()
+		done <- c
+	}()
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	c2 := <-done
+	require.NotNil(t, c2)
+	mc1, err := manet.WrapNetConn(c1)
+	require.NoError(t, err)
+	mc2, err := manet.WrapNetConn(c2)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		mc1.Close()
+		mc2.Close()
+	})
+	return mc1, mc2
+}
+
+func TestCaptureConn(t *testing.T) {
+	c := New()
+	local, remote := tcpPair(t)
+	conn := c.WrapConn(local)
+
+	// nothing is captured without a session
+	_, err := conn.Write([]byte("foo"))
+	require.NoError(t, err)
+
+	var r recorder
+	stop, err := c.Start(Session{Hook: r.hook, Duration: time.Minute, SnapLen: 2})
+	require.NoError(t, err)
+	require.True(t, c.Active())
+	_, err = conn.Write([]byte("bar"))
+	require.NoError(t, err)
+	_, err = remote.Write([]byte("baz"))
+	require.NoError(t, err)
+	buf := make([]byte, 6)
+	_, err = io.ReadFull(remote, buf)
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, buf[:3])
+	require.NoError(t, err)
+
+	stop()
+	require.False(t, c.Active())
+	_, err = conn.Write([]byte("qux"))
+	require.NoError(t, err)
+
+	frames := r.get()
+	require.Len(t, frames, 2)
+	require.True(t, frames[0].Sent)
+	require.Equal(t, 3, frames[0].Size)
+	require.Equal(t, []byte("ba"), frames[0].Data)
+	require.Equal(t, local.LocalAddr(), frames[0].Local)
+	require.Equal(t, local.RemoteAddr(), frames[0].Remote)
+	require.False(t, frames[1].Sent)
+	require.Equal(t, []byte("ba"), frames[1].Data)
+}
+
+func TestCaptureSession(t *testing.T) {
+	var nilCapturer *Capturer
+	require.False(t, nilCapturer.Active())
+	nilCapturer.Capture(Frame{}, nil)
+
+	c := New()
+	_, err := c.Start(Session{Hook: func(Frame) {}})
+	require.Error(t, err)
+	_, err = c.Start(Session{Duration: time.Minute})
+	require.Error(t, err)
+
+	ip := net.IPv4(1, 2, 3, 4)
+	var r1, r2 recorder
+	stop, err := c.Start(Session{Hook: r1.hook, Duration: time.Minute, Filter: RemoteIP(ip)})
+	require.NoError(t, err)
+	defer stop()
+	_, err = c.Start(Session{Hook: r2.hook, Duration: 50 * time.Millisecond})
+	require.NoError(t, err)
+
+	c.Capture(Frame{Remote: &net.UDPAddr{IP: ip, Port: 1}}, []byte("foo"))
+	c.Capture(Frame{Remote: &net.UDPAddr{IP: net.IPv4(5, 6, 7, 8), Port: 1}}, []byte("foo"))
+	require.Len(t, r1.get(), 1)
+	require.Nil(t, r1.get()[0].Data)
+	require.Len(t, r2.get(), 2)
+
+	// the second session expires
+	require.Eventually(t, func() bool {
+		return len(*c.sessions.Load()) == 1
+	}, time.Second, 10*time.Millisecond)
+	c.Capture(Frame{Remote: &net.UDPAddr{IP: ip, Port: 1}}, nil)
+	require.Len(t, r1.get(), 2)
+	require.Len(t, r2.get(), 2)
+}
@@ -0,0 +1,68 @@
+package capture
+
+import (
+	"time"
+
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// WrapConn returns a connection passing the bytes read from and written to c to the
+// capture sessions. It returns c if the Capturer is nil.
+func (c *Capturer) WrapConn(conn manet.Conn) manet.Conn {
+	if c == nil {
+		return conn
+	}
+	return &capturingConn{Conn: conn, capturer: c}
+}
+
+// WrapListener returns a listener wrapping the connections it accepts with WrapConn.
+// It returns l if the Capturer is nil.
+func (c *Capturer) WrapListener(l manet.Listener) manet.Listener {
+	if c == nil {
+		return l
+	}
+	return &capturingListener{Listener: l, capturer: c}
+}
+
+type capturingConn struct {
+	manet.Conn
+	capturer *Capturer
+}
+
+func (c *capturingConn) capture(sent bool, b []byte) {
+	if len(b) == 0 || !c.capturer.Active() {
+		return
+	}
+	c.capturer.Capture(Frame{
+		Time:   time.Now(),
+		Sent:   sent,
+		Local:  c.LocalAddr(),
+		Remote: c.RemoteAddr(),
+		Size:   len(b),
+	}, b)
+}
+
+func (c *capturingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.capture(false, b[:n])
+	return n, err
+}
+
+func (c *capturingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.capture(true, b[:n])
+	return n, err
+}
+
+type capturingListener struct {
+	manet.Listener
+	capturer *Capturer
+}
+
+func (l *capturingListener) Accept() (manet.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.capturer.WrapConn(conn), nil
+}
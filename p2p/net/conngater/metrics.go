@@ -0,0 +1,64 @@
+package conngater
+
+import (
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricNamespace = "libp2p_conngater"
+
+var (
+	deniedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "denied_total",
+			Help:      "Connections denied by the connection gater",
+		},
+		[]string{"stage", "gater"},
+	)
+	collectors = []prometheus.Collector{
+		deniedTotal,
+	}
+)
+
+// MetricsTracer is the interface for tracking metrics for the connection gater
+type MetricsTracer interface {
+	// ConnectionDenied is called when the gater denies a connection.
+	ConnectionDenied(reason connmgr.DenyReason)
+}
+
+type metricsTracer struct{}
+
+var _ MetricsTracer = &metricsTracer{}
+
+type metricsTracerSetting struct {
+	reg prometheus.Registerer
+}
+
+type MetricsTracerOption func(*metricsTracerSetting)
+
+func WithRegisterer(reg prometheus.Registerer) MetricsTracerOption {
+	return func(s *metricsTracerSetting) {
+		if reg != nil {
+			s.reg = reg
+		}
+	}
+}
+
+func NewMetricsTracer(opts ...MetricsTracerOption) MetricsTracer {
+	setting := &metricsTracerSetting{reg: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(setting)
+	}
+	metricshelper.RegisterCollectors(setting.reg, collectors...)
+	return &metricsTracer{}
+}
+
+func (mt *metricsTracer) ConnectionDenied(reason connmgr.DenyReason) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, reason.Stage.String(), reason.Gater)
+	deniedTotal.WithLabelValues(*tags...).Inc()
+}
@@ -0,0 +1,30 @@
+//go:build nocover
+
+package conngater
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+)
+
+func TestMetricsNoAllocNoCover(t *testing.T) {
+	tr := NewMetricsTracer()
+	gaters := []string{"rules", "addrfilter", "*conngater.BasicConnectionGater"}
+	tests := map[string]func(){
+		"ConnectionDenied": func() {
+			tr.ConnectionDenied(connmgr.DenyReason{
+				Stage: connmgr.GatingStage(rand.Intn(5)),
+				Gater: gaters[rand.Intn(len(gaters))],
+				Rule:  "deny subnet 1.2.3.0/24",
+			})
+		},
+	}
+	for method, f := range tests {
+		allocs := testing.AllocsPerRun(1000, f)
+		if allocs > 0 {
+			t.Fatalf("Alloc Test: %s, got: %0.2f, expected: 0 allocs", method, allocs)
+		}
+	}
+}
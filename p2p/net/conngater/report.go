@@ -0,0 +1,155 @@
+package conngater
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ReportingGater is a connection gater applying another one, and reporting the
+// connections it denies: they're logged, counted in the metrics if it has a
+// MetricsTracer, and an event.EvtConnectionGated is emitted for each of them once
+// EmitEvents was called.
+//
+// The events are emitted in the background, so that slow subscribers never block
+// gating. At most maxPendingGatedEvents are queued, newer events are dropped, and
+// the number of dropped events is logged.
+//
+// It implements connmgr.DenyReasoner, passing on the reasons of the gater it applies.
+type ReportingGater struct {
+	next          connmgr.ConnectionGater
+	metricsTracer MetricsTracer
+	emitter       atomic.Pointer[event.Emitter]
+
+	// pending holds the events yet to be emitted. A goroutine emitting them runs
+	// while emitting is set.
+	pending  chan event.EvtConnectionGated
+	emitting atomic.Bool
+	// dropped counts the events dropped because pending was full, reported is the
+	// number of dropped events that was logged
+	dropped, reported atomic.Uint64
+}
+
+// maxPendingGatedEvents is the maximum number of events queued for slow subscribers.
+const maxPendingGatedEvents = 256
+
+var (
+	_ connmgr.ConnectionGater = (*ReportingGater)(nil)
+	_ connmgr.DenyReasoner    = (*ReportingGater)(nil)
+)
+
+// NewReportingGater creates a ReportingGater applying next. The metrics tracer is
+// optional, it can be nil.
+func NewReportingGater(next connmgr.ConnectionGater, mt MetricsTracer) *ReportingGater {
+	return &ReportingGater{
+		next:          next,
+		metricsTracer: mt,
+		pending:       make(chan event.EvtConnectionGated, maxPendingGatedEvents),
+	}
+}
+
+// EmitEvents makes the gater emit an event.EvtConnectionGated on bus for every
+// connection it denies. It can only be called once.
+func (g *ReportingGater) EmitEvents(bus event.Bus) error {
+	em, err := bus.Emitter(new(event.EvtConnectionGated))
+	if err != nil {
+		return err
+	}
+	if !g.emitter.CompareAndSwap(nil, &em) {
+		em.Close()
+		return errors.New("gater is already emitting events")
+	}
+	return nil
+}
+
+// report reports r, which is nil if the connection was allowed, and returns it.
+func (g *ReportingGater) report(r *connmgr.DenyReason, p peer.ID, a ma.Multiaddr, dir network.Direction) *connmgr.DenyReason {
+	if r == nil {
+		return nil
+	}
+	log.Debugw("connection gated", "peer", p, "addr", a, "direction", dir, "reason", r)
+	if g.metricsTracer != nil {
+		g.metricsTracer.ConnectionDenied(*r)
+	}
+	if em := g.emitter.Load(); em != nil {
+		g.emit(*em, event.EvtConnectionGated{Peer: p, Addr: a, Direction: dir, Reason: *r})
+	}
+	return r
+}
+
+// emit queues evt, and starts a goroutine emitting the queued events if none is
+// running. It never blocks.
+func (g *ReportingGater) emit(em event.Emitter, evt event.EvtConnectionGated) {
+	select {
+	case g.pending <- evt:
+	default:
+		g.dropped.Add(1)
+	}
+	if g.emitting.CompareAndSwap(false, true) {
+		go g.emitPending(em)
+	}
+}
+
+// emitPending emits the queued events until the queue is empty.
+func (g *ReportingGater) emitPending(em event.Emitter) {
+	for {
+		if d := g.dropped.Load(); d != g.reported.Load() {
+			log.Warnf("dropped %d connection gated events, subscribers are too slow", d-g.reported.Swap(d))
+		}
+		select {
+		case evt := <-g.pending:
+			em.Emit(evt)
+		default:
+			g.emitting.Store(false)
+			// an event might have been queued before we cleared emitting
+			if len(g.pending) == 0 || !g.emitting.CompareAndSwap(false, true) {
+				return
+			}
+		}
+	}
+}
+
+func (g *ReportingGater) DenyPeerDial(p peer.ID) *connmgr.DenyReason {
+	return g.report(connmgr.GatePeerDial(g.next, p), p, nil, network.DirOutbound)
+}
+
+func (g *ReportingGater) DenyAddrDial(p peer.ID, a ma.Multiaddr) *connmgr.DenyReason {
+	return g.report(connmgr.GateAddrDial(g.next, p, a), p, a, network.DirOutbound)
+}
+
+func (g *ReportingGater) DenyAccept(addrs network.ConnMultiaddrs) *connmgr.DenyReason {
+	return g.report(connmgr.GateAccept(g.next, addrs), "", addrs.RemoteMultiaddr(), network.DirInbound)
+}
+
+func (g *ReportingGater) DenySecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) *connmgr.DenyReason {
+	return g.report(connmgr.GateSecured(g.next, dir, p, addrs), p, addrs.RemoteMultiaddr(), dir)
+}
+
+func (g *ReportingGater) InterceptPeerDial(p peer.ID) (allow bool) {
+	return g.DenyPeerDial(p) == nil
+}
+
+func (g *ReportingGater) InterceptAddrDial(p peer.ID, a ma.Multiaddr) (allow bool) {
+	return g.DenyAddrDial(p, a) == nil
+}
+
+func (g *ReportingGater) InterceptAccept(addrs network.ConnMultiaddrs) (allow bool) {
+	return g.DenyAccept(addrs) == nil
+}
+
+func (g *ReportingGater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) (allow bool) {
+	return g.DenySecured(dir, p, addrs) == nil
+}
+
+func (g *ReportingGater) InterceptUpgraded(c network.Conn) (allow bool, reason control.DisconnectReason) {
+	r, reason := connmgr.GateUpgraded(g.next, c)
+	g.report(r, c.RemotePeer(), c.RemoteMultiaddr(), c.Stat().Direction)
+	return r == nil, reason
+}
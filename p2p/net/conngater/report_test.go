@@ -0,0 +1,96 @@
+package conngater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+type mockMetricsTracer struct {
+	denied []connmgr.DenyReason
+}
+
+func (mt *mockMetricsTracer) ConnectionDenied(r connmgr.DenyReason) {
+	mt.denied = append(mt.denied, r)
+}
+
+func TestReportingGater(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+
+	rules, err := NewRuleGater(nil)
+	require.NoError(t, err)
+	require.NoError(t, rules.AddRule(Rule{Action: RuleDeny, Peer: p}))
+	require.NoError(t, rules.AddRule(mustParseRule(t, "deny subnet 1.2.3.0/24")))
+
+	mt := &mockMetricsTracer{}
+	g := NewReportingGater(rules, mt)
+	bus := eventbus.NewBus()
+	require.NoError(t, g.EmitEvents(bus))
+	require.Error(t, g.EmitEvents(bus))
+	sub, err := bus.Subscribe(new(event.EvtConnectionGated))
+	require.NoError(t, err)
+	defer sub.Close()
+	next := func() event.EvtConnectionGated {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			return e.(event.EvtConnectionGated)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected an event")
+			return event.EvtConnectionGated{}
+		}
+	}
+
+	require.True(t, g.InterceptPeerDial(test.RandPeerIDFatal(t)))
+	require.True(t, g.InterceptAccept(&mockConnMultiaddrs{remote: ma.StringCast("/ip4/5.6.7.8/tcp/1")}))
+
+	require.False(t, g.InterceptPeerDial(p))
+	peerDial := connmgr.DenyReason{Stage: connmgr.GatingStagePeerDial, Gater: "rules", Rule: "deny peer " + p.String()}
+	require.Equal(t, event.EvtConnectionGated{Peer: p, Direction: network.DirOutbound, Reason: peerDial}, next())
+
+	require.False(t, g.InterceptAccept(&mockConnMultiaddrs{remote: addr}))
+	accept := connmgr.DenyReason{Stage: connmgr.GatingStageAccept, Gater: "rules", Rule: "deny subnet 1.2.3.0/24"}
+	require.Equal(t, event.EvtConnectionGated{Addr: addr, Direction: network.DirInbound, Reason: accept}, next())
+
+	// the reasons are passed on
+	require.Equal(t, &peerDial, connmgr.GatePeerDial(g, p))
+	next()
+
+	require.Equal(t, []connmgr.DenyReason{peerDial, accept, peerDial}, mt.denied)
+}
+
+func TestReportingGaterSlowSubscriber(t *testing.T) {
+	rules, err := NewRuleGater(nil)
+	require.NoError(t, err)
+	require.NoError(t, rules.AddRule(mustParseRule(t, "deny subnet 1.2.3.0/24")))
+	g := NewReportingGater(rules, nil)
+	bus := eventbus.NewBus()
+	require.NoError(t, g.EmitEvents(bus))
+	// the subscriber never reads its events
+	sub, err := bus.Subscribe(new(event.EvtConnectionGated), eventbus.BufSize(1))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*maxPendingGatedEvents; i++ {
+			g.InterceptAccept(&mockConnMultiaddrs{remote: ma.StringCast("/ip4/1.2.3.4/tcp/1234")})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("gating blocked on the subscriber")
+	}
+	require.NotZero(t, g.dropped.Load())
+}
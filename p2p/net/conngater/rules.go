@@ -0,0 +1,388 @@
+package conngater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/internal/peermatch"
+
+	ma "github.com/multiformats/go-multiaddr"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// RuleAction is what a Rule does with the connections it matches.
+type RuleAction string
+
+const (
+	RuleAllow RuleAction = "allow"
+	RuleDeny  RuleAction = "deny"
+)
+
+// Rule is a rule of a RuleGater. It matches the connections to or from a peer ID, an
+// IP subnet or an ASN: exactly one of Peer, Subnet and ASN must be set.
+//
+// The text form of a rule is its action, kind and value, separated by spaces, e.g.
+// "deny subnet 1.2.3.0/24", "allow peer 12D3KooW..." or "deny asn 13335".
+type Rule struct {
+	Action RuleAction
+	Peer   peer.ID
+	Subnet *net.IPNet
+	// ASN is the decimal number of an autonomous system.
+	ASN string
+}
+
+// ParseRule parses the text form of a rule.
+func ParseRule(s string) (Rule, error) {
+	var r Rule
+	err := r.UnmarshalText([]byte(s))
+	return r, err
+}
+
+func (r Rule) String() string {
+	kind, value := r.target()
+	return fmt.Sprintf("%s %s %s", r.Action, kind, value)
+}
+
+// target returns the kind and the value of what r matches.
+func (r Rule) target() (kind, value string) {
+	switch {
+	case r.Peer != "":
+		return "peer", r.Peer.String()
+	case r.Subnet != nil:
+		return "subnet", r.Subnet.String()
+	default:
+		return "asn", r.ASN
+	}
+}
+
+func (r Rule) MarshalText() ([]byte, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return []byte(r.normalize().String()), nil
+}
+
+func (r *Rule) UnmarshalText(b []byte) error {
+	fields := strings.Fields(string(b))
+	if len(fields) != 3 {
+		return fmt.Errorf("invalid rule %q: expected an action, a kind and a value", b)
+	}
+	rule := Rule{Action: RuleAction(fields[0])}
+	switch kind, value := fields[1], fields[2]; kind {
+	case "peer":
+		p, err := peer.Decode(value)
+		if err != nil {
+			return fmt.Errorf("invalid rule %q: %w", b, err)
+		}
+		rule.Peer = p
+	case "subnet":
+		_, ipnet, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("invalid rule %q: %w", b, err)
+		}
+		rule.Subnet = ipnet
+	case "asn":
+		rule.ASN = value
+	default:
+		return fmt.Errorf("invalid rule %q: unknown kind %q", b, kind)
+	}
+	if err := rule.validate(); err != nil {
+		return fmt.Errorf("invalid rule %q: %w", b, err)
+	}
+	*r = rule
+	return nil
+}
+
+func (r Rule) validate() error {
+	if r.Action != RuleAllow && r.Action != RuleDeny {
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	n := 0
+	if r.Peer != "" {
+		n++
+	}
+	if r.Subnet != nil {
+		n++
+		if _, bits := r.Subnet.Mask.Size(); bits == 0 {
+			return fmt.Errorf("invalid subnet mask: %s", r.Subnet.Mask)
+		}
+	}
+	if r.ASN != "" {
+		n++
+		if _, err := strconv.ParseUint(r.ASN, 10, 32); err != nil {
+			return fmt.Errorf("invalid ASN %q", r.ASN)
+		}
+	}
+	if n != 1 {
+		return errors.New("a rule must match exactly one of a peer, a subnet or an ASN")
+	}
+	return nil
+}
+
+// normalize returns r with the host bits of its subnet cleared, so that equal rules
+// have the same text form.
+func (r Rule) normalize() Rule {
+	if r.Subnet != nil {
+		r.Subnet = &net.IPNet{IP: r.Subnet.IP.Mask(r.Subnet.Mask), Mask: r.Subnet.Mask}
+	}
+	return r
+}
+
+// match returns what r matches.
+func (r Rule) match() peermatch.Match {
+	return peermatch.Match{Peer: r.Peer, Subnet: r.Subnet, ASN: r.ASN}
+}
+
+// setRules returns the rules with action matching what was added to s.
+func setRules(action RuleAction, s *peermatch.Set) []Rule {
+	all := s.All()
+	rules := make([]Rule, 0, len(all))
+	for _, m := range all {
+		rules = append(rules, Rule{Action: action, Peer: m.Peer, Subnet: m.Subnet, ASN: m.ASN})
+	}
+	return rules
+}
+
+// RuleGater is a connection gater allowing and denying connections by peer ID, IP
+// subnet and ASN. The rules can be added and removed at any time, and apply to the
+// connections opened afterwards: the established connections aren't closed.
+//
+// A connection is denied if the peer ID, the IP address or the ASN of the remote peer
+// is denied. Otherwise, if there is any allow rule, at least one of them must match.
+// ASNs are only known for IPv6 addresses, so ASN rules don't apply to IPv4 addresses.
+//
+// As the peer ID of an inbound connection is only known once it is secured, the allow
+// rules are checked on inbound connections after the handshake, while the deny rules
+// on addresses are checked as soon as it's accepted.
+type RuleGater struct {
+	mx    sync.RWMutex
+	lists peermatch.Lists
+
+	ds datastore.Datastore
+}
+
+var _ connmgr.ConnectionGater = (*RuleGater)(nil)
+
+const (
+	rulesNs = "/libp2p/net/conngater/rules"
+	keyRule = "/rule/"
+)
+
+// NewRuleGater creates a RuleGater.
+// The ds argument is an (optional, can be nil) datastore to persist the rules in. The
+// rules already in ds are loaded.
+func NewRuleGater(ds datastore.Datastore) (*RuleGater, error) {
+	g := &RuleGater{lists: peermatch.NewLists()}
+	if ds != nil {
+		g.ds = namespace.Wrap(ds, datastore.NewKey(rulesNs))
+		if err := g.loadRules(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func (g *RuleGater) loadRules(ctx context.Context) error {
+	res, err := g.ds.Query(ctx, query.Query{Prefix: keyRule})
+	if err != nil {
+		log.Errorf("error querying datastore for rules: %s", err)
+		return err
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			log.Errorf("query result error: %s", r.Error)
+			return r.Error
+		}
+		rule, err := ParseRule(string(r.Entry.Value))
+		if err != nil {
+			log.Errorf("error parsing rule: %s", err)
+			return err
+		}
+		g.set(rule).Add(rule.match())
+	}
+	return nil
+}
+
+// set returns the list r belongs to.
+func (g *RuleGater) set(r Rule) *peermatch.Set {
+	if r.Action == RuleAllow {
+		return g.lists.Allow
+	}
+	return g.lists.Deny
+}
+
+func ruleKey(r Rule) datastore.Key {
+	kind, value := r.target()
+	return datastore.NewKey(keyRule + string(r.Action) + "/" + kind + "/" + value)
+}
+
+// AddRule adds r to the rules of the gater.
+// Note: the active connections r denies are not automatically closed.
+func (g *RuleGater) AddRule(r Rule) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	r = r.normalize()
+
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	if g.set(r).Contains(r.match()) {
+		return nil
+	}
+	if g.ds != nil {
+		if err := g.ds.Put(context.Background(), ruleKey(r), []byte(r.String())); err != nil {
+			log.Errorf("error writing rule to datastore: %s", err)
+			return err
+		}
+	}
+	g.set(r).Add(r.match())
+	return nil
+}
+
+// RemoveRule removes r from the rules of the gater. It's a no-op if r wasn't added.
+func (g *RuleGater) RemoveRule(r Rule) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	r = r.normalize()
+
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	if !g.set(r).Contains(r.match()) {
+		return nil
+	}
+	if g.ds != nil {
+		if err := g.ds.Delete(context.Background(), ruleKey(r)); err != nil {
+			log.Errorf("error deleting rule from datastore: %s", err)
+			return err
+		}
+	}
+	g.set(r).Remove(r.match())
+	return nil
+}
+
+// Rules returns the rules of the gater, sorted by their text form.
+func (g *RuleGater) Rules() []Rule {
+	g.mx.RLock()
+	rules := append(setRules(RuleAllow, g.lists.Allow), setRules(RuleDeny, g.lists.Deny)...)
+	g.mx.RUnlock()
+
+	sortRules(rules)
+	return rules
+}
+
+func sortRules(rules []Rule) {
+	sort.Slice(rules, func(i, j int) bool { return rules[i].String() < rules[j].String() })
+}
+
+// noAllowRule is the rule of the reasons of the connections denied because no allow
+// rule matches them.
+const noAllowRule = "no allow rule"
+
+func denyReason(rule string) *connmgr.DenyReason {
+	return &connmgr.DenyReason{Gater: "rules", Rule: rule}
+}
+
+// deniedAddr returns why a is denied, if it is. The caller must hold the lock.
+func (g *RuleGater) deniedAddr(a ma.Multiaddr) *connmgr.DenyReason {
+	if m, ok := g.lists.DeniedAddr(a); ok {
+		return denyReason(denyRule(m).String())
+	}
+	return nil
+}
+
+// denied checks a connection to or from p at a against all the rules, and returns why
+// it's denied, if it is. The caller must hold the lock.
+func (g *RuleGater) denied(p peer.ID, a ma.Multiaddr) *connmgr.DenyReason {
+	m, ok := g.lists.Denied(p, a)
+	if !ok {
+		return nil
+	}
+	if m == (peermatch.Match{}) {
+		return denyReason(noAllowRule)
+	}
+	return denyReason(denyRule(m).String())
+}
+
+// denyRule returns the deny rule matching what m matches.
+func denyRule(m peermatch.Match) Rule {
+	return Rule{Action: RuleDeny, Peer: m.Peer, Subnet: m.Subnet, ASN: m.ASN}
+}
+
+var _ connmgr.DenyReasoner = (*RuleGater)(nil)
+
+// DenyPeerDial implements connmgr.DenyReasoner. The rule of the reasons of the
+// RuleGater is the text form of the deny rule matching the connection, or
+// "no allow rule" if no allow rule matches it.
+func (g *RuleGater) DenyPeerDial(p peer.ID) *connmgr.DenyReason {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
+	// the allow rules are checked once the address is known, in DenyAddrDial
+	if m, ok := g.lists.Deny.MatchPeer(p); ok {
+		return denyReason(denyRule(m).String())
+	}
+	return nil
+}
+
+func (g *RuleGater) DenyAddrDial(p peer.ID, a ma.Multiaddr) *connmgr.DenyReason {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
+	return g.denied(p, a)
+}
+
+func (g *RuleGater) DenyAccept(cma network.ConnMultiaddrs) *connmgr.DenyReason {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
+	// the allow rules are checked once the peer ID is known, in DenySecured
+	return g.deniedAddr(cma.RemoteMultiaddr())
+}
+
+func (g *RuleGater) DenySecured(dir network.Direction, p peer.ID, cma network.ConnMultiaddrs) *connmgr.DenyReason {
+	if dir == network.DirOutbound {
+		// we have already filtered those in DenyPeerDial/DenyAddrDial
+		return nil
+	}
+
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
+	return g.denied(p, cma.RemoteMultiaddr())
+}
+
+func (g *RuleGater) InterceptPeerDial(p peer.ID) (allow bool) {
+	return g.DenyPeerDial(p) == nil
+}
+
+func (g *RuleGater) InterceptAddrDial(p peer.ID, a ma.Multiaddr) (allow bool) {
+	return g.DenyAddrDial(p, a) == nil
+}
+
+func (g *RuleGater) InterceptAccept(cma network.ConnMultiaddrs) (allow bool) {
+	return g.DenyAccept(cma) == nil
+}
+
+func (g *RuleGater) InterceptSecured(dir network.Direction, p peer.ID, cma network.ConnMultiaddrs) (allow bool) {
+	return g.DenySecured(dir, p, cma) == nil
+}
+
+func (g *RuleGater) InterceptUpgraded(network.Conn) (allow bool, reason control.DisconnectReason) {
+	return true, 0
+}
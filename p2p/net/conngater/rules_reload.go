@@ -0,0 +1,241 @@
+package conngater
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/p2p/internal/filewatch"
+)
+
+// RulesDecoder decodes the rules of a rules file.
+type RulesDecoder func(io.Reader) ([]Rule, error)
+
+// decodeRulesText decodes a rule per line, in their text form. Empty lines and lines
+// starting with a # are ignored.
+func decodeRulesText(in io.Reader) ([]Rule, error) {
+	var rules []Rule
+	s := bufio.NewScanner(in)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := ParseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, s.Err()
+}
+
+// ReadRulesFile reads the rules of the file at path, decoded by dec, or as a rule per
+// line in their text form if dec is nil. It can be used to validate a rules file
+// before it's deployed.
+func ReadRulesFile(path string, dec RulesDecoder) ([]Rule, error) {
+	if dec == nil {
+		dec = decodeRulesText
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := dec(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rules from %s: %w", path, err)
+	}
+	for i, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d in %s: %w", i+1, path, err)
+		}
+		rules[i] = r.normalize()
+	}
+	return rules, nil
+}
+
+// RulesReloader applies the rules from a rules file to a RuleGater, and applies them
+// again whenever the file changes or the process receives a SIGHUP, so that rules can
+// be pushed to nodes without restarting them.
+//
+// The RulesReloader keeps track of the rules it added: when a rule is removed from the
+// file, it's removed from the gater. The rules added to the gater by other means are
+// left alone, unless they're also in the file. If the file can't be read or contains
+// invalid rules, the previous rules are kept.
+type RulesReloader struct {
+	path    string
+	gater   *RuleGater
+	decode  RulesDecoder
+	signals bool
+
+	mx sync.Mutex
+	// loaded are the rules in the file when it was last applied, by text form
+	loaded map[string]Rule
+
+	watcher *filewatch.Watcher
+}
+
+// RulesReloaderOption is an option for NewRulesReloader.
+type RulesReloaderOption func(*RulesReloader) error
+
+// WithRulesDecoder sets the decoder of the rules file, e.g. to read JSON or YAML. By
+// default, the file has a rule per line, in their text form, see Rule.
+func WithRulesDecoder(dec RulesDecoder) RulesReloaderOption {
+	return func(r *RulesReloader) error {
+		r.decode = dec
+		return nil
+	}
+}
+
+// WithReloadOnSignal sets whether the rules are reloaded when the process receives a
+// SIGHUP, which is enabled by default.
+func WithReloadOnSignal(enable bool) RulesReloaderOption {
+	return func(r *RulesReloader) error {
+		r.signals = enable
+		return nil
+	}
+}
+
+// NewRulesReloader applies the rules from the rules file at path to g, and starts
+// watching the file for changes.
+func NewRulesReloader(g *RuleGater, path string, opts ...RulesReloaderOption) (*RulesReloader, error) {
+	r := &RulesReloader{
+		path:    path,
+		gater:   g,
+		decode:  decodeRulesText,
+		signals: true,
+		loaded:  make(map[string]Rule),
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.watcher, err = filewatch.New(path, r.signals, r.reloadChanged)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RulesChange is a change of the rules of a RuleGater by a RulesReloader.
+type RulesChange struct {
+	// Added are the rules of the file the gater doesn't have, and Removed the rules
+	// that were in the file when it was last applied, and no longer are. They're sorted
+	// by their text form.
+	Added, Removed []Rule
+}
+
+// changes returns the changes to apply rules. The caller must hold r.mx, and the lock
+// of the gater.
+func (r *RulesReloader) changes(rules []Rule) RulesChange {
+	var change RulesChange
+	current := make(map[string]Rule, len(rules))
+	for _, rule := range rules {
+		key := rule.String()
+		if _, ok := current[key]; ok {
+			continue
+		}
+		current[key] = rule
+		if !r.gater.set(rule).Contains(rule.match()) {
+			change.Added = append(change.Added, rule)
+		}
+	}
+	for key, rule := range r.loaded {
+		if _, ok := current[key]; !ok && r.gater.set(rule).Contains(rule.match()) {
+			change.Removed = append(change.Removed, rule)
+		}
+	}
+
+	sortRules(change.Added)
+	sortRules(change.Removed)
+	return change
+}
+
+// Check reads the rules file, and returns the changes Reload would make, without
+// applying them. It can be used to try a new rules file.
+func (r *RulesReloader) Check() (RulesChange, error) {
+	rules, err := ReadRulesFile(r.path, r.decode)
+	if err != nil {
+		return RulesChange{}, err
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.gater.mx.RLock()
+	defer r.gater.mx.RUnlock()
+	return r.changes(rules), nil
+}
+
+// Reload reads the rules file and applies its rules. It returns the changes it made.
+func (r *RulesReloader) Reload() (RulesChange, error) {
+	rules, err := ReadRulesFile(r.path, r.decode)
+	if err != nil {
+		return RulesChange{}, err
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	// The changes are computed and applied at once, so that no rule added or removed
+	// in between is missed.
+	r.gater.mx.Lock()
+	change := r.changes(rules)
+	err = r.gater.updateRulesLocked(change.Added, change.Removed)
+	r.gater.mx.Unlock()
+	if err != nil {
+		return RulesChange{}, err
+	}
+	r.loaded = make(map[string]Rule, len(rules))
+	for _, rule := range rules {
+		r.loaded[rule.String()] = rule
+	}
+	return change, nil
+}
+
+// reloadChanged reloads the rules file after it changed.
+func (r *RulesReloader) reloadChanged() {
+	change, err := r.Reload()
+	if err != nil {
+		log.Errorw("failed to reload rules", "path", r.path, "error", err)
+		return
+	}
+	log.Infow("reloaded rules", "path", r.path, "added", len(change.Added), "removed", len(change.Removed))
+}
+
+// Close stops watching the rules file. The rules of the gater stay as they are.
+func (r *RulesReloader) Close() error {
+	return r.watcher.Close()
+}
+
+// updateRulesLocked removes the rules in remove and adds the rules in add, which must
+// be valid and normalized, at once. If the datastore fails, the rules that were stored
+// are applied. The caller must hold g.mx.
+func (g *RuleGater) updateRulesLocked(add, remove []Rule) error {
+	for _, rule := range remove {
+		if g.ds != nil {
+			if err := g.ds.Delete(context.Background(), ruleKey(rule)); err != nil {
+				log.Errorf("error deleting rule from datastore: %s", err)
+				return err
+			}
+		}
+		g.set(rule).Remove(rule.match())
+	}
+	for _, rule := range add {
+		if g.ds != nil {
+			if err := g.ds.Put(context.Background(), ruleKey(rule), []byte(rule.String())); err != nil {
+				log.Errorf("error writing rule to datastore: %s", err)
+				return err
+			}
+		}
+		g.set(rule).Add(rule.match())
+	}
+	return nil
+}
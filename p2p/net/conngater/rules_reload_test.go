@@ -0,0 +1,110 @@
+package conngater
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p/core/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules")
+	require.NoError(t, os.WriteFile(path, []byte("# abuse\n\ndeny subnet 1.2.3.4/24\n  allow asn 13335  \n"), 0o644))
+	rules, err := ReadRulesFile(path, nil)
+	require.NoError(t, err)
+	require.Equal(t, []Rule{mustParseRule(t, "deny subnet 1.2.3.0/24"), mustParseRule(t, "allow asn 13335")}, rules)
+
+	require.NoError(t, os.WriteFile(path, []byte("deny subnet 1.2.3.0/24\ndeny asn AS13335\n"), 0o644))
+	_, err = ReadRulesFile(path, nil)
+	require.ErrorContains(t, err, "line 2")
+
+	// JSON files can be read too
+	decodeJSON := func(in io.Reader) ([]Rule, error) {
+		var rules []Rule
+		err := json.NewDecoder(in).Decode(&rules)
+		return rules, err
+	}
+	require.NoError(t, os.WriteFile(path, []byte(`["deny subnet 1.2.3.0/24"]`), 0o644))
+	rules, err = ReadRulesFile(path, decodeJSON)
+	require.NoError(t, err)
+	require.Equal(t, []Rule{mustParseRule(t, "deny subnet 1.2.3.0/24")}, rules)
+	require.NoError(t, os.WriteFile(path, []byte(`[{}]`), 0o644))
+	_, err = ReadRulesFile(path, decodeJSON)
+	require.Error(t, err)
+}
+
+func TestRulesReloader(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+
+	ds := datastore.NewMapDatastore()
+	g, err := NewRuleGater(ds)
+	require.NoError(t, err)
+	manual := Rule{Action: RuleDeny, Peer: p}
+	require.NoError(t, g.AddRule(manual))
+
+	path := filepath.Join(t.TempDir(), "rules")
+	require.NoError(t, os.WriteFile(path, []byte("deny subnet 1.2.3.0/24\n"), 0o644))
+	r, err := NewRulesReloader(g, path, WithReloadOnSignal(false))
+	require.NoError(t, err)
+	require.False(t, g.InterceptAddrDial(test.RandPeerIDFatal(t), addr))
+
+	// the rules are reloaded when the file is replaced, and the rules removed from the
+	// file are removed from the gater, but not the other ones
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, []byte("deny subnet 5.6.7.0/24\n"), 0o644))
+	require.NoError(t, os.Rename(tmp, path))
+	require.Eventually(t, func() bool {
+		return g.InterceptAddrDial(test.RandPeerIDFatal(t), addr)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []Rule{manual, mustParseRule(t, "deny subnet 5.6.7.0/24")}, g.Rules())
+
+	// stop watching, so that the file is only applied on Reload
+	require.NoError(t, r.Close())
+
+	// checking a file doesn't apply it
+	require.NoError(t, os.WriteFile(path, []byte("deny subnet 9.9.9.0/24\ndeny peer "+p.String()+"\n"), 0o644))
+	change, err := r.Check()
+	require.NoError(t, err)
+	require.Equal(t, RulesChange{
+		Added:   []Rule{mustParseRule(t, "deny subnet 9.9.9.0/24")},
+		Removed: []Rule{mustParseRule(t, "deny subnet 5.6.7.0/24")},
+	}, change)
+	require.Equal(t, []Rule{manual, mustParseRule(t, "deny subnet 5.6.7.0/24")}, g.Rules())
+
+	change, err = r.Reload()
+	require.NoError(t, err)
+	require.Len(t, change.Added, 1)
+	require.Len(t, change.Removed, 1)
+	require.Equal(t, []Rule{manual, mustParseRule(t, "deny subnet 9.9.9.0/24")}, g.Rules())
+
+	// invalid files keep the rules
+	require.NoError(t, os.WriteFile(path, []byte("deny subnet 9.9.9.9\n"), 0o644))
+	_, err = r.Reload()
+	require.Error(t, err)
+	_, err = r.Check()
+	require.Error(t, err)
+	require.Equal(t, []Rule{manual, mustParseRule(t, "deny subnet 9.9.9.0/24")}, g.Rules())
+
+	// the peer rule is now in the file, so emptying the file removes it too
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+	_, err = r.Reload()
+	require.NoError(t, err)
+	require.Empty(t, g.Rules())
+
+	// the changes are persisted
+	g2, err := NewRuleGater(ds)
+	require.NoError(t, err)
+	require.Empty(t, g2.Rules())
+
+	_, err = NewRulesReloader(g, filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
@@ -0,0 +1,198 @@
+package conngater
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+
+	asnutil "github.com/libp2p/go-libp2p-asn-util"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseRule(t *testing.T, s string) Rule {
+	t.Helper()
+	r, err := ParseRule(s)
+	require.NoError(t, err)
+	return r
+}
+
+func TestParseRule(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	for _, s := range []string{
+		"allow peer " + p.String(),
+		"deny subnet 1.2.3.0/24",
+		"deny subnet 2001:db8::/32",
+		"allow asn 13335",
+	} {
+		r := mustParseRule(t, s)
+		require.Equal(t, s, r.String())
+	}
+
+	// the host bits are cleared
+	require.Equal(t, "deny subnet 1.2.3.0/24", mustParseRule(t, "deny subnet 1.2.3.4/24").String())
+
+	for _, s := range []string{
+		"",
+		"deny",
+		"block peer " + p.String(),
+		"deny peer foo",
+		"deny subnet 1.2.3.4",
+		"deny asn AS13335",
+		"deny host example.com",
+		"deny subnet 1.2.3.0/24 extra",
+	} {
+		_, err := ParseRule(s)
+		require.Error(t, err, s)
+	}
+
+	_, ipnet, err := net.ParseCIDR("1.2.3.0/24")
+	require.NoError(t, err)
+	b, err := json.Marshal([]Rule{{Action: RuleDeny, Subnet: ipnet}, {Action: RuleAllow, ASN: "13335"}})
+	require.NoError(t, err)
+	require.JSONEq(t, `["deny subnet 1.2.3.0/24", "allow asn 13335"]`, string(b))
+	var rules []Rule
+	require.NoError(t, json.Unmarshal(b, &rules))
+	require.Equal(t, "deny subnet 1.2.3.0/24", rules[0].String())
+	require.Equal(t, "allow asn 13335", rules[1].String())
+
+	_, err = json.Marshal(Rule{Action: RuleDeny, Peer: p, ASN: "13335"})
+	require.Error(t, err)
+}
+
+func TestRuleGater(t *testing.T) {
+	peerA := test.RandPeerIDFatal(t)
+	peerB := test.RandPeerIDFatal(t)
+	addr1 := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	addr2 := ma.StringCast("/ip4/5.6.7.8/tcp/1234")
+	conn := func(remote ma.Multiaddr) *mockConnMultiaddrs {
+		return &mockConnMultiaddrs{remote: remote}
+	}
+
+	g, err := NewRuleGater(nil)
+	require.NoError(t, err)
+	require.True(t, g.InterceptPeerDial(peerA))
+	require.True(t, g.InterceptAddrDial(peerA, addr1))
+	require.True(t, g.InterceptAccept(conn(addr1)))
+	require.True(t, g.InterceptSecured(network.DirInbound, peerA, conn(addr1)))
+
+	// deny rules
+	require.NoError(t, g.AddRule(Rule{Action: RuleDeny, Peer: peerA}))
+	require.NoError(t, g.AddRule(mustParseRule(t, "deny subnet 1.2.3.0/24")))
+	require.False(t, g.InterceptPeerDial(peerA))
+	require.True(t, g.InterceptPeerDial(peerB))
+	require.False(t, g.InterceptAddrDial(peerB, addr1))
+	require.True(t, g.InterceptAddrDial(peerB, addr2))
+	require.False(t, g.InterceptAccept(conn(addr1)))
+	require.True(t, g.InterceptAccept(conn(addr2)))
+	require.False(t, g.InterceptSecured(network.DirInbound, peerA, conn(addr2)))
+	require.True(t, g.InterceptSecured(network.DirInbound, peerB, conn(addr2)))
+	require.True(t, g.InterceptSecured(network.DirOutbound, peerA, conn(addr2)))
+
+	// allow rules: anything else is denied, but deny rules win
+	require.NoError(t, g.AddRule(Rule{Action: RuleAllow, Peer: peerB}))
+	require.NoError(t, g.AddRule(mustParseRule(t, "allow subnet 1.2.3.4/32")))
+	peerC := test.RandPeerIDFatal(t)
+	require.True(t, g.InterceptAddrDial(peerB, addr2))
+	require.False(t, g.InterceptAddrDial(peerC, addr2))
+	require.False(t, g.InterceptAddrDial(peerC, addr1))
+	// the peer ID of inbound connections is only known once they're secured
+	require.True(t, g.InterceptAccept(conn(addr2)))
+	require.True(t, g.InterceptSecured(network.DirInbound, peerB, conn(addr2)))
+	require.False(t, g.InterceptSecured(network.DirInbound, peerC, conn(addr2)))
+
+	require.Len(t, g.Rules(), 4)
+	require.NoError(t, g.RemoveRule(mustParseRule(t, "deny subnet 1.2.3.0/24")))
+	require.True(t, g.InterceptAddrDial(peerC, addr1))
+	require.NoError(t, g.RemoveRule(Rule{Action: RuleAllow, Peer: peerB}))
+	require.NoError(t, g.RemoveRule(mustParseRule(t, "allow subnet 1.2.3.4/32")))
+	// removing a missing rule is a no-op
+	require.NoError(t, g.RemoveRule(mustParseRule(t, "allow subnet 1.2.3.4/32")))
+	require.True(t, g.InterceptAddrDial(peerC, addr2))
+	require.Equal(t, []Rule{{Action: RuleDeny, Peer: peerA}}, g.Rules())
+
+	require.Error(t, g.AddRule(Rule{Action: RuleDeny}))
+	require.Error(t, g.AddRule(Rule{Action: "block", Peer: peerA}))
+}
+
+func TestRuleGaterASN(t *testing.T) {
+	ip := net.ParseIP("2606:4700:4700::1111")
+	asn, err := asnutil.Store.AsnForIPv6(ip)
+	require.NoError(t, err)
+	require.NotEmpty(t, asn)
+	addr := ma.StringCast("/ip6/2606:4700:4700::1111/udp/1234/quic-v1")
+	p := test.RandPeerIDFatal(t)
+
+	g, err := NewRuleGater(nil)
+	require.NoError(t, err)
+	require.NoError(t, g.AddRule(Rule{Action: RuleDeny, ASN: asn}))
+	require.False(t, g.InterceptAddrDial(p, addr))
+	require.False(t, g.InterceptAccept(&mockConnMultiaddrs{remote: addr}))
+	// ASN rules don't apply to IPv4 addresses
+	require.True(t, g.InterceptAddrDial(p, ma.StringCast("/ip4/1.1.1.1/tcp/1234")))
+
+	require.NoError(t, g.RemoveRule(Rule{Action: RuleDeny, ASN: asn}))
+	require.NoError(t, g.AddRule(Rule{Action: RuleAllow, ASN: asn}))
+	require.True(t, g.InterceptAddrDial(p, addr))
+	require.False(t, g.InterceptAddrDial(p, ma.StringCast("/ip6/2001:db8::1/tcp/1234")))
+}
+
+func TestRuleGaterPersistence(t *testing.T) {
+	ds := datastore.NewMapDatastore()
+	p := test.RandPeerIDFatal(t)
+
+	g, err := NewRuleGater(ds)
+	require.NoError(t, err)
+	require.NoError(t, g.AddRule(Rule{Action: RuleDeny, Peer: p}))
+	require.NoError(t, g.AddRule(mustParseRule(t, "deny subnet 2001:db8::/32")))
+	require.NoError(t, g.AddRule(mustParseRule(t, "allow asn 13335")))
+	require.NoError(t, g.AddRule(mustParseRule(t, "allow subnet 1.2.3.0/24")))
+	require.NoError(t, g.RemoveRule(mustParseRule(t, "allow subnet 1.2.3.0/24")))
+
+	g2, err := NewRuleGater(ds)
+	require.NoError(t, err)
+	require.Equal(t, g.Rules(), g2.Rules())
+	require.Len(t, g2.Rules(), 3)
+	require.False(t, g2.InterceptPeerDial(p))
+
+	// the rules don't clash with the ones of the BasicConnectionGater
+	cg, err := NewBasicConnectionGater(ds)
+	require.NoError(t, err)
+	require.NoError(t, cg.BlockPeer(peer.ID("A")))
+	g3, err := NewRuleGater(ds)
+	require.NoError(t, err)
+	require.Equal(t, g.Rules(), g3.Rules())
+}
+
+func TestRuleGaterDenyReason(t *testing.T) {
+	peerA := test.RandPeerIDFatal(t)
+	peerB := test.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+
+	g, err := NewRuleGater(nil)
+	require.NoError(t, err)
+	require.NoError(t, g.AddRule(Rule{Action: RuleDeny, Peer: peerA}))
+	require.NoError(t, g.AddRule(mustParseRule(t, "deny subnet 1.2.3.0/24")))
+
+	require.Equal(t,
+		&connmgr.DenyReason{Stage: connmgr.GatingStagePeerDial, Gater: "rules", Rule: "deny peer " + peerA.String()},
+		connmgr.GatePeerDial(g, peerA))
+	require.Equal(t,
+		&connmgr.DenyReason{Stage: connmgr.GatingStageAddrDial, Gater: "rules", Rule: "deny subnet 1.2.3.0/24"},
+		connmgr.GateAddrDial(g, peerB, addr))
+	require.Equal(t,
+		&connmgr.DenyReason{Stage: connmgr.GatingStageAccept, Gater: "rules", Rule: "deny subnet 1.2.3.0/24"},
+		connmgr.GateAccept(g, &mockConnMultiaddrs{remote: addr}))
+
+	require.NoError(t, g.AddRule(Rule{Action: RuleAllow, Peer: peerB}))
+	require.Nil(t, connmgr.GateSecured(g, network.DirInbound, peerB, &mockConnMultiaddrs{remote: ma.StringCast("/ip4/5.6.7.8/tcp/1")}))
+	require.Equal(t,
+		&connmgr.DenyReason{Stage: connmgr.GatingStageSecured, Gater: "rules", Rule: "no allow rule"},
+		connmgr.GateSecured(g, network.DirInbound, test.RandPeerIDFatal(t), &mockConnMultiaddrs{remote: ma.StringCast("/ip4/5.6.7.8/tcp/1")}))
+}
@@ -0,0 +1,185 @@
+package connmgr
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+)
+
+// PressureSource reports how close a resource is to being exhausted, as a value
+// between 0 (plenty available) and 1 (exhausted).
+type PressureSource interface {
+	Pressure() float64
+}
+
+// PressureFunc is a function that implements PressureSource.
+type PressureFunc func() float64
+
+func (f PressureFunc) Pressure() float64 { return f() }
+
+// MemoryPressure returns a PressureSource reporting the memory obtained from the OS by
+// the Go runtime, relative to limit bytes.
+func MemoryPressure(limit uint64) PressureSource {
+	return PressureFunc(func() float64 {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		return float64(ms.Sys-ms.HeapReleased) / float64(limit)
+	})
+}
+
+// ResourceManagerPressure returns a PressureSource reporting the usage of the memory,
+// connections and file descriptors of the system scope of rm relative to its limits,
+// whichever is highest. Resource managers whose scopes don't expose their limits
+// through rcmgr.ResourceScopeLimiter report no pressure.
+func ResourceManagerPressure(rm network.ResourceScopeViewer) PressureSource {
+	return PressureFunc(func() float64 {
+		var pressure float64
+		_ = rm.ViewSystem(func(scope network.ResourceScope) error {
+			limiter, ok := scope.(rcmgr.ResourceScopeLimiter)
+			if !ok {
+				return nil
+			}
+			l, stat := limiter.Limit(), scope.Stat()
+			pressure = math.Max(pressure, ratio(float64(stat.Memory), float64(l.GetMemoryLimit())))
+			pressure = math.Max(pressure, ratio(float64(stat.NumConnsInbound+stat.NumConnsOutbound), float64(l.GetConnTotalLimit())))
+			pressure = math.Max(pressure, ratio(float64(stat.NumFD), float64(l.GetFDLimit())))
+			return nil
+		})
+		return pressure
+	})
+}
+
+// FDPressure returns a PressureSource reporting the number of open file descriptors of
+// the process relative to its file descriptor limit. It reports no pressure on
+// platforms where the open file descriptors can't be counted.
+func FDPressure() PressureSource {
+	return PressureFunc(func() float64 {
+		open, limit := fdUsage()
+		return ratio(float64(open), float64(limit))
+	})
+}
+
+// ratio returns used/limit, or 0 for unlimited resources, whose limit is math.MaxInt
+// or math.MaxInt64 in the resource manager.
+func ratio(used, limit float64) float64 {
+	if limit <= 0 || limit >= float64(math.MaxInt) {
+		return 0
+	}
+	return used / limit
+}
+
+// AdaptiveCfg is the configuration of adaptive watermarks, see WithAdaptiveWatermarks.
+type AdaptiveCfg struct {
+	// Sources report the resource pressure. The highest pressure reported is used.
+	Sources []PressureSource
+	// Interval is how often the pressure is checked.
+	Interval time.Duration
+	// Threshold is the pressure above which the watermarks shrink.
+	Threshold float64
+	// MinScale is the smallest fraction of the configured watermarks that is used, when
+	// a resource is exhausted.
+	MinScale float64
+	// GrowStep is the largest fraction of the configured watermarks by which the
+	// watermarks grow back per Interval once the pressure decreases.
+	GrowStep float64
+}
+
+// WithDefaults writes the default values on this AdaptiveCfg instance,
+// and returns itself for chainability.
+func (cfg *AdaptiveCfg) WithDefaults() *AdaptiveCfg {
+	cfg.Interval = 10 * time.Second
+	cfg.Threshold = 0.7
+	cfg.MinScale = 0.25
+	cfg.GrowStep = 0.1
+	return cfg
+}
+
+func (cfg *AdaptiveCfg) validate() error {
+	if len(cfg.Sources) == 0 {
+		return errors.New("adaptive watermarks need at least one pressure source")
+	}
+	if cfg.Interval <= 0 {
+		return errors.New("adaptive watermark interval must be positive")
+	}
+	if cfg.Threshold < 0 || cfg.Threshold >= 1 {
+		return errors.New("adaptive watermark threshold must satisfy 0 <= threshold < 1")
+	}
+	if cfg.MinScale <= 0 || cfg.MinScale > 1 {
+		return errors.New("adaptive watermark minimum scale must satisfy 0 < scale <= 1")
+	}
+	if cfg.GrowStep <= 0 {
+		return errors.New("adaptive watermark grow step must be positive")
+	}
+	return nil
+}
+
+// targetScale returns the scale of the watermarks for the given pressure. It shrinks
+// linearly from 1 at the threshold to MinScale when a resource is exhausted.
+func (cfg *AdaptiveCfg) targetScale(pressure float64) float64 {
+	if pressure <= cfg.Threshold {
+		return 1
+	}
+	excess := math.Min((pressure-cfg.Threshold)/(1-cfg.Threshold), 1)
+	return 1 - excess*(1-cfg.MinScale)
+}
+
+// watermarks returns the current low and high watermarks, which are scaled down under
+// resource pressure if adaptive watermarks are enabled.
+func (cm *BasicConnMgr) watermarks() (low, high int) {
+	w := cm.water.Load()
+	if cm.cfg.adaptive == nil {
+		return w.low, w.high
+	}
+	scale := math.Float64frombits(cm.watermarkScale.Load())
+	return int(float64(w.low) * scale), int(float64(w.high) * scale)
+}
+
+// adapt updates the scale of the watermarks to the current pressure. The watermarks
+// shrink immediately, but only grow back by GrowStep at a time, so that the
+// connection set doesn't oscillate. It returns true if the watermarks shrank.
+func (cm *BasicConnMgr) adapt() bool {
+	cfg := cm.cfg.adaptive
+	var pressure float64
+	for _, src := range cfg.Sources {
+		pressure = math.Max(pressure, src.Pressure())
+	}
+	current := math.Float64frombits(cm.watermarkScale.Load())
+	scale := cfg.targetScale(pressure)
+	if scale > current {
+		scale = math.Min(scale, current+cfg.GrowStep)
+	}
+	if scale == current {
+		return false
+	}
+	cm.watermarkScale.Store(math.Float64bits(scale))
+	low, high := cm.watermarks()
+	log.Debugw("adjusted watermarks", "pressure", pressure, "scale", scale, "low", low, "high", high)
+	return scale < current
+}
+
+// adaptive periodically adjusts the watermarks to the resource pressure, and trims as
+// soon as they shrink below the connection count.
+func (cm *BasicConnMgr) adaptive() {
+	defer cm.refCount.Done()
+
+	ticker := cm.clock.Ticker(cm.cfg.adaptive.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !cm.adapt() {
+				continue
+			}
+			if _, high := cm.watermarks(); int(cm.connCount.Load()) > high {
+				cm.doTrim()
+			}
+		case <-cm.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package connmgr
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// fdUsage returns the number of open file descriptors and the soft limit.
+func fdUsage() (open, limit int) {
+	var l unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &l); err != nil {
+		log.Errorw("failed to get fd limit", "error", err)
+		return 0, 0
+	}
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		log.Errorw("failed to count open fds", "error", err)
+		return 0, 0
+	}
+	return len(fds), int(l.Cur)
+}
@@ -2,6 +2,9 @@ package connmgr
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -39,12 +42,24 @@ type BasicConnMgr struct {
 	// channel-based semaphore that enforces only a single trim is in progress
 	trimMutex sync.Mutex
 	connCount atomic.Int32
+	// connection counts per direction, indexed by network.Direction
+	dirConnCount [3]atomic.Int32
 	// to be accessed atomically. This is mimicking the implementation of a sync.Once.
 	// Take care of correct alignment when modifying this struct.
 	trimCount uint64
 
-	lastTrimMu sync.RWMutex
-	lastTrim   time.Time
+	lastTrimMu     sync.RWMutex
+	lastTrim       time.Time
+	lastTrimReport *connmgr.TrimReport
+
+	// events is set once the connection manager emits events, see EmitEvents.
+	events atomic.Pointer[trimEvents]
+
+	// water holds the configured watermarks, see SetWatermarks.
+	water atomic.Pointer[watermarks]
+	// watermarkScale holds the float64 bits of the factor the watermarks are scaled
+	// with, see WithAdaptiveWatermarks.
+	watermarkScale atomic.Uint64
 
 	refCount                sync.WaitGroup
 	ctx                     context.Context
@@ -138,18 +153,27 @@ func NewConnManager(low, hi int, opts ...Option) (*BasicConnMgr, error) {
 		}
 	}
 
+	decay, err := NewDecayer(cfg.decayer, cm)
+	if err != nil {
+		return nil, err
+	}
+	cm.decayer = decay
+
 	cm.ctx, cm.cancel = context.WithCancel(context.Background())
+	cm.water.Store(&watermarks{low: cfg.lowWater, high: cfg.highWater})
+	cm.watermarkScale.Store(math.Float64bits(1))
 
 	if cfg.emergencyTrim {
 		// When we're running low on memory, immediately trigger a trim.
 		cm.unregisterMemoryWatcher = registerWatchdog(cm.memoryEmergency)
 	}
 
-	decay, _ := NewDecayer(cfg.decayer, cm)
-	cm.decayer = decay
-
 	cm.refCount.Add(1)
 	go cm.background()
+	if cfg.adaptive != nil {
+		cm.refCount.Add(1)
+		go cm.adaptive()
+	}
 	return cm, nil
 }
 
@@ -159,9 +183,10 @@ func NewConnManager(low, hi int, opts ...Option) (*BasicConnMgr, error) {
 // We try to not kill protected connections, but if that turns out to be necessary, not connection is safe!
 func (cm *BasicConnMgr) memoryEmergency() {
 	connCount := int(cm.connCount.Load())
-	target := connCount - cm.cfg.lowWater
+	lowWater, _ := cm.watermarks()
+	target := connCount - lowWater
 	if target < 0 {
-		log.Warnw("Low on memory, but we only have a few connections", "num", connCount, "low watermark", cm.cfg.lowWater)
+		log.Warnw("Low on memory, but we only have a few connections", "num", connCount, "low watermark", lowWater)
 		return
 	} else {
 		log.Warnf("Low on memory. Closing %d connections.", target)
@@ -171,11 +196,20 @@ func (cm *BasicConnMgr) memoryEmergency() {
 	defer atomic.AddUint64(&cm.trimCount, 1)
 	defer cm.trimMutex.Unlock()
 
-	// Trim connections without paying attention to the silence period.
+	start := cm.clock.Now()
+	cm.emitTrimStarted(start, connCount)
+	sel := newConnSelection()
 	for _, c := range cm.getConnsToCloseEmergency(target) {
+		sel.add(c, connmgr.PruneReasonMemory)
+	}
+	report := cm.newTrimReport(start, connCount, sel)
+
+	// Trim connections without paying attention to the silence period.
+	for _, c := range sel.conns {
 		log.Infow("low on memory. closing conn", "peer", c.RemotePeer())
 		c.Close()
 	}
+	cm.finishTrim(report)
 
 	// finally, update the last trim time.
 	cm.lastTrimMu.Lock()
@@ -192,6 +226,10 @@ func (cm *BasicConnMgr) Close() error {
 		return err
 	}
 	cm.refCount.Wait()
+	if ev := cm.events.Load(); ev != nil {
+		ev.started.Close()
+		ev.finished.Close()
+	}
 	return nil
 }
 
@@ -250,6 +288,12 @@ type peerInfo struct {
 
 	conns map[network.Conn]time.Time // start time of each connection
 
+	// lastActive holds the last time each connection was seen with non-keepalive
+	// streams, if it ever was. Only tracked if idle pruning is enabled.
+	lastActive map[network.Conn]time.Time
+	// idle is true if all connections were idle at the last activity update.
+	idle bool
+
 	firstSeen time.Time // timestamp when we began tracking this peer.
 }
 
@@ -283,6 +327,10 @@ func (p peerInfos) SortByValueAndStreams(segments *segments, sortByMoreStreams b
 		if left.temp != right.temp {
 			return left.temp
 		}
+		// then idle peers, see WithIdlePruning.
+		if left.idle != right.idle {
+			return left.idle
+		}
 		// otherwise, compare by value.
 		if left.value != right.value {
 			return left.value < right.value
@@ -346,7 +394,10 @@ func (cm *BasicConnMgr) background() {
 	for {
 		select {
 		case <-ticker.C:
-			if cm.connCount.Load() < int32(cm.cfg.highWater) {
+			if cm.cfg.idlePeriod > 0 {
+				cm.updateActivity()
+			}
+			if _, highWater := cm.watermarks(); cm.connCount.Load() < int32(highWater) && !cm.limitsExceeded() {
 				// Below high water, skip.
 				continue
 			}
@@ -373,11 +424,18 @@ func (cm *BasicConnMgr) doTrim() {
 
 // trim starts the trim, if the last trim happened before the configured silence period.
 func (cm *BasicConnMgr) trim() {
+	start := cm.clock.Now()
+	connCount := int(cm.connCount.Load())
+	cm.emitTrimStarted(start, connCount)
+
+	sel := cm.selectConnsToClose()
+	report := cm.newTrimReport(start, connCount, sel)
 	// do the actual trim.
-	for _, c := range cm.getConnsToClose() {
+	for _, c := range sel.conns {
 		log.Debugw("closing conn", "peer", c.RemotePeer())
 		c.Close()
 	}
+	cm.finishTrim(report)
 }
 
 func (cm *BasicConnMgr) getConnsToCloseEmergency(target int) []network.Conn {
@@ -451,14 +509,29 @@ func (cm *BasicConnMgr) getConnsToCloseEmergency(target int) []network.Conn {
 // getConnsToClose runs the heuristics described in TrimOpenConns and returns the
 // connections to close.
 func (cm *BasicConnMgr) getConnsToClose() []network.Conn {
-	if cm.cfg.lowWater == 0 || cm.cfg.highWater == 0 {
-		// disabled
-		return nil
-	}
+	return cm.selectConnsToClose().conns
+}
 
-	if int(cm.connCount.Load()) <= cm.cfg.lowWater {
+// selectConnsToClose runs the heuristics described in TrimOpenConns and returns the
+// connections to close, along with the reasons.
+func (cm *BasicConnMgr) selectConnsToClose() *connSelection {
+	sel := newConnSelection()
+	lowWater, highWater := cm.watermarks()
+	trimTotal := lowWater != 0 && highWater != 0
+	if trimTotal && int(cm.connCount.Load()) <= lowWater {
 		log.Info("open connection count below limit")
-		return nil
+		trimTotal = false
+	}
+	// a direction is only trimmed when it exceeds its own high watermark, like in
+	// limitsExceeded
+	trimInbound := cm.cfg.inbound.enabled() && int(cm.dirConnCount[network.DirInbound].Load()) > cm.cfg.inbound.high
+	trimOutbound := cm.cfg.outbound.enabled() && int(cm.dirConnCount[network.DirOutbound].Load()) > cm.cfg.outbound.high
+	if !trimTotal && !trimInbound && !trimOutbound && len(cm.cfg.protocolLimits) == 0 && len(cm.cfg.groups) == 0 {
+		// disabled
+		return sel
+	}
+	if cm.cfg.idlePeriod > 0 {
+		cm.updateActivity()
 	}
 
 	candidates := make(peerInfos, 0, cm.segments.countPeers())
@@ -485,23 +558,33 @@ func (cm *BasicConnMgr) getConnsToClose() []network.Conn {
 		s.Unlock()
 	}
 	cm.plk.RUnlock()
+	sel.groups = cm.countGroups()
+
+	// Sort peers according to their value.
+	candidates.SortByValueAndStreams(&cm.segments, false)
+
+	if trimInbound {
+		cm.selectByDirection(candidates, network.DirInbound, cm.cfg.inbound.low, connmgr.PruneReasonInbound, sel)
+	}
+	if trimOutbound {
+		cm.selectByDirection(candidates, network.DirOutbound, cm.cfg.outbound.low, connmgr.PruneReasonOutbound, sel)
+	}
+	cm.selectByProtocol(candidates, sel)
+	cm.selectByGroup(candidates, sel)
 
-	if ncandidates < cm.cfg.lowWater {
+	if !trimTotal {
+		return sel
+	}
+	if ncandidates < lowWater {
 		log.Info("open connection count above limit but too many are in the grace period")
 		// We have too many connections but fewer than lowWater
 		// connections out of the grace period.
 		//
 		// If we trimmed now, we'd kill potentially useful connections.
-		return nil
+		return sel
 	}
 
-	// Sort peers according to their value.
-	candidates.SortByValueAndStreams(&cm.segments, false)
-
-	target := ncandidates - cm.cfg.lowWater
-
-	// slightly overallocate because we may have more than one conns per peer
-	selected := make([]network.Conn, 0, target+10)
+	target := ncandidates - lowWater - len(sel.conns)
 
 	for _, inf := range candidates {
 		if target <= 0 {
@@ -514,17 +597,22 @@ func (cm *BasicConnMgr) getConnsToClose() []network.Conn {
 		if len(inf.conns) == 0 && inf.temp {
 			// handle temporary entries for early tags -- this entry has gone past the grace period
 			// and still holds no connections, so prune it.
+			cm.decayer.stash(inf)
 			delete(s.peers, inf.id)
 		} else {
 			for c := range inf.conns {
-				selected = append(selected, c)
+				if !sel.groups.allowed(inf.id) {
+					break
+				}
+				if sel.add(c, connmgr.PruneReasonWatermark) {
+					target--
+				}
 			}
-			target -= len(inf.conns)
 		}
 		s.Unlock()
 	}
 
-	return selected
+	return sel
 }
 
 // GetTagInfo is called to fetch the tag information associated with a given
@@ -605,10 +693,12 @@ func (cm *BasicConnMgr) UpsertTag(p peer.ID, tag string, upsert func(int) int) {
 
 // CMInfo holds the configuration for BasicConnMgr, as well as status data.
 type CMInfo struct {
-	// The low watermark, as described in NewConnManager.
+	// The low watermark, as described in NewConnManager. It's scaled down under
+	// resource pressure if adaptive watermarks are enabled.
 	LowWater int
 
-	// The high watermark, as described in NewConnManager.
+	// The high watermark, as described in NewConnManager. It's scaled down under
+	// resource pressure if adaptive watermarks are enabled.
 	HighWater int
 
 	// The timestamp when the last trim was triggered.
@@ -619,6 +709,25 @@ type CMInfo struct {
 
 	// The current connection count.
 	ConnCount int
+
+	// The current inbound and outbound connection counts.
+	InboundConnCount  int
+	OutboundConnCount int
+}
+
+// SetWatermarks changes the low and high watermarks, as described in NewConnManager,
+// on a running connection manager. If the connection count is above the new high
+// watermark, the connections are trimmed on the next check. The adaptive watermarks
+// scale the new watermarks.
+func (cm *BasicConnMgr) SetWatermarks(low, high int) error {
+	if low < 0 || high < 0 {
+		return errors.New("watermarks must not be negative")
+	}
+	if low > high {
+		return fmt.Errorf("low watermark %d is above the high watermark %d", low, high)
+	}
+	cm.water.Store(&watermarks{low: low, high: high})
+	return nil
 }
 
 // GetInfo returns the configuration and status data for this connection manager.
@@ -626,13 +735,17 @@ func (cm *BasicConnMgr) GetInfo() CMInfo {
 	cm.lastTrimMu.RLock()
 	lastTrim := cm.lastTrim
 	cm.lastTrimMu.RUnlock()
+	lowWater, highWater := cm.watermarks()
 
 	return CMInfo{
-		HighWater:   cm.cfg.highWater,
-		LowWater:    cm.cfg.lowWater,
+		HighWater:   highWater,
+		LowWater:    lowWater,
 		LastTrim:    lastTrim,
 		GracePeriod: cm.cfg.gracePeriod,
 		ConnCount:   int(cm.connCount.Load()),
+
+		InboundConnCount:  int(cm.dirConnCount[network.DirInbound].Load()),
+		OutboundConnCount: int(cm.dirConnCount[network.DirOutbound].Load()),
 	}
 }
 
@@ -671,12 +784,14 @@ func (nn *cmNotifee) Connected(n network.Network, c network.Conn) {
 			conns:     make(map[network.Conn]time.Time),
 		}
 		s.peers[id] = pinfo
+		cm.decayer.restore(pinfo)
 	} else if pinfo.temp {
 		// we had created a temporary entry for this peer to buffer early tags before the
 		// Connected notification arrived: flip the temporary flag, and update the firstSeen
 		// timestamp to the real one.
 		pinfo.temp = false
 		pinfo.firstSeen = cm.clock.Now()
+		cm.decayer.restore(pinfo)
 	}
 
 	_, ok = pinfo.conns[c]
@@ -687,6 +802,7 @@ func (nn *cmNotifee) Connected(n network.Network, c network.Conn) {
 
 	pinfo.conns[c] = cm.clock.Now()
 	cm.connCount.Add(1)
+	cm.dirConnCount[c.Stat().Direction].Add(1)
 }
 
 // Disconnected is called by notifiers to inform that an existing connection has been closed or terminated.
@@ -712,10 +828,13 @@ func (nn *cmNotifee) Disconnected(n network.Network, c network.Conn) {
 	}
 
 	delete(cinf.conns, c)
+	delete(cinf.lastActive, c)
 	if len(cinf.conns) == 0 {
+		cm.decayer.stash(cinf)
 		delete(s.peers, p)
 	}
 	cm.connCount.Add(-1)
+	cm.dirConnCount[c.Stat().Direction].Add(-1)
 }
 
 // Listen is no-op in this implementation.
@@ -8,10 +8,14 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/libp2p/go-libp2p/core/connmgr"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	tu "github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
 
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
@@ -23,6 +27,9 @@ type tconn struct {
 	peer             peer.ID
 	closed           uint32 // to be used atomically. Closed if 1
 	disconnectNotify func(net network.Network, conn network.Conn)
+
+	dir     network.Direction // outbound if unset
+	streams []network.Stream
 }
 
 func (c *tconn) Close() error {
@@ -42,14 +49,31 @@ func (c *tconn) RemotePeer() peer.ID {
 }
 
 func (c *tconn) Stat() network.ConnStats {
+	dir := c.dir
+	if dir == network.DirUnknown {
+		dir = network.DirOutbound
+	}
 	return network.ConnStats{
 		Stats: network.Stats{
-			Direction: network.DirOutbound,
+			Direction: dir,
 		},
 		NumStreams: 1,
 	}
 }
 
+func (c *tconn) GetStreams() []network.Stream {
+	return c.streams
+}
+
+type tstream struct {
+	network.Stream
+	proto protocol.ID
+}
+
+func (s *tstream) Protocol() protocol.ID {
+	return s.proto
+}
+
 func (c *tconn) RemoteMultiaddr() ma.Multiaddr {
 	addr, err := ma.NewMultiaddr("/ip4/127.0.0.1/udp/1234")
 	if err != nil {
@@ -327,6 +351,261 @@ func TestUntagPeer(t *testing.T) {
 	}
 }
 
+func TestDirectionLimits(t *testing.T) {
+	cm, err := NewConnManager(100, 200, WithGracePeriod(0), WithInboundLimits(2, 4))
+	require.NoError(t, err)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	var inbound, outbound []*tconn
+	for i := 0; i < 6; i++ {
+		c := &tconn{peer: tu.RandPeerIDFatal(t), dir: network.DirInbound, disconnectNotify: not.Disconnected}
+		inbound = append(inbound, c)
+		not.Connected(nil, c)
+	}
+	for i := 0; i < 3; i++ {
+		c := &tconn{peer: tu.RandPeerIDFatal(t), disconnectNotify: not.Disconnected}
+		outbound = append(outbound, c)
+		not.Connected(nil, c)
+	}
+	// the most valuable inbound connections are kept
+	cm.TagPeer(inbound[0].peer, "foo", 10)
+	cm.TagPeer(inbound[1].peer, "foo", 10)
+	require.True(t, cm.limitsExceeded())
+
+	cm.TrimOpenConns(context.Background())
+	info := cm.GetInfo()
+	require.Equal(t, 2, info.InboundConnCount)
+	require.Equal(t, 3, info.OutboundConnCount)
+	require.False(t, inbound[0].isClosed())
+	require.False(t, inbound[1].isClosed())
+	for _, c := range outbound {
+		require.False(t, c.isClosed())
+	}
+	require.False(t, cm.limitsExceeded())
+
+	_, err = NewConnManager(100, 200, WithOutboundLimits(4, 2))
+	require.Error(t, err)
+}
+
+func TestDirectionLimitsOnlyTrimExceededDirection(t *testing.T) {
+	// the total watermarks are exceeded, but neither direction is
+	cm, err := NewConnManager(3, 5, WithGracePeriod(0), WithInboundLimits(1, 4), WithOutboundLimits(1, 4))
+	require.NoError(t, err)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	var outbound []*tconn
+	for i := 0; i < 3; i++ {
+		c := &tconn{peer: tu.RandPeerIDFatal(t), dir: network.DirInbound, disconnectNotify: not.Disconnected}
+		cm.TagPeer(c.peer, "foo", 10)
+		not.Connected(nil, c)
+	}
+	for i := 0; i < 3; i++ {
+		c := &tconn{peer: tu.RandPeerIDFatal(t), disconnectNotify: not.Disconnected}
+		outbound = append(outbound, c)
+		not.Connected(nil, c)
+	}
+
+	// only the watermark trim applies, which closes the least valuable connections
+	cm.TrimOpenConns(context.Background())
+	info := cm.GetInfo()
+	require.Equal(t, 3, info.InboundConnCount)
+	require.Equal(t, 0, info.OutboundConnCount)
+	for _, c := range outbound {
+		require.True(t, c.isClosed())
+	}
+}
+
+func TestDirectionLimitsCountProtected(t *testing.T) {
+	cm, err := NewConnManager(100, 200, WithGracePeriod(0), WithInboundLimits(2, 3))
+	require.NoError(t, err)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	var inbound []*tconn
+	for i := 0; i < 5; i++ {
+		c := &tconn{peer: tu.RandPeerIDFatal(t), dir: network.DirInbound, disconnectNotify: not.Disconnected}
+		inbound = append(inbound, c)
+		not.Connected(nil, c)
+	}
+	cm.Protect(inbound[0].peer, "foo")
+	cm.Protect(inbound[1].peer, "foo")
+
+	// the protected connections count towards the low watermark, so all other
+	// inbound connections are closed
+	cm.TrimOpenConns(context.Background())
+	require.Equal(t, 2, cm.GetInfo().InboundConnCount)
+	require.False(t, inbound[0].isClosed())
+	require.False(t, inbound[1].isClosed())
+}
+
+func TestProtocolLimits(t *testing.T) {
+	cm, err := NewConnManager(100, 200, WithGracePeriod(0), WithProtocolLimit("/bitswap", 2))
+	require.NoError(t, err)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	newConn := func(protos ...protocol.ID) *tconn {
+		c := &tconn{peer: tu.RandPeerIDFatal(t), disconnectNotify: not.Disconnected}
+		for _, p := range protos {
+			c.streams = append(c.streams, &tstream{proto: p})
+		}
+		not.Connected(nil, c)
+		return c
+	}
+	var bitswap []*tconn
+	for i := 0; i < 4; i++ {
+		bitswap = append(bitswap, newConn("/bitswap", "/bitswap", "/kad"))
+	}
+	kad := newConn("/kad", "/kad")
+	mixed := newConn("/bitswap", "/kad")
+	cm.TagPeer(bitswap[3].peer, "foo", 10)
+	require.True(t, cm.limitsExceeded())
+
+	cm.TrimOpenConns(context.Background())
+	require.False(t, bitswap[3].isClosed())
+	var open int
+	for _, c := range bitswap {
+		if !c.isClosed() {
+			open++
+		}
+	}
+	require.Equal(t, 2, open)
+	require.False(t, kad.isClosed())
+	require.False(t, mixed.isClosed())
+	require.False(t, cm.limitsExceeded())
+}
+
+func TestPeerGroups(t *testing.T) {
+	cm, err := NewConnManager(2, 4, WithGracePeriod(0), WithPeerGroup("mesh", 2, 0), WithPeerGroup("random", 0, 1))
+	require.NoError(t, err)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	newConns := func(n int, tag string, value int) []*tconn {
+		var conns []*tconn
+		for i := 0; i < n; i++ {
+			c := &tconn{peer: tu.RandPeerIDFatal(t), disconnectNotify: not.Disconnected}
+			not.Connected(nil, c)
+			if tag != "" {
+				cm.TagPeer(c.peer, tag, value)
+			}
+			conns = append(conns, c)
+		}
+		return conns
+	}
+	untagged := newConns(2, "", 0)
+	mesh := newConns(3, "mesh:topic", 1)
+	random := newConns(3, "random", 5)
+	require.True(t, cm.limitsExceeded())
+
+	cm.TrimOpenConns(context.Background())
+	// the group minimum is honored, although the mesh peers have a lower value
+	var open int
+	for _, c := range mesh {
+		if !c.isClosed() {
+			open++
+		}
+	}
+	require.Equal(t, 2, open)
+	for _, c := range append(untagged, random...) {
+		require.True(t, c.isClosed())
+	}
+	require.Equal(t, 2, cm.GetInfo().ConnCount)
+
+	var groupPruned int
+	for _, pp := range cm.LastTrimReport().Pruned {
+		if pp.Reason == connmgr.PruneReasonGroup {
+			groupPruned++
+		}
+	}
+	require.Equal(t, 2, groupPruned)
+
+	_, err = NewConnManager(2, 4, WithPeerGroup("mesh", 3, 2))
+	require.Error(t, err)
+}
+
+func TestIdlePruning(t *testing.T) {
+	clk := clock.NewMock()
+	cm, err := NewConnManager(1, 10, WithGracePeriod(0), WithClock(clk), WithIdlePruning(time.Minute))
+	require.NoError(t, err)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	newConn := func(protos ...protocol.ID) *tconn {
+		c := &tconn{peer: tu.RandPeerIDFatal(t), disconnectNotify: not.Disconnected}
+		for _, p := range protos {
+			c.streams = append(c.streams, &tstream{proto: p})
+		}
+		not.Connected(nil, c)
+		return c
+	}
+	keepalive := newConn(pingProtocol)
+	active := newConn("/foo")
+	idle := newConn()
+	// idle peers are pruned first, even if they're more valuable
+	cm.TagPeer(keepalive.peer, "foo", 100)
+	cm.TagPeer(idle.peer, "foo", 100)
+
+	cm.updateActivity()
+	clk.Add(2 * time.Minute)
+	cm.TrimOpenConns(context.Background())
+	require.True(t, keepalive.isClosed())
+	require.True(t, idle.isClosed())
+	require.False(t, active.isClosed())
+
+	_, err = NewConnManager(1, 10, WithIdlePruning(0))
+	require.Error(t, err)
+}
+
+func TestTrimReport(t *testing.T) {
+	cm, err := NewConnManager(1, 10, WithGracePeriod(0), WithInboundLimits(0, 1))
+	require.NoError(t, err)
+	defer cm.Close()
+	bus := eventbus.NewBus()
+	sub, err := bus.Subscribe([]interface{}{new(event.EvtConnManagerTrimStarted), new(event.EvtConnManagerTrimFinished)}, eventbus.BufSize(4))
+	require.NoError(t, err)
+	defer sub.Close()
+	require.NoError(t, cm.EmitEvents(bus))
+	require.Nil(t, cm.LastTrimReport())
+
+	not := cm.Notifee()
+	// the inbound connections exceed their high watermark
+	inbound := &tconn{peer: tu.RandPeerIDFatal(t), dir: network.DirInbound, disconnectNotify: not.Disconnected}
+	not.Connected(nil, inbound)
+	inbound2 := &tconn{peer: tu.RandPeerIDFatal(t), dir: network.DirInbound, disconnectNotify: not.Disconnected}
+	not.Connected(nil, inbound2)
+	var outbound []*tconn
+	for i := 0; i < 3; i++ {
+		c := &tconn{peer: tu.RandPeerIDFatal(t), disconnectNotify: not.Disconnected}
+		outbound = append(outbound, c)
+		not.Connected(nil, c)
+	}
+	cm.TagPeer(inbound.peer, "foo", 10)
+	cm.TagPeer(inbound2.peer, "foo", 30)
+	cm.TagPeer(outbound[0].peer, "foo", 5)
+	cm.TagPeer(outbound[1].peer, "foo", 20)
+	cm.TagPeer(outbound[2].peer, "foo", 20)
+
+	cm.TrimOpenConns(context.Background())
+	report := cm.LastTrimReport()
+	require.NotNil(t, report)
+	require.Equal(t, 5, report.ConnCount)
+	require.Equal(t, []connmgr.PrunedPeer{
+		{Peer: inbound.peer, Reason: connmgr.PruneReasonInbound, Conns: 1, Value: 10, Tags: map[string]int{"foo": 10}},
+		{Peer: inbound2.peer, Reason: connmgr.PruneReasonInbound, Conns: 1, Value: 30, Tags: map[string]int{"foo": 30}},
+		{Peer: outbound[0].peer, Reason: connmgr.PruneReasonWatermark, Conns: 1, Value: 5, Tags: map[string]int{"foo": 5}},
+	}, report.Pruned[:3])
+	require.Len(t, report.Pruned, 4)
+
+	started := (<-sub.Out()).(event.EvtConnManagerTrimStarted)
+	require.Equal(t, report.Start, started.Start)
+	require.Equal(t, 5, started.ConnCount)
+	finished := (<-sub.Out()).(event.EvtConnManagerTrimFinished)
+	require.Equal(t, *report, finished.Report)
+}
+
 func TestGetInfo(t *testing.T) {
 	start := time.Now()
 	const gp = 10 * time.Minute
@@ -357,6 +636,40 @@ func TestGetInfo(t *testing.T) {
 	}
 }
 
+func TestSetWatermarks(t *testing.T) {
+	cm, err := NewConnManager(20, 30, WithGracePeriod(0))
+	require.NoError(t, err)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	var conns []network.Conn
+	for i := 0; i < 20; i++ {
+		rc := randConn(t, nil)
+		conns = append(conns, rc)
+		not.Connected(nil, rc)
+	}
+	cm.TrimOpenConns(context.Background())
+	for _, c := range conns {
+		require.False(t, c.(*tconn).isClosed())
+	}
+
+	require.Error(t, cm.SetWatermarks(-1, 10))
+	require.Error(t, cm.SetWatermarks(10, 5))
+	require.NoError(t, cm.SetWatermarks(5, 10))
+	info := cm.GetInfo()
+	require.Equal(t, 5, info.LowWater)
+	require.Equal(t, 10, info.HighWater)
+
+	cm.TrimOpenConns(context.Background())
+	var closed int
+	for _, c := range conns {
+		if c.(*tconn).isClosed() {
+			closed++
+		}
+	}
+	require.Equal(t, 15, closed)
+}
+
 func TestDoubleConnection(t *testing.T) {
 	const gp = 10 * time.Minute
 	cm, err := NewConnManager(1, 5, WithGracePeriod(gp))
@@ -966,3 +1279,45 @@ func TestSafeConcurrency(t *testing.T) {
 		wg.Wait()
 	})
 }
+
+func TestAdaptiveWatermarks(t *testing.T) {
+	clk := clock.NewMock()
+	var pressure atomic.Value
+	pressure.Store(0.0)
+	cfg := (&AdaptiveCfg{}).WithDefaults()
+	cfg.Interval = time.Second
+	cfg.Sources = []PressureSource{PressureFunc(func() float64 { return pressure.Load().(float64) })}
+	cm, err := NewConnManager(8, 20, WithClock(clk), WithGracePeriod(0), WithSilencePeriod(time.Hour), WithAdaptiveWatermarks(cfg))
+	require.NoError(t, err)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	for i := 0; i < 12; i++ {
+		not.Connected(nil, &tconn{peer: tu.RandPeerIDFatal(t), disconnectNotify: not.Disconnected})
+	}
+
+	// the watermarks shrink to a quarter when a resource is exhausted, and the
+	// connections are trimmed right away
+	pressure.Store(1.0)
+	require.Eventually(t, func() bool {
+		clk.Add(time.Second)
+		return cm.GetInfo().ConnCount == 2
+	}, time.Second, 10*time.Millisecond)
+	info := cm.GetInfo()
+	require.Equal(t, 2, info.LowWater)
+	require.Equal(t, 5, info.HighWater)
+
+	// they grow back step by step once the pressure decreases
+	pressure.Store(0.0)
+	clk.Add(time.Second)
+	require.Eventually(t, func() bool { return cm.GetInfo().HighWater > 5 }, time.Second, 10*time.Millisecond)
+	require.Less(t, cm.GetInfo().HighWater, 20)
+	require.Eventually(t, func() bool {
+		clk.Add(time.Second)
+		info := cm.GetInfo()
+		return info.LowWater == 8 && info.HighWater == 20
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = NewConnManager(8, 20, WithAdaptiveWatermarks((&AdaptiveCfg{}).WithDefaults()))
+	require.Error(t, err)
+}
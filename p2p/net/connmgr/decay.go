@@ -10,11 +10,16 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 
 	"github.com/benbjohnson/clock"
+	ds "github.com/ipfs/go-datastore"
 )
 
 // DefaultResolution is the default resolution of the decay tracker.
 var DefaultResolution = 1 * time.Minute
 
+// DefaultPersistTTL is the default time after which the persisted values of peers
+// that aren't connected are dropped.
+var DefaultPersistTTL = 30 * 24 * time.Hour
+
 // bumpCmd represents a bump command.
 type bumpCmd struct {
 	peer  peer.ID
@@ -37,6 +42,11 @@ type decayer struct {
 	tagsMu    sync.Mutex
 	knownTags map[string]*decayingTag
 
+	// pending holds the values restored from the datastore that weren't applied to a
+	// peer yet, by tag name.
+	pendingMu sync.Mutex
+	pending   map[string]map[peer.ID]storedValue
+
 	// lastTick stores the last time the decayer ticked. Guarded by atomic.
 	lastTick atomic.Pointer[time.Time]
 
@@ -57,6 +67,20 @@ var _ connmgr.Decayer = (*decayer)(nil)
 type DecayerCfg struct {
 	Resolution time.Duration
 	Clock      clock.Clock
+
+	// Datastore, if set, is used to persist the values of decaying tags across
+	// restarts. They're written when the decayer is closed, and every PersistInterval.
+	// Once a tag is registered again, its restored values are applied to the peers
+	// as soon as they're tracked by the connection manager.
+	Datastore ds.Datastore
+	// PersistInterval is the interval at which the values of decaying tags are
+	// written to the Datastore. Zero means they're only written on close.
+	PersistInterval time.Duration
+	// PersistTTL is the time after their last visit at which the persisted values of
+	// peers that aren't connected are dropped. The values of disconnected peers are
+	// persisted too, so that long-term scores survive both disconnections and
+	// restarts. Zero means they're never dropped.
+	PersistTTL time.Duration
 }
 
 // WithDefaults writes the default values on this DecayerConfig instance,
@@ -67,6 +91,7 @@ type DecayerCfg struct {
 //	t := NewDecayer(cfg, cm)
 func (cfg *DecayerCfg) WithDefaults() *DecayerCfg {
 	cfg.Resolution = DefaultResolution
+	cfg.PersistTTL = DefaultPersistTTL
 	return cfg
 }
 
@@ -82,6 +107,7 @@ func NewDecayer(cfg *DecayerCfg, mgr *BasicConnMgr) (*decayer, error) {
 		mgr:         mgr,
 		clock:       cfg.Clock,
 		knownTags:   make(map[string]*decayingTag),
+		pending:     make(map[string]map[peer.ID]storedValue),
 		bumpTagCh:   make(chan bumpCmd, 128),
 		removeTagCh: make(chan removeCmd, 128),
 		closeTagCh:  make(chan *decayingTag, 128),
@@ -89,6 +115,12 @@ func NewDecayer(cfg *DecayerCfg, mgr *BasicConnMgr) (*decayer, error) {
 		doneCh:      make(chan struct{}),
 	}
 
+	if cfg.Datastore != nil {
+		if err := d.load(); err != nil {
+			return nil, err
+		}
+	}
+
 	now := d.clock.Now()
 	d.lastTick.Store(&now)
 
@@ -100,9 +132,8 @@ func NewDecayer(cfg *DecayerCfg, mgr *BasicConnMgr) (*decayer, error) {
 
 func (d *decayer) RegisterDecayingTag(name string, interval time.Duration, decayFn connmgr.DecayFn, bumpFn connmgr.BumpFn) (connmgr.DecayingTag, error) {
 	d.tagsMu.Lock()
-	defer d.tagsMu.Unlock()
-
 	if _, ok := d.knownTags[name]; ok {
+		d.tagsMu.Unlock()
 		return nil, fmt.Errorf("decaying tag with name %s already exists", name)
 	}
 
@@ -128,6 +159,11 @@ func (d *decayer) RegisterDecayingTag(name string, interval time.Duration, decay
 	}
 
 	d.knownTags[name] = tag
+	d.tagsMu.Unlock()
+
+	if d.cfg.Datastore != nil {
+		d.restoreTracked(tag)
+	}
 	return tag, nil
 }
 
@@ -155,6 +191,13 @@ func (d *decayer) process() {
 	ticker := d.clock.Ticker(d.cfg.Resolution)
 	defer ticker.Stop()
 
+	var persistCh <-chan time.Time
+	if d.cfg.Datastore != nil && d.cfg.PersistInterval > 0 {
+		persistTicker := d.clock.Ticker(d.cfg.PersistInterval)
+		defer persistTicker.Stop()
+		persistCh = persistTicker.C
+	}
+
 	var (
 		bmp   bumpCmd
 		visit = make(map[*decayingTag]struct{})
@@ -224,6 +267,12 @@ func (d *decayer) process() {
 
 			p := s.tagInfoFor(peer, d.clock.Now())
 			v, ok := p.decaying[tag]
+			if !ok && d.cfg.Datastore != nil {
+				if v, ok = d.takePending(tag, peer); ok {
+					p.decaying[tag] = v
+					p.value += v.Value
+				}
+			}
 			if !ok {
 				v = &connmgr.DecayingValue{
 					Tag:       tag,
@@ -275,7 +324,15 @@ func (d *decayer) process() {
 				s.Unlock()
 			}
 
+		case <-persistCh:
+			if err := d.persist(); err != nil {
+				log.Errorw("failed to persist decaying tags", "error", err)
+			}
+
 		case <-d.closeCh:
+			if d.cfg.Datastore != nil {
+				d.err = d.persist()
+			}
 			return
 		}
 	}
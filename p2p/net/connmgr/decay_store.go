@@ -0,0 +1,212 @@
+package connmgr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/multiformats/go-base32"
+)
+
+// Values of decaying tags are persisted under the following db key pattern:
+// /connmgr/decaying/<b32 tag name no padding>/<b32 peer id no padding>
+var decayingBase = ds.NewKey("/connmgr/decaying")
+
+// storedValue is a persisted value of a decaying tag.
+type storedValue struct {
+	Value     int
+	Added     time.Time
+	LastVisit time.Time
+}
+
+func decayingKey(tag string, p peer.ID) ds.Key {
+	return decayingBase.
+		ChildString(base32.RawStdEncoding.EncodeToString([]byte(tag))).
+		ChildString(base32.RawStdEncoding.EncodeToString([]byte(p)))
+}
+
+// load reads the persisted values of all decaying tags, by tag name.
+func (d *decayer) load() error {
+	res, err := d.cfg.Datastore.Query(context.Background(), query.Query{Prefix: decayingBase.String()})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return fmt.Errorf("failed to load decaying tags: %w", r.Error)
+		}
+		k := ds.RawKey(r.Key)
+		name, err := base32.RawStdEncoding.DecodeString(k.Parent().Name())
+		if err != nil {
+			return fmt.Errorf("failed to decode tag name of %s: %w", k, err)
+		}
+		id, err := base32.RawStdEncoding.DecodeString(k.Name())
+		if err != nil {
+			return fmt.Errorf("failed to decode peer ID of %s: %w", k, err)
+		}
+		var v storedValue
+		if err := json.Unmarshal(r.Value, &v); err != nil {
+			return fmt.Errorf("failed to decode value of %s: %w", k, err)
+		}
+		if d.expired(v) {
+			continue
+		}
+		vals, ok := d.pending[string(name)]
+		if !ok {
+			vals = make(map[peer.ID]storedValue)
+			d.pending[string(name)] = vals
+		}
+		vals[peer.ID(id)] = v
+	}
+	return nil
+}
+
+// expired returns true if v belongs to a peer that hasn't been visited for longer
+// than the PersistTTL.
+func (d *decayer) expired(v storedValue) bool {
+	return d.cfg.PersistTTL > 0 && d.clock.Since(v.LastVisit) > d.cfg.PersistTTL
+}
+
+// persist replaces the persisted values with the current values of all decaying
+// tags, including the values of disconnected peers and the restored values that
+// haven't been applied yet. Expired values are dropped.
+func (d *decayer) persist() error {
+	vals := make(map[ds.Key]storedValue)
+	for _, s := range d.mgr.segments.buckets {
+		s.Lock()
+		for p, inf := range s.peers {
+			for tag, v := range inf.decaying {
+				vals[decayingKey(tag.name, p)] = storedValue{Value: v.Value, Added: v.Added, LastVisit: v.LastVisit}
+			}
+		}
+		s.Unlock()
+	}
+	d.pendingMu.Lock()
+	for name, pvals := range d.pending {
+		for p, v := range pvals {
+			if d.expired(v) {
+				delete(pvals, p)
+				continue
+			}
+			if _, ok := vals[decayingKey(name, p)]; !ok {
+				vals[decayingKey(name, p)] = v
+			}
+		}
+		if len(pvals) == 0 {
+			delete(d.pending, name)
+		}
+	}
+	d.pendingMu.Unlock()
+
+	ctx := context.Background()
+	res, err := d.cfg.Datastore.Query(ctx, query.Query{Prefix: decayingBase.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		k := ds.RawKey(e.Key)
+		if _, ok := vals[k]; !ok {
+			if err := d.cfg.Datastore.Delete(ctx, k); err != nil {
+				return err
+			}
+		}
+	}
+	for k, v := range vals {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := d.cfg.Datastore.Put(ctx, k, b); err != nil {
+			return err
+		}
+	}
+	return d.cfg.Datastore.Sync(ctx, decayingBase)
+}
+
+// takePending removes and returns the restored value of tag for p, if there is one.
+func (d *decayer) takePending(tag *decayingTag, p peer.ID) (*connmgr.DecayingValue, bool) {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	v, ok := d.pending[tag.name][p]
+	if !ok {
+		return nil, false
+	}
+	delete(d.pending[tag.name], p)
+	if len(d.pending[tag.name]) == 0 {
+		delete(d.pending, tag.name)
+	}
+	return &connmgr.DecayingValue{Tag: tag, Peer: p, Added: v.Added, LastVisit: v.LastVisit, Value: v.Value}, true
+}
+
+// restore applies the restored values of the registered tags to pi. The lock of the
+// segment of pi must be held.
+func (d *decayer) restore(pi *peerInfo) {
+	if d == nil || d.cfg.Datastore == nil {
+		return
+	}
+	d.tagsMu.Lock()
+	tags := make([]*decayingTag, 0, len(d.knownTags))
+	for _, tag := range d.knownTags {
+		tags = append(tags, tag)
+	}
+	d.tagsMu.Unlock()
+
+	for _, tag := range tags {
+		if _, ok := pi.decaying[tag]; ok {
+			continue
+		}
+		if v, ok := d.takePending(tag, pi.id); ok {
+			pi.decaying[tag] = v
+			pi.value += v.Value
+		}
+	}
+}
+
+// stash keeps the values of the decaying tags of pi, whose peer is no longer tracked,
+// so that they're persisted, and restored if the peer connects again. The lock of the
+// segment of pi must be held.
+func (d *decayer) stash(pi *peerInfo) {
+	if d == nil || d.cfg.Datastore == nil || len(pi.decaying) == 0 {
+		return
+	}
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	for tag, v := range pi.decaying {
+		vals, ok := d.pending[tag.name]
+		if !ok {
+			vals = make(map[peer.ID]storedValue)
+			d.pending[tag.name] = vals
+		}
+		vals[pi.id] = storedValue{Value: v.Value, Added: v.Added, LastVisit: v.LastVisit}
+	}
+}
+
+// restoreTracked applies the restored values of tag to the peers that are already
+// tracked.
+func (d *decayer) restoreTracked(tag *decayingTag) {
+	for _, s := range d.mgr.segments.buckets {
+		s.Lock()
+		for p, pi := range s.peers {
+			if _, ok := pi.decaying[tag]; ok {
+				continue
+			}
+			if v, ok := d.takePending(tag, p); ok {
+				pi.decaying[tag] = v
+				pi.value += v.Value
+			}
+		}
+		s.Unlock()
+	}
+}
@@ -1,6 +1,7 @@
 package connmgr
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -10,6 +11,9 @@ import (
 	tu "github.com/libp2p/go-libp2p/core/test"
 
 	"github.com/benbjohnson/clock"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/stretchr/testify/require"
 )
 
@@ -199,6 +203,144 @@ func TestLinearDecayOverwrite(t *testing.T) {
 	eventuallyEqual(t, func() int { return mgr.GetTagInfo(id).Value }, 1000)
 }
 
+func TestExponentialDecay(t *testing.T) {
+	id := tu.RandPeerIDFatal(t)
+	mgr, decay, mockClock := testDecayTracker(t)
+
+	tag, err := decay.RegisterDecayingTag("beep", 250*time.Millisecond, connmgr.DecayExponential(500*time.Millisecond), connmgr.BumpOverwrite())
+	require.NoError(t, err)
+
+	_ = tag.Bump(id, 1000)
+	waitForTag(t, mgr, id)
+	eventuallyEqual(t, func() int { return mgr.GetTagInfo(id).Value }, 1000)
+
+	// two ticks per half life
+	mockClock.Add(250 * time.Millisecond)
+	eventuallyEqual(t, func() int { return mgr.GetTagInfo(id).Value }, 707)
+	mockClock.Add(250 * time.Millisecond)
+	eventuallyEqual(t, func() int { return mgr.GetTagInfo(id).Value }, 499)
+}
+
+func TestStepwiseDecay(t *testing.T) {
+	id := tu.RandPeerIDFatal(t)
+	mgr, decay, mockClock := testDecayTracker(t)
+
+	tag, err := decay.RegisterDecayingTag("beep", 250*time.Millisecond, connmgr.DecayStepwise(10, 100, 50), connmgr.BumpOverwrite())
+	require.NoError(t, err)
+
+	_ = tag.Bump(id, 80)
+	waitForTag(t, mgr, id)
+	eventuallyEqual(t, func() int { return mgr.GetTagInfo(id).Value }, 80)
+
+	mockClock.Add(250 * time.Millisecond)
+	eventuallyEqual(t, func() int { return mgr.GetTagInfo(id).Value }, 50)
+	mockClock.Add(250 * time.Millisecond)
+	eventuallyEqual(t, func() int { return mgr.GetTagInfo(id).Value }, 10)
+	mockClock.Add(250 * time.Millisecond)
+	eventuallyEqual(t, func() int { return len(mgr.GetTagInfo(id).Tags) }, 0)
+}
+
+func TestDecayPersistence(t *testing.T) {
+	id := tu.RandPeerIDFatal(t)
+	other := tu.RandPeerIDFatal(t)
+	store := dssync.MutexWrap(ds.NewMapDatastore())
+	newMgr := func() *BasicConnMgr {
+		cfg := &DecayerCfg{Resolution: TestResolution, Clock: clock.NewMock(), Datastore: store}
+		mgr, err := NewConnManager(10, 10, WithGracePeriod(time.Second), DecayerConfig(cfg))
+		require.NoError(t, err)
+		return mgr
+	}
+
+	mgr := newMgr()
+	beep, err := mgr.RegisterDecayingTag("beep", time.Second, connmgr.DecayNone(), connmgr.BumpSumUnbounded())
+	require.NoError(t, err)
+	bop, err := mgr.RegisterDecayingTag("bop", time.Second, connmgr.DecayNone(), connmgr.BumpSumUnbounded())
+	require.NoError(t, err)
+	require.NoError(t, beep.Bump(id, 10))
+	require.NoError(t, bop.Bump(other, 5))
+	eventuallyEqual(t, func() int {
+		if ti := mgr.GetTagInfo(other); ti != nil {
+			return ti.Value
+		}
+		return 0
+	}, 5)
+	require.NoError(t, mgr.Close())
+
+	// only beep is registered after the restart, the values of bop must survive anyway
+	mgr = newMgr()
+	_, err = mgr.RegisterDecayingTag("beep", time.Second, connmgr.DecayNone(), connmgr.BumpSumUnbounded())
+	require.NoError(t, err)
+	require.Nil(t, mgr.GetTagInfo(id))
+	mgr.Notifee().Connected(nil, &tconn{peer: id})
+	require.Equal(t, 10, mgr.GetTagInfo(id).Value)
+	require.NoError(t, mgr.Close())
+
+	// the values of peers that are already tracked are restored when the tag is registered
+	mgr = newMgr()
+	defer mgr.Close()
+	mgr.Notifee().Connected(nil, &tconn{peer: other})
+	require.Zero(t, mgr.GetTagInfo(other).Value)
+	bop, err = mgr.RegisterDecayingTag("bop", time.Second, connmgr.DecayNone(), connmgr.BumpSumUnbounded())
+	require.NoError(t, err)
+	require.Equal(t, 5, mgr.GetTagInfo(other).Tags["bop"])
+	require.NoError(t, bop.Bump(other, 1))
+	eventuallyEqual(t, func() int { return mgr.GetTagInfo(other).Value }, 6)
+}
+
+func TestDecayPersistenceDisconnected(t *testing.T) {
+	id := tu.RandPeerIDFatal(t)
+	store := dssync.MutexWrap(ds.NewMapDatastore())
+	mockClock := clock.NewMock()
+	newMgr := func() *BasicConnMgr {
+		cfg := &DecayerCfg{Resolution: TestResolution, Clock: mockClock, Datastore: store, PersistTTL: time.Hour}
+		mgr, err := NewConnManager(10, 10, WithGracePeriod(time.Second), DecayerConfig(cfg))
+		require.NoError(t, err)
+		return mgr
+	}
+	register := func(mgr *BasicConnMgr) connmgr.DecayingTag {
+		tag, err := mgr.RegisterDecayingTag("beep", time.Hour, connmgr.DecayNone(), connmgr.BumpSumUnbounded())
+		require.NoError(t, err)
+		return tag
+	}
+
+	mgr := newMgr()
+	tag := register(mgr)
+	conn := &tconn{peer: id}
+	mgr.Notifee().Connected(nil, conn)
+	require.NoError(t, tag.Bump(id, 10))
+	eventuallyEqual(t, func() int { return mgr.GetTagInfo(id).Value }, 10)
+	// the peer disconnects before the restart, its value is kept anyway
+	mgr.Notifee().Disconnected(nil, conn)
+	require.Nil(t, mgr.GetTagInfo(id))
+	require.NoError(t, mgr.Close())
+
+	mgr = newMgr()
+	register(mgr)
+	// and so is it if the peer doesn't connect before the next restart
+	require.NoError(t, mgr.Close())
+
+	mgr = newMgr()
+	register(mgr)
+	conn = &tconn{peer: id}
+	mgr.Notifee().Connected(nil, conn)
+	require.Equal(t, 10, mgr.GetTagInfo(id).Value)
+	mgr.Notifee().Disconnected(nil, conn)
+	require.NoError(t, mgr.Close())
+
+	// the value expires once the peer hasn't been visited for the TTL
+	mockClock.Add(2 * time.Hour)
+	mgr = newMgr()
+	register(mgr)
+	mgr.Notifee().Connected(nil, &tconn{peer: id})
+	require.Zero(t, mgr.GetTagInfo(id).Value)
+	require.NoError(t, mgr.Close())
+	res, err := store.Query(context.Background(), query.Query{Prefix: decayingBase.String()})
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
 func TestResolutionMisaligned(t *testing.T) {
 	var (
 		id                    = tu.RandPeerIDFatal(t)
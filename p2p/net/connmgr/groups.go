@@ -0,0 +1,166 @@
+package connmgr
+
+import (
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// groupQuota is the quota of connections to a group of peers, see WithPeerGroup.
+type groupQuota struct {
+	// min is the number of connections trims leave open
+	min int
+	// max is the number of connections above which trims close connections, 0 means unlimited
+	max int
+}
+
+// tagNamespace returns the namespace of a tag, i.e. the part of its name before the
+// first colon, or the whole name if it has none.
+func tagNamespace(tag string) string {
+	if i := strings.IndexByte(tag, ':'); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// groupsOf returns the configured groups inf belongs to. The lock of the segment of inf
+// must be held.
+func (cm *BasicConnMgr) groupsOf(inf *peerInfo) []string {
+	var groups []string
+	add := func(tag string) {
+		ns := tagNamespace(tag)
+		if _, ok := cm.cfg.groups[ns]; !ok {
+			return
+		}
+		for _, g := range groups {
+			if g == ns {
+				return
+			}
+		}
+		groups = append(groups, ns)
+	}
+	for tag := range inf.tags {
+		add(tag)
+	}
+	for tag := range inf.decaying {
+		add(tag.name)
+	}
+	return groups
+}
+
+// groupCounts tracks the connections to each group of peers during a trim, so that
+// the selection passes can honor the group quotas.
+type groupCounts struct {
+	quotas map[string]groupQuota
+	// groups are the groups of each peer
+	groups map[peer.ID][]string
+	// conns is the number of connections to each group that aren't selected for closing
+	conns map[string]int
+}
+
+// countGroups counts the connections to the peers of each configured group, or returns
+// nil if there are no groups.
+func (cm *BasicConnMgr) countGroups() *groupCounts {
+	if len(cm.cfg.groups) == 0 {
+		return nil
+	}
+	gc := &groupCounts{
+		quotas: cm.cfg.groups,
+		groups: make(map[peer.ID][]string),
+		conns:  make(map[string]int, len(cm.cfg.groups)),
+	}
+	for _, s := range cm.segments.buckets {
+		s.Lock()
+		for id, inf := range s.peers {
+			groups := cm.groupsOf(inf)
+			if len(groups) == 0 {
+				continue
+			}
+			gc.groups[id] = groups
+			for _, g := range groups {
+				gc.conns[g] += len(inf.conns)
+			}
+		}
+		s.Unlock()
+	}
+	return gc
+}
+
+// allowed returns false if closing a connection to p would leave fewer connections to
+// one of its groups than the group's minimum.
+func (gc *groupCounts) allowed(p peer.ID) bool {
+	if gc == nil {
+		return true
+	}
+	for _, g := range gc.groups[p] {
+		if gc.conns[g] <= gc.quotas[g].min {
+			return false
+		}
+	}
+	return true
+}
+
+// closing records that a connection to p was selected for closing.
+func (gc *groupCounts) closing(p peer.ID) {
+	if gc == nil {
+		return
+	}
+	for _, g := range gc.groups[p] {
+		gc.conns[g]--
+	}
+}
+
+// groupsExceeded returns true if there are more connections to a group than its
+// maximum.
+func (cm *BasicConnMgr) groupsExceeded() bool {
+	gc := cm.countGroups()
+	if gc == nil {
+		return false
+	}
+	for g, q := range gc.quotas {
+		if q.max > 0 && gc.conns[g] > q.max {
+			return true
+		}
+	}
+	return false
+}
+
+// selectByGroup selects the connections of the candidates of each group whose maximum
+// is exceeded, lowest value first, until the maximum is no longer exceeded.
+func (cm *BasicConnMgr) selectByGroup(candidates peerInfos, sel *connSelection) {
+	if sel.groups == nil {
+		return
+	}
+	for g, q := range sel.groups.quotas {
+		if q.max == 0 {
+			continue
+		}
+		for _, inf := range candidates {
+			if sel.groups.conns[g] <= q.max {
+				break
+			}
+			if !sel.inGroup(inf.id, g) || !sel.groups.allowed(inf.id) {
+				continue
+			}
+			s := cm.segments.get(inf.id)
+			s.Lock()
+			for c := range inf.conns {
+				if sel.groups.conns[g] <= q.max || !sel.groups.allowed(inf.id) {
+					break
+				}
+				sel.add(c, connmgr.PruneReasonGroup)
+			}
+			s.Unlock()
+		}
+	}
+}
+
+func (sel *connSelection) inGroup(p peer.ID, group string) bool {
+	for _, g := range sel.groups.groups[p] {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
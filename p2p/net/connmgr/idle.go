@@ -0,0 +1,47 @@
+package connmgr
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// updateActivity records which connections have non-keepalive streams open, and marks
+// the peers whose connections were all idle for the idle period.
+func (cm *BasicConnMgr) updateActivity() {
+	now := cm.clock.Now()
+	for _, s := range cm.segments.buckets {
+		s.Lock()
+		for _, inf := range s.peers {
+			idle := len(inf.conns) > 0
+			for c, start := range inf.conns {
+				last, ok := inf.lastActive[c]
+				if !ok {
+					last = start
+				}
+				if cm.hasActiveStreams(c) {
+					if inf.lastActive == nil {
+						inf.lastActive = make(map[network.Conn]time.Time)
+					}
+					inf.lastActive[c] = now
+					last = now
+				}
+				if now.Sub(last) < cm.cfg.idlePeriod {
+					idle = false
+				}
+			}
+			inf.idle = idle
+		}
+		s.Unlock()
+	}
+}
+
+// hasActiveStreams returns true if c has a stream open that isn't a keepalive stream.
+func (cm *BasicConnMgr) hasActiveStreams(c network.Conn) bool {
+	for _, str := range c.GetStreams() {
+		if _, ok := cm.cfg.keepaliveProtocols[str.Protocol()]; !ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package connmgr
+
+import (
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// connSelection holds the connections selected for closing during a trim, and why
+// they were selected.
+type connSelection struct {
+	conns    []network.Conn
+	reasons  []connmgr.PruneReason
+	selected map[network.Conn]struct{}
+	// groups tracks the group quotas, it is nil if there are no peer groups
+	groups *groupCounts
+}
+
+func newConnSelection() *connSelection {
+	return &connSelection{selected: make(map[network.Conn]struct{})}
+}
+
+// add selects c for the given reason. It returns false if c was already selected.
+func (sel *connSelection) add(c network.Conn, reason connmgr.PruneReason) bool {
+	if _, ok := sel.selected[c]; ok {
+		return false
+	}
+	sel.selected[c] = struct{}{}
+	sel.conns = append(sel.conns, c)
+	sel.reasons = append(sel.reasons, reason)
+	sel.groups.closing(c.RemotePeer())
+	return true
+}
+
+// addN selects n connections of conns for the given reason, in order, skipping the
+// connections that the group quotas protect. Connections that are already selected
+// count towards n.
+func (sel *connSelection) addN(conns []network.Conn, n int, reason connmgr.PruneReason) {
+	for _, c := range conns {
+		if n <= 0 {
+			return
+		}
+		if _, ok := sel.selected[c]; ok {
+			n--
+			continue
+		}
+		if !sel.groups.allowed(c.RemotePeer()) {
+			continue
+		}
+		sel.add(c, reason)
+		n--
+	}
+}
+
+// limitsExceeded returns true if the high watermark of a direction, a protocol limit
+// or the maximum of a peer group is exceeded.
+func (cm *BasicConnMgr) limitsExceeded() bool {
+	if cm.cfg.inbound.enabled() && int(cm.dirConnCount[network.DirInbound].Load()) > cm.cfg.inbound.high {
+		return true
+	}
+	if cm.cfg.outbound.enabled() && int(cm.dirConnCount[network.DirOutbound].Load()) > cm.cfg.outbound.high {
+		return true
+	}
+	if cm.groupsExceeded() {
+		return true
+	}
+	if len(cm.cfg.protocolLimits) == 0 {
+		return false
+	}
+	counts := make(map[protocol.ID]int, len(cm.cfg.protocolLimits))
+	for _, s := range cm.segments.buckets {
+		s.Lock()
+		for _, inf := range s.peers {
+			for c := range inf.conns {
+				if proto, ok := dominantProtocol(c); ok {
+					counts[proto]++
+				}
+			}
+		}
+		s.Unlock()
+	}
+	for proto, max := range cm.cfg.protocolLimits {
+		if counts[proto] > max {
+			return true
+		}
+	}
+	return false
+}
+
+// dominantProtocol returns the protocol used by more than half of the streams of c.
+func dominantProtocol(c network.Conn) (protocol.ID, bool) {
+	streams := c.GetStreams()
+	if len(streams) == 0 {
+		return "", false
+	}
+	counts := make(map[protocol.ID]int, len(streams))
+	for _, str := range streams {
+		if proto := str.Protocol(); proto != "" {
+			counts[proto]++
+			if counts[proto]*2 > len(streams) {
+				return proto, true
+			}
+		}
+	}
+	return "", false
+}
+
+// selectByDirection selects connections in direction dir of the candidates, lowest
+// value first, until only low connections remain in that direction. Protected
+// connections and connections in their grace period aren't candidates, but they
+// count towards low.
+func (cm *BasicConnMgr) selectByDirection(candidates peerInfos, dir network.Direction, low int, reason connmgr.PruneReason, sel *connSelection) {
+	var conns []network.Conn
+	for _, inf := range candidates {
+		s := cm.segments.get(inf.id)
+		s.Lock()
+		for c := range inf.conns {
+			if c.Stat().Direction == dir {
+				conns = append(conns, c)
+			}
+		}
+		s.Unlock()
+	}
+	sel.addN(conns, int(cm.dirConnCount[dir].Load())-low, reason)
+}
+
+// selectByProtocol selects connections of the candidates dominated by a protocol,
+// lowest value first, until the protocol limits are no longer exceeded.
+func (cm *BasicConnMgr) selectByProtocol(candidates peerInfos, sel *connSelection) {
+	if len(cm.cfg.protocolLimits) == 0 {
+		return
+	}
+	conns := make(map[protocol.ID][]network.Conn, len(cm.cfg.protocolLimits))
+	for _, inf := range candidates {
+		s := cm.segments.get(inf.id)
+		s.Lock()
+		for c := range inf.conns {
+			if proto, ok := dominantProtocol(c); ok {
+				if _, limited := cm.cfg.protocolLimits[proto]; limited {
+					conns[proto] = append(conns[proto], c)
+				}
+			}
+		}
+		s.Unlock()
+	}
+	for proto, max := range cm.cfg.protocolLimits {
+		sel.addN(conns[proto], len(conns[proto])-max, connmgr.PruneReasonProtocol)
+	}
+}
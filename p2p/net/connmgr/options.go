@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
 // config is the configuration struct for the basic connection manager.
@@ -16,6 +17,30 @@ type config struct {
 	decayer       *DecayerCfg
 	emergencyTrim bool
 	clock         clock.Clock
+
+	// inbound and outbound are the watermarks per direction. Zero values disable them.
+	inbound, outbound watermarks
+	// protocolLimits are the maximum numbers of connections dominated by a protocol.
+	protocolLimits map[protocol.ID]int
+
+	// idlePeriod is the time after which connections without streams are considered
+	// idle, see WithIdlePruning. Zero disables idle tracking.
+	idlePeriod         time.Duration
+	keepaliveProtocols map[protocol.ID]struct{}
+
+	// groups are the quotas of the peer groups by tag namespace, see WithPeerGroup.
+	groups map[string]groupQuota
+
+	// adaptive configures adaptive watermarks, see WithAdaptiveWatermarks.
+	adaptive *AdaptiveCfg
+}
+
+type watermarks struct {
+	low, high int
+}
+
+func (w watermarks) enabled() bool {
+	return w.high > 0
 }
 
 // Option represents an option for the basic connection manager.
@@ -62,3 +87,112 @@ func WithSilencePeriod(p time.Duration) Option {
 		return nil
 	}
 }
+
+// WithInboundLimits sets separate watermarks for inbound connections. When the number
+// of inbound connections exceeds hi, inbound connections are trimmed until lo remain,
+// independently of the watermarks for all connections.
+func WithInboundLimits(lo, hi int) Option {
+	return func(cfg *config) error {
+		if lo < 0 || hi < lo {
+			return errors.New("inbound watermarks must satisfy 0 <= lo <= hi")
+		}
+		cfg.inbound = watermarks{low: lo, high: hi}
+		return nil
+	}
+}
+
+// WithOutboundLimits sets separate watermarks for outbound connections. When the
+// number of outbound connections exceeds hi, outbound connections are trimmed until lo
+// remain, independently of the watermarks for all connections.
+func WithOutboundLimits(lo, hi int) Option {
+	return func(cfg *config) error {
+		if lo < 0 || hi < lo {
+			return errors.New("outbound watermarks must satisfy 0 <= lo <= hi")
+		}
+		cfg.outbound = watermarks{low: lo, high: hi}
+		return nil
+	}
+}
+
+// WithProtocolLimit caps the number of connections dominated by proto, i.e. the
+// connections on which more than half of the streams use proto. Once the cap is
+// exceeded, the connections of the lowest value peers dominated by proto are trimmed.
+// This prevents a single subsystem from crowding out the others.
+func WithProtocolLimit(proto protocol.ID, max int) Option {
+	return func(cfg *config) error {
+		if max < 0 {
+			return errors.New("protocol limit must be non-negative")
+		}
+		if cfg.protocolLimits == nil {
+			cfg.protocolLimits = make(map[protocol.ID]int)
+		}
+		cfg.protocolLimits[proto] = max
+		return nil
+	}
+}
+
+// pingProtocol is the protocol ID of the ping protocol, the default keepalive protocol.
+const pingProtocol = "/ipfs/ping/1.0.0"
+
+// WithIdlePruning makes the connection manager prune idle peers first, before looking
+// at their value. A peer is idle if none of its connections had a stream open for at
+// least the idle period. Streams of the keepalive protocols don't count as activity,
+// by default those are the streams of the ping protocol.
+//
+// Stream activity is sampled every silence period, and before every trim.
+func WithIdlePruning(idle time.Duration, keepalive ...protocol.ID) Option {
+	return func(cfg *config) error {
+		if idle <= 0 {
+			return errors.New("idle period must be positive")
+		}
+		if len(keepalive) == 0 {
+			keepalive = []protocol.ID{pingProtocol}
+		}
+		cfg.idlePeriod = idle
+		cfg.keepaliveProtocols = make(map[protocol.ID]struct{}, len(keepalive))
+		for _, proto := range keepalive {
+			cfg.keepaliveProtocols[proto] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithPeerGroup defines a group of peers with a connection quota. The group consists of
+// the peers with a tag in the namespace ns, i.e. a tag named ns, or a tag whose name
+// starts with ns followed by a colon, like "pubsub:<topic>".
+//
+// Trims don't close connections to peers of the group if fewer than min connections to
+// the group would remain, so that a baseline of each class of peers survives. If there
+// are more than max connections to the group, the connections to its lowest value peers
+// are closed. A max of zero means unlimited. Memory emergency trims ignore the quotas.
+func WithPeerGroup(ns string, min, max int) Option {
+	return func(cfg *config) error {
+		if min < 0 || (max != 0 && max < min) {
+			return errors.New("peer group quota must satisfy 0 <= min <= max, or max == 0")
+		}
+		if cfg.groups == nil {
+			cfg.groups = make(map[string]groupQuota)
+		}
+		cfg.groups[ns] = groupQuota{min: min, max: max}
+		return nil
+	}
+}
+
+// WithAdaptiveWatermarks makes the connection manager adjust its watermarks to the
+// resource pressure reported by the sources of cfg: when the pressure exceeds the
+// threshold the watermarks shrink, and connections are trimmed down to the new low
+// watermark immediately. Once the pressure decreases, the watermarks grow back to the
+// configured values.
+//
+//	cfg := (&AdaptiveCfg{}).WithDefaults()
+//	cfg.Sources = []PressureSource{MemoryPressure(4 << 30), FDPressure()}
+//	cm, err := NewConnManager(low, high, WithAdaptiveWatermarks(cfg))
+func WithAdaptiveWatermarks(cfg *AdaptiveCfg) Option {
+	return func(c *config) error {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		c.adaptive = cfg
+		return nil
+	}
+}
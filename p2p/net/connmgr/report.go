@@ -0,0 +1,85 @@
+package connmgr
+
+import (
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// trimEvents holds the emitters used to report trims.
+type trimEvents struct {
+	started, finished event.Emitter
+}
+
+// EmitEvents makes the connection manager emit an event.EvtConnManagerTrimStarted
+// and an event.EvtConnManagerTrimFinished on bus for every trim. It can only be
+// called once.
+func (cm *BasicConnMgr) EmitEvents(bus event.Bus) error {
+	started, err := bus.Emitter(new(event.EvtConnManagerTrimStarted))
+	if err != nil {
+		return err
+	}
+	finished, err := bus.Emitter(new(event.EvtConnManagerTrimFinished))
+	if err != nil {
+		started.Close()
+		return err
+	}
+	if !cm.events.CompareAndSwap(nil, &trimEvents{started: started, finished: finished}) {
+		started.Close()
+		finished.Close()
+		return errors.New("connection manager is already emitting events")
+	}
+	return nil
+}
+
+// LastTrimReport returns the report of the most recent trim, or nil if there was no
+// trim yet. It can be used to find out why the connections to a peer were closed.
+func (cm *BasicConnMgr) LastTrimReport() *connmgr.TrimReport {
+	cm.lastTrimMu.RLock()
+	defer cm.lastTrimMu.RUnlock()
+	return cm.lastTrimReport
+}
+
+func (cm *BasicConnMgr) emitTrimStarted(start time.Time, connCount int) {
+	if ev := cm.events.Load(); ev != nil {
+		ev.started.Emit(event.EvtConnManagerTrimStarted{Start: start, ConnCount: connCount})
+	}
+}
+
+// newTrimReport creates the report of a trim that closes the connections in sel. It
+// must be called before the connections are closed, while the tags of the peers are
+// still known.
+func (cm *BasicConnMgr) newTrimReport(start time.Time, connCount int, sel *connSelection) *connmgr.TrimReport {
+	report := &connmgr.TrimReport{Start: start, ConnCount: connCount}
+	pruned := make(map[peer.ID]int)
+	for i, c := range sel.conns {
+		p := c.RemotePeer()
+		if idx, ok := pruned[p]; ok {
+			report.Pruned[idx].Conns++
+			continue
+		}
+		pp := connmgr.PrunedPeer{Peer: p, Reason: sel.reasons[i], Conns: 1}
+		if ti := cm.GetTagInfo(p); ti != nil {
+			pp.Value = ti.Value
+			pp.Tags = ti.Tags
+		}
+		pruned[p] = len(report.Pruned)
+		report.Pruned = append(report.Pruned, pp)
+	}
+	return report
+}
+
+// finishTrim records report as the most recent trim report and emits it.
+func (cm *BasicConnMgr) finishTrim(report *connmgr.TrimReport) {
+	report.End = cm.clock.Now()
+	cm.lastTrimMu.Lock()
+	cm.lastTrimReport = report
+	cm.lastTrimMu.Unlock()
+
+	if ev := cm.events.Load(); ev != nil {
+		ev.finished.Emit(event.EvtConnManagerTrimFinished{Report: *report})
+	}
+}
@@ -67,11 +67,25 @@ type Mocknet interface {
 }
 
 // LinkOptions are used to change aspects of the links.
-// Sorry but they dont work yet :(
+// Probabilities are between 0 and 1.
 type LinkOptions struct {
 	Latency   time.Duration
 	Bandwidth float64 // in bytes-per-second
-	// we can make these values distributions down the road.
+
+	// Jitter is the maximum random delay added to the latency of every write.
+	// Writes on a stream are still delivered in order.
+	Jitter time.Duration
+	// PacketLoss is the probability that a write is lost. Streams are reliable, so
+	// a lost write is retransmitted, which delays it by another round trip, and
+	// delays the writes after it on the same stream.
+	PacketLoss float64
+	// Reordering is the probability that a write is held back by ReorderDelay, so
+	// that writes on the other streams of the link sent after it arrive before it.
+	Reordering float64
+	// ReorderDelay is the delay of reordered writes. Defaults to Latency.
+	ReorderDelay time.Duration
+	// StreamLoss is the probability that opening a stream over the link fails.
+	StreamLoss float64
 }
 
 // Link represents the **possibility** of a connection between
@@ -0,0 +1,75 @@
+package mocknet
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// LinkProfileStep is a step of a LinkProfile.
+type LinkProfileStep struct {
+	Options  LinkOptions
+	Duration time.Duration
+}
+
+// LinkProfile varies the options of links over time, e.g. to simulate a link that
+// degrades, or that is periodically congested.
+type LinkProfile struct {
+	Steps []LinkProfileStep
+	// Repeat restarts the profile from its first step after its last step.
+	Repeat bool
+	// Clock times the steps. Defaults to the real clock, it should be the clock of
+	// the mocknet if it has one.
+	Clock clock.Clock
+}
+
+// Run sets the options of every step on links in order, and keeps them for the
+// duration of the step. It blocks until the last step ends or, if the profile
+// repeats, until ctx is done. The links keep the options of the last step applied.
+func (p LinkProfile) Run(ctx context.Context, links ...Link) error {
+	if p.Repeat {
+		var total time.Duration
+		for _, s := range p.Steps {
+			total += s.Duration
+		}
+		if total <= 0 {
+			return errors.New("a repeating link profile must have a positive duration")
+		}
+	}
+
+	cl := p.Clock
+	if cl == nil {
+		cl = clock.New()
+	}
+	var t *clock.Timer
+	defer func() {
+		if t != nil {
+			t.Stop()
+		}
+	}()
+	for {
+		for _, s := range p.Steps {
+			for _, l := range links {
+				l.SetOptions(s.Options)
+			}
+			if s.Duration <= 0 {
+				continue
+			}
+			if t == nil {
+				t = cl.Timer(s.Duration)
+			} else {
+				t.Reset(s.Duration)
+			}
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if !p.Repeat {
+			return nil
+		}
+	}
+}
@@ -130,7 +130,7 @@ func (c *conn) remoteOpenedStream(s *stream) {
 }
 
 func (c *conn) openStream() *stream {
-	sl, sr := newStreamPair()
+	sl, sr := newStreamPair(c.link.mock.clock)
 	go c.rconn.remoteOpenedStream(sr)
 	c.addStream(sl)
 	return sl
@@ -139,6 +139,9 @@ func (c *conn) openStream() *stream {
 func (c *conn) NewStream(context.Context) (network.Stream, error) {
 	log.Debugf("Conn.NewStreamWithProtocol: %s --> %s", c.local, c.remote)
 
+	if c.link.chance(c.link.Options().StreamLoss) {
+		return nil, ErrStreamLost
+	}
 	s := c.openStream()
 	return s, nil
 }
@@ -1,6 +1,7 @@
 package mocknet
 
 import (
+	"math/rand"
 	"sync"
 	"time"
 
@@ -17,13 +18,17 @@ type link struct {
 	ratelimiter *RateLimiter
 	// this could have addresses on both sides.
 
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
 	sync.RWMutex
 }
 
 func newLink(mn *mocknet, opts LinkOptions) *link {
 	l := &link{mock: mn,
 		opts:        opts,
-		ratelimiter: NewRateLimiter(opts.Bandwidth)}
+		ratelimiter: newRateLimiter(opts.Bandwidth, mn.clock),
+		rng:         rand.New(rand.NewSource(mn.linkSeed()))}
 	return l
 }
 
@@ -77,12 +82,39 @@ func (l *link) Options() LinkOptions {
 	return l.opts
 }
 
-func (l *link) GetLatency() time.Duration {
-	l.RLock()
-	defer l.RUnlock()
-	return l.opts.Latency
-}
-
 func (l *link) RateLimit(dataSize int) time.Duration {
 	return l.ratelimiter.Limit(dataSize)
 }
+
+// writeDelay returns how long a write of dataSize bytes takes to cross the link.
+func (l *link) writeDelay(dataSize int) time.Duration {
+	opts := l.Options()
+	delay := opts.Latency + l.RateLimit(dataSize)
+	if opts.Jitter > 0 {
+		l.rngMu.Lock()
+		delay += time.Duration(l.rng.Int63n(int64(opts.Jitter)))
+		l.rngMu.Unlock()
+	}
+	if l.chance(opts.PacketLoss) {
+		// retransmitted after a round trip
+		delay += 2 * opts.Latency
+	}
+	if l.chance(opts.Reordering) {
+		if opts.ReorderDelay > 0 {
+			delay += opts.ReorderDelay
+		} else {
+			delay += opts.Latency
+		}
+	}
+	return delay
+}
+
+// chance returns true with probability p.
+func (l *link) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	l.rngMu.Lock()
+	defer l.rngMu.Unlock()
+	return l.rng.Float64() < p
+}
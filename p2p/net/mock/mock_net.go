@@ -4,9 +4,11 @@ import (
 	"context"
 	"crypto/rand"
 	"fmt"
+	mrand "math/rand"
 	"net"
 	"sort"
 	"sync"
+	"time"
 
 	ic "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
@@ -17,6 +19,7 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
 	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
 
+	"github.com/benbjohnson/clock"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -37,21 +40,62 @@ type mocknet struct {
 
 	linkDefaults LinkOptions
 
+	clock clock.Clock
+
+	// seeds seeds the random number generators of the links, see WithSeed.
+	seedsMu sync.Mutex
+	seeds   *mrand.Rand
+
 	ctxCancel context.CancelFunc
 	ctx       context.Context
 	sync.Mutex
 }
 
-func New() Mocknet {
+// Option is an option that can be passed to New.
+type Option func(*mocknet)
+
+// WithClock sets the clock used by the links of the mocknet to delay the writes on
+// streams, and by the peerstores of the peers it generates. With a mock clock, the
+// latency and bandwidth of links elapse when the clock is advanced, writes that
+// aren't delayed are delivered right away.
+func WithClock(cl clock.Clock) Option {
+	return func(mn *mocknet) {
+		mn.clock = cl
+	}
+}
+
+// WithSeed seeds the random numbers that the links of the mocknet use to jitter
+// their latency, and to lose and reorder packets. Each link is seeded with the next
+// number drawn from seed, so that the links behave the same in all runs that create
+// them in the same order.
+func WithSeed(seed int64) Option {
+	return func(mn *mocknet) {
+		mn.seeds = mrand.New(mrand.NewSource(seed))
+	}
+}
+
+func New(opts ...Option) Mocknet {
 	mn := &mocknet{
 		nets:  map[peer.ID]*peernet{},
 		hosts: map[peer.ID]host.Host{},
 		links: map[peer.ID]map[peer.ID]map[*link]struct{}{},
+		clock: clock.New(),
+		seeds: mrand.New(mrand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(mn)
 	}
 	mn.ctx, mn.ctxCancel = context.WithCancel(context.Background())
 	return mn
 }
 
+// linkSeed returns the seed of the random number generator of a new link.
+func (mn *mocknet) linkSeed() int64 {
+	mn.seedsMu.Lock()
+	defer mn.seedsMu.Unlock()
+	return mn.seeds.Int63()
+}
+
 func (mn *mocknet) Close() error {
 	mn.ctxCancel()
 	for _, h := range mn.hosts {
@@ -97,7 +141,7 @@ func (mn *mocknet) AddPeer(k ic.PrivKey, a ma.Multiaddr) (host.Host, error) {
 		return nil, err
 	}
 
-	ps, err := pstoremem.NewPeerstore()
+	ps, err := pstoremem.NewPeerstore(pstoremem.WithClock(mn.clock))
 	if err != nil {
 		return nil, err
 	}
@@ -6,11 +6,14 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/benbjohnson/clock"
 )
 
 var streamCounter atomic.Int64
@@ -31,29 +34,39 @@ type stream struct {
 
 	writeErr error
 
+	writeMu sync.Mutex
+	// lastArrival is the arrival time of the last write.
+	lastArrival time.Time
+
 	protocol atomic.Pointer[protocol.ID]
 	stat     network.Stats
+
+	clock clock.Clock
 }
 
 var ErrClosed = errors.New("stream closed")
 
+// ErrStreamLost is returned when opening a stream fails because of the StreamLoss
+// of the link.
+var ErrStreamLost = errors.New("stream lost")
+
 type transportObject struct {
 	msg         []byte
 	arrivalTime time.Time
 }
 
-func newStreamPair() (*stream, *stream) {
+func newStreamPair(cl clock.Clock) (*stream, *stream) {
 	ra, wb := io.Pipe()
 	rb, wa := io.Pipe()
 
-	sa := newStream(wa, ra, network.DirOutbound)
-	sb := newStream(wb, rb, network.DirInbound)
+	sa := newStream(wa, ra, network.DirOutbound, cl)
+	sb := newStream(wb, rb, network.DirInbound, cl)
 	sa.rstream = sb
 	sb.rstream = sa
 	return sa, sb
 }
 
-func newStream(w *io.PipeWriter, r *io.PipeReader, dir network.Direction) *stream {
+func newStream(w *io.PipeWriter, r *io.PipeReader, dir network.Direction, cl clock.Clock) *stream {
 	s := &stream{
 		read:      r,
 		write:     w,
@@ -63,6 +76,7 @@ func newStream(w *io.PipeWriter, r *io.PipeReader, dir network.Direction) *strea
 		closed:    make(chan struct{}),
 		toDeliver: make(chan *transportObject),
 		stat:      network.Stats{Direction: dir},
+		clock:     cl,
 	}
 
 	go s.transport()
@@ -71,9 +85,15 @@ func newStream(w *io.PipeWriter, r *io.PipeReader, dir network.Direction) *strea
 
 // How to handle errors with writes?
 func (s *stream) Write(p []byte) (n int, err error) {
-	l := s.conn.link
-	delay := l.GetLatency() + l.RateLimit(len(p))
-	t := time.Now().Add(delay)
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	t := s.clock.Now().Add(s.conn.link.writeDelay(len(p)))
+	// a write can't overtake the previous one on the same stream
+	if t.Before(s.lastArrival) {
+		t = s.lastArrival
+	}
+	s.lastArrival = t
 
 	// Copy it.
 	cpy := make([]byte, len(p))
@@ -179,7 +199,7 @@ func (s *stream) transport() {
 
 	bufsize := 256
 	buf := new(bytes.Buffer)
-	timer := time.NewTimer(0)
+	timer := s.clock.Timer(0)
 	if !timer.Stop() {
 		select {
 		case <-timer.C:
@@ -207,6 +227,15 @@ func (s *stream) transport() {
 	// an incoming packet. it waits until the arrival time,
 	// and then writes things out.
 	deliverOrWait := func(o *transportObject) error {
+		delay := s.clock.Until(o.arrivalTime)
+		if delay <= 0 {
+			// the message is due, and so are the buffered ones
+			if err := drainBuf(); err != nil {
+				return err
+			}
+			_, err := s.write.Write(o.msg)
+			return err
+		}
 		buffered := len(o.msg) + buf.Len()
 
 		// Yes, we can end up extending a timer multiple times if we
@@ -220,12 +249,7 @@ func (s *stream) transport() {
 			default:
 			}
 		}
-		delay := time.Until(o.arrivalTime)
-		if delay >= 0 {
-			timer.Reset(delay)
-		} else {
-			timer.Reset(0)
-		}
+		timer.Reset(delay)
 
 		if buffered >= bufsize {
 			select {
@@ -17,6 +17,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 
+	"github.com/benbjohnson/clock"
 	"github.com/libp2p/go-libp2p-testing/ci"
 	tetc "github.com/libp2p/go-libp2p-testing/etc"
 	"github.com/libp2p/go-libp2p-testing/race"
@@ -681,3 +682,198 @@ func TestEventBus(t *testing.T) {
 		}
 	}
 }
+
+func TestLinkConditions(t *testing.T) {
+	const latency = 10 * time.Millisecond
+	l := newLink(New().(*mocknet), LinkOptions{Latency: latency, Jitter: 5 * time.Millisecond})
+	for i := 0; i < 100; i++ {
+		d := l.writeDelay(1)
+		require.GreaterOrEqual(t, d, latency)
+		require.Less(t, d, latency+5*time.Millisecond)
+	}
+
+	l.SetOptions(LinkOptions{Latency: latency, PacketLoss: 1})
+	require.Equal(t, 3*latency, l.writeDelay(1))
+	l.SetOptions(LinkOptions{Latency: latency, Reordering: 1})
+	require.Equal(t, 2*latency, l.writeDelay(1))
+	l.SetOptions(LinkOptions{Latency: latency, Reordering: 1, ReorderDelay: time.Millisecond})
+	require.Equal(t, latency+time.Millisecond, l.writeDelay(1))
+}
+
+func TestLinkSeed(t *testing.T) {
+	opts := LinkOptions{Latency: 10 * time.Millisecond, Jitter: 5 * time.Millisecond, PacketLoss: 0.5}
+	delays := func(seed int64) []time.Duration {
+		l := newLink(New(WithSeed(seed)).(*mocknet), opts)
+		ds := make([]time.Duration, 20)
+		for i := range ds {
+			ds[i] = l.writeDelay(1)
+		}
+		return ds
+	}
+	require.Equal(t, delays(42), delays(42))
+	require.NotEqual(t, delays(42), delays(43))
+}
+
+func TestStreamsWithJitter(t *testing.T) {
+	mn, err := FullMeshLinked(2)
+	require.NoError(t, err)
+	defer mn.Close()
+	for _, l := range mn.LinksBetweenPeers(mn.Peers()[0], mn.Peers()[1]) {
+		l.SetOptions(LinkOptions{Jitter: 20 * time.Millisecond, Reordering: 0.5, PacketLoss: 0.5})
+	}
+	h1, h2 := mn.Hosts()[0], mn.Hosts()[1]
+	require.NoError(t, mn.ConnectAllButSelf())
+
+	received := make(chan []byte, 1)
+	h2.SetStreamHandler(protocol.TestingID, func(s network.Stream) {
+		b, _ := io.ReadAll(s)
+		received <- b
+		s.Close()
+	})
+	s, err := h1.NewStream(context.Background(), h2.ID(), protocol.TestingID)
+	require.NoError(t, err)
+	var sent []byte
+	for i := 0; i < 50; i++ {
+		b := []byte{byte(i)}
+		_, err := s.Write(b)
+		require.NoError(t, err)
+		sent = append(sent, b...)
+	}
+	require.NoError(t, s.CloseWrite())
+	select {
+	case b := <-received:
+		require.Equal(t, sent, b)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestStreamLoss(t *testing.T) {
+	mn, err := FullMeshLinked(2)
+	require.NoError(t, err)
+	defer mn.Close()
+	p1, p2 := mn.Peers()[0], mn.Peers()[1]
+	c, err := mn.ConnectPeers(p1, p2)
+	require.NoError(t, err)
+	for _, l := range mn.LinksBetweenPeers(p1, p2) {
+		l.SetOptions(LinkOptions{StreamLoss: 1})
+	}
+	_, err = c.NewStream(context.Background())
+	require.ErrorIs(t, err, ErrStreamLost)
+}
+
+func TestLinkProfile(t *testing.T) {
+	mn, err := FullMeshLinked(2)
+	require.NoError(t, err)
+	defer mn.Close()
+	links := mn.LinksBetweenPeers(mn.Peers()[0], mn.Peers()[1])
+
+	p := LinkProfile{Steps: []LinkProfileStep{
+		{Options: LinkOptions{Latency: time.Millisecond}, Duration: 10 * time.Millisecond},
+		{Options: LinkOptions{Latency: 2 * time.Millisecond}, Duration: 10 * time.Millisecond},
+	}}
+	start := time.Now()
+	require.NoError(t, p.Run(context.Background(), links...))
+	require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	for _, l := range links {
+		require.Equal(t, LinkOptions{Latency: 2 * time.Millisecond}, l.Options())
+	}
+
+	p.Repeat = true
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Run(ctx, links...), context.DeadlineExceeded)
+
+	require.Error(t, LinkProfile{Steps: []LinkProfileStep{{}}, Repeat: true}.Run(context.Background(), links...))
+}
+
+func TestStreamsWithMockClock(t *testing.T) {
+	cl := clock.NewMock()
+	mn := New(WithClock(cl))
+	defer mn.Close()
+	for i := 0; i < 2; i++ {
+		_, err := mn.GenPeer()
+		require.NoError(t, err)
+	}
+	require.NoError(t, mn.LinkAll())
+	p1, p2 := mn.Peers()[0], mn.Peers()[1]
+	c, err := mn.ConnectPeers(p1, p2)
+	require.NoError(t, err)
+
+	received := make(chan []byte, 1)
+	mn.Net(p2).SetStreamHandler(func(s network.Stream) {
+		b := make([]byte, 4)
+		// ignore the streams of the hosts, e.g. identify
+		if _, err := io.ReadFull(s, b); err == nil && (string(b) == "ping" || string(b) == "pong") {
+			received <- b
+		}
+		s.Close()
+	})
+
+	// writes that aren't delayed don't wait for the clock
+	s, err := c.NewStream(context.Background())
+	require.NoError(t, err)
+	_, err = s.Write([]byte("ping"))
+	require.NoError(t, err)
+	select {
+	case b := <-received:
+		require.Equal(t, "ping", string(b))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	s.Close()
+
+	for _, l := range mn.LinksBetweenPeers(p1, p2) {
+		l.SetOptions(LinkOptions{Latency: time.Second})
+	}
+	s, err = c.NewStream(context.Background())
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.Write([]byte("pong"))
+	require.NoError(t, err)
+	select {
+	case <-received:
+		t.Fatal("received before the latency elapsed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cl.Add(time.Second)
+	select {
+	case b := <-received:
+		require.Equal(t, "pong", string(b))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestLinkProfileWithMockClock(t *testing.T) {
+	cl := clock.NewMock()
+	mn, err := FullMeshLinked(2)
+	require.NoError(t, err)
+	defer mn.Close()
+	l := mn.LinksBetweenPeers(mn.Peers()[0], mn.Peers()[1])[0]
+
+	p := LinkProfile{
+		Steps: []LinkProfileStep{
+			{Options: LinkOptions{Latency: time.Millisecond}, Duration: time.Minute},
+			{Options: LinkOptions{Latency: 2 * time.Millisecond}, Duration: time.Minute},
+		},
+		Clock: cl,
+	}
+	done := make(chan error, 1)
+	go func() { done <- p.Run(context.Background(), l) }()
+	require.Eventually(t, func() bool { return l.Options().Latency == time.Millisecond }, 5*time.Second, time.Millisecond)
+	require.Eventually(t, func() bool {
+		cl.Add(time.Minute)
+		return l.Options().Latency == 2*time.Millisecond
+	}, 5*time.Second, time.Millisecond)
+	require.Eventually(t, func() bool {
+		cl.Add(time.Minute)
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+}
@@ -3,6 +3,8 @@ package mocknet
 import (
 	"sync"
 	"time"
+
+	"github.com/benbjohnson/clock"
 )
 
 // A RateLimiter is used by a link to determine how long to wait before sending
@@ -15,17 +17,23 @@ type RateLimiter struct {
 	lastUpdate   time.Time     // when allowance was updated last
 	count        int           // number of times rate limiting was applied
 	duration     time.Duration // total delay introduced due to rate limiting
+	clock        clock.Clock
 }
 
 // Creates a new RateLimiter with bandwidth (in bytes/sec)
 func NewRateLimiter(bandwidth float64) *RateLimiter {
+	return newRateLimiter(bandwidth, clock.New())
+}
+
+func newRateLimiter(bandwidth float64, cl clock.Clock) *RateLimiter {
 	//  convert bandwidth to bytes per nanosecond
 	b := bandwidth / float64(time.Second)
 	return &RateLimiter{
 		bandwidth:    b,
 		allowance:    0,
 		maxAllowance: bandwidth,
-		lastUpdate:   time.Now(),
+		lastUpdate:   cl.Now(),
+		clock:        cl,
 	}
 }
 
@@ -39,7 +47,7 @@ func (r *RateLimiter) UpdateBandwidth(bandwidth float64) {
 	//  Reset allowance
 	r.allowance = 0
 	r.maxAllowance = bandwidth
-	r.lastUpdate = time.Now()
+	r.lastUpdate = r.clock.Now()
 }
 
 // Returns how long to wait before sending data with length 'dataSize' bytes
@@ -51,7 +59,7 @@ func (r *RateLimiter) Limit(dataSize int) time.Duration {
 	if r.bandwidth == 0 {
 		return duration
 	}
-	current := time.Now()
+	current := r.clock.Now()
 	elapsedTime := current.Sub(r.lastUpdate)
 	r.lastUpdate = current
 
@@ -0,0 +1,229 @@
+package nat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+
+	"github.com/libp2p/go-nat"
+	"github.com/libp2p/go-netroute"
+)
+
+// Gateway describes a NAT device found during discovery.
+type Gateway struct {
+	// Type is the protocol used to request mappings, e.g. "PCP", "NAT-PMP" or
+	// "UPNP (IG2)".
+	Type string
+	// Addr is the address of the device.
+	Addr netip.Addr
+	// Interface is the name of the local interface the device is reached on. It is
+	// empty if it is unknown.
+	Interface string
+}
+
+type discoveryConfig struct {
+	filter     func(Gateway) bool
+	interfaces map[string]struct{}
+	addrs      []net.IP
+}
+
+// WithGateways only requests mappings on the discovered gateways for which filter
+// returns true.
+func WithGateways(filter func(Gateway) bool) Option {
+	return func(n *NAT) error {
+		n.discovery.filter = filter
+		return nil
+	}
+}
+
+// WithInterfaces only requests mappings on gateways reached on one of the given local
+// interfaces.
+func WithInterfaces(names ...string) Option {
+	return func(n *NAT) error {
+		if len(names) == 0 {
+			return errors.New("no interfaces")
+		}
+		n.discovery.interfaces = make(map[string]struct{}, len(names))
+		for _, name := range names {
+			n.discovery.interfaces[name] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithGatewayAddrs probes the given addresses for PCP and NAT-PMP gateways, in
+// addition to the default gateway. This is useful on hosts with several uplinks, where
+// only one of the gateways is on the default route. UPnP gateways are discovered on
+// all interfaces that receive the multicast discovery.
+func WithGatewayAddrs(addrs ...netip.Addr) Option {
+	return func(n *NAT) error {
+		for _, a := range addrs {
+			n.discovery.addrs = append(n.discovery.addrs, net.IP(a.AsSlice()))
+		}
+		return nil
+	}
+}
+
+// so we can mock them in tests
+var (
+	discoverGateways = func(ctx context.Context) []nat.NAT {
+		var nats []nat.NAT
+		for n := range nat.DiscoverNATs(ctx) {
+			nats = append(nats, n)
+		}
+		return nats
+	}
+	defaultGateway = func() (net.IP, error) {
+		router, err := netroute.New()
+		if err != nil {
+			return nil, err
+		}
+		_, gw, _, err := router.Route(net.IPv4zero)
+		if err != nil {
+			return nil, err
+		}
+		if gw == nil {
+			return nil, errors.New("no default gateway")
+		}
+		return gw, nil
+	}
+)
+
+// gatewayTypeRank ranks the protocols to talk to a gateway that supports several of
+// them, lower is better.
+func gatewayTypeRank(typ string) int {
+	switch typ {
+	case "PCP":
+		return 0
+	case "UPNP (IG2)":
+		return 1
+	case "UPNP (IG1)", "UPNP (GenIGDev)":
+		return 2
+	default:
+		return 3
+	}
+}
+
+// discover finds the gateways on the network, using the best protocol for each device,
+// and returns those selected by cfg.
+func discover(ctx context.Context, cfg *discoveryConfig) ([]*gateway, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// UPnP and NAT-PMP discovery of go-nat takes a few seconds, run it in parallel
+	upnp := make(chan []nat.NAT, 1)
+	discoverUPnP := discoverGateways
+	go func() { upnp <- discoverUPnP(ctx) }()
+
+	var addrs []net.IP
+	if gw, err := defaultGateway(); err == nil {
+		addrs = append(addrs, gw)
+	} else {
+		log.Debugw("failed to find the default gateway", "error", err)
+	}
+	addrs = append(addrs, cfg.addrs...)
+
+	var nats []nat.NAT
+	for i, addr := range addrs {
+		n, err := discoverPCP(ctx, addr)
+		if err == nil {
+			nats = append(nats, n)
+			continue
+		}
+		log.Debugw("PCP not available", "gateway", addr, "error", err)
+		// go-nat already probes the default gateway for NAT-PMP
+		if i >= len(addrs)-len(cfg.addrs) {
+			if n, err := discoverNATPMP(ctx, addr); err == nil {
+				nats = append(nats, n)
+			} else {
+				log.Debugw("NAT-PMP not available", "gateway", addr, "error", err)
+			}
+		}
+	}
+	nats = append(nats, <-upnp...)
+
+	var gws []*gateway
+	byAddr := make(map[netip.Addr]int)
+	for _, n := range nats {
+		gw := &gateway{nat: n, info: gatewayInfo(n)}
+		if cfg.filter != nil && !cfg.filter(gw.info) {
+			gw.close()
+			continue
+		}
+		if cfg.interfaces != nil {
+			if _, ok := cfg.interfaces[gw.info.Interface]; !ok {
+				gw.close()
+				continue
+			}
+		}
+		// Only use the best protocol of devices that speak several of them.
+		if gw.info.Addr.IsValid() {
+			if i, ok := byAddr[gw.info.Addr]; ok {
+				if gatewayTypeRank(gw.info.Type) < gatewayTypeRank(gws[i].info.Type) {
+					gws[i], gw = gw, gws[i]
+				}
+				gw.close()
+				continue
+			}
+			byAddr[gw.info.Addr] = len(gws)
+		}
+		gws = append(gws, gw)
+	}
+	if len(gws) == 0 {
+		return nil, nat.ErrNoNATFound
+	}
+	return gws, nil
+}
+
+// close releases the resources of the NAT of gw, e.g. the socket of PCP gateways.
+func (gw *gateway) close() error {
+	if c, ok := gw.nat.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func gatewayInfo(n nat.NAT) Gateway {
+	info := Gateway{Type: n.Type()}
+	devIP, err := n.GetDeviceAddress()
+	if err != nil {
+		log.Debugw("failed to get the gateway address", "type", info.Type, "error", err)
+	} else {
+		info.Addr, _ = netip.AddrFromSlice(devIP)
+		info.Addr = info.Addr.Unmap()
+	}
+	localIP, _ := n.GetInternalAddress()
+	info.Interface = interfaceFor(localIP, devIP)
+	return info
+}
+
+// interfaceFor returns the name of the interface that has the address localIP, or
+// else is on the same subnet as gatewayIP.
+func interfaceFor(localIP, gatewayIP net.IP) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	var onLink string
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if localIP != nil && ipnet.IP.Equal(localIP) {
+				return iface.Name
+			}
+			if onLink == "" && gatewayIP != nil && ipnet.Contains(gatewayIP) {
+				onLink = iface.Name
+			}
+		}
+	}
+	return onLink
+}
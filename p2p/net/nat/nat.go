@@ -5,11 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"net/netip"
+	"sort"
 	"sync"
 	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 
+	"github.com/libp2p/go-libp2p/core/event"
+
 	"github.com/libp2p/go-nat"
 )
 
@@ -30,43 +33,77 @@ type entry struct {
 	port     int
 }
 
-// so we can mock it in tests
-var discoverGateway = nat.DiscoverGateway
+// mapping is the state of a mapping requested on a gateway.
+type mapping struct {
+	// externalPort is 0 if the mapping isn't established
+	externalPort int
+	// expiry is zero if the lease doesn't expire
+	expiry time.Time
+}
 
-// DiscoverNAT looks for a NAT device in the network and returns an object that can manage port mappings.
-func DiscoverNAT(ctx context.Context) (*NAT, error) {
-	natInstance, err := discoverGateway(ctx)
-	if err != nil {
-		return nil, err
-	}
-	var extAddr netip.Addr
-	extIP, err := natInstance.GetExternalAddress()
-	if err == nil {
-		extAddr, _ = netip.AddrFromSlice(extIP)
-	}
+// gateway is a NAT device we request mappings on.
+type gateway struct {
+	info Gateway
+	// natmu serializes the requests to the device
+	natmu sync.Mutex
+	nat   nat.NAT
+	// External IP of the device, guarded by the mapping mutex. Will be renewed
+	// periodically (every CacheTime).
+	extAddr netip.Addr
+}
 
-	// Log the device addr.
-	addr, err := natInstance.GetDeviceAddress()
-	if err != nil {
-		log.Debug("DiscoverGateway address error:", err)
-	} else {
-		log.Debug("DiscoverGateway address:", addr)
+// Option is an option for DiscoverNAT.
+type Option func(*NAT) error
+
+// WithMappingEvents makes the NAT call handler whenever a mapping is acquired,
+// renewed, lost or removed. handler is called without holding the NAT's locks, but a
+// slow handler delays the operation that changed the mapping, e.g. AddMapping.
+func WithMappingEvents(handler func(event.EvtNATPortMappingChanged)) Option {
+	return func(n *NAT) error {
+		n.onMappingChange = handler
+		return nil
 	}
+}
 
+// DiscoverNAT looks for NAT devices in the network and returns an object that can manage port mappings
+// on them. Mappings are requested on all discovered gateways, unless they are restricted using
+// WithGateways or WithInterfaces. PCP is preferred if a gateway supports it, otherwise UPnP and
+// NAT-PMP are used.
+func DiscoverNAT(ctx context.Context, opts ...Option) (*NAT, error) {
 	ctx, cancel := context.WithCancel(context.Background())
-	nat := &NAT{
-		nat:       natInstance,
-		extAddr:   extAddr,
-		mappings:  make(map[entry]int),
+	n := &NAT{
+		mappings:  make(map[entry][]mapping),
 		ctx:       ctx,
 		ctxCancel: cancel,
 	}
-	nat.refCount.Add(1)
+	for _, opt := range opts {
+		if err := opt(n); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	gws, err := discover(ctx, &n.discovery)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for _, gw := range gws {
+		extIP, err := gw.nat.GetExternalAddress()
+		if err == nil {
+			gw.extAddr, _ = netip.AddrFromSlice(extIP)
+			gw.extAddr = gw.extAddr.Unmap()
+		}
+		log.Debugw("using gateway", "type", gw.info.Type, "address", gw.info.Addr, "interface", gw.info.Interface)
+	}
+	n.gateways = gws
+
+	n.refCount.Add(1)
 	go func() {
-		defer nat.refCount.Done()
-		nat.background()
+		defer n.refCount.Done()
+		n.background()
 	}()
-	return nat, nil
+	return n, nil
 }
 
 // NAT is an object that manages address port mappings in
@@ -74,18 +111,19 @@ func DiscoverNAT(ctx context.Context) (*NAT, error) {
 // service that will periodically renew port mappings,
 // and keep an up-to-date list of all the external addresses.
 type NAT struct {
-	natmu sync.Mutex
-	nat   nat.NAT
-	// External IP of the NAT. Will be renewed periodically (every CacheTime).
-	extAddr netip.Addr
+	discovery discoveryConfig
+	gateways  []*gateway
+
+	onMappingChange func(event.EvtNATPortMappingChanged)
 
 	refCount  sync.WaitGroup
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 
-	mappingmu sync.RWMutex // guards mappings
+	mappingmu sync.RWMutex // guards mappings and the external addresses of the gateways
 	closed    bool
-	mappings  map[entry]int
+	// mappings holds the mapping on every gateway, in the order of the gateways
+	mappings map[entry][]mapping
 }
 
 // Close shuts down all port mappings. NAT can no longer be used.
@@ -96,24 +134,140 @@ func (nat *NAT) Close() error {
 
 	nat.ctxCancel()
 	nat.refCount.Wait()
-	return nil
+
+	var err error
+	for _, gw := range nat.gateways {
+		if cerr := gw.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
+// Gateways returns the gateways mappings are requested on.
+func (nat *NAT) Gateways() []Gateway {
+	gws := make([]Gateway, 0, len(nat.gateways))
+	for _, gw := range nat.gateways {
+		gws = append(gws, gw.info)
+	}
+	return gws
+}
+
+// GetMapping returns the external address of the mapping of port on the first gateway it is
+// established on.
 func (nat *NAT) GetMapping(protocol string, port int) (addr netip.AddrPort, found bool) {
-	nat.mappingmu.Lock()
-	defer nat.mappingmu.Unlock()
+	if addrs := nat.GetMappings(protocol, port); len(addrs) > 0 {
+		return addrs[0], true
+	}
+	return netip.AddrPort{}, false
+}
 
-	if !nat.extAddr.IsValid() {
-		return netip.AddrPort{}, false
+// GetMappings returns the external addresses of the mappings of port on all gateways
+// it is established on.
+func (nat *NAT) GetMappings(protocol string, port int) []netip.AddrPort {
+	nat.mappingmu.RLock()
+	defer nat.mappingmu.RUnlock()
+
+	var addrs []netip.AddrPort
+	for i, m := range nat.mappings[entry{protocol: protocol, port: port}] {
+		gw := nat.gateways[i]
+		if !gw.extAddr.IsValid() || m.externalPort == 0 {
+			continue
+		}
+		addrs = append(addrs, netip.AddrPortFrom(gw.extAddr, uint16(m.externalPort)))
 	}
-	extPort, found := nat.mappings[entry{protocol: protocol, port: port}]
-	if !found {
-		return netip.AddrPort{}, false
+	return addrs
+}
+
+// Mappings returns all mappings requested on the gateways, including those that aren't
+// established.
+func (nat *NAT) Mappings() []event.NATPortMapping {
+	nat.mappingmu.RLock()
+	defer nat.mappingmu.RUnlock()
+
+	mappings := make([]event.NATPortMapping, 0, len(nat.mappings)*len(nat.gateways))
+	for e, ms := range nat.mappings {
+		for i, m := range ms {
+			mappings = append(mappings, nat.toPortMapping(nat.gateways[i], e, m))
+		}
 	}
-	return netip.AddrPortFrom(nat.extAddr, uint16(extPort)), true
+	sort.SliceStable(mappings, func(i, j int) bool {
+		if mappings[i].Protocol != mappings[j].Protocol {
+			return mappings[i].Protocol < mappings[j].Protocol
+		}
+		if mappings[i].InternalPort != mappings[j].InternalPort {
+			return mappings[i].InternalPort < mappings[j].InternalPort
+		}
+		return mappings[i].Gateway.Less(mappings[j].Gateway)
+	})
+	return mappings
 }
 
-// AddMapping attempts to construct a mapping on protocol and internal port.
+func (nat *NAT) toPortMapping(gw *gateway, e entry, m mapping) event.NATPortMapping {
+	return event.NATPortMapping{
+		Protocol:     e.protocol,
+		InternalPort: e.port,
+		ExternalPort: m.externalPort,
+		ExternalAddr: gw.extAddr,
+		Expiry:       m.expiry,
+		Gateway:      gw.info.Addr,
+	}
+}
+
+// mappingChanged returns the event reporting a change of the mapping m of e on gw. The
+// mapping mutex must be held.
+func (nat *NAT) mappingChanged(status event.NATPortMappingStatus, gw *gateway, e entry, m mapping, err error) event.EvtNATPortMappingChanged {
+	return event.EvtNATPortMappingChanged{Status: status, Mapping: nat.toPortMapping(gw, e, m), Error: err}
+}
+
+// notify emits the events returned by updateMappings and removeMappings. The mapping
+// mutex must not be held, so that a slow subscriber doesn't block the mappings.
+func (nat *NAT) notify(evts []event.EvtNATPortMappingChanged) {
+	if nat.onMappingChange == nil {
+		return
+	}
+	for _, evt := range evts {
+		nat.onMappingChange(evt)
+	}
+}
+
+// updateMappings sets the mappings of e to ms, and appends the events reporting how
+// they changed from prev, which is nil for new mappings, to evts. The mapping mutex
+// must be held.
+func (nat *NAT) updateMappings(evts []event.EvtNATPortMappingChanged, e entry, prev, ms []mapping, errs []error) []event.EvtNATPortMappingChanged {
+	nat.mappings[e] = ms
+	for i, m := range ms {
+		gw := nat.gateways[i]
+		switch {
+		case m.externalPort != 0 && (prev == nil || prev[i].externalPort == 0):
+			evts = append(evts, nat.mappingChanged(event.NATPortMappingAcquired, gw, e, m, nil))
+		case m.externalPort != 0:
+			evts = append(evts, nat.mappingChanged(event.NATPortMappingRenewed, gw, e, m, nil))
+		case prev == nil:
+			evts = append(evts, nat.mappingChanged(event.NATPortMappingFailed, gw, e, m, errs[i]))
+		case prev[i].externalPort != 0:
+			evts = append(evts, nat.mappingChanged(event.NATPortMappingLost, gw, e, m, errs[i]))
+		}
+	}
+	return evts
+}
+
+// removeMappings removes the mappings ms of e from the gateways, and appends the events
+// reporting the removal of the established ones to evts. The mapping mutex must be held.
+func (nat *NAT) removeMappings(evts []event.EvtNATPortMappingChanged, e entry, ms []mapping) []event.EvtNATPortMappingChanged {
+	for i, m := range ms {
+		gw := nat.gateways[i]
+		if m.externalPort != 0 {
+			evts = append(evts, nat.mappingChanged(event.NATPortMappingRemoved, gw, e, m, nil))
+		}
+		gw.natmu.Lock()
+		gw.nat.DeletePortMapping(e.protocol, e.port)
+		gw.natmu.Unlock()
+	}
+	return evts
+}
+
+// AddMapping attempts to construct a mapping on protocol and internal port on all gateways.
 // It blocks until a mapping was established. Once added, it periodically renews the mapping.
 //
 // May not succeed, and mappings may change over time;
@@ -126,36 +280,53 @@ func (nat *NAT) AddMapping(protocol string, port int) error {
 	}
 
 	nat.mappingmu.Lock()
-	defer nat.mappingmu.Unlock()
-
 	if nat.closed {
+		nat.mappingmu.Unlock()
 		return errors.New("closed")
 	}
 
 	// do it once synchronously, so first mapping is done right away, and before exiting,
 	// allowing users -- in the optimistic case -- to use results right after.
-	extPort := nat.establishMapping(protocol, port)
-	nat.mappings[entry{protocol: protocol, port: port}] = extPort
+	e := entry{protocol: protocol, port: port}
+	ms, errs := nat.establishMappings(e)
+	for i, gw := range nat.gateways {
+		// Some NATs (e.g. PCP) only learn the external address when establishing a mapping.
+		if !gw.extAddr.IsValid() && ms[i].externalPort != 0 {
+			if extIP, err := gw.nat.GetExternalAddress(); err == nil {
+				gw.extAddr, _ = netip.AddrFromSlice(extIP)
+				gw.extAddr = gw.extAddr.Unmap()
+			}
+		}
+	}
+	evts := nat.updateMappings(nil, e, nat.mappings[e], ms, errs)
+	nat.mappingmu.Unlock()
+
+	nat.notify(evts)
 	return nil
 }
 
 // RemoveMapping removes a port mapping.
 // It blocks until the NAT has removed the mapping.
 func (nat *NAT) RemoveMapping(protocol string, port int) error {
-	nat.mappingmu.Lock()
-	defer nat.mappingmu.Unlock()
-
 	switch protocol {
 	case "tcp", "udp":
-		e := entry{protocol: protocol, port: port}
-		if _, ok := nat.mappings[e]; ok {
-			delete(nat.mappings, e)
-			return nat.nat.DeletePortMapping(protocol, port)
-		}
-		return errors.New("unknown mapping")
 	default:
 		return fmt.Errorf("invalid protocol: %s", protocol)
 	}
+
+	e := entry{protocol: protocol, port: port}
+	nat.mappingmu.Lock()
+	ms, ok := nat.mappings[e]
+	if !ok {
+		nat.mappingmu.Unlock()
+		return errors.New("unknown mapping")
+	}
+	delete(nat.mappings, e)
+	evts := nat.removeMappings(nil, e, ms)
+	nat.mappingmu.Unlock()
+
+	nat.notify(evts)
+	return nil
 }
 
 func (nat *NAT) background() {
@@ -169,13 +340,16 @@ func (nat *NAT) background() {
 	defer t.Stop()
 
 	var in []entry
-	var out []int // port numbers
+	var out [][]mapping
+	var errs [][]error
+	var evts []event.EvtNATPortMappingChanged
 	for {
 		select {
 		case now := <-t.C:
 			if now.After(nextMappingUpdate) {
 				in = in[:0]
 				out = out[:0]
+				errs = errs[:0]
 				nat.mappingmu.Lock()
 				for e := range nat.mappings {
 					in = append(in, e)
@@ -184,67 +358,95 @@ func (nat *NAT) background() {
 				// Establishing the mapping involves network requests.
 				// Don't hold the mutex, just save the ports.
 				for _, e := range in {
-					out = append(out, nat.establishMapping(e.protocol, e.port))
+					ms, es := nat.establishMappings(e)
+					out = append(out, ms)
+					errs = append(errs, es)
 				}
+				evts = evts[:0]
 				nat.mappingmu.Lock()
 				for i, p := range in {
-					if _, ok := nat.mappings[p]; !ok {
+					prev, ok := nat.mappings[p]
+					if !ok {
 						continue // entry might have been deleted
 					}
-					nat.mappings[p] = out[i]
+					evts = nat.updateMappings(evts, p, prev, out[i], errs[i])
 				}
 				nat.mappingmu.Unlock()
+				nat.notify(evts)
 				nextMappingUpdate = time.Now().Add(mappingUpdate)
 			}
 			if now.After(nextAddrUpdate) {
-				var extAddr netip.Addr
-				extIP, err := nat.nat.GetExternalAddress()
-				if err == nil {
-					extAddr, _ = netip.AddrFromSlice(extIP)
+				extAddrs := make([]netip.Addr, len(nat.gateways))
+				for i, gw := range nat.gateways {
+					extIP, err := gw.nat.GetExternalAddress()
+					if err == nil {
+						extAddrs[i], _ = netip.AddrFromSlice(extIP)
+						extAddrs[i] = extAddrs[i].Unmap()
+					}
+				}
+				nat.mappingmu.Lock()
+				for i, gw := range nat.gateways {
+					gw.extAddr = extAddrs[i]
 				}
-				nat.extAddr = extAddr
+				nat.mappingmu.Unlock()
 				nextAddrUpdate = time.Now().Add(CacheTime)
 			}
 			t.Reset(time.Until(minTime(nextAddrUpdate, nextMappingUpdate)))
 		case <-nat.ctx.Done():
+			evts = evts[:0]
 			nat.mappingmu.Lock()
-			for e := range nat.mappings {
+			for e, ms := range nat.mappings {
 				delete(nat.mappings, e)
-				nat.nat.DeletePortMapping(e.protocol, e.port)
+				evts = nat.removeMappings(evts, e, ms)
 			}
 			nat.mappingmu.Unlock()
+			nat.notify(evts)
 			return
 		}
 	}
 }
 
-func (nat *NAT) establishMapping(protocol string, internalPort int) (externalPort int) {
+// establishMappings establishes the mapping of e on every gateway.
+func (nat *NAT) establishMappings(e entry) ([]mapping, []error) {
+	ms := make([]mapping, len(nat.gateways))
+	errs := make([]error, len(nat.gateways))
+	for i, gw := range nat.gateways {
+		ms[i], errs[i] = gw.establishMapping(e.protocol, e.port)
+	}
+	return ms, errs
+}
+
+func (gw *gateway) establishMapping(protocol string, internalPort int) (mapping, error) {
 	log.Debugf("Attempting port map: %s/%d", protocol, internalPort)
 	const comment = "libp2p"
 
-	nat.natmu.Lock()
-	var err error
-	externalPort, err = nat.nat.AddPortMapping(protocol, internalPort, comment, MappingDuration)
-	if err != nil {
+	gw.natmu.Lock()
+	start := time.Now()
+	var expiry time.Time
+	externalPort, err := gw.nat.AddPortMapping(protocol, internalPort, comment, MappingDuration)
+	if err == nil {
+		expiry = start.Add(MappingDuration)
+	} else {
 		// Some hardware does not support mappings with timeout, so try that
-		externalPort, err = nat.nat.AddPortMapping(protocol, internalPort, comment, 0)
+		externalPort, err = gw.nat.AddPortMapping(protocol, internalPort, comment, 0)
 	}
-	nat.natmu.Unlock()
+	gw.natmu.Unlock()
 
 	if err != nil || externalPort == 0 {
 		// TODO: log.Event
 		if err != nil {
-			log.Warnf("failed to establish port mapping: %s", err)
+			log.Warnf("failed to establish port mapping on %s: %s", gw.info.Addr, err)
 		} else {
-			log.Warnf("failed to establish port mapping: newport = 0")
+			err = errors.New("newport = 0")
+			log.Warnf("failed to establish port mapping on %s: newport = 0", gw.info.Addr)
 		}
 		// we do not close if the mapping failed,
 		// because it may work again next time.
-		return 0
+		return mapping{}, err
 	}
 
-	log.Debugf("NAT Mapping: %d --> %d (%s)", externalPort, internalPort, protocol)
-	return externalPort
+	log.Debugf("NAT Mapping on %s: %d --> %d (%s)", gw.info.Addr, externalPort, internalPort, protocol)
+	return mapping{externalPort: externalPort, expiry: expiry}, nil
 }
 
 func minTime(a, b time.Time) time.Time {
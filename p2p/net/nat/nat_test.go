@@ -6,6 +6,9 @@ import (
 	"net"
 	"net/netip"
 	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
 
 	"github.com/libp2p/go-nat"
 
@@ -15,17 +18,45 @@ import (
 
 //go:generate sh -c "go run github.com/golang/mock/mockgen -package nat -destination mock_nat_test.go github.com/libp2p/go-nat NAT"
 
+// mockDiscovery makes the discovery find nats, and PCP gateways using pcp.
+func mockDiscovery(t *testing.T, nats []nat.NAT, pcp func(context.Context, net.IP) (nat.NAT, error)) {
+	t.Helper()
+	origDiscoverGateways, origDiscoverPCP, origDefaultGateway := discoverGateways, discoverPCP, defaultGateway
+	t.Cleanup(func() {
+		discoverGateways, discoverPCP, defaultGateway = origDiscoverGateways, origDiscoverPCP, origDefaultGateway
+	})
+	discoverGateways = func(ctx context.Context) []nat.NAT { return nats }
+	defaultGateway = func() (net.IP, error) { return net.IPv4(127, 0, 0, 1), nil }
+	if pcp == nil {
+		pcp = func(context.Context, net.IP) (nat.NAT, error) { return nil, errors.New("no PCP") }
+	}
+	discoverPCP = pcp
+}
+
+// newMockGateway returns a mock NAT-PMP device at addr, reached from the local address
+// localIP.
+func newMockGateway(ctrl *gomock.Controller, addr, localIP net.IP) *MockNAT {
+	mockNAT := NewMockNAT(ctrl)
+	mockNAT.EXPECT().Type().Return("NAT-PMP").AnyTimes()
+	if addr == nil {
+		mockNAT.EXPECT().GetDeviceAddress().Return(nil, errors.New("nope")).AnyTimes()
+	} else {
+		mockNAT.EXPECT().GetDeviceAddress().Return(addr, nil).AnyTimes()
+	}
+	if localIP == nil {
+		mockNAT.EXPECT().GetInternalAddress().Return(nil, errors.New("nope")).AnyTimes()
+	} else {
+		mockNAT.EXPECT().GetInternalAddress().Return(localIP, nil).AnyTimes()
+	}
+	return mockNAT
+}
+
 func setupMockNAT(t *testing.T) (mockNAT *MockNAT, reset func()) {
 	t.Helper()
 	ctrl := gomock.NewController(t)
-	mockNAT = NewMockNAT(ctrl)
-	mockNAT.EXPECT().GetDeviceAddress().Return(nil, errors.New("nope")) // is only used for logging
-	origDiscoverGateway := discoverGateway
-	discoverGateway = func(ctx context.Context) (nat.NAT, error) { return mockNAT, nil }
-	return mockNAT, func() {
-		discoverGateway = origDiscoverGateway
-		ctrl.Finish()
-	}
+	mockNAT = newMockGateway(ctrl, nil, nil)
+	mockDiscovery(t, []nat.NAT{mockNAT}, nil)
+	return mockNAT, ctrl.Finish
 }
 
 func TestAddMapping(t *testing.T) {
@@ -67,3 +98,165 @@ func TestRemoveMapping(t *testing.T) {
 	_, found = nat.GetMapping("tcp", 10000)
 	require.False(t, found, "didn't expect port mapping for deleted mapping")
 }
+
+func TestMappingEvents(t *testing.T) {
+	mockNAT, reset := setupMockNAT(t)
+	defer reset()
+	mockNAT.EXPECT().GetExternalAddress().Return(net.IPv4(1, 2, 3, 4), nil)
+
+	events := make(chan event.EvtNATPortMappingChanged, 10)
+	nat, err := DiscoverNAT(context.Background(), WithMappingEvents(func(e event.EvtNATPortMappingChanged) { events <- e }))
+	require.NoError(t, err)
+	nextEvent := func() event.EvtNATPortMappingChanged {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		default:
+			t.Fatal("expected a mapping event")
+			return event.EvtNATPortMappingChanged{}
+		}
+	}
+
+	mockNAT.EXPECT().AddPortMapping("tcp", 10000, gomock.Any(), MappingDuration).Return(1234, nil)
+	start := time.Now()
+	require.NoError(t, nat.AddMapping("tcp", 10000))
+	e := nextEvent()
+	require.Equal(t, event.NATPortMappingAcquired, e.Status)
+	require.Equal(t, "tcp", e.Mapping.Protocol)
+	require.Equal(t, 10000, e.Mapping.InternalPort)
+	require.Equal(t, 1234, e.Mapping.ExternalPort)
+	require.Equal(t, netip.AddrFrom4([4]byte{1, 2, 3, 4}), e.Mapping.ExternalAddr)
+	require.WithinDuration(t, start.Add(MappingDuration), e.Mapping.Expiry, time.Second)
+	require.Equal(t, []event.NATPortMapping{e.Mapping}, nat.Mappings())
+
+	mockNAT.EXPECT().AddPortMapping("tcp", 10000, gomock.Any(), MappingDuration).Return(1234, nil)
+	require.NoError(t, nat.AddMapping("tcp", 10000))
+	require.Equal(t, event.NATPortMappingRenewed, nextEvent().Status)
+
+	mapErr := errors.New("mapping failed")
+	mockNAT.EXPECT().AddPortMapping("tcp", 10000, gomock.Any(), gomock.Any()).Return(0, mapErr).Times(2)
+	require.NoError(t, nat.AddMapping("tcp", 10000))
+	e = nextEvent()
+	require.Equal(t, event.NATPortMappingLost, e.Status)
+	require.ErrorIs(t, e.Error, mapErr)
+	require.Zero(t, nat.Mappings()[0].ExternalPort)
+
+	mockNAT.EXPECT().AddPortMapping("udp", 10000, gomock.Any(), gomock.Any()).Return(0, mapErr).Times(2)
+	require.NoError(t, nat.AddMapping("udp", 10000))
+	require.Equal(t, event.NATPortMappingFailed, nextEvent().Status)
+
+	mockNAT.EXPECT().AddPortMapping("tcp", 10001, gomock.Any(), MappingDuration).Return(1235, nil)
+	require.NoError(t, nat.AddMapping("tcp", 10001))
+	require.Equal(t, event.NATPortMappingAcquired, nextEvent().Status)
+	mockNAT.EXPECT().DeletePortMapping("tcp", 10001)
+	require.NoError(t, nat.RemoveMapping("tcp", 10001))
+	e = nextEvent()
+	require.Equal(t, event.NATPortMappingRemoved, e.Status)
+	require.Equal(t, 10001, e.Mapping.InternalPort)
+	require.Empty(t, events)
+}
+
+func TestSlowMappingEvents(t *testing.T) {
+	mockNAT, reset := setupMockNAT(t)
+	defer reset()
+	mockNAT.EXPECT().GetExternalAddress().Return(net.IPv4(1, 2, 3, 4), nil)
+
+	called := make(chan struct{})
+	unblock := make(chan struct{})
+	nat, err := DiscoverNAT(context.Background(), WithMappingEvents(func(event.EvtNATPortMappingChanged) {
+		close(called)
+		<-unblock
+	}))
+	require.NoError(t, err)
+
+	mockNAT.EXPECT().AddPortMapping("tcp", 10000, gomock.Any(), MappingDuration).Return(1234, nil)
+	done := make(chan error, 1)
+	go func() { done <- nat.AddMapping("tcp", 10000) }()
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a mapping event")
+	}
+
+	// the handler doesn't block the mappings
+	_, found := nat.GetMapping("tcp", 10000)
+	require.True(t, found, "expected port mapping")
+	close(unblock)
+	require.NoError(t, <-done)
+}
+
+func TestMultipleGateways(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	gw1 := newMockGateway(ctrl, net.IPv4(192, 168, 1, 1), net.IPv4(127, 0, 0, 1))
+	gw2 := newMockGateway(ctrl, net.IPv4(10, 0, 0, 1), nil)
+	// the same device as gw1, speaking another protocol
+	gw1UPnP := NewMockNAT(ctrl)
+	gw1UPnP.EXPECT().Type().Return("UPNP (IG2)").AnyTimes()
+	gw1UPnP.EXPECT().GetDeviceAddress().Return(net.IPv4(192, 168, 1, 1), nil).AnyTimes()
+	gw1UPnP.EXPECT().GetInternalAddress().Return(net.IPv4(127, 0, 0, 1), nil).AnyTimes()
+	mockDiscovery(t, []nat.NAT{gw1, gw2, gw1UPnP}, nil)
+
+	gw1UPnP.EXPECT().GetExternalAddress().Return(net.IPv4(1, 2, 3, 4), nil)
+	gw2.EXPECT().GetExternalAddress().Return(net.IPv4(5, 6, 7, 8), nil)
+	n, err := DiscoverNAT(context.Background())
+	require.NoError(t, err)
+	gws := n.Gateways()
+	require.Len(t, gws, 2)
+	require.Equal(t, "UPNP (IG2)", gws[0].Type, "expected the best protocol of the device to be used")
+	require.Equal(t, netip.MustParseAddr("192.168.1.1"), gws[0].Addr)
+	require.Equal(t, netip.MustParseAddr("10.0.0.1"), gws[1].Addr)
+
+	gw1UPnP.EXPECT().AddPortMapping("tcp", 10000, gomock.Any(), MappingDuration).Return(1234, nil)
+	gw2.EXPECT().AddPortMapping("tcp", 10000, gomock.Any(), MappingDuration).Return(4321, nil)
+	require.NoError(t, n.AddMapping("tcp", 10000))
+	require.ElementsMatch(t, []netip.AddrPort{
+		netip.MustParseAddrPort("1.2.3.4:1234"),
+		netip.MustParseAddrPort("5.6.7.8:4321"),
+	}, n.GetMappings("tcp", 10000))
+	mappings := n.Mappings()
+	require.Len(t, mappings, 2)
+	require.Equal(t, netip.MustParseAddr("10.0.0.1"), mappings[0].Gateway)
+	require.Equal(t, 4321, mappings[0].ExternalPort)
+	require.Equal(t, netip.MustParseAddr("192.168.1.1"), mappings[1].Gateway)
+	require.Equal(t, 1234, mappings[1].ExternalPort)
+
+	gw1UPnP.EXPECT().DeletePortMapping("tcp", 10000)
+	gw2.EXPECT().DeletePortMapping("tcp", 10000)
+	require.NoError(t, n.RemoveMapping("tcp", 10000))
+}
+
+func TestSelectGateways(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	gw1 := newMockGateway(ctrl, net.IPv4(192, 168, 1, 1), net.IPv4(127, 0, 0, 1))
+	gw2 := newMockGateway(ctrl, net.IPv4(10, 0, 0, 1), nil)
+	mockDiscovery(t, []nat.NAT{gw1, gw2}, nil)
+
+	loopback := func() string {
+		ifaces, err := net.Interfaces()
+		require.NoError(t, err)
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagLoopback != 0 {
+				return iface.Name
+			}
+		}
+		t.Skip("no loopback interface")
+		return ""
+	}()
+
+	gw1.EXPECT().GetExternalAddress().Return(net.IPv4(1, 2, 3, 4), nil)
+	n, err := DiscoverNAT(context.Background(), WithInterfaces(loopback))
+	require.NoError(t, err)
+	require.Equal(t, []Gateway{{Type: "NAT-PMP", Addr: netip.MustParseAddr("192.168.1.1"), Interface: loopback}}, n.Gateways())
+
+	gw2.EXPECT().GetExternalAddress().Return(net.IPv4(5, 6, 7, 8), nil)
+	n, err = DiscoverNAT(context.Background(), WithGateways(func(gw Gateway) bool { return gw.Addr == netip.MustParseAddr("10.0.0.1") }))
+	require.NoError(t, err)
+	require.Len(t, n.Gateways(), 1)
+	require.Equal(t, netip.MustParseAddr("10.0.0.1"), n.Gateways()[0].Addr)
+
+	_, err = DiscoverNAT(context.Background(), WithGateways(func(Gateway) bool { return false }))
+	require.ErrorIs(t, err, nat.ErrNoNATFound)
+}
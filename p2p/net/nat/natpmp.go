@@ -0,0 +1,96 @@
+package nat
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/libp2p/go-nat"
+
+	natpmp "github.com/jackpal/go-nat-pmp"
+)
+
+// natpmpNAT implements nat.NAT using NAT-PMP (RFC 6886). go-nat only probes the
+// default gateway for NAT-PMP, this is used for the gateways set by WithGatewayAddrs.
+type natpmpNAT struct {
+	c       *natpmp.Client
+	gateway net.IP
+	// ports maps the internal ports to the external ports
+	ports map[entry]int
+}
+
+var _ nat.NAT = (*natpmpNAT)(nil)
+
+// so we can mock it in tests
+var discoverNATPMP = func(ctx context.Context, gw net.IP) (nat.NAT, error) {
+	c := natpmp.NewClientWithTimeout(gw, pcpDiscoveryTimeout)
+	res := make(chan error, 1)
+	go func() {
+		_, err := c.GetExternalAddress()
+		res <- err
+	}()
+	select {
+	case err := <-res:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &natpmpNAT{
+		c:       natpmp.NewClientWithTimeout(gw, pcpRequestTimeout),
+		gateway: gw,
+		ports:   make(map[entry]int),
+	}, nil
+}
+
+func (n *natpmpNAT) Type() string {
+	return "NAT-PMP"
+}
+
+func (n *natpmpNAT) GetDeviceAddress() (net.IP, error) {
+	return n.gateway, nil
+}
+
+func (n *natpmpNAT) GetInternalAddress() (net.IP, error) {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: n.gateway, Port: pcpPort})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+func (n *natpmpNAT) GetExternalAddress() (net.IP, error) {
+	res, err := n.c.GetExternalAddress()
+	if err != nil {
+		return nil, err
+	}
+	ip := res.ExternalIPAddress
+	return net.IPv4(ip[0], ip[1], ip[2], ip[3]), nil
+}
+
+func (n *natpmpNAT) AddPortMapping(protocol string, internalPort int, _ string, timeout time.Duration) (int, error) {
+	lifetime := timeout
+	if lifetime <= 0 {
+		lifetime = pcpDefaultLifetime
+	}
+	e := entry{protocol: protocol, port: internalPort}
+	externalPort, ok := n.ports[e]
+	if !ok {
+		externalPort = internalPort
+	}
+	res, err := n.c.AddPortMapping(protocol, internalPort, externalPort, int(lifetime/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	n.ports[e] = int(res.MappedExternalPort)
+	return int(res.MappedExternalPort), nil
+}
+
+func (n *natpmpNAT) DeletePortMapping(protocol string, internalPort int) error {
+	delete(n.ports, entry{protocol: protocol, port: internalPort})
+	// a lifetime of 0 deletes the mapping
+	_, err := n.c.AddPortMapping(protocol, internalPort, 0, 0)
+	return err
+}
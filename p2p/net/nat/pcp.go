@@ -0,0 +1,313 @@
+package nat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-nat"
+)
+
+// PCP (Port Control Protocol, RFC 6887) is the successor of NAT-PMP. Many modern
+// CPE devices and carrier-grade NATs only speak PCP.
+
+const (
+	pcpPort    = 5351
+	pcpVersion = 2
+
+	pcpOpAnnounce = 0
+	pcpOpMap      = 1
+	pcpResponse   = 0x80
+
+	pcpHeaderLen  = 24
+	pcpMapDataLen = 36
+
+	// pcpDefaultLifetime is the lifetime requested for mappings without a timeout.
+	// A lifetime of 0 deletes a mapping in PCP.
+	pcpDefaultLifetime = 2 * time.Hour
+
+	// pcpDiscoveryTimeout bounds how long we wait for a PCP server to answer before
+	// falling back to UPnP and NAT-PMP.
+	pcpDiscoveryTimeout = time.Second
+	// pcpRequestTimeout bounds how long we retransmit MAP requests.
+	pcpRequestTimeout = 4 * time.Second
+)
+
+// pcpRetransmits are the timeouts after which a request is retransmitted. RFC 6887
+// suggests a much longer initial timeout, but we'd rather fall back quickly.
+var pcpRetransmits = []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second}
+
+var pcpResultCodes = map[byte]string{
+	1:  "UNSUPP_VERSION",
+	2:  "NOT_AUTHORIZED",
+	3:  "MALFORMED_REQUEST",
+	4:  "UNSUPP_OPCODE",
+	5:  "UNSUPP_OPTION",
+	6:  "MALFORMED_OPTION",
+	7:  "NETWORK_FAILURE",
+	8:  "NO_RESOURCES",
+	9:  "UNSUPP_PROTOCOL",
+	10: "USER_EX_QUOTA",
+	11: "CANNOT_PROVIDE_EXTERNAL",
+	12: "ADDRESS_MISMATCH",
+	13: "EXCESSIVE_REMOTE_PEERS",
+}
+
+// pcpError is a result code returned by a PCP server.
+type pcpError byte
+
+func (e pcpError) Error() string {
+	if name, ok := pcpResultCodes[byte(e)]; ok {
+		return "PCP error: " + name
+	}
+	return fmt.Sprintf("PCP error: result code %d", byte(e))
+}
+
+var errPCPUnsupportedVersion = errors.New("gateway doesn't support PCP")
+
+// so we can mock it in tests
+var discoverPCP = func(ctx context.Context, gw net.IP) (nat.NAT, error) {
+	n, err := probePCP(ctx, &net.UDPAddr{IP: gw, Port: pcpPort})
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// probePCP checks that server speaks PCP, by sending it an ANNOUNCE request.
+func probePCP(ctx context.Context, server *net.UDPAddr) (*pcpNAT, error) {
+	conn, err := net.DialUDP("udp", nil, server)
+	if err != nil {
+		return nil, err
+	}
+	n := &pcpNAT{
+		server:   server,
+		conn:     conn,
+		mappings: make(map[entry]*pcpMapping),
+	}
+	ctx, cancel := context.WithTimeout(ctx, pcpDiscoveryTimeout)
+	defer cancel()
+	if _, err := n.request(ctx, pcpOpAnnounce, 0, nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// pcpMapping is a mapping requested from a PCP server.
+type pcpMapping struct {
+	nonce        [12]byte
+	externalPort int
+	externalIP   net.IP
+}
+
+// pcpNAT implements nat.NAT using PCP MAP requests.
+type pcpNAT struct {
+	server *net.UDPAddr
+
+	mx       sync.Mutex // serializes requests, guards mappings and the fields below
+	conn     *net.UDPConn
+	mappings map[entry]*pcpMapping
+	// externalIP is the external address of the most recent mapping
+	externalIP net.IP
+}
+
+var _ nat.NAT = (*pcpNAT)(nil)
+
+func (n *pcpNAT) Type() string {
+	return "PCP"
+}
+
+// Close closes the socket used to talk to the server. It doesn't delete the mappings.
+func (n *pcpNAT) Close() error {
+	return n.conn.Close()
+}
+
+func (n *pcpNAT) GetDeviceAddress() (net.IP, error) {
+	return n.server.IP, nil
+}
+
+func (n *pcpNAT) GetInternalAddress() (net.IP, error) {
+	return n.conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// GetExternalAddress returns the external address assigned to the most recent
+// mapping, as PCP has no request to only query the external address.
+func (n *pcpNAT) GetExternalAddress() (net.IP, error) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	if n.externalIP == nil {
+		return nil, errors.New("no PCP mapping established yet")
+	}
+	return n.externalIP, nil
+}
+
+func (n *pcpNAT) AddPortMapping(protocol string, internalPort int, _ string, timeout time.Duration) (int, error) {
+	proto, err := pcpProtocol(protocol)
+	if err != nil {
+		return 0, err
+	}
+	lifetime := timeout
+	if lifetime <= 0 {
+		lifetime = pcpDefaultLifetime
+	}
+
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	e := entry{protocol: protocol, port: internalPort}
+	m, ok := n.mappings[e]
+	if !ok {
+		m = &pcpMapping{externalPort: internalPort}
+		if _, err := rand.Read(m.nonce[:]); err != nil {
+			return 0, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pcpRequestTimeout)
+	defer cancel()
+	resp, err := n.request(ctx, pcpOpMap, lifetime, n.mapData(m, proto, internalPort))
+	if err != nil {
+		return 0, err
+	}
+	m.externalPort = int(binary.BigEndian.Uint16(resp[pcpHeaderLen+18:]))
+	m.externalIP = pcpIP(resp[pcpHeaderLen+20 : pcpHeaderLen+36])
+	n.mappings[e] = m
+	n.externalIP = m.externalIP
+	return m.externalPort, nil
+}
+
+func (n *pcpNAT) DeletePortMapping(protocol string, internalPort int) error {
+	proto, err := pcpProtocol(protocol)
+	if err != nil {
+		return err
+	}
+
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	e := entry{protocol: protocol, port: internalPort}
+	m, ok := n.mappings[e]
+	if !ok {
+		return nil
+	}
+	delete(n.mappings, e)
+	ctx, cancel := context.WithTimeout(context.Background(), pcpRequestTimeout)
+	defer cancel()
+	_, err = n.request(ctx, pcpOpMap, 0, n.mapData(m, proto, internalPort))
+	return err
+}
+
+// mapData returns the opcode-specific data of a MAP request for m. The previously
+// assigned external port and address are suggested, so that renewals keep them.
+func (n *pcpNAT) mapData(m *pcpMapping, proto byte, internalPort int) []byte {
+	b := make([]byte, pcpMapDataLen)
+	copy(b, m.nonce[:])
+	b[12] = proto
+	binary.BigEndian.PutUint16(b[16:], uint16(internalPort))
+	binary.BigEndian.PutUint16(b[18:], uint16(m.externalPort))
+	if m.externalIP != nil {
+		copy(b[20:], m.externalIP.To16())
+	} else {
+		copy(b[20:], net.IPv6zero)
+	}
+	return b
+}
+
+// request sends a request with opcode op to the server, retransmitting it until a
+// matching response arrives or ctx is done. The mutex must be held.
+func (n *pcpNAT) request(ctx context.Context, op byte, lifetime time.Duration, data []byte) ([]byte, error) {
+	req := make([]byte, pcpHeaderLen, pcpHeaderLen+len(data))
+	req[0] = pcpVersion
+	req[1] = op
+	binary.BigEndian.PutUint32(req[4:], uint32(lifetime/time.Second))
+	copy(req[8:], n.conn.LocalAddr().(*net.UDPAddr).IP.To16())
+	req = append(req, data...)
+
+	buf := make([]byte, 1100) // the maximum size of a PCP message
+	for _, timeout := range pcpRetransmits {
+		if _, err := n.conn.Write(req); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		n.conn.SetReadDeadline(deadline)
+		for {
+			l, err := n.conn.Read(buf)
+			if err != nil {
+				var nerr net.Error
+				if errors.As(err, &nerr) && nerr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			resp := buf[:l]
+			if ok, err := pcpMatches(req, resp); err != nil {
+				return nil, err
+			} else if ok {
+				return resp, nil
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("PCP request timed out: %w", err)
+	}
+	return nil, errors.New("PCP request timed out")
+}
+
+// pcpMatches returns true if resp is the successful response to req. Unrelated
+// messages are ignored, errors returned by the server are returned.
+func pcpMatches(req, resp []byte) (bool, error) {
+	if len(resp) < 4 {
+		return false, nil
+	}
+	if resp[0] != pcpVersion {
+		// NAT-PMP servers answer with version 0 and an UNSUPP_VERSION result
+		if resp[0] == 0 && resp[3] == 1 {
+			return false, errPCPUnsupportedVersion
+		}
+		return false, nil
+	}
+	if len(resp) < pcpHeaderLen || resp[1] != req[1]|pcpResponse {
+		return false, nil
+	}
+	if req[1] == pcpOpMap {
+		// the nonce, protocol and internal port must match
+		if len(resp) < pcpHeaderLen+pcpMapDataLen || string(resp[pcpHeaderLen:pcpHeaderLen+18]) != string(req[pcpHeaderLen:pcpHeaderLen+18]) {
+			return false, nil
+		}
+	}
+	if code := resp[3]; code != 0 {
+		return false, pcpError(code)
+	}
+	return true, nil
+}
+
+func pcpProtocol(protocol string) (byte, error) {
+	switch protocol {
+	case "tcp":
+		return 6, nil
+	case "udp":
+		return 17, nil
+	default:
+		return 0, fmt.Errorf("invalid protocol: %s", protocol)
+	}
+}
+
+// pcpIP converts the 16 byte address of a PCP message, which is IPv4-mapped for IPv4.
+func pcpIP(b []byte) net.IP {
+	ip := net.IP(append([]byte(nil), b...))
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
@@ -0,0 +1,159 @@
+package nat
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-nat"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type pcpRequest struct {
+	op       byte
+	lifetime uint32
+	nonce    []byte
+	port     uint16
+}
+
+// fakePCPServer is a PCP server that maps internal ports to external port + 1000.
+type fakePCPServer struct {
+	conn *net.UDPConn
+
+	mx       sync.Mutex
+	requests []pcpRequest
+}
+
+func newFakePCPServer(t *testing.T, natpmp bool) *fakePCPServer {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	s := &fakePCPServer{conn: conn}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve(natpmp)
+	return s
+}
+
+func (s *fakePCPServer) addr() *net.UDPAddr {
+	return s.conn.LocalAddr().(*net.UDPAddr)
+}
+
+func (s *fakePCPServer) serve(natpmp bool) {
+	buf := make([]byte, 1100)
+	for {
+		l, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		req := buf[:l]
+		if natpmp {
+			s.conn.WriteToUDP([]byte{0, 0x80 | req[1], 0, 1, 0, 0, 0, 0}, from)
+			continue
+		}
+		r := pcpRequest{op: req[1], lifetime: binary.BigEndian.Uint32(req[4:])}
+		resp := make([]byte, l)
+		copy(resp, req)
+		resp[1] |= pcpResponse
+		if r.op == pcpOpMap {
+			r.nonce = append([]byte(nil), req[pcpHeaderLen:pcpHeaderLen+12]...)
+			r.port = binary.BigEndian.Uint16(req[pcpHeaderLen+16:])
+			binary.BigEndian.PutUint16(resp[pcpHeaderLen+18:], r.port+1000)
+			copy(resp[pcpHeaderLen+20:], net.IPv4(1, 2, 3, 4).To16())
+		}
+		s.mx.Lock()
+		s.requests = append(s.requests, r)
+		s.mx.Unlock()
+		s.conn.WriteToUDP(resp, from)
+	}
+}
+
+func (s *fakePCPServer) getRequests() []pcpRequest {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]pcpRequest(nil), s.requests...)
+}
+
+func TestPCPMapping(t *testing.T) {
+	s := newFakePCPServer(t, false)
+	n, err := probePCP(context.Background(), s.addr())
+	require.NoError(t, err)
+	require.Equal(t, "PCP", n.Type())
+
+	_, err = n.GetExternalAddress()
+	require.Error(t, err, "expected no external address before the first mapping")
+
+	port, err := n.AddPortMapping("tcp", 4001, "libp2p", MappingDuration)
+	require.NoError(t, err)
+	require.Equal(t, 5001, port)
+	extIP, err := n.GetExternalAddress()
+	require.NoError(t, err)
+	require.True(t, extIP.Equal(net.IPv4(1, 2, 3, 4)))
+
+	// renewing keeps the nonce
+	_, err = n.AddPortMapping("tcp", 4001, "libp2p", MappingDuration)
+	require.NoError(t, err)
+	require.NoError(t, n.DeletePortMapping("tcp", 4001))
+
+	reqs := s.getRequests()
+	require.Len(t, reqs, 4)
+	require.Equal(t, byte(pcpOpAnnounce), reqs[0].op)
+	for _, r := range reqs[1:] {
+		require.Equal(t, byte(pcpOpMap), r.op)
+		require.Equal(t, uint16(4001), r.port)
+		require.True(t, bytes.Equal(reqs[1].nonce, r.nonce))
+	}
+	require.Equal(t, uint32(MappingDuration/time.Second), reqs[1].lifetime)
+	require.Zero(t, reqs[3].lifetime, "deleting a mapping requests a lifetime of 0")
+}
+
+func TestPCPNATPMPServer(t *testing.T) {
+	s := newFakePCPServer(t, true)
+	_, err := probePCP(context.Background(), s.addr())
+	require.ErrorIs(t, err, errPCPUnsupportedVersion)
+}
+
+func TestPCPNoServer(t *testing.T) {
+	s := newFakePCPServer(t, false)
+	addr := s.addr()
+	s.conn.Close()
+	start := time.Now()
+	_, err := probePCP(context.Background(), addr)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 2*pcpDiscoveryTimeout)
+}
+
+func TestDiscoverPrefersPCP(t *testing.T) {
+	s := newFakePCPServer(t, false)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// the PCP server also speaks NAT-PMP
+	natpmp := newMockGateway(ctrl, net.IPv4(127, 0, 0, 1), nil)
+	var pcp *pcpNAT
+	mockDiscovery(t, []nat.NAT{natpmp}, func(ctx context.Context, gw net.IP) (nat.NAT, error) {
+		require.True(t, gw.Equal(net.IPv4(127, 0, 0, 1)))
+		var err error
+		pcp, err = probePCP(ctx, s.addr())
+		return pcp, err
+	})
+
+	n, err := DiscoverNAT(context.Background())
+	require.NoError(t, err)
+	require.Len(t, n.Gateways(), 1)
+	require.Equal(t, "PCP", n.Gateways()[0].Type)
+	require.NoError(t, n.AddMapping("udp", 4001))
+	mapped, found := n.GetMapping("udp", 4001)
+	require.True(t, found, "expected port mapping")
+	require.Equal(t, uint16(5001), mapped.Port())
+	require.Equal(t, "1.2.3.4", mapped.Addr().String())
+
+	// closing the NAT closes the socket of the PCP gateway
+	require.NoError(t, n.Close())
+	_, err = pcp.conn.Write([]byte{0})
+	require.ErrorIs(t, err, net.ErrClosed)
+}
@@ -0,0 +1,290 @@
+// Package nat64 detects IPv6-only networks that provide IPv4 connectivity through
+// NAT64 and DNS64, as many mobile networks do.
+//
+// On such networks, IPv4 addresses can't be dialed directly. They can be dialed by
+// embedding them in the NAT64 prefix of the network (RFC 6052), which is discovered
+// by resolving ipv4only.arpa (RFC 7050). IPv4 addresses of the node itself are
+// useless to its peers, since NAT64 only translates outgoing connections.
+package nat64
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// WellKnownPrefix is the NAT64 prefix reserved by RFC 6052.
+var WellKnownPrefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// clatPrefix is the range reserved for the IPv4 addresses of the CLAT (RFC 7335), the
+// customer-side translator of 464XLAT. Connections from these addresses are
+// translated to IPv6 and then back to IPv4 by the NAT64.
+var clatPrefix = netip.MustParsePrefix("192.0.0.0/29")
+
+// ipv4OnlyName is the name resolved to discover the NAT64 prefix, see RFC 7050.
+const ipv4OnlyName = "ipv4only.arpa"
+
+// ipv4OnlyAddrs are the IPv4 addresses ipv4only.arpa resolves to.
+var ipv4OnlyAddrs = [...]netip.Addr{netip.AddrFrom4([4]byte{192, 0, 0, 170}), netip.AddrFrom4([4]byte{192, 0, 0, 171})}
+
+// prefixLens are the NAT64 prefix lengths allowed by RFC 6052.
+var prefixLens = [...]int{96, 64, 56, 48, 40, 32}
+
+// Resolver resolves host names. Both net.Resolver and madns.Resolver implement it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// IsCLATAddr reports whether ip is an IPv4 address of a CLAT.
+func IsCLATAddr(ip netip.Addr) bool {
+	return clatPrefix.Contains(ip.Unmap())
+}
+
+// Synthesize embeds the IPv4 address ip in the NAT64 prefix, as described in RFC
+// 6052. It returns false if ip isn't an IPv4 address or the prefix length isn't one
+// of 32, 40, 48, 56, 64 and 96.
+func Synthesize(prefix netip.Prefix, ip netip.Addr) (netip.Addr, bool) {
+	ip = ip.Unmap()
+	if !ip.Is4() || !prefix.Addr().Is6() || !validPrefixLen(prefix.Bits()) {
+		return netip.Addr{}, false
+	}
+	b := prefix.Masked().Addr().As16()
+	v4 := ip.As4()
+	i := prefix.Bits() / 8
+	for _, o := range v4 {
+		// bits 64 to 71 are reserved, and must be zero
+		if i == 8 {
+			i++
+		}
+		b[i] = o
+		i++
+	}
+	return netip.AddrFrom16(b), true
+}
+
+// extract returns the IPv4 address embedded in ip, assuming a NAT64 prefix of length
+// bits.
+func extract(ip netip.Addr, bits int) netip.Addr {
+	b := ip.As16()
+	var v4 [4]byte
+	i := bits / 8
+	for j := range v4 {
+		if i == 8 {
+			i++
+		}
+		v4[j] = b[i]
+		i++
+	}
+	return netip.AddrFrom4(v4)
+}
+
+func validPrefixLen(bits int) bool {
+	for _, l := range prefixLens {
+		if bits == l {
+			return true
+		}
+	}
+	return false
+}
+
+// findPrefix returns the NAT64 prefix used to synthesize the addresses ipv4only.arpa
+// resolved to.
+func findPrefix(addrs []net.IPAddr) (netip.Prefix, bool) {
+	for _, a := range addrs {
+		ip, ok := netip.AddrFromSlice(a.IP)
+		if !ok || ip.Is4In6() || !ip.Is6() {
+			continue
+		}
+		for _, bits := range prefixLens {
+			embedded := extract(ip, bits)
+			for _, known := range ipv4OnlyAddrs {
+				if embedded == known {
+					return netip.PrefixFrom(ip, bits).Masked(), true
+				}
+			}
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// isIPv6Only reports whether the interface addresses include a global IPv6 address
+// but no usable IPv4 address. Loopback, link-local and CLAT addresses aren't
+// usable.
+func isIPv6Only(addrs []net.Addr) bool {
+	var v6 bool
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(ipnet.IP)
+		if !ok {
+			continue
+		}
+		ip = ip.Unmap()
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		if ip.Is4() {
+			if !IsCLATAddr(ip) {
+				return false
+			}
+			continue
+		}
+		if ip.IsGlobalUnicast() {
+			v6 = true
+		}
+	}
+	return v6
+}
+
+// Detector detects whether the node is in an IPv6-only network, and the NAT64 prefix
+// of the network. It doesn't refresh its state by itself: Refresh has to be called
+// whenever the network may have changed. The BasicHost does this periodically.
+//
+// Detector is safe for concurrent use.
+type Detector struct {
+	resolver       Resolver
+	interfaceAddrs func() ([]net.Addr, error)
+
+	mx       sync.RWMutex
+	prefix   netip.Prefix
+	ipv6Only bool
+}
+
+type Option func(*Detector) error
+
+// WithResolver sets the resolver used to discover the NAT64 prefix. It has to use the
+// DNS64 servers of the network. Defaults to net.DefaultResolver.
+func WithResolver(r Resolver) Option {
+	return func(d *Detector) error {
+		d.resolver = r
+		return nil
+	}
+}
+
+// WithInterfaceAddrs sets the function returning the addresses of the network
+// interfaces. Defaults to net.InterfaceAddrs. This is mostly useful for tests.
+func WithInterfaceAddrs(f func() ([]net.Addr, error)) Option {
+	return func(d *Detector) error {
+		d.interfaceAddrs = f
+		return nil
+	}
+}
+
+// NewDetector creates a Detector. Until Refresh is called, it doesn't consider the
+// network to be IPv6-only.
+func NewDetector(opts ...Option) (*Detector, error) {
+	d := &Detector{
+		resolver:       net.DefaultResolver,
+		interfaceAddrs: net.InterfaceAddrs,
+	}
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Refresh detects whether the network is IPv6-only, and if so, discovers its NAT64
+// prefix. It returns true if the state of the Detector changed. If the prefix can't
+// be resolved, the previously discovered prefix is kept and the error is returned.
+func (d *Detector) Refresh(ctx context.Context) (changed bool, err error) {
+	ifaceAddrs, err := d.interfaceAddrs()
+	if err != nil {
+		return false, err
+	}
+	ipv6Only := isIPv6Only(ifaceAddrs)
+
+	d.mx.RLock()
+	prefix := d.prefix
+	d.mx.RUnlock()
+	if ipv6Only {
+		var addrs []net.IPAddr
+		addrs, err = d.resolver.LookupIPAddr(ctx, ipv4OnlyName)
+		if err == nil {
+			// no DNS64 if the name only resolved to its IPv4 addresses
+			prefix, _ = findPrefix(addrs)
+		}
+	} else {
+		prefix = netip.Prefix{}
+	}
+
+	d.mx.Lock()
+	changed = ipv6Only != d.ipv6Only || prefix != d.prefix
+	d.ipv6Only = ipv6Only
+	d.prefix = prefix
+	d.mx.Unlock()
+	return changed, err
+}
+
+// IPv6Only reports whether the network was IPv6-only at the last refresh.
+func (d *Detector) IPv6Only() bool {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	return d.ipv6Only
+}
+
+// Prefix returns the NAT64 prefix of the network. It returns false if the network
+// isn't IPv6-only, or provides no NAT64.
+func (d *Detector) Prefix() (netip.Prefix, bool) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	return d.prefix, d.prefix.IsValid()
+}
+
+// SynthesizeAddrs returns the public /ip4 addresses in addrs with their IP address
+// embedded in the NAT64 prefix. It returns nil if the network isn't IPv6-only or
+// provides no NAT64.
+func (d *Detector) SynthesizeAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	prefix, ok := d.Prefix()
+	if !ok {
+		return nil
+	}
+	var out []ma.Multiaddr
+	for _, a := range addrs {
+		first, rest := ma.SplitFirst(a)
+		if first == nil || first.Protocol().Code != ma.P_IP4 || !manet.IsPublicAddr(a) {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(first.RawValue())
+		if !ok {
+			continue
+		}
+		ip6, ok := Synthesize(prefix, ip)
+		if !ok {
+			continue
+		}
+		synthesized, err := ma.NewMultiaddr("/ip6/" + ip6.String())
+		if err != nil {
+			continue
+		}
+		if rest != nil {
+			synthesized = synthesized.Encapsulate(rest)
+		}
+		out = append(out, synthesized)
+	}
+	return out
+}
+
+// AdvertisableAddr reports whether a is worth advertising to peers. CLAT addresses
+// never are, and on IPv6-only networks no IPv4 address is, except loopback ones.
+func (d *Detector) AdvertisableAddr(a ma.Multiaddr) bool {
+	first, _ := ma.SplitFirst(a)
+	if first == nil || first.Protocol().Code != ma.P_IP4 {
+		return true
+	}
+	ip, ok := netip.AddrFromSlice(first.RawValue())
+	if !ok {
+		return true
+	}
+	if IsCLATAddr(ip) {
+		return false
+	}
+	return ip.IsLoopback() || !d.IPv6Only()
+}
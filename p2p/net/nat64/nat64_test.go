@@ -0,0 +1,135 @@
+package nat64
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSynthesize(t *testing.T) {
+	// examples from RFC 6052, section 2.4
+	ip := netip.MustParseAddr("192.0.2.33")
+	for _, tc := range []struct {
+		prefix, want string
+	}{
+		{"2001:db8::/32", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::192.0.2.33"},
+		{"64:ff9b::/96", "64:ff9b::192.0.2.33"},
+	} {
+		prefix := netip.MustParsePrefix(tc.prefix)
+		got, ok := Synthesize(prefix, ip)
+		require.True(t, ok, tc.prefix)
+		require.Equal(t, netip.MustParseAddr(tc.want), got, tc.prefix)
+		require.Equal(t, ip, extract(got, prefix.Bits()), tc.prefix)
+	}
+
+	_, ok := Synthesize(netip.MustParsePrefix("2001:db8::/80"), ip)
+	require.False(t, ok)
+	_, ok = Synthesize(WellKnownPrefix, netip.MustParseAddr("2001:db8::1"))
+	require.False(t, ok)
+}
+
+type mockResolver struct {
+	addrs []net.IPAddr
+	err   error
+}
+
+func (r *mockResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	if host != ipv4OnlyName {
+		return nil, errors.New("unexpected host")
+	}
+	return r.addrs, r.err
+}
+
+func ifaceAddrs(ips ...string) func() ([]net.Addr, error) {
+	return func() ([]net.Addr, error) {
+		var addrs []net.Addr
+		for _, ip := range ips {
+			addr, ipnet, err := net.ParseCIDR(ip)
+			if err != nil {
+				return nil, err
+			}
+			ipnet.IP = addr
+			addrs = append(addrs, ipnet)
+		}
+		return addrs, nil
+	}
+}
+
+func TestDetector(t *testing.T) {
+	r := &mockResolver{addrs: []net.IPAddr{
+		{IP: net.ParseIP("192.0.0.170")},
+		{IP: net.ParseIP("2001:db8:64::c000:aa")},
+	}}
+	ipv6Only := ifaceAddrs("127.0.0.1/8", "192.0.0.4/29", "fe80::1/64", "2001:db8:1::1/64")
+	d, err := NewDetector(WithResolver(r), WithInterfaceAddrs(ipv6Only))
+	require.NoError(t, err)
+	require.False(t, d.IPv6Only())
+
+	changed, err := d.Refresh(context.Background())
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.True(t, d.IPv6Only())
+	prefix, ok := d.Prefix()
+	require.True(t, ok)
+	require.Equal(t, netip.MustParsePrefix("2001:db8:64::/96"), prefix)
+
+	addrs := d.SynthesizeAddrs([]ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1234"),
+		ma.StringCast("/ip4/1.2.3.4"),
+		ma.StringCast("/ip4/192.168.1.1/tcp/1234"),
+		ma.StringCast("/ip6/2001:db8::1/tcp/1234"),
+		ma.StringCast("/dns4/example.com/tcp/1234"),
+	})
+	require.Equal(t, []ma.Multiaddr{
+		ma.StringCast("/ip6/2001:db8:64::102:304/tcp/1234"),
+		ma.StringCast("/ip6/2001:db8:64::102:304"),
+	}, addrs)
+
+	require.True(t, d.AdvertisableAddr(ma.StringCast("/ip6/2001:db8:1::1/tcp/1234")))
+	require.True(t, d.AdvertisableAddr(ma.StringCast("/ip4/127.0.0.1/tcp/1234")))
+	require.False(t, d.AdvertisableAddr(ma.StringCast("/ip4/1.2.3.4/tcp/1234")))
+	require.False(t, d.AdvertisableAddr(ma.StringCast("/ip4/192.0.0.4/tcp/1234")))
+
+	// the prefix is kept if it can't be resolved
+	r.err = errors.New("failed")
+	changed, err = d.Refresh(context.Background())
+	require.Error(t, err)
+	require.False(t, changed)
+	_, ok = d.Prefix()
+	require.True(t, ok)
+
+	// no DNS64
+	r.err = nil
+	r.addrs = r.addrs[:1]
+	changed, err = d.Refresh(context.Background())
+	require.NoError(t, err)
+	require.True(t, changed)
+	_, ok = d.Prefix()
+	require.False(t, ok)
+	require.True(t, d.IPv6Only())
+	require.Nil(t, d.SynthesizeAddrs([]ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1234")}))
+}
+
+func TestDetectorDualStack(t *testing.T) {
+	r := &mockResolver{addrs: []net.IPAddr{{IP: net.ParseIP("64:ff9b::c000:aa")}}}
+	d, err := NewDetector(WithResolver(r), WithInterfaceAddrs(ifaceAddrs("192.168.1.2/24", "2001:db8:1::1/64")))
+	require.NoError(t, err)
+	changed, err := d.Refresh(context.Background())
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.False(t, d.IPv6Only())
+	_, ok := d.Prefix()
+	require.False(t, ok)
+	require.True(t, d.AdvertisableAddr(ma.StringCast("/ip4/1.2.3.4/tcp/1234")))
+	require.False(t, d.AdvertisableAddr(ma.StringCast("/ip4/192.0.0.4/tcp/1234")))
+}
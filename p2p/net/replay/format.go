@@ -0,0 +1,241 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// magic starts every recording file.
+const magic = "libp2p-stream-recording/1\n"
+
+const (
+	maxHeaderSize = 64 << 10
+	maxEventSize  = 16 << 20
+)
+
+// EventKind is the kind of an Event.
+type EventKind uint8
+
+const (
+	// EventRead is data read from the stream.
+	EventRead EventKind = iota + 1
+	// EventReadEOF is a read that returned io.EOF.
+	EventReadEOF
+	// EventReadReset is a read that failed because the stream was reset.
+	EventReadReset
+	// EventReadError is a read that failed with another error, e.g. a deadline. The
+	// data of the event is the error message.
+	EventReadError
+	// EventWrite is data written to the stream.
+	EventWrite
+	// EventWriteError is a write that failed. The data of the event is the error
+	// message.
+	EventWriteError
+	// EventCloseRead, EventCloseWrite, EventClose and EventReset record the calls to
+	// the methods of the same name.
+	EventCloseRead
+	EventCloseWrite
+	EventClose
+	EventReset
+	// EventTruncated marks the end of a recording that reached its size limit.
+	EventTruncated
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventRead:
+		return "read"
+	case EventReadEOF:
+		return "read EOF"
+	case EventReadReset:
+		return "read reset"
+	case EventReadError:
+		return "read error"
+	case EventWrite:
+		return "write"
+	case EventWriteError:
+		return "write error"
+	case EventCloseRead:
+		return "close read"
+	case EventCloseWrite:
+		return "close write"
+	case EventClose:
+		return "close"
+	case EventReset:
+		return "reset"
+	case EventTruncated:
+		return "truncated"
+	default:
+		return fmt.Sprintf("unknown (%d)", k)
+	}
+}
+
+// Event is an operation on a recorded stream.
+type Event struct {
+	Kind EventKind
+	// Offset is the time of the event, relative to the start of the recording.
+	Offset time.Duration
+	Data   []byte
+}
+
+// Header describes a recorded stream.
+type Header struct {
+	Protocol   protocol.ID
+	Direction  network.Direction
+	LocalPeer  peer.ID `json:",omitempty"`
+	RemotePeer peer.ID `json:",omitempty"`
+	LocalAddr  string
+	RemoteAddr string
+	// Start is the time the recording started.
+	Start time.Time
+}
+
+// Recording is a recorded stream.
+type Recording struct {
+	Header
+	Events []Event
+}
+
+// Read returns the data read from the stream.
+func (r *Recording) Read() []byte {
+	return r.data(EventRead)
+}
+
+// Written returns the data written to the stream.
+func (r *Recording) Written() []byte {
+	return r.data(EventWrite)
+}
+
+func (r *Recording) data(kind EventKind) []byte {
+	var b []byte
+	for _, e := range r.Events {
+		if e.Kind == kind {
+			b = append(b, e.Data...)
+		}
+	}
+	return b
+}
+
+// Load reads the recording stored in the file at path.
+func Load(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(bufio.NewReader(f))
+}
+
+// Decode reads a recording from r.
+func Decode(r io.Reader) (*Recording, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		brr := bufio.NewReader(r)
+		r, br = brr, brr
+	}
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, m); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	if string(m) != magic {
+		return nil, errors.New("not a stream recording")
+	}
+	hdr, err := readBlock(r, br, maxHeaderSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording header: %w", err)
+	}
+	rec := &Recording{}
+	if err := json.Unmarshal(hdr, &rec.Header); err != nil {
+		return nil, fmt.Errorf("failed to decode recording header: %w", err)
+	}
+	for {
+		kind, err := br.ReadByte()
+		if err == io.EOF {
+			return rec, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event: %w", unexpectedEOF(err))
+		}
+		data, err := readBlock(r, br, maxEventSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event: %w", err)
+		}
+		rec.Events = append(rec.Events, Event{Kind: EventKind(kind), Offset: time.Duration(offset), Data: data})
+	}
+}
+
+func readBlock(r io.Reader, br io.ByteReader, max int) ([]byte, error) {
+	l, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if l > uint64(max) {
+		return nil, fmt.Errorf("block too large: %d bytes", l)
+	}
+	if l == 0 {
+		return nil, nil
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func appendBlock(b, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func encodeHeader(h *Header) ([]byte, error) {
+	hdr, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return appendBlock([]byte(magic), hdr), nil
+}
+
+func encodeEvent(e Event) []byte {
+	b := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(e.Data))
+	b = append(b, byte(e.Kind))
+	b = binary.AppendUvarint(b, uint64(e.Offset))
+	return appendBlock(b, e.Data)
+}
+
+// Encode writes the recording to w, in the format of the files written by the
+// Recorder.
+func (r *Recording) Encode(w io.Writer) error {
+	hdr, err := encodeHeader(&r.Header)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.Write(hdr)
+	for _, e := range r.Events {
+		buf.Write(encodeEvent(e))
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,323 @@
+// Package replay records the traffic of selected streams, and replays it into
+// protocol handlers. It is meant to turn protocol bugs observed in production into
+// regression tests.
+//
+// Streams are recorded after decryption and demultiplexing: a recording holds the
+// data a handler read from, and wrote to, a single stream, as well as the errors
+// it saw. Inbound streams are recorded by wrapping their handler:
+//
+//	rec, err := replay.NewRecorder(dir, replay.WithFilter(replay.Peers(p)))
+//	...
+//	h.SetStreamHandler(proto, rec.Handler(handler))
+//
+// The recordings can then be replayed into the handler in a test:
+//
+//	r, err := replay.Load(path)
+//	...
+//	got, err := replay.Replay(ctx, r, handler)
+//	...
+//	require.Equal(t, r.Written(), got.Written())
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("replay")
+
+// FileExt is the extension of the recording files.
+const FileExt = ".rec"
+
+// DefaultMaxStreamBytes is the default value of WithMaxStreamBytes.
+const DefaultMaxStreamBytes = 16 << 20
+
+// Option configures a Recorder.
+type Option func(*Recorder) error
+
+// WithFilter selects the streams to record. All streams are recorded by default.
+func WithFilter(f func(network.Stream) bool) Option {
+	return func(r *Recorder) error {
+		r.filter = f
+		return nil
+	}
+}
+
+// WithMaxStreamBytes bounds the data read and written recorded per stream. Once
+// the limit is reached, the recording is truncated. Defaults to
+// DefaultMaxStreamBytes.
+func WithMaxStreamBytes(n int) Option {
+	return func(r *Recorder) error {
+		if n <= 0 {
+			return errors.New("max stream bytes must be positive")
+		}
+		r.maxStreamBytes = n
+		return nil
+	}
+}
+
+// Peers returns a filter selecting the streams to the peers ps.
+func Peers(ps ...peer.ID) func(network.Stream) bool {
+	return func(s network.Stream) bool {
+		for _, p := range ps {
+			if s.Conn().RemotePeer() == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Protocols returns a filter selecting the streams of the protocols protos.
+func Protocols(protos ...protocol.ID) func(network.Stream) bool {
+	return func(s network.Stream) bool {
+		for _, p := range protos {
+			if s.Protocol() == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Recorder records streams to files in a directory, one file per stream.
+type Recorder struct {
+	dir            string
+	filter         func(network.Stream) bool
+	maxStreamBytes int
+
+	seq atomic.Uint64
+
+	mx     sync.Mutex
+	closed bool
+	open   map[*eventLog]struct{}
+}
+
+// NewRecorder creates a Recorder writing its recordings to dir, which is created
+// if it doesn't exist.
+func NewRecorder(dir string, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		dir:            dir,
+		maxStreamBytes: DefaultMaxStreamBytes,
+		open:           make(map[*eventLog]struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Handler returns a stream handler recording the streams selected by the filter
+// before passing them to h.
+func (r *Recorder) Handler(h network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		h(r.Wrap(s))
+	}
+}
+
+// Wrap returns a stream recording s, if s is selected by the filter. Otherwise, or
+// if the recording can't be created, it returns s. The protocol of s must be set,
+// which is the case for the streams passed to handlers and returned by
+// host.NewStream.
+func (r *Recorder) Wrap(s network.Stream) network.Stream {
+	if r.filter != nil && !r.filter(s) {
+		return s
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.closed {
+		return s
+	}
+
+	start := time.Now()
+	name := fmt.Sprintf("%d-%d%s", start.UnixNano(), r.seq.Add(1), FileExt)
+	f, err := os.Create(filepath.Join(r.dir, name))
+	if err != nil {
+		log.Warnw("failed to create recording", "error", err)
+		return s
+	}
+	hdr, err := encodeHeader(headerOf(s, start))
+	if err == nil {
+		_, err = f.Write(hdr)
+	}
+	if err != nil {
+		log.Warnw("failed to write recording header", "file", f.Name(), "error", err)
+		f.Close()
+		return s
+	}
+
+	l := &eventLog{start: start, maxSize: r.maxStreamBytes, write: func(e Event) error {
+		_, err := f.Write(encodeEvent(e))
+		return err
+	}}
+	l.onClose = func() error {
+		r.mx.Lock()
+		delete(r.open, l)
+		r.mx.Unlock()
+		return f.Close()
+	}
+	r.open[l] = struct{}{}
+	return &stream{Stream: s, log: l}
+}
+
+// Close stops recording, and closes the files of the streams being recorded.
+func (r *Recorder) Close() error {
+	r.mx.Lock()
+	r.closed = true
+	logs := make([]*eventLog, 0, len(r.open))
+	for l := range r.open {
+		logs = append(logs, l)
+	}
+	r.mx.Unlock()
+
+	for _, l := range logs {
+		l.close()
+	}
+	return nil
+}
+
+func headerOf(s network.Stream, start time.Time) *Header {
+	c := s.Conn()
+	return &Header{
+		Protocol:   s.Protocol(),
+		Direction:  s.Stat().Direction,
+		LocalPeer:  c.LocalPeer(),
+		RemotePeer: c.RemotePeer(),
+		LocalAddr:  c.LocalMultiaddr().String(),
+		RemoteAddr: c.RemoteMultiaddr().String(),
+		Start:      start,
+	}
+}
+
+// eventLog passes the events of a stream to write, stopping once maxSize bytes of data
+// were recorded. Write errors stop the recording, but never fail the stream.
+type eventLog struct {
+	start   time.Time
+	maxSize int
+
+	mx      sync.Mutex
+	write   func(Event) error
+	size    int
+	done    bool
+	onClose func() error
+}
+
+func (l *eventLog) add(kind EventKind, data []byte) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if l.done {
+		return
+	}
+	if kind == EventRead || kind == EventWrite {
+		if l.size+len(data) > l.maxSize {
+			l.writeLocked(Event{Kind: EventTruncated, Offset: time.Since(l.start)})
+			l.closeLocked()
+			return
+		}
+		l.size += len(data)
+	}
+	l.writeLocked(Event{Kind: kind, Offset: time.Since(l.start), Data: data})
+	if kind == EventClose || kind == EventReset {
+		l.closeLocked()
+	}
+}
+
+func (l *eventLog) addError(kind EventKind, err error) {
+	l.add(kind, []byte(err.Error()))
+}
+
+func (l *eventLog) writeLocked(e Event) {
+	if err := l.write(e); err != nil {
+		log.Warnw("failed to write recording, stopping", "error", err)
+		l.closeLocked()
+	}
+}
+
+func (l *eventLog) close() {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.closeLocked()
+}
+
+func (l *eventLog) closeLocked() {
+	if l.done {
+		return
+	}
+	l.done = true
+	if l.onClose != nil {
+		if err := l.onClose(); err != nil {
+			log.Warnw("failed to close recording", "error", err)
+		}
+	}
+}
+
+// stream records the operations on a stream to its log.
+type stream struct {
+	network.Stream
+	log *eventLog
+}
+
+func (s *stream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	if n > 0 {
+		s.log.add(EventRead, b[:n])
+	}
+	switch {
+	case err == nil:
+	case err == io.EOF:
+		s.log.add(EventReadEOF, nil)
+	case errors.Is(err, network.ErrReset):
+		s.log.add(EventReadReset, nil)
+	default:
+		s.log.addError(EventReadError, err)
+	}
+	return n, err
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	n, err := s.Stream.Write(b)
+	if n > 0 {
+		s.log.add(EventWrite, b[:n])
+	}
+	if err != nil {
+		s.log.addError(EventWriteError, err)
+	}
+	return n, err
+}
+
+func (s *stream) CloseRead() error {
+	s.log.add(EventCloseRead, nil)
+	return s.Stream.CloseRead()
+}
+
+func (s *stream) CloseWrite() error {
+	s.log.add(EventCloseWrite, nil)
+	return s.Stream.CloseWrite()
+}
+
+func (s *stream) Close() error {
+	s.log.add(EventClose, nil)
+	return s.Stream.Close()
+}
+
+func (s *stream) Reset() error {
+	s.log.add(EventReset, nil)
+	return s.Stream.Reset()
+}
@@ -0,0 +1,193 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ErrTruncated is returned by the reads of a replayed stream past the end of a
+// truncated recording.
+var ErrTruncated = errors.New("recording truncated")
+
+// ErrReplayStream is returned by the operations a replayed stream doesn't support,
+// such as opening new streams on its connection.
+var ErrReplayStream = errors.New("not supported on a replayed stream")
+
+// Replay passes a stream replaying the reads of rec to h, and returns the recording
+// of what h did with the stream once h returns. Reads return the data recorded in the
+// same chunks, followed by the error that ended the recorded stream. Writes always
+// succeed.
+//
+// If h doesn't return before ctx is done, Replay returns the recording so far along
+// with the context error.
+func Replay(ctx context.Context, rec *Recording, h network.StreamHandler) (*Recording, error) {
+	start := time.Now()
+	var mx sync.Mutex
+	events := make([]Event, 0, len(rec.Events))
+	l := &eventLog{start: start, maxSize: math.MaxInt, write: func(e Event) error {
+		// the data is owned by the handler
+		e.Data = append([]byte(nil), e.Data...)
+		mx.Lock()
+		events = append(events, e)
+		mx.Unlock()
+		return nil
+	}}
+	s := &stream{Stream: newReplayStream(rec), log: l}
+	recording := func() *Recording {
+		got := &Recording{Header: rec.Header}
+		got.Start = start
+		mx.Lock()
+		got.Events = append([]Event(nil), events...)
+		mx.Unlock()
+		return got
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h(s)
+	}()
+	select {
+	case <-done:
+		return recording(), nil
+	case <-ctx.Done():
+		return recording(), ctx.Err()
+	}
+}
+
+// replayStream is a stream whose reads return the data recorded.
+type replayStream struct {
+	hdr  Header
+	conn *replayConn
+
+	mx       sync.Mutex
+	protocol protocol.ID
+	// reads are the read events left to replay
+	reads []Event
+	// last is the error returned once the reads are exhausted
+	last error
+}
+
+var _ network.Stream = &replayStream{}
+
+func newReplayStream(rec *Recording) *replayStream {
+	s := &replayStream{hdr: rec.Header, protocol: rec.Protocol, last: io.EOF}
+	for _, e := range rec.Events {
+		switch e.Kind {
+		case EventRead, EventReadEOF, EventReadReset, EventReadError, EventTruncated:
+			s.reads = append(s.reads, e)
+		}
+	}
+	s.conn = &replayConn{hdr: rec.Header, stream: s}
+	return s
+}
+
+func (s *replayStream) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if len(s.reads) == 0 {
+		return 0, s.last
+	}
+	e := &s.reads[0]
+	switch e.Kind {
+	case EventRead:
+		n := copy(b, e.Data)
+		if e.Data = e.Data[n:]; len(e.Data) == 0 {
+			s.reads = s.reads[1:]
+		}
+		return n, nil
+	case EventReadEOF:
+		s.last = io.EOF
+	case EventReadReset:
+		s.last = network.ErrReset
+	case EventReadError:
+		// transient errors, such as deadlines, aren't repeated
+		s.reads = s.reads[1:]
+		return 0, errors.New(string(e.Data))
+	case EventTruncated:
+		s.last = ErrTruncated
+	}
+	s.reads = s.reads[1:]
+	return 0, s.last
+}
+
+func (s *replayStream) Write(b []byte) (int, error) { return len(b), nil }
+func (s *replayStream) Close() error                { return nil }
+func (s *replayStream) CloseRead() error            { return nil }
+func (s *replayStream) CloseWrite() error           { return nil }
+func (s *replayStream) Reset() error                { return nil }
+
+func (s *replayStream) SetDeadline(time.Time) error      { return nil }
+func (s *replayStream) SetReadDeadline(time.Time) error  { return nil }
+func (s *replayStream) SetWriteDeadline(time.Time) error { return nil }
+
+func (s *replayStream) ID() string { return "replay" }
+
+func (s *replayStream) Protocol() protocol.ID {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.protocol
+}
+
+func (s *replayStream) SetProtocol(id protocol.ID) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.protocol = id
+	return nil
+}
+
+func (s *replayStream) Stat() network.Stats {
+	return network.Stats{Direction: s.hdr.Direction, Opened: s.hdr.Start}
+}
+
+func (s *replayStream) Conn() network.Conn         { return s.conn }
+func (s *replayStream) Scope() network.StreamScope { return &network.NullScope{} }
+
+// replayConn is the connection of a replayStream. It has the peers and addresses
+// of the recorded connection.
+type replayConn struct {
+	hdr    Header
+	stream *replayStream
+}
+
+var _ network.Conn = &replayConn{}
+
+func (c *replayConn) Close() error                       { return nil }
+func (c *replayConn) LocalPeer() peer.ID                 { return c.hdr.LocalPeer }
+func (c *replayConn) RemotePeer() peer.ID                { return c.hdr.RemotePeer }
+func (c *replayConn) RemotePublicKey() ic.PubKey         { return nil }
+func (c *replayConn) ConnState() network.ConnectionState { return network.ConnectionState{} }
+func (c *replayConn) LocalMultiaddr() ma.Multiaddr       { return parseAddr(c.hdr.LocalAddr) }
+func (c *replayConn) RemoteMultiaddr() ma.Multiaddr      { return parseAddr(c.hdr.RemoteAddr) }
+func (c *replayConn) Stat() network.ConnStats {
+	return network.ConnStats{Stats: network.Stats{Direction: c.hdr.Direction, Opened: c.hdr.Start}, NumStreams: 1}
+}
+func (c *replayConn) Scope() network.ConnScope { return &network.NullScope{} }
+func (c *replayConn) ID() string               { return "replay" }
+func (c *replayConn) NewStream(context.Context) (network.Stream, error) {
+	return nil, ErrReplayStream
+}
+func (c *replayConn) GetStreams() []network.Stream { return []network.Stream{c.stream} }
+func (c *replayConn) IsClosed() bool               { return false }
+
+func parseAddr(s string) ma.Multiaddr {
+	a, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return nil
+	}
+	return a
+}
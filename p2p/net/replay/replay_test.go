@@ -0,0 +1,222 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testProto protocol.ID = "/test/upper/1.0.0"
+
+// upperHandler answers every line it reads with the line in upper case.
+func upperHandler(s network.Stream) {
+	defer s.Close()
+	r := bufio.NewReader(s)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if _, err := s.Write([]byte(strings.ToUpper(line))); err != nil {
+			s.Reset()
+			return
+		}
+	}
+}
+
+func connectedHosts(t *testing.T) (host.Host, host.Host) {
+	mn, err := mocknet.FullMeshConnected(2)
+	require.NoError(t, err)
+	t.Cleanup(func() { mn.Close() })
+	hosts := mn.Hosts()
+	return hosts[0], hosts[1]
+}
+
+func recordings(t *testing.T, dir string) []*Recording {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+FileExt))
+	require.NoError(t, err)
+	var recs []*Recording
+	for _, f := range files {
+		rec, err := Load(f)
+		require.NoError(t, err)
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func exchange(t *testing.T, client, server host.Host, lines ...string) []byte {
+	t.Helper()
+	s, err := client.NewStream(context.Background(), server.ID(), testProto)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// mocknet streams are unbuffered: read the answers while writing, or the
+	// handler blocks on its writes
+	type result struct {
+		b   []byte
+		err error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		b, err := io.ReadAll(s)
+		resCh <- result{b, err}
+	}()
+	for _, l := range lines {
+		_, err := s.Write([]byte(l + "\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.CloseWrite())
+	res := <-resCh
+	require.NoError(t, res.err)
+	return res.b
+}
+
+func TestRecordReplay(t *testing.T) {
+	client, server := connectedHosts(t)
+	dir := t.TempDir()
+	r, err := NewRecorder(dir)
+	require.NoError(t, err)
+	defer r.Close()
+	server.SetStreamHandler(testProto, r.Handler(upperHandler))
+
+	require.Equal(t, []byte("FOO\nBAR\n"), exchange(t, client, server, "foo", "bar"))
+
+	var recs []*Recording
+	require.Eventually(t, func() bool {
+		recs = recordings(t, dir)
+		return len(recs) == 1 && len(recs[0].Events) > 0 && recs[0].Events[len(recs[0].Events)-1].Kind == EventClose
+	}, 5*time.Second, 10*time.Millisecond)
+	rec := recs[0]
+	require.Equal(t, testProto, rec.Protocol)
+	require.Equal(t, network.DirInbound, rec.Direction)
+	require.Equal(t, server.ID(), rec.LocalPeer)
+	require.Equal(t, client.ID(), rec.RemotePeer)
+	require.Equal(t, []byte("foo\nbar\n"), rec.Read())
+	require.Equal(t, []byte("FOO\nBAR\n"), rec.Written())
+
+	got, err := Replay(context.Background(), rec, upperHandler)
+	require.NoError(t, err)
+	require.Equal(t, rec.Written(), got.Written())
+	require.Equal(t, rec.Read(), got.Read())
+	require.Equal(t, EventClose, got.Events[len(got.Events)-1].Kind)
+
+	// a regression in the handler shows up in the replayed output
+	got, err = Replay(context.Background(), rec, func(s network.Stream) {
+		defer s.Close()
+		line, _ := bufio.NewReader(s).ReadString('\n')
+		s.Write([]byte(line))
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, rec.Written(), got.Written())
+}
+
+func TestRecorderFilter(t *testing.T) {
+	client, server := connectedHosts(t)
+	dir := t.TempDir()
+	r, err := NewRecorder(dir, WithFilter(Protocols("/other")))
+	require.NoError(t, err)
+	defer r.Close()
+	server.SetStreamHandler(testProto, r.Handler(upperHandler))
+
+	require.Equal(t, []byte("FOO\n"), exchange(t, client, server, "foo"))
+	require.Empty(t, recordings(t, dir))
+}
+
+func TestRecorderTruncates(t *testing.T) {
+	client, server := connectedHosts(t)
+	dir := t.TempDir()
+	r, err := NewRecorder(dir, WithMaxStreamBytes(10))
+	require.NoError(t, err)
+	defer r.Close()
+	server.SetStreamHandler(testProto, r.Handler(upperHandler))
+
+	// the stream works past the limit
+	require.Equal(t, []byte("FOO\nBAR\nBAZ\n"), exchange(t, client, server, "foo", "bar", "baz"))
+
+	var recs []*Recording
+	require.Eventually(t, func() bool {
+		recs = recordings(t, dir)
+		return len(recs) == 1 && len(recs[0].Events) > 0 && recs[0].Events[len(recs[0].Events)-1].Kind == EventTruncated
+	}, 5*time.Second, 10*time.Millisecond)
+	rec := recs[0]
+	require.LessOrEqual(t, len(rec.Read())+len(rec.Written()), 10)
+
+	var readErr error
+	_, err = Replay(context.Background(), rec, func(s network.Stream) {
+		_, readErr = io.ReadAll(s)
+	})
+	require.NoError(t, err)
+	require.ErrorIs(t, readErr, ErrTruncated)
+}
+
+func TestReplayResetAndTimeout(t *testing.T) {
+	rec := &Recording{
+		Header: Header{Protocol: testProto},
+		Events: []Event{
+			{Kind: EventRead, Data: []byte("hello")},
+			{Kind: EventReadError, Data: []byte("i/o deadline reached")},
+			{Kind: EventRead, Data: []byte(" world")},
+			{Kind: EventReadReset},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, rec.Encode(&buf))
+	decoded, err := Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, rec.Events, decoded.Events)
+
+	_, err = Replay(context.Background(), decoded, func(s network.Stream) {
+		b := make([]byte, 3)
+		n, err := s.Read(b)
+		require.NoError(t, err)
+		require.Equal(t, "hel", string(b[:n]))
+		n, err = s.Read(b)
+		require.NoError(t, err)
+		require.Equal(t, "lo", string(b[:n]))
+		_, err = s.Read(b)
+		require.EqualError(t, err, "i/o deadline reached")
+		rest, err := io.ReadAll(s)
+		require.ErrorIs(t, err, network.ErrReset)
+		require.Equal(t, " world", string(rest))
+	})
+	require.NoError(t, err)
+}
+
+func TestReplayTimesOut(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := Replay(ctx, &Recording{}, func(network.Stream) { <-block })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode(strings.NewReader("garbage"))
+	require.Error(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, (&Recording{Events: []Event{{Kind: EventRead, Data: []byte("data")}}}).Encode(&buf))
+	_, err = Decode(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	f := filepath.Join(t.TempDir(), "rec"+FileExt)
+	require.NoError(t, os.WriteFile(f, buf.Bytes(), 0o644))
+	rec, err := Load(f)
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), rec.Read())
+}
@@ -11,9 +11,12 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	testutil "github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	pstore "github.com/libp2p/go-libp2p/p2p/host/peerstore"
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 
+	"github.com/benbjohnson/clock"
 	"github.com/libp2p/go-libp2p-testing/ci"
 
 	ma "github.com/multiformats/go-multiaddr"
@@ -465,6 +468,46 @@ func TestDialBackoffClears(t *testing.T) {
 	require.False(t, s1.Backoff().Backoff(s2.LocalPeer(), s2bad), "s2 should no longer be on backoff")
 }
 
+func TestDialBackoffExpiresWithClock(t *testing.T) {
+	cl := clock.NewMock()
+	s := swarmt.GenSwarm(t, swarmt.WithClock(cl), swarmt.OptDialOnly)
+	defer s.Close()
+	p := peer.ID("peer")
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+
+	s.Backoff().AddBackoff(p, addr)
+	require.True(t, s.Backoff().Backoff(p, addr))
+	cl.Add(swarm.BackoffBase - time.Second)
+	require.True(t, s.Backoff().Backoff(p, addr))
+	cl.Add(2 * time.Second)
+	require.False(t, s.Backoff().Backoff(p, addr))
+
+	// the second backoff is longer
+	s.Backoff().AddBackoff(p, addr)
+	cl.Add(swarm.BackoffBase + swarm.BackoffCoef/2)
+	require.True(t, s.Backoff().Backoff(p, addr))
+	cl.Add(swarm.BackoffCoef)
+	require.False(t, s.Backoff().Backoff(p, addr))
+}
+
+func TestDialWithMockClock(t *testing.T) {
+	cl := clock.NewMock()
+	s1 := swarmt.GenSwarm(t, swarmt.WithClock(cl), swarmt.OptDisableQUIC)
+	defer s1.Close()
+	s2 := swarmt.GenSwarm(t, swarmt.WithClock(cl), swarmt.OptDisableQUIC)
+	defer s2.Close()
+
+	// the dial timeout follows the mock clock, not the wall clock
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), s2.ListenAddresses(), peerstore.PermanentAddrTTL)
+	_, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+}
+
+func TestNilClock(t *testing.T) {
+	_, err := swarm.NewSwarm("local", nil, eventbus.NewBus(), swarm.WithClock(nil))
+	require.Error(t, err)
+}
+
 func TestDialPeerFailed(t *testing.T) {
 	swarms := makeSwarms(t, 2, swarmt.WithSwarmOpts(swarm.WithDialTimeout(100*time.Millisecond)))
 	defer closeSwarms(swarms)
@@ -497,6 +540,48 @@ func TestDialPeerFailed(t *testing.T) {
 	}
 }
 
+func TestDialPeerQuality(t *testing.T) {
+	swarms := makeSwarms(t, 3, swarmt.WithSwarmOpts(swarm.WithDialTimeout(100*time.Millisecond)))
+	defer closeSwarms(swarms)
+	testedSwarm, targetSwarm, silentSwarm := swarms[0], swarms[1], swarms[2]
+
+	_, ok := testedSwarm.PeerQuality(targetSwarm.LocalPeer())
+	require.False(t, ok)
+	testedSwarm.Peerstore().AddAddrs(targetSwarm.LocalPeer(), targetSwarm.ListenAddresses(), peerstore.PermanentAddrTTL)
+	_, err := testedSwarm.DialPeer(context.Background(), targetSwarm.LocalPeer())
+	require.NoError(t, err)
+	q, ok := testedSwarm.PeerQuality(targetSwarm.LocalPeer())
+	require.True(t, ok)
+	require.Equal(t, 1, q.DialSuccesses)
+	require.Equal(t, 1.0, q.DialSuccessRate)
+	require.Zero(t, q.RecentErrors)
+	require.NotZero(t, q.DialLatency)
+
+	// the dials are recorded in the peerstore metrics
+	dm, ok := testedSwarm.Peerstore().(pstore.DialMetrics)
+	require.True(t, ok)
+	require.Equal(t, q.DialLatency, dm.DialLatencyEWMA(targetSwarm.LocalPeer()))
+	rate, ok := dm.DialSuccessRate(targetSwarm.LocalPeer())
+	require.True(t, ok)
+	require.Equal(t, 1.0, rate)
+
+	_, silentPeerAddress, silentPeerListener := newSilentPeer(t)
+	go acceptAndHang(silentPeerListener)
+	defer silentPeerListener.Close()
+	testedSwarm.Peerstore().AddAddr(silentSwarm.LocalPeer(), silentPeerAddress, peerstore.PermanentAddrTTL)
+	_, err = testedSwarm.DialPeer(context.Background(), silentSwarm.LocalPeer())
+	require.Error(t, err)
+	q, ok = testedSwarm.PeerQuality(silentSwarm.LocalPeer())
+	require.True(t, ok)
+	require.Equal(t, 1, q.DialAttempts)
+	require.Zero(t, q.DialSuccesses)
+	require.Equal(t, 1, q.RecentErrors)
+	require.NotEmpty(t, q.LastError)
+	rate, ok = dm.DialSuccessRate(silentSwarm.LocalPeer())
+	require.True(t, ok)
+	require.Zero(t, rate)
+}
+
 func TestDialExistingConnection(t *testing.T) {
 	swarms := makeSwarms(t, 2)
 	defer closeSwarms(swarms)
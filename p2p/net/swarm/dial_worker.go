@@ -2,10 +2,13 @@ package swarm
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
 
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
@@ -103,6 +106,9 @@ loop:
 			// at this point, len(addrs) > 0 or else it would be error from addrsForDial
 			// ranke them to process in order
 			addrs = w.rankAddrs(addrs)
+			if w.s.metricsTracer != nil {
+				w.s.metricsTracer.ConsideredDialAddrs(addrs)
+			}
 
 			// create the pending request object
 			pr := &pendRequest{
@@ -219,6 +225,10 @@ loop:
 				ad.conn = conn
 				ad.requests = nil
 
+				if pab, ok := peerstore.GetProvenanceAddrBook(w.s.peers); ok {
+					pab.ConfirmAddr(w.peer, res.Addr)
+				}
+
 				continue loop
 			}
 
@@ -280,6 +290,9 @@ func (w *dialWorker) dispatchError(ad *addrDial, err error) {
 // NonWS > WS
 // Private > Public
 // UDP > TCP
+// Within these tiers, if the peerstore tracks the provenance of addresses:
+// Confirmed > Unconfirmed > Unconfirmed from third parties
+// And finally, addresses that failed recently are dialed last, see PeerQuality.
 func (w *dialWorker) rankAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	addrTier := func(a ma.Multiaddr) (tier int) {
 		if isRelayAddr(a) {
@@ -304,10 +317,48 @@ func (w *dialWorker) rankAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 		tiers[tier] = append(tiers[tier], a)
 	}
 
+	pab, hasProvenance := peerstore.GetProvenanceAddrBook(w.s.peers)
 	result := make([]ma.Multiaddr, 0, len(addrs))
 	for _, tier := range tiers {
+		if hasProvenance && len(tier) > 1 {
+			sortByProvenance(pab, w.peer, tier)
+		}
+		if len(tier) > 1 {
+			w.s.quality.sortByRecentFailures(w.peer, tier)
+		}
 		result = append(result, tier...)
 	}
 
 	return result
 }
+
+// sortByProvenance sorts the addresses of p by provenance: confirmed addresses first,
+// most recently confirmed first, then the unconfirmed addresses and finally the
+// unconfirmed addresses learned from third parties.
+func sortByProvenance(pab peerstore.ProvenanceAddrBook, p peer.ID, addrs []ma.Multiaddr) {
+	type ranked struct {
+		rank      int
+		confirmed time.Time
+	}
+	ranks := make(map[ma.Multiaddr]ranked, len(addrs))
+	for _, a := range addrs {
+		prov, ok := pab.AddrProvenance(p, a)
+		switch {
+		case !ok:
+			ranks[a] = ranked{rank: 1}
+		case !prov.LastConfirmed.IsZero():
+			ranks[a] = ranked{rank: 0, confirmed: prov.LastConfirmed}
+		case prov.Source.IsThirdParty():
+			ranks[a] = ranked{rank: 2}
+		default:
+			ranks[a] = ranked{rank: 1}
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		ri, rj := ranks[addrs[i]], ranks[addrs[j]]
+		if ri.rank != rj.rank {
+			return ri.rank < rj.rank
+		}
+		return ri.confirmed.After(rj.confirmed)
+	})
+}
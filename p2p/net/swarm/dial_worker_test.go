@@ -408,3 +408,44 @@ func TestDialWorkerLoopAddrDedup(t *testing.T) {
 		t.Errorf("expected a fail response")
 	}
 }
+
+func TestDialWorkerLoopConfirmsAddr(t *testing.T) {
+	s1 := makeSwarm(t)
+	s2 := makeSwarm(t)
+	defer s1.Close()
+	defer s2.Close()
+
+	addr := s2.ListenAddresses()[0]
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), []ma.Multiaddr{addr}, peerstore.PermanentAddrTTL)
+	pab, ok := peerstore.GetProvenanceAddrBook(s1.Peerstore())
+	require.True(t, ok)
+	prov, ok := pab.AddrProvenance(s2.LocalPeer(), addr)
+	require.True(t, ok)
+	require.True(t, prov.LastConfirmed.IsZero())
+
+	_, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	prov, ok = pab.AddrProvenance(s2.LocalPeer(), addr)
+	require.True(t, ok)
+	require.False(t, prov.LastConfirmed.IsZero())
+}
+
+func TestRankAddrsByProvenance(t *testing.T) {
+	s := makeSwarm(t)
+	defer s.Close()
+	_, p := newPeer(t)
+
+	dht := ma.StringCast("/ip4/1.2.3.4/udp/1/quic")
+	unknown := ma.StringCast("/ip4/1.2.3.4/udp/2/quic")
+	confirmed := ma.StringCast("/ip4/1.2.3.4/udp/3/quic")
+	tcpAddr := ma.StringCast("/ip4/1.2.3.4/tcp/4")
+	pab, ok := peerstore.GetProvenanceAddrBook(s.Peerstore())
+	require.True(t, ok)
+	pab.AddAddrsWithSource(p, []ma.Multiaddr{dht, tcpAddr}, time.Hour, peerstore.AddrSourceDHT)
+	s.Peerstore().AddAddrs(p, []ma.Multiaddr{unknown, confirmed}, time.Hour)
+	pab.ConfirmAddr(p, confirmed)
+
+	w := newDialWorker(s, p, nil)
+	// provenance only matters within a tier: TCP addresses are still dialed last
+	require.Equal(t, []ma.Multiaddr{confirmed, unknown, dht, tcpAddr}, w.rankAddrs([]ma.Multiaddr{dht, tcpAddr, unknown, confirmed}))
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/transport"
 
+	"github.com/benbjohnson/clock"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -39,6 +40,7 @@ type dialLimiter struct {
 	waitingOnFd []*dialJob
 
 	dialFunc dialfunc
+	clock    clock.Clock
 
 	activePerPeer      map[peer.ID]int
 	perPeerLimit       int
@@ -47,23 +49,24 @@ type dialLimiter struct {
 
 type dialfunc func(context.Context, peer.ID, ma.Multiaddr) (transport.CapableConn, error)
 
-func newDialLimiter(df dialfunc) *dialLimiter {
+func newDialLimiter(df dialfunc, cl clock.Clock) *dialLimiter {
 	fd := ConcurrentFdDials
 	if env := os.Getenv("LIBP2P_SWARM_FD_LIMIT"); env != "" {
 		if n, err := strconv.ParseInt(env, 10, 32); err == nil {
 			fd = int(n)
 		}
 	}
-	return newDialLimiterWithParams(df, fd, DefaultPerPeerRateLimit)
+	return newDialLimiterWithParams(df, cl, fd, DefaultPerPeerRateLimit)
 }
 
-func newDialLimiterWithParams(df dialfunc, fdLimit, perPeerLimit int) *dialLimiter {
+func newDialLimiterWithParams(df dialfunc, cl clock.Clock, fdLimit, perPeerLimit int) *dialLimiter {
 	return &dialLimiter{
 		fdLimit:            fdLimit,
 		perPeerLimit:       perPeerLimit,
 		waitingOnPeerLimit: make(map[peer.ID][]*dialJob),
 		activePerPeer:      make(map[peer.ID]int),
 		dialFunc:           df,
+		clock:              cl,
 	}
 }
 
@@ -204,6 +207,27 @@ func (dl *dialLimiter) clearAllPeerDials(p peer.ID) {
 	// point
 }
 
+// withClockTimeout is like cl.WithTimeout. If cl is a mock clock, the returned
+// context keeps the deadline of ctx though: transports pass the deadline on to the
+// net.Conns they dial, and the deadline of a mock clock isn't a wall clock time.
+func withClockTimeout(cl clock.Clock, ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	tctx, cancel := cl.WithTimeout(ctx, timeout)
+	if _, ok := cl.(*clock.Mock); ok {
+		return parentDeadlineCtx{Context: tctx, parent: ctx}, cancel
+	}
+	return tctx, cancel
+}
+
+// parentDeadlineCtx is a context reporting the deadline of its parent.
+type parentDeadlineCtx struct {
+	context.Context
+	parent context.Context
+}
+
+func (c parentDeadlineCtx) Deadline() (time.Time, bool) {
+	return c.parent.Deadline()
+}
+
 // executeDial calls the dialFunc, and reports the result through the response
 // channel when finished. Once the response is sent it also releases all tokens
 // it held during the dial.
@@ -213,7 +237,7 @@ func (dl *dialLimiter) executeDial(j *dialJob) {
 		return
 	}
 
-	dctx, cancel := context.WithTimeout(j.ctx, j.timeout)
+	dctx, cancel := withClockTimeout(dl.clock, j.ctx, j.timeout)
 	defer cancel()
 
 	con, err := dl.dialFunc(dctx, j.peer, j.addr)
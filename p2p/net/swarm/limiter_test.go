@@ -14,6 +14,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/test"
 	"github.com/libp2p/go-libp2p/core/transport"
 
+	"github.com/benbjohnson/clock"
 	ma "github.com/multiformats/go-multiaddr"
 	mafmt "github.com/multiformats/go-multiaddr-fmt"
 )
@@ -74,7 +75,7 @@ func TestLimiterBasicDials(t *testing.T) {
 	hang := make(chan struct{})
 	defer close(hang)
 
-	l := newDialLimiterWithParams(hangDialFunc(hang), ConcurrentFdDials, 4)
+	l := newDialLimiterWithParams(hangDialFunc(hang), clock.New(), ConcurrentFdDials, 4)
 
 	bads := []ma.Multiaddr{addrWithPort(1), addrWithPort(2), addrWithPort(3), addrWithPort(4)}
 	good := addrWithPort(20)
@@ -123,7 +124,7 @@ func TestLimiterBasicDials(t *testing.T) {
 func TestFDLimiting(t *testing.T) {
 	hang := make(chan struct{})
 	defer close(hang)
-	l := newDialLimiterWithParams(hangDialFunc(hang), 16, 5)
+	l := newDialLimiterWithParams(hangDialFunc(hang), clock.New(), 16, 5)
 
 	bads := []ma.Multiaddr{addrWithPort(1), addrWithPort(2), addrWithPort(3), addrWithPort(4)}
 	pids := []peer.ID{"testpeer1", "testpeer2", "testpeer3", "testpeer4"}
@@ -199,7 +200,7 @@ func TestTokenRedistribution(t *testing.T) {
 		<-ch
 		return nil, fmt.Errorf("test bad dial")
 	}
-	l := newDialLimiterWithParams(df, 8, 4)
+	l := newDialLimiterWithParams(df, clock.New(), 8, 4)
 
 	bads := []ma.Multiaddr{addrWithPort(1), addrWithPort(2), addrWithPort(3), addrWithPort(4)}
 	pids := []peer.ID{"testpeer1", "testpeer2"}
@@ -290,7 +291,7 @@ func TestStressLimiter(t *testing.T) {
 		return nil, fmt.Errorf("test bad dial")
 	}
 
-	l := newDialLimiterWithParams(df, 20, 5)
+	l := newDialLimiterWithParams(df, clock.New(), 20, 5)
 
 	var bads []ma.Multiaddr
 	for i := 0; i < 100; i++ {
@@ -344,7 +345,7 @@ func TestFDLimitUnderflow(t *testing.T) {
 	}
 
 	const fdLimit = 20
-	l := newDialLimiterWithParams(df, fdLimit, 3)
+	l := newDialLimiterWithParams(df, clock.New(), fdLimit, 3)
 
 	var addrs []ma.Multiaddr
 	for i := 0; i <= 1000; i++ {
@@ -395,3 +396,34 @@ func TestFDLimitUnderflow(t *testing.T) {
 		t.Fatalf("l.fdConsuming < 0")
 	}
 }
+
+func TestLimiterDialTimeoutWithClock(t *testing.T) {
+	cl := clock.NewMock()
+	started := make(chan struct{})
+	df := func(ctx context.Context, p peer.ID, a ma.Multiaddr) (transport.CapableConn, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	l := newDialLimiterWithParams(df, cl, ConcurrentFdDials, 4)
+
+	resch := make(chan dialResult)
+	l.AddDialJob(&dialJob{
+		ctx:     context.Background(),
+		peer:    peer.ID("testpeer"),
+		addr:    addrWithPort(1),
+		resp:    resch,
+		timeout: time.Minute,
+	})
+
+	<-started
+	cl.Add(time.Minute)
+	select {
+	case r := <-resch:
+		if !errors.Is(r.Err, context.DeadlineExceeded) {
+			t.Fatalf("expected the dial to time out, got %v", r.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("dial didn't time out when the clock advanced")
+	}
+}
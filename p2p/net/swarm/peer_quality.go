@@ -0,0 +1,189 @@
+package swarm
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/benbjohnson/clock"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// qualityErrorWindow is the window of the recent dial errors of a peer. An
+	// address that failed within the window, and hasn't succeeded since, is ranked
+	// after the other addresses of its tier.
+	qualityErrorWindow = 10 * time.Minute
+	// maxRecentErrors bounds the number of recent errors tracked per peer.
+	maxRecentErrors = 32
+	// qualityTTL is how long the quality of a peer is kept after its last dial.
+	qualityTTL = time.Hour
+	// dialSuccessAlpha is the weight of the last dial in the dial success rate.
+	dialSuccessAlpha = 0.25
+)
+
+// PeerQuality summarizes the quality of the connectivity to a peer: its latency and
+// how reliably it could be dialed.
+type PeerQuality struct {
+	// RTT is the moving average of the round trip time to the peer, as recorded in
+	// the peerstore metrics, e.g. by identify and ping. It is 0 if it isn't known.
+	RTT time.Duration
+	// DialLatency is the moving average of the duration of the successful dials of
+	// the peer, as recorded in the peerstore metrics. It is 0 if it isn't known, or if
+	// the peerstore doesn't implement peerstore.DialMetrics.
+	DialLatency time.Duration
+	// DialAttempts is the number of dials of addresses of the peer, excluding the
+	// dials that were canceled, e.g. because another address succeeded first.
+	DialAttempts int
+	// DialSuccesses is the number of dials that succeeded.
+	DialSuccesses int
+	// DialSuccessRate is a moving average of the outcome of the dials, between 0
+	// (all failed) and 1 (all succeeded).
+	DialSuccessRate float64
+	// RecentErrors is the number of dials that failed during the last 10 minutes, up
+	// to 32.
+	RecentErrors int
+	// LastError is the error of the last failed dial.
+	LastError string
+	// LastDial is when the last dial finished.
+	LastDial time.Time
+}
+
+// PeerQuality returns the quality of the connectivity to p. It returns false if
+// neither the swarm nor the peerstore know anything about p yet.
+func (s *Swarm) PeerQuality(p peer.ID) (PeerQuality, bool) {
+	q, ok := s.quality.get(p)
+	q.RTT = s.peers.LatencyEWMA(p)
+	if s.dialMetrics != nil {
+		q.DialLatency = s.dialMetrics.DialLatencyEWMA(p)
+	}
+	return q, ok || q.RTT > 0
+}
+
+// recordDial records the outcome of a dial of addr that took d, both for the dial
+// ranking and in the peerstore metrics. err is nil if the dial succeeded.
+func (s *Swarm) recordDial(p peer.ID, addr ma.Multiaddr, d time.Duration, err error) {
+	s.quality.record(p, addr, err)
+	if s.dialMetrics != nil {
+		s.dialMetrics.RecordDial(p, d, err == nil)
+	}
+}
+
+// peerQuality tracks the outcome of the dials of the peers.
+type peerQuality struct {
+	mx    sync.Mutex
+	peers map[peer.ID]*peerQualityRecord
+	// nextEviction is the earliest time the records of the peers that weren't dialed
+	// for qualityTTL can be evicted
+	nextEviction time.Time
+
+	clock clock.Clock
+}
+
+type peerQualityRecord struct {
+	PeerQuality
+	recentErrors []time.Time
+	addrs        map[string]*addrQuality
+}
+
+type addrQuality struct {
+	lastSuccess, lastFailure time.Time
+}
+
+func newPeerQuality(cl clock.Clock) *peerQuality {
+	return &peerQuality{peers: make(map[peer.ID]*peerQualityRecord), clock: cl}
+}
+
+// record records the outcome of a dial of addr. err is nil if the dial succeeded.
+func (pq *peerQuality) record(p peer.ID, addr ma.Multiaddr, err error) {
+	now := pq.clock.Now()
+	pq.mx.Lock()
+	defer pq.mx.Unlock()
+
+	pq.evict(now)
+	r, ok := pq.peers[p]
+	if !ok {
+		r = &peerQualityRecord{addrs: make(map[string]*addrQuality)}
+		pq.peers[p] = r
+	}
+	aq, ok := r.addrs[string(addr.Bytes())]
+	if !ok {
+		aq = &addrQuality{}
+		r.addrs[string(addr.Bytes())] = aq
+	}
+
+	outcome := 0.0
+	if err == nil {
+		outcome = 1
+		r.DialSuccesses++
+		aq.lastSuccess = now
+	} else {
+		r.LastError = err.Error()
+		aq.lastFailure = now
+		if len(r.recentErrors) == maxRecentErrors {
+			r.recentErrors = r.recentErrors[1:]
+		}
+		r.recentErrors = append(r.recentErrors, now)
+	}
+	if r.DialAttempts == 0 {
+		r.DialSuccessRate = outcome
+	} else {
+		r.DialSuccessRate = dialSuccessAlpha*outcome + (1-dialSuccessAlpha)*r.DialSuccessRate
+	}
+	r.DialAttempts++
+	r.LastDial = now
+}
+
+// evict removes the records of the peers that weren't dialed for qualityTTL. It scans
+// the peers at most once per minute.
+func (pq *peerQuality) evict(now time.Time) {
+	if now.Before(pq.nextEviction) {
+		return
+	}
+	pq.nextEviction = now.Add(time.Minute)
+	for p, r := range pq.peers {
+		if now.Sub(r.LastDial) > qualityTTL {
+			delete(pq.peers, p)
+		}
+	}
+}
+
+func (pq *peerQuality) get(p peer.ID) (PeerQuality, bool) {
+	pq.mx.Lock()
+	defer pq.mx.Unlock()
+
+	r, ok := pq.peers[p]
+	if !ok {
+		return PeerQuality{}, false
+	}
+	q := r.PeerQuality
+	cutoff := pq.clock.Now().Add(-qualityErrorWindow)
+	for _, t := range r.recentErrors {
+		if t.After(cutoff) {
+			q.RecentErrors++
+		}
+	}
+	return q, true
+}
+
+// sortByRecentFailures moves the addresses of p that failed during the error window,
+// and haven't succeeded since, after the other addresses, keeping the order otherwise.
+func (pq *peerQuality) sortByRecentFailures(p peer.ID, addrs []ma.Multiaddr) {
+	pq.mx.Lock()
+	defer pq.mx.Unlock()
+
+	r, ok := pq.peers[p]
+	if !ok {
+		return
+	}
+	cutoff := pq.clock.Now().Add(-qualityErrorWindow)
+	failed := make(map[ma.Multiaddr]bool, len(addrs))
+	for _, a := range addrs {
+		if aq, ok := r.addrs[string(a.Bytes())]; ok {
+			failed[a] = aq.lastFailure.After(cutoff) && aq.lastFailure.After(aq.lastSuccess)
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool { return !failed[addrs[i]] && failed[addrs[j]] })
+}
@@ -0,0 +1,56 @@
+package swarm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/benbjohnson/clock"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerQuality(t *testing.T) {
+	cl := clock.NewMock()
+	pq := newPeerQuality(cl)
+	p := peer.ID("peer")
+	a1 := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	a2 := ma.StringCast("/ip4/1.2.3.4/tcp/2")
+	a3 := ma.StringCast("/ip4/1.2.3.4/tcp/3")
+
+	_, ok := pq.get(p)
+	require.False(t, ok)
+
+	pq.record(p, a1, errors.New("connection refused"))
+	pq.record(p, a2, nil)
+	q, ok := pq.get(p)
+	require.True(t, ok)
+	require.Equal(t, 2, q.DialAttempts)
+	require.Equal(t, 1, q.DialSuccesses)
+	require.Equal(t, 1, q.RecentErrors)
+	require.Equal(t, "connection refused", q.LastError)
+	require.InDelta(t, dialSuccessAlpha, q.DialSuccessRate, 1e-9)
+
+	// the address that failed is dialed last
+	addrs := []ma.Multiaddr{a1, a2, a3}
+	pq.sortByRecentFailures(p, addrs)
+	require.Equal(t, []ma.Multiaddr{a2, a3, a1}, addrs)
+
+	// until it succeeds again
+	pq.record(p, a1, nil)
+	addrs = []ma.Multiaddr{a1, a2, a3}
+	pq.sortByRecentFailures(p, addrs)
+	require.Equal(t, []ma.Multiaddr{a1, a2, a3}, addrs)
+
+	// old errors are not recent anymore
+	cl.Add(2 * qualityErrorWindow)
+	q, _ = pq.get(p)
+	require.Zero(t, q.RecentErrors)
+
+	// peers that weren't dialed for a while are forgotten
+	cl.Add(2 * qualityTTL)
+	pq.record(peer.ID("other"), a1, nil)
+	_, ok = pq.get(p)
+	require.False(t, ok)
+}
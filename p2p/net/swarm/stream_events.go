@@ -0,0 +1,172 @@
+package swarm
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// WithStreamEvents makes the swarm emit an event.EvtStreamOpened and an
+// event.EvtStreamClosed for a sample of the streams, which allows applications to
+// observe the streams of every protocol without wrapping their handlers. The sample
+// rate is the fraction of streams events are emitted for, between 0 (none) and 1
+// (all).
+//
+// The events are emitted in order from a background goroutine, so that slow
+// subscribers never block the streams. They are delayed, and queued in memory,
+// until the subscribers catch up. At most maxPendingStreamEvents are queued, newer
+// events are dropped, and the number of dropped events is logged.
+func WithStreamEvents(sampleRate float64) Option {
+	return func(s *Swarm) error {
+		if sampleRate < 0 || sampleRate > 1 {
+			return errors.New("stream event sample rate must be between 0 and 1")
+		}
+		s.streamEventsSampleRate = sampleRate
+		return nil
+	}
+}
+
+// maxPendingStreamEvents is the maximum number of stream events queued for slow
+// subscribers.
+const maxPendingStreamEvents = 1024
+
+// streamEvents holds the emitters used to report the lifecycle of streams. Events
+// are queued by push and emitted by the background goroutine.
+type streamEvents struct {
+	sampleRate     float64
+	opened, closed event.Emitter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wake is signaled when events are pushed
+	wake chan struct{}
+
+	mx      sync.Mutex
+	pending []interface{}
+	// dropped counts the events dropped because the queue was full
+	dropped atomic.Uint64
+}
+
+func newStreamEvents(bus event.Bus, sampleRate float64) (*streamEvents, error) {
+	opened, err := bus.Emitter(new(event.EvtStreamOpened))
+	if err != nil {
+		return nil, err
+	}
+	closed, err := bus.Emitter(new(event.EvtStreamClosed))
+	if err != nil {
+		opened.Close()
+		return nil, err
+	}
+	ev := &streamEvents{
+		sampleRate: sampleRate,
+		opened:     opened,
+		closed:     closed,
+		wake:       make(chan struct{}, 1),
+	}
+	ev.ctx, ev.cancel = context.WithCancel(context.Background())
+	go ev.background()
+	return ev, nil
+}
+
+func (ev *streamEvents) push(evt interface{}) {
+	ev.mx.Lock()
+	if len(ev.pending) >= maxPendingStreamEvents {
+		ev.mx.Unlock()
+		ev.dropped.Add(1)
+		return
+	}
+	ev.pending = append(ev.pending, evt)
+	ev.mx.Unlock()
+	select {
+	case ev.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ev *streamEvents) background() {
+	defer ev.closed.Close()
+	defer ev.opened.Close()
+
+	var pend []interface{}
+	var dropped uint64
+	for {
+		select {
+		case <-ev.wake:
+		case <-ev.ctx.Done():
+			return
+		}
+		ev.mx.Lock()
+		pend, ev.pending = ev.pending, pend[:0]
+		ev.mx.Unlock()
+		if d := ev.dropped.Load(); d != dropped {
+			log.Warnf("dropped %d stream events, subscribers are too slow", d-dropped)
+			dropped = d
+		}
+		for _, evt := range pend {
+			if ev.ctx.Err() != nil {
+				return
+			}
+			var err error
+			switch evt := evt.(type) {
+			case event.EvtStreamOpened:
+				err = ev.opened.Emit(evt)
+			case event.EvtStreamClosed:
+				err = ev.closed.Emit(evt)
+			}
+			if err != nil {
+				log.Warnf("error emitting stream event: %s", err)
+			}
+		}
+	}
+}
+
+// sample returns true if events should be emitted for a new stream.
+func (ev *streamEvents) sample() bool {
+	if ev == nil {
+		return false
+	}
+	return ev.sampleRate >= 1 || rand.Float64() < ev.sampleRate
+}
+
+// close stops emitting events, dropping the events still queued. It doesn't wait
+// for the background goroutine, which may be blocked on a slow subscriber: the
+// emitters are closed once the event being emitted is delivered.
+func (ev *streamEvents) close() {
+	if ev != nil {
+		ev.cancel()
+	}
+}
+
+// emitOpened reports that s started speaking p, if s is part of the sample. It is
+// only reported the first time the protocol of s is set.
+func (s *Stream) emitOpened(p protocol.ID) {
+	if !s.sampled || !s.openedEmitted.CompareAndSwap(false, true) {
+		return
+	}
+	s.conn.swarm.streamEvents.push(event.EvtStreamOpened{
+		Peer:      s.conn.RemotePeer(),
+		Protocol:  p,
+		Direction: s.stat.Direction,
+	})
+}
+
+// emitClosed reports that s was closed or reset, if s is part of the sample.
+func (s *Stream) emitClosed(reset bool) {
+	if !s.sampled {
+		return
+	}
+	s.conn.swarm.streamEvents.push(event.EvtStreamClosed{
+		Peer:         s.conn.RemotePeer(),
+		Protocol:     s.Protocol(),
+		Direction:    s.stat.Direction,
+		Reset:        reset,
+		Duration:     s.conn.swarm.clock.Since(s.stat.Opened),
+		BytesRead:    s.bytesRead.Load(),
+		BytesWritten: s.bytesWritten.Load(),
+	})
+}
@@ -0,0 +1,19 @@
+package swarm
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/event"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamEventsQueueLimit(t *testing.T) {
+	// without the background goroutine, nothing takes the events out of the queue
+	ev := &streamEvents{wake: make(chan struct{}, 1)}
+	for i := 0; i < maxPendingStreamEvents+10; i++ {
+		ev.push(event.EvtStreamClosed{})
+	}
+	require.Len(t, ev.pending, maxPendingStreamEvents)
+	require.Equal(t, uint64(10), ev.dropped.Load())
+}
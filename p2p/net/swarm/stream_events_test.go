@@ -0,0 +1,116 @@
+package swarm_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	. "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamEvents(t *testing.T) {
+	bus := eventbus.NewBus()
+	sub, err := bus.Subscribe([]interface{}{new(event.EvtStreamOpened), new(event.EvtStreamClosed)})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	s1 := GenSwarm(t, EventBus(bus), WithSwarmOpts(swarm.WithStreamEvents(1)))
+	s2 := GenSwarm(t)
+	defer s1.Close()
+	defer s2.Close()
+	connectSwarms(t, context.Background(), []*swarm.Swarm{s1, s2})
+
+	s2.SetStreamHandler(func(str network.Stream) {
+		io.Copy(str, str)
+		str.Close()
+	})
+
+	str, err := s1.NewStream(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	require.NoError(t, str.SetProtocol("/echo"))
+	// setting the protocol again doesn't emit another event
+	require.NoError(t, str.SetProtocol("/echo"))
+	_, err = str.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, str.CloseWrite())
+	b, err := io.ReadAll(str)
+	require.NoError(t, err)
+	require.Equal(t, "foobar", string(b))
+	require.NoError(t, str.Close())
+
+	str, err = s1.NewStream(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	require.NoError(t, str.Reset())
+
+	next := func() interface{} {
+		select {
+		case evt := <-sub.Out():
+			return evt
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+			return nil
+		}
+	}
+	require.Equal(t, event.EvtStreamOpened{Peer: s2.LocalPeer(), Protocol: "/echo", Direction: network.DirOutbound}, next())
+	closed := next().(event.EvtStreamClosed)
+	require.Equal(t, event.EvtStreamClosed{
+		Peer:         s2.LocalPeer(),
+		Protocol:     "/echo",
+		Direction:    network.DirOutbound,
+		Duration:     closed.Duration,
+		BytesRead:    6,
+		BytesWritten: 6,
+	}, closed)
+	require.NotZero(t, closed.Duration)
+
+	// the stream was reset before negotiating a protocol
+	closed = next().(event.EvtStreamClosed)
+	require.True(t, closed.Reset)
+	require.Empty(t, closed.Protocol)
+}
+
+func TestStreamEventsSlowSubscriber(t *testing.T) {
+	bus := eventbus.NewBus()
+	// the subscriber never reads its events
+	sub, err := bus.Subscribe(new(event.EvtStreamClosed), eventbus.BufSize(1))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	s1 := GenSwarm(t, EventBus(bus), WithSwarmOpts(swarm.WithStreamEvents(1)))
+	s2 := GenSwarm(t)
+	defer s1.Close()
+	defer s2.Close()
+	connectSwarms(t, context.Background(), []*swarm.Swarm{s1, s2})
+	s2.SetStreamHandler(func(str network.Stream) { str.Close() })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			str, err := s1.NewStream(context.Background(), s2.LocalPeer())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			str.SetProtocol("/test")
+			str.Close()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing streams blocked on the subscriber")
+	}
+}
+
+func TestStreamEventsSampleRate(t *testing.T) {
+	require.Error(t, swarm.WithStreamEvents(1.5)(&swarm.Swarm{}))
+	require.Error(t, swarm.WithStreamEvents(-1)(&swarm.Swarm{}))
+}
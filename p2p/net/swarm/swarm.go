@@ -17,7 +17,10 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/transport"
+	pstore "github.com/libp2p/go-libp2p/p2p/host/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/net/nat64"
 
+	"github.com/benbjohnson/clock"
 	logging "github.com/ipfs/go-log/v2"
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
@@ -56,6 +59,19 @@ func WithConnectionGater(gater connmgr.ConnectionGater) Option {
 	}
 }
 
+// WithClock sets the clock of the timers of the swarm: dial timeouts, dial backoffs, dial quality
+// records, cached interface addresses and the times of connection and stream stats.
+// With a mock clock, tests of the logic built on them don't need to sleep.
+func WithClock(cl clock.Clock) Option {
+	return func(s *Swarm) error {
+		if cl == nil {
+			return errors.New("clock must not be nil")
+		}
+		s.clock = cl
+		return nil
+	}
+}
+
 // WithMultiaddrResolver sets a custom multiaddress resolver
 func WithMultiaddrResolver(maResolver *madns.Resolver) Option {
 	return func(s *Swarm) error {
@@ -64,6 +80,16 @@ func WithMultiaddrResolver(maResolver *madns.Resolver) Option {
 	}
 }
 
+// WithNAT64 makes the swarm also dial the public IPv4 addresses of peers through
+// NAT64, by synthesizing IPv6 addresses for them, when the detector found that we are
+// in an IPv6-only network.
+func WithNAT64(d *nat64.Detector) Option {
+	return func(s *Swarm) error {
+		s.nat64 = d
+		return nil
+	}
+}
+
 // WithMetrics sets a metrics reporter
 func WithMetrics(reporter metrics.Reporter) Option {
 	return func(s *Swarm) error {
@@ -147,6 +173,7 @@ type Swarm struct {
 	}
 
 	maResolver *madns.Resolver
+	nat64      *nat64.Detector
 
 	// stream handlers
 	streamh atomic.Pointer[network.StreamHandler]
@@ -163,6 +190,22 @@ type Swarm struct {
 
 	bwc           metrics.Reporter
 	metricsTracer MetricsTracer
+
+	streamEventsSampleRate float64
+	// streamEvents is nil if stream events are disabled, see WithStreamEvents
+	streamEvents *streamEvents
+
+	traceOut io.Writer
+	// traceFile is opened as traceOut once the options were applied, see WithTraceFile
+	traceFile *TraceFile
+	// tracer is nil if tracing is disabled, see WithTrace
+	tracer *tracer
+
+	quality *peerQuality
+	// dialMetrics is nil if the peerstore doesn't record dials
+	dialMetrics pstore.DialMetrics
+
+	clock clock.Clock
 }
 
 // NewSwarm constructs a Swarm.
@@ -181,6 +224,7 @@ func NewSwarm(local peer.ID, peers peerstore.Peerstore, eventBus event.Bus, opts
 		dialTimeout:      defaultDialTimeout,
 		dialTimeoutLocal: defaultDialTimeoutLocal,
 		maResolver:       madns.DefaultResolver,
+		clock:            clock.New(),
 	}
 
 	s.conns.m = make(map[peer.ID][]*Conn)
@@ -196,10 +240,27 @@ func NewSwarm(local peer.ID, peers peerstore.Peerstore, eventBus event.Bus, opts
 	if s.rcmgr == nil {
 		s.rcmgr = &network.NullResourceManager{}
 	}
+	if s.streamEventsSampleRate > 0 {
+		s.streamEvents, err = newStreamEvents(eventBus, s.streamEventsSampleRate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.traceFile != nil {
+		s.traceOut, err = openRotatingFile(*s.traceFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.traceOut != nil {
+		s.tracer = newTracer(s.traceOut)
+	}
 
+	s.quality = newPeerQuality(s.clock)
+	s.dialMetrics, _ = s.peers.(pstore.DialMetrics)
 	s.dsync = newDialSync(s.dialWorkerLoop)
-	s.limiter = newDialLimiter(s.dialAddr)
-	s.backf.init(s.ctx)
+	s.limiter = newDialLimiter(s.dialAddr, s.clock)
+	s.backf.init(s.ctx, s.clock)
 	return s, nil
 }
 
@@ -247,6 +308,8 @@ func (s *Swarm) close() {
 
 	// Wait for everything to finish.
 	s.refs.Wait()
+	s.streamEvents.close()
+	s.tracer.close()
 
 	// Now close out any transports (if necessary). Do this after closing
 	// all connections/listeners.
@@ -288,7 +351,7 @@ func (s *Swarm) addConn(tc transport.CapableConn, dir network.Direction) (*Conn,
 		stat = cs.Stat()
 	}
 	stat.Direction = dir
-	stat.Opened = time.Now()
+	stat.Opened = s.clock.Now()
 
 	// Wrap and register the connection.
 	c := &Conn{
@@ -301,13 +364,14 @@ func (s *Swarm) addConn(tc transport.CapableConn, dir network.Direction) (*Conn,
 	// we ONLY check upgraded connections here so we can send them a Disconnect message.
 	// If we do this in the Upgrader, we will not be able to do this.
 	if s.gater != nil {
-		if allow, _ := s.gater.InterceptUpgraded(c); !allow {
+		if r, _ := connmgr.GateUpgraded(s.gater, c); r != nil {
+			s.tracer.connGated(tc, dir)
 			// TODO Send disconnect with reason here
 			err := tc.Close()
 			if err != nil {
 				log.Warnf("failed to close connection with peer %s and addr %s; err: %s", p.Pretty(), addr, err)
 			}
-			return nil, ErrGaterDisallowedConnection
+			return nil, &connmgr.GatedError{Reason: *r}
 		}
 	}
 
@@ -346,12 +410,19 @@ func (s *Swarm) addConn(tc transport.CapableConn, dir network.Direction) (*Conn,
 	// Disconnect notifications until after the Connect notifications done.
 	c.notifyLk.Lock()
 	s.conns.Unlock()
+	s.tracer.connOpened(c)
 
 	s.notifyAll(func(f network.Notifiee) {
 		f.Connected(s, c)
 	})
 	c.notifyLk.Unlock()
 
+	// Let the resource manager close the connection to make room for more
+	// important work when it runs out of resources.
+	if sc, ok := tc.Scope().(interface{ SetShedFunc(func()) }); ok {
+		sc.SetShedFunc(func() { c.Close() })
+	}
+
 	c.start()
 	return c, nil
 }
@@ -659,6 +730,12 @@ func (s *Swarm) ResourceManager() network.ResourceManager {
 	return s.rcmgr
 }
 
+// DialTimeout returns the timeout of the dials to non-local addresses, see
+// WithDialTimeout.
+func (s *Swarm) DialTimeout() time.Duration {
+	return s.dialTimeout
+}
+
 // Swarm is a Network.
 var _ network.Network = (*Swarm)(nil)
 var _ transport.TransportNetwork = (*Swarm)(nil)
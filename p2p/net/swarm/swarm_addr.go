@@ -32,7 +32,7 @@ func (s *Swarm) InterfaceListenAddresses() ([]ma.Multiaddr, error) {
 	s.listeners.RLock() // RLock start
 
 	ifaceListenAddres := s.listeners.ifaceListenAddres
-	isEOL := time.Now().After(s.listeners.cacheEOL)
+	isEOL := s.clock.Now().After(s.listeners.cacheEOL)
 	s.listeners.RUnlock() // RLock end
 
 	if !isEOL {
@@ -46,7 +46,7 @@ func (s *Swarm) InterfaceListenAddresses() ([]ma.Multiaddr, error) {
 	s.listeners.Lock() // Lock start
 
 	ifaceListenAddres = s.listeners.ifaceListenAddres
-	isEOL = time.Now().After(s.listeners.cacheEOL)
+	isEOL = s.clock.Now().After(s.listeners.cacheEOL)
 	if isEOL {
 		// Cache is still invalid
 		listenAddres := s.listenAddressesNoLock()
@@ -63,7 +63,7 @@ func (s *Swarm) InterfaceListenAddresses() ([]ma.Multiaddr, error) {
 		}
 
 		s.listeners.ifaceListenAddres = ifaceListenAddres
-		s.listeners.cacheEOL = time.Now().Add(ifaceAddrsCacheDuration)
+		s.listeners.cacheEOL = s.clock.Now().Add(ifaceAddrsCacheDuration)
 	}
 
 	s.listeners.Unlock() // Lock end
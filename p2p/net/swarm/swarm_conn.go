@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
-	"time"
 
 	ic "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/network"
@@ -59,12 +58,19 @@ func (c *Conn) ID() string {
 // open notifications must finish before we can fire off the close
 // notifications).
 func (c *Conn) Close() error {
-	c.closeOnce.Do(c.doClose)
+	return c.closeWithCause("local")
+}
+
+// closeWithCause closes the connection, recording cause as the reason it was closed
+// in the trace.
+func (c *Conn) closeWithCause(cause string) error {
+	c.closeOnce.Do(func() { c.doClose(cause) })
 	return c.err
 }
 
-func (c *Conn) doClose() {
+func (c *Conn) doClose(cause string) {
 	c.swarm.removeConn(c)
+	c.swarm.tracer.connClosed(c, cause)
 
 	// Prevent new streams from opening.
 	c.streams.Lock()
@@ -77,7 +83,7 @@ func (c *Conn) doClose() {
 	// This is just for cleaning up state. The connection has already been closed.
 	// We *could* optimize this but it really isn't worth it.
 	for s := range streams {
-		s.Reset()
+		s.reset("connection closed")
 	}
 
 	// do this in a goroutine to avoid deadlocking if we call close in an open notification.
@@ -108,11 +114,11 @@ func (c *Conn) removeStream(s *Stream) {
 func (c *Conn) start() {
 	go func() {
 		defer c.swarm.refs.Done()
-		defer c.Close()
 
 		for {
 			ts, err := c.conn.AcceptStream()
 			if err != nil {
+				c.closeWithCause(err.Error())
 				return
 			}
 			scope, err := c.swarm.ResourceManager().OpenStream(c.RemotePeer(), network.DirInbound)
@@ -235,10 +241,12 @@ func (c *Conn) addStream(ts network.MuxedStream, dir network.Direction, scope ne
 		scope:  scope,
 		stat: network.Stats{
 			Direction: dir,
-			Opened:    time.Now(),
+			Opened:    c.swarm.clock.Now(),
 		},
-		id: atomic.AddUint64(&c.swarm.nextStreamID, 1),
+		id:      atomic.AddUint64(&c.swarm.nextStreamID, 1),
+		sampled: c.swarm.streamEvents.sample(),
 	}
+	s.countBytes = s.sampled || c.swarm.metricsTracer != nil
 	c.stat.NumStreams++
 	c.streams.m[s] = struct{}{}
 
@@ -247,6 +255,11 @@ func (c *Conn) addStream(ts network.MuxedStream, dir network.Direction, scope ne
 	c.swarm.refs.Add(1)
 
 	c.streams.Unlock()
+	c.swarm.tracer.streamOpened(s)
+
+	if sc, ok := scope.(interface{ SetShedFunc(func()) }); ok {
+		sc.SetShedFunc(func() { s.Reset() })
+	}
 	return s, nil
 }
 
@@ -8,10 +8,13 @@ import (
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/canonicallog"
+	"github.com/libp2p/go-libp2p/core/connmgr"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/transport"
+
+	"github.com/benbjohnson/clock"
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
 	manet "github.com/multiformats/go-multiaddr/net"
@@ -57,8 +60,9 @@ var (
 	ErrNoGoodAddresses = errors.New("no good addresses")
 
 	// ErrGaterDisallowedConnection is returned when the gater prevents us from
-	// forming a connection with a peer.
-	ErrGaterDisallowedConnection = errors.New("gater disallows connection to peer")
+	// forming a connection with a peer. It's wrapped in a connmgr.GatedError
+	// telling why.
+	ErrGaterDisallowedConnection = connmgr.ErrGated
 )
 
 // DialAttempts governs how many times a goroutine will try to dial a given peer.
@@ -108,6 +112,8 @@ var DefaultPerPeerRateLimit = 8
 type DialBackoff struct {
 	entries map[peer.ID]map[string]*backoffAddr
 	lock    sync.RWMutex
+	// clock is nil for the zero value, which uses the real clock
+	clock clock.Clock
 }
 
 type backoffAddr struct {
@@ -115,15 +121,23 @@ type backoffAddr struct {
 	until time.Time
 }
 
-func (db *DialBackoff) init(ctx context.Context) {
+func (db *DialBackoff) init(ctx context.Context, cl clock.Clock) {
 	if db.entries == nil {
 		db.entries = make(map[peer.ID]map[string]*backoffAddr)
 	}
+	db.clock = cl
 	go db.background(ctx)
 }
 
+func (db *DialBackoff) now() time.Time {
+	if db.clock == nil {
+		return time.Now()
+	}
+	return db.clock.Now()
+}
+
 func (db *DialBackoff) background(ctx context.Context) {
-	ticker := time.NewTicker(BackoffMax)
+	ticker := db.clock.Ticker(BackoffMax)
 	defer ticker.Stop()
 	for {
 		select {
@@ -142,7 +156,7 @@ func (db *DialBackoff) Backoff(p peer.ID, addr ma.Multiaddr) (backoff bool) {
 	defer db.lock.Unlock()
 
 	ap, found := db.entries[p][string(addr.Bytes())]
-	return found && time.Now().Before(ap.until)
+	return found && db.now().Before(ap.until)
 }
 
 // BackoffBase is the base amount of time to backoff (default: 5s).
@@ -177,7 +191,7 @@ func (db *DialBackoff) AddBackoff(p peer.ID, addr ma.Multiaddr) {
 	if !ok {
 		bp[saddr] = &backoffAddr{
 			tries: 1,
-			until: time.Now().Add(BackoffBase),
+			until: db.now().Add(BackoffBase),
 		}
 		return
 	}
@@ -186,7 +200,7 @@ func (db *DialBackoff) AddBackoff(p peer.ID, addr ma.Multiaddr) {
 	if backoffTime > BackoffMax {
 		backoffTime = BackoffMax
 	}
-	ba.until = time.Now().Add(backoffTime)
+	ba.until = db.now().Add(backoffTime)
 	ba.tries++
 }
 
@@ -201,7 +215,7 @@ func (db *DialBackoff) Clear(p peer.ID) {
 func (db *DialBackoff) cleanup() {
 	db.lock.Lock()
 	defer db.lock.Unlock()
-	now := time.Now()
+	now := db.now()
 	for p, e := range db.entries {
 		good := false
 		for _, backoff := range e {
@@ -257,13 +271,15 @@ func (s *Swarm) dialPeer(ctx context.Context, p peer.ID) (*Conn, error) {
 		return conn, err
 	}
 
-	if s.gater != nil && !s.gater.InterceptPeerDial(p) {
-		log.Debugf("gater disallowed outbound connection to peer %s", p.Pretty())
-		return nil, &DialError{Peer: p, Cause: ErrGaterDisallowedConnection}
+	if s.gater != nil {
+		if r := connmgr.GatePeerDial(s.gater, p); r != nil {
+			log.Debugf("gater disallowed outbound connection to peer %s: %s", p.Pretty(), r)
+			return nil, &DialError{Peer: p, Cause: &connmgr.GatedError{Reason: *r}}
+		}
 	}
 
 	// apply the DialPeer timeout
-	ctx, cancel := context.WithTimeout(ctx, network.GetDialPeerTimeout(ctx))
+	ctx, cancel := withClockTimeout(s.clock, ctx, network.GetDialPeerTimeout(ctx))
 	defer cancel()
 
 	conn, err = s.dsync.Dial(ctx, p)
@@ -329,14 +345,25 @@ func (s *Swarm) addrsForDial(ctx context.Context, p peer.ID) ([]ma.Multiaddr, er
 	if err != nil {
 		return nil, err
 	}
+	if s.nat64 != nil {
+		resolved = append(resolved, s.nat64.SynthesizeAddrs(resolved)...)
+	}
 
-	goodAddrs := s.filterKnownUndialables(p, resolved)
+	goodAddrs, gated := s.filterKnownUndialables(p, resolved)
 	if forceDirect, _ := network.GetForceDirectDial(ctx); forceDirect {
 		goodAddrs = ma.FilterAddrs(goodAddrs, s.nonProxyAddr)
 	}
 
 	if len(goodAddrs) == 0 {
-		return nil, ErrNoGoodAddresses
+		if len(gated) == 0 {
+			return nil, ErrNoGoodAddresses
+		}
+		// tell why the gater disallowed the addresses
+		err := &DialError{Peer: p, Cause: ErrNoGoodAddresses}
+		for _, te := range gated {
+			err.recordErr(te.Address, te.Cause)
+		}
+		return nil, err
 	}
 
 	s.peers.AddAddrs(p, goodAddrs, peerstore.TempAddrTTL)
@@ -435,7 +462,8 @@ func (s *Swarm) nonProxyAddr(addr ma.Multiaddr) bool {
 // IPv6 link-local addresses, addresses without a dial-capable transport,
 // and addresses that we know to be our own.
 // This is an optimization to avoid wasting time on dials that we know are going to fail.
-func (s *Swarm) filterKnownUndialables(p peer.ID, addrs []ma.Multiaddr) []ma.Multiaddr {
+// It also returns the errors of the addresses the gater disallowed.
+func (s *Swarm) filterKnownUndialables(p peer.ID, addrs []ma.Multiaddr) ([]ma.Multiaddr, []TransportError) {
 	lisAddrs, _ := s.InterfaceListenAddresses()
 	var ourAddrs []ma.Multiaddr
 	for _, addr := range lisAddrs {
@@ -446,6 +474,7 @@ func (s *Swarm) filterKnownUndialables(p peer.ID, addrs []ma.Multiaddr) []ma.Mul
 		}
 	}
 
+	var gated []TransportError
 	return maybeRemoveWebTransportAddrs(
 		maybeRemoveQUICDraft29(
 			ma.FilterAddrs(addrs,
@@ -454,9 +483,16 @@ func (s *Swarm) filterKnownUndialables(p peer.ID, addrs []ma.Multiaddr) []ma.Mul
 				// TODO: Consider allowing link-local addresses
 				func(addr ma.Multiaddr) bool { return !manet.IsIP6LinkLocal(addr) },
 				func(addr ma.Multiaddr) bool {
-					return s.gater == nil || s.gater.InterceptAddrDial(p, addr)
+					if s.gater == nil {
+						return true
+					}
+					if r := connmgr.GateAddrDial(s.gater, p, addr); r != nil {
+						gated = append(gated, TransportError{Address: addr, Cause: &connmgr.GatedError{Reason: *r}})
+						return false
+					}
+					return true
 				},
-			)))
+			))), gated
 }
 
 // limitedDial will start a dial to the given peer when
@@ -494,12 +530,22 @@ func (s *Swarm) dialAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr) (tra
 		return nil, ErrNoTransport
 	}
 
+	s.tracer.dialStarted(p, addr)
+	if s.metricsTracer != nil {
+		s.metricsTracer.StartedDialing(addr)
+	}
 	start := time.Now()
 	connC, err := tpt.Dial(ctx, addr, p)
+	s.tracer.dialFinished(p, addr, time.Since(start), connC, err)
 	if err != nil {
 		if s.metricsTracer != nil {
 			s.metricsTracer.FailedDialing(addr, err)
 		}
+		// Don't hold dials we canceled, e.g. because another address succeeded, against
+		// the peer.
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			s.recordDial(p, addr, time.Since(start), err)
+		}
 		return nil, err
 	}
 	canonicallog.LogPeerStatus(100, connC.RemotePeer(), connC.RemoteMultiaddr(), "connection_status", "established", "dir", "outbound")
@@ -507,6 +553,7 @@ func (s *Swarm) dialAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr) (tra
 		connWithMetrics := wrapWithMetrics(connC, s.metricsTracer, start, network.DirOutbound)
 		connWithMetrics.completedHandshake()
 		connC = connWithMetrics
+		s.metricsTracer.SucceededDialing(addr)
 	}
 
 	// Trust the transport? Yeah... right.
@@ -518,6 +565,7 @@ func (s *Swarm) dialAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr) (tra
 	}
 
 	// success! we got one!
+	s.recordDial(p, addr, time.Since(start), nil)
 	return connC, nil
 }
 
@@ -14,6 +14,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/test"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
 	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+	"github.com/libp2p/go-libp2p/p2p/net/nat64"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 	"github.com/libp2p/go-libp2p/p2p/transport/websocket"
 
@@ -90,6 +91,34 @@ func newTestSwarmWithResolver(t *testing.T, resolver *madns.Resolver) *Swarm {
 	return s
 }
 
+func TestAddrsForDialNAT64(t *testing.T) {
+	s := newTestSwarmWithResolver(t, madns.DefaultResolver)
+	backend := &madns.MockResolver{IP: map[string][]net.IPAddr{"ipv4only.arpa": {{IP: net.ParseIP("64:ff9b::c000:aa")}}}}
+	d, err := nat64.NewDetector(
+		nat64.WithResolver(backend),
+		nat64.WithInterfaceAddrs(func() ([]net.Addr, error) {
+			return []net.Addr{&net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(64, 128)}}, nil
+		}),
+	)
+	require.NoError(t, err)
+	s.nat64 = d
+
+	p := test.RandPeerIDFatal(t)
+	s.peers.AddAddr(p, ma.StringCast("/ip4/1.2.3.4/tcp/1234"), time.Hour)
+	mas, err := s.addrsForDial(context.Background(), p)
+	require.NoError(t, err)
+	require.Equal(t, []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1234")}, mas)
+
+	_, err = d.Refresh(context.Background())
+	require.NoError(t, err)
+	mas, err = s.addrsForDial(context.Background(), p)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1234"),
+		ma.StringCast("/ip6/64:ff9b::102:304/tcp/1234"),
+	}, mas)
+}
+
 func TestAddrResolution(t *testing.T) {
 	ctx := context.Background()
 
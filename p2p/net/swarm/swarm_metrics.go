@@ -5,10 +5,14 @@ import (
 	"errors"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/transport"
 	"github.com/libp2p/go-libp2p/p2p/metricshelper"
 
 	ma "github.com/multiformats/go-multiaddr"
@@ -69,6 +73,56 @@ var (
 		},
 		[]string{"transport", "security", "muxer", "early_muxer", "ip_version"},
 	)
+	streamBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "stream_bytes_total",
+			Help:      "Bytes sent and received on streams",
+		},
+		[]string{"direction", "protocol"},
+	)
+	streamMessageSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "stream_message_size_bytes",
+			Help:      "Size of the reads and writes on streams",
+			Buckets:   prometheus.ExponentialBuckets(16, 4, 10), // up to 4 MiB
+		},
+		[]string{"direction", "protocol"},
+	)
+	streamTransferred = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "stream_transferred_bytes",
+			Help:      "Bytes transferred over the lifetime of a stream",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 12), // up to 256 MiB
+		},
+		[]string{"direction", "protocol"},
+	)
+	dialFunnel = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "dial_funnel_total",
+			Help:      "Addresses reaching each stage of a dial",
+		},
+		[]string{"transport", "stage", "ip_version"},
+	)
+	dialFunnelFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "dial_funnel_failures_total",
+			Help:      "Dials failing at each stage",
+		},
+		[]string{"transport", "stage", "error"},
+	)
+	peerBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "peer_bytes_total",
+			Help:      "Bytes sent and received on streams, by peer",
+		},
+		[]string{"direction", "peer"},
+	)
 	collectors = []prometheus.Collector{
 		connsOpened,
 		keyTypes,
@@ -76,6 +130,12 @@ var (
 		dialError,
 		connDuration,
 		connHandshakeLatency,
+		streamBytes,
+		streamMessageSize,
+		streamTransferred,
+		dialFunnel,
+		dialFunnelFailures,
+		peerBytes,
 	}
 )
 
@@ -83,15 +143,38 @@ type MetricsTracer interface {
 	OpenedConnection(network.Direction, crypto.PubKey, network.ConnectionState, ma.Multiaddr)
 	ClosedConnection(network.Direction, time.Duration, network.ConnectionState, ma.Multiaddr)
 	CompletedHandshake(time.Duration, network.ConnectionState, ma.Multiaddr)
+	// ConsideredDialAddrs is called with the addresses that are going to be dialed
+	// to connect to a peer, in order, after filtering them.
+	ConsideredDialAddrs([]ma.Multiaddr)
+	// StartedDialing is called when the transport starts dialing an address.
+	StartedDialing(ma.Multiaddr)
+	// SucceededDialing is called when a dial returns a secured and multiplexed
+	// connection.
+	SucceededDialing(ma.Multiaddr)
 	FailedDialing(ma.Multiaddr, error)
+	// SentStreamData is called for every write of n bytes to a stream.
+	SentStreamData(proto protocol.ID, p peer.ID, n int)
+	// ReceivedStreamData is called for every read of n bytes from a stream.
+	ReceivedStreamData(proto protocol.ID, p peer.ID, n int)
+	// ClosedStream is called when a stream is closed or reset, with the number of
+	// bytes read from and written to it.
+	ClosedStream(proto protocol.ID, read, written uint64)
 }
 
-type metricsTracer struct{}
+type metricsTracer struct {
+	// protocols caches the stream metrics of each protocol, and guards their
+	// cardinality
+	protocols *protocolMetrics
+	// peers guards the cardinality of the per-peer metrics, it is nil if they are
+	// disabled
+	peers *peerLabels
+}
 
 var _ MetricsTracer = &metricsTracer{}
 
 type metricsTracerSetting struct {
-	reg prometheus.Registerer
+	reg      prometheus.Registerer
+	maxPeers int
 }
 
 type MetricsTracerOption func(*metricsTracerSetting)
@@ -104,13 +187,153 @@ func WithRegisterer(reg prometheus.Registerer) MetricsTracerOption {
 	}
 }
 
+// WithPeerLabels enables the per-peer byte counters, for at most maxPeers peers at a
+// time to bound the number of series. Peers are labeled in the order they transfer
+// data, the bytes of the peers beyond maxPeers are counted as "other". Peers that
+// haven't transferred data for peerLabelIdleTimeout lose their label, and their
+// series are deleted.
+func WithPeerLabels(maxPeers int) MetricsTracerOption {
+	return func(s *metricsTracerSetting) {
+		s.maxPeers = maxPeers
+	}
+}
+
 func NewMetricsTracer(opts ...MetricsTracerOption) MetricsTracer {
 	setting := &metricsTracerSetting{reg: prometheus.DefaultRegisterer}
 	for _, opt := range opts {
 		opt(setting)
 	}
 	metricshelper.RegisterCollectors(setting.reg, collectors...)
-	return &metricsTracer{}
+	mt := &metricsTracer{protocols: newProtocolMetrics(maxProtocolLabels)}
+	if setting.maxPeers > 0 {
+		mt.peers = newPeerLabels(setting.maxPeers)
+	}
+	return mt
+}
+
+const (
+	peerLabelIdleTimeout = 10 * time.Minute
+	otherPeersLabel      = "other"
+
+	// maxProtocolLabels is the maximum number of protocols with their own stream
+	// metrics. The streams of the protocols beyond it are recorded as "other".
+	maxProtocolLabels   = 128
+	otherProtocolsLabel = "other"
+)
+
+// protocolMetrics holds the stream metrics of a bounded number of protocols, so that
+// reads and writes don't need to look up their series.
+type protocolMetrics struct {
+	max int
+
+	mx        sync.RWMutex
+	protocols map[protocol.ID]*streamMetrics
+	other     *streamMetrics
+}
+
+// streamMetrics are the series of the stream metrics of one protocol label.
+type streamMetrics struct {
+	bytesIn, bytesOut             prometheus.Counter
+	sizeIn, sizeOut               prometheus.Observer
+	transferredIn, transferredOut prometheus.Observer
+}
+
+func newStreamMetrics(label string) *streamMetrics {
+	return &streamMetrics{
+		bytesIn:        streamBytes.WithLabelValues("in", label),
+		bytesOut:       streamBytes.WithLabelValues("out", label),
+		sizeIn:         streamMessageSize.WithLabelValues("in", label),
+		sizeOut:        streamMessageSize.WithLabelValues("out", label),
+		transferredIn:  streamTransferred.WithLabelValues("in", label),
+		transferredOut: streamTransferred.WithLabelValues("out", label),
+	}
+}
+
+func newProtocolMetrics(max int) *protocolMetrics {
+	return &protocolMetrics{
+		max:       max,
+		protocols: make(map[protocol.ID]*streamMetrics),
+		other:     newStreamMetrics(otherProtocolsLabel),
+	}
+}
+
+// get returns the metrics of proto, or those of the other protocols if all labels
+// are taken.
+func (m *protocolMetrics) get(proto protocol.ID) *streamMetrics {
+	m.mx.RLock()
+	sm, ok := m.protocols[proto]
+	m.mx.RUnlock()
+	if ok {
+		return sm
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if sm, ok := m.protocols[proto]; ok {
+		return sm
+	}
+	if len(m.protocols) >= m.max {
+		return m.other
+	}
+	sm = newStreamMetrics(protocolLabel(proto))
+	m.protocols[proto] = sm
+	return sm
+}
+
+// peerLabels assigns labels to a bounded number of peers.
+type peerLabels struct {
+	max int
+
+	mx    sync.Mutex
+	peers map[peer.ID]*peerLabel
+	// nextEviction is the earliest time idle peers can be evicted
+	nextEviction time.Time
+}
+
+type peerLabel struct {
+	label    string
+	lastSeen time.Time
+}
+
+func newPeerLabels(max int) *peerLabels {
+	return &peerLabels{max: max, peers: make(map[peer.ID]*peerLabel)}
+}
+
+// label returns the label of p, or otherPeersLabel if all labels are taken.
+func (l *peerLabels) label(p peer.ID) string {
+	now := time.Now()
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if pl, ok := l.peers[p]; ok {
+		pl.lastSeen = now
+		return pl.label
+	}
+	if len(l.peers) >= l.max {
+		l.evictIdle(now)
+		if len(l.peers) >= l.max {
+			return otherPeersLabel
+		}
+	}
+	pl := &peerLabel{label: p.String(), lastSeen: now}
+	l.peers[p] = pl
+	return pl.label
+}
+
+// evictIdle removes the labels of the idle peers, along with their series. It scans
+// the peers at most once per second.
+func (l *peerLabels) evictIdle(now time.Time) {
+	if now.Before(l.nextEviction) {
+		return
+	}
+	l.nextEviction = now.Add(time.Second)
+	for p, pl := range l.peers {
+		if now.Sub(pl.lastSeen) > peerLabelIdleTimeout {
+			delete(l.peers, p)
+			peerBytes.DeleteLabelValues("in", pl.label)
+			peerBytes.DeleteLabelValues("out", pl.label)
+		}
+	}
 }
 
 func appendConnectionState(tags []string, cs network.ConnectionState) []string {
@@ -185,13 +408,29 @@ func (m *metricsTracer) CompletedHandshake(t time.Duration, cs network.Connectio
 
 var transports = [...]int{ma.P_CIRCUIT, ma.P_WEBRTC, ma.P_WEBTRANSPORT, ma.P_QUIC, ma.P_QUIC_V1, ma.P_WSS, ma.P_WS, ma.P_TCP}
 
-func (m *metricsTracer) FailedDialing(addr ma.Multiaddr, err error) {
-	var transport string
+// Stages of the dial funnel. A dial that fails is attributed to the stage after the
+// last stage it reached.
+const (
+	dialStageConsidered = "considered"
+	dialStageAttempted  = "attempted"
+	// dialStageConnected is reached once the transport connected: TCP connected, or
+	// a UDP based transport was reachable
+	dialStageConnected = "connected"
+	dialStageSecured   = "secured"
+	dialStageMuxed     = "muxed"
+)
+
+func getDialTransport(addr ma.Multiaddr) string {
+	var tpt string
 	for _, t := range transports {
 		if _, err := addr.ValueForProtocol(t); err == nil {
-			transport = ma.ProtocolWithCode(t).Name
+			tpt = ma.ProtocolWithCode(t).Name
 		}
 	}
+	return tpt
+}
+
+func getDialErrorCategory(err error) string {
 	e := "other"
 	if errors.Is(err, context.Canceled) {
 		e = "canceled"
@@ -205,11 +444,119 @@ func (m *metricsTracer) FailedDialing(addr ma.Multiaddr, err error) {
 			e = "connection refused"
 		}
 	}
+	return e
+}
+
+var (
+	securityFailureStages = []string{dialStageConnected}
+	muxerFailureStages    = []string{dialStageConnected, dialStageSecured}
+)
+
+// dialStagesReached returns the funnel stages that a dial failing with err reached
+// after it was attempted, and the stage it failed at.
+func dialStagesReached(err error) (reached []string, failed string) {
+	// Unwrap manually, errors.As allocates.
+	var uerr *transport.UpgradeError
+	for e := err; e != nil && uerr == nil; e = errors.Unwrap(e) {
+		uerr, _ = e.(*transport.UpgradeError)
+	}
+	if uerr == nil {
+		// Transports that don't use the upgrader, like QUIC, secure and multiplex
+		// the connection as part of connecting.
+		return nil, "connect"
+	}
+	switch uerr.Stage {
+	case transport.UpgradeStageSecurity:
+		return securityFailureStages, string(uerr.Stage)
+	default:
+		return muxerFailureStages, string(uerr.Stage)
+	}
+}
+
+func (m *metricsTracer) funnelStage(addr ma.Multiaddr, stage string) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	*tags = append(*tags, getDialTransport(addr), stage, getIPVersion(addr))
+	dialFunnel.WithLabelValues(*tags...).Inc()
+}
+
+func (m *metricsTracer) ConsideredDialAddrs(addrs []ma.Multiaddr) {
+	for _, addr := range addrs {
+		m.funnelStage(addr, dialStageConsidered)
+	}
+}
+
+func (m *metricsTracer) StartedDialing(addr ma.Multiaddr) {
+	m.funnelStage(addr, dialStageAttempted)
+}
+
+func (m *metricsTracer) SucceededDialing(addr ma.Multiaddr) {
+	m.funnelStage(addr, dialStageConnected)
+	m.funnelStage(addr, dialStageSecured)
+	m.funnelStage(addr, dialStageMuxed)
+}
+
+func (m *metricsTracer) FailedDialing(addr ma.Multiaddr, err error) {
+	tpt := getDialTransport(addr)
+	e := getDialErrorCategory(err)
 
 	tags := metricshelper.GetStringSlice()
 	defer metricshelper.PutStringSlice(tags)
 
-	*tags = append(*tags, transport, e)
+	*tags = append(*tags, tpt, e)
 	*tags = append(*tags, getIPVersion(addr))
 	dialError.WithLabelValues(*tags...).Inc()
+
+	reached, failed := dialStagesReached(err)
+	for _, stage := range reached {
+		m.funnelStage(addr, stage)
+	}
+	*tags = (*tags)[:0]
+	*tags = append(*tags, tpt, failed, e)
+	dialFunnelFailures.WithLabelValues(*tags...).Inc()
+}
+
+func protocolLabel(proto protocol.ID) string {
+	if proto == "" {
+		return "unknown"
+	}
+	return string(proto)
+}
+
+func (m *metricsTracer) peerData(direction string, p peer.ID, n int) {
+	if m.peers == nil {
+		return
+	}
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	*tags = append(*tags, direction, m.peers.label(p))
+	peerBytes.WithLabelValues(*tags...).Add(float64(n))
+}
+
+func (m *metricsTracer) SentStreamData(proto protocol.ID, p peer.ID, n int) {
+	if n <= 0 {
+		return
+	}
+	sm := m.protocols.get(proto)
+	sm.bytesOut.Add(float64(n))
+	sm.sizeOut.Observe(float64(n))
+	m.peerData("out", p, n)
+}
+
+func (m *metricsTracer) ReceivedStreamData(proto protocol.ID, p peer.ID, n int) {
+	if n <= 0 {
+		return
+	}
+	sm := m.protocols.get(proto)
+	sm.bytesIn.Add(float64(n))
+	sm.sizeIn.Observe(float64(n))
+	m.peerData("in", p, n)
+}
+
+func (m *metricsTracer) ClosedStream(proto protocol.ID, read, written uint64) {
+	sm := m.protocols.get(proto)
+	sm.transferredIn.Observe(float64(read))
+	sm.transferredOut.Observe(float64(written))
 }
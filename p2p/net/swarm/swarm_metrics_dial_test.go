@@ -0,0 +1,36 @@
+package swarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/transport"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialStagesReached(t *testing.T) {
+	for _, tc := range []struct {
+		err     error
+		reached []string
+		failed  string
+	}{
+		{err: errors.New("connection refused"), failed: "connect"},
+		{
+			err:     &transport.UpgradeError{Stage: transport.UpgradeStageSecurity, Err: context.Canceled},
+			reached: []string{dialStageConnected},
+			failed:  "security",
+		},
+		{
+			err:     fmt.Errorf("dial: %w", &transport.UpgradeError{Stage: transport.UpgradeStageMuxer, Err: context.Canceled}),
+			reached: []string{dialStageConnected, dialStageSecured},
+			failed:  "muxer",
+		},
+	} {
+		reached, failed := dialStagesReached(tc.err)
+		require.Equal(t, tc.reached, reached, tc.err.Error())
+		require.Equal(t, tc.failed, failed, tc.err.Error())
+	}
+}
@@ -0,0 +1,36 @@
+package swarm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerLabels(t *testing.T) {
+	l := newPeerLabels(2)
+	p1, p2, p3 := peer.ID("peer1"), peer.ID("peer2"), peer.ID("peer3")
+
+	require.Equal(t, p1.String(), l.label(p1))
+	require.Equal(t, p2.String(), l.label(p2))
+	require.Equal(t, otherPeersLabel, l.label(p3))
+	require.Equal(t, p1.String(), l.label(p1))
+
+	// once a peer is idle, its label is given to a new peer
+	l.peers[p2].lastSeen = time.Now().Add(-2 * peerLabelIdleTimeout)
+	l.nextEviction = time.Time{}
+	require.Equal(t, p3.String(), l.label(p3))
+	require.Equal(t, otherPeersLabel, l.label(p2))
+}
+
+func TestProtocolMetrics(t *testing.T) {
+	m := newProtocolMetrics(2)
+	foo := m.get("/foo")
+	require.Same(t, foo, m.get("/foo"))
+	require.NotSame(t, foo, m.get(""))
+	// all labels are taken
+	require.Same(t, m.other, m.get("/bar"))
+	require.Same(t, foo, m.get("/foo"))
+}
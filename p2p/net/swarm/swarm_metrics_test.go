@@ -12,6 +12,9 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/transport"
 	ma "github.com/multiformats/go-multiaddr"
 
 	mrand "math/rand"
@@ -47,7 +50,7 @@ func randItem[T any](items []T) T {
 }
 
 func TestMetricsNoAllocNoCover(t *testing.T) {
-	mt := NewMetricsTracer()
+	mt := NewMetricsTracer(WithPeerLabels(2))
 
 	connections := []network.ConnectionState{
 		{StreamMultiplexer: "yamux", Security: "tls", Transport: "tcp", UsedEarlyMuxerNegotiation: true},
@@ -70,6 +73,8 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 		context.Canceled,
 		context.DeadlineExceeded,
 		&net.OpError{Err: syscall.ETIMEDOUT},
+		&transport.UpgradeError{Stage: transport.UpgradeStageSecurity, Err: context.Canceled},
+		&transport.UpgradeError{Stage: transport.UpgradeStageMuxer, Err: context.Canceled},
 	}
 
 	addrs := []ma.Multiaddr{
@@ -78,6 +83,9 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 		ma.StringCast("/ip4/1.2.3.4/udp/2345"),
 	}
 
+	protos := []protocol.ID{"", "/ipfs/ping/1.0.0", "/ipfs/id/1.0.0"}
+	peers := []peer.ID{"peer1", "peer2", "peer3"}
+
 	tests := map[string]func(){
 		"OpenedConnection": func() {
 			mt.OpenedConnection(randItem(directions), randItem(keys), randItem(connections), randItem(addrs))
@@ -88,7 +96,19 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 		"CompletedHandshake": func() {
 			mt.CompletedHandshake(time.Duration(mrand.Intn(100))*time.Second, randItem(connections), randItem(addrs))
 		},
-		"FailedDialing": func() { mt.FailedDialing(randItem(addrs), randItem(errors)) },
+		"ConsideredDialAddrs": func() { mt.ConsideredDialAddrs(addrs) },
+		"StartedDialing":      func() { mt.StartedDialing(randItem(addrs)) },
+		"SucceededDialing":    func() { mt.SucceededDialing(randItem(addrs)) },
+		"FailedDialing":       func() { mt.FailedDialing(randItem(addrs), randItem(errors)) },
+		"SentStreamData": func() {
+			mt.SentStreamData(randItem(protos), randItem(peers), mrand.Intn(1<<20))
+		},
+		"ReceivedStreamData": func() {
+			mt.ReceivedStreamData(randItem(protos), randItem(peers), mrand.Intn(1<<20))
+		},
+		"ClosedStream": func() {
+			mt.ClosedStream(randItem(protos), uint64(mrand.Intn(1<<20)), uint64(mrand.Intn(1<<20)))
+		},
 	}
 
 	for method, f := range tests {
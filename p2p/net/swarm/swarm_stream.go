@@ -27,6 +27,15 @@ type Stream struct {
 	protocol atomic.Pointer[protocol.ID]
 
 	stat network.Stats
+
+	// sampled is true if stream events are emitted for this stream
+	sampled bool
+	// openedEmitted is set once the EvtStreamOpened of the stream was emitted
+	openedEmitted atomic.Bool
+	// countBytes is true if the bytes read and written are counted, for the stream
+	// events or for the metrics
+	countBytes              bool
+	bytesRead, bytesWritten atomic.Uint64
 }
 
 func (s *Stream) ID() string {
@@ -53,6 +62,12 @@ func (s *Stream) Conn() network.Conn {
 // Read reads bytes from a stream.
 func (s *Stream) Read(p []byte) (int, error) {
 	n, err := s.stream.Read(p)
+	if s.countBytes {
+		s.bytesRead.Add(uint64(n))
+	}
+	if mt := s.conn.swarm.metricsTracer; mt != nil {
+		mt.ReceivedStreamData(s.Protocol(), s.conn.RemotePeer(), n)
+	}
 	// TODO: push this down to a lower level for better accuracy.
 	if s.conn.swarm.bwc != nil {
 		s.conn.swarm.bwc.LogRecvMessage(int64(n))
@@ -64,6 +79,12 @@ func (s *Stream) Read(p []byte) (int, error) {
 // Write writes bytes to a stream, flushing for each call.
 func (s *Stream) Write(p []byte) (int, error) {
 	n, err := s.stream.Write(p)
+	if s.countBytes {
+		s.bytesWritten.Add(uint64(n))
+	}
+	if mt := s.conn.swarm.metricsTracer; mt != nil {
+		mt.SentStreamData(s.Protocol(), s.conn.RemotePeer(), n)
+	}
 	// TODO: push this down to a lower level for better accuracy.
 	if s.conn.swarm.bwc != nil {
 		s.conn.swarm.bwc.LogSentMessage(int64(n))
@@ -76,15 +97,20 @@ func (s *Stream) Write(p []byte) (int, error) {
 // resources.
 func (s *Stream) Close() error {
 	err := s.stream.Close()
-	s.closeOnce.Do(s.remove)
+	s.closeOnce.Do(func() { s.remove(false, "local") })
 	return err
 }
 
 // Reset resets the stream, signaling an error on both ends and freeing all
 // associated resources.
 func (s *Stream) Reset() error {
+	return s.reset("local")
+}
+
+// reset resets the stream, recording cause as the reason it was reset in the trace.
+func (s *Stream) reset(cause string) error {
 	err := s.stream.Reset()
-	s.closeOnce.Do(s.remove)
+	s.closeOnce.Do(func() { s.remove(true, cause) })
 	return err
 }
 
@@ -101,8 +127,13 @@ func (s *Stream) CloseRead() error {
 	return s.stream.CloseRead()
 }
 
-func (s *Stream) remove() {
+func (s *Stream) remove(reset bool, cause string) {
 	s.conn.removeStream(s)
+	s.emitClosed(reset)
+	s.conn.swarm.tracer.streamClosed(s, reset, cause)
+	if mt := s.conn.swarm.metricsTracer; mt != nil {
+		mt.ClosedStream(s.Protocol(), s.bytesRead.Load(), s.bytesWritten.Load())
+	}
 	s.conn.swarm.refs.Done()
 }
 
@@ -126,6 +157,8 @@ func (s *Stream) SetProtocol(p protocol.ID) error {
 	}
 
 	s.protocol.Store(&p)
+	s.emitOpened(p)
+	s.conn.swarm.tracer.streamProtocol(s, p)
 	return nil
 }
 
@@ -2,6 +2,7 @@ package swarm
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/libp2p/go-libp2p/core/transport"
@@ -69,6 +70,24 @@ func (s *Swarm) TransportForListening(a ma.Multiaddr) transport.Transport {
 	return selected
 }
 
+// Transports returns the transports added to the swarm, ordered by the code of the
+// first protocol they handle.
+func (s *Swarm) Transports() []transport.Transport {
+	s.transports.RLock()
+	defer s.transports.RUnlock()
+	seen := make(map[transport.Transport]struct{}, len(s.transports.m))
+	tpts := make([]transport.Transport, 0, len(s.transports.m))
+	for _, t := range s.transports.m {
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		tpts = append(tpts, t)
+	}
+	sort.Slice(tpts, func(i, j int) bool { return tpts[i].Protocols()[0] < tpts[j].Protocols()[0] })
+	return tpts
+}
+
 // AddTransport adds a transport to this swarm.
 //
 // Satisfies the Network interface from go-libp2p-transport.
@@ -25,6 +25,7 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 
+	mockClock "github.com/benbjohnson/clock"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
 )
@@ -54,7 +55,9 @@ func (rc realclock) Now() time.Time {
 // Option is an option that can be passed when constructing a test swarm.
 type Option func(*testing.T, *config)
 
-// WithClock sets the clock to use for this swarm
+// WithClock sets the clock to use for this swarm. The peerstore uses it, and so does
+// the swarm itself if it implements the Clock of github.com/benbjohnson/clock, as
+// its mock clock does.
 func WithClock(clock clock) Option {
 	return func(_ *testing.T, c *config) {
 		c.clock = clock
@@ -148,6 +151,9 @@ func GenSwarm(t *testing.T, opts ...Option) *swarm.Swarm {
 	if cfg.connectionGater != nil {
 		swarmOpts = append(swarmOpts, swarm.WithConnectionGater(cfg.connectionGater))
 	}
+	if cl, ok := cfg.clock.(mockClock.Clock); ok {
+		swarmOpts = append(swarmOpts, swarm.WithClock(cl))
+	}
 
 	eventBus := cfg.eventBus
 	if eventBus == nil {
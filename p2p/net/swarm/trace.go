@@ -0,0 +1,389 @@
+package swarm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/transport"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// TraceRecordType is the type of a TraceRecord.
+type TraceRecordType string
+
+const (
+	// TraceDialStarted is recorded when dialing an address starts.
+	TraceDialStarted TraceRecordType = "dial_started"
+	// TraceDialFinished is recorded when dialing an address finishes, after the
+	// connection was upgraded. Error is set if the dial or the upgrade failed.
+	TraceDialFinished TraceRecordType = "dial_finished"
+	// TraceConnOpened is recorded when an upgraded connection is added to the swarm.
+	TraceConnOpened TraceRecordType = "conn_opened"
+	// TraceConnGated is recorded when the connection gater rejects an upgraded
+	// connection.
+	TraceConnGated TraceRecordType = "conn_gated"
+	// TraceConnClosed is recorded when a connection is closed. Cause is "local" if
+	// it was closed by this node, or the error that ended it otherwise.
+	TraceConnClosed TraceRecordType = "conn_closed"
+	// TraceStreamOpened is recorded when a stream is opened, before its protocol is
+	// negotiated.
+	TraceStreamOpened TraceRecordType = "stream_opened"
+	// TraceStreamProtocol is recorded when the protocol of a stream is set.
+	TraceStreamProtocol TraceRecordType = "stream_protocol"
+	// TraceStreamClosed is recorded when a stream is closed or reset. Cause is
+	// "local" if it was closed or reset by this node, or "connection closed" if its
+	// connection was closed.
+	TraceStreamClosed TraceRecordType = "stream_closed"
+)
+
+// TraceRecord is a connection or stream lifecycle record written by the tracer,
+// see WithTrace. Fields that don't apply to a record are omitted.
+type TraceRecord struct {
+	Time      time.Time
+	Type      TraceRecordType
+	Peer      peer.ID `json:",omitempty"`
+	Conn      string  `json:",omitempty"`
+	Stream    string  `json:",omitempty"`
+	Direction string  `json:",omitempty"`
+
+	LocalAddr  string `json:",omitempty"`
+	RemoteAddr string `json:",omitempty"`
+	Transport  string `json:",omitempty"`
+	Security   string `json:",omitempty"`
+	Muxer      string `json:",omitempty"`
+
+	Protocol protocol.ID `json:",omitempty"`
+	// Duration is the time the dial took for TraceDialFinished, and the lifetime of
+	// the connection or stream when it is closed.
+	Duration time.Duration `json:",omitempty"`
+	Error    string        `json:",omitempty"`
+	Cause    string        `json:",omitempty"`
+	Reset    bool          `json:",omitempty"`
+}
+
+// TraceFile configures a trace file that is rotated once it reaches MaxSize bytes.
+// The rotated files are named Path.1 (the most recent) to Path.<MaxFiles>.
+type TraceFile struct {
+	Path string
+	// MaxSize is the size at which the file is rotated, it defaults to 100 MiB.
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept. If it is 0, the file is
+	// truncated when it is rotated.
+	MaxFiles int
+}
+
+const defaultTraceFileMaxSize = 100 << 20
+
+// WithTrace makes the swarm write a TraceRecord for the dials, connections and
+// streams to w, as lines of JSON. Records are buffered and written every second, and
+// when the swarm is closed.
+func WithTrace(w io.Writer) Option {
+	return func(s *Swarm) error {
+		if w == nil {
+			return errors.New("trace writer cannot be nil")
+		}
+		if s.traceOut != nil || s.traceFile != nil {
+			return errors.New("trace already set")
+		}
+		s.traceOut = w
+		return nil
+	}
+}
+
+// WithTraceFile is like WithTrace, writing the records to a rotated file. The file
+// is appended to if it exists. It's opened by NewSwarm, once all options were applied.
+func WithTraceFile(f TraceFile) Option {
+	return func(s *Swarm) error {
+		if f.Path == "" {
+			return errors.New("trace file path cannot be empty")
+		}
+		if f.MaxFiles < 0 {
+			return errors.New("negative number of trace files")
+		}
+		if s.traceOut != nil || s.traceFile != nil {
+			return errors.New("trace already set")
+		}
+		if f.MaxSize <= 0 {
+			f.MaxSize = defaultTraceFileMaxSize
+		}
+		s.traceFile = &f
+		return nil
+	}
+}
+
+// tracer writes the trace records. Its methods can be called on a nil tracer, which
+// doesn't record anything.
+type tracer struct {
+	out io.Writer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mx      sync.Mutex
+	done    bool
+	pending []TraceRecord
+}
+
+func newTracer(out io.Writer) *tracer {
+	t := &tracer{out: out}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	t.wg.Add(1)
+	go t.background()
+	return t
+}
+
+func (t *tracer) push(r TraceRecord) {
+	r.Time = time.Now()
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if !t.done {
+		t.pending = append(t.pending, r)
+	}
+}
+
+func (t *tracer) background() {
+	defer t.wg.Done()
+
+	// Each record is written with a single call, so that the trace file is only
+	// rotated between records.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var pend []TraceRecord
+	write := func() bool {
+		t.mx.Lock()
+		pend, t.pending = t.pending, pend[:0]
+		t.mx.Unlock()
+		for _, r := range pend {
+			buf.Reset()
+			if err := enc.Encode(r); err != nil {
+				log.Warnf("error encoding swarm trace record: %s", err)
+				continue
+			}
+			if _, err := t.out.Write(buf.Bytes()); err != nil {
+				log.Warnf("error writing swarm trace: %s", err)
+				return false
+			}
+		}
+		return true
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			if !write() {
+				t.mx.Lock()
+				t.done = true
+				t.pending = nil
+				t.mx.Unlock()
+				return
+			}
+		case <-t.ctx.Done():
+			write()
+			return
+		}
+	}
+}
+
+// close writes the pending records, and closes the output if the tracer owns it.
+func (t *tracer) close() {
+	if t == nil {
+		return
+	}
+	t.mx.Lock()
+	t.done = true
+	t.mx.Unlock()
+	t.cancel()
+	t.wg.Wait()
+	if rf, ok := t.out.(*rotatingFile); ok {
+		if err := rf.Close(); err != nil {
+			log.Warnf("error closing swarm trace: %s", err)
+		}
+	}
+}
+
+func traceConnState(r *TraceRecord, cs network.ConnectionState) {
+	r.Transport = string(cs.Transport)
+	r.Security = string(cs.Security)
+	r.Muxer = string(cs.StreamMultiplexer)
+}
+
+func (t *tracer) dialStarted(p peer.ID, addr ma.Multiaddr) {
+	if t == nil {
+		return
+	}
+	t.push(TraceRecord{Type: TraceDialStarted, Peer: p, RemoteAddr: addr.String()})
+}
+
+func (t *tracer) dialFinished(p peer.ID, addr ma.Multiaddr, dt time.Duration, c transport.CapableConn, err error) {
+	if t == nil {
+		return
+	}
+	r := TraceRecord{Type: TraceDialFinished, Peer: p, RemoteAddr: addr.String(), Duration: dt}
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.LocalAddr = c.LocalMultiaddr().String()
+		traceConnState(&r, c.ConnState())
+	}
+	t.push(r)
+}
+
+func (t *tracer) connOpened(c *Conn) {
+	if t == nil {
+		return
+	}
+	r := TraceRecord{
+		Type:       TraceConnOpened,
+		Peer:       c.RemotePeer(),
+		Conn:       c.ID(),
+		Direction:  strings.ToLower(c.stat.Direction.String()),
+		LocalAddr:  c.LocalMultiaddr().String(),
+		RemoteAddr: c.RemoteMultiaddr().String(),
+	}
+	traceConnState(&r, c.ConnState())
+	t.push(r)
+}
+
+func (t *tracer) connGated(tc transport.CapableConn, dir network.Direction) {
+	if t == nil {
+		return
+	}
+	t.push(TraceRecord{
+		Type:       TraceConnGated,
+		Peer:       tc.RemotePeer(),
+		Direction:  strings.ToLower(dir.String()),
+		LocalAddr:  tc.LocalMultiaddr().String(),
+		RemoteAddr: tc.RemoteMultiaddr().String(),
+	})
+}
+
+func (t *tracer) connClosed(c *Conn, cause string) {
+	if t == nil {
+		return
+	}
+	t.push(TraceRecord{
+		Type:     TraceConnClosed,
+		Peer:     c.RemotePeer(),
+		Conn:     c.ID(),
+		Duration: c.swarm.clock.Since(c.stat.Opened),
+		Cause:    cause,
+	})
+}
+
+func (t *tracer) streamOpened(s *Stream) {
+	if t == nil {
+		return
+	}
+	t.push(TraceRecord{
+		Type:      TraceStreamOpened,
+		Peer:      s.conn.RemotePeer(),
+		Conn:      s.conn.ID(),
+		Stream:    s.ID(),
+		Direction: strings.ToLower(s.stat.Direction.String()),
+	})
+}
+
+func (t *tracer) streamProtocol(s *Stream, p protocol.ID) {
+	if t == nil {
+		return
+	}
+	t.push(TraceRecord{
+		Type:     TraceStreamProtocol,
+		Peer:     s.conn.RemotePeer(),
+		Conn:     s.conn.ID(),
+		Stream:   s.ID(),
+		Protocol: p,
+	})
+}
+
+func (t *tracer) streamClosed(s *Stream, reset bool, cause string) {
+	if t == nil {
+		return
+	}
+	t.push(TraceRecord{
+		Type:     TraceStreamClosed,
+		Peer:     s.conn.RemotePeer(),
+		Conn:     s.conn.ID(),
+		Stream:   s.ID(),
+		Protocol: s.Protocol(),
+		Duration: s.conn.swarm.clock.Since(s.stat.Opened),
+		Reset:    reset,
+		Cause:    cause,
+	})
+}
+
+// rotatingFile is a file that is rotated when it reaches its maximum size. Writes
+// aren't split across files.
+type rotatingFile struct {
+	cfg  TraceFile
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(cfg TraceFile) (*rotatingFile, error) {
+	f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rotatingFile{cfg: cfg, f: f, size: fi.Size()}, nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.cfg.MaxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	if rf.cfg.MaxFiles > 0 {
+		for i := rf.cfg.MaxFiles - 1; i > 0; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", rf.cfg.Path, i), fmt.Sprintf("%s.%d", rf.cfg.Path, i+1))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Rename(rf.cfg.Path, rf.cfg.Path+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(rf.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	rf.f = f
+	rf.size = 0
+	return nil
+}
+
+func (rf *rotatingFile) Close() error {
+	return rf.f.Close()
+}
@@ -0,0 +1,118 @@
+package swarm_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	. "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readTrace(t *testing.T, b []byte) []swarm.TraceRecord {
+	t.Helper()
+	var records []swarm.TraceRecord
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		var r swarm.TraceRecord
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &r))
+		records = append(records, r)
+	}
+	require.NoError(t, sc.Err())
+	return records
+}
+
+func TestTrace(t *testing.T) {
+	var buf bytes.Buffer
+	s1 := GenSwarm(t, WithSwarmOpts(swarm.WithTrace(&buf)))
+	s2 := GenSwarm(t)
+	defer s2.Close()
+	connectSwarms(t, context.Background(), []*swarm.Swarm{s1, s2})
+	s2.SetStreamHandler(func(str network.Stream) { str.Close() })
+
+	str, err := s1.NewStream(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	require.NoError(t, str.SetProtocol("/test"))
+	require.NoError(t, str.Reset())
+	str, err = s1.NewStream(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	// closing the swarm flushes the trace
+	require.NoError(t, s1.Close())
+
+	var types []swarm.TraceRecordType
+	for _, r := range readTrace(t, buf.Bytes()) {
+		types = append(types, r.Type)
+		switch r.Type {
+		case swarm.TraceDialFinished:
+			require.Equal(t, s2.LocalPeer(), r.Peer)
+			require.Empty(t, r.Error)
+			require.NotEmpty(t, r.Transport)
+		case swarm.TraceConnOpened:
+			require.Equal(t, "outbound", r.Direction)
+			// QUIC connections don't report their security protocol and muxer
+			if r.Transport == "tcp" {
+				require.NotEmpty(t, r.Security)
+				require.NotEmpty(t, r.Muxer)
+			}
+		case swarm.TraceConnClosed:
+			require.Equal(t, "local", r.Cause)
+		case swarm.TraceStreamClosed:
+			require.True(t, r.Reset)
+			if r.Stream == str.ID() {
+				require.Equal(t, "connection closed", r.Cause)
+			} else {
+				require.Equal(t, "local", r.Cause)
+				require.Equal(t, "/test", string(r.Protocol))
+			}
+		}
+	}
+	require.Equal(t, []swarm.TraceRecordType{
+		swarm.TraceDialStarted,
+		swarm.TraceDialFinished,
+		swarm.TraceConnOpened,
+		swarm.TraceStreamOpened,
+		swarm.TraceStreamProtocol,
+		swarm.TraceStreamClosed,
+		swarm.TraceStreamOpened,
+		swarm.TraceConnClosed,
+		swarm.TraceStreamClosed,
+	}, types)
+}
+
+func TestTraceFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	s1 := GenSwarm(t, WithSwarmOpts(swarm.WithTraceFile(swarm.TraceFile{Path: path, MaxSize: 1, MaxFiles: 2})))
+	s2 := GenSwarm(t)
+	defer s2.Close()
+	connectSwarms(t, context.Background(), []*swarm.Swarm{s1, s2})
+	require.NoError(t, s1.Close())
+
+	// every record exceeds the maximum size, so each file holds a single record
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		b, err := os.ReadFile(name)
+		require.NoError(t, err)
+		require.Len(t, readTrace(t, b), 1)
+	}
+	_, err := os.Stat(path + ".3")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestTraceFileNotOpenedOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	_, err = swarm.NewSwarm("", ps, eventbus.NewBus(), swarm.WithTraceFile(swarm.TraceFile{Path: path}), swarm.WithTrace(nil))
+	require.Error(t, err)
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/libp2p/go-libp2p/core/connmgr"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/transport"
 
@@ -85,13 +86,15 @@ func (l *listener) handleIncoming() {
 		catcher.Reset()
 
 		// gate the connection if applicable
-		if l.upgrader.connGater != nil && !l.upgrader.connGater.InterceptAccept(maconn) {
-			log.Debugf("gater blocked incoming connection on local addr %s from %s",
-				maconn.LocalMultiaddr(), maconn.RemoteMultiaddr())
-			if err := maconn.Close(); err != nil {
-				log.Warnf("failed to close incoming connection rejected by gater: %s", err)
+		if l.upgrader.connGater != nil {
+			if r := connmgr.GateAccept(l.upgrader.connGater, maconn); r != nil {
+				log.Debugf("gater blocked incoming connection on local addr %s from %s: %s",
+					maconn.LocalMultiaddr(), maconn.RemoteMultiaddr(), r)
+				if err := maconn.Close(); err != nil {
+					log.Warnf("failed to close incoming connection rejected by gater: %s", err)
+				}
+				continue
 			}
-			continue
 		}
 
 		connScope, err := l.rcmgr.OpenConnection(network.DirInbound, true, maconn.RemoteMultiaddr())
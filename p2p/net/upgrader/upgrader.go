@@ -144,7 +144,7 @@ func (u *upgrader) upgrade(ctx context.Context, t transport.Transport, maconn ma
 		pconn, err := pnet.NewProtectedConn(u.psk, conn)
 		if err != nil {
 			conn.Close()
-			return nil, fmt.Errorf("failed to setup private network protector: %w", err)
+			return nil, &transport.UpgradeError{Stage: transport.UpgradeStageSecurity, Err: fmt.Errorf("failed to setup private network protector: %w", err)}
 		}
 		conn = pconn
 	} else if ipnet.ForcePrivateNetwork {
@@ -155,16 +155,18 @@ func (u *upgrader) upgrade(ctx context.Context, t transport.Transport, maconn ma
 	sconn, security, server, err := u.setupSecurity(ctx, conn, p, dir)
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to negotiate security protocol: %w", err)
+		return nil, &transport.UpgradeError{Stage: transport.UpgradeStageSecurity, Err: fmt.Errorf("failed to negotiate security protocol: %w", err)}
 	}
 
 	// call the connection gater, if one is registered.
-	if u.connGater != nil && !u.connGater.InterceptSecured(dir, sconn.RemotePeer(), maconn) {
-		if err := maconn.Close(); err != nil {
-			log.Errorw("failed to close connection", "peer", p, "addr", maconn.RemoteMultiaddr(), "error", err)
+	if u.connGater != nil {
+		if r := connmgr.GateSecured(u.connGater, dir, sconn.RemotePeer(), maconn); r != nil {
+			if err := maconn.Close(); err != nil {
+				log.Errorw("failed to close connection", "peer", p, "addr", maconn.RemoteMultiaddr(), "error", err)
+			}
+			return nil, &transport.UpgradeError{Stage: transport.UpgradeStageMuxer, Err: fmt.Errorf("gater rejected connection with peer %s and addr %s with direction %d: %w",
+				sconn.RemotePeer(), maconn.RemoteMultiaddr(), dir, &connmgr.GatedError{Reason: *r})}
 		}
-		return nil, fmt.Errorf("gater rejected connection with peer %s and addr %s with direction %d",
-			sconn.RemotePeer(), maconn.RemoteMultiaddr(), dir)
 	}
 	// Only call SetPeer if it hasn't already been set -- this can happen when we don't know
 	// the peer in advance and in some bug scenarios.
@@ -174,15 +176,15 @@ func (u *upgrader) upgrade(ctx context.Context, t transport.Transport, maconn ma
 			if err := maconn.Close(); err != nil {
 				log.Errorw("failed to close connection", "peer", p, "addr", maconn.RemoteMultiaddr(), "error", err)
 			}
-			return nil, fmt.Errorf("resource manager connection with peer %s and addr %s with direction %d",
-				sconn.RemotePeer(), maconn.RemoteMultiaddr(), dir)
+			return nil, &transport.UpgradeError{Stage: transport.UpgradeStageMuxer, Err: fmt.Errorf("resource manager connection with peer %s and addr %s with direction %d",
+				sconn.RemotePeer(), maconn.RemoteMultiaddr(), dir)}
 		}
 	}
 
 	muxer, smconn, err := u.setupMuxer(ctx, sconn, server, connScope.PeerScope())
 	if err != nil {
 		sconn.Close()
-		return nil, fmt.Errorf("failed to negotiate stream multiplexer: %w", err)
+		return nil, &transport.UpgradeError{Stage: transport.UpgradeStageMuxer, Err: fmt.Errorf("failed to negotiate stream multiplexer: %w", err)}
 	}
 
 	tc := &transportConn{
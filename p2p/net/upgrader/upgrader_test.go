@@ -200,5 +200,8 @@ func TestOutboundResourceManagement(t *testing.T) {
 		_, dialUpgrader := createUpgrader(t)
 		_, err := dial(t, dialUpgrader, ln.Multiaddr(), id, connScope)
 		require.Error(t, err)
+		var uerr *transport.UpgradeError
+		require.ErrorAs(t, err, &uerr)
+		require.Equal(t, transport.UpgradeStageMuxer, uerr.Stage)
 	})
 }
@@ -0,0 +1,233 @@
+// Package autonatv2 implements the AutoNAT v2 protocol.
+//
+// In contrast to AutoNAT v1, which can only determine whether the node is reachable
+// at all, AutoNAT v2 tests the reachability of individual addresses. The client sends
+// a list of addresses along with a nonce to a server, which dials back the first
+// address it is willing to dial and sends the nonce on a stream over the new
+// connection. To prevent the protocol from being abused for amplification attacks,
+// the server asks the client to send a comparatively large amount of data before
+// dialing an address whose IP differs from the client's observed IP.
+package autonatv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+//go:generate protoc --proto_path=$PWD:$PWD/../../.. --go_out=. --go_opt=Mpb/autonatv2.proto=./pb pb/autonatv2.proto
+
+var log = logging.Logger("autonatv2")
+
+const (
+	ServiceName = "libp2p.autonatv2"
+
+	// DialProtocol is the protocol used by clients to request a dial-back.
+	DialProtocol = "/libp2p/autonat/2/dial-request"
+	// DialBackProtocol is the protocol used by servers on the dial-back connection.
+	DialBackProtocol = "/libp2p/autonat/2/dial-back"
+
+	maxMsgSize            = 8192
+	dialBackMaxMsgSize    = 1024
+	streamTimeout         = time.Minute
+	dialBackStreamTimeout = 5 * time.Second
+	dialBackDialTimeout   = 30 * time.Second
+
+	// maxPeerAddresses is the maximum number of addresses a client may ask to be tested
+	// in a single request.
+	maxPeerAddresses = 50
+	// minHandshakeSizeBytes and maxHandshakeSizeBytes bound the amount of data a
+	// server requests from the client before dialing an address with a different IP.
+	minHandshakeSizeBytes = 30_000
+	maxHandshakeSizeBytes = 100_000
+)
+
+var (
+	// ErrNoValidPeers is returned by GetReachability if none of the connected peers
+	// supports the AutoNAT v2 dial protocol.
+	ErrNoValidPeers = errors.New("no valid peers for autonat v2")
+	// ErrDialRefused is returned if the server refused to dial any of the addresses.
+	ErrDialRefused = errors.New("dial refused")
+	// ErrRequestRejected is returned if the server rejected the request, e.g. because
+	// of rate limiting.
+	ErrRequestRejected = errors.New("request rejected")
+)
+
+// Request is the request to verify the reachability of a single address.
+type Request struct {
+	// Addr is the address to verify.
+	Addr ma.Multiaddr
+	// SendDialData indicates whether the client is willing to send the data requested
+	// by the server for amplification attack prevention when testing this address.
+	SendDialData bool
+}
+
+// Result is the result of a reachability check.
+type Result struct {
+	// Idx is the index of the tested address in the list of requests.
+	Idx int
+	// Addr is the tested address.
+	Addr ma.Multiaddr
+	// Reachability is the reachability of Addr.
+	Reachability network.Reachability
+	// Status is the outcome of the dial-back as reported by the server.
+	Status pb.DialStatus
+}
+
+// AutoNAT implements both the client and the server of the AutoNAT v2 protocol.
+type AutoNAT struct {
+	host host.Host
+	cfg  *config
+
+	srv *server
+	cli *client
+
+	mx      sync.Mutex
+	started bool
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	wg        sync.WaitGroup
+
+	reachabilityMx        sync.Mutex
+	transportReachability map[string]network.Reachability
+	emitReachability      event.Emitter
+}
+
+// New creates a new AutoNAT v2 service for the host h.
+// If dialer is non-nil, the service also acts as a server and uses dialer to dial back
+// clients. The dialer must be a separate host with its own identity and network, so that
+// dial-backs don't reuse connections established by h.
+func New(h host.Host, dialer host.Host, opts ...Option) (*AutoNAT, error) {
+	cfg := defaultConfig()
+	for _, o := range opts {
+		if err := o(cfg); err != nil {
+			return nil, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
+	if cfg.addrFunc == nil {
+		cfg.addrFunc = h.Addrs
+	}
+
+	emitReachability, err := h.EventBus().Emitter(new(event.EvtTransportReachabilityChanged), eventbus.Stateful)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create emitter: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	an := &AutoNAT{
+		host:                  h,
+		cfg:                   cfg,
+		cli:                   newClient(h),
+		ctx:                   ctx,
+		ctxCancel:             cancel,
+		transportReachability: make(map[string]network.Reachability),
+		emitReachability:      emitReachability,
+	}
+	if dialer != nil {
+		if dialer.ID() == h.ID() || dialer.Network() == h.Network() {
+			cancel()
+			emitReachability.Close()
+			return nil, errors.New("dialer should not be that of the host")
+		}
+		an.srv = newServer(h, dialer, cfg)
+	}
+	return an, nil
+}
+
+// Start registers the AutoNAT v2 stream handlers with the host and starts tracking
+// the reachability of the host's transports.
+func (an *AutoNAT) Start() {
+	an.mx.Lock()
+	defer an.mx.Unlock()
+	if an.started || an.ctx.Err() != nil {
+		return
+	}
+	an.started = true
+	an.cli.Start()
+	if an.srv != nil {
+		an.srv.Start()
+	}
+	an.wg.Add(1)
+	go an.background()
+}
+
+// Close stops the AutoNAT v2 service and removes its stream handlers from the host.
+// It doesn't close the dialer passed to New. A closed service can't be restarted.
+func (an *AutoNAT) Close() error {
+	an.mx.Lock()
+	defer an.mx.Unlock()
+	if an.ctx.Err() != nil {
+		return nil
+	}
+	an.ctxCancel()
+	an.wg.Wait()
+	if an.started {
+		an.started = false
+		if an.srv != nil {
+			an.srv.Close()
+		}
+		an.cli.Close()
+	}
+	return an.emitReachability.Close()
+}
+
+// GetReachability asks a random connected AutoNAT v2 server to verify the reachability
+// of the requested addresses. The server tests at most one of them, preferring addresses
+// that appear earlier in reqs; the returned Result identifies the tested address.
+func (an *AutoNAT) GetReachability(ctx context.Context, reqs []Request) (Result, error) {
+	if len(reqs) == 0 {
+		return Result{}, errors.New("no addresses to check")
+	}
+	if len(reqs) > maxPeerAddresses {
+		return Result{}, fmt.Errorf("too many addresses: %d > %d", len(reqs), maxPeerAddresses)
+	}
+	if !an.cfg.allowPrivateAddrs {
+		for _, r := range reqs {
+			if !manet.IsPublicAddr(r.Addr) {
+				return Result{}, fmt.Errorf("private address cannot be verified by autonatv2: %s", r.Addr)
+			}
+		}
+	}
+
+	p := an.peerToProbe()
+	if p == "" {
+		return Result{}, ErrNoValidPeers
+	}
+	res, err := an.cli.GetReachability(ctx, p, reqs)
+	if err != nil {
+		log.Debugw("reachability check failed", "peer", p, "error", err)
+		return Result{}, fmt.Errorf("reachability check with %s failed: %w", p, err)
+	}
+	log.Debugw("reachability check completed", "peer", p, "addr", res.Addr, "reachability", res.Reachability)
+	return res, nil
+}
+
+func (an *AutoNAT) peerToProbe() peer.ID {
+	var candidates []peer.ID
+	for _, p := range an.host.Network().Peers() {
+		if protos, err := an.host.Peerstore().SupportsProtocols(p, DialProtocol); err != nil || len(protos) == 0 {
+			continue
+		}
+		candidates = append(candidates, p)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[mrand.Intn(len(candidates))]
+}
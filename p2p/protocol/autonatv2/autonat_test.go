@@ -0,0 +1,218 @@
+package autonatv2
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHost(t *testing.T) host.Host {
+	h := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func newTestServer(t *testing.T, opts ...Option) (host.Host, *AutoNAT) {
+	h := newTestHost(t)
+	dialer := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDialOnly))
+	t.Cleanup(func() { dialer.Close() })
+	an, err := New(h, dialer, append([]Option{allowPrivateAddrs}, opts...)...)
+	require.NoError(t, err)
+	an.Start()
+	t.Cleanup(func() { an.Close() })
+	return h, an
+}
+
+func newTestClient(t *testing.T, srv host.Host) (host.Host, *AutoNAT) {
+	h := newTestHost(t)
+	an, err := New(h, nil, allowPrivateAddrs)
+	require.NoError(t, err)
+	an.Start()
+	t.Cleanup(func() { an.Close() })
+
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: srv.ID(), Addrs: srv.Addrs()}))
+	// blank hosts don't run identify
+	require.NoError(t, h.Peerstore().AddProtocols(srv.ID(), DialProtocol))
+	return h, an
+}
+
+func TestGetReachability(t *testing.T) {
+	srv, _ := newTestServer(t)
+	cli, an := newTestClient(t, srv)
+
+	res, err := an.GetReachability(context.Background(), []Request{{Addr: cli.Addrs()[0]}})
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Idx)
+	require.Equal(t, network.ReachabilityPublic, res.Reachability)
+	require.Equal(t, pb.DialStatus_OK, res.Status)
+	require.True(t, res.Addr.Equal(cli.Addrs()[0]))
+
+	// the server only dials the first address it's willing to dial
+	circuit := ma.StringCast("/ip4/1.2.3.4/tcp/1/p2p/" + srv.ID().String() + "/p2p-circuit")
+	closed := ma.StringCast("/ip4/127.0.0.1/tcp/1")
+	res, err = an.GetReachability(context.Background(), []Request{{Addr: circuit}, {Addr: closed}, {Addr: cli.Addrs()[0]}})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Idx)
+	require.Equal(t, network.ReachabilityPrivate, res.Reachability)
+	require.Equal(t, pb.DialStatus_E_DIAL_ERROR, res.Status)
+
+	_, err = an.GetReachability(context.Background(), []Request{{Addr: circuit}})
+	require.ErrorIs(t, err, ErrDialRefused)
+	// WebTransport addresses can't be dialed without the certificate hashes
+	_, err = an.GetReachability(context.Background(), []Request{{Addr: ma.StringCast("/ip4/127.0.0.1/udp/1/quic-v1/webtransport")}})
+	require.ErrorIs(t, err, ErrDialRefused)
+}
+
+func TestGetReachabilityNoServer(t *testing.T) {
+	h := newTestHost(t)
+	an, err := New(h, nil)
+	require.NoError(t, err)
+	an.Start()
+	defer an.Close()
+
+	_, err = an.GetReachability(context.Background(), []Request{{Addr: ma.StringCast("/ip4/1.2.3.4/tcp/1")}})
+	require.ErrorIs(t, err, ErrNoValidPeers)
+	// private addresses can't be verified
+	_, err = an.GetReachability(context.Background(), []Request{{Addr: ma.StringCast("/ip4/127.0.0.1/tcp/1")}})
+	require.Error(t, err)
+}
+
+func TestDialData(t *testing.T) {
+	srv, _ := newTestServer(t, withDataRequestPolicy(func(network.Stream, ma.Multiaddr) bool { return true }))
+	cli, an := newTestClient(t, srv)
+
+	// the client refuses to send dial data unless the request allows it
+	_, err := an.GetReachability(context.Background(), []Request{{Addr: cli.Addrs()[0]}})
+	require.Error(t, err)
+
+	// the server may still be processing the reset request
+	var res Result
+	require.Eventually(t, func() bool {
+		res, err = an.GetReachability(context.Background(), []Request{{Addr: cli.Addrs()[0], SendDialData: true}})
+		return !errors.Is(err, ErrRequestRejected)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, network.ReachabilityPublic, res.Reachability)
+}
+
+func TestServerRateLimit(t *testing.T) {
+	srv, _ := newTestServer(t, WithServerRateLimit(10, 1, 10))
+	cli, an := newTestClient(t, srv)
+
+	_, err := an.GetReachability(context.Background(), []Request{{Addr: cli.Addrs()[0]}})
+	require.NoError(t, err)
+	_, err = an.GetReachability(context.Background(), []Request{{Addr: cli.Addrs()[0]}})
+	require.ErrorIs(t, err, ErrRequestRejected)
+}
+
+func TestTransportKey(t *testing.T) {
+	for addr, key := range map[string]string{
+		"/ip4/1.2.3.4/tcp/1":                           "ip4/tcp",
+		"/ip6/::1/udp/1/quic-v1":                       "ip6/udp/quic-v1",
+		"/dns4/example.com/udp/1/quic-v1/webtransport": "ip4/udp/quic-v1/webtransport",
+		"/dns/example.com/tcp/1/ws":                    "dns/tcp/ws",
+		"/ip4/1.2.3.4/udp/1/quic-v1/webtransport/certhash/uEiDDq4_xNyDorZBH3TlGazyJdOWSwvo4PUo5YHFMrvDE8g": "ip4/udp/quic-v1/webtransport",
+	} {
+		require.Equal(t, key, TransportKey(ma.StringCast(addr)), addr)
+	}
+}
+
+func TestTransportReachability(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	h := newTestHost(t)
+	unreachable := ma.StringCast("/ip6/::1/tcp/1")
+	an, err := New(h, nil,
+		allowPrivateAddrs,
+		WithoutStartupDelay(),
+		WithSchedule(50*time.Millisecond, time.Hour),
+		UsingAddresses(func() []ma.Multiaddr { return append(h.Addrs(), unreachable) }),
+	)
+	require.NoError(t, err)
+	defer an.Close()
+
+	sub, err := h.EventBus().Subscribe(new(event.EvtTransportReachabilityChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: srv.ID(), Addrs: srv.Addrs()}))
+	require.NoError(t, h.Peerstore().AddProtocols(srv.ID(), DialProtocol))
+	an.Start()
+
+	expected := map[string]network.Reachability{
+		"ip4/tcp": network.ReachabilityPublic,
+		"ip6/tcp": network.ReachabilityPrivate,
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-sub.Out():
+			if reflect.DeepEqual(expected, e.(event.EvtTransportReachabilityChanged).Reachability) {
+				require.Equal(t, expected, an.TransportReachability())
+				return
+			}
+		case <-timeout:
+			t.Fatalf("expected reachability %v, got %v", expected, an.TransportReachability())
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	r := &rateLimiter{RPM: 3, PerPeerRPM: 2, DialDataRPM: 1, now: func() time.Time { return now }}
+
+	require.True(t, r.Accept("peer1"))
+	// only a single request per peer may be in flight
+	require.False(t, r.Accept("peer1"))
+	r.CompleteRequest("peer1")
+	require.True(t, r.Accept("peer1"))
+	r.CompleteRequest("peer1")
+	require.False(t, r.Accept("peer1"))
+
+	require.True(t, r.Accept("peer2"))
+	r.CompleteRequest("peer2")
+	require.False(t, r.Accept("peer3"))
+
+	require.True(t, r.AcceptDialDataRequest())
+	require.False(t, r.AcceptDialDataRequest())
+
+	now = now.Add(time.Minute + time.Second)
+	require.True(t, r.Accept("peer3"))
+	require.True(t, r.Accept("peer1"))
+	require.True(t, r.AcceptDialDataRequest())
+}
+
+func TestNewResult(t *testing.T) {
+	addr := ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1")
+
+	// a successful dial-back must have been received
+	_, err := newResult(0, addr, pb.DialStatus_OK, nil)
+	require.Error(t, err)
+	// on the requested transport
+	_, err = newResult(0, addr, pb.DialStatus_OK, ma.StringCast("/ip4/192.168.1.1/tcp/1"))
+	require.Error(t, err)
+
+	res, err := newResult(0, addr, pb.DialStatus_OK, ma.StringCast("/ip4/192.168.1.1/udp/2/quic-v1"))
+	require.NoError(t, err)
+	require.Equal(t, network.ReachabilityPublic, res.Reachability)
+
+	res, err = newResult(0, addr, pb.DialStatus_E_DIAL_BACK_ERROR, nil)
+	require.NoError(t, err)
+	require.Equal(t, network.ReachabilityUnknown, res.Reachability)
+
+	_, err = newResult(0, addr, pb.DialStatus_UNUSED, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,283 @@
+package autonatv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+
+	"github.com/libp2p/go-msgio/pbio"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// dialDataChunkSize is the size of the DialDataResponse messages sent by the client.
+const dialDataChunkSize = 4000
+
+// client implements the client side of the AutoNAT v2 protocol.
+type client struct {
+	host     host.Host
+	dialData []byte
+
+	mu sync.Mutex
+	// dialBackQueues maps the nonce of a pending request to the channel on which the
+	// local address of the dial-back connection is delivered.
+	dialBackQueues map[uint64]chan ma.Multiaddr
+}
+
+func newClient(h host.Host) *client {
+	return &client{
+		host:           h,
+		dialData:       make([]byte, dialDataChunkSize),
+		dialBackQueues: make(map[uint64]chan ma.Multiaddr),
+	}
+}
+
+func (ac *client) Start() {
+	ac.host.SetStreamHandler(DialBackProtocol, ac.handleDialBack)
+}
+
+func (ac *client) Close() {
+	ac.host.RemoveStreamHandler(DialBackProtocol)
+}
+
+// GetReachability asks the server p to verify the reachability of one of the
+// requested addresses.
+func (ac *client) GetReachability(ctx context.Context, p peer.ID, reqs []Request) (Result, error) {
+	s, err := ac.host.NewStream(ctx, p, DialProtocol)
+	if err != nil {
+		return Result{}, fmt.Errorf("open %s stream failed: %w", DialProtocol, err)
+	}
+
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		s.Reset()
+		return Result{}, fmt.Errorf("attach stream %s to service %s failed: %w", DialProtocol, ServiceName, err)
+	}
+
+	if err := s.Scope().ReserveMemory(maxMsgSize, network.ReservationPriorityAlways); err != nil {
+		s.Reset()
+		return Result{}, fmt.Errorf("failed to reserve memory for stream %s: %w", DialProtocol, err)
+	}
+	defer s.Scope().ReleaseMemory(maxMsgSize)
+
+	s.SetDeadline(time.Now().Add(streamTimeout))
+	defer s.Close()
+
+	nonce := mrand.Uint64()
+	ch := make(chan ma.Multiaddr, 1)
+	ac.mu.Lock()
+	ac.dialBackQueues[nonce] = ch
+	ac.mu.Unlock()
+	defer func() {
+		ac.mu.Lock()
+		delete(ac.dialBackQueues, nonce)
+		ac.mu.Unlock()
+	}()
+
+	msg := newDialRequest(reqs, nonce)
+	w := pbio.NewDelimitedWriter(s)
+	if err := w.WriteMsg(&msg); err != nil {
+		s.Reset()
+		return Result{}, fmt.Errorf("dial request write failed: %w", err)
+	}
+
+	r := pbio.NewDelimitedReader(s, maxMsgSize)
+	if err := r.ReadMsg(&msg); err != nil {
+		s.Reset()
+		return Result{}, fmt.Errorf("dial msg read failed: %w", err)
+	}
+
+	if ddr := msg.GetDialDataRequest(); ddr != nil {
+		idx := int(ddr.GetAddrIdx())
+		if idx >= len(reqs) {
+			s.Reset()
+			return Result{}, fmt.Errorf("dial data requested for invalid address index %d", idx)
+		}
+		if !reqs[idx].SendDialData {
+			s.Reset()
+			return Result{}, fmt.Errorf("dial data requested for address %s without permission", reqs[idx].Addr)
+		}
+		if ddr.GetNumBytes() > maxHandshakeSizeBytes {
+			s.Reset()
+			return Result{}, fmt.Errorf("requested dial data too large: %d bytes", ddr.GetNumBytes())
+		}
+		if err := ac.sendDialData(w, int(ddr.GetNumBytes())); err != nil {
+			s.Reset()
+			return Result{}, fmt.Errorf("dial data send failed: %w", err)
+		}
+		if err := r.ReadMsg(&msg); err != nil {
+			s.Reset()
+			return Result{}, fmt.Errorf("dial response read failed: %w", err)
+		}
+	}
+
+	resp := msg.GetDialResponse()
+	if resp == nil {
+		s.Reset()
+		return Result{}, fmt.Errorf("invalid response type: %T", msg.Msg)
+	}
+
+	switch resp.GetStatus() {
+	case pb.DialResponse_OK:
+	case pb.DialResponse_E_REQUEST_REJECTED:
+		return Result{}, ErrRequestRejected
+	case pb.DialResponse_E_DIAL_REFUSED:
+		return Result{}, ErrDialRefused
+	default:
+		return Result{}, fmt.Errorf("dial request failed: response status %s", resp.GetStatus())
+	}
+
+	idx := int(resp.GetAddrIdx())
+	if idx >= len(reqs) {
+		return Result{}, fmt.Errorf("invalid address index %d in response", idx)
+	}
+	addr := reqs[idx].Addr
+
+	var dialBackAddr ma.Multiaddr
+	select {
+	case dialBackAddr = <-ch:
+	default:
+	}
+	return newResult(idx, addr, resp.GetDialStatus(), dialBackAddr)
+}
+
+// newResult converts the server's dial status into a Result. A claimed successful dial
+// is only trusted if we actually received the dial-back.
+func newResult(idx int, addr ma.Multiaddr, status pb.DialStatus, dialBackAddr ma.Multiaddr) (Result, error) {
+	var rch network.Reachability
+	switch status {
+	case pb.DialStatus_OK:
+		if dialBackAddr == nil {
+			return Result{}, errors.New("server reported a successful dial-back that was not received")
+		}
+		if !sameTransport(addr, dialBackAddr) {
+			return Result{}, fmt.Errorf("dial-back received on %s, not on the requested transport of %s", dialBackAddr, addr)
+		}
+		rch = network.ReachabilityPublic
+	case pb.DialStatus_E_DIAL_ERROR:
+		rch = network.ReachabilityPrivate
+	case pb.DialStatus_E_DIAL_BACK_ERROR:
+		rch = network.ReachabilityUnknown
+	default:
+		return Result{}, fmt.Errorf("invalid dial status %s", status)
+	}
+	return Result{Idx: idx, Addr: addr, Reachability: rch, Status: status}, nil
+}
+
+func (ac *client) sendDialData(w pbio.Writer, numBytes int) error {
+	msg := pb.Message{
+		Msg: &pb.Message_DialDataResponse{
+			DialDataResponse: &pb.DialDataResponse{},
+		},
+	}
+	for remain := numBytes; remain > 0; {
+		n := len(ac.dialData)
+		if remain < n {
+			n = remain
+		}
+		msg.GetDialDataResponse().Data = ac.dialData[:n]
+		if err := w.WriteMsg(&msg); err != nil {
+			return err
+		}
+		remain -= n
+	}
+	return nil
+}
+
+func (ac *client) handleDialBack(s network.Stream) {
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("failed to attach stream to service %s: %s", ServiceName, err)
+		s.Reset()
+		return
+	}
+
+	if err := s.Scope().ReserveMemory(dialBackMaxMsgSize, network.ReservationPriorityAlways); err != nil {
+		log.Debugf("failed to reserve memory for stream %s: %s", DialBackProtocol, err)
+		s.Reset()
+		return
+	}
+	defer s.Scope().ReleaseMemory(dialBackMaxMsgSize)
+
+	s.SetDeadline(time.Now().Add(dialBackStreamTimeout))
+	defer s.Close()
+
+	r := pbio.NewDelimitedReader(s, dialBackMaxMsgSize)
+	var msg pb.DialBack
+	if err := r.ReadMsg(&msg); err != nil {
+		log.Debugf("failed to read dialback msg from %s: %s", s.Conn().RemotePeer(), err)
+		s.Reset()
+		return
+	}
+
+	ac.mu.Lock()
+	ch, ok := ac.dialBackQueues[msg.GetNonce()]
+	ac.mu.Unlock()
+	if !ok {
+		log.Debugf("dialback received with invalid nonce from %s", s.Conn().RemoteMultiaddr())
+		s.Reset()
+		return
+	}
+	select {
+	case ch <- s.Conn().LocalMultiaddr():
+	default:
+	}
+
+	w := pbio.NewDelimitedWriter(s)
+	res := pb.DialBackResponse{Status: pb.DialBackResponse_OK}
+	if err := w.WriteMsg(&res); err != nil {
+		log.Debugf("failed to write dialback response: %s", err)
+		s.Reset()
+	}
+}
+
+func newDialRequest(reqs []Request, nonce uint64) pb.Message {
+	addrs := make([][]byte, len(reqs))
+	for i, r := range reqs {
+		addrs[i] = r.Addr.Bytes()
+	}
+	return pb.Message{
+		Msg: &pb.Message_DialRequest{
+			DialRequest: &pb.DialRequest{
+				Addrs: addrs,
+				Nonce: nonce,
+			},
+		},
+	}
+}
+
+// sameTransport reports whether a and b use the same transport stack. IP addresses,
+// ports and peer IDs are ignored, since the local address of a dial-back connection
+// differs from the tested address when the node is behind a NAT or port mapping.
+func sameTransport(a, b ma.Multiaddr) bool {
+	ca, cb := transportCodes(a), transportCodes(b)
+	if len(ca) != len(cb) {
+		return false
+	}
+	for i := range ca {
+		if ca[i] != cb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func transportCodes(a ma.Multiaddr) []int {
+	var codes []int
+	for i, p := range a.Protocols() {
+		switch {
+		case i == 0:
+			// ip4, ip6 and dns addresses can all be dialed the same way
+		case p.Code == ma.P_P2P || p.Code == ma.P_CERTHASH:
+		default:
+			codes = append(codes, p.Code)
+		}
+	}
+	return codes
+}
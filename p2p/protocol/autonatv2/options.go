@@ -0,0 +1,131 @@
+package autonatv2
+
+import (
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// config holds the configuration of the AutoNAT v2 service.
+type config struct {
+	allowPrivateAddrs bool
+
+	// client
+	addrFunc        func() []ma.Multiaddr
+	bootDelay       time.Duration
+	retryInterval   time.Duration
+	refreshInterval time.Duration
+	requestTimeout  time.Duration
+
+	// server
+
+	serverRPM         int
+	serverPerPeerRPM  int
+	serverDialDataRPM int
+
+	dataRequestPolicy dataRequestPolicyFunc
+	now               func() time.Time
+}
+
+func defaultConfig() *config {
+	return &config{
+		bootDelay:         15 * time.Second,
+		retryInterval:     90 * time.Second,
+		refreshInterval:   15 * time.Minute,
+		requestTimeout:    time.Minute,
+		serverRPM:         60,
+		serverPerPeerRPM:  12,
+		serverDialDataRPM: 12,
+		dataRequestPolicy: amplificationAttackPrevention,
+		now:               time.Now,
+	}
+}
+
+// dataRequestPolicyFunc decides whether the server asks the client for dial data before
+// dialing addr.
+type dataRequestPolicyFunc func(s network.Stream, addr ma.Multiaddr) bool
+
+// Option is an AutoNAT v2 option for configuration.
+type Option func(*config) error
+
+// UsingAddresses overrides the addresses whose reachability is tracked. By default,
+// the host's addresses are used.
+func UsingAddresses(addrFunc func() []ma.Multiaddr) Option {
+	return func(c *config) error {
+		if addrFunc == nil {
+			return errors.New("invalid address function supplied")
+		}
+		c.addrFunc = addrFunc
+		return nil
+	}
+}
+
+// WithSchedule configures how often the reachability of the host's transports is
+// checked. retryInterval is used while the reachability of any transport is unknown,
+// refreshInterval once the reachability of all transports is known.
+func WithSchedule(retryInterval, refreshInterval time.Duration) Option {
+	return func(c *config) error {
+		if retryInterval <= 0 || refreshInterval <= 0 {
+			return errors.New("intervals must be positive")
+		}
+		c.retryInterval = retryInterval
+		c.refreshInterval = refreshInterval
+		return nil
+	}
+}
+
+// WithoutStartupDelay removes the initial delay before the reachability of the
+// host's transports is first checked, which otherwise gives the host time to
+// connect to some AutoNAT v2 servers.
+func WithoutStartupDelay() Option {
+	return func(c *config) error {
+		c.bootDelay = 0
+		return nil
+	}
+}
+
+// WithServerRateLimit sets the maximum number of requests the server serves per
+// minute, both in total and per peer, and the maximum number of requests per minute
+// for which it asks clients for dial data.
+func WithServerRateLimit(rpm, perPeerRPM, dialDataRPM int) Option {
+	return func(c *config) error {
+		if rpm <= 0 || perPeerRPM <= 0 || dialDataRPM <= 0 {
+			return errors.New("rate limits must be positive")
+		}
+		c.serverRPM = rpm
+		c.serverPerPeerRPM = perPeerRPM
+		c.serverDialDataRPM = dialDataRPM
+		return nil
+	}
+}
+
+// allowPrivateAddrs allows testing and dialing back private addresses. Only used in tests.
+func allowPrivateAddrs(c *config) error {
+	c.allowPrivateAddrs = true
+	return nil
+}
+
+func withDataRequestPolicy(policy dataRequestPolicyFunc) Option {
+	return func(c *config) error {
+		c.dataRequestPolicy = policy
+		return nil
+	}
+}
+
+// amplificationAttackPrevention requests dial data if the IP of the address to dial
+// differs from the IP the client is connected from.
+func amplificationAttackPrevention(s network.Stream, addr ma.Multiaddr) bool {
+	connIP, err := manet.ToIP(s.Conn().RemoteMultiaddr())
+	if err != nil {
+		return true
+	}
+	dialIP, err := manet.ToIP(addr)
+	if err != nil {
+		return true
+	}
+	return !connIP.Equal(dialIP)
+}
@@ -0,0 +1,353 @@
+package autonatv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/net/addrutil"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+
+	"github.com/libp2p/go-msgio/pbio"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// server implements the server side of the AutoNAT v2 protocol.
+type server struct {
+	host       host.Host
+	dialerHost host.Host
+	limiter    *rateLimiter
+
+	dataRequestPolicy dataRequestPolicyFunc
+	allowPrivateAddrs bool
+}
+
+func newServer(h, dialer host.Host, cfg *config) *server {
+	return &server{
+		host:       h,
+		dialerHost: dialer,
+		limiter: &rateLimiter{
+			RPM:         cfg.serverRPM,
+			PerPeerRPM:  cfg.serverPerPeerRPM,
+			DialDataRPM: cfg.serverDialDataRPM,
+			now:         cfg.now,
+		},
+		dataRequestPolicy: cfg.dataRequestPolicy,
+		allowPrivateAddrs: cfg.allowPrivateAddrs,
+	}
+}
+
+func (as *server) Start() {
+	as.host.SetStreamHandler(DialProtocol, as.handleDialRequest)
+}
+
+func (as *server) Close() {
+	as.host.RemoveStreamHandler(DialProtocol)
+}
+
+func (as *server) handleDialRequest(s network.Stream) {
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("failed to attach stream to service %s: %s", ServiceName, err)
+		s.Reset()
+		return
+	}
+
+	if err := s.Scope().ReserveMemory(maxMsgSize, network.ReservationPriorityAlways); err != nil {
+		log.Debugf("failed to reserve memory for stream %s: %s", DialProtocol, err)
+		s.Reset()
+		return
+	}
+	defer s.Scope().ReleaseMemory(maxMsgSize)
+
+	s.SetDeadline(time.Now().Add(streamTimeout))
+	defer s.Close()
+
+	p := s.Conn().RemotePeer()
+	w := pbio.NewDelimitedWriter(s)
+
+	if !as.limiter.Accept(p) {
+		msg := newDialResponse(pb.DialResponse_E_REQUEST_REJECTED, 0, pb.DialStatus_UNUSED)
+		if err := w.WriteMsg(&msg); err != nil {
+			s.Reset()
+			log.Debugf("failed to write request rejected response to %s: %s", p, err)
+		}
+		return
+	}
+	defer as.limiter.CompleteRequest(p)
+
+	r := pbio.NewDelimitedReader(s, maxMsgSize)
+	var msg pb.Message
+	if err := r.ReadMsg(&msg); err != nil {
+		s.Reset()
+		log.Debugf("failed to read request from %s: %s", p, err)
+		return
+	}
+	req := msg.GetDialRequest()
+	if req == nil {
+		s.Reset()
+		log.Debugf("invalid message type from %s: %T expected: DialRequest", p, msg.Msg)
+		return
+	}
+
+	// pick the first address we're willing to dial
+	var dialAddr ma.Multiaddr
+	var addrIdx int
+	for i, ab := range req.GetAddrs() {
+		if i >= maxPeerAddresses {
+			break
+		}
+		a, err := ma.NewMultiaddrBytes(ab)
+		if err != nil {
+			continue
+		}
+		if as.canDial(a) {
+			dialAddr = a
+			addrIdx = i
+			break
+		}
+	}
+
+	if dialAddr == nil {
+		msg = newDialResponse(pb.DialResponse_E_DIAL_REFUSED, 0, pb.DialStatus_UNUSED)
+		if err := w.WriteMsg(&msg); err != nil {
+			s.Reset()
+			log.Debugf("failed to write dial refused response to %s: %s", p, err)
+		}
+		return
+	}
+
+	nonce := req.GetNonce()
+	if as.dataRequestPolicy(s, dialAddr) {
+		if !as.limiter.AcceptDialDataRequest() {
+			msg = newDialResponse(pb.DialResponse_E_REQUEST_REJECTED, 0, pb.DialStatus_UNUSED)
+			if err := w.WriteMsg(&msg); err != nil {
+				s.Reset()
+				log.Debugf("failed to write request rejected response to %s: %s", p, err)
+			}
+			return
+		}
+		if err := getDialData(w, r, &msg, addrIdx); err != nil {
+			s.Reset()
+			log.Debugf("%s refused dial data request: %s", p, err)
+			return
+		}
+	}
+
+	dialStatus := as.dialBack(s.Conn().RemotePeer(), dialAddr, nonce)
+	// Complete the request before responding, so that the client can send its next
+	// request as soon as it has received the response.
+	as.limiter.CompleteRequest(p)
+	msg = newDialResponse(pb.DialResponse_OK, addrIdx, dialStatus)
+	if err := w.WriteMsg(&msg); err != nil {
+		s.Reset()
+		log.Debugf("failed to write response to %s: %s", p, err)
+	}
+}
+
+// canDial reports whether the server is willing and able to dial a.
+func (as *server) canDial(a ma.Multiaddr) bool {
+	type transportForDialinger interface {
+		TransportForDialing(a ma.Multiaddr) transport.Transport
+	}
+
+	if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+		return false
+	}
+	if !as.allowPrivateAddrs && !manet.IsPublicAddr(a) {
+		return false
+	}
+	if _, err := manet.ToIP(a); err != nil {
+		return false
+	}
+	if addrutil.MissingCertHash(a) {
+		return false
+	}
+	if s, ok := as.dialerHost.Network().(transportForDialinger); ok {
+		return s.TransportForDialing(a) != nil
+	}
+	return true
+}
+
+// getDialData requests numBytes of data from the client and reads it.
+func getDialData(w pbio.Writer, r pbio.Reader, msg *pb.Message, addrIdx int) error {
+	numBytes := minHandshakeSizeBytes + mrand.Intn(maxHandshakeSizeBytes-minHandshakeSizeBytes)
+	*msg = pb.Message{
+		Msg: &pb.Message_DialDataRequest{
+			DialDataRequest: &pb.DialDataRequest{
+				AddrIdx:  uint32(addrIdx),
+				NumBytes: uint64(numBytes),
+			},
+		},
+	}
+	if err := w.WriteMsg(msg); err != nil {
+		return fmt.Errorf("dial data request write failed: %w", err)
+	}
+
+	for remain := numBytes; remain > 0; {
+		if err := r.ReadMsg(msg); err != nil {
+			return fmt.Errorf("dial data read failed: %w", err)
+		}
+		resp := msg.GetDialDataResponse()
+		if resp == nil {
+			return fmt.Errorf("invalid message type %T, expected DialDataResponse", msg.Msg)
+		}
+		if len(resp.Data) == 0 {
+			return errors.New("empty dial data response")
+		}
+		remain -= len(resp.Data)
+	}
+	return nil
+}
+
+// dialBack dials addr from the dialer host and sends the nonce on a dial-back stream.
+func (as *server) dialBack(p peer.ID, addr ma.Multiaddr, nonce uint64) pb.DialStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), dialBackDialTimeout)
+	ctx = network.WithForceDirectDial(ctx, "autonatv2")
+	defer cancel()
+
+	ps := as.dialerHost.Peerstore()
+	ps.AddAddr(p, addr, peerstore.TempAddrTTL)
+	defer func() {
+		as.dialerHost.Network().ClosePeer(p)
+		ps.ClearAddrs(p)
+		ps.RemovePeer(p)
+	}()
+
+	if err := as.dialerHost.Connect(ctx, peer.AddrInfo{ID: p}); err != nil {
+		log.Debugf("dial-back to %s on %s failed: %s", p, addr, err)
+		return pb.DialStatus_E_DIAL_ERROR
+	}
+
+	s, err := as.dialerHost.NewStream(ctx, p, DialBackProtocol)
+	if err != nil {
+		return pb.DialStatus_E_DIAL_BACK_ERROR
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(dialBackStreamTimeout))
+
+	w := pbio.NewDelimitedWriter(s)
+	if err := w.WriteMsg(&pb.DialBack{Nonce: nonce}); err != nil {
+		s.Reset()
+		return pb.DialStatus_E_DIAL_BACK_ERROR
+	}
+
+	// Wait for the client to acknowledge the nonce, so that the dial-back has been
+	// processed before the client receives the response on the dial stream.
+	r := pbio.NewDelimitedReader(s, dialBackMaxMsgSize)
+	var res pb.DialBackResponse
+	if err := r.ReadMsg(&res); err != nil || res.GetStatus() != pb.DialBackResponse_OK {
+		s.Reset()
+		return pb.DialStatus_E_DIAL_BACK_ERROR
+	}
+	return pb.DialStatus_OK
+}
+
+func newDialResponse(status pb.DialResponse_ResponseStatus, addrIdx int, dialStatus pb.DialStatus) pb.Message {
+	return pb.Message{
+		Msg: &pb.Message_DialResponse{
+			DialResponse: &pb.DialResponse{
+				Status:     status,
+				AddrIdx:    uint32(addrIdx),
+				DialStatus: dialStatus,
+			},
+		},
+	}
+}
+
+// rateLimiter limits the requests served by the server over a sliding window of one
+// minute. Every peer may only have a single request in flight.
+type rateLimiter struct {
+	// PerPeerRPM is the maximum number of requests per minute per peer.
+	PerPeerRPM int
+	// RPM is the maximum number of requests per minute across all peers.
+	RPM int
+	// DialDataRPM is the maximum number of requests per minute that require dial data.
+	DialDataRPM int
+
+	now func() time.Time
+
+	mu           sync.Mutex
+	reqs         []time.Time
+	peerReqs     map[peer.ID][]time.Time
+	dialDataReqs []time.Time
+	ongoingReqs  map[peer.ID]struct{}
+}
+
+// Accept reports whether a request from p may be served. If so, the caller must call
+// CompleteRequest once done.
+func (r *rateLimiter) Accept(p peer.ID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.peerReqs == nil {
+		r.peerReqs = make(map[peer.ID][]time.Time)
+		r.ongoingReqs = make(map[peer.ID]struct{})
+	}
+
+	now := r.now()
+	r.cleanup(now)
+	if _, ok := r.ongoingReqs[p]; ok {
+		return false
+	}
+	if len(r.reqs) >= r.RPM || len(r.peerReqs[p]) >= r.PerPeerRPM {
+		return false
+	}
+
+	r.ongoingReqs[p] = struct{}{}
+	r.reqs = append(r.reqs, now)
+	r.peerReqs[p] = append(r.peerReqs[p], now)
+	return true
+}
+
+// AcceptDialDataRequest reports whether the server may ask for dial data.
+func (r *rateLimiter) AcceptDialDataRequest() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	r.cleanup(now)
+	if len(r.dialDataReqs) >= r.DialDataRPM {
+		return false
+	}
+	r.dialDataReqs = append(r.dialDataReqs, now)
+	return true
+}
+
+// CompleteRequest marks the request from p as done. It may be called multiple times.
+func (r *rateLimiter) CompleteRequest(p peer.ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.ongoingReqs, p)
+}
+
+// cleanup removes the requests older than one minute.
+func (r *rateLimiter) cleanup(now time.Time) {
+	minute := now.Add(-time.Minute)
+	r.reqs = trimBefore(r.reqs, minute)
+	r.dialDataReqs = trimBefore(r.dialDataReqs, minute)
+	for p, reqs := range r.peerReqs {
+		reqs = trimBefore(reqs, minute)
+		if len(reqs) == 0 {
+			delete(r.peerReqs, p)
+			continue
+		}
+		r.peerReqs[p] = reqs
+	}
+}
+
+// trimBefore removes the timestamps before t from the sorted slice ts.
+func trimBefore(ts []time.Time, t time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && ts[i].Before(t) {
+		i++
+	}
+	return ts[i:]
+}
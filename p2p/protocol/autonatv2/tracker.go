@@ -0,0 +1,198 @@
+package autonatv2
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// addrChangeDelay is the delay after an address change before the reachability of
+// the new addresses is checked, allowing a burst of changes to settle.
+const addrChangeDelay = time.Second
+
+// TransportKey returns the transport of the address a, as used to key the reachability
+// of the host's transports: the address family followed by the names of the remaining
+// protocols, e.g. "ip4/tcp" or "ip6/udp/quic-v1". DNS addresses are keyed by the
+// address family they resolve to, if known.
+func TransportKey(a ma.Multiaddr) string {
+	var sb strings.Builder
+	for i, p := range a.Protocols() {
+		name := p.Name
+		switch {
+		case i == 0 && p.Code == ma.P_DNS4:
+			name = "ip4"
+		case i == 0 && p.Code == ma.P_DNS6:
+			name = "ip6"
+		case p.Code == ma.P_P2P || p.Code == ma.P_CERTHASH:
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('/')
+		}
+		sb.WriteString(name)
+	}
+	return sb.String()
+}
+
+// TransportReachability returns the reachability of each of the host's transports,
+// keyed by TransportKey.
+func (an *AutoNAT) TransportReachability() map[string]network.Reachability {
+	an.reachabilityMx.Lock()
+	defer an.reachabilityMx.Unlock()
+	return copyReachability(an.transportReachability)
+}
+
+func copyReachability(m map[string]network.Reachability) map[string]network.Reachability {
+	c := make(map[string]network.Reachability, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func (an *AutoNAT) background() {
+	defer an.wg.Done()
+
+	sub, err := an.host.EventBus().Subscribe(new(event.EvtLocalAddressesUpdated), eventbus.Name("autonatv2"))
+	if err != nil {
+		log.Errorf("failed to subscribe to address updates: %s", err)
+		return
+	}
+	defer sub.Close()
+
+	timer := time.NewTimer(an.cfg.bootDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			timer.Reset(an.probeTransports(an.ctx))
+		case <-sub.Out():
+			an.updateTransports(an.groupAddrs())
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(addrChangeDelay)
+		case <-an.ctx.Done():
+			return
+		}
+	}
+}
+
+// groupAddrs returns the addresses whose reachability can be checked, grouped by transport.
+func (an *AutoNAT) groupAddrs() map[string][]ma.Multiaddr {
+	groups := make(map[string][]ma.Multiaddr)
+	for _, a := range an.cfg.addrFunc() {
+		if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+			continue
+		}
+		if !an.cfg.allowPrivateAddrs && !manet.IsPublicAddr(a) {
+			continue
+		}
+		k := TransportKey(a)
+		groups[k] = append(groups[k], a)
+	}
+	return groups
+}
+
+// updateTransports adds the transports of groups with unknown reachability and removes
+// the transports that aren't in use any more.
+func (an *AutoNAT) updateTransports(groups map[string][]ma.Multiaddr) {
+	an.reachabilityMx.Lock()
+	defer an.reachabilityMx.Unlock()
+	updated := make(map[string]network.Reachability, len(groups))
+	for k := range groups {
+		r, ok := an.transportReachability[k]
+		if !ok {
+			r = network.ReachabilityUnknown
+		}
+		updated[k] = r
+	}
+	an.setTransportReachabilityLocked(updated)
+}
+
+// probeTransports checks the reachability of every transport in use, and returns the
+// delay until the next check.
+func (an *AutoNAT) probeTransports(ctx context.Context) time.Duration {
+	groups := an.groupAddrs()
+	an.updateTransports(groups)
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	results := make(map[string]network.Reachability, len(keys))
+	for _, k := range keys {
+		reqs := make([]Request, 0, len(groups[k]))
+		for _, a := range groups[k] {
+			reqs = append(reqs, Request{Addr: a, SendDialData: true})
+			if len(reqs) == maxPeerAddresses {
+				break
+			}
+		}
+
+		rctx, cancel := context.WithTimeout(ctx, an.cfg.requestTimeout)
+		res, err := an.GetReachability(rctx, reqs)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, ErrNoValidPeers) {
+				break
+			}
+			continue
+		}
+		results[k] = res.Reachability
+	}
+
+	an.reachabilityMx.Lock()
+	updated := copyReachability(an.transportReachability)
+	for k, r := range results {
+		if _, ok := updated[k]; ok {
+			updated[k] = r
+		}
+	}
+	an.setTransportReachabilityLocked(updated)
+	unknown := false
+	for _, r := range updated {
+		if r == network.ReachabilityUnknown {
+			unknown = true
+		}
+	}
+	an.reachabilityMx.Unlock()
+
+	if unknown {
+		return an.cfg.retryInterval
+	}
+	return an.cfg.refreshInterval
+}
+
+// setTransportReachabilityLocked replaces the reachability map and emits an event if it
+// changed. It must be called with reachabilityMx held.
+func (an *AutoNAT) setTransportReachabilityLocked(updated map[string]network.Reachability) {
+	changed := len(updated) != len(an.transportReachability)
+	for k, r := range updated {
+		if old, ok := an.transportReachability[k]; !ok || old != r {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	an.transportReachability = updated
+	log.Debugw("transport reachability changed", "reachability", updated)
+	if err := an.emitReachability.Emit(event.EvtTransportReachabilityChanged{Reachability: copyReachability(updated)}); err != nil {
+		log.Debugf("failed to emit transport reachability event: %s", err)
+	}
+}
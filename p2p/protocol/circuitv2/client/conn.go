@@ -24,6 +24,23 @@ var (
 	StatLimitData     = statLimitData{}
 )
 
+// ConnLimit returns the limits the relay applies to the relayed connection c: the
+// duration after which the relay resets the connection, and the number of bytes it
+// relays in each direction before doing so. ok is false if c isn't a relayed
+// connection, or if the relay doesn't limit it.
+func ConnLimit(c network.Conn) (duration time.Duration, data uint64, ok bool) {
+	stat := c.Stat()
+	if stat.Extra == nil {
+		return 0, 0, false
+	}
+	duration, ok = stat.Extra[StatLimitDuration].(time.Duration)
+	if !ok {
+		return 0, 0, false
+	}
+	data, _ = stat.Extra[StatLimitData].(uint64)
+	return duration, data, true
+}
+
 type Conn struct {
 	stream network.Stream
 	remote peer.AddrInfo
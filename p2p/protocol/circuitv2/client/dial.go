@@ -118,7 +118,8 @@ func (c *Client) dialPeer(ctx context.Context, relay, dest peer.AddrInfo) (*Conn
 	log.Debugf("dialing peer %s through relay %s", dest.ID, relay.ID)
 
 	if len(relay.Addrs) > 0 {
-		c.host.Peerstore().AddAddrs(relay.ID, relay.Addrs, peerstore.TempAddrTTL)
+		// we learned the addresses of the relay from a relay address of the destination
+		peerstore.AddAddrsWithSource(c.host.Peerstore(), relay.ID, relay.Addrs, peerstore.TempAddrTTL, peerstore.AddrSourceRelay)
 	}
 
 	dialCtx, cancel := context.WithTimeout(ctx, DialRelayTimeout)
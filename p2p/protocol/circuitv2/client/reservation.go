@@ -8,7 +8,6 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
-	"github.com/libp2p/go-libp2p/core/record"
 	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
@@ -35,6 +34,9 @@ type Reservation struct {
 
 	// Voucher is a signed reservation voucher provided by the relay
 	Voucher *proto.ReservationVoucher
+	// SignedVoucher is the signed envelope containing Voucher. It can be presented to
+	// third parties as a proof of the reservation, see proto.VerifyVoucher.
+	SignedVoucher []byte
 }
 
 // ReservationError is the error returned on failure to reserve a slot in the relay
@@ -62,7 +64,7 @@ func (re ReservationError) Unwrap() error {
 // Clients must reserve slots in order for the relay to relay connections to them.
 func Reserve(ctx context.Context, h host.Host, ai peer.AddrInfo) (*Reservation, error) {
 	if len(ai.Addrs) > 0 {
-		h.Peerstore().AddAddrs(ai.ID, ai.Addrs, peerstore.TempAddrTTL)
+		peerstore.AddAddrsWithSource(h.Peerstore(), ai.ID, ai.Addrs, peerstore.TempAddrTTL, peerstore.AddrSourceManual)
 	}
 
 	s, err := h.NewStream(ctx, ai.ID, proto.ProtoIDv2Hop)
@@ -130,23 +132,16 @@ func Reserve(ctx context.Context, h host.Host, ai peer.AddrInfo) (*Reservation,
 
 	voucherBytes := rsvp.GetVoucher()
 	if voucherBytes != nil {
-		_, rec, err := record.ConsumeEnvelope(voucherBytes, proto.RecordDomain)
+		voucher, err := proto.VerifyVoucher(voucherBytes, ai.ID, h.ID(), time.Now())
 		if err != nil {
 			return nil, ReservationError{
 				Status: pbv2.Status_MALFORMED_MESSAGE,
-				Reason: fmt.Sprintf("error consuming voucher envelope: %s", err),
+				Reason: err.Error(),
 				err:    err,
 			}
 		}
-
-		voucher, ok := rec.(*proto.ReservationVoucher)
-		if !ok {
-			return nil, ReservationError{
-				Status: pbv2.Status_MALFORMED_MESSAGE,
-				Reason: fmt.Sprintf("unexpected voucher record type: %+T", rec),
-			}
-		}
 		result.Voucher = voucher
+		result.SignedVoucher = voucherBytes
 	}
 
 	limit := msg.GetLimit()
@@ -1,6 +1,8 @@
 package proto
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -15,6 +17,10 @@ const RecordDomain = "libp2p-relay-rsvp"
 // TODO: register in multicodec table in https://github.com/multiformats/multicodec
 var RecordCodec = []byte{0x03, 0x02}
 
+// ErrInvalidVoucher is returned by VerifyVoucher if a voucher is not a valid proof of
+// a reservation.
+var ErrInvalidVoucher = errors.New("invalid reservation voucher")
+
 func init() {
 	record.RegisterType(&ReservationVoucher{})
 }
@@ -67,3 +73,40 @@ func (rv *ReservationVoucher) UnmarshalRecord(blob []byte) error {
 	rv.Expiration = time.Unix(int64(pbrv.GetExpiration()), 0)
 	return nil
 }
+
+// VerifyVoucher verifies the signed reservation voucher envelope blob, as obtained by a
+// client with its reservation, and returns the voucher. It checks that the voucher
+// was signed by relay, that it was issued to peer p, and that the reservation
+// hasn't expired by now.
+//
+// This lets any peer holding the voucher confirm that p has a reservation with relay,
+// without contacting the relay.
+func VerifyVoucher(blob []byte, relay, p peer.ID, now time.Time) (*ReservationVoucher, error) {
+	envelope, rec, err := record.ConsumeEnvelope(blob, RecordDomain)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming voucher envelope: %w", err)
+	}
+
+	rv, ok := rec.(*ReservationVoucher)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected record type: %+T", ErrInvalidVoucher, rec)
+	}
+
+	signer, err := peer.IDFromPublicKey(envelope.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signer key: %s", ErrInvalidVoucher, err)
+	}
+	if signer != rv.Relay {
+		return nil, fmt.Errorf("%w: signed by %s instead of the relay %s", ErrInvalidVoucher, signer, rv.Relay)
+	}
+	if rv.Relay != relay {
+		return nil, fmt.Errorf("%w: issued by relay %s instead of %s", ErrInvalidVoucher, rv.Relay, relay)
+	}
+	if rv.Peer != p {
+		return nil, fmt.Errorf("%w: issued to %s instead of %s", ErrInvalidVoucher, rv.Peer, p)
+	}
+	if !now.Before(rv.Expiration) {
+		return nil, fmt.Errorf("%w: expired at %s", ErrInvalidVoucher, rv.Expiration)
+	}
+	return rv, nil
+}
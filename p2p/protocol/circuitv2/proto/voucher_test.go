@@ -66,3 +66,58 @@ func TestReservationVoucher(t *testing.T) {
 		t.Fatal("expirations don't match")
 	}
 }
+
+func TestVerifyVoucher(t *testing.T) {
+	newID := func() (crypto.PrivKey, peer.ID) {
+		priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := peer.IDFromPrivateKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return priv, id
+	}
+	relayPriv, relayID := newID()
+	otherPriv, otherID := newID()
+	_, peerID := newID()
+
+	expiration := time.Now().Add(time.Hour)
+	seal := func(rv *ReservationVoucher, priv crypto.PrivKey) []byte {
+		envelope, err := record.Seal(rv, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob, err := envelope.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blob
+	}
+	valid := seal(&ReservationVoucher{Relay: relayID, Peer: peerID, Expiration: expiration}, relayPriv)
+
+	rv, err := VerifyVoucher(valid, relayID, peerID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rv.Relay != relayID || rv.Peer != peerID || rv.Expiration.Unix() != expiration.Unix() {
+		t.Fatalf("unexpected voucher: %+v", rv)
+	}
+
+	for name, tc := range map[string]struct {
+		blob        []byte
+		relay, peer peer.ID
+		now         time.Time
+	}{
+		"wrong relay":   {blob: valid, relay: otherID, peer: peerID, now: time.Now()},
+		"wrong peer":    {blob: valid, relay: relayID, peer: otherID, now: time.Now()},
+		"expired":       {blob: valid, relay: relayID, peer: peerID, now: expiration.Add(time.Second)},
+		"forged":        {blob: seal(&ReservationVoucher{Relay: relayID, Peer: peerID, Expiration: expiration}, otherPriv), relay: relayID, peer: peerID, now: time.Now()},
+		"not a voucher": {blob: []byte("foobar"), relay: relayID, peer: peerID, now: time.Now()},
+	} {
+		if _, err := VerifyVoucher(tc.blob, tc.relay, tc.peer, tc.now); err == nil {
+			t.Fatalf("%s: expected voucher verification to fail", name)
+		}
+	}
+}
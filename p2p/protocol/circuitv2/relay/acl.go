@@ -1,7 +1,11 @@
 package relay
 
 import (
+	"net"
+	"sync"
+
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/internal/peermatch"
 
 	ma "github.com/multiformats/go-multiaddr"
 )
@@ -15,3 +19,102 @@ type ACLFilter interface {
 	// to a destination peer.
 	AllowConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) bool
 }
+
+// StaticACL is an ACLFilter based on lists of allowed and denied peer IDs, IP ranges
+// and ASNs. The lists may be updated at any time; changes apply to subsequent
+// reservation and connection requests.
+//
+// A peer is denied if its peer ID, IP address or ASN is denied. Otherwise, if any
+// allow list is non-empty, the peer must match at least one of them. As ASNs are only
+// known for IPv6 addresses, ASN rules don't apply to peers connecting over IPv4.
+//
+// Connections are only relayed if the source peer is allowed and the destination
+// peer ID isn't denied.
+type StaticACL struct {
+	mx    sync.RWMutex
+	lists peermatch.Lists
+}
+
+var _ ACLFilter = (*StaticACL)(nil)
+
+// NewStaticACL creates a StaticACL which allows all peers.
+func NewStaticACL() *StaticACL {
+	return &StaticACL{lists: peermatch.NewLists()}
+}
+
+func (a *StaticACL) add(s *peermatch.Set, m peermatch.Match) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	s.Add(m)
+}
+
+func (a *StaticACL) remove(m peermatch.Match) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.lists.Allow.Remove(m)
+	a.lists.Deny.Remove(m)
+}
+
+// AllowPeer adds p to the list of allowed peers.
+func (a *StaticACL) AllowPeer(p peer.ID) {
+	a.add(a.lists.Allow, peermatch.Match{Peer: p})
+}
+
+// DenyPeer adds p to the list of denied peers.
+func (a *StaticACL) DenyPeer(p peer.ID) {
+	a.add(a.lists.Deny, peermatch.Match{Peer: p})
+}
+
+// RemovePeer removes p from the lists of allowed and denied peers.
+func (a *StaticACL) RemovePeer(p peer.ID) {
+	a.remove(peermatch.Match{Peer: p})
+}
+
+// AllowSubnet adds ipnet to the list of allowed IP ranges.
+func (a *StaticACL) AllowSubnet(ipnet *net.IPNet) {
+	a.add(a.lists.Allow, peermatch.Match{Subnet: ipnet})
+}
+
+// DenySubnet adds ipnet to the list of denied IP ranges.
+func (a *StaticACL) DenySubnet(ipnet *net.IPNet) {
+	a.add(a.lists.Deny, peermatch.Match{Subnet: ipnet})
+}
+
+// RemoveSubnet removes ipnet from the lists of allowed and denied IP ranges.
+func (a *StaticACL) RemoveSubnet(ipnet *net.IPNet) {
+	a.remove(peermatch.Match{Subnet: ipnet})
+}
+
+// AllowASN adds asn to the list of allowed ASNs.
+func (a *StaticACL) AllowASN(asn string) {
+	a.add(a.lists.Allow, peermatch.Match{ASN: asn})
+}
+
+// DenyASN adds asn to the list of denied ASNs.
+func (a *StaticACL) DenyASN(asn string) {
+	a.add(a.lists.Deny, peermatch.Match{ASN: asn})
+}
+
+// RemoveASN removes asn from the lists of allowed and denied ASNs.
+func (a *StaticACL) RemoveASN(asn string) {
+	a.remove(peermatch.Match{ASN: asn})
+}
+
+// AllowReserve implements ACLFilter.
+func (a *StaticACL) AllowReserve(p peer.ID, addr ma.Multiaddr) bool {
+	a.mx.RLock()
+	defer a.mx.RUnlock()
+	_, denied := a.lists.Denied(p, addr)
+	return !denied
+}
+
+// AllowConnect implements ACLFilter.
+func (a *StaticACL) AllowConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) bool {
+	a.mx.RLock()
+	defer a.mx.RUnlock()
+	if _, ok := a.lists.Deny.MatchPeer(dest); ok {
+		return false
+	}
+	_, denied := a.lists.Denied(src, srcAddr)
+	return !denied
+}
@@ -0,0 +1,70 @@
+package relay
+
+import (
+	"net"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticACL(t *testing.T) {
+	p1, p2, p3 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	addr1 := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	addr2 := ma.StringCast("/ip4/5.6.7.8/tcp/1")
+	_, subnet, err := net.ParseCIDR("1.2.3.0/24")
+	require.NoError(t, err)
+
+	acl := NewStaticACL()
+	require.True(t, acl.AllowReserve(p1, addr1))
+	require.True(t, acl.AllowConnect(p1, addr1, p2))
+
+	acl.DenyPeer(p1)
+	require.False(t, acl.AllowReserve(p1, addr2))
+	require.False(t, acl.AllowConnect(p2, addr2, p1))
+	require.True(t, acl.AllowReserve(p2, addr1))
+	acl.RemovePeer(p1)
+	require.True(t, acl.AllowReserve(p1, addr2))
+
+	acl.DenySubnet(subnet)
+	require.False(t, acl.AllowReserve(p1, addr1))
+	require.False(t, acl.AllowConnect(p1, addr1, p2))
+	require.True(t, acl.AllowReserve(p1, addr2))
+	acl.RemoveSubnet(subnet)
+	require.True(t, acl.AllowReserve(p1, addr1))
+
+	// once anything is allowed explicitly, everything else is denied
+	acl.AllowSubnet(subnet)
+	acl.AllowPeer(p2)
+	require.True(t, acl.AllowReserve(p1, addr1))
+	require.False(t, acl.AllowReserve(p1, addr2))
+	require.True(t, acl.AllowReserve(p2, addr2))
+	require.False(t, acl.AllowReserve(p3, addr2))
+	// denying takes precedence
+	acl.DenyPeer(p2)
+	require.False(t, acl.AllowReserve(p2, addr2))
+	require.False(t, acl.AllowReserve(p2, addr1))
+
+	acl.RemovePeer(p2)
+	acl.RemoveSubnet(subnet)
+	require.True(t, acl.AllowReserve(p3, addr2))
+}
+
+func TestStaticACLASN(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	// 2a03:2880::/29 is announced by Facebook (AS32934)
+	addr := ma.StringCast("/ip6/2a03:2880:f003:c07:face:b00c::2/tcp/1")
+
+	acl := NewStaticACL()
+	acl.DenyASN("32934")
+	require.False(t, acl.AllowReserve(p, addr))
+	// ASN rules don't apply to IPv4 addresses
+	require.True(t, acl.AllowReserve(p, ma.StringCast("/ip4/1.2.3.4/tcp/1")))
+
+	acl.RemoveASN("32934")
+	acl.AllowASN("32934")
+	require.True(t, acl.AllowReserve(p, addr))
+	require.False(t, acl.AllowReserve(p, ma.StringCast("/ip6/2001:db8::1/tcp/1")))
+}
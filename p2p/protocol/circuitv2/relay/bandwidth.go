@@ -0,0 +1,183 @@
+package relay
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const bandwidthCheckInterval = time.Second
+
+// BandwidthAction is the action a BandwidthPolicy takes on the heaviest circuits.
+type BandwidthAction int
+
+const (
+	// BandwidthThrottle limits the throughput of the heaviest circuits to the
+	// ThrottleRate of the policy, for the rest of their lifetime.
+	BandwidthThrottle BandwidthAction = iota
+	// BandwidthTerminate resets the heaviest circuits.
+	BandwidthTerminate
+)
+
+func (a BandwidthAction) String() string {
+	switch a {
+	case BandwidthThrottle:
+		return "throttle"
+	case BandwidthTerminate:
+		return "terminate"
+	default:
+		return "unknown"
+	}
+}
+
+// BandwidthPolicy is applied when the relay is saturated, i.e. when the total
+// throughput of all relayed connections exceeds MaxRate. The Action is then taken
+// on the circuits with the highest throughput first, until the throughput of the
+// remaining circuits doesn't exceed MaxRate anymore.
+type BandwidthPolicy struct {
+	// MaxRate is the total throughput in bytes per second above which the relay
+	// is saturated.
+	MaxRate int64
+	// Action is the action taken on the heaviest circuits.
+	Action BandwidthAction
+	// ThrottleRate is the throughput in bytes per second throttled circuits are
+	// limited to. It is only used by BandwidthThrottle.
+	ThrottleRate int64
+}
+
+// BandwidthUsage is the number of bytes relayed for peers, in both directions.
+type BandwidthUsage struct {
+	// Reservations holds the bytes relayed through the circuits to each peer with
+	// a reservation, since it obtained its reservation.
+	Reservations map[peer.ID]int64
+	// Sources holds the bytes relayed through the circuits opened by each source
+	// peer, since it connected to the relay.
+	Sources map[peer.ID]int64
+}
+
+// circuit is a relayed connection from src to dest.
+type circuit struct {
+	src, dest peer.ID
+	s, bs     network.Stream
+
+	// bytes is the number of bytes relayed in both directions
+	bytes     atomic.Int64
+	throttled atomic.Bool
+	// lastBytes is the value of bytes at the last bandwidth check. It is only
+	// accessed by the bandwidth check.
+	lastBytes int64
+}
+
+// relayed records that n bytes were relayed, and throttles the circuit if required.
+func (c *circuit) relayed(n int, throttleRate int64) {
+	c.bytes.Add(int64(n))
+	if throttleRate > 0 && c.throttled.Load() {
+		time.Sleep(time.Duration(int64(n) * int64(time.Second) / throttleRate))
+	}
+}
+
+// BandwidthUsage returns the number of bytes relayed per reserved peer and per
+// source peer, including the active relayed connections.
+func (r *Relay) BandwidthUsage() BandwidthUsage {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	usage := BandwidthUsage{
+		Reservations: make(map[peer.ID]int64, len(r.rsvpBytes)),
+		Sources:      make(map[peer.ID]int64, len(r.srcBytes)),
+	}
+	for p, n := range r.rsvpBytes {
+		usage.Reservations[p] = n
+	}
+	for p, n := range r.srcBytes {
+		usage.Sources[p] = n
+	}
+	for c := range r.circuits {
+		n := c.bytes.Load()
+		if _, ok := r.rsvp[c.dest]; ok {
+			usage.Reservations[c.dest] += n
+		}
+		usage.Sources[c.src] += n
+	}
+	return usage
+}
+
+func (r *Relay) addCircuit(c *circuit) {
+	r.mx.Lock()
+	r.circuits[c] = struct{}{}
+	r.mx.Unlock()
+}
+
+func (r *Relay) rmCircuit(c *circuit) {
+	n := c.bytes.Load()
+
+	r.mx.Lock()
+	delete(r.circuits, c)
+	if _, ok := r.rsvp[c.dest]; ok {
+		r.rsvpBytes[c.dest] += n
+	}
+	if r.host.Network().Connectedness(c.src) == network.Connected {
+		r.srcBytes[c.src] += n
+	}
+	r.mx.Unlock()
+
+	if r.metricsTracer != nil {
+		r.metricsTracer.ConnectionBytesRelayed(n)
+	}
+}
+
+func (r *Relay) throttleRate() int64 {
+	if r.bwPolicy == nil || r.bwPolicy.Action != BandwidthThrottle {
+		return 0
+	}
+	return r.bwPolicy.ThrottleRate
+}
+
+// checkBandwidth applies the bandwidth policy if the relay is saturated.
+func (r *Relay) checkBandwidth(interval time.Duration) {
+	type circuitRate struct {
+		c     *circuit
+		bytes int64
+	}
+
+	r.mx.Lock()
+	rates := make([]circuitRate, 0, len(r.circuits))
+	var total int64
+	for c := range r.circuits {
+		n := c.bytes.Load()
+		rates = append(rates, circuitRate{c: c, bytes: n - c.lastBytes})
+		total += n - c.lastBytes
+		c.lastBytes = n
+	}
+	r.mx.Unlock()
+
+	maxBytes := int64(float64(r.bwPolicy.MaxRate) * interval.Seconds())
+	if total <= maxBytes {
+		return
+	}
+
+	sort.Slice(rates, func(i, j int) bool { return rates[i].bytes > rates[j].bytes })
+	for _, cr := range rates {
+		if total <= maxBytes {
+			break
+		}
+		switch r.bwPolicy.Action {
+		case BandwidthTerminate:
+			log.Debugf("relay saturated; terminating relayed connection from %s to %s", cr.c.src, cr.c.dest)
+			cr.c.s.Reset()
+			cr.c.bs.Reset()
+		case BandwidthThrottle:
+			if cr.c.throttled.Swap(true) {
+				continue
+			}
+			log.Debugf("relay saturated; throttling relayed connection from %s to %s", cr.c.src, cr.c.dest)
+		}
+		total -= cr.bytes
+		if r.metricsTracer != nil {
+			r.metricsTracer.BandwidthPolicyApplied(r.bwPolicy.Action)
+		}
+	}
+}
@@ -76,6 +76,23 @@ var (
 		},
 	)
 
+	connectionBytesRelayed = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "connection_bytes_relayed",
+			Help:      "Bytes Relayed per Relay Connection",
+			Buckets:   prometheus.ExponentialBuckets(1024, 4, 11),
+		},
+	)
+	bandwidthPolicyActionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "bandwidth_policy_actions_total",
+			Help:      "Relay Connections Throttled or Terminated by the Bandwidth Policy",
+		},
+		[]string{"action"},
+	)
+
 	dataTransferredBytesTotal = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: metricNamespace,
@@ -93,6 +110,8 @@ var (
 		connectionRequestResponseStatusTotal,
 		connectionRejectionsTotal,
 		connectionDurationSeconds,
+		connectionBytesRelayed,
+		bandwidthPolicyActionsTotal,
 		dataTransferredBytesTotal,
 	}
 )
@@ -124,6 +143,10 @@ type MetricsTracer interface {
 
 	// BytesTransferred tracks the total bytes transferred by the relay service
 	BytesTransferred(cnt int)
+	// ConnectionBytesRelayed tracks the bytes relayed by a relay connection, when it is closed
+	ConnectionBytesRelayed(cnt int64)
+	// BandwidthPolicyApplied tracks a relay connection being throttled or terminated
+	BandwidthPolicyApplied(action BandwidthAction)
 }
 
 type metricsTracer struct{}
@@ -232,6 +255,18 @@ func (mt *metricsTracer) BytesTransferred(cnt int) {
 	dataTransferredBytesTotal.Add(float64(cnt))
 }
 
+func (mt *metricsTracer) ConnectionBytesRelayed(cnt int64) {
+	connectionBytesRelayed.Observe(float64(cnt))
+}
+
+func (mt *metricsTracer) BandwidthPolicyApplied(action BandwidthAction) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, action.String())
+
+	bandwidthPolicyActionsTotal.WithLabelValues(*tags...).Inc()
+}
+
 func getResponseStatus(status pbv2.Status) string {
 	responseStatus := "unknown"
 	switch status {
@@ -27,6 +27,8 @@ func TestNoCoverNoAlloc(t *testing.T) {
 		"ReservationClosed":         func() { mt.ReservationClosed(rand.Intn(10)) },
 		"ReservationRequestHandled": func() { mt.ReservationRequestHandled(statuses[rand.Intn(len(statuses))]) },
 		"BytesTransferred":          func() { mt.BytesTransferred(rand.Intn(1000)) },
+		"ConnectionBytesRelayed":    func() { mt.ConnectionBytesRelayed(int64(rand.Intn(1000))) },
+		"BandwidthPolicyApplied":    func() { mt.BandwidthPolicyApplied(BandwidthAction(rand.Intn(2))) },
 	}
 	for method, f := range tests {
 		allocs := testing.AllocsPerRun(1000, f)
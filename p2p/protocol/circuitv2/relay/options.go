@@ -1,5 +1,12 @@
 package relay
 
+import (
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/discovery"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
 type Option func(*Relay) error
 
 // WithResources is a Relay option that sets specific relay resources for the relay.
@@ -26,6 +33,47 @@ func WithInfiniteLimits() Option {
 	}
 }
 
+// WithPeerLimits is a Relay option that sets the relayed connection limits for specific
+// peers, overriding the limits set in the resources. A nil limit disables limits for the
+// peer, e.g. for trusted peers.
+//
+// A relayed connection is subject to the more generous of the limits of its source and
+// destination.
+func WithPeerLimits(limits map[peer.ID]*RelayLimit) Option {
+	return func(r *Relay) error {
+		r.peerLimits = make(map[peer.ID]*RelayLimit, len(limits))
+		for p, l := range limits {
+			r.peerLimits[p] = l
+		}
+		return nil
+	}
+}
+
+// WithBandwidthPolicy is a Relay option that sets the policy applied to the relayed
+// connections with the highest throughput when the relay is saturated.
+func WithBandwidthPolicy(policy BandwidthPolicy) Option {
+	return func(r *Relay) error {
+		if policy.MaxRate <= 0 {
+			return errors.New("bandwidth policy requires a positive max rate")
+		}
+		if policy.Action == BandwidthThrottle && policy.ThrottleRate <= 0 {
+			return errors.New("bandwidth policy requires a positive throttle rate to throttle")
+		}
+		r.bwPolicy = &policy
+		return nil
+	}
+}
+
+// WithAdvertiser is a Relay option that advertises the relay service in the namespace ns
+// using a, for as long as the relay is running, so that clients can discover it.
+func WithAdvertiser(a discovery.Advertiser, ns string) Option {
+	return func(r *Relay) error {
+		r.advertiser = a
+		r.advertiseNS = ns
+		return nil
+	}
+}
+
 // WithACL is a Relay option that supplies an ACLFilter for access control.
 func WithACL(acl ACLFilter) Option {
 	return func(r *Relay) error {
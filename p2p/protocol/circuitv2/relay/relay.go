@@ -9,10 +9,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/discovery"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/record"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
 	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
@@ -48,15 +50,23 @@ type Relay struct {
 
 	host        host.Host
 	rc          Resources
+	peerLimits  map[peer.ID]*RelayLimit
+	bwPolicy    *BandwidthPolicy
+	advertiser  discovery.Advertiser
+	advertiseNS string
 	acl         ACLFilter
 	constraints *constraints
 	scope       network.ResourceScopeSpan
 	notifiee    network.Notifiee
 
-	mx     sync.Mutex
-	rsvp   map[peer.ID]time.Time
-	conns  map[peer.ID]int
-	closed bool
+	mx       sync.Mutex
+	rsvp     map[peer.ID]time.Time
+	conns    map[peer.ID]int
+	circuits map[*circuit]struct{}
+	// bytes relayed through closed circuits, see BandwidthUsage
+	rsvpBytes map[peer.ID]int64
+	srcBytes  map[peer.ID]int64
+	closed    bool
 
 	selfAddr ma.Multiaddr
 
@@ -75,6 +85,10 @@ func New(h host.Host, opts ...Option) (*Relay, error) {
 		acl:    nil,
 		rsvp:   make(map[peer.ID]time.Time),
 		conns:  make(map[peer.ID]int),
+
+		circuits:  make(map[*circuit]struct{}),
+		rsvpBytes: make(map[peer.ID]int64),
+		srcBytes:  make(map[peer.ID]int64),
 	}
 
 	for _, opt := range opts {
@@ -106,6 +120,9 @@ func New(h host.Host, opts ...Option) (*Relay, error) {
 		r.metricsTracer.RelayStatus(true)
 	}
 	go r.background()
+	if r.advertiser != nil {
+		dutil.Advertise(r.ctx, r.advertiser, r.advertiseNS)
+	}
 
 	return r, nil
 }
@@ -227,7 +244,7 @@ func (r *Relay) handleReserve(s network.Stream) pbv2.Status {
 	// Delivery of the reservation might fail for a number of reasons.
 	// For example, the stream might be reset or the connection might be closed before the reservation is received.
 	// In that case, the reservation will just be garbage collected later.
-	if err := r.writeResponse(s, pbv2.Status_OK, r.makeReservationMsg(p, expire), r.makeLimitMsg(p)); err != nil {
+	if err := r.writeResponse(s, pbv2.Status_OK, r.makeReservationMsg(p, expire), r.makeLimitMsg(r.peerLimit(p))); err != nil {
 		log.Debugf("error writing reservation response; retracting reservation for %s", p)
 		s.Reset()
 		return pbv2.Status_CONNECTION_FAILED
@@ -361,7 +378,8 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) pbv2.Statu
 	var stopmsg pbv2.StopMessage
 	stopmsg.Type = pbv2.StopMessage_CONNECT.Enum()
 	stopmsg.Peer = util.PeerInfoToPeerV2(peer.AddrInfo{ID: src})
-	stopmsg.Limit = r.makeLimitMsg(dest.ID)
+	limit := r.circuitLimit(src, dest.ID)
+	stopmsg.Limit = r.makeLimitMsg(limit)
 
 	bs.SetDeadline(time.Now().Add(HandshakeTimeout))
 
@@ -396,7 +414,7 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) pbv2.Statu
 	var response pbv2.HopMessage
 	response.Type = pbv2.HopMessage_STATUS.Enum()
 	response.Status = pbv2.Status_OK.Enum()
-	response.Limit = r.makeLimitMsg(dest.ID)
+	response.Limit = r.makeLimitMsg(limit)
 
 	wr = util.NewDelimitedWriter(s)
 	err = wr.WriteMsg(&response)
@@ -413,6 +431,9 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) pbv2.Statu
 
 	log.Infof("relaying connection from %s to %s", src, dest.ID)
 
+	c := &circuit{src: src, dest: dest.ID, s: s, bs: bs}
+	r.addCircuit(c)
+
 	var goroutines atomic.Int32
 	goroutines.Store(2)
 
@@ -420,19 +441,20 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) pbv2.Statu
 		if goroutines.Add(-1) == 0 {
 			s.Close()
 			bs.Close()
+			r.rmCircuit(c)
 			cleanup()
 		}
 	}
 
-	if r.rc.Limit != nil {
-		deadline := time.Now().Add(r.rc.Limit.Duration)
+	if limit != nil {
+		deadline := time.Now().Add(limit.Duration)
 		s.SetDeadline(deadline)
 		bs.SetDeadline(deadline)
-		go r.relayLimited(s, bs, src, dest.ID, r.rc.Limit.Data, done)
-		go r.relayLimited(bs, s, dest.ID, src, r.rc.Limit.Data, done)
+		go r.relayLimited(c, s, bs, src, dest.ID, limit.Data, done)
+		go r.relayLimited(c, bs, s, dest.ID, src, limit.Data, done)
 	} else {
-		go r.relayUnlimited(s, bs, src, dest.ID, done)
-		go r.relayUnlimited(bs, s, dest.ID, src, done)
+		go r.relayUnlimited(c, s, bs, src, dest.ID, done)
+		go r.relayUnlimited(c, bs, s, dest.ID, src, done)
 	}
 
 	return pbv2.Status_OK
@@ -458,7 +480,7 @@ func (r *Relay) rmConn(p peer.ID) {
 	}
 }
 
-func (r *Relay) relayLimited(src, dest network.Stream, srcID, destID peer.ID, limit int64, done func()) {
+func (r *Relay) relayLimited(c *circuit, src, dest network.Stream, srcID, destID peer.ID, limit int64, done func()) {
 	defer done()
 
 	buf := pool.Get(r.rc.BufferSize)
@@ -466,7 +488,7 @@ func (r *Relay) relayLimited(src, dest network.Stream, srcID, destID peer.ID, li
 
 	limitedSrc := io.LimitReader(src, limit)
 
-	count, err := r.copyWithBuffer(dest, limitedSrc, buf)
+	count, err := r.copyWithBuffer(c, dest, limitedSrc, buf)
 	if err != nil {
 		log.Debugf("relay copy error: %s", err)
 		// Reset both.
@@ -484,13 +506,13 @@ func (r *Relay) relayLimited(src, dest network.Stream, srcID, destID peer.ID, li
 	log.Debugf("relayed %d bytes from %s to %s", count, srcID, destID)
 }
 
-func (r *Relay) relayUnlimited(src, dest network.Stream, srcID, destID peer.ID, done func()) {
+func (r *Relay) relayUnlimited(c *circuit, src, dest network.Stream, srcID, destID peer.ID, done func()) {
 	defer done()
 
 	buf := pool.Get(r.rc.BufferSize)
 	defer pool.Put(buf)
 
-	count, err := r.copyWithBuffer(dest, src, buf)
+	count, err := r.copyWithBuffer(c, dest, src, buf)
 	if err != nil {
 		log.Debugf("relay copy error: %s", err)
 		// Reset both.
@@ -509,9 +531,11 @@ func (r *Relay) relayUnlimited(src, dest network.Stream, srcID, destID peer.ID,
 var errInvalidWrite = errors.New("invalid write result")
 
 // copyWithBuffer copies from src to dst using the provided buf until either EOF is reached
-// on src or an error occurs. It reports the number of bytes transferred to metricsTracer.
+// on src or an error occurs. It reports the number of bytes transferred to metricsTracer
+// and to the circuit c.
 // The implementation is a modified form of io.CopyBuffer to support metrics tracking.
-func (r *Relay) copyWithBuffer(dst io.Writer, src io.Reader, buf []byte) (written int64, err error) {
+func (r *Relay) copyWithBuffer(c *circuit, dst io.Writer, src io.Reader, buf []byte) (written int64, err error) {
+	throttleRate := r.throttleRate()
 	for {
 		nr, er := src.Read(buf)
 		if nr > 0 {
@@ -534,6 +558,7 @@ func (r *Relay) copyWithBuffer(dst io.Writer, src io.Reader, buf []byte) (writte
 			if r.metricsTracer != nil {
 				r.metricsTracer.BytesTransferred(nw)
 			}
+			c.relayed(nw, throttleRate)
 		}
 		if er != nil {
 			if er != io.EOF {
@@ -609,13 +634,38 @@ func (r *Relay) makeReservationMsg(p peer.ID, expire time.Time) *pbv2.Reservatio
 	return rsvp
 }
 
-func (r *Relay) makeLimitMsg(p peer.ID) *pbv2.Limit {
-	if r.rc.Limit == nil {
+// peerLimit returns the limit for relayed connections of p, or nil if they're unlimited.
+func (r *Relay) peerLimit(p peer.ID) *RelayLimit {
+	if limit, ok := r.peerLimits[p]; ok {
+		return limit
+	}
+	return r.rc.Limit
+}
+
+// circuitLimit returns the limit for a relayed connection between src and dest, which
+// is the more generous of their limits.
+func (r *Relay) circuitLimit(src, dest peer.ID) *RelayLimit {
+	srcLimit, destLimit := r.peerLimit(src), r.peerLimit(dest)
+	if srcLimit == nil || destLimit == nil {
+		return nil
+	}
+	limit := *srcLimit
+	if destLimit.Duration > limit.Duration {
+		limit.Duration = destLimit.Duration
+	}
+	if destLimit.Data > limit.Data {
+		limit.Data = destLimit.Data
+	}
+	return &limit
+}
+
+func (r *Relay) makeLimitMsg(limit *RelayLimit) *pbv2.Limit {
+	if limit == nil {
 		return nil
 	}
 
-	duration := uint32(r.rc.Limit.Duration / time.Second)
-	data := uint64(r.rc.Limit.Data)
+	duration := uint32(limit.Duration / time.Second)
+	data := uint64(limit.Data)
 
 	return &pbv2.Limit{
 		Duration: &duration,
@@ -629,10 +679,19 @@ func (r *Relay) background() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
+	var bwCheck <-chan time.Time
+	if r.bwPolicy != nil {
+		bwTicker := time.NewTicker(bandwidthCheckInterval)
+		defer bwTicker.Stop()
+		bwCheck = bwTicker.C
+	}
+
 	for {
 		select {
 		case <-ticker.C:
 			r.gc()
+		case <-bwCheck:
+			r.checkBandwidth(bandwidthCheckInterval)
 		case <-r.ctx.Done():
 			return
 		}
@@ -648,6 +707,7 @@ func (r *Relay) gc() {
 	for p, expire := range r.rsvp {
 		if r.closed || expire.Before(now) {
 			delete(r.rsvp, p)
+			delete(r.rsvpBytes, p)
 			r.host.ConnManager().UntagPeer(p, "relay-reservation")
 			cnt++
 		}
@@ -674,6 +734,8 @@ func (r *Relay) disconnected(n network.Network, c network.Conn) {
 	if ok {
 		delete(r.rsvp, p)
 	}
+	delete(r.rsvpBytes, p)
+	delete(r.srcBytes, p)
 	r.mx.Unlock()
 
 	if ok && r.metricsTracer != nil {
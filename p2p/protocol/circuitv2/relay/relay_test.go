@@ -21,6 +21,7 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 
@@ -139,6 +140,9 @@ func TestBasicRelay(t *testing.T) {
 	if rsvp.Voucher == nil {
 		t.Fatal("no reservation voucher")
 	}
+	if _, err := proto.VerifyVoucher(rsvp.SignedVoucher, hosts[1].ID(), hosts[0].ID(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
 
 	raddr, err := ma.NewMultiaddr(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", hosts[1].ID(), hosts[0].ID()))
 	if err != nil {
@@ -357,3 +361,135 @@ func TestRelayLimitData(t *testing.T) {
 	}
 
 }
+
+func TestRelayPeerLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts, upgraders := getNetHosts(t, ctx, 4)
+	addTransport(t, hosts[0], upgraders[0])
+	addTransport(t, hosts[2], upgraders[2])
+	addTransport(t, hosts[3], upgraders[3])
+
+	r, err := relay.New(hosts[1], relay.WithPeerLimits(map[peer.ID]*relay.RelayLimit{
+		hosts[0].ID(): {Duration: time.Hour, Data: 1 << 20},
+		hosts[3].ID(): nil,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+	connect(t, hosts[1], hosts[3])
+
+	rinfo := hosts[1].Peerstore().PeerInfo(hosts[1].ID())
+	rsvp, err := client.Reserve(ctx, hosts[0], rinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsvp.LimitDuration != time.Hour || rsvp.LimitData != 1<<20 {
+		t.Fatalf("unexpected reservation limit: %s, %d", rsvp.LimitDuration, rsvp.LimitData)
+	}
+
+	raddr, err := ma.NewMultiaddr(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", hosts[1].ID(), hosts[0].ID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the more generous limit of source and destination applies
+	if err := hosts[2].Connect(ctx, peer.AddrInfo{ID: hosts[0].ID(), Addrs: []ma.Multiaddr{raddr}}); err != nil {
+		t.Fatal(err)
+	}
+	duration, data, ok := client.ConnLimit(hosts[2].Network().ConnsToPeer(hosts[0].ID())[0])
+	if !ok || duration != time.Hour || data != 1<<20 {
+		t.Fatalf("unexpected connection limit: %t, %s, %d", ok, duration, data)
+	}
+
+	// connections of unlimited peers aren't limited
+	if err := hosts[3].Connect(ctx, peer.AddrInfo{ID: hosts[0].ID(), Addrs: []ma.Multiaddr{raddr}}); err != nil {
+		t.Fatal(err)
+	}
+	conns := hosts[3].Network().ConnsToPeer(hosts[0].ID())
+	if len(conns) != 1 {
+		t.Fatalf("expected 1 connection, but got %d", len(conns))
+	}
+	if _, _, ok := client.ConnLimit(conns[0]); ok {
+		t.Fatal("expected unlimited connection")
+	}
+	if conns[0].Stat().Transient {
+		t.Fatal("expected non-transient connection")
+	}
+}
+
+func TestRelayBandwidthPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts, upgraders := getNetHosts(t, ctx, 3)
+	addTransport(t, hosts[0], upgraders[0])
+	addTransport(t, hosts[2], upgraders[2])
+
+	hosts[0].SetStreamHandler("test", func(s network.Stream) {
+		defer s.Close()
+		io.Copy(io.Discard, s)
+	})
+
+	r, err := relay.New(hosts[1],
+		relay.WithInfiniteLimits(),
+		relay.WithBandwidthPolicy(relay.BandwidthPolicy{MaxRate: 64 << 10, Action: relay.BandwidthTerminate}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+
+	rinfo := hosts[1].Peerstore().PeerInfo(hosts[1].ID())
+	if _, err := client.Reserve(ctx, hosts[0], rinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	raddr, err := ma.NewMultiaddr(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", hosts[1].ID(), hosts[0].ID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hosts[2].Connect(ctx, peer.AddrInfo{ID: hosts[0].ID(), Addrs: []ma.Multiaddr{raddr}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := hosts[2].NewStream(ctx, hosts[0].ID(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// relaying more than the max rate terminates the connection
+	buf := make([]byte, 1024)
+	var written int
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the relayed connection to be terminated")
+		}
+		n, err := s.Write(buf)
+		written += n
+		if err != nil {
+			break
+		}
+	}
+	if written < 64<<10 {
+		t.Fatalf("expected to write at least %d bytes before termination, but wrote %d", 64<<10, written)
+	}
+
+	usage := r.BandwidthUsage()
+	if usage.Reservations[hosts[0].ID()] < 64<<10 {
+		t.Fatalf("expected at least %d bytes relayed for the reservation, got %d", 64<<10, usage.Reservations[hosts[0].ID()])
+	}
+	if usage.Sources[hosts[2].ID()] != usage.Reservations[hosts[0].ID()] {
+		t.Fatalf("expected the bytes relayed for the source and the reservation to match, got %d and %d",
+			usage.Sources[hosts[2].ID()], usage.Reservations[hosts[0].ID()])
+	}
+}
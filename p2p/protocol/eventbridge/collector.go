@@ -0,0 +1,115 @@
+package eventbridge
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/libp2p/go-msgio"
+)
+
+type CollectorOption func(*Collector) error
+
+// AllowForwarders sets the peers the Collector accepts events from. Streams from
+// other peers are reset. It must be set unless AllowAllForwarders is.
+func AllowForwarders(peers ...peer.ID) CollectorOption {
+	return func(c *Collector) error {
+		for _, p := range peers {
+			c.allowed[p] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// AllowAllForwarders makes the Collector accept events from any peer.
+func AllowAllForwarders() CollectorOption {
+	return func(c *Collector) error {
+		c.allowAll = true
+		return nil
+	}
+}
+
+// Collector receives the events sent by forwarders.
+type Collector struct {
+	host     host.Host
+	handler  func(peer.ID, Record)
+	allowed  map[peer.ID]struct{}
+	allowAll bool
+}
+
+// NewCollector creates a Collector receiving events on h, and passing them to
+// handler along with the peer that forwarded them. handler is called concurrently
+// for different forwarders, and in order for the events of a forwarder.
+func NewCollector(h host.Host, handler func(from peer.ID, r Record), opts ...CollectorOption) (*Collector, error) {
+	if handler == nil {
+		return nil, errors.New("no handler")
+	}
+	c := &Collector{
+		host:    h,
+		handler: handler,
+		allowed: make(map[peer.ID]struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if !c.allowAll && len(c.allowed) == 0 {
+		return nil, errors.New("no forwarders allowed")
+	}
+	h.SetStreamHandler(ID, c.handleStream)
+	return c, nil
+}
+
+func (c *Collector) handleStream(s network.Stream) {
+	from := s.Conn().RemotePeer()
+	if _, ok := c.allowed[from]; !ok && !c.allowAll {
+		log.Debugw("rejecting events from unauthorized peer", "peer", from)
+		s.Reset()
+		return
+	}
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugw("error attaching stream to event bridge service", "error", err)
+		s.Reset()
+		return
+	}
+	if err := s.Scope().ReserveMemory(maxMessageSize, network.ReservationPriorityAlways); err != nil {
+		log.Debugw("error reserving memory for event bridge stream", "error", err)
+		s.Reset()
+		return
+	}
+	defer s.Scope().ReleaseMemory(maxMessageSize)
+
+	r := msgio.NewVarintReaderSize(s, maxMessageSize)
+	for {
+		msg, err := r.ReadMsg()
+		if err != nil {
+			if err == io.EOF {
+				s.Close()
+			} else {
+				log.Debugw("error reading events", "peer", from, "error", err)
+				s.Reset()
+			}
+			return
+		}
+		var rec Record
+		err = json.Unmarshal(msg, &rec)
+		r.ReleaseMsg(msg)
+		if err != nil {
+			log.Debugw("received malformed event", "peer", from, "error", err)
+			s.Reset()
+			return
+		}
+		c.handler(from, rec)
+	}
+}
+
+// Close stops receiving events.
+func (c *Collector) Close() error {
+	c.host.RemoveStreamHandler(ID)
+	return nil
+}
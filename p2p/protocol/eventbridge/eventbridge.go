@@ -0,0 +1,46 @@
+// Package eventbridge forwards selected events of the event bus of a host to a
+// collector peer, so that the behavior of a fleet of nodes can be observed centrally.
+//
+// The bridge is opt-in, and meant for debugging: a Forwarder only ever sends events to
+// the single collector peer it was configured with, and a Collector only accepts events
+// from the forwarders it allows.
+package eventbridge
+
+import (
+	"encoding/json"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+var log = logging.Logger("eventbridge")
+
+const (
+	// ID is the protocol forwarders use to send events to a collector.
+	ID protocol.ID = "/libp2p/event-bridge/1.0.0"
+
+	ServiceName = "libp2p.eventbridge"
+
+	// maxMessageSize is the maximum size of a forwarded event
+	maxMessageSize = 64 << 10
+)
+
+// DefaultEvents are the events forwarded by default: changes of the reachability,
+// of the connections to peers, and the results of hole punches.
+var DefaultEvents = []interface{}{
+	new(event.EvtLocalReachabilityChanged),
+	new(event.EvtPeerConnectednessChanged),
+	new(event.EvtHolePunchFinished),
+}
+
+// Record is a forwarded event.
+type Record struct {
+	// Type is the Go type of the event, e.g. "event.EvtLocalReachabilityChanged".
+	Type string `json:"type"`
+	// Time is when the forwarder received the event from its event bus.
+	Time time.Time `json:"time"`
+	// Event is the JSON encoding of the event.
+	Event json.RawMessage `json:"event"`
+}
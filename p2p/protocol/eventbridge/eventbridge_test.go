@@ -0,0 +1,100 @@
+package eventbridge
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mx      sync.Mutex
+	records []Record
+	from    []peer.ID
+}
+
+func (r *recorder) handle(from peer.ID, rec Record) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.records = append(r.records, rec)
+	r.from = append(r.from, from)
+}
+
+func (r *recorder) get() ([]peer.ID, []Record) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return append([]peer.ID(nil), r.from...), append([]Record(nil), r.records...)
+}
+
+func newHost(t *testing.T) *bhost.BasicHost {
+	h, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { h.Close() })
+	h.Start()
+	return h
+}
+
+func TestForwardEvents(t *testing.T) {
+	collector := newHost(t)
+	node := newHost(t)
+	require.NoError(t, node.Connect(context.Background(), peer.AddrInfo{ID: collector.ID(), Addrs: collector.Addrs()}))
+
+	var rec recorder
+	c, err := NewCollector(collector, rec.handle, AllowForwarders(node.ID()))
+	require.NoError(t, err)
+	defer c.Close()
+
+	f, err := NewForwarder(node, collector.ID(), WithEvents(new(event.EvtLocalReachabilityChanged)))
+	require.NoError(t, err)
+	defer f.Close()
+
+	em, err := node.EventBus().Emitter(new(event.EvtLocalReachabilityChanged))
+	require.NoError(t, err)
+	defer em.Close()
+	require.NoError(t, em.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPrivate, Confidence: 0.5}))
+
+	require.Eventually(t, func() bool {
+		_, records := rec.get()
+		return len(records) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	from, records := rec.get()
+	require.Equal(t, node.ID(), from[0])
+	require.Equal(t, "event.EvtLocalReachabilityChanged", records[0].Type)
+	var evt event.EvtLocalReachabilityChanged
+	require.NoError(t, json.Unmarshal(records[0].Event, &evt))
+	require.Equal(t, network.ReachabilityPrivate, evt.Reachability)
+	require.Equal(t, 0.5, evt.Confidence)
+}
+
+func TestRejectUnauthorizedForwarder(t *testing.T) {
+	collector := newHost(t)
+	node := newHost(t)
+	require.NoError(t, node.Connect(context.Background(), peer.AddrInfo{ID: collector.ID(), Addrs: collector.Addrs()}))
+
+	_, err := NewCollector(collector, func(peer.ID, Record) {})
+	require.Error(t, err)
+
+	var rec recorder
+	c, err := NewCollector(collector, rec.handle, AllowForwarders(peer.ID("other")))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// depending on timing, the stream is reset while negotiating the protocol or
+	// afterwards
+	str, err := node.NewStream(context.Background(), collector.ID(), ID)
+	if err == nil {
+		defer str.Close()
+		str.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = str.Read(make([]byte, 1))
+	}
+	require.ErrorIs(t, err, network.ErrReset)
+}
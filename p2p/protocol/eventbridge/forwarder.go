@@ -0,0 +1,200 @@
+package eventbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	"github.com/libp2p/go-msgio"
+)
+
+const (
+	defaultBufferSize = 128
+	streamTimeout     = 10 * time.Second
+	minBackoff        = time.Second
+	maxBackoff        = time.Minute
+)
+
+type ForwarderOption func(*Forwarder) error
+
+// WithEvents sets the events to forward, as typed nil pointers to the event structs.
+// It defaults to DefaultEvents.
+func WithEvents(evtTypes ...interface{}) ForwarderOption {
+	return func(f *Forwarder) error {
+		if len(evtTypes) == 0 {
+			return errors.New("no events to forward")
+		}
+		f.evtTypes = evtTypes
+		return nil
+	}
+}
+
+// WithBufferSize sets the number of events buffered while the collector is slow or
+// unreachable. When the buffer is full, the oldest events are dropped.
+func WithBufferSize(n int) ForwarderOption {
+	return func(f *Forwarder) error {
+		if n <= 0 {
+			return errors.New("buffer size must be positive")
+		}
+		f.bufSize = n
+		return nil
+	}
+}
+
+// Forwarder forwards events of the event bus of a host to a collector peer.
+type Forwarder struct {
+	host      host.Host
+	collector peer.ID
+	evtTypes  []interface{}
+	bufSize   int
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	refCount  sync.WaitGroup
+
+	// str and w are the stream to the collector, and the writer on it. They are only
+	// used by the forwarding loop.
+	str         network.Stream
+	w           msgio.WriteCloser
+	nextAttempt time.Time
+	backoff     time.Duration
+}
+
+// NewForwarder creates a Forwarder sending events of h to collector, over a stream
+// it opens to collector. The addresses of collector must be known to h, or it must
+// be connected to it already. Events that can't be sent are dropped.
+func NewForwarder(h host.Host, collector peer.ID, opts ...ForwarderOption) (*Forwarder, error) {
+	if collector == "" {
+		return nil, errors.New("no collector")
+	}
+	if collector == h.ID() {
+		return nil, errors.New("can't forward events to self")
+	}
+	f := &Forwarder{
+		host:      h,
+		collector: collector,
+		evtTypes:  DefaultEvents,
+		bufSize:   defaultBufferSize,
+		backoff:   minBackoff,
+	}
+	for _, opt := range opts {
+		if err := opt(f); err != nil {
+			return nil, err
+		}
+	}
+
+	sub, err := h.EventBus().Subscribe(f.evtTypes, eventbus.Name("eventbridge"),
+		eventbus.BufSize(f.bufSize), eventbus.OnOverflow(eventbus.DropOldest))
+	if err != nil {
+		return nil, err
+	}
+	f.ctx, f.ctxCancel = context.WithCancel(context.Background())
+	f.refCount.Add(1)
+	go f.loop(sub)
+	return f, nil
+}
+
+func (f *Forwarder) loop(sub event.Subscription) {
+	defer f.refCount.Done()
+	defer sub.Close()
+	defer f.closeStream()
+
+	for {
+		select {
+		case evt, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			if err := f.forward(evt, time.Now()); err != nil {
+				log.Debugw("failed to forward event", "collector", f.collector, "error", err)
+			}
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *Forwarder) forward(evt interface{}, now time.Time) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(Record{Type: reflect.TypeOf(evt).String(), Time: now, Event: b})
+	if err != nil {
+		return err
+	}
+	if len(msg) > maxMessageSize {
+		return fmt.Errorf("event too large: %d bytes", len(msg))
+	}
+
+	if err := f.openStream(now); err != nil {
+		return err
+	}
+	f.str.SetWriteDeadline(now.Add(streamTimeout))
+	if err := f.w.WriteMsg(msg); err != nil {
+		f.str.Reset()
+		f.str, f.w = nil, nil
+		f.failed(now)
+		return err
+	}
+	return nil
+}
+
+// openStream opens a stream to the collector, unless there is one already, or the
+// last attempt failed too recently.
+func (f *Forwarder) openStream(now time.Time) error {
+	if f.str != nil {
+		return nil
+	}
+	if now.Before(f.nextAttempt) {
+		return errors.New("backing off after a failure")
+	}
+	ctx, cancel := context.WithTimeout(f.ctx, streamTimeout)
+	defer cancel()
+	str, err := f.host.NewStream(ctx, f.collector, ID)
+	if err != nil {
+		f.failed(now)
+		return err
+	}
+	if err := str.Scope().SetService(ServiceName); err != nil {
+		str.Reset()
+		f.failed(now)
+		return err
+	}
+	f.str = str
+	f.w = msgio.NewVarintWriter(str)
+	f.backoff = minBackoff
+	return nil
+}
+
+func (f *Forwarder) failed(now time.Time) {
+	f.nextAttempt = now.Add(f.backoff)
+	f.backoff *= 2
+	if f.backoff > maxBackoff {
+		f.backoff = maxBackoff
+	}
+}
+
+func (f *Forwarder) closeStream() {
+	if f.str != nil {
+		f.str.Close()
+		f.str, f.w = nil, nil
+	}
+}
+
+// Close stops forwarding events, and closes the stream to the collector.
+func (f *Forwarder) Close() error {
+	f.ctxCancel()
+	f.refCount.Wait()
+	return nil
+}
@@ -2,7 +2,9 @@ package holepunch_test
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -13,6 +15,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
@@ -149,6 +152,9 @@ func TestEndToEndSimConnect(t *testing.T) {
 	require.Equal(t, holepunch.StartHolePunchEvtT, h2Events[0].Type)
 	require.Equal(t, holepunch.HolePunchAttemptEvtT, h2Events[1].Type)
 	require.Equal(t, holepunch.EndHolePunchEvtT, h2Events[2].Type)
+	end := h2Events[2].Evt.(*holepunch.EndHolePunchEvt)
+	require.Equal(t, holepunch.SideInitiator, end.Side)
+	require.Equal(t, []string{"tcp"}, end.Transports)
 
 	h1Events := h1tr.getEvents()
 	// We don't really expect a hole-punched connection to be established in this test,
@@ -247,6 +253,250 @@ func TestFailuresOnInitiator(t *testing.T) {
 	}
 }
 
+func TestRetryPolicy(t *testing.T) {
+	const attempts = 3
+	const backoff = 50 * time.Millisecond
+
+	h1, h2, relay, _ := makeRelayedHosts(t, nil, nil, false)
+	defer h1.Close()
+	defer h2.Close()
+	defer relay.Close()
+
+	tr := &mockEventTracer{}
+	hps := addHolePunchService(t, h2,
+		holepunch.WithTracer(tr),
+		holepunch.WithMaxAttempts(attempts),
+		holepunch.WithAttemptTimeout(time.Second),
+		holepunch.WithRetryBackoff(backoff),
+	)
+	require.ErrorIs(t, hps.RetryHolePunch(h1.ID()), holepunch.ErrNotInitiator)
+	require.Eventually(t, func() bool {
+		protos, _ := h2.Peerstore().SupportsProtocols(h1.ID(), holepunch.Protocol)
+		return len(protos) > 0
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	// respond with an address nobody listens on, so that every round fails
+	var mx sync.Mutex
+	var rounds int
+	h1.SetStreamHandler(holepunch.Protocol, func(s network.Stream) {
+		defer s.Close()
+		mx.Lock()
+		rounds++
+		mx.Unlock()
+		rd := pbio.NewDelimitedReader(s, 2048)
+		wr := pbio.NewDelimitedWriter(s)
+		var msg holepunch_pb.HolePunch
+		if err := rd.ReadMsg(&msg); err != nil {
+			return
+		}
+		wr.WriteMsg(&holepunch_pb.HolePunch{
+			Type:     holepunch_pb.HolePunch_CONNECT.Enum(),
+			ObsAddrs: addrsToBytes([]ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/1")}),
+		})
+		rd.ReadMsg(&msg)
+	})
+	getRounds := func() int {
+		mx.Lock()
+		defer mx.Unlock()
+		return rounds
+	}
+
+	// the hole punch would succeed by dialing h1's actual listen addresses
+	h1.Network().(*swarm.Swarm).ListenClose(h1.Network().ListenAddresses()...)
+
+	start := time.Now()
+	require.Error(t, hps.DirectConnect(h1.ID()))
+	require.Equal(t, attempts, getRounds())
+	var ends []*holepunch.EndHolePunchEvt
+	for _, evt := range tr.getEvents() {
+		if end, ok := evt.Evt.(*holepunch.EndHolePunchEvt); ok {
+			ends = append(ends, end)
+		}
+	}
+	require.Len(t, ends, attempts)
+	for _, end := range ends {
+		require.False(t, end.Success)
+		require.Equal(t, holepunch.SideInitiator, end.Side)
+		require.Equal(t, holepunch.StageDial, end.Stage)
+		require.Equal(t, []string{"tcp"}, end.Transports)
+	}
+	require.GreaterOrEqual(t, time.Since(start), backoff+2*backoff)
+
+	// a manual retry runs all rounds again
+	require.Error(t, hps.RetryHolePunch(h1.ID()))
+	require.Equal(t, 2*attempts, getRounds())
+}
+
+func TestTCPSimultaneousOpenAttempts(t *testing.T) {
+	const attempts = 3
+
+	// accepts connections and immediately closes them, failing the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	var mx sync.Mutex
+	var accepted int
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mx.Lock()
+			accepted++
+			mx.Unlock()
+			c.Close()
+		}
+	}()
+	getAccepted := func() int {
+		mx.Lock()
+		defer mx.Unlock()
+		return accepted
+	}
+
+	h1, h2, relay, _ := makeRelayedHosts(t, nil, nil, false)
+	defer h1.Close()
+	defer h2.Close()
+	defer relay.Close()
+
+	hps := addHolePunchService(t, h2,
+		holepunch.WithMaxAttempts(1),
+		holepunch.WithTCPSimultaneousOpenAttempts(attempts),
+		holepunch.WithTCPPortPrediction(1),
+	)
+	require.Eventually(t, func() bool {
+		protos, _ := h2.Peerstore().SupportsProtocols(h1.ID(), holepunch.Protocol)
+		return len(protos) > 0
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	// announce the port preceding the one of the listener, which is then predicted
+	port := l.Addr().(*net.TCPAddr).Port
+	h1.SetStreamHandler(holepunch.Protocol, func(s network.Stream) {
+		defer s.Close()
+		rd := pbio.NewDelimitedReader(s, 2048)
+		wr := pbio.NewDelimitedWriter(s)
+		var msg holepunch_pb.HolePunch
+		if err := rd.ReadMsg(&msg); err != nil {
+			return
+		}
+		wr.WriteMsg(&holepunch_pb.HolePunch{
+			Type:     holepunch_pb.HolePunch_CONNECT.Enum(),
+			ObsAddrs: addrsToBytes([]ma.Multiaddr{ma.StringCast(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port-1))}),
+		})
+		rd.ReadMsg(&msg)
+	})
+	// the hole punch would succeed by dialing h1's actual listen addresses
+	h1.Network().(*swarm.Swarm).ListenClose(h1.Network().ListenAddresses()...)
+
+	require.Error(t, hps.DirectConnect(h1.ID()))
+	require.Equal(t, attempts, getAccepted())
+}
+
+type webTransportIDService struct {
+	identify.IDService
+}
+
+func (s *webTransportIDService) OwnObservedAddrs() []ma.Multiaddr {
+	return append(s.IDService.OwnObservedAddrs(), ma.StringCast("/ip4/1.1.1.1/udp/1234/quic-v1/webtransport"))
+}
+
+func TestHolePunchOverWebTransportRelay(t *testing.T) {
+	if race.WithRace() {
+		t.Skip("modifying manet.Private4 is racy")
+	}
+	wt := ma.StringCast("/ip4/127.0.0.1/udp/0/quic-v1/webtransport")
+
+	relay, err := libp2p.New(
+		libp2p.ListenAddrs(wt),
+		libp2p.DisableRelay(),
+		libp2p.ResourceManager(&network.NullResourceManager{}),
+	)
+	require.NoError(t, err)
+	defer relay.Close()
+	_, err = relayv2.New(relay)
+	require.NoError(t, err)
+
+	// h2 obtains a reservation with the relay via WebTransport
+	cpy := manet.Private4
+	manet.Private4 = []*net.IPNet{}
+	h2, err := libp2p.New(
+		libp2p.ListenAddrs(wt),
+		libp2p.EnableRelay(),
+		libp2p.EnableAutoRelayWithStaticRelays([]peer.AddrInfo{{ID: relay.ID(), Addrs: relay.Addrs()}}),
+		libp2p.ForceReachabilityPrivate(),
+		libp2p.ResourceManager(&network.NullResourceManager{}),
+	)
+	require.NoError(t, err)
+	defer h2.Close()
+	var raddr ma.Multiaddr
+	require.Eventually(t, func() bool {
+		for _, a := range h2.Addrs() {
+			if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+				raddr = a
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 50*time.Millisecond)
+	manet.Private4 = cpy
+
+	h1, _ := mkHostWithHolePunchSvc(t)
+	defer h1.Close()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: []ma.Multiaddr{raddr}}))
+
+	ids, err := identify.NewIDService(h2)
+	require.NoError(t, err)
+	ids.Start()
+	defer ids.Close()
+	hps, err := holepunch.NewService(h2, &webTransportIDService{IDService: ids})
+	require.NoError(t, err)
+	defer hps.Close()
+	require.Eventually(t, func() bool {
+		protos, _ := h2.Peerstore().SupportsProtocols(h1.ID(), holepunch.Protocol)
+		return len(protos) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	// respond with a WebTransport address without certificate hashes, which can't be dialed
+	addrsCh := make(chan []ma.Multiaddr, 1)
+	h1.SetStreamHandler(holepunch.Protocol, func(s network.Stream) {
+		defer s.Close()
+		rd := pbio.NewDelimitedReader(s, 2048)
+		wr := pbio.NewDelimitedWriter(s)
+		var msg holepunch_pb.HolePunch
+		if err := rd.ReadMsg(&msg); err != nil {
+			return
+		}
+		var addrs []ma.Multiaddr
+		for _, b := range msg.ObsAddrs {
+			addrs = append(addrs, ma.Cast(b))
+		}
+		addrsCh <- addrs
+		wr.WriteMsg(&holepunch_pb.HolePunch{
+			Type:     holepunch_pb.HolePunch_CONNECT.Enum(),
+			ObsAddrs: addrsToBytes([]ma.Multiaddr{ma.StringCast("/ip4/1.1.1.1/udp/1234/quic-v1/webtransport")}),
+		})
+		rd.ReadMsg(&msg)
+	})
+
+	err = hps.DirectConnect(h1.ID())
+	require.ErrorContains(t, err, "didn't receive any public addresses in CONNECT")
+
+	// we sent our observed WebTransport address with our certificate hashes
+	var sent []ma.Multiaddr
+	select {
+	case sent = <-addrsCh:
+	case <-time.After(time.Second):
+		t.Fatal("CONNECT not received over the relayed connection")
+	}
+	var found bool
+	for _, a := range sent {
+		if strings.HasPrefix(a.String(), "/ip4/1.1.1.1/udp/1234/quic-v1/webtransport/certhash/") {
+			found = true
+		}
+	}
+	require.True(t, found, "expected WebTransport address with certificate hashes in %s", sent)
+}
+
 func addrsToBytes(as []ma.Multiaddr) [][]byte {
 	bzs := make([][]byte, 0, len(as))
 	for _, a := range as {
@@ -346,7 +596,7 @@ func TestFailuresOnResponder(t *testing.T) {
 				events := tr.getEvents()
 				for _, ev := range events {
 					if errEv, ok := ev.Evt.(*holepunch.ProtocolErrorEvt); ok {
-						errs = append(errs, errEv.Error)
+						errs = append(errs, errEv.Side+": "+errEv.Error)
 					}
 				}
 				return errs
@@ -356,6 +606,7 @@ func TestFailuresOnResponder(t *testing.T) {
 			errs := getTracerError(tr)
 			require.Len(t, errs, 1)
 			require.Contains(t, errs[0], tc.errMsg)
+			require.True(t, strings.HasPrefix(errs[0], holepunch.SideReceiver+": "))
 		})
 
 	}
@@ -22,10 +22,7 @@ import (
 // ErrHolePunchActive is returned from DirectConnect when another hole punching attempt is currently running
 var ErrHolePunchActive = errors.New("another hole punching attempt to this peer is active")
 
-const (
-	dialTimeout = 5 * time.Second
-	maxRetries  = 3
-)
+const dialTimeout = 5 * time.Second
 
 // The holePuncher is run on the peer that's behind a NAT / Firewall.
 // It observes new incoming connections via a relay that it has a reservation with,
@@ -50,15 +47,19 @@ type holePuncher struct {
 
 	tracer *tracer
 	filter AddrFilter
+	retry  retryPolicy
+	tcp    tcpConfig
 }
 
-func newHolePuncher(h host.Host, ids identify.IDService, tracer *tracer, filter AddrFilter) *holePuncher {
+func newHolePuncher(h host.Host, ids identify.IDService, tracer *tracer, filter AddrFilter, retry retryPolicy, tcp tcpConfig) *holePuncher {
 	hp := &holePuncher{
 		host:   h,
 		ids:    ids,
 		active: make(map[peer.ID]struct{}),
 		tracer: tracer,
 		filter: filter,
+		retry:  retry,
+		tcp:    tcp,
 	}
 	hp.ctx, hp.ctxCancel = context.WithCancel(context.Background())
 	h.Network().Notify((*netNotifiee)(hp))
@@ -133,11 +134,23 @@ func (hp *holePuncher) directConnect(rp peer.ID) error {
 	log.Debugw("got inbound proxy conn", "peer", rp)
 
 	// hole punch
-	for i := 0; i < maxRetries; i++ {
+	backoff := hp.retry.backoff
+	for i := 0; i < hp.retry.maxAttempts; i++ {
+		if i > 0 && backoff > 0 {
+			log.Debugf("hole punching round %d with peer %s failed; retrying in %s", i, rp, backoff)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-hp.ctx.Done():
+				timer.Stop()
+				return hp.ctx.Err()
+			}
+			backoff *= 2
+		}
 		addrs, rtt, err := hp.initiateHolePunch(rp)
 		if err != nil {
 			log.Debugw("hole punching failed", "peer", rp, "error", err)
-			hp.tracer.ProtocolError(rp, err)
+			hp.tracer.ProtocolError(rp, SideInitiator, err)
 			return err
 		}
 		synTime := rtt / 2
@@ -152,11 +165,11 @@ func (hp *holePuncher) directConnect(rp peer.ID) error {
 				ID:    rp,
 				Addrs: addrs,
 			}
-			hp.tracer.StartHolePunch(rp, addrs, rtt)
+			hp.tracer.StartHolePunch(rp, SideInitiator, addrs, rtt)
 			hp.tracer.HolePunchAttempt(pi.ID)
-			err := holePunchConnect(hp.ctx, hp.host, pi, true)
+			err := holePunchConnect(hp.ctx, hp.host, pi, true, hp.retry.attemptTimeout, hp.tcp)
 			dt := time.Since(start)
-			hp.tracer.EndHolePunch(rp, dt, err)
+			hp.tracer.EndHolePunch(rp, SideInitiator, addrs, dt, err)
 			if err == nil {
 				log.Debugw("hole punching with successful", "peer", rp, "time", dt)
 				return nil
@@ -206,7 +219,7 @@ func (hp *holePuncher) initiateHolePunchImpl(str network.Stream) ([]ma.Multiaddr
 	str.SetDeadline(time.Now().Add(StreamTimeout))
 
 	// send a CONNECT and start RTT measurement.
-	obsAddrs := removeRelayAddrs(hp.ids.OwnObservedAddrs())
+	obsAddrs := addCertHashes(hp.host, removeRelayAddrs(hp.ids.OwnObservedAddrs()))
 	if hp.filter != nil {
 		obsAddrs = hp.filter.FilterLocal(str.Conn().RemotePeer(), obsAddrs)
 	}
@@ -233,7 +246,7 @@ func (hp *holePuncher) initiateHolePunchImpl(str network.Stream) ([]ma.Multiaddr
 		return nil, 0, fmt.Errorf("expect CONNECT message, got %s", t)
 	}
 
-	addrs := removeRelayAddrs(addrsFromBytes(msg.ObsAddrs))
+	addrs := removeAddrsWithoutCertHashes(removeRelayAddrs(addrsFromBytes(msg.ObsAddrs)))
 	if hp.filter != nil {
 		addrs = hp.filter.FilterRemote(str.Conn().RemotePeer(), addrs)
 	}
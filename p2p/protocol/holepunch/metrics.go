@@ -0,0 +1,123 @@
+package holepunch
+
+import (
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricNamespace = "libp2p_holepunch"
+
+var (
+	directDialsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "direct_dials_total",
+			Help:      "Direct Dials Total",
+		},
+		[]string{"outcome"},
+	)
+	holePunchesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "hole_punches_total",
+			Help:      "Hole Punch Rounds by Outcome and Failure Stage",
+		},
+		[]string{"side", "outcome", "stage"},
+	)
+	holePunchTransportsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "hole_punch_transports_total",
+			Help:      "Hole Punch Rounds by Dialed Transport and NAT Device Type",
+		},
+		[]string{"side", "transport", "nat_device_type", "outcome"},
+	)
+	collectors = []prometheus.Collector{
+		directDialsTotal,
+		holePunchesTotal,
+		holePunchTransportsTotal,
+	}
+)
+
+// MetricsTracer is the interface for tracking metrics for hole punching
+type MetricsTracer interface {
+	// HolePunchFinished is called when a hole punching round ends. stage is the stage
+	// the hole punch failed at, or empty if it succeeded. transports are the
+	// transports that were dialed, and tcpNAT and udpNAT are the detected types of
+	// our NAT.
+	HolePunchFinished(side, stage string, transports []string, tcpNAT, udpNAT network.NATDeviceType)
+	// DirectDialFinished is called when the direct dial attempted before hole
+	// punching ends.
+	DirectDialFinished(success bool)
+}
+
+type metricsTracer struct{}
+
+var _ MetricsTracer = &metricsTracer{}
+
+type metricsTracerSetting struct {
+	reg prometheus.Registerer
+}
+
+type MetricsTracerOption func(*metricsTracerSetting)
+
+func WithRegisterer(reg prometheus.Registerer) MetricsTracerOption {
+	return func(s *metricsTracerSetting) {
+		if reg != nil {
+			s.reg = reg
+		}
+	}
+}
+
+func NewMetricsTracer(opts ...MetricsTracerOption) MetricsTracer {
+	setting := &metricsTracerSetting{reg: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(setting)
+	}
+	metricshelper.RegisterCollectors(setting.reg, collectors...)
+
+	// initialise these counters to 0, so that the success rate can be computed before
+	// the first failure
+	for _, side := range []string{SideInitiator, SideReceiver} {
+		holePunchesTotal.WithLabelValues(side, "success", "none")
+	}
+	directDialsTotal.WithLabelValues("success")
+	directDialsTotal.WithLabelValues("failed")
+	return &metricsTracer{}
+}
+
+func (mt *metricsTracer) HolePunchFinished(side, stage string, transports []string, tcpNAT, udpNAT network.NATDeviceType) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	outcome := "success"
+	if stage != "" {
+		outcome = "failed"
+	} else {
+		stage = "none"
+	}
+	*tags = append(*tags, side, outcome, stage)
+	holePunchesTotal.WithLabelValues(*tags...).Inc()
+
+	for _, tpt := range transports {
+		natType := udpNAT
+		if tpt == "tcp" || tpt == "ws" || tpt == "wss" {
+			natType = tcpNAT
+		}
+		*tags = (*tags)[:0]
+		*tags = append(*tags, side, tpt, natType.String(), outcome)
+		holePunchTransportsTotal.WithLabelValues(*tags...).Inc()
+	}
+}
+
+func (mt *metricsTracer) DirectDialFinished(success bool) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	if success {
+		*tags = append(*tags, "success")
+	} else {
+		*tags = append(*tags, "failed")
+	}
+	directDialsTotal.WithLabelValues(*tags...).Inc()
+}
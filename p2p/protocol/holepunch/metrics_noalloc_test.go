@@ -0,0 +1,32 @@
+//go:build nocover
+
+package holepunch
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+func TestMetricsNoAllocNoCover(t *testing.T) {
+	sides := []string{SideInitiator, SideReceiver}
+	stages := []string{"", StageAddrExchange, StageDial, StageSecurity, StageMuxer}
+	transports := [][]string{nil, {"tcp"}, {"quic-v1", "tcp"}, {"quic", "quic-v1", "webtransport"}}
+	natTypes := []network.NATDeviceType{network.NATDeviceTypeUnknown, network.NATDeviceTypeCone, network.NATDeviceTypeSymmetric}
+
+	tr := NewMetricsTracer()
+	tests := map[string]func(){
+		"HolePunchFinished": func() {
+			tr.HolePunchFinished(sides[rand.Intn(len(sides))], stages[rand.Intn(len(stages))],
+				transports[rand.Intn(len(transports))], natTypes[rand.Intn(len(natTypes))], natTypes[rand.Intn(len(natTypes))])
+		},
+		"DirectDialFinished": func() { tr.DirectDialFinished(rand.Intn(2) == 1) },
+	}
+	for method, f := range tests {
+		allocs := testing.AllocsPerRun(1000, f)
+		if allocs > 0 {
+			t.Fatalf("Alloc Test: %s, got: %0.2f, expected: 0 allocs", method, allocs)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package holepunch
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultAttemptTimeout = 5 * time.Second
+)
+
+// retryPolicy configures how often and how fast the holePuncher retries hole punching.
+type retryPolicy struct {
+	// maxAttempts is the number of hole punching rounds before giving up.
+	maxAttempts int
+	// attemptTimeout is the timeout for the dial of each hole punching round.
+	attemptTimeout time.Duration
+	// backoff is the time to wait before the second round. It is doubled for every
+	// subsequent round.
+	backoff time.Duration
+}
+
+// WithMaxAttempts sets the number of hole punching rounds the initiator runs before
+// giving up. It defaults to 3.
+func WithMaxAttempts(n int) Option {
+	return func(hps *Service) error {
+		if n <= 0 {
+			return errors.New("number of hole punching attempts must be positive")
+		}
+		hps.retry.maxAttempts = n
+		return nil
+	}
+}
+
+// WithAttemptTimeout sets the timeout for the dial of each hole punching round, on both
+// the initiator and the responder. It defaults to 5 seconds.
+func WithAttemptTimeout(d time.Duration) Option {
+	return func(hps *Service) error {
+		if d <= 0 {
+			return errors.New("hole punching timeout must be positive")
+		}
+		hps.retry.attemptTimeout = d
+		return nil
+	}
+}
+
+// WithRetryBackoff sets the time the initiator waits after a failed hole punching
+// round before starting the next one. The backoff is doubled after every round.
+// By default, the next round is started immediately.
+func WithRetryBackoff(d time.Duration) Option {
+	return func(hps *Service) error {
+		if d < 0 {
+			return errors.New("hole punching backoff must not be negative")
+		}
+		hps.retry.backoff = d
+		return nil
+	}
+}
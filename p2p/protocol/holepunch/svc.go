@@ -38,6 +38,10 @@ const (
 // ErrClosed is returned when the hole punching is closed
 var ErrClosed = errors.New("hole punching service closing")
 
+// ErrNotInitiator is returned by RetryHolePunch if we're not behind a NAT / firewall
+// (yet), and therefore don't initiate hole punches.
+var ErrNotInitiator = errors.New("hole punching is only initiated by private nodes")
+
 type Option func(*Service) error
 
 // The Service runs on every node that supports the DCUtR protocol.
@@ -55,6 +59,8 @@ type Service struct {
 
 	tracer *tracer
 	filter AddrFilter
+	retry  retryPolicy
+	tcp    tcpConfig
 
 	refCount sync.WaitGroup
 }
@@ -76,6 +82,12 @@ func NewService(h host.Host, ids identify.IDService, opts ...Option) (*Service,
 		host:               h,
 		ids:                ids,
 		hasPublicAddrsChan: make(chan struct{}),
+		tracer:             newTracer(h.ID()),
+		retry: retryPolicy{
+			maxAttempts:    defaultMaxAttempts,
+			attemptTimeout: defaultAttemptTimeout,
+		},
+		tcp: tcpConfig{attempts: 1},
 	}
 
 	for _, opt := range opts {
@@ -84,6 +96,24 @@ func NewService(h host.Host, ids identify.IDService, opts ...Option) (*Service,
 			return nil, err
 		}
 	}
+	emitter, err := h.EventBus().Emitter(new(event.EvtHolePunchFinished))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s.tracer.emitter = emitter
+	s.tracer.Start()
+
+	if s.tracer.enabled() {
+		sub, err := h.EventBus().Subscribe(new(event.EvtNATDeviceTypeChanged), eventbus.Name("holepunch (NAT type)"))
+		if err != nil {
+			s.tracer.Close()
+			cancel()
+			return nil, err
+		}
+		s.refCount.Add(1)
+		go s.watchNATDeviceType(sub)
+	}
 
 	s.refCount.Add(1)
 	go s.watchForPublicAddr()
@@ -142,7 +172,7 @@ func (s *Service) watchForPublicAddr() {
 				continue
 			}
 			s.holePuncherMx.Lock()
-			s.holePuncher = newHolePuncher(s.host, s.ids, s.tracer, s.filter)
+			s.holePuncher = newHolePuncher(s.host, s.ids, s.tracer, s.filter, s.retry, s.tcp)
 			s.holePuncherMx.Unlock()
 			close(s.hasPublicAddrsChan)
 			return
@@ -150,6 +180,25 @@ func (s *Service) watchForPublicAddr() {
 	}
 }
 
+// watchNATDeviceType records the NAT device types detected by identify, which are
+// reported by the tracer as hints for the outcome of hole punches.
+func (s *Service) watchNATDeviceType(sub event.Subscription) {
+	defer s.refCount.Done()
+	defer sub.Close()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			evt := e.(event.EvtNATDeviceTypeChanged)
+			s.tracer.SetNATDeviceType(evt.TransportProtocol, evt.NatDeviceType)
+		}
+	}
+}
+
 // Close closes the Hole Punch Service.
 func (s *Service) Close() error {
 	var err error
@@ -170,7 +219,7 @@ func (s *Service) incomingHolePunch(str network.Stream) (rtt time.Duration, addr
 	if !isRelayAddress(str.Conn().RemoteMultiaddr()) {
 		return 0, nil, fmt.Errorf("received hole punch stream: %s", str.Conn().RemoteMultiaddr())
 	}
-	ownAddrs := removeRelayAddrs(s.ids.OwnObservedAddrs())
+	ownAddrs := addCertHashes(s.host, removeRelayAddrs(s.ids.OwnObservedAddrs()))
 	if s.filter != nil {
 		ownAddrs = s.filter.FilterLocal(str.Conn().RemotePeer(), ownAddrs)
 	}
@@ -201,7 +250,7 @@ func (s *Service) incomingHolePunch(str network.Stream) (rtt time.Duration, addr
 		return 0, nil, fmt.Errorf("expected CONNECT message from initiator but got %d", t)
 	}
 
-	obsDial := removeRelayAddrs(addrsFromBytes(msg.ObsAddrs))
+	obsDial := removeAddrsWithoutCertHashes(removeRelayAddrs(addrsFromBytes(msg.ObsAddrs)))
 	if s.filter != nil {
 		obsDial = s.filter.FilterRemote(str.Conn().RemotePeer(), obsDial)
 	}
@@ -251,7 +300,7 @@ func (s *Service) handleNewStream(str network.Stream) {
 	rp := str.Conn().RemotePeer()
 	rtt, addrs, err := s.incomingHolePunch(str)
 	if err != nil {
-		s.tracer.ProtocolError(rp, err)
+		s.tracer.ProtocolError(rp, SideReceiver, err)
 		log.Debugw("error handling holepunching stream from", "peer", rp, "error", err)
 		str.Reset()
 		return
@@ -263,13 +312,13 @@ func (s *Service) handleNewStream(str network.Stream) {
 		ID:    rp,
 		Addrs: addrs,
 	}
-	s.tracer.StartHolePunch(rp, addrs, rtt)
+	s.tracer.StartHolePunch(rp, SideReceiver, addrs, rtt)
 	log.Debugw("starting hole punch", "peer", rp)
 	start := time.Now()
 	s.tracer.HolePunchAttempt(pi.ID)
-	err = holePunchConnect(s.ctx, s.host, pi, false)
+	err = holePunchConnect(s.ctx, s.host, pi, false, s.retry.attemptTimeout, s.tcp)
 	dt := time.Since(start)
-	s.tracer.EndHolePunch(rp, dt, err)
+	s.tracer.EndHolePunch(rp, SideReceiver, addrs, dt, err)
 }
 
 // DirectConnect is only exposed for testing purposes.
@@ -281,3 +330,21 @@ func (s *Service) DirectConnect(p peer.ID) error {
 	s.holePuncherMx.Unlock()
 	return holePuncher.DirectConnect(p)
 }
+
+// RetryHolePunch triggers a new hole punch with peer p, which we must be connected to
+// through a relay. It runs the configured number of hole punching rounds and returns
+// once we have a direct connection to p, or all rounds failed.
+// It returns ErrHolePunchActive if a hole punch with p is already running, and
+// ErrNotInitiator if we aren't initiating hole punches, as we're not behind a NAT.
+func (s *Service) RetryHolePunch(p peer.ID) error {
+	s.holePuncherMx.Lock()
+	holePuncher := s.holePuncher
+	s.holePuncherMx.Unlock()
+	if holePuncher == nil {
+		return ErrNotInitiator
+	}
+	if s.host.Network().Connectedness(p) != network.Connected {
+		return fmt.Errorf("not connected to peer %s", p)
+	}
+	return holePuncher.DirectConnect(p)
+}
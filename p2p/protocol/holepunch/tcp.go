@@ -0,0 +1,102 @@
+package holepunch
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// tcpSimOpenInterval is the time between two TCP simultaneous open attempts of one
+// hole punching round.
+const tcpSimOpenInterval = 100 * time.Millisecond
+
+// tcpConfig configures the TCP simultaneous open of a hole punching round.
+type tcpConfig struct {
+	// attempts is the number of times the TCP addresses are dialed in each round.
+	attempts int
+	// predictedPorts is the number of ports following the port of each observed TCP
+	// address that are dialed in addition.
+	predictedPorts int
+}
+
+// WithTCPSimultaneousOpenAttempts sets the number of times the TCP addresses of the
+// remote peer are dialed in each hole punching round, until a connection is
+// established or the round times out. A TCP simultaneous open only succeeds if the
+// SYNs of both peers cross, which often isn't the case for the first SYN, when the
+// NAT of the remote peer hasn't created its mapping yet. It defaults to 1.
+func WithTCPSimultaneousOpenAttempts(n int) Option {
+	return func(hps *Service) error {
+		if n <= 0 {
+			return errors.New("number of TCP simultaneous open attempts must be positive")
+		}
+		hps.tcp.attempts = n
+		return nil
+	}
+}
+
+// WithTCPPortPrediction enables sequential port prediction for TCP hole punching.
+// Some NATs allocate the source ports of new mappings sequentially, so that the port
+// the remote peer's NAT uses for the hole punch is likely one of the n ports following
+// the one that was observed. These ports are dialed in addition to the observed ones.
+func WithTCPPortPrediction(n int) Option {
+	return func(hps *Service) error {
+		if n < 0 {
+			return errors.New("number of predicted TCP ports must not be negative")
+		}
+		hps.tcp.predictedPorts = n
+		return nil
+	}
+}
+
+// predictTCPAddrs returns addrs followed by the addresses with the n ports following
+// the port of every TCP address in addrs.
+func predictTCPAddrs(addrs []ma.Multiaddr, n int) []ma.Multiaddr {
+	if n == 0 {
+		return addrs
+	}
+	result := append(make([]ma.Multiaddr, 0, len(addrs)), addrs...)
+	for _, a := range addrs {
+		if !isTCPAddr(a) {
+			continue
+		}
+		ip, _ := ma.SplitFirst(a)
+		tcpPort, err := a.ValueForProtocol(ma.P_TCP)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.Atoi(tcpPort)
+		if err != nil {
+			continue
+		}
+		for i := 1; i <= n && port+i <= 65535; i++ {
+			c, err := ma.NewComponent("tcp", strconv.Itoa(port+i))
+			if err != nil {
+				break
+			}
+			result = append(result, ma.Join(ip, c))
+		}
+	}
+	return result
+}
+
+// tcpAddrs returns the plain TCP addresses in addrs.
+func tcpAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	var result []ma.Multiaddr
+	for _, a := range addrs {
+		if isTCPAddr(a) {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// isTCPAddr returns true if a is an /ip4 or /ip6 address followed by a TCP port.
+func isTCPAddr(a ma.Multiaddr) bool {
+	protos := a.Protocols()
+	if len(protos) != 2 || protos[1].Code != ma.P_TCP {
+		return false
+	}
+	return protos[0].Code == ma.P_IP4 || protos[0].Code == ma.P_IP6
+}
@@ -0,0 +1,24 @@
+package holepunch
+
+import (
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPredictTCPAddrs(t *testing.T) {
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1234"),
+		ma.StringCast("/ip6/::1/tcp/65534"),
+		ma.StringCast("/ip4/1.2.3.4/udp/1234/quic-v1"),
+		ma.StringCast("/ip4/1.2.3.4/tcp/1234/ws"),
+	}
+	require.Equal(t, addrs, predictTCPAddrs(addrs, 0))
+	require.Equal(t, append(addrs,
+		ma.StringCast("/ip4/1.2.3.4/tcp/1235"),
+		ma.StringCast("/ip4/1.2.3.4/tcp/1236"),
+		ma.StringCast("/ip6/::1/tcp/65535"),
+	), predictTCPAddrs(addrs, 2))
+	require.Equal(t, addrs[:2], tcpAddrs(addrs))
+}
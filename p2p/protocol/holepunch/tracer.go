@@ -2,11 +2,16 @@ package holepunch
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 
 	ma "github.com/multiformats/go-multiaddr"
 )
@@ -19,25 +24,26 @@ const (
 // WithTracer is a Service option that enables hole punching tracing
 func WithTracer(tr EventTracer) Option {
 	return func(hps *Service) error {
-		t := &tracer{
-			tr:   tr,
-			self: hps.host.ID(),
-			peers: make(map[peer.ID]struct {
-				counter int
-				last    time.Time
-			}),
-		}
-		t.refCount.Add(1)
-		t.ctx, t.ctxCancel = context.WithCancel(context.Background())
-		go t.gc()
-		hps.tracer = t
+		hps.tracer.tr = tr
+		return nil
+	}
+}
+
+// WithMetricsTracer is a Service option that enables hole punching metrics
+func WithMetricsTracer(mt MetricsTracer) Option {
+	return func(hps *Service) error {
+		hps.tracer.mt = mt
 		return nil
 	}
 }
 
 type tracer struct {
 	tr   EventTracer
+	mt   MetricsTracer
 	self peer.ID
+	// emitter emits an event.EvtHolePunchFinished for every hole punch, it is nil
+	// if there is no event bus
+	emitter event.Emitter
 
 	refCount  sync.WaitGroup
 	ctx       context.Context
@@ -48,6 +54,51 @@ type tracer struct {
 		counter int
 		last    time.Time
 	}
+	// tcpNAT and udpNAT are the NAT device types detected by identify
+	tcpNAT, udpNAT network.NATDeviceType
+}
+
+func newTracer(self peer.ID) *tracer {
+	t := &tracer{
+		self: self,
+		peers: make(map[peer.ID]struct {
+			counter int
+			last    time.Time
+		}),
+	}
+	t.ctx, t.ctxCancel = context.WithCancel(context.Background())
+	return t
+}
+
+func (t *tracer) Start() {
+	if t.tr == nil {
+		return
+	}
+	t.refCount.Add(1)
+	go t.gc()
+}
+
+// enabled returns true if an EventTracer or a MetricsTracer is set.
+func (t *tracer) enabled() bool {
+	return t != nil && (t.tr != nil || t.mt != nil)
+}
+
+// SetNATDeviceType records the NAT device type detected for transport protocol proto.
+func (t *tracer) SetNATDeviceType(proto network.NATTransportProtocol, typ network.NATDeviceType) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	switch proto {
+	case network.NATTransportTCP:
+		t.tcpNAT = typ
+	case network.NATTransportUDP:
+		t.udpNAT = typ
+	}
+}
+
+func (t *tracer) natDeviceTypes() (tcp, udp network.NATDeviceType) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.tcpNAT, t.udpNAT
 }
 
 type EventTracer interface {
@@ -62,6 +113,30 @@ type Event struct {
 	Evt       interface{} // the actual event
 }
 
+// Sides of a hole punch
+const (
+	// SideInitiator is the peer behind a NAT that initiates the hole punch, after
+	// receiving a relayed connection.
+	SideInitiator = "initiator"
+	// SideReceiver is the peer that receives the hole punch request over the relayed
+	// connection it established.
+	SideReceiver = "receiver"
+)
+
+// Stages of a hole punch at which it can fail
+const (
+	// StageAddrExchange is the exchange of the CONNECT and SYNC messages over the relayed
+	// connection.
+	StageAddrExchange = "addr_exchange"
+	// StageDial is the simultaneous dial to the addresses of the remote peer.
+	StageDial = "dial"
+	// StageSecurity is the security handshake on the connection established by the
+	// simultaneous dial.
+	StageSecurity = "security"
+	// StageMuxer is the stream multiplexer negotiation on the secured connection.
+	StageMuxer = "muxer"
+)
+
 // Event Types
 const (
 	DirectDialEvtT       = "DirectDial"
@@ -80,17 +155,34 @@ type DirectDialEvt struct {
 
 type ProtocolErrorEvt struct {
 	Error string
+	// Side is the side of the hole punch we're on, SideInitiator or SideReceiver
+	Side string
+	// Stage is the stage at which the hole punch failed, which is always StageAddrExchange
+	Stage string
 }
 
 type StartHolePunchEvt struct {
 	RemoteAddrs []string
 	RTT         time.Duration
+	// Side is the side of the hole punch we're on, SideInitiator or SideReceiver
+	Side string
 }
 
 type EndHolePunchEvt struct {
 	Success      bool
 	EllapsedTime time.Duration
 	Error        string `json:",omitempty"`
+	// Side is the side of the hole punch we're on, SideInitiator or SideReceiver
+	Side string
+	// Stage is the stage at which the hole punch failed, StageDial, StageSecurity or StageMuxer
+	Stage string `json:",omitempty"`
+	// Transports are the transports of the addresses that were dialed, e.g. "tcp"
+	// and "quic-v1"
+	Transports []string
+	// TCPNATDeviceType and UDPNATDeviceType are the types of our NAT, as far as
+	// they have been detected, which hint at the chances of hole punching success.
+	TCPNATDeviceType string `json:",omitempty"`
+	UDPNATDeviceType string `json:",omitempty"`
 }
 
 type HolePunchAttemptEvt struct {
@@ -102,6 +194,12 @@ func (t *tracer) DirectDialSuccessful(p peer.ID, dt time.Duration) {
 	if t == nil {
 		return
 	}
+	if t.mt != nil {
+		t.mt.DirectDialFinished(true)
+	}
+	if t.tr == nil {
+		return
+	}
 
 	t.tr.Trace(&Event{
 		Timestamp: time.Now().UnixNano(),
@@ -119,6 +217,12 @@ func (t *tracer) DirectDialFailed(p peer.ID, dt time.Duration, err error) {
 	if t == nil {
 		return
 	}
+	if t.mt != nil {
+		t.mt.DirectDialFinished(false)
+	}
+	if t.tr == nil {
+		return
+	}
 
 	t.tr.Trace(&Event{
 		Timestamp: time.Now().UnixNano(),
@@ -133,10 +237,17 @@ func (t *tracer) DirectDialFailed(p peer.ID, dt time.Duration, err error) {
 	})
 }
 
-func (t *tracer) ProtocolError(p peer.ID, err error) {
+func (t *tracer) ProtocolError(p peer.ID, side string, err error) {
 	if t == nil {
 		return
 	}
+	if t.mt != nil {
+		tcpNAT, udpNAT := t.natDeviceTypes()
+		t.mt.HolePunchFinished(side, StageAddrExchange, nil, tcpNAT, udpNAT)
+	}
+	if t.tr == nil {
+		return
+	}
 
 	t.tr.Trace(&Event{
 		Timestamp: time.Now().UnixNano(),
@@ -145,12 +256,14 @@ func (t *tracer) ProtocolError(p peer.ID, err error) {
 		Type:      ProtocolErrorEvtT,
 		Evt: &ProtocolErrorEvt{
 			Error: err.Error(),
+			Side:  side,
+			Stage: StageAddrExchange,
 		},
 	})
 }
 
-func (t *tracer) StartHolePunch(p peer.ID, obsAddrs []ma.Multiaddr, rtt time.Duration) {
-	if t == nil {
+func (t *tracer) StartHolePunch(p peer.ID, side string, obsAddrs []ma.Multiaddr, rtt time.Duration) {
+	if t == nil || t.tr == nil {
 		return
 	}
 
@@ -167,22 +280,53 @@ func (t *tracer) StartHolePunch(p peer.ID, obsAddrs []ma.Multiaddr, rtt time.Dur
 		Evt: &StartHolePunchEvt{
 			RemoteAddrs: addrs,
 			RTT:         rtt,
+			Side:        side,
 		},
 	})
 }
 
-func (t *tracer) EndHolePunch(p peer.ID, dt time.Duration, err error) {
-	if t == nil {
+// EndHolePunch is called when the simultaneous dial to the addrs of p ends.
+func (t *tracer) EndHolePunch(p peer.ID, side string, addrs []ma.Multiaddr, dt time.Duration, err error) {
+	if t != nil && t.emitter != nil {
+		evt := event.EvtHolePunchFinished{Peer: p, Initiator: side == SideInitiator, Success: err == nil, Duration: dt}
+		if err != nil {
+			evt.Error = err.Error()
+		}
+		t.emitter.Emit(evt)
+	}
+	if !t.enabled() {
+		return
+	}
+
+	var stage string
+	if err != nil {
+		stage = failureStage(err)
+	}
+	transports := dialedTransports(addrs)
+	tcpNAT, udpNAT := t.natDeviceTypes()
+	if t.mt != nil {
+		t.mt.HolePunchFinished(side, stage, transports, tcpNAT, udpNAT)
+	}
+	if t.tr == nil {
 		return
 	}
 
 	evt := &EndHolePunchEvt{
 		Success:      err == nil,
 		EllapsedTime: dt,
+		Side:         side,
+		Stage:        stage,
+		Transports:   transports,
 	}
 	if err != nil {
 		evt.Error = err.Error()
 	}
+	if tcpNAT != network.NATDeviceTypeUnknown {
+		evt.TCPNATDeviceType = tcpNAT.String()
+	}
+	if udpNAT != network.NATDeviceTypeUnknown {
+		evt.UDPNATDeviceType = udpNAT.String()
+	}
 
 	t.tr.Trace(&Event{
 		Timestamp: time.Now().UnixNano(),
@@ -194,7 +338,7 @@ func (t *tracer) EndHolePunch(p peer.ID, dt time.Duration, err error) {
 }
 
 func (t *tracer) HolePunchAttempt(p peer.ID) {
-	if t == nil {
+	if t == nil || t.tr == nil {
 		return
 	}
 
@@ -217,10 +361,7 @@ func (t *tracer) HolePunchAttempt(p peer.ID) {
 }
 
 func (t *tracer) gc() {
-	defer func() {
-		fmt.Println("done")
-		t.refCount.Done()
-	}()
+	defer t.refCount.Done()
 
 	timer := time.NewTicker(tracerGCInterval)
 	defer timer.Stop()
@@ -249,5 +390,77 @@ func (t *tracer) Close() error {
 
 	t.ctxCancel()
 	t.refCount.Wait()
+	if t.emitter != nil {
+		t.emitter.Close()
+	}
+	return nil
+}
+
+// failureStage determines the stage at which the simultaneous dial failed with err.
+func failureStage(err error) string {
+	if uerr := upgradeError(err); uerr != nil {
+		switch uerr.Stage {
+		case transport.UpgradeStageSecurity:
+			return StageSecurity
+		case transport.UpgradeStageMuxer:
+			return StageMuxer
+		}
+	}
+	return StageDial
+}
+
+// upgradeError returns the error of the failed upgrade of a connection established by
+// the dial that failed with err, if there is one. The swarm reports the failures of
+// the dials to the individual addresses in its DialError.
+func upgradeError(err error) *transport.UpgradeError {
+	var uerr *transport.UpgradeError
+	if errors.As(err, &uerr) {
+		return uerr
+	}
+	var derr *swarm.DialError
+	if errors.As(err, &derr) {
+		for _, te := range derr.DialErrors {
+			if errors.As(te.Cause, &uerr) {
+				return uerr
+			}
+		}
+	}
 	return nil
 }
+
+// dialedTransports returns the transports of addrs, sorted and without duplicates.
+func dialedTransports(addrs []ma.Multiaddr) []string {
+	transports := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		tpt := addrTransport(a)
+		if tpt == "" {
+			continue
+		}
+		found := false
+		for _, t := range transports {
+			if t == tpt {
+				found = true
+				break
+			}
+		}
+		if !found {
+			transports = append(transports, tpt)
+		}
+	}
+	sort.Strings(transports)
+	return transports
+}
+
+// addrTransport returns the name of the transport used to dial a, i.e. the name of
+// its outermost transport protocol.
+func addrTransport(a ma.Multiaddr) string {
+	var tpt string
+	ma.ForEach(a, func(c ma.Component) bool {
+		switch c.Protocol().Code {
+		case ma.P_TCP, ma.P_UDP, ma.P_QUIC, ma.P_QUIC_V1, ma.P_WEBTRANSPORT, ma.P_WEBRTC_DIRECT, ma.P_WS, ma.P_WSS:
+			tpt = c.Protocol().Name
+		}
+		return true
+	})
+	return tpt
+}
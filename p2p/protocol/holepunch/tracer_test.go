@@ -0,0 +1,33 @@
+package holepunch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureStage(t *testing.T) {
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	dialErr := func(causes ...error) error {
+		derr := &swarm.DialError{Cause: swarm.ErrAllDialsFailed}
+		for _, c := range causes {
+			derr.DialErrors = append(derr.DialErrors, swarm.TransportError{Address: addr, Cause: c})
+		}
+		return fmt.Errorf("failed to connect: %w", derr)
+	}
+	security := &transport.UpgradeError{Stage: transport.UpgradeStageSecurity, Err: errors.New("handshake failed")}
+	muxer := &transport.UpgradeError{Stage: transport.UpgradeStageMuxer, Err: context.Canceled}
+
+	require.Equal(t, StageDial, failureStage(errors.New("failed to negotiate security protocol")))
+	require.Equal(t, StageDial, failureStage(dialErr(context.DeadlineExceeded)))
+	require.Equal(t, StageSecurity, failureStage(security))
+	require.Equal(t, StageMuxer, failureStage(fmt.Errorf("upgrade: %w", muxer)))
+	require.Equal(t, StageSecurity, failureStage(dialErr(context.DeadlineExceeded, security)))
+}
@@ -2,10 +2,13 @@ package holepunch
 
 import (
 	"context"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/net/addrutil"
 
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
@@ -31,6 +34,47 @@ func removeRelayAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	return result
 }
 
+// addCertHashes adds the certificate hashes of our WebTransport listeners to the
+// WebTransport addresses in addrs. Observed addresses never contain certificate
+// hashes, but WebTransport addresses can't be dialed without them.
+func addCertHashes(h host.Host, addrs []ma.Multiaddr) []ma.Multiaddr {
+	type transportForListeninger interface {
+		TransportForListening(a ma.Multiaddr) transport.Transport
+	}
+	type addCertHasher interface {
+		AddCertHashes(m ma.Multiaddr) (ma.Multiaddr, bool)
+	}
+
+	s, ok := h.Network().(transportForListeninger)
+	if !ok {
+		return addrs
+	}
+	result := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if addrutil.MissingCertHash(a) {
+			if tpt, ok := s.TransportForListening(a).(addCertHasher); ok {
+				if withCertHashes, added := tpt.AddCertHashes(a); added {
+					a = withCertHashes
+				}
+			}
+		}
+		result = append(result, a)
+	}
+	return result
+}
+
+// removeAddrsWithoutCertHashes removes the WebTransport and WebRTC addresses that can't be dialed
+// as they don't contain any certificate hashes.
+func removeAddrsWithoutCertHashes(addrs []ma.Multiaddr) []ma.Multiaddr {
+	result := make([]ma.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		if !addrutil.MissingCertHash(addr) {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
 func isRelayAddress(a ma.Multiaddr) bool {
 	_, err := a.ValueForProtocol(ma.P_CIRCUIT)
 	return err == nil
@@ -55,13 +99,29 @@ func addrsFromBytes(bzs [][]byte) []ma.Multiaddr {
 	return addrs
 }
 
-func holePunchConnect(ctx context.Context, host host.Host, pi peer.AddrInfo, isClient bool) error {
+func holePunchConnect(ctx context.Context, host host.Host, pi peer.AddrInfo, isClient bool, timeout time.Duration, tcp tcpConfig) error {
 	holePunchCtx := network.WithSimultaneousConnect(ctx, isClient, "hole-punching")
 	forceDirectConnCtx := network.WithForceDirectDial(holePunchCtx, "hole-punching")
-	dialCtx, cancel := context.WithTimeout(forceDirectConnCtx, dialTimeout)
+	dialCtx, cancel := context.WithTimeout(forceDirectConnCtx, timeout)
 	defer cancel()
 
-	if err := host.Connect(dialCtx, pi); err != nil {
+	pi.Addrs = predictTCPAddrs(pi.Addrs, tcp.predictedPorts)
+	err := host.Connect(dialCtx, pi)
+	// retry the TCP simultaneous open, the direct dial doesn't back off
+	for i := 1; err != nil && i < tcp.attempts; i++ {
+		addrs := tcpAddrs(pi.Addrs)
+		if len(addrs) == 0 {
+			break
+		}
+		log.Debugw("TCP simultaneous open with peer failed, retrying", "peer ID", pi.ID, "attempt", i, "error", err)
+		select {
+		case <-time.After(tcpSimOpenInterval):
+		case <-dialCtx.Done():
+			return err
+		}
+		err = host.Connect(dialCtx, peer.AddrInfo{ID: pi.ID, Addrs: addrs})
+	}
+	if err != nil {
 		log.Debugw("hole punch attempt with peer failed", "peer ID", pi.ID, "error", err)
 		return err
 	}
@@ -2,6 +2,7 @@ package identify
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -44,6 +45,14 @@ const ServiceName = "libp2p.identify"
 
 const maxPushConcurrency = 32
 
+// DefaultPushQuietPeriod is the default value for the PushQuietPeriod option.
+const DefaultPushQuietPeriod = 100 * time.Millisecond
+
+// maxPushDelayFactor bounds how long pushes can be held back by a continuous
+// stream of changes: a push is sent at the latest maxPushDelayFactor quiet
+// periods after the first unsent change.
+const maxPushDelayFactor = 10
+
 // StreamReadTimeout is the read timeout on all incoming Identify family streams.
 var StreamReadTimeout = 60 * time.Second
 
@@ -53,8 +62,16 @@ const (
 	maxMessages  = 10
 )
 
+// DefaultMaxMessageSize is the default maximum size of a single identify message we accept.
+// We also split the messages we send, such that every message is smaller than the maximum size.
+const DefaultMaxMessageSize = signedIDSize
+
 var defaultUserAgent = "github.com/libp2p/go-libp2p"
 
+// ErrNoSignedPeerRecord is returned when identifying a peer that didn't send a valid
+// signed peer record, and signed peer records are required.
+var ErrNoSignedPeerRecord = errors.New("peer did not send a valid signed peer record")
+
 type identifySnapshot struct {
 	seq       uint64
 	protocols []protocol.ID
@@ -81,6 +98,15 @@ type IDService interface {
 	io.Closer
 }
 
+// ObservationsProvider is implemented by the IDService returned by NewIDService.
+// Check for it with a type assertion, e.g. on the IDService of a host.
+type ObservationsProvider interface {
+	// OwnObservations returns all the addresses peers have reported we've dialed
+	// from, including the ones that aren't advertised, with how many peers reported
+	// them.
+	OwnObservations() []ObservedAddr
+}
+
 type identifyPushSupport uint8
 
 const (
@@ -99,6 +125,8 @@ type entry struct {
 	PushSupport identifyPushSupport
 	// Sequence is the sequence number of the last snapshot we sent to this peer.
 	Sequence uint64
+	// LastPush is the time we last sent an Identify Push on this connection.
+	LastPush time.Time
 }
 
 // idService is a structure that implements ProtocolIdentify.
@@ -115,6 +143,8 @@ type idService struct {
 	ProtocolVersion string
 
 	metricsTracer MetricsTracer
+	// extMetricsTracer is set if metricsTracer is an ExtendedMetricsTracer
+	extMetricsTracer ExtendedMetricsTracer
 
 	setupCompleted chan struct{} // is closed when Start has finished setting up
 	ctx            context.Context
@@ -123,6 +153,19 @@ type idService struct {
 	refCount sync.WaitGroup
 
 	disableSignedPeerRecord bool
+	requireSignedPeerRecord bool
+
+	timeout        time.Duration
+	maxMessageSize int
+
+	pushQuietPeriod time.Duration
+	minPushInterval time.Duration
+
+	listenAddrsFilter  ListenAddrsFilter
+	observedAddrFilter ObservedAddrFilter
+
+	connUserAgent func(network.Conn) string
+	inboundPolicy InboundPolicy
 
 	connsMu sync.RWMutex
 	// The conns map contains all connections we're currently handling.
@@ -149,8 +192,13 @@ type idService struct {
 
 // NewIDService constructs a new *idService and activates it by
 // attaching its stream handler to the given host.Host.
+var _ ObservationsProvider = (*idService)(nil)
+
 func NewIDService(h host.Host, opts ...Option) (*idService, error) {
-	var cfg config
+	cfg := config{
+		pushQuietPeriod: DefaultPushQuietPeriod,
+		maxMessageSize:  DefaultMaxMessageSize,
+	}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
@@ -165,6 +213,16 @@ func NewIDService(h host.Host, opts ...Option) (*idService, error) {
 		protocolVersion = cfg.protocolVersion
 	}
 
+	if cfg.minObservers < 0 || cfg.stablePeriod < 0 {
+		return nil, errors.New("invalid observed address damping")
+	}
+	if cfg.maxMessageSize <= 0 {
+		return nil, errors.New("maximum identify message size must be positive")
+	}
+	if cfg.requireSignedPeerRecord && cfg.disableSignedPeerRecord {
+		return nil, errors.New("cannot require signed peer records when signed peer records are disabled")
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	s := &idService{
 		Host:                    h,
@@ -174,15 +232,28 @@ func NewIDService(h host.Host, opts ...Option) (*idService, error) {
 		ctxCancel:               cancel,
 		conns:                   make(map[network.Conn]entry),
 		disableSignedPeerRecord: cfg.disableSignedPeerRecord,
+		requireSignedPeerRecord: cfg.requireSignedPeerRecord,
+		timeout:                 cfg.timeout,
+		maxMessageSize:          cfg.maxMessageSize,
 		setupCompleted:          make(chan struct{}),
 		metricsTracer:           cfg.metricsTracer,
+		pushQuietPeriod:         cfg.pushQuietPeriod,
+		minPushInterval:         cfg.minPushInterval,
+		listenAddrsFilter:       cfg.listenAddrsFilter,
+		observedAddrFilter:      cfg.observedAddrFilter,
+		connUserAgent:           cfg.connUserAgent,
+		inboundPolicy:           cfg.inboundPolicy,
 	}
+	s.extMetricsTracer, _ = cfg.metricsTracer.(ExtendedMetricsTracer)
 
 	observedAddrs, err := NewObservedAddrManager(h)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create observed address manager: %s", err)
 	}
 	s.observedAddrs = observedAddrs
+	if cfg.minObservers != 0 || cfg.stablePeriod != 0 {
+		observedAddrs.SetDamping(cfg.minObservers, cfg.stablePeriod)
+	}
 
 	s.emitters.evtPeerProtocolsUpdated, err = h.EventBus().Emitter(&event.EvtPeerProtocolsUpdated{})
 	if err != nil {
@@ -230,18 +301,7 @@ func (ids *idService) loop(ctx context.Context) {
 	// * another push being queued in the triggerPush channel
 	triggerPush := make(chan struct{}, 1)
 	ids.refCount.Add(1)
-	go func() {
-		defer ids.refCount.Done()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-triggerPush:
-				ids.sendPushes(ctx)
-			}
-		}
-	}()
+	go ids.pushLoop(ctx, triggerPush)
 
 	for {
 		select {
@@ -263,7 +323,73 @@ func (ids *idService) loop(ctx context.Context) {
 	}
 }
 
-func (ids *idService) sendPushes(ctx context.Context) {
+// pushLoop sends pushes when triggered.
+// Triggers that arrive within the quiet period are coalesced into a single push.
+// Connections that were skipped due to the minimum push interval are retried
+// once the interval has elapsed.
+func (ids *idService) pushLoop(ctx context.Context, triggerPush <-chan struct{}) {
+	defer ids.refCount.Done()
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	// firstPending is the time of the first trigger that hasn't resulted in a push yet.
+	var firstPending time.Time
+	// retryAt is the time at which connections that were rate limited can be pushed to.
+	var retryAt time.Time
+	resetTimer := func() {
+		var next time.Time
+		if !firstPending.IsZero() {
+			next = time.Now().Add(ids.pushQuietPeriod)
+			if deadline := firstPending.Add(maxPushDelayFactor * ids.pushQuietPeriod); next.After(deadline) {
+				next = deadline
+			}
+		}
+		if !retryAt.IsZero() && (next.IsZero() || retryAt.Before(next)) {
+			next = retryAt
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+	}
+	push := func() {
+		firstPending = time.Time{}
+		retryAt = ids.sendPushes(ctx)
+		resetTimer()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-triggerPush:
+			if ids.pushQuietPeriod <= 0 {
+				push()
+				continue
+			}
+			if firstPending.IsZero() {
+				firstPending = time.Now()
+			}
+			resetTimer()
+		case <-timer.C:
+			push()
+		}
+	}
+}
+
+// sendPushes sends the current snapshot to all connections that haven't received it yet.
+// If some connections were skipped due to the minimum push interval, it returns
+// the time at which the next of these connections can be pushed to.
+func (ids *idService) sendPushes(ctx context.Context) (retryAt time.Time) {
 	ids.connsMu.RLock()
 	conns := make([]network.Conn, 0, len(ids.conns))
 	for c, e := range ids.conns {
@@ -293,7 +419,25 @@ func (ids *idService) sendPushes(ctx context.Context) {
 			log.Debugw("already sent this snapshot to peer", "peer", c.RemotePeer(), "seq", snapshot.seq)
 			continue
 		}
+		// check if we're allowed to push to this peer again
+		if ids.minPushInterval > 0 && !e.LastPush.IsZero() {
+			if next := e.LastPush.Add(ids.minPushInterval); time.Now().Before(next) {
+				log.Debugw("delaying identify push to peer", "peer", c.RemotePeer(), "seq", snapshot.seq, "until", next)
+				if retryAt.IsZero() || next.Before(retryAt) {
+					retryAt = next
+				}
+				continue
+			}
+		}
 		// we haven't, send it now
+		if ids.minPushInterval > 0 {
+			ids.connsMu.Lock()
+			if e, ok := ids.conns[c]; ok {
+				e.LastPush = time.Now()
+				ids.conns[c] = e
+			}
+			ids.connsMu.Unlock()
+		}
 		sem <- struct{}{}
 		wg.Add(1)
 		go func(c network.Conn) {
@@ -303,6 +447,9 @@ func (ids *idService) sendPushes(ctx context.Context) {
 			defer cancel()
 			str, err := ids.Host.NewStream(ctx, c.RemotePeer(), IDPush)
 			if err != nil { // connection might have been closed recently
+				if ids.extMetricsTracer != nil {
+					ids.extMetricsTracer.IdentifyFailed(true, true)
+				}
 				return
 			}
 			// TODO: find out if the peer supports push if we didn't have any information about push support
@@ -313,6 +460,7 @@ func (ids *idService) sendPushes(ctx context.Context) {
 		}(c)
 	}
 	wg.Wait()
+	return retryAt
 }
 
 // Close shuts down the idService
@@ -331,6 +479,10 @@ func (ids *idService) ObservedAddrsFor(local ma.Multiaddr) []ma.Multiaddr {
 	return ids.observedAddrs.AddrsFor(local)
 }
 
+func (ids *idService) OwnObservations() []ObservedAddr {
+	return ids.observedAddrs.Observations()
+}
+
 // IdentifyConn runs the Identify protocol on a connection.
 // It returns when we've received the peer's Identify message (or the request fails).
 // If successful, the peer store will contain the peer's addresses and supported protocols.
@@ -385,9 +537,13 @@ func (ids *idService) IdentifyWait(c network.Conn) <-chan struct{} {
 }
 
 func (ids *idService) identifyConn(c network.Conn) error {
+	start := time.Now()
 	s, err := c.NewStream(network.WithUseTransient(context.TODO(), "identify"))
 	if err != nil {
 		log.Debugw("error opening identify stream", "peer", c.RemotePeer(), "error", err)
+		if ids.extMetricsTracer != nil {
+			ids.extMetricsTracer.IdentifyFailed(false, false)
+		}
 		return err
 	}
 
@@ -400,10 +556,19 @@ func (ids *idService) identifyConn(c network.Conn) error {
 	if err := msmux.SelectProtoOrFail(ID, s); err != nil {
 		log.Infow("failed negotiate identify protocol with peer", "peer", c.RemotePeer(), "error", err)
 		s.Reset()
+		if ids.extMetricsTracer != nil {
+			ids.extMetricsTracer.IdentifyFailed(false, false)
+		}
 		return err
 	}
 
-	return ids.handleIdentifyResponse(s, false)
+	if err := ids.handleIdentifyResponse(s, false); err != nil {
+		return err
+	}
+	if ids.extMetricsTracer != nil {
+		ids.extMetricsTracer.IdentifyRoundTrip(time.Since(start))
+	}
+	return nil
 }
 
 // handlePush handles incoming identify push streams
@@ -428,17 +593,31 @@ func (ids *idService) sendIdentifyResp(s network.Stream, isPush bool) error {
 
 	log.Debugw("sending snapshot", "seq", snapshot.seq, "protocols", snapshot.protocols, "addrs", snapshot.addrs)
 
-	mes := ids.createBaseIdentifyResponse(s.Conn(), &snapshot)
-	mes.SignedPeerRecord = ids.getSignedRecord(&snapshot)
+	addrs := ids.disclosedAddrs(s.Conn(), &snapshot)
+	if ids.requireSignedPeerRecord {
+		// In strict mode, we don't advertise addresses that we can't certify.
+		addrs = certifiedAddrs(snapshot.record, addrs)
+	}
+	mes := ids.createBaseIdentifyResponse(s.Conn(), &snapshot, addrs)
+	mes.SignedPeerRecord = ids.getSignedRecord(&snapshot, addrs)
 
 	log.Debugf("%s sending message to %s %s", ID, s.Conn().RemotePeer(), s.Conn().RemoteMultiaddr())
+	_ = s.SetWriteDeadline(time.Now().Add(ids.streamTimeout()))
+	size := proto.Size(mes)
 	if err := ids.writeChunkedIdentifyMsg(s, mes); err != nil {
+		s.Reset()
+		if ids.extMetricsTracer != nil {
+			ids.extMetricsTracer.IdentifyFailed(isPush, true)
+		}
 		return err
 	}
 
 	if ids.metricsTracer != nil {
 		ids.metricsTracer.IdentifySent(isPush, len(mes.Protocols), len(mes.ListenAddrs))
 	}
+	if ids.extMetricsTracer != nil {
+		ids.extMetricsTracer.MessageSize(isPush, true, size)
+	}
 
 	ids.connsMu.Lock()
 	defer ids.connsMu.Unlock()
@@ -462,23 +641,26 @@ func (ids *idService) handleIdentifyResponse(s network.Stream, isPush bool) erro
 		return err
 	}
 
-	if err := s.Scope().ReserveMemory(signedIDSize, network.ReservationPriorityAlways); err != nil {
+	if err := s.Scope().ReserveMemory(ids.maxMessageSize, network.ReservationPriorityAlways); err != nil {
 		log.Warnf("error reserving memory for identify stream: %s", err)
 		s.Reset()
 		return err
 	}
-	defer s.Scope().ReleaseMemory(signedIDSize)
+	defer s.Scope().ReleaseMemory(ids.maxMessageSize)
 
-	_ = s.SetReadDeadline(time.Now().Add(StreamReadTimeout))
+	_ = s.SetReadDeadline(time.Now().Add(ids.streamTimeout()))
 
 	c := s.Conn()
 
-	r := pbio.NewDelimitedReader(s, signedIDSize)
+	r := pbio.NewDelimitedReader(s, ids.maxMessageSize)
 	mes := &pb.Identify{}
 
 	if err := readAllIDMessages(r, mes); err != nil {
 		log.Warn("error reading identify message: ", err)
 		s.Reset()
+		if ids.extMetricsTracer != nil {
+			ids.extMetricsTracer.IdentifyFailed(isPush, false)
+		}
 		return err
 	}
 
@@ -486,17 +668,34 @@ func (ids *idService) handleIdentifyResponse(s network.Stream, isPush bool) erro
 
 	log.Debugf("%s received message from %s %s", s.Protocol(), c.RemotePeer(), c.RemoteMultiaddr())
 
-	ids.consumeMessage(mes, c, isPush)
+	if ids.inboundPolicy != nil && c.Stat().Direction == network.DirInbound {
+		if err := ids.inboundPolicy(c, mes.GetAgentVersion(), mes.GetProtocolVersion()); err != nil {
+			log.Debugw("closing connection rejected by inbound policy", "peer", c.RemotePeer(), "agent", mes.GetAgentVersion(), "error", err)
+			if ids.extMetricsTracer != nil {
+				ids.extMetricsTracer.IdentifyRejected(isPush, RejectionInboundPolicy)
+			}
+			c.Close()
+			return fmt.Errorf("connection rejected by inbound policy: %w", err)
+		}
+	}
+
+	consumeErr := ids.consumeMessage(mes, c, isPush)
 
 	if ids.metricsTracer != nil {
 		ids.metricsTracer.IdentifyReceived(isPush, len(mes.Protocols), len(mes.ListenAddrs))
 	}
+	if ids.extMetricsTracer != nil {
+		ids.extMetricsTracer.MessageSize(isPush, false, proto.Size(mes))
+		if consumeErr == ErrNoSignedPeerRecord {
+			ids.extMetricsTracer.IdentifyRejected(isPush, RejectionNoSignedPeerRecord)
+		}
+	}
 
 	ids.connsMu.Lock()
 	defer ids.connsMu.Unlock()
 	e, ok := ids.conns[c]
 	if !ok { // might already have disconnected
-		return nil
+		return consumeErr
 	}
 	sup, err := ids.Host.Peerstore().SupportsProtocols(c.RemotePeer(), IDPush)
 	if supportsIdentifyPush := err == nil && len(sup) > 0; supportsIdentifyPush {
@@ -510,7 +709,15 @@ func (ids *idService) handleIdentifyResponse(s network.Stream, isPush bool) erro
 	}
 
 	ids.conns[c] = e
-	return nil
+	return consumeErr
+}
+
+// streamTimeout returns the read and write timeout for identify streams.
+func (ids *idService) streamTimeout() time.Duration {
+	if ids.timeout > 0 {
+		return ids.timeout
+	}
+	return StreamReadTimeout
 }
 
 func readAllIDMessages(r pbio.Reader, finalMsg proto.Message) error {
@@ -551,20 +758,90 @@ func (ids *idService) updateSnapshot() {
 func (ids *idService) writeChunkedIdentifyMsg(s network.Stream, mes *pb.Identify) error {
 	writer := pbio.NewDelimitedWriter(s)
 
-	if mes.SignedPeerRecord == nil || proto.Size(mes) <= legacyIDSize {
+	size := proto.Size(mes)
+	if (mes.SignedPeerRecord == nil || size <= legacyIDSize) && size <= ids.maxMessageSize {
 		return writer.WriteMsg(mes)
 	}
 
 	sr := mes.SignedPeerRecord
 	mes.SignedPeerRecord = nil
-	if err := writer.WriteMsg(mes); err != nil {
-		return err
+	// Peers merge all messages they receive, so we can split the addresses and
+	// protocols over multiple messages if they don't fit into a single one.
+	msgs := splitIdentifyMsg(mes, ids.maxMessageSize)
+	parts := len(msgs)
+	if sr != nil {
+		parts++
+	}
+	// Peers don't read more than maxMessages messages.
+	if parts > maxMessages {
+		return fmt.Errorf("identify message too large: needs %d parts, at most %d are allowed", parts, maxMessages)
+	}
+	for _, m := range msgs {
+		if err := writer.WriteMsg(m); err != nil {
+			return err
+		}
+	}
+	if sr == nil {
+		return nil
 	}
 	// then write just the signed record
 	return writer.WriteMsg(&pb.Identify{SignedPeerRecord: sr})
 }
 
-func (ids *idService) createBaseIdentifyResponse(conn network.Conn, snapshot *identifySnapshot) *pb.Identify {
+// splitIdentifyMsg splits the listen addresses and protocols of mes over multiple
+// messages, such that every message is at most limit bytes large.
+// All other fields are sent in the first message.
+func splitIdentifyMsg(mes *pb.Identify, limit int) []*pb.Identify {
+	if proto.Size(mes) <= limit {
+		return []*pb.Identify{mes}
+	}
+	first := proto.Clone(mes).(*pb.Identify)
+	first.ListenAddrs = nil
+	first.Protocols = nil
+	msgs := []*pb.Identify{first}
+	cur := first
+	// numFields is the number of addresses and protocols in cur
+	var numFields int
+	add := func(set func(*pb.Identify), unset func(*pb.Identify)) {
+		set(cur)
+		numFields++
+		// Always add at least one field to every message, otherwise we'd never make progress.
+		if numFields > 1 && proto.Size(cur) > limit {
+			unset(cur)
+			cur = &pb.Identify{}
+			msgs = append(msgs, cur)
+			set(cur)
+			numFields = 1
+		}
+	}
+	for _, a := range mes.ListenAddrs {
+		a := a
+		add(
+			func(m *pb.Identify) { m.ListenAddrs = append(m.ListenAddrs, a) },
+			func(m *pb.Identify) { m.ListenAddrs = m.ListenAddrs[:len(m.ListenAddrs)-1] },
+		)
+	}
+	for _, p := range mes.Protocols {
+		p := p
+		add(
+			func(m *pb.Identify) { m.Protocols = append(m.Protocols, p) },
+			func(m *pb.Identify) { m.Protocols = m.Protocols[:len(m.Protocols)-1] },
+		)
+	}
+	return msgs
+}
+
+// disclosedAddrs returns the listen addresses from the snapshot that we're willing to disclose on this connection.
+func (ids *idService) disclosedAddrs(conn network.Conn, snapshot *identifySnapshot) []ma.Multiaddr {
+	if ids.listenAddrsFilter == nil {
+		return snapshot.addrs
+	}
+	addrs := make([]ma.Multiaddr, len(snapshot.addrs))
+	copy(addrs, snapshot.addrs)
+	return ids.listenAddrsFilter(conn, addrs)
+}
+
+func (ids *idService) createBaseIdentifyResponse(conn network.Conn, snapshot *identifySnapshot, addrs []ma.Multiaddr) *pb.Identify {
 	mes := &pb.Identify{}
 
 	remoteAddr := conn.RemoteMultiaddr()
@@ -575,14 +852,16 @@ func (ids *idService) createBaseIdentifyResponse(conn network.Conn, snapshot *id
 
 	// observed address so other side is informed of their
 	// "public" address, at least in relation to us.
-	mes.ObservedAddr = remoteAddr.Bytes()
+	if ids.observedAddrFilter == nil || ids.observedAddrFilter(conn, remoteAddr) {
+		mes.ObservedAddr = remoteAddr.Bytes()
+	}
 
 	// populate unsigned addresses.
 	// peers that do not yet support signed addresses will need this.
 	// Note: LocalMultiaddr is sometimes 0.0.0.0
 	viaLoopback := manet.IsIPLoopback(localAddr) || manet.IsIPLoopback(remoteAddr)
-	mes.ListenAddrs = make([][]byte, 0, len(snapshot.addrs))
-	for _, addr := range snapshot.addrs {
+	mes.ListenAddrs = make([][]byte, 0, len(addrs))
+	for _, addr := range addrs {
 		if !viaLoopback && manet.IsIPLoopback(addr) {
 			continue
 		}
@@ -612,16 +891,38 @@ func (ids *idService) createBaseIdentifyResponse(conn network.Conn, snapshot *id
 	// set protocol versions
 	mes.ProtocolVersion = &ids.ProtocolVersion
 	mes.AgentVersion = &ids.UserAgent
+	if ids.connUserAgent != nil {
+		if ua := ids.connUserAgent(conn); ua != "" {
+			mes.AgentVersion = &ua
+		}
+	}
 
 	return mes
 }
 
-func (ids *idService) getSignedRecord(snapshot *identifySnapshot) []byte {
+func (ids *idService) getSignedRecord(snapshot *identifySnapshot, addrs []ma.Multiaddr) []byte {
 	if ids.disableSignedPeerRecord || snapshot.record == nil {
 		return nil
 	}
 
-	recBytes, err := snapshot.record.Marshal()
+	rec := snapshot.record
+	if !sameAddrs(addrs, snapshot.addrs) {
+		// We're withholding some addresses from this peer.
+		// The snapshot's record contains all of them, so we need to sign a new one.
+		key := ids.Host.Peerstore().PrivKey(ids.Host.ID())
+		if key == nil {
+			log.Errorw("cannot sign peer record, no private key")
+			return nil
+		}
+		var err error
+		rec, err = record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: ids.Host.ID(), Addrs: addrs}), key)
+		if err != nil {
+			log.Errorw("failed to create signed record", "err", err)
+			return nil
+		}
+	}
+
+	recBytes, err := rec.Marshal()
 	if err != nil {
 		log.Errorw("failed to marshal signed record", "err", err)
 		return nil
@@ -630,6 +931,41 @@ func (ids *idService) getSignedRecord(snapshot *identifySnapshot) []byte {
 	return recBytes
 }
 
+// certifiedAddrs returns the addresses of addrs that are contained in the signed peer record env.
+func certifiedAddrs(env *record.Envelope, addrs []ma.Multiaddr) []ma.Multiaddr {
+	if env == nil {
+		return nil
+	}
+	rec, err := env.Record()
+	if err != nil {
+		return nil
+	}
+	pr, ok := rec.(*peer.PeerRecord)
+	if !ok {
+		return nil
+	}
+	certified := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if ma.Contains(pr.Addrs, a) {
+			certified = append(certified, a)
+		}
+	}
+	return certified
+}
+
+// sameAddrs returns true if a and b contain the same addresses, ignoring the order.
+func sameAddrs(a, b []ma.Multiaddr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		if !ma.Contains(b, x) {
+			return false
+		}
+	}
+	return true
+}
+
 // diff takes two slices of strings (a and b) and computes which elements were added and removed in b
 func diff(a, b []protocol.ID) (added, removed []protocol.ID) {
 	// This is O(n^2), but it's fine because the slices are small.
@@ -660,7 +996,10 @@ func diff(a, b []protocol.ID) (added, removed []protocol.ID) {
 	return
 }
 
-func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn, isPush bool) {
+// consumeMessage stores the information contained in an identify message.
+// It only returns an error if the message doesn't satisfy our requirements,
+// i.e. if a signed peer record is required but missing.
+func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn, isPush bool) error {
 	p := c.RemotePeer()
 
 	supported, _ := ids.Host.Peerstore().GetProtocols(p)
@@ -672,6 +1011,8 @@ func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn, isPush bo
 			Peer:    p,
 			Added:   added,
 			Removed: removed,
+			Conn:    c,
+			Time:    time.Now(),
 		})
 	}
 
@@ -706,9 +1047,55 @@ func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn, isPush bo
 		log.Errorf("error getting peer record from Identify message: %v", err)
 	}
 
+	// the remote address of outbound connections is an address we know the peer is reachable at
+	var observed ma.Multiaddr
+	if c.Stat().Direction == network.DirOutbound {
+		observed = c.RemoteMultiaddr()
+	}
+
+	var consumeErr error
+	if ids.requireSignedPeerRecord {
+		// Only store certified addresses.
+		if isSignedBy(signedPeerRecord, p) {
+			ids.consumeListenAddrs(p, signedPeerRecord, nil, observed)
+		} else {
+			log.Debugw("ignoring listen addrs of peer without signed peer record", "peer", p)
+			consumeErr = ErrNoSignedPeerRecord
+		}
+	} else {
+		ids.consumeListenAddrs(p, signedPeerRecord, lmaddrs, observed)
+	}
+
+	log.Debugf("%s received listen addrs for %s: %s", c.LocalPeer(), c.RemotePeer(), lmaddrs)
+
+	// get protocol versions
+	pv := mes.GetProtocolVersion()
+	av := mes.GetAgentVersion()
+
+	ids.Host.Peerstore().Put(p, "ProtocolVersion", pv)
+	ids.Host.Peerstore().Put(p, "AgentVersion", av)
+
+	// get the key from the other side. we may not have it (no-auth transport)
+	ids.consumeReceivedPubKey(c, mes.PublicKey)
+	return consumeErr
+}
+
+// isSignedBy checks that the envelope was signed by peer p.
+func isSignedBy(env *record.Envelope, p peer.ID) bool {
+	if env == nil {
+		return false
+	}
+	return p.MatchesPublicKey(env.PublicKey)
+}
+
+// consumeListenAddrs replaces the addresses of peer p by the addresses contained in the signed peer record,
+// or, if the peer didn't send a signed peer record, by the unsigned listen addresses. observed is the
+// address we dialed p at, or nil if p dialed us.
+func (ids *idService) consumeListenAddrs(p peer.ID, signedPeerRecord *record.Envelope, lmaddrs []ma.Multiaddr, observed ma.Multiaddr) {
 	// Extend the TTLs on the known (probably) good addresses.
 	// Taking the lock ensures that we don't concurrently process a disconnect.
 	ids.addrMu.Lock()
+	defer ids.addrMu.Unlock()
 	ttl := peerstore.RecentlyConnectedAddrTTL
 	if ids.Host.Network().Connectedness(p) == network.Connected {
 		ttl = peerstore.ConnectedAddrTTL
@@ -723,31 +1110,40 @@ func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn, isPush bo
 	}
 
 	// add signed addrs if we have them and the peerstore supports them
-	cab, ok := peerstore.GetCertifiedAddrBook(ids.Host.Peerstore())
+	ps := ids.Host.Peerstore()
+	cab, ok := peerstore.GetCertifiedAddrBook(ps)
 	if ok && signedPeerRecord != nil {
 		_, addErr := cab.ConsumePeerRecord(signedPeerRecord, ttl)
 		if addErr != nil {
 			log.Debugf("error adding signed addrs to peerstore: %v", addErr)
+		} else if _, ok := peerstore.GetProvenanceAddrBook(ps); ok {
+			// record the source of the signed addrs
+			if rec, err := signedPeerRecord.Record(); err == nil {
+				if pr, ok := rec.(*peer.PeerRecord); ok {
+					addIdentifiedAddrs(ps, p, pr.Addrs, ttl, observed)
+				}
+			}
 		}
 	} else {
-		ids.Host.Peerstore().AddAddrs(p, lmaddrs, ttl)
+		addIdentifiedAddrs(ps, p, lmaddrs, ttl, observed)
 	}
 
 	// Finally, expire all temporary addrs.
 	ids.Host.Peerstore().UpdateAddrs(p, peerstore.TempAddrTTL, 0)
-	ids.addrMu.Unlock()
-
-	log.Debugf("%s received listen addrs for %s: %s", c.LocalPeer(), c.RemotePeer(), lmaddrs)
-
-	// get protocol versions
-	pv := mes.GetProtocolVersion()
-	av := mes.GetAgentVersion()
-
-	ids.Host.Peerstore().Put(p, "ProtocolVersion", pv)
-	ids.Host.Peerstore().Put(p, "AgentVersion", av)
+}
 
-	// get the key from the other side. we may not have it (no-auth transport)
-	ids.consumeReceivedPubKey(c, mes.PublicKey)
+// addIdentifiedAddrs adds the addrs p advertised using identify to ps. If we connected
+// to p at observed, and p advertised it, it's recorded as an observed address.
+func addIdentifiedAddrs(ps peerstore.Peerstore, p peer.ID, addrs []ma.Multiaddr, ttl time.Duration, observed ma.Multiaddr) {
+	if observed != nil {
+		for _, a := range addrs {
+			if a.Equal(observed) {
+				peerstore.AddAddrsWithSource(ps, p, []ma.Multiaddr{observed}, ttl, peerstore.AddrSourceObserved)
+				break
+			}
+		}
+	}
+	peerstore.AddAddrsWithSource(ps, p, addrs, ttl, peerstore.AddrSourceIdentify)
 }
 
 func (ids *idService) consumeReceivedPubKey(c network.Conn, kb []byte) {
@@ -2,6 +2,7 @@ package identify
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -9,9 +10,12 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	blhost "github.com/libp2p/go-libp2p/p2p/host/blank"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify/pb"
 
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestFastDisconnect(t *testing.T) {
@@ -82,3 +86,27 @@ func TestFastDisconnect(t *testing.T) {
 	// double-check to make sure we didn't actually timeout somewhere.
 	require.NoError(t, ctx.Err())
 }
+
+func TestSplitIdentifyMessage(t *testing.T) {
+	pv := "ipfs/0.1.0"
+	mes := &pb.Identify{ProtocolVersion: &pv, ObservedAddr: ma.StringCast("/ip4/1.2.3.4/tcp/1234").Bytes()}
+	for i := 0; i < 1000; i++ {
+		mes.ListenAddrs = append(mes.ListenAddrs, ma.StringCast(fmt.Sprintf("/ip4/1.2.3.4/tcp/%d", i)).Bytes())
+		mes.Protocols = append(mes.Protocols, fmt.Sprintf("/proto/%d", i))
+	}
+	const limit = 2000
+	require.Greater(t, proto.Size(mes), limit)
+
+	msgs := splitIdentifyMsg(proto.Clone(mes).(*pb.Identify), limit)
+	require.Greater(t, len(msgs), 1)
+	merged := &pb.Identify{}
+	for _, m := range msgs {
+		require.LessOrEqual(t, proto.Size(m), limit)
+		proto.Merge(merged, m)
+	}
+	require.True(t, proto.Equal(mes, merged))
+
+	// small messages are not split
+	small := &pb.Identify{ProtocolVersion: &pv}
+	require.Equal(t, []*pb.Identify{small}, splitIdentifyMsg(small, limit))
+}
@@ -32,8 +32,10 @@ import (
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-msgio/pbio"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 func init() {
@@ -546,6 +548,239 @@ func TestUserAgent(t *testing.T) {
 	}
 }
 
+func TestConnUserAgent(t *testing.T) {
+	h2, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h2.Close()
+
+	h1, err := libp2p.New(
+		libp2p.UserAgent("foo"),
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.IdentifyOptions(identify.WithConnUserAgent(func(c network.Conn) string {
+			if c.RemotePeer() == h2.ID() {
+				return "special"
+			}
+			return ""
+		})),
+	)
+	require.NoError(t, err)
+	defer h1.Close()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	require.Eventually(t, func() bool {
+		av, err := h2.Peerstore().Get(h1.ID(), "AgentVersion")
+		return err == nil && av.(string) == "special"
+	}, time.Second, 10*time.Millisecond)
+}
+
+// rejectionTracer records the rejections reported to the metrics tracer.
+type rejectionTracer struct {
+	identify.ExtendedMetricsTracer
+	rejections chan identify.RejectionReason
+}
+
+func (t *rejectionTracer) IdentifyRejected(isPush bool, reason identify.RejectionReason) {
+	t.rejections <- reason
+}
+
+func newRejectionTracer() *rejectionTracer {
+	return &rejectionTracer{
+		ExtendedMetricsTracer: identify.NewMetricsTracer(identify.WithRegisterer(prometheus.NewRegistry())).(identify.ExtendedMetricsTracer),
+		rejections:            make(chan identify.RejectionReason, 10),
+	}
+}
+
+func TestInboundPolicy(t *testing.T) {
+	type policyCall struct {
+		p                         peer.ID
+		agentVersion, protVersion string
+	}
+	calls := make(chan policyCall, 10)
+	tr := newRejectionTracer()
+	h1, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.IdentifyOptions(
+			identify.WithInboundPolicy(func(c network.Conn, av, pv string) error {
+				calls <- policyCall{p: c.RemotePeer(), agentVersion: av, protVersion: pv}
+				if av == "bad" {
+					return errors.New("bad agent")
+				}
+				return nil
+			}),
+			identify.WithMetricsTracer(tr),
+		),
+	)
+	require.NoError(t, err)
+	defer h1.Close()
+
+	good, err := libp2p.New(libp2p.UserAgent("good"), libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer good.Close()
+	bad, err := libp2p.New(libp2p.UserAgent("bad"), libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer bad.Close()
+
+	h1Info := peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}
+	require.NoError(t, good.Connect(context.Background(), h1Info))
+	c := <-calls
+	require.Equal(t, policyCall{p: good.ID(), agentVersion: "good", protVersion: identify.DefaultProtocolVersion}, c)
+
+	require.NoError(t, bad.Connect(context.Background(), h1Info))
+	c = <-calls
+	require.Equal(t, bad.ID(), c.p)
+	require.Eventually(t, func() bool {
+		return h1.Network().Connectedness(bad.ID()) != network.Connected
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, network.Connected, h1.Network().Connectedness(good.ID()))
+	require.Equal(t, identify.RejectionInboundPolicy, <-tr.rejections)
+	require.Empty(t, tr.rejections)
+	_, err = h1.Peerstore().Get(bad.ID(), "AgentVersion")
+	require.ErrorIs(t, err, peerstore.ErrNotFound)
+
+	// the policy is not applied to outbound connections
+	h3, err := libp2p.New(libp2p.UserAgent("bad"), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h3.Close()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h3.ID(), Addrs: h3.Addrs()}))
+	require.Eventually(t, func() bool {
+		av, err := h1.Peerstore().Get(h3.ID(), "AgentVersion")
+		return err == nil && av.(string) == "bad"
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, calls)
+}
+
+func TestRequireSignedPeerRecord(t *testing.T) {
+	h1, err := basichost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), &basichost.HostOpts{RequireSignedPeerRecord: true})
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+
+	sub, err := h1.EventBus().Subscribe([]interface{}{new(event.EvtPeerIdentificationCompleted), new(event.EvtPeerIdentificationFailed)})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	// h2 sends a signed peer record
+	h2, err := basichost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+	require.NoError(t, h2.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}))
+	select {
+	case e := <-sub.Out():
+		require.Equal(t, event.EvtPeerIdentificationCompleted{Peer: h2.ID()}, e)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected identification to complete")
+	}
+	testHasCertifiedAddrs(t, h1, h2.ID(), h2.Addrs())
+	require.ElementsMatch(t, h2.Addrs(), h1.Peerstore().Addrs(h2.ID()))
+
+	// h3 doesn't send a signed peer record
+	h3, err := basichost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), &basichost.HostOpts{DisableSignedPeerRecord: true})
+	require.NoError(t, err)
+	defer h3.Close()
+	h3.Start()
+	require.NoError(t, h3.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}))
+	select {
+	case e := <-sub.Out():
+		failed, ok := e.(event.EvtPeerIdentificationFailed)
+		require.True(t, ok, "expected identification to fail")
+		require.Equal(t, h3.ID(), failed.Peer)
+		require.ErrorIs(t, failed.Reason, identify.ErrNoSignedPeerRecord)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected identification to fail")
+	}
+	require.Empty(t, h1.Peerstore().Addrs(h3.ID()))
+	// information other than the addresses is still recorded
+	protos, err := h1.Peerstore().GetProtocols(h3.ID())
+	require.NoError(t, err)
+	require.Contains(t, protos, protocol.ID(identify.ID))
+}
+
+func TestRequireSignedPeerRecordAdvertisesCertifiedAddrs(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h2.Close()
+	require.NoError(t, h2.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}))
+	require.Greater(t, len(h1.Addrs()), 1)
+
+	identifyMsg := func() *pb.Identify {
+		t.Helper()
+		s, err := h2.NewStream(context.Background(), h1.ID(), identify.ID)
+		require.NoError(t, err)
+		defer s.Close()
+		var mes pb.Identify
+		require.NoError(t, pbio.NewDelimitedReader(s, 1<<16).ReadMsg(&mes))
+		return &mes
+	}
+
+	// the signed peer record of the blank host contains all its addresses
+	ids, err := identify.NewIDService(h1, identify.RequireSignedPeerRecord())
+	require.NoError(t, err)
+	ids.Start()
+	require.Len(t, identifyMsg().ListenAddrs, len(h1.Addrs()))
+	ids.Close()
+
+	// only the addresses of the signed peer record are advertised
+	certified := h1.Addrs()[:1]
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: h1.ID(), Addrs: certified}), h1.Peerstore().PrivKey(h1.ID()))
+	require.NoError(t, err)
+	cab, ok := peerstore.GetCertifiedAddrBook(h1.Peerstore())
+	require.True(t, ok)
+	_, err = cab.ConsumePeerRecord(env, peerstore.PermanentAddrTTL)
+	require.NoError(t, err)
+	ids, err = identify.NewIDService(h1, identify.RequireSignedPeerRecord())
+	require.NoError(t, err)
+	defer ids.Close()
+	ids.Start()
+	mes := identifyMsg()
+	require.Equal(t, [][]byte{certified[0].Bytes()}, mes.ListenAddrs)
+	_, rec, err := record.ConsumeEnvelope(mes.SignedPeerRecord, peer.PeerRecordEnvelopeDomain)
+	require.NoError(t, err)
+	require.Equal(t, certified, rec.(*peer.PeerRecord).Addrs)
+}
+
+func TestObservedAddrProvenance(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h2.Close()
+	ids1, err := identify.NewIDService(h1)
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+	ids2, err := identify.NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+	ids2.Start()
+
+	h1.Peerstore().AddAddrs(h2.ID(), h2.Addrs(), peerstore.TempAddrTTL)
+	c, err := h1.Network().DialPeer(context.Background(), h2.ID())
+	require.NoError(t, err)
+	<-ids1.IdentifyWait(c)
+
+	// the address we dialed is recorded as observed, the others as identified
+	pab, ok := peerstore.GetProvenanceAddrBook(h1.Peerstore())
+	require.True(t, ok)
+	require.Greater(t, len(h2.Addrs()), 1)
+	for _, a := range h2.Addrs() {
+		prov, ok := pab.AddrProvenance(h2.ID(), a)
+		require.True(t, ok)
+		if a.Equal(c.RemoteMultiaddr()) {
+			require.Equal(t, peerstore.AddrSourceObserved, prov.Source)
+		} else {
+			require.Equal(t, peerstore.AddrSourceIdentify, prov.Source)
+		}
+	}
+}
+
+func TestRequireSignedPeerRecordConflictsWithDisable(t *testing.T) {
+	h := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h.Close()
+	_, err := identify.NewIDService(h, identify.RequireSignedPeerRecord(), identify.DisableSignedPeerRecord())
+	require.Error(t, err)
+}
+
 func TestNotListening(t *testing.T) {
 	// Make sure we don't panic if we're not listening on any addresses.
 	//
@@ -612,6 +847,196 @@ func TestSendPush(t *testing.T) {
 	}, time.Second, 10*time.Millisecond)
 }
 
+func TestPushCoalescing(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	defer h2.Close()
+
+	ids1, err := identify.NewIDService(h1,
+		identify.PushQuietPeriod(200*time.Millisecond),
+		identify.MinPushInterval(time.Second),
+	)
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+
+	pushes := make(chan struct{}, 100)
+	h2.SetStreamHandler(identify.IDPush, func(s network.Stream) {
+		pushes <- struct{}{}
+		s.Reset()
+	})
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	ids1.IdentifyConn(h1.Network().ConnsToPeer(h2.ID())[0])
+
+	// rapid protocol changes are coalesced into a single push
+	for i := 0; i < 10; i++ {
+		h1.SetStreamHandler(protocol.ID(fmt.Sprintf("/foo/%d", i)), func(network.Stream) {})
+	}
+	select {
+	case <-pushes:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected a push")
+	}
+	time.Sleep(300 * time.Millisecond)
+	require.Empty(t, pushes)
+
+	// the next push is held back until the minimum push interval has elapsed
+	start := time.Now()
+	h1.SetStreamHandler("/bar", func(network.Stream) {})
+	select {
+	case <-pushes:
+		require.Greater(t, time.Since(start), 500*time.Millisecond)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected a push")
+	}
+}
+
+func TestSelectiveAddrDisclosure(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	defer h2.Close()
+
+	isTCP := func(a ma.Multiaddr) bool {
+		_, err := a.ValueForProtocol(ma.P_TCP)
+		return err == nil
+	}
+	var tcpAddrs []ma.Multiaddr
+	for _, a := range h1.Addrs() {
+		if isTCP(a) {
+			tcpAddrs = append(tcpAddrs, a)
+		}
+	}
+	require.NotEmpty(t, tcpAddrs)
+	require.Greater(t, len(h1.Addrs()), len(tcpAddrs))
+
+	filterCalledFor := make(chan peer.ID, 1)
+	ids1, err := identify.NewIDService(h1,
+		identify.WithListenAddrsFilter(func(c network.Conn, addrs []ma.Multiaddr) []ma.Multiaddr {
+			filterCalledFor <- c.RemotePeer()
+			var res []ma.Multiaddr
+			for _, a := range addrs {
+				if isTCP(a) {
+					res = append(res, a)
+				}
+			}
+			return res
+		}),
+		identify.WithObservedAddrFilter(func(network.Conn, ma.Multiaddr) bool { return false }),
+	)
+	require.NoError(t, err)
+	defer ids1.Close()
+	// make sure h1 has a signed peer record containing all its addresses
+	emitAddrChangeEvt(t, h1)
+	ids1.Start()
+
+	require.NoError(t, h2.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}))
+	s, err := h2.NewStream(context.Background(), h1.ID(), identify.ID)
+	require.NoError(t, err)
+	defer s.Close()
+
+	mes := &pb.Identify{}
+	r := pbio.NewDelimitedReader(s, 8*1024)
+	for {
+		m := &pb.Identify{}
+		if err := r.ReadMsg(m); err != nil {
+			break
+		}
+		proto.Merge(mes, m)
+	}
+	require.Equal(t, h2.ID(), <-filterCalledFor)
+	require.Nil(t, mes.ObservedAddr)
+
+	var listenAddrs []ma.Multiaddr
+	for _, b := range mes.ListenAddrs {
+		a, err := ma.NewMultiaddrBytes(b)
+		require.NoError(t, err)
+		listenAddrs = append(listenAddrs, a)
+	}
+	require.ElementsMatch(t, tcpAddrs, listenAddrs)
+
+	require.NotNil(t, mes.SignedPeerRecord)
+	_, rec, err := record.ConsumeEnvelope(mes.SignedPeerRecord, peer.PeerRecordEnvelopeDomain)
+	require.NoError(t, err)
+	require.Equal(t, h1.ID(), rec.(*peer.PeerRecord).PeerID)
+	require.ElementsMatch(t, tcpAddrs, rec.(*peer.PeerRecord).Addrs)
+}
+
+func TestProtocolUpdatesAndWaitForProtocols(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	defer h2.Close()
+
+	ids1, err := identify.NewIDService(h1)
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+	ids2, err := identify.NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+	ids2.Start()
+
+	sub, err := h1.EventBus().Subscribe(&event.EvtPeerProtocolsUpdated{})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	type waitResult struct {
+		protos []protocol.ID
+		err    error
+	}
+	done := make(chan waitResult, 1)
+	go func() {
+		protos, err := identify.WaitForProtocols(context.Background(), h1, h2.ID(), "/foo", "/bar")
+		done <- waitResult{protos: protos, err: err}
+	}()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	ids1.IdentifyConn(h1.Network().ConnsToPeer(h2.ID())[0])
+
+	select {
+	case <-done:
+		t.Fatal("didn't expect h2 to support the protocol yet")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	start := time.Now()
+	h2.SetStreamHandler("/foo", func(network.Stream) {})
+	select {
+	case res := <-done:
+		require.NoError(t, res.err)
+		require.Equal(t, []protocol.ID{"/foo"}, res.protos)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for protocol support")
+	}
+
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtPeerProtocolsUpdated)
+		require.Equal(t, h2.ID(), evt.Peer)
+		require.Equal(t, []protocol.ID{"/foo"}, evt.Added)
+		require.Equal(t, h1.Network().ConnsToPeer(h2.ID())[0], evt.Conn)
+		require.WithinRange(t, evt.Time, start, time.Now())
+	case <-time.After(time.Second):
+		t.Fatal("expected a protocols updated event")
+	}
+
+	// already supported protocols are returned immediately
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	protos, err := identify.WaitForProtocols(ctx, h1, h2.ID(), "/foo")
+	require.NoError(t, err)
+	require.Equal(t, []protocol.ID{"/foo"}, protos)
+
+	// waiting is aborted when the context is canceled
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = identify.WaitForProtocols(ctx, h1, h2.ID(), "/baz")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
 func TestLargeIdentifyMessage(t *testing.T) {
 	oldTTL := peerstore.RecentlyConnectedAddrTTL
 	peerstore.RecentlyConnectedAddrTTL = 500 * time.Millisecond
@@ -849,6 +1274,114 @@ func TestIdentifyResponseReadTimeout(t *testing.T) {
 	}
 }
 
+func TestIdentifyTimeoutOption(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	defer h2.Close()
+
+	ids1, err := identify.NewIDService(h1, identify.WithTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+
+	// remote stream handler will just hang and not send back an identify response
+	h2.SetStreamHandler(identify.ID, func(s network.Stream) {
+		time.Sleep(100 * time.Second)
+	})
+
+	sub, err := h1.EventBus().Subscribe(new(event.EvtPeerIdentificationFailed))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	select {
+	case ev := <-sub.Out():
+		fev := ev.(event.EvtPeerIdentificationFailed)
+		require.Contains(t, fev.Reason.Error(), "deadline")
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not receive identify failure event")
+	}
+}
+
+func TestIdentifyMaxMessageSize(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+	defer h1.Close()
+	defer h2.Close()
+
+	ids1, err := identify.NewIDService(h1, identify.WithMaxMessageSize(64))
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+	ids2, err := identify.NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+	ids2.Start()
+
+	_, err = identify.NewIDService(h1, identify.WithMaxMessageSize(0))
+	require.Error(t, err)
+
+	sub, err := h1.EventBus().Subscribe(new(event.EvtPeerIdentificationFailed))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	select {
+	case ev := <-sub.Out():
+		require.Equal(t, h2.ID(), ev.(event.EvtPeerIdentificationFailed).Peer)
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not receive identify failure event")
+	}
+}
+
+func TestIdentifySplitsAtMaxMessageSize(t *testing.T) {
+	for name, tc := range map[string]struct {
+		protocols int
+		ok        bool
+	}{
+		"split":          {protocols: 300, ok: true},
+		"too many parts": {protocols: 2000, ok: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h1 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+			h2 := blhost.NewBlankHost(swarmt.GenSwarm(t))
+			defer h1.Close()
+			defer h2.Close()
+			for i := 0; i < tc.protocols; i++ {
+				h2.SetStreamHandler(protocol.ID(fmt.Sprintf("/proto/%d", i)), func(network.Stream) {})
+			}
+
+			ids1, err := identify.NewIDService(h1, identify.WithMaxMessageSize(1024))
+			require.NoError(t, err)
+			defer ids1.Close()
+			ids1.Start()
+			ids2, err := identify.NewIDService(h2, identify.WithMaxMessageSize(1024))
+			require.NoError(t, err)
+			defer ids2.Close()
+			ids2.Start()
+
+			sub, err := h1.EventBus().Subscribe([]interface{}{new(event.EvtPeerIdentificationCompleted), new(event.EvtPeerIdentificationFailed)})
+			require.NoError(t, err)
+			defer sub.Close()
+
+			require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+			select {
+			case ev := <-sub.Out():
+				_, completed := ev.(event.EvtPeerIdentificationCompleted)
+				require.Equal(t, tc.ok, completed, "unexpected event %#v", ev)
+			case <-time.After(5 * time.Second):
+				t.Fatal("identify didn't finish")
+			}
+			if tc.ok {
+				protos, err := h1.Peerstore().GetProtocols(h2.ID())
+				require.NoError(t, err)
+				require.Len(t, protos, len(h2.Mux().Protocols()))
+			}
+		})
+	}
+}
+
 func TestIncomingIDStreamsTimeout(t *testing.T) {
 	timeout := identify.StreamReadTimeout
 	identify.StreamReadTimeout = 100 * time.Millisecond
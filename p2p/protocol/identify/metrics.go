@@ -1,6 +1,8 @@
 package identify
 
 import (
+	"time"
+
 	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/p2p/metricshelper"
@@ -73,6 +75,39 @@ var (
 			Buckets:   buckets,
 		},
 	)
+	identifyFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "identify_failures_total",
+			Help:      "Identify Failures",
+		},
+		[]string{"type", "dir"},
+	)
+	identifyRoundTrip = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "identify_round_trip_seconds",
+			Help:      "Identify Round Trip Time",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 1.25, 40), // 1ms to ~6000ms
+		},
+	)
+	identifyRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "identify_rejections_total",
+			Help:      "Identify Rejections",
+		},
+		[]string{"type", "reason"},
+	)
+	messageSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "message_size_bytes",
+			Help:      "Identify Message Size",
+			Buckets:   prometheus.ExponentialBuckets(64, 2, 9), // 64B to 16KiB
+		},
+		[]string{"type", "dir"},
+	)
 	collectors = []prometheus.Collector{
 		pushesTriggered,
 		identify,
@@ -82,6 +117,10 @@ var (
 		addrsCount,
 		numProtocolsReceived,
 		numAddrsReceived,
+		identifyFailures,
+		identifyRoundTrip,
+		identifyRejections,
+		messageSize,
 	}
 	// 1 to 20 and then up to 100 in steps of 5
 	buckets = append(
@@ -104,9 +143,41 @@ type MetricsTracer interface {
 	IdentifySent(isPush bool, numProtocols int, numAddrs int)
 }
 
+// RejectionReason is the reason an identify message received from a peer was rejected.
+type RejectionReason int
+
+const (
+	// RejectionNoSignedPeerRecord means that the peer didn't send a valid signed peer
+	// record, but signed peer records are required.
+	RejectionNoSignedPeerRecord RejectionReason = iota
+	// RejectionInboundPolicy means that the InboundPolicy rejected the connection.
+	RejectionInboundPolicy
+)
+
+// ExtendedMetricsTracer is a MetricsTracer that also tracks failures, round trip times,
+// message sizes and rejections. The identify service checks whether the tracer passed
+// to WithMetricsTracer implements it.
+type ExtendedMetricsTracer interface {
+	MetricsTracer
+
+	// IdentifyFailed counts failures to send or receive an identify message.
+	// sent is true if we failed to send the message.
+	IdentifyFailed(isPush bool, sent bool)
+
+	// IdentifyRoundTrip tracks the time it took from opening an identify stream
+	// to receiving the peer's identify response
+	IdentifyRoundTrip(rtt time.Duration)
+
+	// MessageSize tracks the size of identify messages
+	MessageSize(isPush bool, sent bool, size int)
+
+	// IdentifyRejected counts identify messages received from peers that were rejected.
+	IdentifyRejected(isPush bool, reason RejectionReason)
+}
+
 type metricsTracer struct{}
 
-var _ MetricsTracer = &metricsTracer{}
+var _ ExtendedMetricsTracer = &metricsTracer{}
 
 type metricsTracerSetting struct {
 	reg prometheus.Registerer
@@ -186,6 +257,34 @@ func (t *metricsTracer) IdentifyReceived(isPush bool, numProtocols int, numAddrs
 	numAddrsReceived.Observe(float64(numAddrs))
 }
 
+func (t *metricsTracer) IdentifyFailed(isPush bool, sent bool) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	*tags = append(*tags, getMessageType(isPush), getMessageDirection(isPush, sent))
+	identifyFailures.WithLabelValues(*tags...).Inc()
+}
+
+func (t *metricsTracer) IdentifyRoundTrip(rtt time.Duration) {
+	identifyRoundTrip.Observe(rtt.Seconds())
+}
+
+func (t *metricsTracer) MessageSize(isPush bool, sent bool, size int) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	*tags = append(*tags, getMessageType(isPush), getMessageDirection(isPush, sent))
+	messageSize.WithLabelValues(*tags...).Observe(float64(size))
+}
+
+func (t *metricsTracer) IdentifyRejected(isPush bool, reason RejectionReason) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	*tags = append(*tags, getMessageType(isPush), getRejectionReason(reason))
+	identifyRejections.WithLabelValues(*tags...).Inc()
+}
+
 func (t *metricsTracer) ConnPushSupport(support identifyPushSupport) {
 	tags := metricshelper.GetStringSlice()
 	defer metricshelper.PutStringSlice(tags)
@@ -204,3 +303,32 @@ func getPushSupport(s identifyPushSupport) string {
 		return "unknown"
 	}
 }
+
+func getRejectionReason(r RejectionReason) string {
+	switch r {
+	case RejectionNoSignedPeerRecord:
+		return "no_signed_peer_record"
+	case RejectionInboundPolicy:
+		return "inbound_policy"
+	default:
+		return "unknown"
+	}
+}
+
+func getMessageType(isPush bool) string {
+	if isPush {
+		return "push"
+	}
+	return "identify"
+}
+
+// getMessageDirection returns the direction of the stream the message was sent on,
+// using the same convention as the identify and identify_push counters.
+func getMessageDirection(isPush bool, sent bool) string {
+	// Identify responses are sent on streams opened by the peer,
+	// pushes are sent on streams we open to the peer.
+	if isPush == sent {
+		return metricshelper.GetDirection(network.DirOutbound)
+	}
+	return metricshelper.GetDirection(network.DirInbound)
+}
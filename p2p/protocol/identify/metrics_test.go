@@ -5,6 +5,7 @@ package identify
 import (
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/event"
 )
@@ -22,12 +23,16 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 		identifyPushUnsupported,
 	}
 
-	tr := NewMetricsTracer()
+	tr := NewMetricsTracer().(ExtendedMetricsTracer)
 	tests := map[string]func(){
-		"TriggeredPushes":  func() { tr.TriggeredPushes(events[rand.Intn(len(events))]) },
-		"ConnPushSupport":  func() { tr.ConnPushSupport(pushSupport[rand.Intn(len(pushSupport))]) },
-		"IdentifyReceived": func() { tr.IdentifyReceived(rand.Intn(2) == 0, rand.Intn(20), rand.Intn(20)) },
-		"IdentifySent":     func() { tr.IdentifySent(rand.Intn(2) == 0, rand.Intn(20), rand.Intn(20)) },
+		"TriggeredPushes":   func() { tr.TriggeredPushes(events[rand.Intn(len(events))]) },
+		"ConnPushSupport":   func() { tr.ConnPushSupport(pushSupport[rand.Intn(len(pushSupport))]) },
+		"IdentifyReceived":  func() { tr.IdentifyReceived(rand.Intn(2) == 0, rand.Intn(20), rand.Intn(20)) },
+		"IdentifySent":      func() { tr.IdentifySent(rand.Intn(2) == 0, rand.Intn(20), rand.Intn(20)) },
+		"IdentifyFailed":    func() { tr.IdentifyFailed(rand.Intn(2) == 0, rand.Intn(2) == 0) },
+		"IdentifyRoundTrip": func() { tr.IdentifyRoundTrip(time.Duration(rand.Intn(1000)) * time.Millisecond) },
+		"MessageSize":       func() { tr.MessageSize(rand.Intn(2) == 0, rand.Intn(2) == 0, rand.Intn(8192)) },
+		"IdentifyRejected":  func() { tr.IdentifyRejected(rand.Intn(2) == 0, RejectionReason(rand.Intn(2))) },
 	}
 	for method, f := range tests {
 		allocs := testing.AllocsPerRun(1000, f)
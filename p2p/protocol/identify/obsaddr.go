@@ -59,6 +59,9 @@ type observedAddr struct {
 	seenBy     map[string]observation // peer(observer) address -> observation info
 	lastSeen   time.Time
 	numInbound int
+	// stableSince is the time since which the address has had enough observers to be
+	// advertised. It is zero if it doesn't have enough observers.
+	stableSince time.Time
 }
 
 func (oa *observedAddr) activated() bool {
@@ -115,6 +118,9 @@ type ObservedAddrManager struct {
 	addrs        map[string][]*observedAddr
 	ttl          time.Duration
 	refreshTimer *time.Timer
+	// minObservers and stablePeriod are set by SetDamping
+	minObservers int
+	stablePeriod time.Duration
 
 	// this is the worker channel
 	wch chan newObservation
@@ -193,13 +199,114 @@ func (oas *ObservedAddrManager) Addrs() []ma.Multiaddr {
 	return oas.filter(allObserved)
 }
 
+// ObservedAddr describes an address peers observed for us.
+type ObservedAddr struct {
+	// Addr is the observed address.
+	Addr ma.Multiaddr
+	// LocalAddr is the local address of the connections the observations were made on.
+	LocalAddr ma.Multiaddr
+	// Transport is the transport of Addr, e.g. "tcp" or "udp/quic-v1".
+	Transport string
+	// Observers is the number of distinct observers that reported Addr in the last
+	// TTL * ActivationThresh. Peers sharing an IP address count as a single observer.
+	Observers int
+	// InboundObservers is the number of observers that reported Addr on an inbound
+	// connection.
+	InboundObservers int
+	// LastSeen is the time of the last observation.
+	LastSeen time.Time
+	// Confidence is Observers divided by the number of observers needed to advertise
+	// the address (ActivationThresh, unless changed with SetDamping), capped at 1.
+	Confidence float64
+	// StableSince is the time since which the address has had enough observers to be
+	// advertised. It is zero if it doesn't. With SetDamping, the address is only
+	// advertised once it has been stable for the configured period.
+	StableSince time.Time
+	// Advertised is true if Addr is returned by Addrs, i.e. it is stable, was
+	// observed in the last TTL, and is one of the most observed addresses of its IP
+	// version and transport.
+	Advertised bool
+}
+
+// Observations returns all the addresses peers observed for us, including the ones
+// that aren't advertised, sorted by decreasing number of observers.
+func (oas *ObservedAddrManager) Observations() []ObservedAddr {
+	oas.mu.RLock()
+	defer oas.mu.RUnlock()
+
+	var all []*observedAddr
+	for _, addrs := range oas.addrs {
+		all = append(all, addrs...)
+	}
+	advertised := make(map[string]struct{})
+	for _, a := range oas.filter(all) {
+		advertised[string(a.Bytes())] = struct{}{}
+	}
+
+	now := time.Now()
+	observations := make([]ObservedAddr, 0, len(all))
+	for local, addrs := range oas.addrs {
+		localAddr, err := ma.NewMultiaddrBytes([]byte(local))
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			o := ObservedAddr{
+				Addr:        a.addr,
+				LocalAddr:   localAddr,
+				Transport:   transportName(a.addr),
+				LastSeen:    a.lastSeen,
+				StableSince: a.stableSince,
+			}
+			for _, ob := range a.seenBy {
+				if now.Sub(ob.seenTime) > oas.ttl*time.Duration(ActivationThresh) {
+					continue
+				}
+				o.Observers++
+				if ob.inbound {
+					o.InboundObservers++
+				}
+			}
+			o.Confidence = float64(o.Observers) / float64(oas.minObserversLocked())
+			if o.Confidence > 1 {
+				o.Confidence = 1
+			}
+			_, o.Advertised = advertised[string(a.addr.Bytes())]
+			observations = append(observations, o)
+		}
+	}
+	sort.SliceStable(observations, func(i, j int) bool {
+		if observations[i].Observers != observations[j].Observers {
+			return observations[i].Observers > observations[j].Observers
+		}
+		return observations[i].Addr.String() < observations[j].Addr.String()
+	})
+	return observations
+}
+
+// transportName returns the names of the protocols following the IP component of a,
+// omitting certificate hashes.
+func transportName(a ma.Multiaddr) string {
+	var name []byte
+	for i, p := range a.Protocols() {
+		if i == 0 || p.Code == ma.P_CERTHASH {
+			continue
+		}
+		if len(name) > 0 {
+			name = append(name, '/')
+		}
+		name = append(name, p.Name...)
+	}
+	return string(name)
+}
+
 func (oas *ObservedAddrManager) filter(observedAddrs []*observedAddr) []ma.Multiaddr {
 	pmap := make(map[string][]*observedAddr)
 	now := time.Now()
 
 	for i := range observedAddrs {
 		a := observedAddrs[i]
-		if now.Sub(a.lastSeen) <= oas.ttl && a.activated() {
+		if now.Sub(a.lastSeen) <= oas.ttl && oas.stable(a, now) {
 			// group addresses by their IPX/Transport Protocol(TCP or UDP) pattern.
 			pat := a.groupKey()
 			pmap[pat] = append(pmap[pat], a)
@@ -312,6 +419,7 @@ func (oas *ObservedAddrManager) gc() {
 					}
 				}
 			}
+			oas.updateStableSince(a, now)
 
 			// leave only alive observed addresses
 			if now.Sub(a.lastSeen) <= oas.ttl {
@@ -474,8 +582,13 @@ func (oas *ObservedAddrManager) recordObservationUnlocked(conn network.Conn, obs
 				observedAddr.numInbound++
 			}
 
+			if now.Sub(observedAddr.lastSeen) > oas.ttl {
+				// the address went stale, it has to be stable again before it's advertised
+				observedAddr.stableSince = time.Time{}
+			}
 			observedAddr.seenBy[observerString] = ob
 			observedAddr.lastSeen = now
+			oas.updateStableSince(observedAddr, now)
 			return
 		}
 	}
@@ -491,6 +604,7 @@ func (oas *ObservedAddrManager) recordObservationUnlocked(conn network.Conn, obs
 	if ob.inbound {
 		oa.numInbound++
 	}
+	oas.updateStableSince(oa, now)
 	oas.addrs[localString] = append(oas.addrs[localString], oa)
 }
 
@@ -606,6 +720,49 @@ func observerGroup(m ma.Multiaddr) string {
 	return string(first.Bytes())
 }
 
+// SetDamping sets the number of distinct observers an observed address needs before
+// it is advertised, and for how long it needs to keep them. A minObservers of 0 means
+// ActivationThresh, a stablePeriod of 0 advertises addresses as soon as they have
+// enough observers.
+func (oas *ObservedAddrManager) SetDamping(minObservers int, stablePeriod time.Duration) {
+	oas.mu.Lock()
+	defer oas.mu.Unlock()
+	oas.minObservers = minObservers
+	oas.stablePeriod = stablePeriod
+	now := time.Now()
+	for _, addrs := range oas.addrs {
+		for _, a := range addrs {
+			oas.updateStableSince(a, now)
+		}
+	}
+}
+
+// minObserversLocked returns the number of observers an address needs to be
+// advertised.
+func (oas *ObservedAddrManager) minObserversLocked() int {
+	if oas.minObservers > 0 {
+		return oas.minObservers
+	}
+	return ActivationThresh
+}
+
+// updateStableSince updates the time since which a has had enough observers.
+func (oas *ObservedAddrManager) updateStableSince(a *observedAddr, now time.Time) {
+	if len(a.seenBy) < oas.minObserversLocked() {
+		a.stableSince = time.Time{}
+	} else if a.stableSince.IsZero() {
+		a.stableSince = now
+	}
+}
+
+// stable reports whether a has had enough observers for the stable period.
+func (oas *ObservedAddrManager) stable(a *observedAddr, now time.Time) bool {
+	if len(a.seenBy) < oas.minObserversLocked() || a.stableSince.IsZero() {
+		return false
+	}
+	return now.Sub(a.stableSince) >= oas.stablePeriod
+}
+
 // SetTTL sets the TTL of an observed address manager.
 func (oas *ObservedAddrManager) SetTTL(ttl time.Duration) {
 	oas.mu.Lock()
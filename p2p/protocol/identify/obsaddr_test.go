@@ -2,6 +2,7 @@ package identify_test
 
 import (
 	"crypto/rand"
+	"fmt"
 	"testing"
 	"time"
 
@@ -434,3 +435,65 @@ func TestObserveWebtransport(t *testing.T) {
 	require.Equal(t, 1, len(harness.oas.Addrs()))
 	require.Equal(t, "/ip4/1.2.3.4/udp/1231/quic-v1/webtransport", harness.oas.Addrs()[0].String())
 }
+
+func TestObservations(t *testing.T) {
+	harness := newHarness(t)
+	require.Empty(t, harness.oas.Observations())
+
+	a1 := ma.StringCast("/ip4/1.2.3.4/tcp/1231")
+	a2 := ma.StringCast("/ip4/1.2.3.4/tcp/1232")
+	var observers []peer.ID
+	for i := 0; i < identify.ActivationThresh; i++ {
+		observers = append(observers, harness.add(ma.StringCast(fmt.Sprintf("/ip4/1.2.3.%d/tcp/1236", 10+i))))
+	}
+	for i, p := range observers {
+		if i == 0 {
+			harness.observeInbound(a1, p)
+		} else {
+			harness.observe(a1, p)
+		}
+	}
+	harness.observe(a2, observers[1])
+
+	obs := harness.oas.Observations()
+	require.Len(t, obs, 2)
+	require.True(t, obs[0].Addr.Equal(a1))
+	require.True(t, obs[0].LocalAddr.Equal(ma.StringCast("/ip4/127.0.0.1/tcp/10086")))
+	require.Equal(t, "tcp", obs[0].Transport)
+	require.Equal(t, identify.ActivationThresh, obs[0].Observers)
+	require.Equal(t, 1, obs[0].InboundObservers)
+	require.Equal(t, 1.0, obs[0].Confidence)
+	require.True(t, obs[0].Advertised)
+	require.False(t, obs[0].LastSeen.IsZero())
+
+	require.True(t, obs[1].Addr.Equal(a2))
+	require.Equal(t, 1, obs[1].Observers)
+	require.Equal(t, 1/float64(identify.ActivationThresh), obs[1].Confidence)
+	require.False(t, obs[1].Advertised)
+}
+
+func TestObservedAddrDamping(t *testing.T) {
+	harness := newHarness(t)
+	harness.oas.SetDamping(2, 500*time.Millisecond)
+
+	a1 := ma.StringCast("/ip4/1.2.3.4/tcp/1231")
+	p1 := harness.add(ma.StringCast("/ip4/1.2.3.10/tcp/1236"))
+	p2 := harness.add(ma.StringCast("/ip4/1.2.3.11/tcp/1236"))
+	harness.observe(a1, p1)
+	obs := harness.oas.Observations()
+	require.Len(t, obs, 1)
+	require.Equal(t, 0.5, obs[0].Confidence)
+	require.True(t, obs[0].StableSince.IsZero())
+
+	harness.observe(a1, p2)
+	obs = harness.oas.Observations()
+	require.False(t, obs[0].StableSince.IsZero())
+	// the address has enough observers, but isn't stable yet
+	require.Empty(t, harness.oas.Addrs())
+	require.False(t, obs[0].Advertised)
+	require.Eventually(t, func() bool {
+		addrs := harness.oas.Addrs()
+		return len(addrs) == 1 && addrs[0].Equal(a1)
+	}, 5*time.Second, 50*time.Millisecond)
+	require.True(t, harness.oas.Observations()[0].Advertised)
+}
@@ -1,12 +1,47 @@
 package identify
 
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
 type config struct {
 	protocolVersion         string
 	userAgent               string
 	disableSignedPeerRecord bool
 	metricsTracer           MetricsTracer
+	pushQuietPeriod         time.Duration
+	minPushInterval         time.Duration
+	listenAddrsFilter       ListenAddrsFilter
+	observedAddrFilter      ObservedAddrFilter
+	connUserAgent           func(network.Conn) string
+	inboundPolicy           InboundPolicy
+	requireSignedPeerRecord bool
+	timeout                 time.Duration
+	maxMessageSize          int
+	minObservers            int
+	stablePeriod            time.Duration
 }
 
+// InboundPolicy is consulted when we receive an identify message (or push) from the
+// remote peer of an inbound connection, before any of its contents are stored.
+// It is passed the agent and protocol version advertised by the peer.
+// If it returns an error, the connection is closed. The policy can also be used
+// to tag the peer, e.g. using the connection manager.
+type InboundPolicy func(c network.Conn, agentVersion, protocolVersion string) error
+
+// ListenAddrsFilter selects which of our listen addresses are disclosed to the
+// remote peer of a connection. It is passed a copy of the addresses and returns
+// the subset that is sent in identify messages on that connection.
+type ListenAddrsFilter func(c network.Conn, addrs []ma.Multiaddr) []ma.Multiaddr
+
+// ObservedAddrFilter decides whether the address we observed the remote peer of a
+// connection at is sent to that peer in identify messages.
+type ObservedAddrFilter func(c network.Conn, observed ma.Multiaddr) bool
+
 // Option is an option function for identify.
 type Option func(*config)
 
@@ -33,8 +68,120 @@ func DisableSignedPeerRecord() Option {
 	}
 }
 
+// RequireSignedPeerRecord enables strict signed peer record mode.
+// Peers are required to send a valid signed peer record in their identify messages,
+// and only the certified addresses contained in it are stored in the peerstore.
+// Unsigned listen addresses are ignored. Identifying a peer that doesn't send a
+// signed peer record fails with ErrNoSignedPeerRecord.
+// Likewise, only the listen addresses contained in our own signed peer record are
+// sent to other peers.
+// This option can't be combined with DisableSignedPeerRecord.
+func RequireSignedPeerRecord() Option {
+	return func(cfg *config) {
+		cfg.requireSignedPeerRecord = true
+	}
+}
+
+// WithTimeout sets the timeout for reading and writing identify messages.
+// If not set, StreamReadTimeout is used.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = d
+	}
+}
+
+// WithMaxMessageSize sets the maximum size of a single identify message we accept.
+// Peers with a lot of addresses or protocols split their identify messages,
+// and the signed peer record is sent in a separate message.
+// The messages we send are split at this size too, into at most 10 messages.
+// Defaults to DefaultMaxMessageSize.
+func WithMaxMessageSize(size int) Option {
+	return func(cfg *config) {
+		cfg.maxMessageSize = size
+	}
+}
+
 func WithMetricsTracer(tr MetricsTracer) Option {
 	return func(cfg *config) {
 		cfg.metricsTracer = tr
 	}
 }
+
+// PushQuietPeriod sets how long the identify service waits after a change to
+// the local addresses or protocols before pushing the update to connected peers.
+// Changes that happen within the quiet period are coalesced into a single push.
+// It defaults to DefaultPushQuietPeriod. Setting it to 0 disables coalescing
+// and pushes updates immediately.
+func PushQuietPeriod(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.pushQuietPeriod = d
+	}
+}
+
+// MinPushInterval sets the minimum interval between two identify pushes sent
+// on the same connection. Updates that happen faster than that are delayed, and
+// only the most recent state is sent once the interval has elapsed.
+// Setting it to 0 disables the limit.
+func MinPushInterval(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.minPushInterval = d
+	}
+}
+
+// WithListenAddrsFilter sets a filter that is applied to the listen addresses
+// we send on every connection, allowing addresses to be withheld from some
+// peers (e.g. not revealing LAN addresses to peers on the public internet).
+// When the filter removes addresses, the signed peer record is re-signed
+// with the remaining addresses, so the omitted addresses are not leaked.
+// If the option is used multiple times, the filters are applied in order.
+func WithListenAddrsFilter(f ListenAddrsFilter) Option {
+	return func(cfg *config) {
+		if prev := cfg.listenAddrsFilter; prev != nil {
+			cfg.listenAddrsFilter = func(c network.Conn, addrs []ma.Multiaddr) []ma.Multiaddr {
+				return f(c, prev(c, addrs))
+			}
+			return
+		}
+		cfg.listenAddrsFilter = f
+	}
+}
+
+// WithObservedAddrFilter sets a filter that decides on every connection whether
+// we tell the remote peer the address we observed it at (e.g. not sending
+// observed addresses to relays).
+func WithObservedAddrFilter(f ObservedAddrFilter) Option {
+	return func(cfg *config) {
+		cfg.observedAddrFilter = f
+	}
+}
+
+// WithConnUserAgent sets a function that selects the user agent sent on a
+// specific connection, e.g. to use a different user agent when dialing a
+// particular set of peers. If the function returns an empty string, the
+// user agent configured using UserAgent is used.
+func WithConnUserAgent(f func(c network.Conn) string) Option {
+	return func(cfg *config) {
+		cfg.connUserAgent = f
+	}
+}
+
+// WithInboundPolicy sets a policy that inbound connections are subjected to,
+// based on the agent and protocol version the remote peer advertises.
+func WithInboundPolicy(p InboundPolicy) Option {
+	return func(cfg *config) {
+		cfg.inboundPolicy = p
+	}
+}
+
+// ObservedAddrDamping delays advertising newly observed addresses, to avoid flooding
+// the network with flapping addresses behind unstable NATs. An observed address is
+// only advertised once at least minObservers distinct observers reported it, and it
+// kept that many observers for stablePeriod. A minObservers of 0 means
+// ActivationThresh, a stablePeriod of 0 advertises addresses as soon as they have
+// enough observers.
+func ObservedAddrDamping(minObservers int, stablePeriod time.Duration) Option {
+	return func(cfg *config) {
+		cfg.minObservers = minObservers
+		cfg.stablePeriod = stablePeriod
+	}
+}
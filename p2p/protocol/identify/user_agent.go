@@ -41,3 +41,9 @@ func init() {
 		defaultUserAgent += "-dirty"
 	}
 }
+
+// DefaultUserAgent returns the user agent sent when none is configured. It's derived
+// from the build information of the main module.
+func DefaultUserAgent() string {
+	return defaultUserAgent
+}
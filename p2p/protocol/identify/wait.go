@@ -0,0 +1,61 @@
+package identify
+
+import (
+	"context"
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+)
+
+// WaitForProtocols blocks until peer p is known to support at least one of the given protocols,
+// and returns the subset of protos that p supports.
+// Support is learned from the peerstore, which is updated by the identify service
+// when a peer is identified and when it pushes changes to its protocols.
+// It returns an error if the context is canceled before that happens.
+func WaitForProtocols(ctx context.Context, h host.Host, p peer.ID, protos ...protocol.ID) ([]protocol.ID, error) {
+	// Subscribe before checking the peerstore, so we don't miss an update happening in between.
+	sub, err := h.EventBus().Subscribe(
+		[]any{&event.EvtPeerProtocolsUpdated{}, &event.EvtPeerIdentificationCompleted{}},
+		eventbus.Name("identify (wait for protocols)"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+
+	for {
+		supported, err := h.Peerstore().SupportsProtocols(p, protos...)
+		if err != nil {
+			return nil, err
+		}
+		if len(supported) > 0 {
+			return supported, nil
+		}
+
+	waitForUpdate:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case e, ok := <-sub.Out():
+				if !ok {
+					return nil, errors.New("event subscription closed")
+				}
+				switch evt := e.(type) {
+				case event.EvtPeerProtocolsUpdated:
+					if evt.Peer == p {
+						break waitForUpdate
+					}
+				case event.EvtPeerIdentificationCompleted:
+					if evt.Peer == p {
+						break waitForUpdate
+					}
+				}
+			}
+		}
+	}
+}
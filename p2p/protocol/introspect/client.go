@@ -0,0 +1,66 @@
+package introspect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/libp2p/go-msgio"
+)
+
+// Query asks p for the given sections of its state, or all sections if none are
+// given. h must be allowed to query p, see AllowPeers.
+func Query(ctx context.Context, h host.Host, p peer.ID, sections ...Section) (*State, error) {
+	str, err := h.NewStream(ctx, p, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer str.Close()
+
+	if err := str.Scope().SetService(ServiceName); err != nil {
+		str.Reset()
+		return nil, fmt.Errorf("error attaching stream to introspection service: %w", err)
+	}
+	if err := str.Scope().ReserveMemory(maxResponseSize, network.ReservationPriorityAlways); err != nil {
+		str.Reset()
+		return nil, fmt.Errorf("error reserving memory for introspection stream: %w", err)
+	}
+	defer str.Scope().ReleaseMemory(maxResponseSize)
+
+	deadline := time.Now().Add(StreamTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	str.SetDeadline(deadline)
+
+	b, err := json.Marshal(Request{Sections: sections})
+	if err != nil {
+		str.Reset()
+		return nil, err
+	}
+	if err := msgio.NewVarintWriter(str).WriteMsg(b); err != nil {
+		str.Reset()
+		return nil, err
+	}
+	r := msgio.NewVarintReaderSize(str, maxResponseSize)
+	msg, err := r.ReadMsg()
+	if err != nil {
+		str.Reset()
+		return nil, err
+	}
+	defer r.ReleaseMsg(msg)
+	var state State
+	if err := json.Unmarshal(msg, &state); err != nil {
+		str.Reset()
+		return nil, fmt.Errorf("malformed state: %w", err)
+	}
+	if state.Peer != p {
+		return nil, fmt.Errorf("received the state of %s instead of %s", state.Peer, p)
+	}
+	return &state, nil
+}
@@ -0,0 +1,73 @@
+// Package introspect implements a protocol that lets authorized peers query the
+// runtime state of a node: its connections and streams, its addresses, its
+// reachability and the usage of its resource manager. It is meant for fleet tooling
+// and remote debugging.
+//
+// Peers are authenticated by the secure channel of the connection. A Service only
+// answers the peers it was configured to allow.
+package introspect
+
+import (
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/host/debug"
+)
+
+var log = logging.Logger("introspect")
+
+const (
+	// ID is the protocol used to query the state of a node.
+	ID protocol.ID = "/libp2p/introspect/1.0.0"
+
+	ServiceName = "libp2p.introspect"
+
+	// StreamTimeout is the timeout of a query.
+	StreamTimeout = time.Minute
+
+	maxRequestSize  = 4 << 10
+	maxResponseSize = 4 << 20
+)
+
+// Section is a part of the state of a node.
+type Section string
+
+const (
+	// SectionConns are the open connections and their streams.
+	SectionConns Section = "conns"
+	// SectionAddrs are the listen and the advertised addresses.
+	SectionAddrs Section = "addrs"
+	// SectionReachability is the reachability, as last reported by AutoNAT.
+	SectionReachability Section = "reachability"
+	// SectionResources is the usage of the resource manager, relative to its limits.
+	SectionResources Section = "resources"
+)
+
+// AllSections are all the sections of the state.
+var AllSections = []Section{SectionConns, SectionAddrs, SectionReachability, SectionResources}
+
+// Request is a query for the state of a node.
+type Request struct {
+	// Sections are the sections to return, all sections are returned if it is
+	// empty.
+	Sections []Section `json:",omitempty"`
+}
+
+// State is the state of a node. Only the requested sections are set.
+type State struct {
+	Peer peer.ID
+	// Time is when the state was collected.
+	Time time.Time
+
+	Conns        []debug.ConnInfo `json:",omitempty"`
+	ListenAddrs  []string         `json:",omitempty"`
+	Addrs        []string         `json:",omitempty"`
+	Reachability string           `json:",omitempty"`
+	// Resources is nil if the resource manager of the node doesn't report its usage.
+	Resources *ResourceUsage `json:",omitempty"`
+}
+
+// ResourceUsage is the usage of the resource manager, see debug.ResourceUsage.
+type ResourceUsage = debug.ResourceUsage
@@ -0,0 +1,85 @@
+package introspect
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newHost(t *testing.T, opts ...swarm.Option) *bhost.BasicHost {
+	h, err := bhost.NewHost(swarmt.GenSwarm(t, swarmt.WithSwarmOpts(opts...)), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { h.Close() })
+	h.Start()
+	return h
+}
+
+func TestQuery(t *testing.T) {
+	mgr, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(rcmgr.InfiniteLimits))
+	require.NoError(t, err)
+	node := newHost(t, swarm.WithResourceManager(mgr))
+	client := newHost(t)
+	require.NoError(t, client.Connect(context.Background(), peer.AddrInfo{ID: node.ID(), Addrs: node.Addrs()}))
+
+	svc, err := NewService(node, AllowPeers(client.ID()))
+	require.NoError(t, err)
+	defer svc.Close()
+
+	em, err := node.EventBus().Emitter(new(event.EvtLocalReachabilityChanged), eventbus.Stateful)
+	require.NoError(t, err)
+	defer em.Close()
+	require.NoError(t, em.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}))
+	require.Eventually(t, func() bool {
+		return network.Reachability(svc.reachability.Load()) == network.ReachabilityPublic
+	}, 5*time.Second, 10*time.Millisecond)
+
+	state, err := Query(context.Background(), client, node.ID())
+	require.NoError(t, err)
+	require.Equal(t, node.ID(), state.Peer)
+	require.Equal(t, network.ReachabilityPublic.String(), state.Reachability)
+	require.NotEmpty(t, state.Addrs)
+	require.NotEmpty(t, state.ListenAddrs)
+	require.NotNil(t, state.Resources)
+	require.Len(t, state.Conns, 1)
+	require.Equal(t, client.ID(), state.Conns[0].Peer)
+	// the stream of the query itself
+	require.Len(t, state.Conns[0].Streams, 1)
+	require.Equal(t, ID, state.Conns[0].Streams[0].Protocol)
+
+	state, err = Query(context.Background(), client, node.ID(), SectionAddrs)
+	require.NoError(t, err)
+	require.NotEmpty(t, state.Addrs)
+	require.Empty(t, state.Conns)
+	require.Empty(t, state.Reachability)
+	require.Nil(t, state.Resources)
+
+	_, err = Query(context.Background(), client, node.ID(), "unknown")
+	require.Error(t, err)
+}
+
+func TestRejectUnauthorizedPeer(t *testing.T) {
+	node := newHost(t)
+	client := newHost(t)
+	require.NoError(t, client.Connect(context.Background(), peer.AddrInfo{ID: node.ID(), Addrs: node.Addrs()}))
+
+	svc, err := NewService(node, AllowPeers(node.ID()))
+	require.NoError(t, err)
+	defer svc.Close()
+
+	_, err = Query(context.Background(), client, node.ID())
+	require.Error(t, err)
+
+	_, err = NewService(node)
+	require.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package introspect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/debug"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+
+	"github.com/libp2p/go-msgio"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+type Option func(*Service) error
+
+// AllowPeers sets the peers allowed to query the state of the node. Streams from
+// other peers are reset. At least one peer must be allowed.
+func AllowPeers(peers ...peer.ID) Option {
+	return func(s *Service) error {
+		for _, p := range peers {
+			s.allowed[p] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// Service answers the queries of the allowed peers for the state of a host.
+type Service struct {
+	host    host.Host
+	allowed map[peer.ID]struct{}
+
+	sub          event.Subscription
+	reachability atomic.Int32 // network.Reachability
+	refCount     sync.WaitGroup
+}
+
+// NewService creates a Service answering queries on h.
+func NewService(h host.Host, opts ...Option) (*Service, error) {
+	s := &Service{host: h, allowed: make(map[peer.ID]struct{})}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.allowed) == 0 {
+		return nil, errors.New("no peers allowed")
+	}
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged), eventbus.Name("introspect"))
+	if err != nil {
+		return nil, err
+	}
+	s.sub = sub
+	s.refCount.Add(1)
+	go s.trackReachability()
+	h.SetStreamHandler(ID, s.handleStream)
+	return s, nil
+}
+
+func (s *Service) trackReachability() {
+	defer s.refCount.Done()
+	for e := range s.sub.Out() {
+		s.reachability.Store(int32(e.(event.EvtLocalReachabilityChanged).Reachability))
+	}
+}
+
+func (s *Service) handleStream(str network.Stream) {
+	from := str.Conn().RemotePeer()
+	if _, ok := s.allowed[from]; !ok {
+		log.Debugw("rejecting query from unauthorized peer", "peer", from)
+		str.Reset()
+		return
+	}
+	if err := str.Scope().SetService(ServiceName); err != nil {
+		log.Debugw("error attaching stream to introspection service", "error", err)
+		str.Reset()
+		return
+	}
+	if err := str.Scope().ReserveMemory(maxRequestSize, network.ReservationPriorityAlways); err != nil {
+		log.Debugw("error reserving memory for introspection stream", "error", err)
+		str.Reset()
+		return
+	}
+	defer str.Scope().ReleaseMemory(maxRequestSize)
+	str.SetDeadline(time.Now().Add(StreamTimeout))
+
+	r := msgio.NewVarintReaderSize(str, maxRequestSize)
+	msg, err := r.ReadMsg()
+	if err != nil {
+		log.Debugw("error reading query", "peer", from, "error", err)
+		str.Reset()
+		return
+	}
+	var req Request
+	err = json.Unmarshal(msg, &req)
+	r.ReleaseMsg(msg)
+	if err != nil {
+		log.Debugw("received malformed query", "peer", from, "error", err)
+		str.Reset()
+		return
+	}
+	state, err := s.State(req.Sections...)
+	if err != nil {
+		log.Debugw("invalid query", "peer", from, "error", err)
+		str.Reset()
+		return
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		log.Errorw("failed to marshal state", "error", err)
+		str.Reset()
+		return
+	}
+	if len(b) > maxResponseSize {
+		log.Warnw("state too large to answer query", "peer", from, "size", len(b))
+		str.Reset()
+		return
+	}
+	if err := msgio.NewVarintWriter(str).WriteMsg(b); err != nil {
+		log.Debugw("error writing state", "peer", from, "error", err)
+		str.Reset()
+		return
+	}
+	str.Close()
+}
+
+// State returns the requested sections of the state of the host, or all sections if
+// none are requested.
+func (s *Service) State(sections ...Section) (*State, error) {
+	if len(sections) == 0 {
+		sections = AllSections
+	}
+	state := &State{Peer: s.host.ID(), Time: time.Now()}
+	for _, sec := range sections {
+		switch sec {
+		case SectionConns:
+			state.Conns = debug.ConnInfos(s.host.Network())
+		case SectionAddrs:
+			if laddrs, err := s.host.Network().InterfaceListenAddresses(); err == nil {
+				state.ListenAddrs = addrStrings(laddrs)
+			}
+			state.Addrs = addrStrings(s.host.Addrs())
+		case SectionReachability:
+			state.Reachability = network.Reachability(s.reachability.Load()).String()
+		case SectionResources:
+			if viewer, ok := s.host.Network().ResourceManager().(rcmgr.ResourceManagerUsageViewer); ok {
+				state.Resources = debug.NewResourceUsage(viewer.Usage())
+			}
+		default:
+			return nil, fmt.Errorf("unknown section: %q", sec)
+		}
+	}
+	return state, nil
+}
+
+func addrStrings(addrs []ma.Multiaddr) []string {
+	s := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		s = append(s, a.String())
+	}
+	return s
+}
+
+// Close stops answering queries.
+func (s *Service) Close() error {
+	s.host.RemoveStreamHandler(ID)
+	err := s.sub.Close()
+	s.refCount.Wait()
+	return err
+}
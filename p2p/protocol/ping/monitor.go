@@ -0,0 +1,228 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+)
+
+const maxMonitorConcurrency = 16
+
+// MonitorOption is an option for the LatencyMonitor.
+type MonitorOption func(*LatencyMonitor) error
+
+// WithMonitorInterval sets the interval at which peers are pinged.
+// Default: 1 minute.
+func WithMonitorInterval(d time.Duration) MonitorOption {
+	return func(m *LatencyMonitor) error {
+		if d <= 0 {
+			return errors.New("monitor interval must be positive")
+		}
+		m.interval = d
+		return nil
+	}
+}
+
+// WithMonitorTimeout sets the time after which a ping is considered failed.
+// Default: DefaultProbeTimeout.
+func WithMonitorTimeout(d time.Duration) MonitorOption {
+	return func(m *LatencyMonitor) error {
+		if d <= 0 {
+			return errors.New("monitor timeout must be positive")
+		}
+		m.timeout = d
+		return nil
+	}
+}
+
+// WithThresholds sets the latency thresholds.
+// An EvtPeerLatencyThresholdCrossed event is emitted every time the latency
+// estimate of a peer crosses one of these thresholds.
+func WithThresholds(thresholds ...time.Duration) MonitorOption {
+	return func(m *LatencyMonitor) error {
+		m.thresholds = append([]time.Duration(nil), thresholds...)
+		sort.Slice(m.thresholds, func(i, j int) bool { return m.thresholds[i] < m.thresholds[j] })
+		return nil
+	}
+}
+
+// WithPeerFilter restricts the monitor to the connected peers for which filter returns true.
+// By default, all connected peers are monitored.
+func WithPeerFilter(filter func(peer.ID) bool) MonitorOption {
+	return func(m *LatencyMonitor) error {
+		m.filter = filter
+		return nil
+	}
+}
+
+// WithTaggedPeers restricts the monitor to the connected peers that carry the
+// given tag in the connection manager.
+func WithTaggedPeers(tag string) MonitorOption {
+	return func(m *LatencyMonitor) error {
+		m.filter = func(p peer.ID) bool {
+			info := m.host.ConnManager().GetTagInfo(p)
+			if info == nil {
+				return false
+			}
+			_, ok := info.Tags[tag]
+			return ok
+		}
+		return nil
+	}
+}
+
+// LatencyMonitor periodically pings connected peers.
+// The latency estimate of the peerstore (see peerstore.Metrics) is updated with every
+// measurement, and EvtPeerLatencyThresholdCrossed events are emitted when the
+// estimate crosses one of the configured thresholds.
+type LatencyMonitor struct {
+	host host.Host
+
+	interval   time.Duration
+	timeout    time.Duration
+	thresholds []time.Duration
+	filter     func(peer.ID) bool
+
+	emitter event.Emitter
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	refCount  sync.WaitGroup
+
+	mx sync.Mutex
+	// levels stores, for every monitored peer, the number of thresholds its latency is above.
+	levels map[peer.ID]int
+}
+
+// NewLatencyMonitor creates a new latency monitor.
+// Call Start to start monitoring.
+func NewLatencyMonitor(h host.Host, opts ...MonitorOption) (*LatencyMonitor, error) {
+	m := &LatencyMonitor{
+		host:     h,
+		interval: time.Minute,
+		timeout:  DefaultProbeTimeout,
+		levels:   make(map[peer.ID]int),
+	}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	emitter, err := h.EventBus().Emitter(new(event.EvtPeerLatencyThresholdCrossed))
+	if err != nil {
+		return nil, err
+	}
+	m.emitter = emitter
+	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
+	return m, nil
+}
+
+func (m *LatencyMonitor) Start() {
+	m.refCount.Add(1)
+	go m.background()
+}
+
+func (m *LatencyMonitor) background() {
+	defer m.refCount.Done()
+
+	sub, err := m.host.EventBus().Subscribe(new(event.EvtPeerConnectednessChanged), eventbus.Name("ping (latency monitor)"))
+	if err != nil {
+		log.Errorf("failed to subscribe to connectedness events: %s", err)
+		return
+	}
+	defer sub.Close()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			if evt := e.(event.EvtPeerConnectednessChanged); evt.Connectedness != network.Connected {
+				m.mx.Lock()
+				delete(m.levels, evt.Peer)
+				m.mx.Unlock()
+			}
+		case <-ticker.C:
+			m.pingPeers()
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *LatencyMonitor) pingPeers() {
+	sem := make(chan struct{}, maxMonitorConcurrency)
+	var wg sync.WaitGroup
+	for _, p := range m.host.Network().Peers() {
+		if m.filter != nil && !m.filter(p) {
+			continue
+		}
+		// Don't ping peers we know don't support the ping protocol.
+		if protos, err := m.host.Peerstore().GetProtocols(p); err == nil && len(protos) > 0 {
+			if supported, err := m.host.Peerstore().SupportsProtocols(p, ID); err != nil || len(supported) == 0 {
+				continue
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-m.ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			m.pingPeer(p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+func (m *LatencyMonitor) pingPeer(p peer.ID) {
+	// Probe records the latency in the peerstore.
+	if _, err := Probe(m.ctx, m.host, p, WithCount(1), WithProbeTimeout(m.timeout)); err != nil {
+		log.Debugw("latency monitor failed to ping peer", "peer", p, "error", err)
+		return
+	}
+	latency := m.host.Peerstore().LatencyEWMA(p)
+
+	level := sort.Search(len(m.thresholds), func(i int) bool { return m.thresholds[i] >= latency })
+	m.mx.Lock()
+	prev, known := m.levels[p]
+	// Don't track peers that disconnected while we were pinging them.
+	if m.host.Network().Connectedness(p) == network.Connected {
+		m.levels[p] = level
+	}
+	m.mx.Unlock()
+
+	if !known {
+		// The first measurement only crosses the thresholds below the latency.
+		prev = 0
+	}
+	for i := prev; i < level; i++ {
+		m.emitter.Emit(event.EvtPeerLatencyThresholdCrossed{Peer: p, Latency: latency, Threshold: m.thresholds[i], Above: true})
+	}
+	for i := prev - 1; i >= level; i-- {
+		m.emitter.Emit(event.EvtPeerLatencyThresholdCrossed{Peer: p, Latency: latency, Threshold: m.thresholds[i], Above: false})
+	}
+}
+
+// Close stops the latency monitor.
+func (m *LatencyMonitor) Close() error {
+	m.ctxCancel()
+	m.refCount.Wait()
+	return m.emitter.Close()
+}
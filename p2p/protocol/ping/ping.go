@@ -15,6 +15,8 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	msmux "github.com/multiformats/go-multistream"
 )
 
 var log = logging.Logger("ping")
@@ -111,24 +113,17 @@ func pingError(err error) chan Result {
 // Ping pings the remote peer until the context is canceled, returning a stream
 // of RTTs or errors.
 func Ping(ctx context.Context, h host.Host, p peer.ID) <-chan Result {
-	s, err := h.NewStream(network.WithUseTransient(ctx, "ping"), p, ID)
+	s, err := newPingStream(ctx, h, p)
 	if err != nil {
 		return pingError(err)
 	}
 
-	if err := s.Scope().SetService(ServiceName); err != nil {
-		log.Debugf("error attaching stream to ping service: %s", err)
-		s.Reset()
-		return pingError(err)
-	}
-
-	b := make([]byte, 8)
-	if _, err := rand.Read(b); err != nil {
+	ra, err := newRandReader()
+	if err != nil {
 		log.Errorf("failed to get cryptographic random: %s", err)
 		s.Reset()
 		return pingError(err)
 	}
-	ra := mrand.New(mrand.NewSource(int64(binary.BigEndian.Uint64(b))))
 
 	ctx, cancel := context.WithCancel(ctx)
 
@@ -167,15 +162,74 @@ func Ping(ctx context.Context, h host.Host, p peer.ID) <-chan Result {
 	return out
 }
 
+func newPingStream(ctx context.Context, h host.Host, p peer.ID) (network.Stream, error) {
+	s, err := h.NewStream(network.WithUseTransient(ctx, "ping"), p, ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("error attaching stream to ping service: %s", err)
+		s.Reset()
+		return nil, err
+	}
+	return s, nil
+}
+
+// newConnPingStream opens a ping stream on the given connection, bypassing the
+// host's connection selection.
+func newConnPingStream(ctx context.Context, c network.Conn) (network.Stream, error) {
+	s, err := c.NewStream(network.WithUseTransient(ctx, "ping"))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	}
+
+	if err := s.SetProtocol(ID); err != nil {
+		log.Debugf("error setting ping protocol for stream: %s", err)
+		s.Reset()
+		return nil, err
+	}
+	if err := msmux.SelectProtoOrFail(ID, s); err != nil {
+		s.Reset()
+		return nil, err
+	}
+
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("error attaching stream to ping service: %s", err)
+		s.Reset()
+		return nil, err
+	}
+	_ = s.SetDeadline(time.Time{})
+	return s, nil
+}
+
+// newRandReader returns a fast source of randomness for ping payloads, seeded from crypto/rand.
+func newRandReader() (io.Reader, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return mrand.New(mrand.NewSource(int64(binary.BigEndian.Uint64(b)))), nil
+}
+
 func ping(s network.Stream, randReader io.Reader) (time.Duration, error) {
-	if err := s.Scope().ReserveMemory(2*PingSize, network.ReservationPriorityAlways); err != nil {
+	return pingWithSize(s, randReader, PingSize)
+}
+
+// pingWithSize sends size random bytes and waits for the peer to echo them.
+// Peers echo every PingSize bytes individually, so size must be a multiple of PingSize.
+func pingWithSize(s network.Stream, randReader io.Reader, size int) (time.Duration, error) {
+	if err := s.Scope().ReserveMemory(2*size, network.ReservationPriorityAlways); err != nil {
 		log.Debugf("error reserving memory for ping stream: %s", err)
 		s.Reset()
 		return 0, err
 	}
-	defer s.Scope().ReleaseMemory(2 * PingSize)
+	defer s.Scope().ReleaseMemory(2 * size)
 
-	buf := pool.Get(PingSize)
+	buf := pool.Get(size)
 	defer pool.Put(buf)
 
 	if _, err := io.ReadFull(randReader, buf); err != nil {
@@ -187,7 +241,7 @@ func ping(s network.Stream, randReader io.Reader) (time.Duration, error) {
 		return 0, err
 	}
 
-	rbuf := pool.Get(PingSize)
+	rbuf := pool.Get(size)
 	defer pool.Put(rbuf)
 
 	if _, err := io.ReadFull(s, rbuf); err != nil {
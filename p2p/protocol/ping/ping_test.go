@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/peer"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
@@ -55,3 +56,136 @@ func testPing(t *testing.T, ps *ping.PingService, p peer.ID) {
 	}
 
 }
+
+func TestProbe(t *testing.T) {
+	h1, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+	h2, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+	h3, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h3.Close()
+	h3.Start()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h3.ID(), Addrs: h3.Addrs()}))
+
+	ps1 := ping.NewPingService(h1)
+	ping.NewPingService(h2)
+
+	start := time.Now()
+	stats, err := ps1.Probe(context.Background(), h2.ID(),
+		ping.WithCount(4),
+		ping.WithInterval(50*time.Millisecond),
+		ping.WithPayloadSize(4*ping.PingSize),
+	)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	require.Equal(t, 4, stats.Sent)
+	require.Equal(t, 4, stats.Received)
+	require.Zero(t, stats.Loss)
+	require.Len(t, stats.RTTs, 4)
+	require.LessOrEqual(t, stats.Min, stats.Avg)
+	require.LessOrEqual(t, stats.Avg, stats.Max)
+	require.LessOrEqual(t, stats.Min, stats.P95)
+	require.LessOrEqual(t, stats.P95, stats.Max)
+	require.LessOrEqual(t, stats.Jitter, stats.Max-stats.Min)
+	require.NotZero(t, h1.Peerstore().LatencyEWMA(h2.ID()))
+
+	// h3 doesn't run the ping service, so all probes are lost
+	stats, err = ps1.Probe(context.Background(), h3.ID(), ping.WithCount(2), ping.WithInterval(0))
+	require.Error(t, err)
+	require.Equal(t, 2, stats.Sent)
+	require.Zero(t, stats.Received)
+	require.Equal(t, 1.0, stats.Loss)
+
+	_, err = ps1.Probe(context.Background(), h2.ID(), ping.WithPayloadSize(ping.PingSize+1))
+	require.Error(t, err)
+	_, err = ps1.Probe(context.Background(), h2.ID(), ping.WithCount(0))
+	require.Error(t, err)
+}
+
+func TestProbeOverConn(t *testing.T) {
+	h1, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+	h2, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	ping.NewPingService(h2)
+
+	conns := h1.Network().ConnsToPeer(h2.ID())
+	require.NotEmpty(t, conns)
+	stats, err := ping.Probe(context.Background(), h1, h2.ID(),
+		ping.WithConnID(conns[0].ID()),
+		ping.WithCount(2),
+		ping.WithInterval(0),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.Received)
+	// pinned probes don't affect the peer's latency estimate
+	require.Zero(t, h1.Peerstore().LatencyEWMA(h2.ID()))
+
+	_, err = ping.Probe(context.Background(), h1, h2.ID(), ping.WithConnID("unknown"), ping.WithCount(1))
+	require.ErrorIs(t, err, ping.ErrConnNotFound)
+
+	all, err := ping.ProbeConns(context.Background(), h1, h2.ID(), ping.WithCount(1))
+	require.NoError(t, err)
+	require.Len(t, all, len(conns))
+	for _, c := range conns {
+		require.Contains(t, all, c.ID())
+		require.Equal(t, 1, all[c.ID()].Received)
+	}
+}
+
+func TestLatencyMonitor(t *testing.T) {
+	h1, err := bhost.NewHost(swarmt.GenSwarm(t), &bhost.HostOpts{EnablePing: true})
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+	h2, err := bhost.NewHost(swarmt.GenSwarm(t), &bhost.HostOpts{EnablePing: true})
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+
+	sub, err := h1.EventBus().Subscribe(new(event.EvtPeerLatencyThresholdCrossed))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	m, err := ping.NewLatencyMonitor(h1,
+		ping.WithMonitorInterval(50*time.Millisecond),
+		ping.WithThresholds(time.Hour, time.Nanosecond),
+	)
+	require.NoError(t, err)
+	m.Start()
+	defer m.Close()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtPeerLatencyThresholdCrossed)
+		require.Equal(t, h2.ID(), evt.Peer)
+		require.Equal(t, time.Nanosecond, evt.Threshold)
+		require.True(t, evt.Above)
+		require.NotZero(t, evt.Latency)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a latency event")
+	}
+	require.NotZero(t, h1.Peerstore().LatencyEWMA(h2.ID()))
+
+	// the latency stays within the same thresholds, so no more events are emitted
+	select {
+	case e := <-sub.Out():
+		t.Fatalf("didn't expect another event: %v", e)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
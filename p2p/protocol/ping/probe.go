@@ -0,0 +1,327 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// DefaultProbeCount is the default number of probes sent by Probe.
+	DefaultProbeCount = 5
+	// DefaultProbeInterval is the default interval between two probes sent by Probe.
+	DefaultProbeInterval = time.Second
+	// DefaultProbeTimeout is the default time after which a probe is considered lost.
+	DefaultProbeTimeout = 5 * time.Second
+)
+
+type probeConfig struct {
+	count       int
+	interval    time.Duration
+	payloadSize int
+	timeout     time.Duration
+	connID      string
+}
+
+// ProbeOption is an option for Probe.
+type ProbeOption func(*probeConfig) error
+
+// WithCount sets the number of probes to send.
+func WithCount(n int) ProbeOption {
+	return func(cfg *probeConfig) error {
+		if n <= 0 {
+			return errors.New("probe count must be positive")
+		}
+		cfg.count = n
+		return nil
+	}
+}
+
+// WithInterval sets the interval between the start of two consecutive probes.
+func WithInterval(d time.Duration) ProbeOption {
+	return func(cfg *probeConfig) error {
+		if d < 0 {
+			return errors.New("probe interval must not be negative")
+		}
+		cfg.interval = d
+		return nil
+	}
+}
+
+// WithPayloadSize sets the number of bytes sent with every probe.
+// Since peers echo ping payloads in chunks of PingSize bytes, the size must be a
+// positive multiple of PingSize.
+func WithPayloadSize(size int) ProbeOption {
+	return func(cfg *probeConfig) error {
+		if size <= 0 || size%PingSize != 0 {
+			return fmt.Errorf("payload size must be a positive multiple of %d", PingSize)
+		}
+		cfg.payloadSize = size
+		return nil
+	}
+}
+
+// WithProbeTimeout sets the time after which an unanswered probe is considered lost.
+func WithProbeTimeout(d time.Duration) ProbeOption {
+	return func(cfg *probeConfig) error {
+		if d <= 0 {
+			return errors.New("probe timeout must be positive")
+		}
+		cfg.timeout = d
+		return nil
+	}
+}
+
+// WithConnID pins all probes to the connection with the given ID (see network.Conn.ID),
+// so that the latency of different paths to the same peer can be compared.
+// If no open connection to the peer has this ID, Probe fails with ErrConnNotFound.
+// RTTs measured over a pinned connection are not recorded in the peerstore, since they
+// don't necessarily reflect the latency of the path the host would pick.
+func WithConnID(id string) ProbeOption {
+	return func(cfg *probeConfig) error {
+		if id == "" {
+			return errors.New("connection ID must not be empty")
+		}
+		cfg.connID = id
+		return nil
+	}
+}
+
+// ErrConnNotFound is returned by Probe if the connection selected with WithConnID
+// is not (or no longer) open.
+var ErrConnNotFound = errors.New("connection to peer not found")
+
+// Stats are the aggregate statistics of a series of ping probes.
+type Stats struct {
+	// Sent is the number of probes sent.
+	Sent int
+	// Received is the number of probes that were answered in time.
+	Received int
+	// Loss is the fraction of probes that were not answered, between 0 and 1.
+	Loss float64
+
+	// RTTs are the round trip times of the answered probes, in the order they were sent.
+	RTTs []time.Duration
+
+	Min time.Duration
+	Max time.Duration
+	Avg time.Duration
+	P95 time.Duration
+	// Jitter is the mean difference between the RTTs of consecutive answered probes.
+	Jitter time.Duration
+}
+
+func newStats(sent int, rtts []time.Duration) *Stats {
+	s := &Stats{Sent: sent, Received: len(rtts), RTTs: rtts}
+	if sent > 0 {
+		s.Loss = float64(sent-len(rtts)) / float64(sent)
+	}
+	if len(rtts) == 0 {
+		return s
+	}
+
+	var sum, jitter time.Duration
+	for i, rtt := range rtts {
+		sum += rtt
+		if i > 0 {
+			d := rtt - rtts[i-1]
+			if d < 0 {
+				d = -d
+			}
+			jitter += d
+		}
+	}
+	s.Avg = sum / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		s.Jitter = jitter / time.Duration(len(rtts)-1)
+	}
+
+	sorted := make([]time.Duration, len(rtts))
+	copy(sorted, rtts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s.Min = sorted[0]
+	s.Max = sorted[len(sorted)-1]
+	// nearest-rank percentile
+	rank := (95*len(sorted) + 99) / 100
+	s.P95 = sorted[rank-1]
+	return s
+}
+
+// Probe sends a series of ping probes to the peer using the service's host.
+// See the Probe function for details.
+func (ps *PingService) Probe(ctx context.Context, p peer.ID, opts ...ProbeOption) (*Stats, error) {
+	return Probe(ctx, ps.Host, p, opts...)
+}
+
+// Probe sends a series of ping probes to the remote peer and returns aggregate statistics.
+// Probes that aren't answered within the probe timeout are counted as lost, and the
+// next probe is sent on a new stream.
+// An error is returned if the options are invalid, if the context is canceled,
+// or if none of the probes was answered.
+func Probe(ctx context.Context, h host.Host, p peer.ID, opts ...ProbeOption) (*Stats, error) {
+	cfg := probeConfig{
+		count:       DefaultProbeCount,
+		interval:    DefaultProbeInterval,
+		payloadSize: PingSize,
+		timeout:     DefaultProbeTimeout,
+	}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	ra, err := newRandReader()
+	if err != nil {
+		log.Errorf("failed to get cryptographic random: %s", err)
+		return nil, err
+	}
+
+	openStream := func(ctx context.Context) (network.Stream, error) {
+		return newPingStream(ctx, h, p)
+	}
+	if cfg.connID != "" {
+		openStream = func(ctx context.Context) (network.Stream, error) {
+			c := findConn(h, p, cfg.connID)
+			if c == nil {
+				return nil, ErrConnNotFound
+			}
+			return newConnPingStream(ctx, c)
+		}
+	}
+
+	var s network.Stream
+	defer func() {
+		if s != nil {
+			s.Reset()
+		}
+	}()
+
+	var lastErr error
+	rtts := make([]time.Duration, 0, cfg.count)
+	var next time.Time
+	for i := 0; i < cfg.count; i++ {
+		if i > 0 {
+			if err := sleepUntil(ctx, next); err != nil {
+				return nil, err
+			}
+		}
+		start := time.Now()
+		next = start.Add(cfg.interval)
+
+		if s == nil {
+			probeCtx, cancel := context.WithTimeout(ctx, cfg.timeout)
+			s, err = openStream(probeCtx)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				if err == ErrConnNotFound {
+					return nil, err
+				}
+				lastErr = err
+				continue
+			}
+		}
+
+		_ = s.SetDeadline(start.Add(cfg.timeout))
+		rtt, err := pingWithSize(s, ra, cfg.payloadSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Debugw("ping probe failed", "peer", p, "error", err)
+			lastErr = err
+			s.Reset()
+			s = nil
+			continue
+		}
+		if cfg.connID == "" {
+			h.Peerstore().RecordLatency(p, rtt)
+		}
+		rtts = append(rtts, rtt)
+	}
+
+	stats := newStats(cfg.count, rtts)
+	if stats.Received == 0 {
+		return stats, lastErr
+	}
+	return stats, nil
+}
+
+// ProbeConns probes every open connection to the peer concurrently and returns the
+// statistics for each of them, keyed by connection ID.
+// Connections on which all probes failed are included with their loss statistics.
+// See Probe for the available options; WithConnID must not be used.
+func ProbeConns(ctx context.Context, h host.Host, p peer.ID, opts ...ProbeOption) (map[string]*Stats, error) {
+	var cfg probeConfig
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.connID != "" {
+		return nil, errors.New("WithConnID can't be used with ProbeConns")
+	}
+
+	conns := h.Network().ConnsToPeer(p)
+	if len(conns) == 0 {
+		return nil, network.ErrNoConn
+	}
+
+	type result struct {
+		id    string
+		stats *Stats
+		err   error
+	}
+	results := make(chan result, len(conns))
+	for _, c := range conns {
+		go func(id string) {
+			stats, err := Probe(ctx, h, p, append(opts[:len(opts):len(opts)], WithConnID(id))...)
+			results <- result{id: id, stats: stats, err: err}
+		}(c.ID())
+	}
+
+	out := make(map[string]*Stats, len(conns))
+	var ctxErr error
+	for range conns {
+		res := <-results
+		switch {
+		case res.stats != nil:
+			out[res.id] = res.stats
+		case res.err == context.Canceled || res.err == context.DeadlineExceeded:
+			ctxErr = res.err
+		}
+	}
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
+	return out, nil
+}
+
+func findConn(h host.Host, p peer.ID, id string) network.Conn {
+	for _, c := range h.Network().ConnsToPeer(p) {
+		if c.ID() == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
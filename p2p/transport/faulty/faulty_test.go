@@ -0,0 +1,236 @@
+package faulty
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
+	"github.com/libp2p/go-libp2p/core/sec/insecure"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	ttransport "github.com/libp2p/go-libp2p/p2p/transport/testsuite"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+var muxers = []tptu.StreamMuxer{{ID: "/yamux", Muxer: yamux.DefaultTransport}}
+
+func makeTransport(t *testing.T) (peer.ID, transport.Transport) {
+	t.Helper()
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	u, err := tptu.New([]sec.SecureTransport{insecure.NewWithIdentity(insecure.ID, id, priv)}, muxers, nil, nil, nil)
+	require.NoError(t, err)
+	tpt, err := tcp.NewTCPTransport(u, nil)
+	require.NoError(t, err)
+	return id, tpt
+}
+
+// connect returns the dialed and the accepted side of a connection from b to a.
+func connect(t *testing.T, a, b transport.Transport, idA peer.ID) (transport.CapableConn, transport.CapableConn) {
+	t.Helper()
+	l, err := a.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	accepted := make(chan transport.CapableConn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	dialed, err := b.Dial(context.Background(), l.Multiaddr(), idA)
+	require.NoError(t, err)
+	t.Cleanup(func() { dialed.Close() })
+	select {
+	case c := <-accepted:
+		t.Cleanup(func() { c.Close() })
+		return dialed, c
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+		return nil, nil
+	}
+}
+
+func TestNoFaults(t *testing.T) {
+	idA, ta := makeTransport(t)
+	_, tb := makeTransport(t)
+	ttransport.SubtestTransport(t, Wrap(ta, NewScenario()), Wrap(tb, NewScenario()), "/ip4/127.0.0.1/tcp/0", idA)
+}
+
+func TestRefuseDial(t *testing.T) {
+	idA, ta := makeTransport(t)
+	_, tb := makeTransport(t)
+	s := NewScenario(Rule{Fault: RefuseDial, Direction: network.DirOutbound, Times: 1})
+	tb = Wrap(tb, s)
+
+	l, err := ta.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	_, err = tb.Dial(context.Background(), l.Multiaddr(), idA)
+	require.ErrorIs(t, err, ErrFaultInjected)
+	c, err := tb.Dial(context.Background(), l.Multiaddr(), idA)
+	require.NoError(t, err)
+	c.Close()
+	require.Equal(t, 1, s.Injected(RefuseDial))
+}
+
+func TestRefuseInbound(t *testing.T) {
+	idA, ta := makeTransport(t)
+	_, tb := makeTransport(t)
+	s := NewScenario(Rule{Fault: RefuseDial, Times: 1})
+	ta = Wrap(ta, s)
+
+	l, err := ta.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer l.Close()
+	accepted := make(chan transport.CapableConn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	refused, err := tb.Dial(context.Background(), l.Multiaddr(), idA)
+	require.NoError(t, err)
+	defer refused.Close()
+	_, err = refused.AcceptStream()
+	require.Error(t, err)
+
+	c, err := tb.Dial(context.Background(), l.Multiaddr(), idA)
+	require.NoError(t, err)
+	defer c.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	require.Equal(t, 1, s.Injected(RefuseDial))
+}
+
+func TestStallHandshake(t *testing.T) {
+	idA, ta := makeTransport(t)
+	_, tb := makeTransport(t)
+	tb = Wrap(tb, NewScenario(
+		Rule{Fault: StallHandshake, Times: 1},
+		Rule{Fault: StallHandshake, Duration: 50 * time.Millisecond},
+	))
+
+	l, err := ta.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = tb.Dial(ctx, l.Multiaddr(), idA)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	start := time.Now()
+	c, err := tb.Dial(context.Background(), l.Multiaddr(), idA)
+	require.NoError(t, err)
+	c.Close()
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestResetStream(t *testing.T) {
+	idA, ta := makeTransport(t)
+	_, tb := makeTransport(t)
+	tb = Wrap(tb, NewScenario(Rule{Fault: ResetStream, Direction: network.DirOutbound, Bytes: 3}))
+	dialed, accepted := connect(t, ta, tb, idA)
+
+	s, err := dialed.OpenStream(context.Background())
+	require.NoError(t, err)
+	n, err := s.Write([]byte("hello"))
+	require.Equal(t, 3, n)
+	require.ErrorIs(t, err, network.ErrReset)
+
+	rs, err := accepted.AcceptStream()
+	require.NoError(t, err)
+	// the reset may overtake the bytes written before it
+	b, err := io.ReadAll(rs)
+	require.ErrorIs(t, err, network.ErrReset)
+	require.True(t, strings.HasPrefix("hel", string(b)))
+}
+
+func TestDeadlines(t *testing.T) {
+	idA, ta := makeTransport(t)
+	_, tb := makeTransport(t)
+	tb = Wrap(tb, NewScenario(
+		Rule{Fault: ExpireDeadlines, Times: 1},
+		Rule{Fault: IgnoreDeadlines},
+	))
+	dialed, accepted := connect(t, ta, tb, idA)
+
+	s, err := dialed.OpenStream(context.Background())
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.SetReadDeadline(time.Now().Add(time.Hour)))
+	_, err = s.Read(make([]byte, 1))
+	var nerr net.Error
+	require.True(t, errors.As(err, &nerr) && nerr.Timeout(), "expected a timeout, got %v", err)
+
+	s, err = dialed.OpenStream(context.Background())
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	read := make(chan error, 1)
+	go func() {
+		_, err := s.Read(make([]byte, 1))
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		t.Fatalf("read returned early: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	// the inbound streams of the accepting side are not affected
+	for i := 0; i < 2; i++ {
+		rs, err := accepted.AcceptStream()
+		require.NoError(t, err)
+		defer rs.Close()
+		if i == 1 {
+			_, err = rs.Write([]byte("a"))
+			require.NoError(t, err)
+		}
+	}
+	select {
+	case err := <-read:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,180 @@
+// Package faulty wraps transports to inject failures into the connections and
+// streams they establish, for integration tests of the resilience of applications:
+//
+//	s := faulty.NewScenario(
+//		// the first two dials fail
+//		faulty.Rule{Fault: faulty.RefuseDial, Direction: network.DirOutbound, Times: 2},
+//		// then every stream is reset after 1KiB is written to it
+//		faulty.Rule{Fault: faulty.ResetStream, Bytes: 1 << 10},
+//	)
+//	tpt, err := tcp.NewTCPTransport(upgrader, rcmgr)
+//	...
+//	swarm.AddTransport(faulty.Wrap(tpt, s))
+//
+// The rules of a scenario can be changed while it runs, to script the failures of
+// the different phases of a test.
+package faulty
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ErrFaultInjected is wrapped by the errors of injected failures.
+var ErrFaultInjected = errors.New("fault injected")
+
+// Fault is a failure injected by a Rule.
+type Fault int
+
+const (
+	// RefuseDial fails the connection. Outbound, Dial returns an error wrapping
+	// ErrFaultInjected. Inbound, the connection is closed as soon as it's accepted.
+	RefuseDial Fault = iota + 1
+	// StallHandshake delays the establishment of the connection by the Duration of
+	// the rule. Outbound, Dial fails when its context is done. Inbound, the
+	// connection is closed if the listener is closed first. A Duration of 0 stalls
+	// the connection until then.
+	//
+	// The delay is injected after the wrapped transport completed the handshake, as
+	// the wrapper doesn't see the raw connection, so the remote peer sees the
+	// connection as established and may open streams on it. It emulates a slow
+	// handshake to the local peer only.
+	StallHandshake
+	// ResetStream resets the stream once the Bytes of the rule were written to it,
+	// in the middle of the write that exceeds them.
+	ResetStream
+	// IgnoreDeadlines makes the deadlines of the stream have no effect. Setting them
+	// still succeeds.
+	IgnoreDeadlines
+	// ExpireDeadlines makes the deadlines of the stream expire as soon as they are
+	// set, whatever their value.
+	ExpireDeadlines
+)
+
+func (f Fault) String() string {
+	switch f {
+	case RefuseDial:
+		return "refuse dial"
+	case StallHandshake:
+		return "stall handshake"
+	case ResetStream:
+		return "reset stream"
+	case IgnoreDeadlines:
+		return "ignore deadlines"
+	case ExpireDeadlines:
+		return "expire deadlines"
+	default:
+		return fmt.Sprintf("unknown fault %d", int(f))
+	}
+}
+
+// onConn returns true for the faults injected into connections, and false for the
+// faults injected into streams.
+func (f Fault) onConn() bool {
+	return f == RefuseDial || f == StallHandshake
+}
+
+// Rule injects a fault into some of the connections, or streams, of a scenario.
+type Rule struct {
+	Fault Fault
+	// Peer restricts the rule to the connections to a peer. All peers match if it's
+	// empty.
+	Peer peer.ID
+	// Direction restricts the rule to the connections, or streams, opened in a
+	// direction. Both directions match if it's DirUnknown.
+	Direction network.Direction
+	// After skips the first After connections, or streams, that match the rule.
+	After int
+	// Times is the number of times the fault is injected. The fault is injected into
+	// all the matching connections, or streams, if it's 0.
+	Times int
+
+	// Duration is how long StallHandshake stalls connections.
+	Duration time.Duration
+	// Bytes is the number of bytes written to a stream before ResetStream resets it.
+	Bytes int
+}
+
+type rule struct {
+	Rule
+	seen, injected int
+}
+
+// Scenario is a list of rules. For every new connection, or stream, the fault of the
+// first rule that matches it and hasn't been injected Times yet is injected, if
+// any. A Scenario can be shared by several transports.
+type Scenario struct {
+	mx    sync.Mutex
+	rules []*rule
+	// injected counts the injected faults
+	injected map[Fault]int
+}
+
+// NewScenario creates a Scenario with rules.
+func NewScenario(rules ...Rule) *Scenario {
+	s := &Scenario{injected: make(map[Fault]int)}
+	s.Add(rules...)
+	return s
+}
+
+// Add appends rules to the scenario.
+func (s *Scenario) Add(rules ...Rule) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for _, r := range rules {
+		s.rules = append(s.rules, &rule{Rule: r})
+	}
+}
+
+// Reset removes all the rules of the scenario, and the counts of injected faults.
+func (s *Scenario) Reset() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.rules = nil
+	s.injected = make(map[Fault]int)
+}
+
+// Injected returns the number of times f was injected.
+func (s *Scenario) Injected(f Fault) int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.injected[f]
+}
+
+// connFault returns the rule injecting a fault into a new connection, if any.
+func (s *Scenario) connFault(p peer.ID, dir network.Direction) (Rule, bool) {
+	return s.next(true, p, dir)
+}
+
+// streamFault returns the rule injecting a fault into a new stream, if any.
+func (s *Scenario) streamFault(p peer.ID, dir network.Direction) (Rule, bool) {
+	return s.next(false, p, dir)
+}
+
+func (s *Scenario) next(onConn bool, p peer.ID, dir network.Direction) (Rule, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for _, r := range s.rules {
+		if r.Fault.onConn() != onConn ||
+			(r.Peer != "" && r.Peer != p) ||
+			(r.Direction != network.DirUnknown && r.Direction != dir) {
+			continue
+		}
+		if r.Times > 0 && r.injected >= r.Times {
+			continue
+		}
+		r.seen++
+		if r.seen <= r.After {
+			continue
+		}
+		r.injected++
+		s.injected[r.Fault]++
+		return r.Rule, true
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,254 @@
+package faulty
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/transport"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+type faultyTransport struct {
+	transport.Transport
+	scenario *Scenario
+}
+
+var _ transport.Transport = &faultyTransport{}
+var _ io.Closer = &faultyTransport{}
+
+// Wrap returns a transport that injects the faults of the scenario into the
+// connections and streams of t. The wrapper closes t when it's closed, but doesn't
+// implement the other optional interfaces of t, such as transport.Resolver.
+func Wrap(t transport.Transport, s *Scenario) transport.Transport {
+	return &faultyTransport{Transport: t, scenario: s}
+}
+
+func (t *faultyTransport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (transport.CapableConn, error) {
+	r, ok := t.scenario.connFault(p, network.DirOutbound)
+	if ok && r.Fault == RefuseDial {
+		return nil, fmt.Errorf("dial to %s refused: %w", raddr, ErrFaultInjected)
+	}
+	c, err := t.Transport.Dial(ctx, raddr, p)
+	if err != nil {
+		return nil, err
+	}
+	if ok && r.Fault == StallHandshake {
+		// The wrapped transport already completed the handshake, the connection is only
+		// withheld from the caller, see StallHandshake.
+		var timeout <-chan time.Time
+		if r.Duration > 0 {
+			timer := time.NewTimer(r.Duration)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-timeout:
+		case <-ctx.Done():
+			c.Close()
+			return nil, ctx.Err()
+		}
+	}
+	return &conn{CapableConn: c, transport: t}, nil
+}
+
+func (t *faultyTransport) Listen(laddr ma.Multiaddr) (transport.Listener, error) {
+	l, err := t.Transport.Listen(laddr)
+	if err != nil {
+		return nil, err
+	}
+	fl := &listener{
+		Listener:  l,
+		transport: t,
+		conns:     make(chan transport.CapableConn),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go fl.run()
+	return fl, nil
+}
+
+func (t *faultyTransport) Close() error {
+	if c, ok := t.Transport.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (t *faultyTransport) String() string {
+	return fmt.Sprintf("faulty %s", t.Transport)
+}
+
+// listener accepts the connections of the wrapped listener in the background, so
+// that stalled connections don't block the others.
+type listener struct {
+	transport.Listener
+	transport *faultyTransport
+
+	conns     chan transport.CapableConn
+	closeOnce sync.Once
+	closing   chan struct{}
+	// done is closed when the wrapped listener fails to accept, with err
+	done chan struct{}
+	err  error
+}
+
+func (l *listener) run() {
+	defer close(l.done)
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			return
+		}
+		r, ok := l.transport.scenario.connFault(c.RemotePeer(), network.DirInbound)
+		fc := &conn{CapableConn: c, transport: l.transport}
+		switch {
+		case ok && r.Fault == RefuseDial:
+			c.Close()
+		case ok && r.Fault == StallHandshake:
+			go l.stall(fc, r.Duration)
+		default:
+			l.deliver(fc)
+		}
+	}
+}
+
+func (l *listener) stall(c *conn, d time.Duration) {
+	var timeout <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-timeout:
+		l.deliver(c)
+	case <-l.closing:
+		c.Close()
+	}
+}
+
+func (l *listener) deliver(c *conn) {
+	select {
+	case l.conns <- c:
+	case <-l.closing:
+		c.Close()
+	}
+}
+
+func (l *listener) Accept() (transport.CapableConn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() { close(l.closing) })
+	return l.Listener.Close()
+}
+
+type conn struct {
+	transport.CapableConn
+	transport *faultyTransport
+}
+
+func (c *conn) Transport() transport.Transport {
+	return c.transport
+}
+
+func (c *conn) OpenStream(ctx context.Context) (network.MuxedStream, error) {
+	s, err := c.CapableConn.OpenStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.wrapStream(s, network.DirOutbound), nil
+}
+
+func (c *conn) AcceptStream() (network.MuxedStream, error) {
+	s, err := c.CapableConn.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return c.wrapStream(s, network.DirInbound), nil
+}
+
+func (c *conn) wrapStream(s network.MuxedStream, dir network.Direction) network.MuxedStream {
+	r, ok := c.transport.scenario.streamFault(c.RemotePeer(), dir)
+	if !ok {
+		return s
+	}
+	return &stream{MuxedStream: s, fault: r}
+}
+
+type stream struct {
+	network.MuxedStream
+	fault Rule
+
+	mx      sync.Mutex
+	written int
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	if s.fault.Fault != ResetStream {
+		return s.MuxedStream.Write(b)
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	remaining := s.fault.Bytes - s.written
+	if len(b) <= remaining {
+		n, err := s.MuxedStream.Write(b)
+		s.written += n
+		return n, err
+	}
+	var n int
+	if remaining > 0 {
+		n, _ = s.MuxedStream.Write(b[:remaining])
+		s.written += n
+	}
+	s.MuxedStream.Reset()
+	return n, network.ErrReset
+}
+
+func (s *stream) SetDeadline(t time.Time) error {
+	if t, ok := s.deadline(t); ok {
+		return s.MuxedStream.SetDeadline(t)
+	}
+	return nil
+}
+
+func (s *stream) SetReadDeadline(t time.Time) error {
+	if t, ok := s.deadline(t); ok {
+		return s.MuxedStream.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (s *stream) SetWriteDeadline(t time.Time) error {
+	if t, ok := s.deadline(t); ok {
+		return s.MuxedStream.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// deadline returns the deadline to set on the wrapped stream instead of t, or false
+// if it must not be set.
+func (s *stream) deadline(t time.Time) (time.Time, bool) {
+	switch s.fault.Fault {
+	case IgnoreDeadlines:
+		return time.Time{}, false
+	case ExpireDeadlines:
+		if !t.IsZero() {
+			return time.Now(), true
+		}
+	}
+	return t, true
+}
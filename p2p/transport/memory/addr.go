@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// P_MEMORY is the multicodec of the /memory multiaddr protocol. Its value is the
+// 64 bit identifier of a listener in the process.
+const P_MEMORY = 0x0309
+
+func init() {
+	if ma.ProtocolWithCode(P_MEMORY).Code != 0 {
+		// registered by another package
+		return
+	}
+	if err := ma.AddProtocol(ma.Protocol{
+		Name:       "memory",
+		Code:       P_MEMORY,
+		VCode:      ma.CodeToVarint(P_MEMORY),
+		Size:       64,
+		Transcoder: ma.NewTranscoderFromFunctions(memoryStB, memoryBtS, memoryValidate),
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func memoryStB(s string) ([]byte, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse memory address %q: %w", s, err)
+	}
+	return binary.BigEndian.AppendUint64(nil, id), nil
+}
+
+func memoryBtS(b []byte) (string, error) {
+	if err := memoryValidate(b); err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(binary.BigEndian.Uint64(b), 10), nil
+}
+
+func memoryValidate(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("invalid length for memory address: %d", len(b))
+	}
+	return nil
+}
+
+// Addr is the address of a listener, or of the dialing side of a connection.
+type Addr uint64
+
+var _ net.Addr = Addr(0)
+
+func (a Addr) Network() string { return "memory" }
+
+func (a Addr) String() string { return strconv.FormatUint(uint64(a), 10) }
+
+// Multiaddr returns the /memory multiaddr of a.
+func (a Addr) Multiaddr() ma.Multiaddr {
+	m, err := ma.NewComponent("memory", a.String())
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// parseAddr returns the address of a /memory multiaddr.
+func parseAddr(m ma.Multiaddr) (Addr, error) {
+	first, rest := ma.SplitFirst(m)
+	if first == nil || first.Protocol().Code != P_MEMORY || rest != nil {
+		return 0, fmt.Errorf("not a memory address: %s", m)
+	}
+	return Addr(binary.BigEndian.Uint64(first.RawValue())), nil
+}
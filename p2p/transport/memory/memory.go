@@ -0,0 +1,191 @@
+// Package memory implements a transport for hosts in the same process, such as the
+// nodes of a simulation or of an embedded multi-node setup. Connections don't use
+// sockets, but are upgraded like those of the other transports: they are secured,
+// multiplexed, and accounted for by the resource manager.
+//
+// Its addresses are /memory/<id> multiaddrs, where id identifies a listener in the
+// process. Listening on /memory/0 picks an unused id:
+//
+//	h, err := libp2p.New(
+//		libp2p.Transport(memory.NewTransport),
+//		libp2p.ListenAddrStrings("/memory/0"),
+//	)
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/transport"
+
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+var log = logging.Logger("memory-tpt")
+
+// ErrConnectionRefused is returned when dialing an address no one listens on.
+var ErrConnectionRefused = errors.New("connection refused")
+
+// listeners are the listeners of the process, by address.
+var listeners = struct {
+	mx sync.Mutex
+	m  map[Addr]*listener
+}{m: make(map[Addr]*listener)}
+
+// newAddr returns an address no one listens on. Dialers get one too, so that the
+// local and remote addresses of all connections are distinct.
+func newAddr() Addr {
+	for {
+		a := Addr(rand.Uint64())
+		if a == 0 {
+			continue
+		}
+		if _, ok := listeners.m[a]; !ok {
+			return a
+		}
+	}
+}
+
+// Transport is the memory transport.
+type Transport struct {
+	upgrader transport.Upgrader
+	rcmgr    network.ResourceManager
+}
+
+var _ transport.Transport = &Transport{}
+
+// NewTransport creates a memory transport.
+func NewTransport(upgrader transport.Upgrader, rcmgr network.ResourceManager) (*Transport, error) {
+	if rcmgr == nil {
+		rcmgr = &network.NullResourceManager{}
+	}
+	return &Transport{upgrader: upgrader, rcmgr: rcmgr}, nil
+}
+
+// CanDial returns true if addr is a /memory address.
+func (t *Transport) CanDial(addr ma.Multiaddr) bool {
+	_, err := parseAddr(addr)
+	return err == nil
+}
+
+func (t *Transport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (transport.CapableConn, error) {
+	connScope, err := t.rcmgr.OpenConnection(network.DirOutbound, true, raddr)
+	if err != nil {
+		log.Debugw("resource manager blocked outgoing connection", "peer", p, "addr", raddr, "error", err)
+		return nil, err
+	}
+	c, err := t.dialWithScope(ctx, raddr, p, connScope)
+	if err != nil {
+		connScope.Done()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (t *Transport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p peer.ID, connScope network.ConnManagementScope) (transport.CapableConn, error) {
+	if err := connScope.SetPeer(p); err != nil {
+		log.Debugw("resource manager blocked outgoing connection for peer", "peer", p, "addr", raddr, "error", err)
+		return nil, err
+	}
+	a, err := parseAddr(raddr)
+	if err != nil {
+		return nil, err
+	}
+	listeners.mx.Lock()
+	l, ok := listeners.m[a]
+	local := newAddr()
+	listeners.mx.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("dial %s: %w", raddr, ErrConnectionRefused)
+	}
+
+	c, lc := newConnPair(local, a)
+	select {
+	case l.incoming <- lc:
+	case <-l.closed:
+		return nil, fmt.Errorf("dial %s: %w", raddr, ErrConnectionRefused)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	direction := network.DirOutbound
+	if ok, isClient, _ := network.GetSimultaneousConnect(ctx); ok && !isClient {
+		direction = network.DirInbound
+	}
+	return t.upgrader.Upgrade(ctx, t, c, direction, p, connScope)
+}
+
+// Listen listens on a /memory address. If its id is 0, it picks an unused one.
+func (t *Transport) Listen(laddr ma.Multiaddr) (transport.Listener, error) {
+	a, err := parseAddr(laddr)
+	if err != nil {
+		return nil, err
+	}
+	listeners.mx.Lock()
+	if a == 0 {
+		a = newAddr()
+	} else if _, ok := listeners.m[a]; ok {
+		listeners.mx.Unlock()
+		return nil, fmt.Errorf("already listening on %s", laddr)
+	}
+	l := &listener{addr: a, incoming: make(chan *conn), closed: make(chan struct{})}
+	listeners.m[a] = l
+	listeners.mx.Unlock()
+	return t.upgrader.UpgradeListener(t, l), nil
+}
+
+func (t *Transport) Protocols() []int {
+	return []int{P_MEMORY}
+}
+
+func (t *Transport) Proxy() bool {
+	return false
+}
+
+func (t *Transport) String() string {
+	return "memory"
+}
+
+type listener struct {
+	addr     Addr
+	incoming chan *conn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ manet.Listener = &listener{}
+
+func (l *listener) Accept() (manet.Conn, error) {
+	select {
+	case c := <-l.incoming:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		listeners.mx.Lock()
+		delete(listeners.m, l.addr)
+		listeners.mx.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *listener) Multiaddr() ma.Multiaddr {
+	return l.addr.Multiaddr()
+}
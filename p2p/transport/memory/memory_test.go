@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
+	"github.com/libp2p/go-libp2p/core/sec/insecure"
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	ttransport "github.com/libp2p/go-libp2p/p2p/transport/testsuite"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+var muxers = []tptu.StreamMuxer{{ID: "/yamux", Muxer: yamux.DefaultTransport}}
+
+func makeTransport(t *testing.T) (peer.ID, *Transport) {
+	t.Helper()
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	u, err := tptu.New([]sec.SecureTransport{insecure.NewWithIdentity(insecure.ID, id, priv)}, muxers, nil, nil, nil)
+	require.NoError(t, err)
+	tpt, err := NewTransport(u, nil)
+	require.NoError(t, err)
+	return id, tpt
+}
+
+func TestMemoryTransport(t *testing.T) {
+	peerA, ta := makeTransport(t)
+	_, tb := makeTransport(t)
+	ttransport.SubtestTransport(t, ta, tb, "/memory/0", peerA)
+}
+
+func TestAddrs(t *testing.T) {
+	a := ma.StringCast("/memory/1234")
+	require.Equal(t, "/memory/1234", a.String())
+	addr, err := parseAddr(a)
+	require.NoError(t, err)
+	require.Equal(t, Addr(1234), addr)
+	require.True(t, a.Equal(addr.Multiaddr()))
+
+	_, err = ma.NewMultiaddr("/memory/foo")
+	require.Error(t, err)
+	_, err = parseAddr(ma.StringCast("/memory/1234/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC"))
+	require.Error(t, err)
+
+	_, tpt := makeTransport(t)
+	require.True(t, tpt.CanDial(a))
+	require.False(t, tpt.CanDial(ma.StringCast("/ip4/127.0.0.1/tcp/1234")))
+}
+
+func TestListen(t *testing.T) {
+	idA, ta := makeTransport(t)
+	_, tb := makeTransport(t)
+
+	l, err := ta.Listen(ma.StringCast("/memory/0"))
+	require.NoError(t, err)
+	addr, err := parseAddr(l.Multiaddr())
+	require.NoError(t, err)
+	require.NotZero(t, addr)
+	_, err = ta.Listen(l.Multiaddr())
+	require.Error(t, err)
+
+	require.NoError(t, l.Close())
+	_, err = tb.Dial(context.Background(), l.Multiaddr(), idA)
+	require.ErrorIs(t, err, ErrConnectionRefused)
+
+	// the address can be reused once the listener is closed
+	l, err = ta.Listen(l.Multiaddr())
+	require.NoError(t, err)
+	l.Close()
+}
+
+func TestConnPipe(t *testing.T) {
+	a, b := newConnPair(1, 2)
+	require.Equal(t, Addr(1), a.LocalAddr())
+	require.Equal(t, Addr(2), a.RemoteAddr())
+
+	// both sides can write at the same time
+	_, err := a.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = b.Write([]byte("world"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(b, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf))
+	_, err = io.ReadFull(a, buf)
+	require.NoError(t, err)
+	require.Equal(t, "world", string(buf))
+
+	// writes block when the buffer is full
+	require.NoError(t, a.SetWriteDeadline(time.Now().Add(50*time.Millisecond)))
+	n, err := a.Write(make([]byte, maxBuffered+1))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.Equal(t, maxBuffered, n)
+	require.NoError(t, a.SetWriteDeadline(time.Time{}))
+
+	require.NoError(t, b.SetReadDeadline(time.Now().Add(-time.Second)))
+	_, err = b.Read(buf)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.NoError(t, b.SetReadDeadline(time.Time{}))
+
+	// the remote reads the buffered data before io.EOF
+	require.NoError(t, a.Close())
+	data, err := io.ReadAll(b)
+	require.NoError(t, err)
+	require.Len(t, data, maxBuffered)
+	_, err = b.Write([]byte("foo"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+}
@@ -0,0 +1,238 @@
+package memory
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// maxBuffered bounds the bytes written to a connection that weren't read yet. Writes
+// block until the remote reads.
+const maxBuffered = 1 << 20
+
+// buffer holds the bytes written in one direction of a connection.
+type buffer struct {
+	mx   sync.Mutex
+	data []byte
+	// eof is set when the writer closed the connection. The reader gets io.EOF once
+	// it has read the data.
+	eof bool
+	// broken is set when the reader closed the connection. Writes fail.
+	broken bool
+
+	// readable and writable are signaled when data, or space, become available, or
+	// when the buffer is closed
+	readable chan struct{}
+	writable chan struct{}
+}
+
+func newBuffer() *buffer {
+	return &buffer{readable: make(chan struct{}, 1), writable: make(chan struct{}, 1)}
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// conn is one end of an in-memory connection. Unlike net.Pipe, writes are buffered,
+// so that both ends can write at the same time.
+type conn struct {
+	in, out *buffer
+
+	laddr, raddr Addr
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	readDeadline, writeDeadline deadline
+}
+
+var _ manet.Conn = &conn{}
+
+func newConnPair(dialer, listener Addr) (*conn, *conn) {
+	ab, ba := newBuffer(), newBuffer()
+	a := &conn{in: ba, out: ab, laddr: dialer, raddr: listener, closed: make(chan struct{}),
+		readDeadline: makeDeadline(), writeDeadline: makeDeadline()}
+	b := &conn{in: ab, out: ba, laddr: listener, raddr: dialer, closed: make(chan struct{}),
+		readDeadline: makeDeadline(), writeDeadline: makeDeadline()}
+	return a, b
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	for {
+		select {
+		case <-c.closed:
+			return 0, net.ErrClosed
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		default:
+		}
+		c.in.mx.Lock()
+		if len(c.in.data) > 0 {
+			n := copy(b, c.in.data)
+			c.in.data = c.in.data[n:]
+			if len(c.in.data) == 0 {
+				c.in.data = nil
+			}
+			c.in.mx.Unlock()
+			signal(c.in.writable)
+			return n, nil
+		}
+		eof := c.in.eof
+		c.in.mx.Unlock()
+		if eof {
+			return 0, io.EOF
+		}
+		if len(b) == 0 {
+			return 0, nil
+		}
+
+		select {
+		case <-c.in.readable:
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		case <-c.closed:
+			return 0, net.ErrClosed
+		}
+	}
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	var n int
+	for {
+		select {
+		case <-c.closed:
+			return n, net.ErrClosed
+		case <-c.writeDeadline.wait():
+			return n, os.ErrDeadlineExceeded
+		default:
+		}
+		c.out.mx.Lock()
+		if c.out.broken {
+			c.out.mx.Unlock()
+			return n, io.ErrClosedPipe
+		}
+		if space := maxBuffered - len(c.out.data); space > 0 {
+			chunk := b[n:]
+			if len(chunk) > space {
+				chunk = chunk[:space]
+			}
+			c.out.data = append(c.out.data, chunk...)
+			n += len(chunk)
+			c.out.mx.Unlock()
+			signal(c.out.readable)
+			if n == len(b) {
+				return n, nil
+			}
+			continue
+		}
+		c.out.mx.Unlock()
+
+		select {
+		case <-c.out.writable:
+		case <-c.writeDeadline.wait():
+			return n, os.ErrDeadlineExceeded
+		case <-c.closed:
+			return n, net.ErrClosed
+		}
+	}
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.out.mx.Lock()
+		c.out.eof = true
+		c.out.mx.Unlock()
+		signal(c.out.readable)
+		c.in.mx.Lock()
+		c.in.broken = true
+		c.in.data = nil
+		c.in.mx.Unlock()
+		signal(c.in.writable)
+	})
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr           { return c.laddr }
+func (c *conn) RemoteAddr() net.Addr          { return c.raddr }
+func (c *conn) LocalMultiaddr() ma.Multiaddr  { return c.laddr.Multiaddr() }
+func (c *conn) RemoteMultiaddr() ma.Multiaddr { return c.raddr.Multiaddr() }
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// deadline is a deadline that can be waited on, as in net.Pipe.
+type deadline struct {
+	mx     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // closed when the deadline expires
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the timer to close cancel
+	}
+	d.timer = nil
+
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+func (d *deadline) wait() chan struct{} {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.cancel
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	tpt "github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
 
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/quic-go/quic-go"
@@ -16,6 +17,7 @@ type conn struct {
 	quicConn  quic.Connection
 	transport *transport
 	scope     network.ConnManagementScope
+	window    *quicreuse.ReceiveWindow
 
 	localPeer      peer.ID
 	localMultiaddr ma.Multiaddr
@@ -37,6 +39,7 @@ func (c *conn) Close() error {
 func (c *conn) closeWithError(errCode quic.ApplicationErrorCode, errString string) error {
 	c.transport.removeConn(c.quicConn)
 	err := c.quicConn.CloseWithError(errCode, errString)
+	c.window.Close()
 	c.scope.Done()
 	return err
 }
@@ -47,7 +50,7 @@ func (c *conn) IsClosed() bool {
 }
 
 func (c *conn) allowWindowIncrease(size uint64) bool {
-	return c.scope.ReserveMemory(int(size), network.ReservationPriorityMedium) == nil
+	return c.window.Grow(size)
 }
 
 // OpenStream creates a new stream.
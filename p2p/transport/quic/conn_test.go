@@ -34,6 +34,10 @@ type connTestCase struct {
 	Options []quicreuse.Option
 }
 
+// initialConnectionReceiveWindow is the initial connection receive window of the
+// QUIC config used by quicreuse, which is reserved when a connection is established.
+const initialConnectionReceiveWindow = 768 << 10
+
 var connTestCases = []*connTestCase{
 	{"reuseport_on", []quicreuse.Option{quicreuse.DisableDraft29()}},
 	{"reuseport_off", []quicreuse.Option{quicreuse.DisableReuseport(), quicreuse.DisableDraft29()}},
@@ -157,6 +161,8 @@ func testResourceManagerSuccess(t *testing.T, tc *connTestCase) {
 	go func() {
 		serverRcmgr.EXPECT().OpenConnection(network.DirInbound, false, gomock.Not(ln.Multiaddr())).Return(serverConnScope, nil)
 		serverConnScope.EXPECT().SetPeer(clientID)
+		serverConnScope.EXPECT().ReserveMemory(initialConnectionReceiveWindow, network.ReservationPriorityMedium)
+		serverConnScope.EXPECT().ReserveMemory(gomock.Any(), network.ReservationPriorityMedium).AnyTimes() // window increases
 		serverConn, err := ln.Accept()
 		require.NoError(t, err)
 		connChan <- serverConn
@@ -165,12 +171,16 @@ func testResourceManagerSuccess(t *testing.T, tc *connTestCase) {
 	connScope := mocknetwork.NewMockConnManagementScope(ctrl)
 	clientRcmgr.EXPECT().OpenConnection(network.DirOutbound, false, ln.Multiaddr()).Return(connScope, nil)
 	connScope.EXPECT().SetPeer(serverID)
+	connScope.EXPECT().ReserveMemory(initialConnectionReceiveWindow, network.ReservationPriorityMedium)
+	connScope.EXPECT().ReserveMemory(gomock.Any(), network.ReservationPriorityMedium).AnyTimes() // window increases
 	conn, err := clientTransport.Dial(context.Background(), ln.Multiaddr(), serverID)
 	require.NoError(t, err)
 	serverConn := <-connChan
 	t.Log("received conn")
-	connScope.EXPECT().Done().MinTimes(1) // for dialed connections, we might call Done multiple times
+	connScope.EXPECT().ReleaseMemory(gomock.Any()) // the receive window
+	connScope.EXPECT().Done().MinTimes(1)          // for dialed connections, we might call Done multiple times
 	conn.Close()
+	serverConnScope.EXPECT().ReleaseMemory(gomock.Any())
 	serverConnScope.EXPECT().Done()
 	serverConn.Close()
 }
@@ -207,6 +217,43 @@ func testResourceManagerDialDenied(t *testing.T, tc *connTestCase) {
 
 }
 
+func TestResourceManagerInitialWindowDenied(t *testing.T) {
+	for _, tc := range connTestCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			testResourceManagerInitialWindowDenied(t, tc)
+		})
+	}
+}
+
+func testResourceManagerInitialWindowDenied(t *testing.T, tc *connTestCase) {
+	serverID, serverKey := createPeer(t)
+	_, clientKey := createPeer(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	serverTransport, err := NewTransport(serverKey, newConnManager(t, tc.Options...), nil, nil, nil)
+	require.NoError(t, err)
+	defer serverTransport.(io.Closer).Close()
+	ln, err := serverTransport.Listen(ma.StringCast("/ip4/127.0.0.1/udp/0/quic-v1"))
+	require.NoError(t, err)
+	defer ln.Close()
+
+	rcmgr := mocknetwork.NewMockResourceManager(ctrl)
+	clientTransport, err := NewTransport(clientKey, newConnManager(t, tc.Options...), nil, nil, rcmgr)
+	require.NoError(t, err)
+	defer clientTransport.(io.Closer).Close()
+
+	connScope := mocknetwork.NewMockConnManagementScope(ctrl)
+	rerr := errors.New("nope")
+	rcmgr.EXPECT().OpenConnection(network.DirOutbound, false, ln.Multiaddr()).Return(connScope, nil)
+	connScope.EXPECT().SetPeer(serverID)
+	connScope.EXPECT().ReserveMemory(initialConnectionReceiveWindow, network.ReservationPriorityMedium).Return(rerr)
+	connScope.EXPECT().Done()
+
+	_, err = clientTransport.Dial(context.Background(), ln.Multiaddr(), serverID)
+	require.ErrorIs(t, err, rerr)
+}
+
 func TestResourceManagerAcceptDenied(t *testing.T) {
 	for _, tc := range connTestCases {
 		t.Run(tc.Name, func(t *testing.T) {
@@ -249,6 +296,7 @@ func testResourceManagerAcceptDenied(t *testing.T, tc *connTestCase) {
 	clientConnScope := mocknetwork.NewMockConnManagementScope(ctrl)
 	clientRcmgr.EXPECT().OpenConnection(network.DirOutbound, false, ln.Multiaddr()).Return(clientConnScope, nil)
 	clientConnScope.EXPECT().SetPeer(serverID)
+	clientConnScope.EXPECT().ReserveMemory(gomock.Any(), network.ReservationPriorityMedium).AnyTimes()
 	// In rare instances, the connection gating error will already occur on Dial.
 	// In that case, Done is called on the connection scope.
 	clientConnScope.EXPECT().Done().MaxTimes(1)
@@ -121,6 +121,11 @@ func (l *listener) setupConnWithScope(qconn quic.Connection, connScope network.C
 		log.Debugw("resource manager blocked incoming connection for peer", "peer", remotePeerID, "addr", qconn.RemoteAddr(), "error", err)
 		return nil, err
 	}
+	window, err := l.transport.connManager.ReserveReceiveWindow(connScope)
+	if err != nil {
+		log.Debugw("resource manager blocked incoming connection for peer", "peer", remotePeerID, "addr", qconn.RemoteAddr(), "error", err)
+		return nil, err
+	}
 
 	localMultiaddr, found := l.localMultiaddrs[qconn.ConnectionState().Version]
 	if !found {
@@ -131,6 +136,7 @@ func (l *listener) setupConnWithScope(qconn quic.Connection, connScope network.C
 		quicConn:        qconn,
 		transport:       l.transport,
 		scope:           connScope,
+		window:          window,
 		localPeer:       l.localPeer,
 		localMultiaddr:  localMultiaddr,
 		remoteMultiaddr: remoteMultiaddr,
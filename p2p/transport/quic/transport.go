@@ -134,6 +134,12 @@ func (t *transport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p pee
 	if err != nil {
 		return nil, err
 	}
+	window, err := t.connManager.ReserveReceiveWindow(scope)
+	if err != nil {
+		log.Debugw("resource manager blocked outgoing connection for peer", "peer", p, "addr", raddr, "error", err)
+		pconn.CloseWithError(1, "")
+		return nil, err
+	}
 
 	// Should be ready by this point, don't block.
 	var remotePubKey ic.PubKey
@@ -155,15 +161,18 @@ func (t *transport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p pee
 		quicConn:        pconn,
 		transport:       t,
 		scope:           scope,
+		window:          window,
 		localPeer:       t.localPeer,
 		localMultiaddr:  localMultiaddr,
 		remotePubKey:    remotePubKey,
 		remotePeerID:    p,
 		remoteMultiaddr: raddr,
 	}
-	if t.gater != nil && !t.gater.InterceptSecured(network.DirOutbound, p, c) {
-		pconn.CloseWithError(errorCodeConnectionGating, "connection gated")
-		return nil, fmt.Errorf("secured connection gated")
+	if t.gater != nil {
+		if r := connmgr.GateSecured(t.gater, network.DirOutbound, p, c); r != nil {
+			pconn.CloseWithError(errorCodeConnectionGating, "connection gated")
+			return nil, fmt.Errorf("secured connection gated: %w", &connmgr.GatedError{Reason: *r})
+		}
 	}
 	t.addConn(pconn, c)
 	return c, nil
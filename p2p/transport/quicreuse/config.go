@@ -8,10 +8,11 @@ import (
 )
 
 var quicConfig = &quic.Config{
-	MaxIncomingStreams:         256,
-	MaxIncomingUniStreams:      5,              // allow some unidirectional streams, in case we speak WebTransport
-	MaxStreamReceiveWindow:     10 * (1 << 20), // 10 MB
-	MaxConnectionReceiveWindow: 15 * (1 << 20), // 15 MB
+	MaxIncomingStreams:             256,
+	MaxIncomingUniStreams:          5,              // allow some unidirectional streams, in case we speak WebTransport
+	MaxStreamReceiveWindow:         10 * (1 << 20), // 10 MB
+	InitialConnectionReceiveWindow: 768 << 10,      // 768 KB, reserved by ReserveReceiveWindow
+	MaxConnectionReceiveWindow:     15 * (1 << 20), // 15 MB
 	RequireAddressValidation: func(net.Addr) bool {
 		// TODO(#1535): require source address validation when under load
 		return false
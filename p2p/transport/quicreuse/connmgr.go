@@ -7,6 +7,8 @@ import (
 	"net"
 	"sync"
 
+	"github.com/libp2p/go-libp2p/p2p/net/capture"
+
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/quic-go/quic-go"
@@ -21,6 +23,7 @@ type ConnManager struct {
 	enableDraft29   bool
 	enableReuseport bool
 	enableMetrics   bool
+	capture         *capture.Capturer
 
 	serverConfig *quic.Config
 	clientConfig *quic.Config
@@ -56,6 +59,9 @@ func NewConnManager(statelessResetKey quic.StatelessResetKey, opts ...Option) (*
 	if cm.enableMetrics {
 		tracers = append(tracers, newMetricsTracer())
 	}
+	if cm.capture != nil {
+		tracers = append(tracers, &captureTracer{capturer: cm.capture})
+	}
 	if len(tracers) > 0 {
 		quicConf.Tracer = quiclogging.NewMultiplexedTracer(tracers...)
 	}
@@ -1,5 +1,7 @@
 package quicreuse
 
+import "github.com/libp2p/go-libp2p/p2p/net/capture"
+
 type Option func(*ConnManager) error
 
 func DisableReuseport() Option {
@@ -19,6 +21,16 @@ func DisableDraft29() Option {
 	}
 }
 
+// EnableCapture passes summaries of the QUIC packets sent and received on the
+// connections to the capture sessions of c, see package capture. The packets are
+// encrypted, so their bytes aren't captured.
+func EnableCapture(c *capture.Capturer) Option {
+	return func(m *ConnManager) error {
+		m.capture = c
+		return nil
+	}
+}
+
 // EnableMetrics enables Prometheus metrics collection.
 func EnableMetrics() Option {
 	return func(m *ConnManager) error {
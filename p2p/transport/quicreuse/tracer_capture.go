@@ -0,0 +1,118 @@
+package quicreuse
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/net/capture"
+
+	"github.com/quic-go/quic-go/logging"
+)
+
+// captureTracer passes summaries of the QUIC packets to the capture sessions.
+type captureTracer struct {
+	logging.NullTracer
+	capturer *capture.Capturer
+}
+
+var _ logging.Tracer = &captureTracer{}
+
+func (t *captureTracer) TracerForConnection(context.Context, logging.Perspective, logging.ConnectionID) logging.ConnectionTracer {
+	return &captureConnTracer{capturer: t.capturer}
+}
+
+type connAddrs struct {
+	local, remote net.Addr
+}
+
+type captureConnTracer struct {
+	logging.NullConnectionTracer
+	capturer *capture.Capturer
+	addrs    atomic.Pointer[connAddrs]
+}
+
+var _ logging.ConnectionTracer = &captureConnTracer{}
+
+func (t *captureConnTracer) StartedConnection(local, remote net.Addr, _, _ logging.ConnectionID) {
+	t.addrs.Store(&connAddrs{local: local, remote: remote})
+}
+
+func (t *captureConnTracer) capture(sent bool, packetType logging.PacketType, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) {
+	if !t.capturer.Active() {
+		return
+	}
+	addrs := t.addrs.Load()
+	if addrs == nil {
+		return
+	}
+	t.capturer.Capture(capture.Frame{
+		Time:    time.Now(),
+		Sent:    sent,
+		Local:   addrs.local,
+		Remote:  addrs.remote,
+		Size:    int(size),
+		Summary: summarizePacket(packetType, ack, frames),
+	}, nil)
+}
+
+func (t *captureConnTracer) SentLongHeaderPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) {
+	t.capture(true, logging.PacketTypeFromHeader(&hdr.Header), size, ack, frames)
+}
+
+func (t *captureConnTracer) SentShortHeaderPacket(_ *logging.ShortHeader, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) {
+	t.capture(true, logging.PacketType1RTT, size, ack, frames)
+}
+
+func (t *captureConnTracer) ReceivedLongHeaderPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, frames []logging.Frame) {
+	t.capture(false, logging.PacketTypeFromHeader(&hdr.Header), size, nil, frames)
+}
+
+func (t *captureConnTracer) ReceivedShortHeaderPacket(_ *logging.ShortHeader, size logging.ByteCount, frames []logging.Frame) {
+	t.capture(false, logging.PacketType1RTT, size, nil, frames)
+}
+
+func packetTypeName(t logging.PacketType) string {
+	switch t {
+	case logging.PacketTypeInitial:
+		return "Initial"
+	case logging.PacketTypeHandshake:
+		return "Handshake"
+	case logging.PacketTypeRetry:
+		return "Retry"
+	case logging.PacketType0RTT:
+		return "0-RTT"
+	case logging.PacketTypeVersionNegotiation:
+		return "VersionNegotiation"
+	case logging.PacketType1RTT:
+		return "1-RTT"
+	case logging.PacketTypeStatelessReset:
+		return "StatelessReset"
+	default:
+		return "Unknown"
+	}
+}
+
+// summarizePacket describes a packet by its type and the types of its frames, e.g.
+// "1-RTT: Ack, Stream".
+func summarizePacket(t logging.PacketType, ack *logging.AckFrame, frames []logging.Frame) string {
+	var b strings.Builder
+	b.WriteString(packetTypeName(t))
+	sep := ": "
+	if ack != nil {
+		b.WriteString(sep)
+		b.WriteString("Ack")
+		sep = ", "
+	}
+	for _, f := range frames {
+		name := fmt.Sprintf("%T", f)
+		name = name[strings.LastIndexByte(name, '.')+1:]
+		b.WriteString(sep)
+		b.WriteString(strings.TrimSuffix(name, "Frame"))
+		sep = ", "
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package quicreuse
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/net/capture"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizePacket(t *testing.T) {
+	require.Equal(t, "Initial", summarizePacket(logging.PacketTypeInitial, nil, nil))
+	require.Equal(t, "1-RTT: Ack, Stream, Ping", summarizePacket(
+		logging.PacketType1RTT,
+		&logging.AckFrame{},
+		[]logging.Frame{&logging.StreamFrame{}, &logging.PingFrame{}},
+	))
+}
+
+func TestCapture(t *testing.T) {
+	c := capture.New()
+	cm, err := NewConnManager([32]byte{}, EnableCapture(c))
+	require.NoError(t, err)
+	defer cm.Close()
+
+	_, tlsConf := getTLSConfForProto(t, "proto")
+	ln, err := cm.ListenQUIC(ma.StringCast("/ip4/127.0.0.1/udp/0/quic-v1"), tlsConf, nil)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	var mx sync.Mutex
+	var frames []capture.Frame
+	stop, err := c.Start(capture.Session{
+		Hook: func(f capture.Frame) {
+			mx.Lock()
+			defer mx.Unlock()
+			frames = append(frames, f)
+		},
+		Duration: time.Minute,
+	})
+	require.NoError(t, err)
+	defer stop()
+
+	_, err = connectWithProtocol(t, ln.Addr(), "proto")
+	require.NoError(t, err)
+
+	mx.Lock()
+	defer mx.Unlock()
+	require.NotEmpty(t, frames)
+	f := frames[0]
+	require.False(t, f.Sent)
+	require.Equal(t, ln.Addr().String(), f.Local.String())
+	require.True(t, strings.HasPrefix(f.Summary, "Initial: "), f.Summary)
+	require.Contains(t, f.Summary, "Crypto")
+	require.Positive(t, f.Size)
+	require.Nil(t, f.Data)
+}
@@ -0,0 +1,75 @@
+package quicreuse
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+var errWindowClosed = errors.New("receive window closed")
+
+// ReceiveWindow accounts for the memory of the connection flow control receive window
+// of a QUIC connection in the resource scope of the connection.
+//
+// A connection starts with the initial receive window of the QUIC config it was created
+// with, which is reserved by ConnManager.ReserveReceiveWindow. quic-go then reports the
+// increases of the window to the AllowConnectionWindowIncrease callback, which must call
+// Grow. QUIC flow control windows never shrink while the connection is open, so the
+// window is released by Close once the connection is closed.
+type ReceiveWindow struct {
+	scope network.ResourceScope
+
+	mx     sync.Mutex
+	size   int
+	closed bool
+}
+
+// ReserveReceiveWindow reserves the memory of the initial receive window of a QUIC
+// connection of the connection manager in scope.
+func (c *ConnManager) ReserveReceiveWindow(scope network.ResourceScope) (*ReceiveWindow, error) {
+	w := &ReceiveWindow{scope: scope}
+	if err := w.reserve(int(c.clientConfig.InitialConnectionReceiveWindow)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Grow reserves the memory for an increase of the window by delta bytes. It returns
+// false if the reservation is denied, or if the window was closed, in which case the
+// window must not be increased.
+func (w *ReceiveWindow) Grow(delta uint64) bool {
+	return w.reserve(int(delta)) == nil
+}
+
+func (w *ReceiveWindow) reserve(n int) error {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if w.closed {
+		return errWindowClosed
+	}
+	if err := w.scope.ReserveMemory(n, network.ReservationPriorityMedium); err != nil {
+		return err
+	}
+	w.size += n
+	return nil
+}
+
+// Size returns the size of the window, which is the memory reserved for it.
+func (w *ReceiveWindow) Size() int {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return w.size
+}
+
+// Close releases the memory reserved for the window.
+func (w *ReceiveWindow) Close() {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.scope.ReleaseMemory(w.size)
+	w.size = 0
+}
@@ -0,0 +1,66 @@
+package quicreuse
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memoryScope struct {
+	network.ResourceScope
+	reserved int
+	limit    int
+}
+
+func (s *memoryScope) ReserveMemory(size int, _ uint8) error {
+	if s.reserved+size > s.limit {
+		return errors.New("limit exceeded")
+	}
+	s.reserved += size
+	return nil
+}
+
+func (s *memoryScope) ReleaseMemory(size int) { s.reserved -= size }
+
+func TestReceiveWindow(t *testing.T) {
+	cm, err := NewConnManager([32]byte{})
+	require.NoError(t, err)
+	defer cm.Close()
+
+	initial := int(quicConfig.InitialConnectionReceiveWindow)
+	scope := &memoryScope{limit: 2 * initial}
+	w, err := cm.ReserveReceiveWindow(scope)
+	require.NoError(t, err)
+	require.Equal(t, initial, w.Size())
+	require.Equal(t, initial, scope.reserved)
+
+	require.True(t, w.Grow(uint64(initial)))
+	require.Equal(t, 2*initial, w.Size())
+	require.Equal(t, 2*initial, scope.reserved)
+	// the scope doesn't allow the window to grow any further
+	require.False(t, w.Grow(1))
+	require.Equal(t, 2*initial, w.Size())
+
+	w.Close()
+	require.Zero(t, scope.reserved)
+	// closing twice doesn't release the memory twice
+	w.Close()
+	require.Zero(t, scope.reserved)
+	// a closed window can't grow
+	require.False(t, w.Grow(1))
+	require.Zero(t, scope.reserved)
+}
+
+func TestReceiveWindowDenied(t *testing.T) {
+	cm, err := NewConnManager([32]byte{})
+	require.NoError(t, err)
+	defer cm.Close()
+
+	scope := &memoryScope{limit: int(quicConfig.InitialConnectionReceiveWindow) - 1}
+	_, err = cm.ReserveReceiveWindow(scope)
+	require.Error(t, err)
+	require.Zero(t, scope.reserved)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/net/capture"
 	"github.com/libp2p/go-libp2p/p2p/net/reuseport"
 
 	logging "github.com/ipfs/go-log/v2"
@@ -113,6 +114,16 @@ func WithMetrics() Option {
 	}
 }
 
+// WithCapture passes the bytes sent and received on the connections to the capture
+// sessions of c, see package capture. The bytes are captured before the connection is
+// secured.
+func WithCapture(c *capture.Capturer) Option {
+	return func(tr *TcpTransport) error {
+		tr.capture = c
+		return nil
+	}
+}
+
 // TcpTransport is the TCP transport.
 type TcpTransport struct {
 	// Connection upgrader for upgrading insecure stream connections to
@@ -121,6 +132,7 @@ type TcpTransport struct {
 
 	disableReuseport bool // Explicitly disable reuseport.
 	enableMetrics    bool
+	capture          *capture.Capturer // nil if capturing is disabled
 
 	// TCP connect timeout
 	connectTimeout time.Duration
@@ -212,6 +224,7 @@ func (t *TcpTransport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p
 			return nil, err
 		}
 	}
+	c = t.capture.WrapConn(c)
 	direction := network.DirOutbound
 	if ok, isClient, _ := network.GetSimultaneousConnect(ctx); ok && !isClient {
 		direction = network.DirInbound
@@ -240,6 +253,7 @@ func (t *TcpTransport) Listen(laddr ma.Multiaddr) (transport.Listener, error) {
 	if t.enableMetrics {
 		list = newTracingListener(&tcpListener{list, 0})
 	}
+	list = t.capture.WrapListener(list)
 	return t.upgrader.UpgradeListener(t, list), nil
 }
 
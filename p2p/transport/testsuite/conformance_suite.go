@@ -0,0 +1,371 @@
+package ttransport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mrand "math/rand"
+
+	"github.com/libp2p/go-libp2p-testing/race"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/transport"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// connect listens on maddr with ta and dials the listener with tb. It returns both
+// ends of the connection, which are closed when the test completes.
+func connect(t *testing.T, ta, tb transport.Transport, maddr ma.Multiaddr, peerA peer.ID) (dialed, accepted transport.CapableConn) {
+	t.Helper()
+
+	l, err := ta.Listen(maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	acceptCh := make(chan transport.CapableConn, 1)
+	go func() {
+		// errors are reported by the dialing side, the test may be over by then
+		c, _ := l.Accept()
+		acceptCh <- c
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), StressTestTimeout)
+	defer cancel()
+	dialed, err = tb.Dial(ctx, l.Multiaddr(), peerA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dialed.Close() })
+
+	select {
+	case accepted = <-acceptCh:
+	case <-ctx.Done():
+		t.Fatal("timed out accepting the connection")
+	}
+	if accepted == nil {
+		t.Fatal("failed to accept the connection")
+	}
+	t.Cleanup(func() { accepted.Close() })
+	return dialed, accepted
+}
+
+// openStreamPair opens a stream on dialed and accepts it on accepted. Some transports
+// don't open the stream until data is written, so testData is written to it and read
+// on the other side.
+func openStreamPair(t *testing.T, dialed, accepted transport.CapableConn) (local, remote network.MuxedStream) {
+	t.Helper()
+
+	local, err := dialed.OpenStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { local.Reset() })
+	if _, err := local.Write(testData); err != nil {
+		t.Fatal(err)
+	}
+
+	remote, err = accepted.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Reset() })
+	buf := make([]byte, len(testData))
+	if _, err := io.ReadFull(remote, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(testData, buf) {
+		t.Fatalf("expected %s, got %s", testData, buf)
+	}
+	return local, remote
+}
+
+func isTimeout(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// SubtestStreamHalfClose checks that closing a stream for writing delivers an EOF to
+// the remote, and that the remote can still write to the stream afterwards.
+func SubtestStreamHalfClose(t *testing.T, ta, tb transport.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	dialed, accepted := connect(t, ta, tb, maddr, peerA)
+	local, remote := openStreamPair(t, dialed, accepted)
+
+	if err := local.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Write(testData); err == nil {
+		t.Error("writing after CloseWrite should have failed")
+	}
+
+	b, err := io.ReadAll(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 0 {
+		t.Fatalf("expected EOF, got %q", b)
+	}
+	if n, err := remote.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("expected EOF on subsequent reads, got %d, %v", n, err)
+	}
+
+	// the remote end is still open for writing
+	if _, err := remote.Write(testData); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	b, err = io.ReadAll(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(testData, b) {
+		t.Fatalf("expected %s, got %s", testData, b)
+	}
+
+	if err := local.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := remote.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// SubtestStreamReadDeadline checks that a read deadline interrupts a blocked read
+// with a timeout error, and that the stream is still usable afterwards.
+func SubtestStreamReadDeadline(t *testing.T, ta, tb transport.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	dialed, accepted := connect(t, ta, tb, maddr, peerA)
+	local, remote := openStreamPair(t, dialed, accepted)
+
+	if err := remote.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err := remote.Read(make([]byte, 1))
+	if !isTimeout(err) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if took := time.Since(start); took < 50*time.Millisecond || took > 5*time.Second {
+		t.Errorf("read returned after %s, expected 100ms", took)
+	}
+
+	// clearing the deadline makes the stream usable again
+	if err := remote.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Write(testData); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(testData))
+	if _, err := io.ReadFull(remote, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(testData, buf) {
+		t.Fatalf("expected %s, got %s", testData, buf)
+	}
+}
+
+// SubtestStreamWriteDeadline checks that a write deadline interrupts a write blocked
+// because the remote doesn't read, with a timeout error.
+func SubtestStreamWriteDeadline(t *testing.T, ta, tb transport.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	dialed, accepted := connect(t, ta, tb, maddr, peerA)
+	local, _ := openStreamPair(t, dialed, accepted)
+
+	if err := local.SetWriteDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	// flow control has to block the writer long before this
+	const maxWritten = 256 << 20
+	buf := make([]byte, 64<<10)
+	var err error
+	for written := 0; err == nil; written += len(buf) {
+		if written > maxWritten {
+			t.Fatalf("wrote %d bytes without the remote reading", written)
+		}
+		_, err = local.Write(buf)
+	}
+	if !isTimeout(err) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
+
+// SubtestStreamResetPropagation checks that resetting one end of a stream fails the
+// reads and writes on the other end with network.ErrReset, in both directions.
+func SubtestStreamResetPropagation(t *testing.T, ta, tb transport.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	for _, resetDialer := range []bool{true, false} {
+		resetDialer := resetDialer
+		name := "listener resets"
+		if resetDialer {
+			name = "dialer resets"
+		}
+		t.Run(name, func(t *testing.T) {
+			dialed, accepted := connect(t, ta, tb, maddr, peerA)
+			local, remote := openStreamPair(t, dialed, accepted)
+			resetter, other := remote, local
+			if resetDialer {
+				resetter, other = local, remote
+			}
+
+			if err := resetter.Reset(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadAll(other); !errors.Is(err, network.ErrReset) {
+				t.Errorf("expected reads to fail with ErrReset, got %v", err)
+			}
+
+			// writes may be buffered until the reset is received
+			deadline := time.Now().Add(StressTestTimeout)
+			var err error
+			for err == nil && time.Now().Before(deadline) {
+				_, err = other.Write(testData)
+				time.Sleep(10 * time.Millisecond)
+			}
+			if !errors.Is(err, network.ErrReset) {
+				t.Errorf("expected writes to fail with ErrReset, got %v", err)
+			}
+		})
+	}
+}
+
+// SubtestLargeTransfer echoes a large amount of data on a single stream, with both
+// ends reading and writing concurrently.
+func SubtestLargeTransfer(t *testing.T, ta, tb transport.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	size := 32 << 20
+	if race.WithRace() {
+		size = 8 << 20
+	}
+
+	dialed, accepted := connect(t, ta, tb, maddr, peerA)
+	local, remote := openStreamPair(t, dialed, accepted)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(remote, remote); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := remote.CloseWrite(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	sent := sha256.New()
+	go func() {
+		defer wg.Done()
+		for written := 0; written < size; {
+			chunk := randBuf(256 << 10)
+			if rest := size - written; rest < len(chunk) {
+				chunk = chunk[:rest]
+			}
+			sent.Write(chunk)
+			n, err := local.Write(chunk)
+			written += n
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if err := local.CloseWrite(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	received := sha256.New()
+	n, err := io.Copy(received, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(size) {
+		t.Fatalf("expected to receive %d bytes, got %d", size, n)
+	}
+	wg.Wait()
+	if !bytes.Equal(sent.Sum(nil), received.Sum(nil)) {
+		t.Fatal("received data doesn't match the data sent")
+	}
+}
+
+// SubtestConcurrentStreams opens many streams from both ends of a connection at
+// the same time, and echoes a message on each of them.
+func SubtestConcurrentStreams(t *testing.T, ta, tb transport.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	streams := 100
+	if race.WithRace() {
+		streams = 20
+	}
+
+	dialed, accepted := connect(t, ta, tb, maddr, peerA)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, c := range []transport.CapableConn{dialed, accepted} {
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			echo(t, c)
+		}()
+	}
+	// the echoing goroutines return once both connections are closed
+	defer dialed.Close()
+	defer accepted.Close()
+
+	var streamsWg sync.WaitGroup
+	for i := 0; i < streams; i++ {
+		for _, c := range []transport.CapableConn{dialed, accepted} {
+			c := c
+			streamsWg.Add(1)
+			go func() {
+				defer streamsWg.Done()
+				s, err := c.OpenStream(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				msg := randBuf(mrand.Intn(32<<10) + 1)
+				if _, err := s.Write(msg); err != nil {
+					t.Error(err)
+					s.Reset()
+					return
+				}
+				if err := s.CloseWrite(); err != nil {
+					t.Error(err)
+					s.Reset()
+					return
+				}
+				b, err := io.ReadAll(s)
+				if err != nil {
+					t.Error(err)
+					s.Reset()
+					return
+				}
+				if !bytes.Equal(msg, b) {
+					t.Errorf("expected %d echoed bytes, got %d", len(msg), len(b))
+				}
+				s.Close()
+			}()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		streamsWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(StressTestTimeout):
+		t.Error("timed out echoing on concurrent streams")
+	}
+}
@@ -1,3 +1,7 @@
+// Package ttransport is a conformance test suite for transport.Transport
+// implementations. Transports implemented outside of this repository can validate
+// their stream semantics (half-close, deadlines, reset propagation, large transfers
+// and concurrent streams) by calling SubtestTransport from their tests.
 package ttransport
 
 import (
@@ -26,12 +30,22 @@ var Subtests = []func(t *testing.T, ta, tb transport.Transport, maddr ma.Multiad
 	SubtestStress1Conn100Stream100Msg10MB,
 	SubtestStreamOpenStress,
 	SubtestStreamReset,
+
+	// Stream semantics every transport has to provide.
+	SubtestStreamHalfClose,
+	SubtestStreamReadDeadline,
+	SubtestStreamWriteDeadline,
+	SubtestStreamResetPropagation,
+	SubtestLargeTransfer,
+	SubtestConcurrentStreams,
 }
 
 func getFunctionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 }
 
+// SubtestTransport runs all Subtests against ta and tb. ta listens on addr, and tb
+// dials it, expecting to connect to peerA.
 func SubtestTransport(t *testing.T, ta, tb transport.Transport, addr string, peerA peer.ID) {
 	maddr, err := ma.NewMultiaddr(addr)
 	if err != nil {
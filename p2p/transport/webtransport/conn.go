@@ -5,6 +5,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/network"
 	tpt "github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
 
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/quic-go/webtransport-go"
@@ -30,17 +31,19 @@ type conn struct {
 	transport *transport
 	session   *webtransport.Session
 
-	scope network.ConnScope
+	scope  network.ConnScope
+	window *quicreuse.ReceiveWindow
 }
 
 var _ tpt.CapableConn = &conn{}
 
-func newConn(tr *transport, sess *webtransport.Session, sconn *connSecurityMultiaddrs, scope network.ConnScope) *conn {
+func newConn(tr *transport, sess *webtransport.Session, sconn *connSecurityMultiaddrs, scope network.ConnScope, window *quicreuse.ReceiveWindow) *conn {
 	return &conn{
 		connSecurityMultiaddrs: sconn,
 		transport:              tr,
 		session:                sess,
 		scope:                  scope,
+		window:                 window,
 	}
 }
 
@@ -61,7 +64,7 @@ func (c *conn) AcceptStream() (network.MuxedStream, error) {
 }
 
 func (c *conn) allowWindowIncrease(size uint64) bool {
-	return c.scope.ReserveMemory(int(size), network.ReservationPriorityMedium) == nil
+	return c.window.Grow(size)
 }
 
 // Close closes the connection.
@@ -69,7 +72,9 @@ func (c *conn) allowWindowIncrease(size uint64) bool {
 // garbage collection to properly work in this package.
 func (c *conn) Close() error {
 	c.transport.removeConn(c.session)
-	return c.session.CloseWithError(0, "")
+	err := c.session.CloseWithError(0, "")
+	c.window.Close()
+	return err
 }
 
 func (c *conn) IsClosed() bool           { return c.session.Context().Err() != nil }
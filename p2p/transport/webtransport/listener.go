@@ -136,8 +136,14 @@ func (l *listener) httpHandlerWithConnScope(w http.ResponseWriter, r *http.Reque
 		sess.CloseWithError(1, "")
 		return err
 	}
+	window, err := l.transport.connManager.ReserveReceiveWindow(connScope)
+	if err != nil {
+		log.Debugw("resource manager blocked incoming connection for peer", "peer", sconn.RemotePeer(), "addr", r.RemoteAddr, "error", err)
+		sess.CloseWithError(1, "")
+		return err
+	}
 
-	conn := newConn(l.transport, sess, sconn, connScope)
+	conn := newConn(l.transport, sess, sconn, connScope, window)
 	l.transport.addConn(sess, conn)
 	select {
 	case l.queue <- conn:
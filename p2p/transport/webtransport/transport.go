@@ -163,16 +163,24 @@ func (t *transport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p pee
 	if err != nil {
 		return nil, err
 	}
+	window, err := t.connManager.ReserveReceiveWindow(scope)
+	if err != nil {
+		log.Debugw("resource manager blocked outgoing connection for peer", "peer", p, "addr", raddr, "error", err)
+		sess.CloseWithError(1, "")
+		return nil, err
+	}
 	sconn, err := t.upgrade(ctx, sess, p, certHashes)
 	if err != nil {
 		sess.CloseWithError(1, "")
 		return nil, err
 	}
-	if t.gater != nil && !t.gater.InterceptSecured(network.DirOutbound, p, sconn) {
-		sess.CloseWithError(errorCodeConnectionGating, "")
-		return nil, fmt.Errorf("secured connection gated")
+	if t.gater != nil {
+		if r := connmgr.GateSecured(t.gater, network.DirOutbound, p, sconn); r != nil {
+			sess.CloseWithError(errorCodeConnectionGating, "")
+			return nil, fmt.Errorf("secured connection gated: %w", &connmgr.GatedError{Reason: *r})
+		}
 	}
-	conn := newConn(t, sess, sconn, scope)
+	conn := newConn(t, sess, sconn, scope, window)
 	t.addConn(sess, conn)
 	return conn, nil
 }
@@ -18,6 +18,7 @@ import (
 	"testing/quick"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/connmgr"
 	ic "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/network"
 	mocknetwork "github.com/libp2p/go-libp2p/core/network/mocks"
@@ -384,7 +385,10 @@ func TestConnectionGaterDialing(t *testing.T) {
 	require.NoError(t, err)
 	defer cl.(io.Closer).Close()
 	_, err = cl.Dial(context.Background(), ln.Multiaddr(), serverID)
-	require.EqualError(t, err, "secured connection gated")
+	require.ErrorContains(t, err, "secured connection gated")
+	var gerr *connmgr.GatedError
+	require.ErrorAs(t, err, &gerr)
+	require.Equal(t, connmgr.GatingStageSecured, gerr.Reason.Stage)
 }
 
 func TestConnectionGaterInterceptAccept(t *testing.T) {
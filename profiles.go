@@ -0,0 +1,143 @@
+package libp2p
+
+// This file contains the configuration profiles.
+
+import (
+	"time"
+
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	ws "github.com/libp2p/go-libp2p/p2p/transport/websocket"
+	webtransport "github.com/libp2p/go-libp2p/p2p/transport/webtransport"
+)
+
+// profileOption is an option of a profile, applied if fallback returns true once
+// the other options were applied.
+type profileOption struct {
+	fallback func(cfg *Config) bool
+	opt      Option
+}
+
+// profile returns an option applying opts once the other options were applied, by
+// FallbackDefaults. Each of opts only sets what the other options, and the profiles
+// given after this one, left unset.
+func profile(opts ...profileOption) Option {
+	return func(cfg *Config) error {
+		cfg.Profiles = append(cfg.Profiles, func(cfg *Config) error {
+			for _, o := range opts {
+				if !o.fallback(cfg) {
+					continue
+				}
+				if err := cfg.Apply(o.opt); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return nil
+	}
+}
+
+func noTransports(cfg *Config) bool         { return cfg.Transports == nil }
+func noListenAddrs(cfg *Config) bool        { return cfg.Transports == nil && cfg.ListenAddrs == nil }
+func noResourceManager(cfg *Config) bool    { return cfg.ResourceManager == nil }
+func noConnectionManager(cfg *Config) bool  { return cfg.ConnManager == nil }
+func noDialTimeout(cfg *Config) bool        { return cfg.DialTimeout == 0 }
+func noNegotiationTimeout(cfg *Config) bool { return cfg.OutboundNegotiationTimeout == 0 }
+
+func profileConnectionManager(low, high int, grace time.Duration) Option {
+	return func(cfg *Config) error {
+		mgr, err := connmgr.NewConnManager(low, high, connmgr.WithGracePeriod(grace))
+		if err != nil {
+			return err
+		}
+		return cfg.Apply(ConnectionManager(mgr))
+	}
+}
+
+// ProfileServer configures libp2p for a publicly reachable node with plenty of
+// resources: it listens on TCP, QUIC, WebSocket and WebTransport, and keeps up to
+// 900 connections.
+//
+// Like all profiles, it only sets the transports, listen addresses, connection
+// manager, resource manager and timeouts that the other options leave unset, so
+// they can be overridden by further options. If several profiles are given, the
+// last one wins.
+func ProfileServer() Option {
+	return profile(
+		profileOption{fallback: noListenAddrs, opt: ListenAddrStrings(
+			"/ip4/0.0.0.0/tcp/0",
+			"/ip4/0.0.0.0/tcp/0/ws",
+			"/ip4/0.0.0.0/udp/0/quic-v1",
+			"/ip4/0.0.0.0/udp/0/quic-v1/webtransport",
+			"/ip6/::/tcp/0",
+			"/ip6/::/tcp/0/ws",
+			"/ip6/::/udp/0/quic-v1",
+			"/ip6/::/udp/0/quic-v1/webtransport",
+		)},
+		profileOption{fallback: noTransports, opt: ChainOptions(
+			Transport(tcp.NewTCPTransport),
+			Transport(quic.NewTransport),
+			Transport(ws.New),
+			Transport(webtransport.New),
+		)},
+		profileOption{fallback: noConnectionManager, opt: profileConnectionManager(600, 900, time.Minute)},
+	)
+}
+
+// ProfileBrowserCompatible configures libp2p for a node browsers can connect to: it
+// listens on WebSocket and WebTransport. There is no WebRTC transport yet, so the
+// browsers need to support one of those. The non-browser peers are also reached
+// over WebSocket and WebTransport.
+//
+// See ProfileServer for how profiles combine with the other options.
+func ProfileBrowserCompatible() Option {
+	return profile(
+		profileOption{fallback: noListenAddrs, opt: ListenAddrStrings(
+			"/ip4/0.0.0.0/tcp/0/ws",
+			"/ip4/0.0.0.0/udp/0/quic-v1/webtransport",
+			"/ip6/::/tcp/0/ws",
+			"/ip6/::/udp/0/quic-v1/webtransport",
+		)},
+		profileOption{fallback: noTransports, opt: ChainOptions(
+			Transport(ws.New),
+			Transport(webtransport.New),
+		)},
+	)
+}
+
+// ProfileLowPower configures libp2p for a node with little memory, CPU or bandwidth,
+// such as a mobile or embedded device: it only uses TCP and QUIC, keeps up to 40
+// connections, uses the base limits of the resource manager and waits longer for
+// dials and protocol negotiations to complete.
+//
+// See ProfileServer for how profiles combine with the other options.
+func ProfileLowPower() Option {
+	return profile(
+		profileOption{fallback: noListenAddrs, opt: ListenAddrStrings(
+			"/ip4/0.0.0.0/tcp/0",
+			"/ip4/0.0.0.0/udp/0/quic-v1",
+			"/ip6/::/tcp/0",
+			"/ip6/::/udp/0/quic-v1",
+		)},
+		profileOption{fallback: noTransports, opt: ChainOptions(
+			Transport(tcp.NewTCPTransport),
+			Transport(quic.NewTransport),
+		)},
+		profileOption{fallback: noConnectionManager, opt: profileConnectionManager(20, 40, 20*time.Second)},
+		profileOption{fallback: noResourceManager, opt: func(cfg *Config) error {
+			limits := rcmgr.DefaultLimits
+			SetDefaultServiceLimits(&limits)
+			// below 128MB, the base limits are used
+			mgr, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(limits.Scale(0, 0)))
+			if err != nil {
+				return err
+			}
+			return cfg.Apply(ResourceManager(mgr))
+		}},
+		profileOption{fallback: noDialTimeout, opt: WithDialTimeout(30 * time.Second)},
+		profileOption{fallback: noNegotiationTimeout, opt: OutboundNegotiationTimeout(20 * time.Second)},
+	)
+}